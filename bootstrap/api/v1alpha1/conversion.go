@@ -51,6 +51,8 @@ func (src *RKE2Config) ConvertTo(dstRaw conversion.Hub) error {
 		dst.Spec.AgentConfig.PodSecurityAdmissionConfigFile = restored.Spec.AgentConfig.PodSecurityAdmissionConfigFile
 	}
 
+	dst.Spec.MaxUserDataBytes = restored.Spec.MaxUserDataBytes
+
 	return nil
 }
 
@@ -110,6 +112,8 @@ func (src *RKE2ConfigTemplate) ConvertTo(dstRaw conversion.Hub) error {
 		dst.Spec.Template.Spec.AgentConfig.PodSecurityAdmissionConfigFile = restored.Spec.Template.Spec.AgentConfig.PodSecurityAdmissionConfigFile
 	}
 
+	dst.Spec.Template.Spec.MaxUserDataBytes = restored.Spec.Template.Spec.MaxUserDataBytes
+
 	return nil
 }
 
@@ -154,3 +158,8 @@ func Convert_v1beta1_RKE2AgentConfig_To_v1alpha1_RKE2AgentConfig(in *bootstrapv1
 	// We have to invoke conversion manually because of the added AirGappedChecksum field.
 	return autoConvert_v1beta1_RKE2AgentConfig_To_v1alpha1_RKE2AgentConfig(in, out, s)
 }
+
+func Convert_v1beta1_RKE2ConfigSpec_To_v1alpha1_RKE2ConfigSpec(in *bootstrapv1.RKE2ConfigSpec, out *RKE2ConfigSpec, s apiconversion.Scope) error {
+	// We have to invoke conversion manually because of the added MaxUserDataBytes field.
+	return autoConvert_v1beta1_RKE2ConfigSpec_To_v1alpha1_RKE2ConfigSpec(in, out, s)
+}
@@ -122,11 +122,6 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1beta1.RKE2ConfigSpec)(nil), (*RKE2ConfigSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1beta1_RKE2ConfigSpec_To_v1alpha1_RKE2ConfigSpec(a.(*v1beta1.RKE2ConfigSpec), b.(*RKE2ConfigSpec), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*RKE2ConfigStatus)(nil), (*v1beta1.RKE2ConfigStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_RKE2ConfigStatus_To_v1beta1_RKE2ConfigStatus(a.(*RKE2ConfigStatus), b.(*v1beta1.RKE2ConfigStatus), scope)
 	}); err != nil {
@@ -227,6 +222,11 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddConversionFunc((*v1beta1.RKE2ConfigSpec)(nil), (*RKE2ConfigSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1beta1_RKE2ConfigSpec_To_v1alpha1_RKE2ConfigSpec(a.(*v1beta1.RKE2ConfigSpec), b.(*RKE2ConfigSpec), scope)
+	}); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -539,14 +539,10 @@ func autoConvert_v1beta1_RKE2ConfigSpec_To_v1alpha1_RKE2ConfigSpec(in *v1beta1.R
 	if err := Convert_v1beta1_Registry_To_v1alpha1_Registry(&in.PrivateRegistriesConfig, &out.PrivateRegistriesConfig, s); err != nil {
 		return err
 	}
+	// WARNING: in.MaxUserDataBytes requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1beta1_RKE2ConfigSpec_To_v1alpha1_RKE2ConfigSpec is an autogenerated conversion function.
-func Convert_v1beta1_RKE2ConfigSpec_To_v1alpha1_RKE2ConfigSpec(in *v1beta1.RKE2ConfigSpec, out *RKE2ConfigSpec, s conversion.Scope) error {
-	return autoConvert_v1beta1_RKE2ConfigSpec_To_v1alpha1_RKE2ConfigSpec(in, out, s)
-}
-
 func autoConvert_v1alpha1_RKE2ConfigStatus_To_v1beta1_RKE2ConfigStatus(in *RKE2ConfigStatus, out *v1beta1.RKE2ConfigStatus, s conversion.Scope) error {
 	out.Ready = in.Ready
 	out.DataSecretName = (*string)(unsafe.Pointer(in.DataSecretName))
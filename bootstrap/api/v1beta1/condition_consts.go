@@ -35,6 +35,11 @@ const (
 	// and user intervention is required to get them fixed.
 	DataSecretGenerationFailedReason string = "DataSecretGenerationFailed"
 
+	// DataSecretTooLargeReason (Severity=Warning) documents a RKE2Config controller detecting that the rendered
+	// bootstrap data exceeds the configured maximum user data size; user intervention is required to reduce the
+	// size of the bootstrap data, e.g. by compressing files, or to raise the limit.
+	DataSecretTooLargeReason string = "DataSecretTooLarge"
+
 	// WaitingForClusterInfrastructureReason (Severity=Info) document a bootstrap secret generation process
 	// waiting for the cluster infrastructure to be ready.
 	//
@@ -51,3 +56,13 @@ const (
 	// and user intervention is required to get them fixed.
 	CertificatesGenerationFailedReason string = "CertificateGenerationFailed"
 )
+
+const (
+	// BootstrapDataUpToDateCondition documents whether the bootstrap data was rendered with the current templates of
+	// the bootstrap provider. It is only reported when renderer drift detection is enabled on the bootstrap provider.
+	BootstrapDataUpToDateCondition clusterv1.ConditionType = "BootstrapDataUpToDate"
+
+	// RendererChangedReason (Severity=Info) documents a RKE2Config whose bootstrap data was rendered with templates
+	// which differ materially from the current templates of the bootstrap provider.
+	RendererChangedReason string = "RendererChanged"
+)
@@ -35,6 +35,10 @@ const (
 	Ignition Format = "ignition"
 )
 
+// RendererHashAnnotation stores the hash of the renderer templates the bootstrap data was rendered with. It is set on
+// the RKE2Config and on the bootstrap data secret.
+const RendererHashAnnotation = "bootstrap.cluster.x-k8s.io/renderer-hash"
+
 // RKE2ConfigSpec defines the desired state of RKE2Config.
 type RKE2ConfigSpec struct {
 	// Files specifies extra files to be passed to user_data upon creation.
@@ -56,6 +60,13 @@ type RKE2ConfigSpec struct {
 	// PrivateRegistriesConfig defines the containerd configuration for private registries and local registry mirrors.
 	//+optional
 	PrivateRegistriesConfig Registry `json:"privateRegistriesConfig,omitempty"`
+
+	// MaxUserDataBytes is the maximum size in bytes of the rendered bootstrap data accepted by the infrastructure provider.
+	// When the rendered bootstrap data exceeds this limit, no bootstrap secret is created and the
+	// DataSecretAvailable condition reports the failure. Consider gzip compressing large files to reduce the size.
+	// +kubebuilder:validation:Minimum=1
+	//+optional
+	MaxUserDataBytes *int32 `json:"maxUserDataBytes,omitempty"`
 }
 
 // RKE2AgentConfig describes some attributes that are common to agent and server nodes.
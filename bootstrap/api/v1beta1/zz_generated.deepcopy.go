@@ -309,6 +309,11 @@ func (in *RKE2ConfigSpec) DeepCopyInto(out *RKE2ConfigSpec) {
 	}
 	in.AgentConfig.DeepCopyInto(&out.AgentConfig)
 	in.PrivateRegistriesConfig.DeepCopyInto(&out.PrivateRegistriesConfig)
+	if in.MaxUserDataBytes != nil {
+		in, out := &in.MaxUserDataBytes, &out.MaxUserDataBytes
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RKE2ConfigSpec.
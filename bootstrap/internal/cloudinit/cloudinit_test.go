@@ -17,6 +17,8 @@ limitations under the License.
 package cloudinit
 
 import (
+	"strings"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -357,3 +359,35 @@ fs_setup:
 `))
 	})
 })
+
+var _ = Describe("RendererHash", func() {
+	It("Should not change when only the templates trailing whitespace changes", func() {
+		reformatted := strings.ReplaceAll(filesTemplate, "\n", "  \n")
+		reformatted = strings.ReplaceAll(reformatted, "{{ range . }}", "{{ range . }}\t")
+		reformatted += "\n\n"
+
+		Expect(reformatted).NotTo(Equal(filesTemplate))
+		Expect(TemplatesHash(cloudConfigHeader, reformatted)).To(Equal(TemplatesHash(cloudConfigHeader, filesTemplate)))
+	})
+
+	It("Should change when the templates indentation changes", func() {
+		reindented := strings.ReplaceAll(filesTemplate, "\n", "\n  ")
+
+		Expect(TemplatesHash(cloudConfigHeader, reindented)).NotTo(Equal(TemplatesHash(cloudConfigHeader, filesTemplate)))
+	})
+
+	It("Should change when the templates output changes materially", func() {
+		changed := strings.ReplaceAll(filesTemplate, "write_files:", "files:")
+
+		Expect(TemplatesHash(cloudConfigHeader, changed)).NotTo(Equal(TemplatesHash(cloudConfigHeader, filesTemplate)))
+	})
+
+	It("Should change when content moves from one template to another", func() {
+		Expect(TemplatesHash("runcmd:", "- echo")).NotTo(Equal(TemplatesHash("runcmd: - echo", "")))
+	})
+
+	It("Should be stable", func() {
+		Expect(RendererHash()).To(Equal(RendererHash()))
+		Expect(RendererHash()).To(HaveLen(64))
+	})
+})
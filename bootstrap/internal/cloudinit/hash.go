@@ -0,0 +1,57 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// RendererHash returns the hash of the templates used to render cloud-config bootstrap data. It changes when the
+// template output changes materially, but not on trailing whitespace changes to the templates.
+func RendererHash() string {
+	return TemplatesHash(
+		cloudConfigHeader,
+		filesTemplate,
+		commandsTemplate,
+		sentinelFileCommand,
+		ntpTemplate,
+		arbitraryTemplate,
+		controlPlaneCloudInit,
+		workerCloudInit,
+	)
+}
+
+// TemplatesHash returns the hash of the given templates, ignoring the trailing whitespace of their lines and the
+// trailing blank lines. Indentation and line breaks are significant in the rendered YAML, so they change the hash.
+func TemplatesHash(templates ...string) string {
+	hash := sha256.New()
+
+	for _, tmpl := range templates {
+		lines := strings.Split(tmpl, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(line, " \t\r")
+		}
+
+		hash.Write([]byte(strings.TrimRight(strings.Join(lines, "\n"), "\n")))
+		// A separator keeps moving content from one template to the next from producing the same hash.
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -65,11 +65,18 @@ const (
 	tokenPrefix      string = "-token"
 )
 
+// ErrUserDataTooLarge describes the rendered bootstrap data exceeding the configured MaxUserDataBytes.
+var ErrUserDataTooLarge = errors.New("bootstrap data exceeds the maximum user data size")
+
 // RKE2ConfigReconciler reconciles a Rke2Config object.
 type RKE2ConfigReconciler struct {
 	RKE2InitLock RKE2InitLock
 	client.Client
 	Scheme *runtime.Scheme
+
+	// DetectRendererDrift enables reporting the BootstrapDataUpToDate condition on RKE2Configs whose bootstrap data
+	// was rendered with different templates than the current ones.
+	DetectRendererDrift bool
 }
 
 const (
@@ -170,6 +177,8 @@ func (r *RKE2ConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 	// Status is ready means a config has been generated.
 	if scope.Config.Status.Ready {
+		r.reconcileRendererHash(scope)
+
 		// In any other case just return as the config is already generated and need not be generated again.
 		return ctrl.Result{}, nil
 	}
@@ -353,13 +362,16 @@ func (r *RKE2ConfigReconciler) handleClusterNotInitialized(ctx context.Context,
 	certificates := secret.NewCertificatesForInitialControlPlane()
 	if _, found := scope.ControlPlane.Annotations[controlplanev1.LegacyRKE2ControlPlane]; found {
 		certificates = secret.NewCertificatesForLegacyControlPlane()
+	} else if scope.ControlPlane.Spec.ServerConfig.Etcd.External != nil {
+		certificates = secret.NewCertificatesForExternalEtcdControlPlane()
 	}
 
-	if err := certificates.LookupOrGenerate(
+	if err := certificates.LookupOrIssue(
 		ctx,
 		r.Client,
 		util.ObjectKey(scope.Cluster),
 		*metav1.NewControllerRef(scope.Config, bootstrapv1.GroupVersion.WithKind("RKE2Config")),
+		scope.ControlPlane.Spec.CertificateAuthorityProvider,
 	); err != nil {
 		conditions.MarkFalse(
 			scope.Config,
@@ -418,6 +430,8 @@ func (r *RKE2ConfigReconciler) handleClusterNotInitialized(ctx context.Context,
 		return ctrl.Result{}, err
 	}
 
+	recordServerDefaultsHash(scope, configStruct)
+
 	var buf bytes.Buffer
 	yamlEncoder := yaml.NewEncoder(&buf)
 	yamlEncoder.SetIndent(2)
@@ -633,6 +647,8 @@ func (r *RKE2ConfigReconciler) joinControlplane(ctx context.Context, scope *Scop
 		return ctrl.Result{}, err
 	}
 
+	recordServerDefaultsHash(scope, configStruct)
+
 	var buf bytes.Buffer
 	yamlEncoder := yaml.NewEncoder(&buf)
 	yamlEncoder.SetIndent(2)
@@ -893,6 +909,19 @@ func (r *RKE2ConfigReconciler) generateAndStoreToken(ctx context.Context, scope
 // storeBootstrapData creates a new secret with the data passed in as input,
 // sets the reference in the configuration status and ready to true.
 func (r *RKE2ConfigReconciler) storeBootstrapData(ctx context.Context, scope *Scope, data []byte) error {
+	if err := validateUserDataSize(scope.Config, data); err != nil {
+		conditions.MarkFalse(
+			scope.Config,
+			bootstrapv1.DataSecretAvailableCondition,
+			bootstrapv1.DataSecretTooLargeReason,
+			clusterv1.ConditionSeverityWarning,
+			err.Error())
+
+		return err
+	}
+
+	rendererHash := rendererHash(scope.Config)
+
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      scope.Config.Name,
@@ -900,6 +929,9 @@ func (r *RKE2ConfigReconciler) storeBootstrapData(ctx context.Context, scope *Sc
 			Labels: map[string]string{
 				clusterv1.ClusterNameLabel: scope.Cluster.Name,
 			},
+			Annotations: map[string]string{
+				bootstrapv1.RendererHashAnnotation: rendererHash,
+			},
 			OwnerReferences: []metav1.OwnerReference{
 				{
 					APIVersion: scope.Config.APIVersion,
@@ -921,11 +953,81 @@ func (r *RKE2ConfigReconciler) storeBootstrapData(ctx context.Context, scope *Sc
 		return err
 	}
 
+	annotations.AddAnnotations(scope.Config, map[string]string{bootstrapv1.RendererHashAnnotation: rendererHash})
+
 	scope.Config.Status.DataSecretName = ptr.To(secret.Name)
 	scope.Config.Status.Ready = true
 
 	conditions.MarkTrue(scope.Config, bootstrapv1.DataSecretAvailableCondition)
 
+	if r.DetectRendererDrift {
+		conditions.MarkTrue(scope.Config, bootstrapv1.BootstrapDataUpToDateCondition)
+	}
+
+	return nil
+}
+
+// rendererHash returns the hash of the current templates used to render the bootstrap data of the RKE2Config.
+func rendererHash(config *bootstrapv1.RKE2Config) string {
+	if config.Spec.AgentConfig.Format == bootstrapv1.Ignition {
+		return ignition.RendererHash()
+	}
+
+	return cloudinit.RendererHash()
+}
+
+// recordServerDefaultsHash records on the RKE2Config the hash of the server defaults merged into its server config, so
+// the control plane compares the defaults the bootstrap data was actually rendered with.
+func recordServerDefaultsHash(scope *Scope, serverConfig *rke2.ServerConfig) {
+	if serverConfig.DefaultsHash == "" {
+		return
+	}
+
+	annotations.AddAnnotations(scope.Config, map[string]string{
+		controlplanev1.ServerDefaultsHashAnnotation: serverConfig.DefaultsHash,
+	})
+}
+
+// reconcileRendererHash reports whether the bootstrap data of a ready RKE2Config was rendered with the current
+// templates. Whitespace-only template changes keep the same hash, so they don't mark existing bootstrap data outdated.
+// Bootstrap data without a renderer hash, e.g. rendered by an older provider version, is not reported.
+func (r *RKE2ConfigReconciler) reconcileRendererHash(scope *Scope) {
+	if !r.DetectRendererDrift {
+		return
+	}
+
+	renderedWith, ok := scope.Config.GetAnnotations()[bootstrapv1.RendererHashAnnotation]
+	if !ok {
+		return
+	}
+
+	if current := rendererHash(scope.Config); renderedWith != current {
+		conditions.MarkFalse(
+			scope.Config,
+			bootstrapv1.BootstrapDataUpToDateCondition,
+			bootstrapv1.RendererChangedReason,
+			clusterv1.ConditionSeverityInfo,
+			"bootstrap data was rendered with renderer %s, current renderer is %s", renderedWith, current)
+
+		return
+	}
+
+	conditions.MarkTrue(scope.Config, bootstrapv1.BootstrapDataUpToDateCondition)
+}
+
+// validateUserDataSize checks the rendered bootstrap data against the MaxUserDataBytes limit of the RKE2Config, if any,
+// so that no bootstrap secret is created which would be rejected by the infrastructure provider.
+func validateUserDataSize(config *bootstrapv1.RKE2Config, data []byte) error {
+	if config.Spec.MaxUserDataBytes == nil {
+		return nil
+	}
+
+	if size, limit := len(data), int(*config.Spec.MaxUserDataBytes); size > limit {
+		return errors.Wrapf(ErrUserDataTooLarge,
+			"rendered bootstrap data is %d bytes, the limit is %d bytes (consider compressing large files using the gzip+base64 encoding)",
+			size, limit)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,103 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
+)
+
+var _ = Describe("RKE2Config bootstrap data size", func() {
+	var (
+		ctx   context.Context
+		r     *RKE2ConfigReconciler
+		scope *Scope
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme := runtime.NewScheme()
+		Expect(corev1.AddToScheme(scheme)).Should(Succeed())
+		Expect(bootstrapv1.AddToScheme(scheme)).Should(Succeed())
+
+		r = &RKE2ConfigReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+			Scheme: scheme,
+		}
+		scope = &Scope{
+			Logger: ctrl.Log,
+			Config: &bootstrapv1.RKE2Config{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-config", Namespace: "default"},
+				Spec: bootstrapv1.RKE2ConfigSpec{
+					MaxUserDataBytes: ptr.To[int32](1024),
+				},
+			},
+			Cluster: &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+			},
+		}
+	})
+
+	It("should reject bootstrap data exceeding the limit", func() {
+		err := r.storeBootstrapData(ctx, scope, bytes.Repeat([]byte("a"), 1025))
+		Expect(errors.Is(err, ErrUserDataTooLarge)).Should(BeTrue())
+		Expect(err.Error()).Should(ContainSubstring("1025 bytes"))
+
+		condition := conditions.Get(scope.Config, bootstrapv1.DataSecretAvailableCondition)
+		Expect(condition).ShouldNot(BeNil())
+		Expect(condition.Status).Should(Equal(corev1.ConditionFalse))
+		Expect(condition.Reason).Should(Equal(bootstrapv1.DataSecretTooLargeReason))
+		Expect(scope.Config.Status.Ready).Should(BeFalse())
+
+		secret := &corev1.Secret{}
+		err = r.Get(ctx, types.NamespacedName{Namespace: "default", Name: "test-config"}, secret)
+		Expect(apierrors.IsNotFound(err)).Should(BeTrue())
+	})
+
+	It("should store bootstrap data within the limit", func() {
+		data := bytes.Repeat([]byte("a"), 1024)
+		Expect(r.storeBootstrapData(ctx, scope, data)).Should(Succeed())
+		Expect(conditions.IsTrue(scope.Config, bootstrapv1.DataSecretAvailableCondition)).Should(BeTrue())
+		Expect(scope.Config.Status.DataSecretName).Should(Equal(ptr.To("test-config")))
+
+		secret := &corev1.Secret{}
+		Expect(r.Get(ctx, types.NamespacedName{Namespace: "default", Name: "test-config"}, secret)).Should(Succeed())
+		Expect(secret.Data["value"]).Should(Equal(data))
+	})
+
+	It("should not limit bootstrap data when no limit is set", func() {
+		scope.Config.Spec.MaxUserDataBytes = nil
+		Expect(r.storeBootstrapData(ctx, scope, bytes.Repeat([]byte("a"), 64*1024))).Should(Succeed())
+	})
+})
@@ -149,6 +149,11 @@ storage:
 `
 )
 
+// RendererHash returns the hash of the butane template, ignoring trailing whitespace changes.
+func RendererHash() string {
+	return cloudinit.TemplatesHash(butaneTemplate)
+}
+
 func defaultTemplateFuncMap() template.FuncMap {
 	return template.FuncMap{
 		"Indent":         templateYAMLIndent,
@@ -72,6 +72,25 @@ type ControlPlaneInput struct {
 	AdditionalIgnition *bootstrapv1.AdditionalUserData
 }
 
+// RendererHash returns the hash of the templates and commands used to render Ignition bootstrap data. It changes when
+// the rendered output changes materially, but not on trailing whitespace changes to the templates.
+func RendererHash() string {
+	templates := []string{
+		cloudinit.RendererHash(),
+		butane.RendererHash(),
+		airGappedChecksumCommand,
+		airGappedControlPlaneCommand,
+		controlPlaneCommand,
+		airGappedWorkerCommand,
+		workerCommand,
+		cisPreparationCommand,
+	}
+	templates = append(templates, serverDeployCommands...)
+	templates = append(templates, workerDeployCommands...)
+
+	return cloudinit.TemplatesHash(templates...)
+}
+
 // NewJoinWorker returns Ignition configuration for new worker node joining the cluster.
 func NewJoinWorker(input *JoinWorkerInput) ([]byte, error) {
 	if input == nil {
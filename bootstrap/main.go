@@ -48,6 +48,7 @@ import (
 	controlplanev1alpha1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1alpha1"
 	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
 	"github.com/rancher/cluster-api-provider-rke2/pkg/consts"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/secret"
 	"github.com/rancher/cluster-api-provider-rke2/version"
 )
 
@@ -68,6 +69,8 @@ var (
 	webhookPort                 int
 	webhookCertDir              string
 	healthAddr                  string
+	detectRendererDrift         bool
+	caProviderSecret            string
 	managerOptions              = flags.ManagerOptions{}
 )
 
@@ -113,6 +116,10 @@ func InitFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&watchNamespace, "namespace", "",
 		"Namespace that the controller watches to reconcile cluster-api objects. If unspecified, the controller watches for cluster-api objects across all namespaces.") //nolint:lll
 
+	fs.StringVar(&caProviderSecret, "ca-provider-secret", "",
+		"Namespace/name of a Secret holding the root CA, under the tls.crt and tls.key keys, registered as the \"secret\" "+
+			"certificateAuthorityProvider of the control planes. Must be set on both the control plane and bootstrap providers.")
+
 	fs.IntVar(&webhookPort, "webhook-port", consts.DefaultWebhookPort, "Webhook Server port")
 
 	fs.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs/",
@@ -121,6 +128,9 @@ func InitFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&healthAddr, "health-addr", ":9440",
 		"The address the health endpoint binds to.")
 
+	fs.BoolVar(&detectRendererDrift, "bootstrap-renderer-drift-detection", false,
+		"Report RKE2Configs whose bootstrap data was rendered with outdated templates, allowing control planes to roll out their machines.") //nolint:lll
+
 	flags.AddManagerOptions(fs, &managerOptions)
 
 	feature.MutableGates.AddFlag(fs)
@@ -191,6 +201,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Register the CA providers the control planes can use through their certificateAuthorityProvider.
+	if caProviderSecret != "" {
+		if err := secret.RegisterSecretCAProvider(mgr.GetAPIReader(), caProviderSecret); err != nil {
+			setupLog.Error(err, "Unable to start manager: invalid flags")
+			os.Exit(1)
+		}
+	}
+
 	// Setup the context that's going to be used in controllers and for the manager.
 	ctx := ctrl.SetupSignalHandler()
 
@@ -220,8 +238,9 @@ func setupChecks(mgr ctrl.Manager) {
 
 func setupReconcilers(mgr ctrl.Manager) {
 	if err := (&controllers.RKE2ConfigReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		DetectRendererDrift: detectRendererDrift,
 	}).SetupWithManager(mgr, concurrencyNumber); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Rke2Config")
 		os.Exit(1)
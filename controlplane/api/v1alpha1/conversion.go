@@ -62,6 +62,17 @@ func (src *RKE2ControlPlane) ConvertTo(dstRaw conversion.Hub) error {
 	}
 
 	dst.Spec.ServerConfig.EmbeddedRegistry = restored.Spec.ServerConfig.EmbeddedRegistry
+	dst.Spec.ServerConfig.DefaultsConfigMap = restored.Spec.ServerConfig.DefaultsConfigMap
+	dst.Spec.ServerConfig.Etcd.External = restored.Spec.ServerConfig.Etcd.External
+	dst.Spec.MaxUserDataBytes = restored.Spec.MaxUserDataBytes
+	dst.Spec.Channel = restored.Spec.Channel
+	dst.Spec.CertificateAuthorityProvider = restored.Spec.CertificateAuthorityProvider
+
+	if restored.Spec.RolloutStrategy != nil && restored.Spec.RolloutStrategy.RollingUpdate != nil &&
+		dst.Spec.RolloutStrategy != nil && dst.Spec.RolloutStrategy.RollingUpdate != nil {
+		dst.Spec.RolloutStrategy.RollingUpdate.MaxUnavailable = restored.Spec.RolloutStrategy.RollingUpdate.MaxUnavailable
+	}
+
 	dst.Spec.MachineTemplate = restored.Spec.MachineTemplate
 	dst.Status = restored.Status
 
@@ -139,6 +150,8 @@ func (src *RKE2ControlPlaneTemplate) ConvertTo(dstRaw conversion.Hub) error {
 	}
 
 	dst.Spec.Template.Spec.ServerConfig.EmbeddedRegistry = restored.Spec.Template.Spec.ServerConfig.EmbeddedRegistry
+	dst.Spec.Template.Spec.ServerConfig.DefaultsConfigMap = restored.Spec.Template.Spec.ServerConfig.DefaultsConfigMap
+	dst.Spec.Template.Spec.ServerConfig.Etcd.External = restored.Spec.Template.Spec.ServerConfig.Etcd.External
 	dst.Spec.Template = restored.Spec.Template
 	dst.Status = restored.Status
 	dst.Spec.Template.Spec.MachineTemplate.NodeDrainTimeout = restored.Spec.Template.Spec.MachineTemplate.NodeDrainTimeout
@@ -233,3 +246,12 @@ func Convert_v1alpha1_RKE2ConfigSpec_To_v1beta1_RKE2ConfigSpec(in *bootstrapv1al
 func Convert_v1beta1_RKE2ServerConfig_To_v1alpha1_RKE2ServerConfig(in *controlplanev1.RKE2ServerConfig, out *RKE2ServerConfig, s apiconversion.Scope) error {
 	return autoConvert_v1beta1_RKE2ServerConfig_To_v1alpha1_RKE2ServerConfig(in, out, s)
 }
+
+func Convert_v1beta1_RollingUpdate_To_v1alpha1_RollingUpdate(in *controlplanev1.RollingUpdate, out *RollingUpdate, s apiconversion.Scope) error {
+	return autoConvert_v1beta1_RollingUpdate_To_v1alpha1_RollingUpdate(in, out, s)
+}
+
+func Convert_v1beta1_EtcdConfig_To_v1alpha1_EtcdConfig(in *controlplanev1.EtcdConfig, out *EtcdConfig, s apiconversion.Scope) error {
+	// External was added in v1beta1.
+	return autoConvert_v1beta1_EtcdConfig_To_v1alpha1_EtcdConfig(in, out, s)
+}
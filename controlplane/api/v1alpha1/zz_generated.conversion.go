@@ -66,11 +66,6 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1beta1.EtcdConfig)(nil), (*EtcdConfig)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1beta1_EtcdConfig_To_v1alpha1_EtcdConfig(a.(*v1beta1.EtcdConfig), b.(*EtcdConfig), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*EtcdS3)(nil), (*v1beta1.EtcdS3)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_EtcdS3_To_v1beta1_EtcdS3(a.(*EtcdS3), b.(*v1beta1.EtcdS3), scope)
 	}); err != nil {
@@ -136,11 +131,6 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1beta1.RollingUpdate)(nil), (*RollingUpdate)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1beta1_RollingUpdate_To_v1alpha1_RollingUpdate(a.(*v1beta1.RollingUpdate), b.(*RollingUpdate), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*RolloutStrategy)(nil), (*v1beta1.RolloutStrategy)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_RolloutStrategy_To_v1beta1_RolloutStrategy(a.(*RolloutStrategy), b.(*v1beta1.RolloutStrategy), scope)
 	}); err != nil {
@@ -171,6 +161,11 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddConversionFunc((*v1beta1.EtcdConfig)(nil), (*EtcdConfig)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1beta1_EtcdConfig_To_v1alpha1_EtcdConfig(a.(*v1beta1.EtcdConfig), b.(*EtcdConfig), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddConversionFunc((*apiv1beta1.RKE2ConfigSpec)(nil), (*apiv1alpha1.RKE2ConfigSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1beta1_RKE2ConfigSpec_To_v1alpha1_RKE2ConfigSpec(a.(*apiv1beta1.RKE2ConfigSpec), b.(*apiv1alpha1.RKE2ConfigSpec), scope)
 	}); err != nil {
@@ -201,6 +196,11 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddConversionFunc((*v1beta1.RollingUpdate)(nil), (*RollingUpdate)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1beta1_RollingUpdate_To_v1alpha1_RollingUpdate(a.(*v1beta1.RollingUpdate), b.(*RollingUpdate), scope)
+	}); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -276,14 +276,10 @@ func autoConvert_v1beta1_EtcdConfig_To_v1alpha1_EtcdConfig(in *v1beta1.EtcdConfi
 		return err
 	}
 	out.CustomConfig = (*apiv1alpha1.ComponentConfig)(unsafe.Pointer(in.CustomConfig))
+	// WARNING: in.External requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1beta1_EtcdConfig_To_v1alpha1_EtcdConfig is an autogenerated conversion function.
-func Convert_v1beta1_EtcdConfig_To_v1alpha1_EtcdConfig(in *v1beta1.EtcdConfig, out *EtcdConfig, s conversion.Scope) error {
-	return autoConvert_v1beta1_EtcdConfig_To_v1alpha1_EtcdConfig(in, out, s)
-}
-
 func autoConvert_v1alpha1_EtcdS3_To_v1beta1_EtcdS3(in *EtcdS3, out *v1beta1.EtcdS3, s conversion.Scope) error {
 	out.Endpoint = in.Endpoint
 	out.EndpointCASecret = (*v1.ObjectReference)(unsafe.Pointer(in.EndpointCASecret))
@@ -403,7 +399,15 @@ func autoConvert_v1alpha1_RKE2ControlPlaneSpec_To_v1beta1_RKE2ControlPlaneSpec(i
 	out.NodeDrainTimeout = (*metav1.Duration)(unsafe.Pointer(in.NodeDrainTimeout))
 	out.RegistrationMethod = v1beta1.RegistrationMethod(in.RegistrationMethod)
 	out.RegistrationAddress = in.RegistrationAddress
-	out.RolloutStrategy = (*v1beta1.RolloutStrategy)(unsafe.Pointer(in.RolloutStrategy))
+	if in.RolloutStrategy != nil {
+		in, out := &in.RolloutStrategy, &out.RolloutStrategy
+		*out = new(v1beta1.RolloutStrategy)
+		if err := Convert_v1alpha1_RolloutStrategy_To_v1beta1_RolloutStrategy(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.RolloutStrategy = nil
+	}
 	return nil
 }
 
@@ -418,6 +422,7 @@ func autoConvert_v1beta1_RKE2ControlPlaneSpec_To_v1alpha1_RKE2ControlPlaneSpec(i
 	}
 	out.Replicas = (*int32)(unsafe.Pointer(in.Replicas))
 	// WARNING: in.Version requires manual conversion: does not exist in peer-type
+	// WARNING: in.Channel requires manual conversion: does not exist in peer-type
 	// WARNING: in.MachineTemplate requires manual conversion: does not exist in peer-type
 	if err := Convert_v1beta1_RKE2ServerConfig_To_v1alpha1_RKE2ServerConfig(&in.ServerConfig, &out.ServerConfig, s); err != nil {
 		return err
@@ -427,8 +432,17 @@ func autoConvert_v1beta1_RKE2ControlPlaneSpec_To_v1alpha1_RKE2ControlPlaneSpec(i
 	out.NodeDrainTimeout = (*metav1.Duration)(unsafe.Pointer(in.NodeDrainTimeout))
 	out.RegistrationMethod = RegistrationMethod(in.RegistrationMethod)
 	out.RegistrationAddress = in.RegistrationAddress
-	out.RolloutStrategy = (*RolloutStrategy)(unsafe.Pointer(in.RolloutStrategy))
+	if in.RolloutStrategy != nil {
+		in, out := &in.RolloutStrategy, &out.RolloutStrategy
+		*out = new(RolloutStrategy)
+		if err := Convert_v1beta1_RolloutStrategy_To_v1alpha1_RolloutStrategy(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.RolloutStrategy = nil
+	}
 	// WARNING: in.RemediationStrategy requires manual conversion: does not exist in peer-type
+	// WARNING: in.CertificateAuthorityProvider requires manual conversion: does not exist in peer-type
 	return nil
 }
 
@@ -463,6 +477,8 @@ func autoConvert_v1beta1_RKE2ControlPlaneStatus_To_v1alpha1_RKE2ControlPlaneStat
 	out.UnavailableReplicas = in.UnavailableReplicas
 	out.AvailableServerIPs = *(*[]string)(unsafe.Pointer(&in.AvailableServerIPs))
 	// WARNING: in.LastRemediation requires manual conversion: does not exist in peer-type
+	// WARNING: in.Etcd requires manual conversion: does not exist in peer-type
+	// WARNING: in.InfrastructureTemplate requires manual conversion: does not exist in peer-type
 	return nil
 }
 
@@ -603,6 +619,7 @@ func autoConvert_v1beta1_RKE2ServerConfig_To_v1alpha1_RKE2ServerConfig(in *v1bet
 	out.CloudControllerManager = (*apiv1alpha1.ComponentConfig)(unsafe.Pointer(in.CloudControllerManager))
 	out.CloudProviderName = in.CloudProviderName
 	out.CloudProviderConfigMap = (*v1.ObjectReference)(unsafe.Pointer(in.CloudProviderConfigMap))
+	// WARNING: in.DefaultsConfigMap requires manual conversion: does not exist in peer-type
 	// WARNING: in.EmbeddedRegistry requires manual conversion: does not exist in peer-type
 	return nil
 }
@@ -619,17 +636,21 @@ func Convert_v1alpha1_RollingUpdate_To_v1beta1_RollingUpdate(in *RollingUpdate,
 
 func autoConvert_v1beta1_RollingUpdate_To_v1alpha1_RollingUpdate(in *v1beta1.RollingUpdate, out *RollingUpdate, s conversion.Scope) error {
 	out.MaxSurge = (*intstr.IntOrString)(unsafe.Pointer(in.MaxSurge))
+	// WARNING: in.MaxUnavailable requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1beta1_RollingUpdate_To_v1alpha1_RollingUpdate is an autogenerated conversion function.
-func Convert_v1beta1_RollingUpdate_To_v1alpha1_RollingUpdate(in *v1beta1.RollingUpdate, out *RollingUpdate, s conversion.Scope) error {
-	return autoConvert_v1beta1_RollingUpdate_To_v1alpha1_RollingUpdate(in, out, s)
-}
-
 func autoConvert_v1alpha1_RolloutStrategy_To_v1beta1_RolloutStrategy(in *RolloutStrategy, out *v1beta1.RolloutStrategy, s conversion.Scope) error {
 	out.Type = v1beta1.RolloutStrategyType(in.Type)
-	out.RollingUpdate = (*v1beta1.RollingUpdate)(unsafe.Pointer(in.RollingUpdate))
+	if in.RollingUpdate != nil {
+		in, out := &in.RollingUpdate, &out.RollingUpdate
+		*out = new(v1beta1.RollingUpdate)
+		if err := Convert_v1alpha1_RollingUpdate_To_v1beta1_RollingUpdate(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.RollingUpdate = nil
+	}
 	return nil
 }
 
@@ -640,7 +661,15 @@ func Convert_v1alpha1_RolloutStrategy_To_v1beta1_RolloutStrategy(in *RolloutStra
 
 func autoConvert_v1beta1_RolloutStrategy_To_v1alpha1_RolloutStrategy(in *v1beta1.RolloutStrategy, out *RolloutStrategy, s conversion.Scope) error {
 	out.Type = RolloutStrategyType(in.Type)
-	out.RollingUpdate = (*RollingUpdate)(unsafe.Pointer(in.RollingUpdate))
+	if in.RollingUpdate != nil {
+		in, out := &in.RollingUpdate, &out.RollingUpdate
+		*out = new(RollingUpdate)
+		if err := Convert_v1beta1_RollingUpdate_To_v1alpha1_RollingUpdate(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.RollingUpdate = nil
+	}
 	return nil
 }
 
@@ -79,6 +79,108 @@ const (
 	RollingUpdateInProgressReason = "RollingUpdateInProgress"
 )
 
+const (
+	// MachineUpToDateCondition documents that the machine matches the RKE2ControlPlane configuration and does not
+	// require a rollout. When this condition is false, the reason reports the first configuration check that failed.
+	MachineUpToDateCondition clusterv1.ConditionType = "UpToDate"
+
+	// VersionMismatchReason (Severity=Info) documents a machine running a different Kubernetes or RKE2 version
+	// than the one requested by the RKE2ControlPlane.
+	VersionMismatchReason = "VersionMismatch"
+
+	// ServerConfigMismatchReason (Severity=Info) documents a machine whose RKE2 server configuration does not
+	// match the RKE2ControlPlane serverConfig.
+	ServerConfigMismatchReason = "ServerConfigMismatch"
+
+	// CloudProviderMismatchReason (Severity=Info) documents a machine whose cloud provider name or cloud provider
+	// config does not match the RKE2ControlPlane serverConfig, e.g. when migrating to an external cloud provider.
+	CloudProviderMismatchReason = "CloudProviderMismatch"
+
+	// AuditPolicyChangedReason (Severity=Info) documents a machine whose audit configuration, i.e. the kube-apiserver
+	// audit args, the audit policy secret or the content of the audit policy file, does not match the RKE2ControlPlane.
+	AuditPolicyChangedReason = "AuditPolicyChanged"
+
+	// PSAConfigChangedReason (Severity=Info) documents a machine whose PodSecurityAdmission configuration, i.e. the
+	// podSecurityAdmissionConfigFile path or the content of the PodSecurityAdmission config file, does not match the
+	// RKE2ControlPlane.
+	PSAConfigChangedReason = "PSAConfigChanged"
+
+	// APIServerArgsChangedReason (Severity=Info) documents a machine whose kube-apiserver extra args do not match
+	// the RKE2ControlPlane serverConfig.
+	APIServerArgsChangedReason = "APIServerArgsChanged"
+
+	// ControllerManagerArgsChangedReason (Severity=Info) documents a machine whose kube-controller-manager extra args
+	// do not match the RKE2ControlPlane serverConfig.
+	ControllerManagerArgsChangedReason = "ControllerManagerArgsChanged"
+
+	// SchedulerArgsChangedReason (Severity=Info) documents a machine whose kube-scheduler extra args do not match
+	// the RKE2ControlPlane serverConfig.
+	SchedulerArgsChangedReason = "SchedulerArgsChanged"
+
+	// NodeRolesMismatchReason (Severity=Info) documents a machine hosting etcd or the API server while the
+	// RKE2ControlPlane serverConfig disables it, or the other way around.
+	NodeRolesMismatchReason = "NodeRolesMismatch"
+
+	// DisabledComponentsMismatchReason (Severity=Info) documents a machine whose set of disabled RKE2 components
+	// does not match the RKE2ControlPlane serverConfig disableComponents.
+	DisabledComponentsMismatchReason = "DisabledComponentsMismatch"
+
+	// ServerDefaultsMismatchReason (Severity=Info) documents a machine bootstrapped with server defaults that
+	// differ from the current content of the RKE2ControlPlane defaults ConfigMap.
+	ServerDefaultsMismatchReason = "ServerDefaultsMismatch"
+
+	// RegistrationAddressChangedReason (Severity=Info) documents a machine configured with a registration address or
+	// method which differs from the one currently resolved for the RKE2ControlPlane.
+	RegistrationAddressChangedReason = "RegistrationAddressChanged"
+
+	// TLSSANChangedReason (Severity=Info) documents a machine whose API server certificate SANs, i.e. the tlsSan of the
+	// server config, do not match the RKE2ControlPlane serverConfig. The order of the SANs is not compared.
+	TLSSANChangedReason = "TLSSANChanged"
+
+	// RegistriesConfigMismatchReason (Severity=Info) documents a machine whose RKE2Config private registries
+	// configuration or system default registry does not match the RKE2ControlPlane RKE2ConfigSpec.
+	RegistriesConfigMismatchReason = "RegistriesConfigMismatch"
+
+	// DataDirChangedReason (Severity=Info) documents a machine whose RKE2 data directory or kubelet binary path does not
+	// match the RKE2ControlPlane RKE2ConfigSpec. These changes require the node to be rebuilt, so they always roll out
+	// the machine, even when the fields are ignored.
+	DataDirChangedReason = "DataDirChanged"
+
+	// ContainerdConfigChangedReason (Severity=Info) documents a machine whose containerd config templates, i.e. the
+	// config.toml.tmpl or config-v3.toml.tmpl files of the containerd directory of the RKE2 agent, do not match the
+	// RKE2ControlPlane RKE2ConfigSpec.
+	ContainerdConfigChangedReason = "ContainerdConfigChanged"
+
+	// NodeAddressConfigChangedReason (Severity=Info) documents a machine whose node address settings, i.e. the node-ip
+	// kubelet arg, do not match the RKE2ControlPlane RKE2ConfigSpec. The order of the addresses is not compared.
+	NodeAddressConfigChangedReason = "NodeAddressConfigChanged"
+
+	// KubeletConfigMismatchReason (Severity=Info) documents a machine whose kubelet configuration files, i.e. the files
+	// referenced by the kubelet config or config-dir arguments, do not match the RKE2ControlPlane RKE2ConfigSpec.
+	KubeletConfigMismatchReason = "KubeletConfigMismatch"
+
+	// KubeletConfigChangedReason (Severity=Info) documents a machine whose kubelet settings of the RKE2 agent config, i.e.
+	// the kubelet extra args, extra env, extra mounts or override image, do not match the RKE2ControlPlane RKE2ConfigSpec,
+	// e.g. after changing the kubelet eviction thresholds.
+	KubeletConfigChangedReason = "KubeletConfigChanged"
+
+	// BootstrapConfigMismatchReason (Severity=Info) documents a machine whose RKE2Config does not match
+	// the RKE2ControlPlane RKE2ConfigSpec.
+	BootstrapConfigMismatchReason = "BootstrapConfigMismatch"
+
+	// BootstrapRendererChangedReason (Severity=Info) documents a machine whose bootstrap data was rendered with
+	// templates which differ materially from the current templates of the bootstrap provider.
+	BootstrapRendererChangedReason = "BootstrapRendererChanged"
+
+	// InfrastructureTemplateMismatchReason (Severity=Info) documents a machine whose infrastructure machine
+	// was not cloned from the RKE2ControlPlane infrastructure template.
+	InfrastructureTemplateMismatchReason = "InfrastructureTemplateMismatch"
+
+	// CustomRolloutCriteriaMismatchReason (Severity=Info) documents a machine which does not satisfy one of the
+	// additional rollout criteria registered on the control plane.
+	CustomRolloutCriteriaMismatchReason = "CustomRolloutCriteriaMismatch"
+)
+
 const (
 	// EtcdClusterHealthyCondition documents the overall etcd cluster's health.
 	EtcdClusterHealthyCondition clusterv1.ConditionType = "EtcdClusterHealthyCondition"
@@ -103,6 +205,103 @@ const (
 	ScalingDownReason = "ScalingDown"
 )
 
+const (
+	// InfrastructureTemplateAvailableCondition documents that the infrastructure template referenced by
+	// spec.machineTemplate.infrastructureRef exists and can be used to create new control plane machines.
+	InfrastructureTemplateAvailableCondition clusterv1.ConditionType = "InfrastructureTemplateAvailable"
+
+	// InfrastructureTemplateNotFoundReason (Severity=Error) documents that the referenced infrastructure template
+	// does not exist or is not an infrastructure machine template, so no new machine can be created.
+	InfrastructureTemplateNotFoundReason = "InfrastructureTemplateNotFound"
+)
+
+const (
+	// BootstrapTokenValidCondition documents that new nodes can join the workload cluster, i.e. the cluster
+	// does not rely on bootstrap tokens or at least one of them is not expired.
+	BootstrapTokenValidCondition clusterv1.ConditionType = "BootstrapTokenValid"
+
+	// BootstrapTokenExpiredReason (Severity=Warning) documents that all the bootstrap tokens of the workload cluster
+	// are expired and can't be used to join new nodes.
+	BootstrapTokenExpiredReason = "BootstrapTokenExpired"
+
+	// BootstrapTokenInspectionFailedReason documents a failure in inspecting the workload cluster bootstrap tokens.
+	BootstrapTokenInspectionFailedReason = "BootstrapTokenInspectionFailed"
+)
+
+const (
+	// WorkerVersionSkewCondition documents that the worker nodes of the workload cluster are within the version skew
+	// supported by the control plane, i.e. the kubelet is at most three minor versions older than the kube-apiserver.
+	WorkerVersionSkewCondition clusterv1.ConditionType = "WorkerVersionSkew"
+
+	// WorkerVersionSkewExceededReason (Severity=Warning) documents that some worker nodes lag the control plane
+	// by more than the supported version skew and should be upgraded.
+	WorkerVersionSkewExceededReason = "WorkerVersionSkewExceeded"
+
+	// WorkerVersionSkewInspectionFailedReason documents a failure in inspecting the worker node versions.
+	WorkerVersionSkewInspectionFailedReason = "WorkerVersionSkewInspectionFailed"
+)
+
+const (
+	// MachinesInfrastructureTemplateAvailableCondition documents that the infrastructure templates the infrastructure
+	// machines of the control plane were cloned from, according to their cloned-from annotations, still exist.
+	MachinesInfrastructureTemplateAvailableCondition clusterv1.ConditionType = "MachinesInfrastructureTemplateAvailable"
+
+	// MachinesInfrastructureTemplateNotFoundReason (Severity=Warning) documents that some machines were cloned from an
+	// infrastructure template which no longer exists. It does not trigger a rollout, but the machines should be adopted
+	// by an existing template or cleaned up.
+	MachinesInfrastructureTemplateNotFoundReason = "MachinesInfrastructureTemplateNotFound"
+
+	// MachinesInfrastructureTemplateInspectionFailedReason documents a failure in inspecting the infrastructure
+	// templates the machines were cloned from.
+	MachinesInfrastructureTemplateInspectionFailedReason = "MachinesInfrastructureTemplateInspectionFailed"
+)
+
+const (
+	// CertificatesNotExpiringCondition documents that none of the serving certificates of the workload cluster
+	// expires within the next 30 days.
+	CertificatesNotExpiringCondition clusterv1.ConditionType = "CertificatesNotExpiring"
+
+	// CertificatesExpiringReason (Severity=Warning) documents that some serving certificates of the workload cluster
+	// expire within the next 30 days and should be rotated.
+	CertificatesExpiringReason = "CertificatesExpiring"
+
+	// CertificatesExternallyManagedReason documents that the cluster CA was not generated by a controller, so the
+	// certificates are externally managed and rotating them is up to their owner. The condition is reported as Unknown
+	// with this reason while the certificates are not expiring, as their rotation is not tracked by the controller.
+	CertificatesExternallyManagedReason = "CertificatesExternallyManaged"
+
+	// CertificatesInspectionFailedReason documents a failure in inspecting the workload cluster certificates.
+	CertificatesInspectionFailedReason = "CertificatesInspectionFailed"
+)
+
+const (
+	// EtcdDBSizeWithinQuotaCondition documents that the database of none of the etcd members exceeds 80% of the
+	// etcd quota.
+	EtcdDBSizeWithinQuotaCondition clusterv1.ConditionType = "EtcdDBSizeWithinQuota"
+
+	// EtcdDBSizeNearQuotaReason (Severity=Warning) documents that the database of some etcd members exceeds 80% of the
+	// etcd quota and should be compacted and defragmented before etcd raises a NOSPACE alarm.
+	EtcdDBSizeNearQuotaReason = "EtcdDBSizeNearQuota"
+
+	// EtcdDBSizeInspectionFailedReason documents a failure in inspecting the database size of the etcd members.
+	EtcdDBSizeInspectionFailedReason = "EtcdDBSizeInspectionFailed"
+)
+
+const (
+	// EtcdOperationsAllowedCondition documents that the controller is allowed to change the etcd cluster, e.g. to remove
+	// etcd members. The condition is only reported while the etcd operations are paused.
+	EtcdOperationsAllowedCondition clusterv1.ConditionType = "EtcdOperationsAllowed"
+
+	// EtcdOperationsPausedReason (Severity=Warning) documents that the etcd operations of the controller are paused by the
+	// EtcdOperationsPausedAnnotation of the RKE2ControlPlane.
+	EtcdOperationsPausedReason = "EtcdOperationsPaused"
+)
+
+// EtcdLearnerPromotionFailedReason (Severity=Warning) documents that the etcd member of a machine was not promoted to a
+// voting member within the promotion timeout, and was removed from the etcd cluster so the machine is remediated. It is
+// set on the MachineHealthCheckSucceeded condition of the machine.
+const EtcdLearnerPromotionFailedReason = "EtcdLearnerPromotionFailed"
+
 const (
 	// CertificatesAvailableCondition documents the overall status of the certificates generated by the RKE2ControlPlane.
 	CertificatesAvailableCondition clusterv1.ConditionType = "CertificatesAvailable"
@@ -110,3 +309,22 @@ const (
 	// CertificatesGenerationFailedReason documents a failure in generating the certificates.
 	CertificatesGenerationFailedReason string = "CertificateGenerationFailed"
 )
+
+const (
+	// ControlPlaneHealthyCondition documents that the etcd quorum is healthy, all the control plane nodes are ready, the
+	// API server is reachable from the pods and the CNI is ready on all the control plane nodes. It contributes to the
+	// Ready condition of the RKE2ControlPlane.
+	ControlPlaneHealthyCondition clusterv1.ConditionType = "ControlPlaneHealthy"
+
+	// EtcdQuorumUnhealthyReason (Severity=Error) documents that less than a quorum of the etcd voting members is healthy.
+	EtcdQuorumUnhealthyReason = "EtcdQuorumUnhealthy"
+
+	// ControlPlaneNodesNotReadyReason (Severity=Warning) documents that some control plane nodes are not ready.
+	ControlPlaneNodesNotReadyReason = "ControlPlaneNodesNotReady"
+
+	// APIServerUnreachableReason (Severity=Warning) documents that the API server is not reachable from the pods.
+	APIServerUnreachableReason = "APIServerUnreachable"
+
+	// CNINotReadyReason (Severity=Warning) documents that the CNI is not ready on some control plane nodes.
+	CNINotReadyReason = "CNINotReady"
+)
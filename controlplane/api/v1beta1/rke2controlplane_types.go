@@ -56,6 +56,84 @@ const (
 	// failures in updating remediation retry (the counter restarts from zero).
 	RemediationForAnnotation = "controlplane.cluster.x-k8s.io/remediation-for"
 
+	// BootstrapTimeoutAnnotation is the machine annotation used to carry the machine template bootstrap timeout, as a
+	// Go duration string, e.g. "20m0s", when the infrastructure provider does not define its own bootstrap timeout
+	// annotation.
+	BootstrapTimeoutAnnotation = "controlplane.cluster.x-k8s.io/bootstrap-timeout"
+
+	// ServerDefaultsHashAnnotation stores the hash of the server defaults ConfigMap content, it is set on the
+	// RKE2ControlPlane and copied to machines so changes to the defaults can trigger a rollout. It is also set on the
+	// RKE2Config of a control plane machine, with the hash of the defaults its bootstrap data was rendered with.
+	ServerDefaultsHashAnnotation = "controlplane.cluster.x-k8s.io/rke2-server-defaults-hash"
+
+	// RegistrationAddressAnnotation is a machine annotation that stores the registration address the machine was
+	// configured with, as resolved for the registration method of the RKE2ControlPlane: the registrationAddress, the
+	// control plane endpoint host or the IP of a control plane node. It allows to detect the machines which must be
+	// reconfigured when the control plane endpoint moves.
+	RegistrationAddressAnnotation = "controlplane.cluster.x-k8s.io/rke2-registration-address"
+
+	// RegistrationMethodAnnotation is a machine annotation that stores the registration method of the RKE2ControlPlane
+	// the machine was configured with, which the recorded registration address was resolved for.
+	RegistrationMethodAnnotation = "controlplane.cluster.x-k8s.io/rke2-registration-method"
+
+	// RKE2ConfigSpecHashAnnotation is a machine annotation that stores the hash of the normalized RKE2ConfigSpec the machine
+	// was created with. It allows to cheaply detect machines which are up to date with the RKE2ControlPlane RKE2ConfigSpec.
+	RKE2ConfigSpecHashAnnotation = "controlplane.cluster.x-k8s.io/rke2-config-spec-hash"
+
+	// RKE2ConfigIgnoreFieldsAnnotation is a controlplane annotation holding a comma separated list of RKE2ConfigSpec field paths,
+	// e.g. "AgentConfig.NodeName,PreRKE2Commands", which are ignored when comparing the machines RKE2Config with the
+	// RKE2ControlPlane. This allows machine-local drift of these fields without triggering a rollout.
+	RKE2ConfigIgnoreFieldsAnnotation = "controlplane.cluster.x-k8s.io/rke2-config-ignore-fields"
+
+	// RKE2ConfigTemplatedFieldsAnnotation is a controlplane annotation holding a comma separated list of RKE2ConfigSpec
+	// field paths, in the format of the RKE2ConfigIgnoreFieldsAnnotation, e.g. "AgentConfig.NodeLabels", whose strings are
+	// Go templates rendered for each machine with its MachineName and ClusterName, e.g. "machine={{ .MachineName }}".
+	// The machines RKE2Config are compared with the templates rendered for them, so per-machine values don't trigger a
+	// rollout while changing a template does. Only fields holding a string or a list of strings can be templated.
+	RKE2ConfigTemplatedFieldsAnnotation = "controlplane.cluster.x-k8s.io/rke2-config-templated-fields"
+
+	// RKE2ConfigInjectedCommandsAnnotation is a controlplane annotation holding a JSON list of commands, e.g.
+	// '["sh /opt/provisioner/register.sh"]', which provisioning tools inject in the PreRKE2Commands or PostRKE2Commands
+	// of the machines RKE2Config. They are ignored when comparing the machines RKE2Config with the RKE2ControlPlane,
+	// while the order of the other commands is still compared.
+	RKE2ConfigInjectedCommandsAnnotation = "controlplane.cluster.x-k8s.io/rke2-config-injected-commands"
+
+	// RolloutOnMissingBootstrapConfigAnnotation is a controlplane annotation which, when set to "true", makes machines whose
+	// RKE2Config can't be found require a rollout. By default these machines are considered up to date, so a misbehaving
+	// API server can't trigger the rollout of the whole control plane. Setting it trades this safety for stricter
+	// enforcement: any transient failure to read the RKE2Configs rolls out the affected machines.
+	RolloutOnMissingBootstrapConfigAnnotation = "controlplane.cluster.x-k8s.io/rollout-on-missing-bootstrap-config"
+
+	// InPlaceServerConfigUpdatesAnnotation is a controlplane annotation which, when set to "true", makes changes limited to
+	// the hot-reloadable server config fields (the extra args of the kube-apiserver, kube-controller-manager and
+	// kube-scheduler, the etcd snapshot schedule and retention, and added TLS SANs) be applied on the existing nodes by
+	// restarting rke2-server, instead of rolling out new machines. Machines on which the changes fail to be applied are
+	// rolled out.
+	// The changes are applied by a pod created in the kube-system namespace of the workload cluster on each node, which
+	// runs privileged in the host PID namespace and uses nsenter to run a shell as root in the namespaces of the host
+	// init process. It thus has full control of the node: enabling the annotation grants the controller root access to
+	// the control plane nodes through the workload cluster API, and requires kube-system to allow privileged pods, e.g.
+	// to be exempted from the restricted Pod Security Standard. The pod is stopped after 10 minutes.
+	// It has no effect when the server config uses a defaults ConfigMap.
+	InPlaceServerConfigUpdatesAnnotation = "controlplane.cluster.x-k8s.io/in-place-server-config-updates"
+
+	// AdoptMachinesAnnotation is a controlplane annotation which, when set to "true", makes the controller backfill the
+	// annotations recording how the owned machines were created on the machines missing them, e.g. after importing an
+	// existing cluster, so they are compared with the current RKE2ControlPlane spec from then on. Existing annotations
+	// are never overwritten, the backfilled machines are considered up to date with the spec at adoption time.
+	AdoptMachinesAnnotation = "controlplane.cluster.x-k8s.io/adopt-machines"
+
+	// RemoveControlPlaneTaintAnnotation is a controlplane annotation which, when set to "true", makes the controller remove
+	// the NoSchedule control plane taint from the control plane nodes once they are Ready and their network is available,
+	// for clusters allowing workloads on the control plane. Taints listed in the agentConfig nodeTaints are never removed.
+	RemoveControlPlaneTaintAnnotation = "controlplane.cluster.x-k8s.io/remove-control-plane-taint"
+
+	// EtcdOperationsPausedAnnotation is a controlplane annotation which, when set to "true", pauses the operations of the
+	// controller changing the etcd cluster, e.g. the removal of etcd members or the clearing of etcd alarms, during a
+	// manual maintenance of etcd. The etcd status is still reported. Machines whose deletion requires an etcd membership
+	// change are not deleted until the annotation is removed.
+	EtcdOperationsPausedAnnotation = "controlplane.cluster.x-k8s.io/etcd-operations-paused"
+
 	// DefaultMinHealthyPeriod defines the default minimum period before we consider a remediation on a
 	// machine unrelated from the previous remediation.
 	DefaultMinHealthyPeriod = 1 * time.Hour
@@ -76,6 +154,11 @@ type RKE2ControlPlaneSpec struct {
 	// +optional
 	Version string `json:"version"`
 
+	// Channel is the RKE2 release channel, e.g. "stable", "latest" or "v1.31", used to resolve the RKE2 version
+	// of the control plane when Version is not set. Machines are only rolled out once the channel moves to a new version.
+	// +optional
+	Channel string `json:"channel,omitempty"`
+
 	// MachineTemplate contains information about how machines
 	// should be shaped when creating or updating a control plane.
 	// +optional
@@ -121,6 +204,13 @@ type RKE2ControlPlaneSpec struct {
 	// remediationStrategy is the RemediationStrategy that controls how control plane machine remediation happens.
 	// +optional
 	RemediationStrategy *RemediationStrategy `json:"remediationStrategy,omitempty"`
+
+	// certificateAuthorityProvider is the name of the external signer issuing the cluster and etcd CAs, as registered
+	// in the control plane and bootstrap controllers, e.g. "secret" when they are started with a --ca-provider-secret
+	// root CA. The CAs are generated by the controllers if not set.
+	// The field is immutable.
+	// +optional
+	CertificateAuthorityProvider string `json:"certificateAuthorityProvider,omitempty"`
 }
 
 // RKE2ControlPlaneMachineTemplate defines the template for Machines
@@ -151,6 +241,12 @@ type RKE2ControlPlaneMachineTemplate struct {
 	// If no value is provided, the default value for this property of the Machine resource will be used.
 	// +optional
 	NodeDeletionTimeout *metav1.Duration `json:"nodeDeletionTimeout,omitempty"`
+
+	// BootstrapTimeout is the amount of time the infrastructure provider should wait for a machine to bootstrap
+	// before considering it failed. It is translated into the infrastructure provider specific annotation
+	// on the generated Machines, or the controlplane.cluster.x-k8s.io/bootstrap-timeout annotation for other providers.
+	// +optional
+	BootstrapTimeout *metav1.Duration `json:"bootstrapTimeout,omitempty"`
 }
 
 // RKE2ServerConfig specifies configuration for the agent nodes.
@@ -230,6 +326,12 @@ type RKE2ServerConfig struct {
 	//+optional
 	CloudProviderConfigMap *corev1.ObjectReference `json:"cloudProviderConfigMap,omitempty"`
 
+	// DefaultsConfigMap is a reference to a ConfigMap containing baseline server args shared across clusters.
+	// The keys kube-apiserver-arg, kube-controller-manager-arg, kube-scheduler-arg and etcd-arg hold
+	// newline separated args which are applied unless the same flag is set in this config.
+	//+optional
+	DefaultsConfigMap *corev1.ObjectReference `json:"defaultsConfigMap,omitempty"`
+
 	// EmbeddedRegistry enables the embedded registry.
 	//+optional
 	EmbeddedRegistry bool `json:"embeddedRegistry,omitempty"`
@@ -292,6 +394,31 @@ type RKE2ControlPlaneStatus struct {
 	// lastRemediation stores info about last remediation performed.
 	// +optional
 	LastRemediation *LastRemediationStatus `json:"lastRemediation,omitempty"`
+
+	// Etcd reports the etcd members of the control plane, as observed from the etcd cluster.
+	// +optional
+	Etcd *EtcdStatus `json:"etcd,omitempty"`
+
+	// InfrastructureTemplate reports how many control plane machines were created from the current infrastructure
+	// template, to follow the progress of a template rollout.
+	// +optional
+	InfrastructureTemplate *InfrastructureTemplateStatus `json:"infrastructureTemplate,omitempty"`
+}
+
+// InfrastructureTemplateStatus reports the control plane machines created from the current infrastructure template and
+// from older ones.
+type InfrastructureTemplateStatus struct {
+	// Name is the name of the infrastructure template referenced by the control plane.
+	Name string `json:"name"`
+
+	// UpToDateReplicas is the number of machines whose infrastructure machine was cloned from the current
+	// infrastructure template. Machines whose infrastructure machine can't be found or does not record the template it
+	// was cloned from, e.g. adopted machines, are counted as up-to-date.
+	UpToDateReplicas int32 `json:"upToDateReplicas"`
+
+	// OutdatedReplicas is the number of machines whose infrastructure machine was cloned from another infrastructure
+	// template.
+	OutdatedReplicas int32 `json:"outdatedReplicas"`
 }
 
 // +kubebuilder:object:root=true
@@ -330,6 +457,20 @@ type EtcdConfig struct {
 
 	// CustomConfig defines the custom settings for ETCD.
 	CustomConfig *bootstrapv1.ComponentConfig `json:"customConfig,omitempty"`
+
+	// External configures the control plane to use an etcd cluster which is not managed by RKE2.
+	// The etcd CA certificate is read from the "<cluster-name>-etcd" secret and the client certificate
+	// from the "<cluster-name>-apiserver-etcd-client" secret, both secrets must be provided by the user.
+	// Embedded etcd member management, e.g. member removal on scale down, is skipped for external etcd.
+	//+optional
+	External *ExternalEtcd `json:"external,omitempty"`
+}
+
+// ExternalEtcd describes an etcd cluster which is not managed by RKE2.
+type ExternalEtcd struct {
+	// Endpoints are the client URLs of the etcd members, e.g. https://etcd-0.example.com:2379.
+	//+kubebuilder:validation:MinItems=1
+	Endpoints []string `json:"endpoints"`
 }
 
 // EtcdBackupConfig describes the backup configuration for ETCD.
@@ -415,8 +556,9 @@ type DisableComponents struct {
 	PluginComponents []DisabledPluginComponent `json:"pluginComponents,omitempty"`
 }
 
-// DisabledKubernetesComponent is an enum field that can take one of the following values: scheduler, kubeProxy or cloudController.
-// +kubebuilder:validation:Enum=scheduler;kubeProxy;cloudController
+// DisabledKubernetesComponent is an enum field that can take one of the following values: scheduler, kubeProxy, cloudController,
+// etcd, apiServer or controllerManager.
+// +kubebuilder:validation:Enum=scheduler;kubeProxy;cloudController;etcd;apiServer;controllerManager
 type DisabledKubernetesComponent string
 
 const (
@@ -428,6 +570,17 @@ const (
 
 	// CloudController references the Cloud Controller Manager Kubernetes Components on the control plane / server nodes.
 	CloudController DisabledKubernetesComponent = "cloudController"
+
+	// Etcd references the etcd member of the control plane/server nodes. All the servers of a control plane share the
+	// same configuration, so it can only be disabled when the control plane uses an external etcd.
+	Etcd DisabledKubernetesComponent = "etcd"
+
+	// APIServer references the Kube API Server Kubernetes component of the control plane/server nodes. All the servers
+	// of a control plane share the same configuration, so it can't be disabled on a control plane.
+	APIServer DisabledKubernetesComponent = "apiServer"
+
+	// ControllerManager references the Kube Controller Manager Kubernetes component of the control plane/server nodes.
+	ControllerManager DisabledKubernetesComponent = "controllerManager"
 )
 
 //+kubebuilder:validation:Enum=rke2-coredns;rke2-ingress-nginx;rke2-metrics-server;rke2-snapshot-controller;rke2-snapshot-controller-crd;rke2-snapshot-validation-webhook
@@ -514,6 +667,40 @@ type LastRemediationStatus struct {
 	RetryCount int `json:"retryCount"`
 }
 
+// EtcdStatus reports the state of the etcd cluster of the control plane.
+type EtcdStatus struct {
+	// Members maps etcd member names to the member details, refreshed on every reconciliation.
+	// +optional
+	Members map[string]EtcdMemberStatus `json:"members,omitempty"`
+}
+
+// EtcdMemberStatus stores the details of a single etcd member.
+type EtcdMemberStatus struct {
+	// ID is the hexadecimal etcd member ID.
+	ID string `json:"id"`
+
+	// PeerURL is the URL the member exposes to the other members of the cluster.
+	// +optional
+	PeerURL string `json:"peerURL,omitempty"`
+
+	// ClientURL is the URL the member exposes to clients.
+	// +optional
+	ClientURL string `json:"clientURL,omitempty"`
+
+	// IsLearner indicates if the member is a raft learner.
+	// +optional
+	IsLearner bool `json:"isLearner,omitempty"`
+
+	// IsLeader indicates if the member is the etcd leader.
+	// +optional
+	IsLeader bool `json:"isLeader,omitempty"`
+
+	// Stale is true when the member could not be reached during the last reconciliation,
+	// in which case the other fields report the last known details of the member.
+	// +optional
+	Stale bool `json:"stale,omitempty"`
+}
+
 // RolloutStrategy describes how to replace existing machines
 // with new ones.
 type RolloutStrategy struct {
@@ -537,6 +724,16 @@ type RollingUpdate struct {
 	// up immediately when the rolling update starts.
 	// +optional
 	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+
+	// The maximum number of outdated control plane machines that can be deleted at the same time
+	// during a rolling update.
+	// Value can be an absolute number or a percentage of the desired number of control planes,
+	// rounded down, and is at least 1.
+	// Defaults to 1.
+	// The effective value is capped to the number of etcd members which can be lost without losing
+	// the etcd quorum, an event is recorded when the requested value is reduced.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
 }
 
 // RolloutStrategyType defines the rollout strategies for a RKE2ControlPlane.
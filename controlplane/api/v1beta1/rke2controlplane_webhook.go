@@ -32,6 +32,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/secret"
 )
 
 const (
@@ -130,8 +131,10 @@ func (rv *RKE2ControlPlaneCustomValidator) ValidateCreate(_ context.Context, obj
 
 	allErrs = append(allErrs, bootstrapv1.ValidateRKE2ConfigSpec(rcp.Name, &rcp.Spec.RKE2ConfigSpec)...)
 	allErrs = append(allErrs, rcp.validateCNI()...)
+	allErrs = append(allErrs, validateDisabledComponents(&rcp.Spec.ServerConfig)...)
 	allErrs = append(allErrs, rcp.validateRegistrationMethod()...)
 	allErrs = append(allErrs, rcp.validateMachineTemplate()...)
+	allErrs = append(allErrs, rcp.validateCertificateAuthorityProvider()...)
 
 	if len(allErrs) == 0 {
 		return nil, nil
@@ -156,6 +159,7 @@ func (rv *RKE2ControlPlaneCustomValidator) ValidateUpdate(_ context.Context, old
 
 	allErrs = append(allErrs, bootstrapv1.ValidateRKE2ConfigSpec(newControlplane.Name, &newControlplane.Spec.RKE2ConfigSpec)...)
 	allErrs = append(allErrs, newControlplane.validateCNI()...)
+	allErrs = append(allErrs, validateDisabledComponents(&newControlplane.Spec.ServerConfig)...)
 	allErrs = append(allErrs, newControlplane.validateMachineTemplate()...)
 
 	oldSet := oldControlplane.Spec.RegistrationMethod != ""
@@ -165,6 +169,13 @@ func (rv *RKE2ControlPlaneCustomValidator) ValidateUpdate(_ context.Context, old
 		)
 	}
 
+	if newControlplane.Spec.CertificateAuthorityProvider != oldControlplane.Spec.CertificateAuthorityProvider {
+		allErrs = append(allErrs,
+			field.Invalid(field.NewPath("spec", "certificateAuthorityProvider"),
+				newControlplane.Spec.CertificateAuthorityProvider, "field value is immutable"),
+		)
+	}
+
 	// Ensure new fields NodeDrainTimeout, NodeVolumeDetachTimeout and NodeDeletionTimeout are mutable
 	if oldControlplane.Spec.MachineTemplate.NodeDrainTimeout != nil && newControlplane.Spec.MachineTemplate.NodeDrainTimeout != nil &&
 		oldControlplane.Spec.MachineTemplate.NodeDrainTimeout.Duration != newControlplane.Spec.MachineTemplate.NodeDrainTimeout.Duration {
@@ -224,6 +235,28 @@ func (r *RKE2ControlPlane) validateCNI() field.ErrorList {
 	return allErrs
 }
 
+// validateDisabledComponents rejects the server configurations disabling etcd or the API server: all the servers of a
+// control plane share the same configuration, so the control plane would have neither, except for etcd when it is
+// external.
+func validateDisabledComponents(serverConfig *RKE2ServerConfig) field.ErrorList {
+	var allErrs field.ErrorList
+
+	path := field.NewPath("spec", "serverConfig", "disableComponents", "kubernetesComponents")
+
+	for i, component := range serverConfig.DisableComponents.KubernetesComponents {
+		switch {
+		case component == APIServer:
+			allErrs = append(allErrs,
+				field.Invalid(path.Index(i), component, "the API server can't be disabled on all the servers of a control plane"))
+		case component == Etcd && serverConfig.Etcd.External == nil:
+			allErrs = append(allErrs,
+				field.Invalid(path.Index(i), component, "etcd can only be disabled when the control plane uses an external etcd"))
+		}
+	}
+
+	return allErrs
+}
+
 func (r *RKE2ControlPlane) validateRegistrationMethod() field.ErrorList {
 	var allErrs field.ErrorList
 
@@ -238,6 +271,22 @@ func (r *RKE2ControlPlane) validateRegistrationMethod() field.ErrorList {
 	return allErrs
 }
 
+func (r *RKE2ControlPlane) validateCertificateAuthorityProvider() field.ErrorList {
+	var allErrs field.ErrorList
+
+	if r.Spec.CertificateAuthorityProvider == "" {
+		return allErrs
+	}
+
+	if _, err := secret.GetCAProvider(r.Spec.CertificateAuthorityProvider); err != nil {
+		allErrs = append(allErrs,
+			field.Invalid(field.NewPath("spec", "certificateAuthorityProvider"),
+				r.Spec.CertificateAuthorityProvider, "no CA provider is registered with this name"))
+	}
+
+	return allErrs
+}
+
 func (r *RKE2ControlPlane) validateMachineTemplate() field.ErrorList {
 	var allErrs field.ErrorList
 
@@ -268,5 +317,12 @@ func (r *RKE2ControlPlane) validateMachineTemplate() field.ErrorList {
 				r.Spec.MachineTemplate.NodeDeletionTimeout.Duration, "must be non-negative"))
 	}
 
+	// Validate BootstrapTimeout (must be positive)
+	if r.Spec.MachineTemplate.BootstrapTimeout != nil && r.Spec.MachineTemplate.BootstrapTimeout.Duration <= 0 {
+		allErrs = append(allErrs,
+			field.Invalid(field.NewPath("spec", "machineTemplate", "bootstrapTimeout"),
+				r.Spec.MachineTemplate.BootstrapTimeout.Duration, "must be positive"))
+	}
+
 	return allErrs
 }
@@ -0,0 +1,76 @@
+/*
+Copyright 2024 SUSE.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/secret"
+)
+
+type noopCAProvider struct{}
+
+func (noopCAProvider) GetCA(_ context.Context, _ secret.Purpose) (*x509.Certificate, error) {
+	return nil, nil
+}
+
+func (noopCAProvider) Sign(_ context.Context, _ secret.Purpose, _ *x509.CertificateRequest) (*x509.Certificate, error) {
+	return nil, nil
+}
+
+func TestRKE2ControlPlaneValidateCertificateAuthorityProvider(t *testing.T) {
+	secret.RegisterCAProvider("webhook-test", noopCAProvider{})
+
+	controlPlane := func(caProvider string) *RKE2ControlPlane {
+		return &RKE2ControlPlane{
+			Spec: RKE2ControlPlaneSpec{
+				MachineTemplate: RKE2ControlPlaneMachineTemplate{
+					InfrastructureRef: corev1.ObjectReference{Name: "infra"},
+				},
+				CertificateAuthorityProvider: caProvider,
+			},
+		}
+	}
+
+	validator := RKE2ControlPlaneCustomValidator{}
+
+	t.Run("allows a registered CA provider", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := validator.ValidateCreate(context.Background(), controlPlane("webhook-test"))
+		g.Expect(err).NotTo(HaveOccurred())
+	})
+
+	t.Run("rejects an unknown CA provider", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := validator.ValidateCreate(context.Background(), controlPlane("unknown"))
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("rejects a CA provider change", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := validator.ValidateUpdate(context.Background(), controlPlane(""), controlPlane("webhook-test"))
+		g.Expect(err).To(HaveOccurred())
+
+		_, err = validator.ValidateUpdate(context.Background(), controlPlane("webhook-test"), controlPlane("webhook-test"))
+		g.Expect(err).NotTo(HaveOccurred())
+	})
+}
@@ -88,6 +88,7 @@ func (r *RKE2ControlPlaneTemplateCustomValidator) ValidateCreate(_ context.Conte
 
 	allErrs = append(allErrs, bootstrapv1.ValidateRKE2ConfigSpec(rcpt.Name, &rcpt.Spec.Template.Spec.RKE2ConfigSpec)...)
 	allErrs = append(allErrs, rcpt.validateCNI()...)
+	allErrs = append(allErrs, validateDisabledComponents(&rcpt.Spec.Template.Spec.ServerConfig)...)
 	allErrs = append(allErrs, rcpt.validateRegistrationMethod()...)
 
 	if len(allErrs) == 0 {
@@ -118,6 +119,7 @@ func (r *RKE2ControlPlaneTemplateCustomValidator) ValidateUpdate(_ context.Conte
 
 	allErrs = append(allErrs, bootstrapv1.ValidateRKE2ConfigSpec(newControlplane.Name, &newControlplane.Spec.Template.Spec.RKE2ConfigSpec)...)
 	allErrs = append(allErrs, newControlplane.validateCNI()...)
+	allErrs = append(allErrs, validateDisabledComponents(&newControlplane.Spec.Template.Spec.ServerConfig)...)
 
 	oldSet := oldControlplane.Spec.Template.Spec.RegistrationMethod != ""
 	if oldSet && newControlplane.Spec.Template.Spec.RegistrationMethod != oldControlplane.Spec.Template.Spec.RegistrationMethod {
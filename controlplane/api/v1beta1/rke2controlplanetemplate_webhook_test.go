@@ -44,6 +44,60 @@ func TestRKE2ControlPlaneTemplateValidateCreate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "don't allow RKE2ControlPlaneTemplate disabling the API server",
+			inputTemplate: &RKE2ControlPlaneTemplate{
+				Spec: RKE2ControlPlaneTemplateSpec{
+					Template: RKE2ControlPlaneTemplateResource{
+						Spec: RKE2ControlPlaneSpec{
+							ServerConfig: RKE2ServerConfig{
+								DisableComponents: DisableComponents{
+									KubernetesComponents: []DisabledKubernetesComponent{Scheduler, APIServer, ControllerManager},
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "don't allow RKE2ControlPlaneTemplate disabling embedded etcd",
+			inputTemplate: &RKE2ControlPlaneTemplate{
+				Spec: RKE2ControlPlaneTemplateSpec{
+					Template: RKE2ControlPlaneTemplateResource{
+						Spec: RKE2ControlPlaneSpec{
+							ServerConfig: RKE2ServerConfig{
+								DisableComponents: DisableComponents{
+									KubernetesComponents: []DisabledKubernetesComponent{Etcd},
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "allow RKE2ControlPlaneTemplate disabling etcd with an external etcd",
+			inputTemplate: &RKE2ControlPlaneTemplate{
+				Spec: RKE2ControlPlaneTemplateSpec{
+					Template: RKE2ControlPlaneTemplateResource{
+						Spec: RKE2ControlPlaneSpec{
+							ServerConfig: RKE2ServerConfig{
+								DisableComponents: DisableComponents{
+									KubernetesComponents: []DisabledKubernetesComponent{Etcd},
+								},
+								Etcd: EtcdConfig{
+									External: &ExternalEtcd{Endpoints: []string{"https://etcd-0.example.com:2379"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
 	}
 	validator := RKE2ControlPlaneTemplateCustomValidator{}
 	for _, test := range tests {
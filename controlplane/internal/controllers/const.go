@@ -26,4 +26,20 @@ const (
 	// preflightFailedRequeueAfter is how long to wait before trying to scale
 	// up/down if some preflight check for those operation has failed.
 	preflightFailedRequeueAfter = 15 * time.Second
+
+	// etcdOperationInProgressRequeueAfter is how long to wait before trying again a destructive etcd
+	// operation when another one is in progress on the same workload cluster.
+	etcdOperationInProgressRequeueAfter = 10 * time.Second
+
+	// etcdMemberReplacementRequeueAfter is how long to wait before continuing the replacement of the etcd member
+	// of an outdated machine with the member of a new machine.
+	etcdMemberReplacementRequeueAfter = 10 * time.Second
+
+	// etcdVersionMismatchRequeueAfter is how long to wait before checking again that the etcd members run the etcd
+	// version embedded in the RKE2 version of their machine, before progressing a rollout.
+	etcdVersionMismatchRequeueAfter = 15 * time.Second
+
+	// serverConfigInPlaceRequeueAfter is how long to wait before checking again the progress of
+	// a server config update applied in place.
+	serverConfigInPlaceRequeueAfter = 15 * time.Second
 )
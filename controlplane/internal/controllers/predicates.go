@@ -0,0 +1,48 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// ignoreStatusOnlyUpdates returns a predicate filtering out RKE2ControlPlane updates which only change the status.
+// Those updates are mostly written by the controller itself at the end of each reconcile, so reacting to them
+// only causes reconcile churn. Spec changes bump the generation; metadata changes (labels, annotations such as
+// paused or the rollout triggers, finalizers, owner references and the deletion timestamp) are compared explicitly
+// since they don't.
+func ignoreStatusOnlyUpdates() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectOld == nil || e.ObjectNew == nil {
+				return true
+			}
+
+			oldObj, newObj := e.ObjectOld, e.ObjectNew
+
+			return oldObj.GetGeneration() != newObj.GetGeneration() ||
+				!reflect.DeepEqual(oldObj.GetLabels(), newObj.GetLabels()) ||
+				!reflect.DeepEqual(oldObj.GetAnnotations(), newObj.GetAnnotations()) ||
+				!reflect.DeepEqual(oldObj.GetFinalizers(), newObj.GetFinalizers()) ||
+				!reflect.DeepEqual(oldObj.GetOwnerReferences(), newObj.GetOwnerReferences()) ||
+				!oldObj.GetDeletionTimestamp().Equal(newObj.GetDeletionTimestamp())
+		},
+	}
+}
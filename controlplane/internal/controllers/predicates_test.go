@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestIgnoreStatusOnlyUpdates(t *testing.T) {
+	newRCP := func() *controlplanev1.RKE2ControlPlane {
+		return &controlplanev1.RKE2ControlPlane{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "rcp",
+				Namespace:       "default",
+				Generation:      1,
+				ResourceVersion: "1",
+				Annotations:     map[string]string{"foo": "bar"},
+			},
+			Spec: controlplanev1.RKE2ControlPlaneSpec{Replicas: ptr.To[int32](3)},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(rcp *controlplanev1.RKE2ControlPlane)
+		expect bool
+	}{
+		{
+			name: "status only update is filtered",
+			mutate: func(rcp *controlplanev1.RKE2ControlPlane) {
+				rcp.Status.ReadyReplicas = 3
+				rcp.Status.ObservedGeneration = 1
+			},
+			expect: false,
+		},
+		{
+			name: "spec change passes through",
+			mutate: func(rcp *controlplanev1.RKE2ControlPlane) {
+				rcp.Spec.Replicas = ptr.To[int32](5)
+				rcp.Generation = 2
+			},
+			expect: true,
+		},
+		{
+			name: "annotation change passes through",
+			mutate: func(rcp *controlplanev1.RKE2ControlPlane) {
+				rcp.Annotations["cluster.x-k8s.io/paused"] = ""
+			},
+			expect: true,
+		},
+		{
+			name: "label change passes through",
+			mutate: func(rcp *controlplanev1.RKE2ControlPlane) {
+				rcp.Labels = map[string]string{"foo": "bar"}
+			},
+			expect: true,
+		},
+		{
+			name: "finalizer change passes through",
+			mutate: func(rcp *controlplanev1.RKE2ControlPlane) {
+				rcp.Finalizers = []string{controlplanev1.RKE2ControlPlaneFinalizer}
+			},
+			expect: true,
+		},
+		{
+			name: "deletion passes through",
+			mutate: func(rcp *controlplanev1.RKE2ControlPlane) {
+				rcp.DeletionTimestamp = ptr.To(metav1.Now())
+			},
+			expect: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			oldRCP := newRCP()
+			updatedRCP := oldRCP.DeepCopy()
+			updatedRCP.ResourceVersion = "2"
+			tt.mutate(updatedRCP)
+
+			g.Expect(ignoreStatusOnlyUpdates().Update(event.UpdateEvent{ObjectOld: oldRCP, ObjectNew: updatedRCP})).To(Equal(tt.expect))
+		})
+	}
+
+	g := NewWithT(t)
+	g.Expect(ignoreStatusOnlyUpdates().Create(event.CreateEvent{Object: newRCP()})).To(BeTrue())
+	g.Expect(ignoreStatusOnlyUpdates().Delete(event.DeleteEvent{Object: newRCP()})).To(BeTrue())
+}
@@ -277,7 +277,17 @@ func (r *RKE2ControlPlaneReconciler) reconcileUnhealthyMachines(ctx context.Cont
 		// If the machine that is about to be deleted is the etcd leader, move it to the newest member available.
 		// NOTE: etcd member removal will be performed by the rke2-cleanup hook after machine completes drain & all volumes are detached.
 		if controlPlane.IsEtcdManaged() {
-			etcdLeaderCandidate := controlPlane.HealthyMachines().Newest()
+			release, err := r.acquireEtcdOperationLease(ctx, controlPlane)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+
+			if release == nil {
+				return ctrl.Result{RequeueAfter: etcdOperationInProgressRequeueAfter}, nil
+			}
+			defer release()
+
+			etcdLeaderCandidate := controlPlane.HealthyMachines().Filter(rke2.HasEtcdRole()).Newest()
 			if etcdLeaderCandidate == nil {
 				log.Info("A control plane machine needs remediation, but there is no healthy machine to forward etcd leadership to")
 				conditions.MarkFalse(
@@ -585,83 +595,26 @@ func (r *RKE2ControlPlaneReconciler) canSafelyRemoveEtcdMember(ctx context.Conte
 	// Gets the etcd status
 
 	// This makes it possible to have a set of etcd members status different from the MHC unhealthy/unhealthy conditions.
-	etcdMembers, err := workloadCluster.EtcdMembers(ctx)
+	etcdMembers, err := workloadCluster.EtcdLearnerStatus(ctx)
 	if err != nil {
 		return false, errors.Wrapf(err, "failed to get etcdStatus for workload cluster %s", controlPlane.Cluster.Name)
 	}
 
-	currentTotalMembers := len(etcdMembers)
-
 	log.Info("etcd cluster before remediation",
-		"currentTotalMembers", currentTotalMembers,
+		"currentTotalMembers", len(etcdMembers),
 		"currentMembers", etcdMembers)
 
 	// Projects the target etcd cluster after remediation, considering all the etcd members except the one being remediated.
-	targetTotalMembers := 0
-	targetUnhealthyMembers := 0
-
-	healthyMembers := []string{}
-	unhealthyMembers := []string{}
-
-	for _, etcdMember := range etcdMembers {
-		// Skip the machine to be deleted because it won't be part of the target etcd cluster.
-		if machineToBeRemediated.Status.NodeRef != nil && machineToBeRemediated.Status.NodeRef.Name == etcdMember {
-			continue
-		}
-
-		// Include the member in the target etcd cluster.
-		targetTotalMembers++
-
-		// Search for the machine corresponding to the etcd member.
-		var machine *clusterv1.Machine
-
-		for _, m := range controlPlane.Machines {
-			if m.Status.NodeRef != nil && m.Status.NodeRef.Name == etcdMember {
-				machine = m
-
-				break
-			}
-		}
-
-		// If an etcd member does not have a corresponding machine it is not possible to retrieve etcd member health,
-		// so RKE2ControlPlane is assuming the worst scenario and considering the member unhealthy.
-		//
-		// NOTE: This should not happen given that RKE2ControlPlane is running reconcileEtcdMembers before calling this method.
-		if machine == nil {
-			log.Info("An etcd member does not have a corresponding machine, assuming this member is unhealthy", "memberName", etcdMember)
-
-			targetUnhealthyMembers++
-
-			unhealthyMembers = append(unhealthyMembers, etcdMember+" (no machine)")
-
-			continue
-		}
-
-		// Check member health as reported by machine's health conditions
-		if !conditions.IsTrue(machine, controlplanev1.MachineEtcdMemberHealthyCondition) {
-			targetUnhealthyMembers++
-
-			unhealthyMembers = append(unhealthyMembers, fmt.Sprintf("%s (%s)", etcdMember, machine.Name))
-
-			continue
-		}
-
-		healthyMembers = append(healthyMembers, fmt.Sprintf("%s (%s)", etcdMember, machine.Name))
-	}
-
-	// See https://etcd.io/docs/v3.3/faq/#what-is-failure-tolerance for fault tolerance formula explanation.
-	targetQuorum := (targetTotalMembers / 2.0) + 1 //nolint:mnd
-	canSafelyRemediate := targetTotalMembers-targetUnhealthyMembers >= targetQuorum
+	safety := rke2.CanSafelyRemoveMachine(controlPlane.Machines, etcdMembers, machineToBeRemediated)
 
 	log.Info("etcd cluster projected after remediation of "+machineToBeRemediated.Name,
-		"healthyMembers", healthyMembers,
-		"unhealthyMembers", unhealthyMembers,
-		"targetTotalMembers", targetTotalMembers,
-		"targetQuorum", targetQuorum,
-		"targetUnhealthyMembers", targetUnhealthyMembers,
-		"canSafelyRemediate", canSafelyRemediate)
-
-	return canSafelyRemediate, nil
+		"targetVoters", safety.TargetVoters,
+		"targetQuorum", safety.TargetQuorum,
+		"targetHealthyVoters", safety.TargetHealthyVoters,
+		"canSafelyRemediate", safety.Safe,
+		"reason", safety.Reason)
+
+	return safety.Safe, nil
 }
 
 // RemediationData struct is used to keep track of information stored in the RemediationInProgressAnnotation in RKE2ControlPlane
@@ -30,6 +30,7 @@ import (
 	storagev1 "k8s.io/api/storage/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
@@ -37,6 +38,7 @@ import (
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -91,11 +93,54 @@ type RKE2ControlPlaneReconciler struct {
 	// WatchFilterValue is the label value used to filter events prior to reconciliation.
 	WatchFilterValue string
 
+	// AdditionalRolloutMatchers extend the criteria used to decide whether a control plane machine is up to date.
+	// Machines which do not satisfy all of them are rolled out.
+	AdditionalRolloutMatchers []collections.Func
+
+	// RolloutIgnoredRKE2ConfigFields are RKE2ConfigSpec field paths, e.g. experimental fields, whose changes don't roll
+	// out the control plane machines of any cluster, in addition to the RKE2ConfigIgnoreFieldsAnnotation of each
+	// RKE2ControlPlane. The machines drift from the RKE2ControlPlane when these fields change.
+	RolloutIgnoredRKE2ConfigFields []string
+
+	// StuckProvisioningThreshold is the duration after which control plane machines which are not Running yet are
+	// reported as stuck provisioning. rke2.DefaultStuckProvisioningThreshold is used if unset.
+	StuckProvisioningThreshold time.Duration
+
+	// EtcdMaintenanceOpsPerMinute is the number of etcd maintenance operations, e.g. database status calls, allowed
+	// per minute and workload cluster. Operations are not limited if not positive.
+	EtcdMaintenanceOpsPerMinute int
+
+	// EtcdLearnerPromotionTimeout is the duration after which the etcd learner of a control plane machine which is not
+	// promoted to a voting member yet is removed from the etcd cluster, and the machine remediated. Learners are not
+	// removed if not positive.
+	EtcdLearnerPromotionTimeout time.Duration
+
+	// EtcdRetryAttempts is the number of attempts of the etcd operations, e.g. the removal of an etcd member, failing with
+	// transient errors such as a leader election. Operations are not retried if not greater than 1.
+	EtcdRetryAttempts int
+
+	// EtcdRetryInterval is the delay before retrying an etcd operation for the first time, doubled for each retry.
+	EtcdRetryInterval time.Duration
+
+	// ChannelResolver resolves the release channels of the RKE2ControlPlanes, rke2.NewDefaultChannelResolver is used if
+	// unset.
+	ChannelResolver rke2.ChannelResolver
+
+	// WorkloadClusterHealthProbeInterval is the interval between two background probes of the etcd member health of the
+	// workload clusters, which are not probed in the background if not positive.
+	WorkloadClusterHealthProbeInterval time.Duration
+
+	// WorkloadClusterHealthStaleness is the age after which the health probed in the background is no longer used,
+	// rke2.DefaultWorkloadClusterHealthStaleness is used if not positive.
+	WorkloadClusterHealthStaleness time.Duration
+
+	// healthProbeCtx is the context of the background health probes, which outlives the reconciles.
+	healthProbeCtx context.Context
+
 	managementClusterUncached rke2.ManagementCluster
 	managementCluster         rke2.ManagementCluster
 	recorder                  record.EventRecorder
 	controller                controller.Controller
-	workloadCluster           rke2.WorkloadCluster
 	ssaCache                  ssa.Cache
 }
 
@@ -107,6 +152,7 @@ type RKE2ControlPlaneReconciler struct {
 // +kubebuilder:rbac:groups="",resources=secrets;events;configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="bootstrap.cluster.x-k8s.io",resources=rke2configs,verbs=get;list;watch;create;patch;delete
 // +kubebuilder:rbac:groups="infrastructure.cluster.x-k8s.io",resources=*,verbs=get;list;watch;create;patch;delete
+// +kubebuilder:rbac:groups="coordination.k8s.io",resources=leases,verbs=get;create;update;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -169,11 +215,23 @@ func (r *RKE2ControlPlaneReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	}
 
 	defer func() {
+		// The workload cluster client built for a previous control plane endpoint was dropped, retry right away so
+		// that a client is built for the new endpoint.
+		if errors.Is(reterr, rke2.ErrControlPlaneEndpointChanged) {
+			logger.Info("Control plane endpoint changed during the reconcile, requeueing", "err", reterr.Error())
+
+			res, reterr = ctrl.Result{Requeue: true}, nil
+		}
+
 		// Always attempt to update status.
 		if err := r.updateStatus(ctx, rcp, cluster); err != nil {
 			var connFailure *rke2.RemoteClusterConnectionError
-			if errors.As(err, &connFailure) {
+			if errors.As(err, &connFailure) && connFailure.IsRetryable() {
 				logger.Info("Could not connect to workload cluster to fetch status", "err", err.Error())
+			} else if errors.Is(err, rke2.ErrControlPlaneEndpointChanged) {
+				logger.Info("Control plane endpoint changed while fetching the status, requeueing", "err", err.Error())
+
+				res = ctrl.Result{Requeue: true}
 			} else {
 				logger.Error(err, "Failed to update RKE2ControlPlane Status")
 				reterr = kerrors.NewAggregate([]error{reterr, err})
@@ -218,6 +276,8 @@ func patchRKE2ControlPlane(ctx context.Context, patchHelper *patch.Helper, rcp *
 			controlplanev1.ResizedCondition,
 			controlplanev1.MachinesReadyCondition,
 			controlplanev1.AvailableCondition,
+			controlplanev1.InfrastructureTemplateAvailableCondition,
+			controlplanev1.ControlPlaneHealthyCondition,
 			// controlplanev1.CertificatesAvailableCondition,
 		),
 	)
@@ -232,6 +292,13 @@ func patchRKE2ControlPlane(ctx context.Context, patchHelper *patch.Helper, rcp *
 			controlplanev1.ResizedCondition,
 			controlplanev1.MachinesReadyCondition,
 			controlplanev1.AvailableCondition,
+			controlplanev1.InfrastructureTemplateAvailableCondition,
+			controlplanev1.BootstrapTokenValidCondition,
+			controlplanev1.WorkerVersionSkewCondition,
+			controlplanev1.MachinesInfrastructureTemplateAvailableCondition,
+			controlplanev1.CertificatesNotExpiringCondition,
+			controlplanev1.EtcdDBSizeWithinQuotaCondition,
+			controlplanev1.ControlPlaneHealthyCondition,
 		}},
 		patch.WithStatusObservedGeneration{},
 	)
@@ -240,8 +307,11 @@ func patchRKE2ControlPlane(ctx context.Context, patchHelper *patch.Helper, rcp *
 // SetupWithManager sets up the controller with the Manager.
 func (r *RKE2ControlPlaneReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, clientQPS float32, clientBurst, concurrency int) error {
 	c, err := ctrl.NewControllerManagedBy(mgr).
-		For(&controlplanev1.RKE2ControlPlane{}).
+		For(&controlplanev1.RKE2ControlPlane{}, builder.WithPredicates(ignoreStatusOnlyUpdates())).
 		Owns(&clusterv1.Machine{}).
+		// Only the metadata of the ConfigMaps is cached, to enqueue the RKE2ControlPlanes using a changed defaults ConfigMap.
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.defaultsConfigMapToRKE2ControlPlanes),
+			builder.OnlyMetadata).
 		WithOptions(controller.Options{
 			MaxConcurrentReconciles: concurrency,
 		}).
@@ -261,6 +331,10 @@ func (r *RKE2ControlPlaneReconciler) SetupWithManager(ctx context.Context, mgr c
 
 	r.controller = c
 	r.recorder = mgr.GetEventRecorderFor("rke2-control-plane-controller")
+
+	if r.ChannelResolver == nil {
+		r.ChannelResolver = rke2.NewDefaultChannelResolver()
+	}
 	r.ssaCache = ssa.NewCache("rke2-control-plane")
 
 	// Set up a clusterCache to provide to controllers
@@ -293,16 +367,39 @@ func (r *RKE2ControlPlaneReconciler) SetupWithManager(ctx context.Context, mgr c
 		return errors.Wrap(err, "unable to create cluster cache tracker")
 	}
 
+	// The limiter is shared by both management clusters, so the operations of a cluster are throttled together.
+	etcdMaintenanceLimiter := rke2.NewEtcdMaintenanceRateLimiter(r.EtcdMaintenanceOpsPerMinute)
+	etcdRetryBackoff := rke2.NewEtcdRetryBackoff(r.EtcdRetryAttempts, r.EtcdRetryInterval)
+
+	var healthProber *rke2.WorkloadClusterHealthProber
+	if r.WorkloadClusterHealthProbeInterval > 0 {
+		healthProber = rke2.NewWorkloadClusterHealthProber(r.WorkloadClusterHealthProbeInterval, r.WorkloadClusterHealthStaleness)
+	}
+
+	r.healthProbeCtx = ctx
+
 	if r.managementCluster == nil {
 		r.managementCluster = &rke2.Management{
-			Client:              r.Client,
-			SecretCachingClient: r.SecretCachingClient,
-			ClusterCache:        clusterCache,
+			Client:                     r.Client,
+			SecretCachingClient:        r.SecretCachingClient,
+			ClusterCache:               clusterCache,
+			APIReader:                  mgr.GetAPIReader(),
+			Recorder:                   r.recorder,
+			EtcdMaintenanceRateLimiter: etcdMaintenanceLimiter,
+			EtcdRetryBackoff:           &etcdRetryBackoff,
+			HealthProber:               healthProber,
 		}
 	}
 
 	if r.managementClusterUncached == nil {
-		r.managementClusterUncached = &rke2.Management{Client: mgr.GetClient()}
+		r.managementClusterUncached = &rke2.Management{
+			Client:                     mgr.GetClient(),
+			APIReader:                  mgr.GetAPIReader(),
+			Recorder:                   r.recorder,
+			EtcdMaintenanceRateLimiter: etcdMaintenanceLimiter,
+			EtcdRetryBackoff:           &etcdRetryBackoff,
+			HealthProber:               healthProber,
+		}
 	}
 
 	return nil
@@ -355,8 +452,15 @@ func (r *RKE2ControlPlaneReconciler) updateStatus(ctx context.Context, rcp *cont
 
 		return err
 	}
+	defer closeControlPlane(ctx, controlPlane)
+
+	controlPlane.AdditionalRolloutMatchers = r.AdditionalRolloutMatchers
+	controlPlane.RolloutIgnoredRKE2ConfigFields = r.RolloutIgnoredRKE2ConfigFields
+	controlPlane.ResolveDesiredVersion(ctx, r.ChannelResolver)
 
-	rcp.Status.UpdatedReplicas = rke2util.SafeInt32(len(controlPlane.UpToDateMachines()))
+	// Machines without a ProviderID are not provisioned yet and are not reported as updated.
+	rcp.Status.UpdatedReplicas = rke2util.SafeInt32(len(controlPlane.UpToDateMachines().Filter(rke2.HasProviderID())))
+	rcp.Status.InfrastructureTemplate = controlPlane.InfrastructureTemplateStatus()
 	replicas := rke2util.SafeInt32(len(ownedMachines))
 	desiredReplicas := *rcp.Spec.Replicas
 
@@ -535,11 +639,15 @@ func (r *RKE2ControlPlaneReconciler) reconcileNormal(
 	certificates := secret.NewCertificatesForInitialControlPlane()
 	if _, found := rcp.Annotations[controlplanev1.LegacyRKE2ControlPlane]; found {
 		certificates = secret.NewCertificatesForLegacyControlPlane()
+	} else if rcp.Spec.ServerConfig.Etcd.External != nil {
+		certificates = secret.NewCertificatesForExternalEtcdControlPlane()
 	}
 
 	controllerRef := metav1.NewControllerRef(rcp, controlplanev1.GroupVersion.WithKind("RKE2ControlPlane"))
 
-	if err := certificates.LookupOrGenerate(ctx, r.Client, util.ObjectKey(cluster), *controllerRef); err != nil {
+	if err := certificates.LookupOrIssue(
+		ctx, r.Client, util.ObjectKey(cluster), *controllerRef, rcp.Spec.CertificateAuthorityProvider,
+	); err != nil {
 		logger.Error(err, "unable to lookup or create cluster certificates")
 		conditions.MarkFalse(
 			rcp, controlplanev1.CertificatesAvailableCondition,
@@ -569,10 +677,13 @@ func (r *RKE2ControlPlaneReconciler) reconcileNormal(
 		return result, err
 	}
 
-	controlPlaneMachines, err := r.managementClusterUncached.GetMachinesForCluster(
-		ctx,
-		util.ObjectKey(cluster),
-		collections.ControlPlaneMachines(cluster.Name))
+	if err := r.reconcileServerDefaultsHash(ctx, rcp); err != nil {
+		logger.Error(err, "failed to reconcile server defaults")
+
+		return ctrl.Result{}, err
+	}
+
+	controlPlaneMachines, err := r.managementClusterUncached.GetControlPlaneMachines(ctx, util.ObjectKey(cluster))
 	if err != nil {
 		logger.Error(err, "failed to retrieve control plane machines for cluster")
 
@@ -592,6 +703,26 @@ func (r *RKE2ControlPlaneReconciler) reconcileNormal(
 
 		return ctrl.Result{}, err
 	}
+	defer closeControlPlane(ctx, controlPlane)
+
+	controlPlane.AdditionalRolloutMatchers = r.AdditionalRolloutMatchers
+	controlPlane.RolloutIgnoredRKE2ConfigFields = r.RolloutIgnoredRKE2ConfigFields
+	controlPlane.ResolveDesiredVersion(ctx, r.ChannelResolver)
+
+	if controlPlane.IsEtcdManaged() && r.healthProbeCtx != nil {
+		r.managementCluster.WatchWorkloadClusterHealth(r.healthProbeCtx, util.ObjectKey(cluster))
+	}
+
+	r.reportMachinesStuckProvisioning(ctx, controlPlane)
+
+	backfilled, err := controlPlane.BackfillAdoptedMachines(ctx, r.Client)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to backfill annotations of adopted Machines")
+	}
+
+	if len(backfilled) > 0 {
+		logger.Info("Backfilled annotations of adopted Machines", "machines", backfilled)
+	}
 
 	if err := r.syncMachines(ctx, controlPlane); err != nil {
 		return ctrl.Result{}, errors.Wrap(err, "failed to sync Machines")
@@ -622,12 +753,24 @@ func (r *RKE2ControlPlaneReconciler) reconcileNormal(
 		return result, err
 	}
 
+	// Removes the etcd learners which failed to be promoted, and marks their machines for remediation.
+	// NOTE: Failing to do so must not prevent the remediation of the machines already marked as unhealthy.
+	if err := r.reconcileEtcdLearners(ctx, controlPlane); err != nil {
+		logger.Error(err, "failed to reconcile etcd learners")
+	}
+
 	// Reconcile unhealthy machines by triggering deletion and requeue if it is considered safe to remediate,
 	// otherwise continue with the other RCP operations.
 	if result, err := r.reconcileUnhealthyMachines(ctx, controlPlane); err != nil || !result.IsZero() {
 		return result, err
 	}
 
+	// Apply hot-reloadable server config changes in place, when enabled, one machine at a time. The rollout of the
+	// other changes waits for the machine being updated.
+	if result := r.reconcileServerConfigInPlace(ctx, controlPlane); !result.IsZero() {
+		return result, nil
+	}
+
 	// Control plane machines rollout due to configuration changes (e.g. upgrades) takes precedence over other operations.
 	needRollout := controlPlane.MachinesNeedingRollout()
 
@@ -657,6 +800,15 @@ func (r *RKE2ControlPlaneReconciler) reconcileNormal(
 
 	desiredReplicas := int(*rcp.Spec.Replicas)
 
+	// Re-evaluate the infrastructure template when no machine is created, so the InfrastructureTemplateAvailable
+	// condition reports the current template rather than the one of the last scale up, e.g. after a scale down. Machine
+	// creation is not waited for, so a missing template does not requeue.
+	if numMachines >= desiredReplicas {
+		if _, err := r.reconcileInfrastructureTemplate(ctx, rcp); err != nil {
+			logger.Error(err, "Failed to check the infrastructure template")
+		}
+	}
+
 	switch {
 	// We are creating the first replica
 	case numMachines < desiredReplicas && numMachines == 0:
@@ -687,15 +839,16 @@ func (r *RKE2ControlPlaneReconciler) reconcileNormal(
 
 // GetWorkloadCluster builds a cluster object.
 // The cluster comes with an etcd client generator to connect to any etcd pod living on a managed machine.
+// The workload cluster is shared with the control plane and closed together with it.
 func (r *RKE2ControlPlaneReconciler) GetWorkloadCluster(ctx context.Context, controlPlane *rke2.ControlPlane) (rke2.WorkloadCluster, error) {
-	workloadCluster, err := r.managementCluster.GetWorkloadCluster(ctx, client.ObjectKeyFromObject(controlPlane.Cluster))
-	if err != nil {
-		return nil, err
-	}
-
-	r.workloadCluster = workloadCluster
+	return controlPlane.GetWorkloadCluster(ctx)
+}
 
-	return r.workloadCluster, nil
+// closeControlPlane releases the workload cluster connections of the control plane at the end of a reconciliation.
+func closeControlPlane(ctx context.Context, controlPlane *rke2.ControlPlane) {
+	if err := controlPlane.Close(); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "failed to close workload cluster connections")
+	}
 }
 
 // reconcileEtcdMembers ensures the number of etcd members is in sync with the number of machines/nodes.
@@ -716,6 +869,10 @@ func (r *RKE2ControlPlaneReconciler) reconcileEtcdMembers(ctx context.Context, c
 		return nil
 	}
 
+	if !controlPlane.IsEtcdManaged() {
+		return nil
+	}
+
 	// Collect all the node names.
 	nodeNames := []string{}
 
@@ -740,9 +897,11 @@ func (r *RKE2ControlPlaneReconciler) reconcileEtcdMembers(ctx context.Context, c
 		return errors.Wrap(err, "cannot get remote client to workload cluster")
 	}
 
-	parsedVersion, err := semver.ParseTolerant(controlPlane.RCP.GetDesiredVersion())
+	desiredVersion := controlPlane.DesiredVersion
+
+	parsedVersion, err := semver.ParseTolerant(desiredVersion)
 	if err != nil {
-		return errors.Wrapf(err, "failed to parse kubernetes version %q", controlPlane.RCP.GetDesiredVersion())
+		return errors.Wrapf(err, "failed to parse kubernetes version %q", desiredVersion)
 	}
 
 	removedMembers, err := workloadCluster.ReconcileEtcdMembers(ctx, nodeNames, parsedVersion)
@@ -757,12 +916,107 @@ func (r *RKE2ControlPlaneReconciler) reconcileEtcdMembers(ctx context.Context, c
 	return nil
 }
 
+// reconcileServerConfigInPlace applies the changes of the hot-reloadable server config fields to the control plane
+// machines in place, when enabled, and requeues while a machine is being updated. Failing to do so is only logged,
+// the changes are applied again on the next reconcile, and rolled out once they failed too many times on a machine.
+func (r *RKE2ControlPlaneReconciler) reconcileServerConfigInPlace(ctx context.Context, controlPlane *rke2.ControlPlane) ctrl.Result {
+	logger := log.FromContext(ctx)
+
+	workloadCluster, err := controlPlane.GetWorkloadCluster(ctx)
+	if err != nil {
+		logger.Error(err, "Unable to get workload cluster to apply server config in place")
+
+		return ctrl.Result{}
+	}
+
+	inProgress, err := workloadCluster.ReconcileRKE2ServerConfigInPlace(ctx, controlPlane)
+	if err != nil {
+		logger.Error(err, "Unable to apply server config in place")
+	}
+
+	// The server config applied in place, or the failed attempts, are recorded on the machines.
+	if err := controlPlane.PatchMachines(ctx); err != nil {
+		logger.Error(err, "Unable to patch machines after applying server config in place")
+	}
+
+	if inProgress {
+		return ctrl.Result{RequeueAfter: serverConfigInPlaceRequeueAfter}
+	}
+
+	return ctrl.Result{}
+}
+
+// reconcileEtcdLearners removes the etcd learners which are not promoted to voting members within the
+// EtcdLearnerPromotionTimeout, and marks their machines as unhealthy so they are remediated by the RKE2ControlPlane.
+func (r *RKE2ControlPlaneReconciler) reconcileEtcdLearners(ctx context.Context, controlPlane *rke2.ControlPlane) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	if r.EtcdLearnerPromotionTimeout <= 0 || controlPlane.Machines.Len() == 0 || !controlPlane.IsEtcdManaged() {
+		return nil
+	}
+
+	if _, found := controlPlane.RCP.Annotations[controlplanev1.LegacyRKE2ControlPlane]; found {
+		return nil
+	}
+
+	workloadCluster, err := r.GetWorkloadCluster(ctx, controlPlane)
+	if err != nil {
+		return errors.Wrap(err, "cannot get remote client to workload cluster")
+	}
+
+	evacuated, err := workloadCluster.EvacuateEtcdLearnerOnFailure(ctx, controlPlane.Machines, r.EtcdLearnerPromotionTimeout)
+	if err != nil {
+		return errors.Wrap(err, "failed to evacuate etcd learners")
+	}
+
+	errList := []error{}
+
+	for _, machineName := range evacuated {
+		machine, ok := controlPlane.Machines[machineName]
+		if !ok || !machine.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		log.Info("Marking machine for remediation, its etcd learner was not promoted", "machine", machineName)
+
+		patchHelper, err := patch.NewHelper(machine, r.Client)
+		if err != nil {
+			errList = append(errList, err)
+
+			continue
+		}
+
+		conditions.MarkFalse(machine,
+			clusterv1.MachineHealthCheckSucceededCondition,
+			controlplanev1.EtcdLearnerPromotionFailedReason,
+			clusterv1.ConditionSeverityWarning,
+			"etcd member was not promoted to a voting member within %s", r.EtcdLearnerPromotionTimeout)
+		conditions.MarkFalse(machine,
+			clusterv1.MachineOwnerRemediatedCondition,
+			clusterv1.WaitingForRemediationReason,
+			clusterv1.ConditionSeverityWarning,
+			"")
+
+		if err := patchHelper.Patch(ctx, machine, patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
+			clusterv1.MachineHealthCheckSucceededCondition,
+			clusterv1.MachineOwnerRemediatedCondition,
+		}}); err != nil {
+			errList = append(errList, errors.Wrapf(err, "failed to patch machine %s", machine.Name))
+		}
+	}
+
+	return kerrors.NewAggregate(errList)
+}
+
 func (r *RKE2ControlPlaneReconciler) reconcileDelete(ctx context.Context,
 	cluster *clusterv1.Cluster,
 	rcp *controlplanev1.RKE2ControlPlane,
 ) (res ctrl.Result, err error) {
 	logger := log.FromContext(ctx)
 
+	// The health of a cluster being deleted is no longer probed in the background.
+	r.managementCluster.StopWatchingWorkloadClusterHealth(util.ObjectKey(cluster))
+
 	// Gets all machines, not just control plane machines.
 	allMachines, err := r.managementCluster.GetMachinesForCluster(ctx, util.ObjectKey(cluster))
 	if err != nil {
@@ -779,6 +1033,13 @@ func (r *RKE2ControlPlaneReconciler) reconcileDelete(ctx context.Context,
 		}
 
 		controllerutil.RemoveFinalizer(rcp, controlplanev1.RKE2ControlPlaneFinalizer)
+		rke2.ForgetRolloutDecisions(util.ObjectKey(cluster))
+		rke2.ForgetEtcdLeaderChanges(util.ObjectKey(cluster))
+		rke2.ForgetEtcdLearners(util.ObjectKey(cluster))
+		rke2.ForgetEtcdMemberReplacements(util.ObjectKey(cluster))
+		rke2.ForgetClusterCacheInvalidation(util.ObjectKey(cluster))
+		rke2.ForgetAPIServerCertificate(util.ObjectKey(cluster))
+		r.managementCluster.ForgetEtcdMaintenance(util.ObjectKey(cluster))
 
 		return ctrl.Result{}, nil
 	}
@@ -789,6 +1050,11 @@ func (r *RKE2ControlPlaneReconciler) reconcileDelete(ctx context.Context,
 
 		return ctrl.Result{}, err
 	}
+	defer closeControlPlane(ctx, controlPlane)
+
+	controlPlane.AdditionalRolloutMatchers = r.AdditionalRolloutMatchers
+	controlPlane.RolloutIgnoredRKE2ConfigFields = r.RolloutIgnoredRKE2ConfigFields
+	controlPlane.ResolveDesiredVersion(ctx, r.ChannelResolver)
 
 	// Updates conditions reporting the status of static pods and the status of the etcd cluster.
 	// NOTE: Ignoring failures given that we are deleting
@@ -917,7 +1183,23 @@ func (r *RKE2ControlPlaneReconciler) reconcileKubeconfig(
 		return ctrl.Result{}, err
 	}
 
-	if needsRotation {
+	needsEndpointUpdate, err := kubeconfig.NeedsEndpointUpdate(configSecret, endpoint.String())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	switch {
+	case needsEndpointUpdate:
+		logger.Info("Control plane endpoint changed, regenerating kubeconfig secret", "endpoint", endpoint.String())
+
+		if err := kubeconfig.UpdateSecret(ctx, r.Client, clusterName, endpoint.String(), configSecret); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to regenerate kubeconfig")
+		}
+
+		// The ClusterCache keeps the clients built from the previous kubeconfig until it reconnects.
+		rke2.InvalidateClusterCache(clusterName, endpoint)
+
+	case needsRotation:
 		logger.Info("Rotating kubeconfig secret")
 
 		if err := kubeconfig.UpdateSecret(ctx, r.Client, clusterName, endpoint.String(), configSecret); err != nil {
@@ -928,6 +1210,29 @@ func (r *RKE2ControlPlaneReconciler) reconcileKubeconfig(
 	return ctrl.Result{}, nil
 }
 
+// reconcileServerDefaultsHash records the hash of the server defaults ConfigMap on the RKE2ControlPlane.
+// New machines copy the hash, so a change of the defaults marks existing machines as outdated.
+func (r *RKE2ControlPlaneReconciler) reconcileServerDefaultsHash(ctx context.Context, rcp *controlplanev1.RKE2ControlPlane) error {
+	defaultsHash, err := rke2.ServerDefaultsHash(ctx, r.Client, rcp.Spec.ServerConfig.DefaultsConfigMap)
+	if err != nil {
+		return err
+	}
+
+	if defaultsHash == "" {
+		delete(rcp.Annotations, controlplanev1.ServerDefaultsHashAnnotation)
+
+		return nil
+	}
+
+	if rcp.Annotations == nil {
+		rcp.Annotations = map[string]string{}
+	}
+
+	rcp.Annotations[controlplanev1.ServerDefaultsHashAnnotation] = defaultsHash
+
+	return nil
+}
+
 // reconcileControlPlaneConditions is responsible of reconciling conditions reporting the status of static pods and
 // the status of the etcd cluster.
 func (r *RKE2ControlPlaneReconciler) reconcileControlPlaneConditions(
@@ -974,6 +1279,10 @@ func (r *RKE2ControlPlaneReconciler) reconcileControlPlaneConditions(
 		}
 	}()
 
+	// Report per machine whether it is up to date with the RCP configuration.
+	controlPlane.UpdateMachinesUpToDateCondition()
+	r.updateMachinesInfrastructureTemplateCondition(ctx, controlPlane)
+
 	if err := workloadCluster.InitWorkload(ctx, controlPlane); err != nil {
 		logger.Error(err, "Unable to initialize workload cluster")
 
@@ -982,7 +1291,19 @@ func (r *RKE2ControlPlaneReconciler) reconcileControlPlaneConditions(
 
 	// Update conditions status
 	workloadCluster.UpdateAgentConditions(controlPlane)
+	updateControlPlaneComponentsHealthyCondition(ctx, controlPlane.RCP, workloadCluster)
 	workloadCluster.UpdateEtcdConditions(controlPlane)
+	workloadCluster.UpdateEtcdMembersStatus(ctx, controlPlane)
+	updateBootstrapTokenCondition(ctx, controlPlane.RCP, workloadCluster)
+	updateWorkerVersionSkewCondition(ctx, controlPlane.RCP, controlPlane.DesiredVersion, workloadCluster)
+	r.updateCertificatesExpiryCondition(ctx, controlPlane, workloadCluster)
+	updateEtcdDBSizeCondition(ctx, controlPlane.RCP, workloadCluster)
+	observeEtcdLeaderChanges(ctx, controlPlane, workloadCluster)
+	updateEtcdOperationsCondition(controlPlane.RCP)
+	r.reconcileAddons(ctx, controlPlane.RCP, workloadCluster)
+	reconcileControlPlaneVIP(ctx, controlPlane.RCP, workloadCluster)
+
+	updateControlPlaneHealthyCondition(ctx, controlPlane.RCP, workloadCluster)
 
 	// Patch nodes metadata
 	if err := workloadCluster.UpdateNodeMetadata(ctx, controlPlane); err != nil {
@@ -991,10 +1312,378 @@ func (r *RKE2ControlPlaneReconciler) reconcileControlPlaneConditions(
 		return ctrl.Result{}, err
 	}
 
+	// Allow workloads on the ready control plane nodes, when enabled.
+	if _, err := workloadCluster.EnsureNodeTaintsRemovedOnReady(ctx, controlPlane.RCP, controlPlane.Machines); err != nil {
+		logger.Error(err, "Unable to remove control plane taints")
+	}
+
 	// RCP will be patched at the end of Reconcile to reflect updated conditions, so we can return now.
 	return ctrl.Result{}, nil
 }
 
+// updateControlPlaneComponentsHealthyCondition reports the control plane components whose static pod is not ready or
+// whose health endpoints fail in the ControlPlaneComponentsHealthy condition, on top of the health of the agents. A
+// condition already reporting agents which are not healthy is kept, as it points to the root cause.
+func updateControlPlaneComponentsHealthyCondition(
+	ctx context.Context,
+	rcp *controlplanev1.RKE2ControlPlane,
+	workloadCluster rke2.WorkloadCluster,
+) {
+	if conditions.IsFalse(rcp, controlplanev1.ControlPlaneComponentsHealthyCondition) {
+		return
+	}
+
+	health, err := workloadCluster.ControlPlaneComponentHealth(ctx)
+	if err != nil {
+		log.FromContext(ctx).V(2).Info("Failed to check the health of the control plane components", "error", err.Error())
+
+		return
+	}
+
+	unhealthy := []string{}
+
+	for _, component := range health {
+		if !component.Healthy {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s on node %s: %s", component.Component, component.NodeName, component.Reason))
+		}
+	}
+
+	if len(unhealthy) == 0 {
+		return
+	}
+
+	conditions.MarkFalse(rcp,
+		controlplanev1.ControlPlaneComponentsHealthyCondition,
+		controlplanev1.ControlPlaneComponentsUnhealthyReason,
+		clusterv1.ConditionSeverityWarning,
+		"%s", strings.Join(unhealthy, "; "))
+}
+
+// updateBootstrapTokenCondition reports whether new nodes can still join the workload cluster.
+func updateBootstrapTokenCondition(ctx context.Context, rcp *controlplanev1.RKE2ControlPlane, workloadCluster rke2.WorkloadCluster) {
+	err := workloadCluster.CheckBootstrapTokens(ctx)
+
+	switch {
+	case err == nil:
+		conditions.MarkTrue(rcp, controlplanev1.BootstrapTokenValidCondition)
+	case errors.Is(err, rke2.ErrBootstrapTokensExpired):
+		conditions.MarkFalse(rcp,
+			controlplanev1.BootstrapTokenValidCondition,
+			controlplanev1.BootstrapTokenExpiredReason,
+			clusterv1.ConditionSeverityWarning,
+			"%s", err.Error())
+	default:
+		conditions.MarkUnknown(rcp,
+			controlplanev1.BootstrapTokenValidCondition,
+			controlplanev1.BootstrapTokenInspectionFailedReason,
+			"%s", err.Error())
+	}
+}
+
+// updateWorkerVersionSkewCondition warns when worker nodes lag the desired version of the control plane by more than
+// the supported skew.
+func updateWorkerVersionSkewCondition(
+	ctx context.Context,
+	rcp *controlplanev1.RKE2ControlPlane,
+	desiredVersion string,
+	workloadCluster rke2.WorkloadCluster,
+) {
+	err := workloadCluster.CheckWorkerVersionSkew(ctx, desiredVersion)
+
+	switch {
+	case err == nil:
+		conditions.MarkTrue(rcp, controlplanev1.WorkerVersionSkewCondition)
+	case errors.Is(err, rke2.ErrWorkerVersionSkew):
+		conditions.MarkFalse(rcp,
+			controlplanev1.WorkerVersionSkewCondition,
+			controlplanev1.WorkerVersionSkewExceededReason,
+			clusterv1.ConditionSeverityWarning,
+			"%s", err.Error())
+	default:
+		conditions.MarkUnknown(rcp,
+			controlplanev1.WorkerVersionSkewCondition,
+			controlplanev1.WorkerVersionSkewInspectionFailedReason,
+			"%s", err.Error())
+	}
+}
+
+// reportMachinesStuckProvisioning logs the control plane machines which are not Running longer than the stuck
+// provisioning threshold after their creation. They are only reported, remediation is left to MachineHealthChecks.
+func (r *RKE2ControlPlaneReconciler) reportMachinesStuckProvisioning(ctx context.Context, controlPlane *rke2.ControlPlane) {
+	threshold := r.StuckProvisioningThreshold
+	if threshold <= 0 {
+		threshold = rke2.DefaultStuckProvisioningThreshold
+	}
+
+	stuck := controlPlane.MachinesStuckProvisioning(threshold)
+	if len(stuck) == 0 {
+		return
+	}
+
+	log.FromContext(ctx).Info("Control plane machines are stuck provisioning",
+		"machines", stuck.Names(), "threshold", threshold.String())
+}
+
+// updateEtcdDBSizeCondition warns when the database of an etcd member exceeds rke2.EtcdDBQuotaWarningPercent of the
+// etcd quota, so it can be compacted and defragmented before etcd raises a NOSPACE alarm.
+func updateEtcdDBSizeCondition(ctx context.Context, rcp *controlplanev1.RKE2ControlPlane, workloadCluster rke2.WorkloadCluster) {
+	statuses, err := workloadCluster.EtcdDBStatus(ctx, rke2.EtcdQuotaBackendBytes(rcp))
+	if errors.Is(err, rke2.ErrEtcdMaintenanceRateLimited) {
+		// Keep the condition reported by the last inspection until the next one is allowed.
+		log.FromContext(ctx).V(4).Info("Skipping etcd database size inspection", "reason", err.Error())
+
+		return
+	}
+
+	if err != nil {
+		conditions.MarkUnknown(rcp,
+			controlplanev1.EtcdDBSizeWithinQuotaCondition,
+			controlplanev1.EtcdDBSizeInspectionFailedReason,
+			"%s", err.Error())
+
+		return
+	}
+
+	nearQuota := []string{}
+
+	for _, status := range statuses {
+		if status.PercentFull > rke2.EtcdDBQuotaWarningPercent {
+			nearQuota = append(nearQuota, fmt.Sprintf("%s is %d%% full", status.Name, status.PercentFull))
+		}
+	}
+
+	if len(nearQuota) > 0 {
+		conditions.MarkFalse(rcp,
+			controlplanev1.EtcdDBSizeWithinQuotaCondition,
+			controlplanev1.EtcdDBSizeNearQuotaReason,
+			clusterv1.ConditionSeverityWarning,
+			"etcd databases must be defragmented: %s", strings.Join(nearQuota, ", "))
+
+		return
+	}
+
+	conditions.MarkTrue(rcp, controlplanev1.EtcdDBSizeWithinQuotaCondition)
+}
+
+// observeEtcdLeaderChanges counts the etcd leader changes of the workload cluster since the previous reconcile, an early
+// sign of etcd instability, and logs them.
+func observeEtcdLeaderChanges(ctx context.Context, controlPlane *rke2.ControlPlane, workloadCluster rke2.WorkloadCluster) {
+	changes, err := workloadCluster.EtcdLeaderChanges(ctx)
+	if err != nil {
+		log.FromContext(ctx).V(4).Info("Failed to get etcd leader changes of some members", "reason", err.Error())
+	}
+
+	if delta := rke2.ObserveEtcdLeaderChanges(util.ObjectKey(controlPlane.Cluster), changes); delta > 0 {
+		log.FromContext(ctx).Info("etcd leader changed since the last reconcile", "leaderChanges", delta, "total", changes.Total)
+	}
+}
+
+// updateEtcdOperationsCondition reports that the etcd operations of the controller are paused by the
+// EtcdOperationsPausedAnnotation, and removes the condition once they are resumed.
+func updateEtcdOperationsCondition(rcp *controlplanev1.RKE2ControlPlane) {
+	if !rke2.EtcdOperationsPaused(rcp) {
+		conditions.Delete(rcp, controlplanev1.EtcdOperationsAllowedCondition)
+
+		return
+	}
+
+	conditions.MarkFalse(rcp,
+		controlplanev1.EtcdOperationsAllowedCondition,
+		controlplanev1.EtcdOperationsPausedReason,
+		clusterv1.ConditionSeverityWarning,
+		"etcd members are not removed, nor alarms cleared, until the %s annotation is removed",
+		controlplanev1.EtcdOperationsPausedAnnotation)
+}
+
+// updateCertificatesExpiryCondition warns when serving certificates of the workload cluster expire within
+// rke2.CertificateExpiryWarningThreshold, and reports certificates signed by a cluster CA which was not generated
+// by a controller as externally managed.
+func (r *RKE2ControlPlaneReconciler) updateCertificatesExpiryCondition(
+	ctx context.Context,
+	controlPlane *rke2.ControlPlane,
+	workloadCluster rke2.WorkloadCluster,
+) {
+	rcp := controlPlane.RCP
+
+	expiries, err := workloadCluster.CertificateExpiry(ctx)
+	if err != nil {
+		conditions.MarkUnknown(rcp,
+			controlplanev1.CertificatesNotExpiringCondition,
+			controlplanev1.CertificatesInspectionFailedReason,
+			"%s", err.Error())
+
+		return
+	}
+
+	clusterCA := &corev1.Secret{}
+	clusterCAKey := client.ObjectKey{
+		Namespace: controlPlane.Cluster.Namespace,
+		Name:      secret.Name(controlPlane.Cluster.Name, secret.ClusterCA),
+	}
+
+	if err := r.Client.Get(ctx, clusterCAKey, clusterCA); client.IgnoreNotFound(err) != nil {
+		conditions.MarkUnknown(rcp,
+			controlplanev1.CertificatesNotExpiringCondition,
+			controlplanev1.CertificatesInspectionFailedReason,
+			"failed to get cluster CA secret: %s", err.Error())
+
+		return
+	}
+
+	externallyManaged := clusterCA.Name != "" && metav1.GetControllerOf(clusterCA) == nil
+
+	expiring := []string{}
+	warningTime := time.Now().Add(rke2.CertificateExpiryWarningThreshold)
+
+	for _, expiry := range expiries {
+		if expiry.NotAfter.Before(warningTime) {
+			expiring = append(expiring, fmt.Sprintf("%s expires at %s", expiry.Name, expiry.NotAfter.UTC().Format(time.RFC3339)))
+		}
+	}
+
+	switch {
+	case len(expiring) > 0 && externallyManaged:
+		conditions.MarkFalse(rcp,
+			controlplanev1.CertificatesNotExpiringCondition,
+			controlplanev1.CertificatesExpiringReason,
+			clusterv1.ConditionSeverityWarning,
+			"Externally managed certificates must be rotated: %s", strings.Join(expiring, ", "))
+	case len(expiring) > 0:
+		conditions.MarkFalse(rcp,
+			controlplanev1.CertificatesNotExpiringCondition,
+			controlplanev1.CertificatesExpiringReason,
+			clusterv1.ConditionSeverityWarning,
+			"Certificates must be rotated: %s", strings.Join(expiring, ", "))
+	case externallyManaged:
+		conditions.MarkUnknown(rcp,
+			controlplanev1.CertificatesNotExpiringCondition,
+			controlplanev1.CertificatesExternallyManagedReason,
+			"Certificates are externally managed")
+	default:
+		conditions.MarkTrue(rcp, controlplanev1.CertificatesNotExpiringCondition)
+	}
+}
+
+// updateMachinesInfrastructureTemplateCondition warns when machines were cloned from an infrastructure template
+// which no longer exists. It does not trigger a rollout, the machines need to be adopted or cleaned up by an operator.
+func (r *RKE2ControlPlaneReconciler) updateMachinesInfrastructureTemplateCondition(ctx context.Context, controlPlane *rke2.ControlPlane) {
+	machineNames, err := rke2.MachinesWithMissingInfrastructureTemplate(ctx, r.Client, controlPlane.InfraResources)
+
+	switch {
+	case err != nil:
+		conditions.MarkUnknown(controlPlane.RCP,
+			controlplanev1.MachinesInfrastructureTemplateAvailableCondition,
+			controlplanev1.MachinesInfrastructureTemplateInspectionFailedReason,
+			"%s", err.Error())
+	case len(machineNames) > 0:
+		conditions.MarkFalse(controlPlane.RCP,
+			controlplanev1.MachinesInfrastructureTemplateAvailableCondition,
+			controlplanev1.MachinesInfrastructureTemplateNotFoundReason,
+			clusterv1.ConditionSeverityWarning,
+			"Machines %s were cloned from an infrastructure template which no longer exists", strings.Join(machineNames, ", "))
+	default:
+		conditions.MarkTrue(controlPlane.RCP, controlplanev1.MachinesInfrastructureTemplateAvailableCondition)
+	}
+}
+
+// reconcileAddons re-applies the drifted HelmChartConfigs declared in the manifests ConfigMap of the RCP and reports
+// the addons which are not ready. Failures are only logged, as addons do not gate control plane operations.
+func (r *RKE2ControlPlaneReconciler) reconcileAddons(
+	ctx context.Context,
+	rcp *controlplanev1.RKE2ControlPlane,
+	workloadCluster rke2.WorkloadCluster,
+) {
+	logger := log.FromContext(ctx)
+
+	manifests := []*unstructured.Unstructured{}
+
+	if ref := rcp.Spec.ManifestsConfigMapReference; ref.Name != "" {
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = rcp.Namespace
+		}
+
+		configMap := &corev1.ConfigMap{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, configMap); err != nil {
+			logger.Error(err, "Failed to get manifests ConfigMap", "ConfigMap", klog.KRef(namespace, ref.Name))
+
+			return
+		}
+
+		var err error
+		if manifests, err = rke2.AddonManifests(configMap); err != nil {
+			logger.Error(err, "Failed to parse addon manifests", "ConfigMap", klog.KRef(namespace, ref.Name))
+
+			return
+		}
+	}
+
+	if err := workloadCluster.ReconcileAddons(ctx, manifests); err != nil {
+		logger.Error(err, "Failed to reconcile addons")
+	}
+
+	statuses, err := workloadCluster.AddonStatus(ctx, rcp, manifests)
+	if err != nil {
+		logger.Error(err, "Failed to get addon status")
+
+		return
+	}
+
+	for name, status := range statuses {
+		if !status.IsReady() {
+			logger.Info("Addon is not ready", "addon", name, "ready", status.Ready, "desired", status.Desired)
+		}
+	}
+}
+
+// reconcileControlPlaneVIP requests RKE2 to reapply the kube-vip manifest configured in the RCP when the VIP address of
+// its DaemonSet drifted.
+// Failures are only logged, as the VIP does not gate control plane operations.
+func reconcileControlPlaneVIP(ctx context.Context, rcp *controlplanev1.RKE2ControlPlane, workloadCluster rke2.WorkloadCluster) {
+	if _, err := workloadCluster.ReconcileControlPlaneVIP(ctx, rcp); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to reconcile the control plane VIP")
+	}
+}
+
+// controlPlaneReadinessCheckReasons are the reasons of the ControlPlaneHealthy condition for each failed readiness
+// check, along with their severity.
+var controlPlaneReadinessCheckReasons = map[rke2.ControlPlaneReadinessCheckName]struct {
+	reason   string
+	severity clusterv1.ConditionSeverity
+}{
+	rke2.EtcdQuorumCheck:             {controlplanev1.EtcdQuorumUnhealthyReason, clusterv1.ConditionSeverityError},
+	rke2.ControlPlaneNodesReadyCheck: {controlplanev1.ControlPlaneNodesNotReadyReason, clusterv1.ConditionSeverityWarning},
+	rke2.APIServerReachableCheck:     {controlplanev1.APIServerUnreachableReason, clusterv1.ConditionSeverityWarning},
+	rke2.CNIReadyCheck:               {controlplanev1.CNINotReadyReason, clusterv1.ConditionSeverityWarning},
+}
+
+// updateControlPlaneHealthyCondition reports the readiness of the control plane of the workload cluster. The reason
+// is the one of the first failed check, and the message lists every failed check.
+func updateControlPlaneHealthyCondition(ctx context.Context, rcp *controlplanev1.RKE2ControlPlane, workloadCluster rke2.WorkloadCluster) {
+	readiness := workloadCluster.ControlPlaneReady(ctx)
+	if readiness.Ready {
+		conditions.MarkTrue(rcp, controlplanev1.ControlPlaneHealthyCondition)
+
+		return
+	}
+
+	failed := readiness.FailedChecks()
+	messages := make([]string, 0, len(failed))
+
+	for _, check := range failed {
+		messages = append(messages, fmt.Sprintf("%s: %s", check.Name, check.Message))
+	}
+
+	log.FromContext(ctx).Info("Control plane is not healthy", "failedChecks", messages)
+
+	first := controlPlaneReadinessCheckReasons[failed[0].Name]
+	conditions.MarkFalse(rcp,
+		controlplanev1.ControlPlaneHealthyCondition,
+		first.reason,
+		first.severity,
+		"%s", strings.Join(messages, "; "))
+}
+
 func (r *RKE2ControlPlaneReconciler) upgradeControlPlane(
 	ctx context.Context,
 	cluster *clusterv1.Cluster,
@@ -1023,6 +1712,20 @@ func (r *RKE2ControlPlaneReconciler) upgradeControlPlane(
 		return ctrl.Result{}, err
 	}
 
+	// Do not progress the rollout while the etcd member of a machine does not run the etcd version embedded in the RKE2
+	// version of the machine, so an upgrade does not leave the etcd cluster with mixed versions.
+	if _, found := rcp.Annotations[controlplanev1.LegacyRKE2ControlPlane]; !found && controlPlane.IsEtcdManaged() {
+		if err := rke2.CheckMachinesEtcdVersion(ctx, workloadCluster, controlPlane.Machines); err != nil {
+			if !errors.Is(err, rke2.ErrEtcdVersionMismatch) {
+				return ctrl.Result{}, err
+			}
+
+			logger.Info("Waiting for the etcd members to run the etcd version of their RKE2 version", "reason", err.Error())
+
+			return ctrl.Result{RequeueAfter: etcdVersionMismatchRequeueAfter}, nil
+		}
+	}
+
 	switch rcp.Spec.RolloutStrategy.Type {
 	case controlplanev1.RollingUpdateStrategyType:
 		// RolloutStrategy is currently defaulted and validated to be RollingUpdate.
@@ -1069,6 +1772,31 @@ func (r *RKE2ControlPlaneReconciler) ClusterToRKE2ControlPlane(ctx context.Conte
 	}
 }
 
+// defaultsConfigMapToRKE2ControlPlanes is a handler.MapFunc to be used to enqueue requests for reconciliation
+// for the RKE2ControlPlanes referencing a ConfigMap as their server defaults, so changes to the defaults are rolled out.
+func (r *RKE2ControlPlaneReconciler) defaultsConfigMapToRKE2ControlPlanes(ctx context.Context, o client.Object) []ctrl.Request {
+	rcpList := &controlplanev1.RKE2ControlPlaneList{}
+	if err := r.Client.List(ctx, rcpList); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list RKE2ControlPlanes for the server defaults ConfigMap",
+			"configMap", client.ObjectKeyFromObject(o))
+
+		return nil
+	}
+
+	requests := []ctrl.Request{}
+
+	for _, rcp := range rcpList.Items {
+		ref := rcp.Spec.ServerConfig.DefaultsConfigMap
+		if ref == nil || ref.Name != o.GetName() || ref.Namespace != o.GetNamespace() {
+			continue
+		}
+
+		requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&rcp)})
+	}
+
+	return requests
+}
+
 func (r *RKE2ControlPlaneReconciler) reconcilePreTerminateHook(ctx context.Context, controlPlane *rke2.ControlPlane) (ctrl.Result, error) {
 	// Ensure that every active machine has the drain hook set
 	patchHookAnnotation := false
@@ -1127,25 +1855,36 @@ func (r *RKE2ControlPlaneReconciler) reconcilePreTerminateHook(ctx context.Conte
 	// Skip leader change for legacy CP
 	_, found := controlPlane.RCP.Annotations[controlplanev1.LegacyRKE2ControlPlane]
 
-	// If we have more than 1 Machine and etcd is managed we forward etcd leadership and remove the member
-	// to keep the etcd cluster healthy.
-	if controlPlane.Machines.Len() > 1 && !found {
+	// If we have more than 1 Machine hosting etcd, the deleting Machine hosts an etcd member and etcd is managed
+	// we forward etcd leadership and remove the member to keep the etcd cluster healthy.
+	etcdMachines := controlPlane.Machines.Filter(rke2.HasEtcdRole())
+	if etcdMachines.Len() > 1 && rke2.MachineNodeRoles(deletingMachine).Etcd && !found && controlPlane.IsEtcdManaged() {
 		workloadCluster, err := r.GetWorkloadCluster(ctx, controlPlane)
 		if err != nil {
 			return ctrl.Result{}, errors.Wrapf(err,
 				"failed to remove etcd member for deleting Machine %s: failed to create client to workload cluster", klog.KObj(deletingMachine))
 		}
 
+		release, err := r.acquireEtcdOperationLease(ctx, controlPlane)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if release == nil {
+			return ctrl.Result{RequeueAfter: etcdOperationInProgressRequeueAfter}, nil
+		}
+		defer release()
+
 		// Note: In regular deletion cases (remediation, scale down) the leader should have been already moved.
 		// We're doing this again here in case the Machine became leader again or the Machine deletion was
 		// triggered in another way (e.g. a user running kubectl delete machine)
-		etcdLeaderCandidate := controlPlane.Machines.Filter(collections.Not(collections.HasDeletionTimestamp)).Newest()
+		etcdLeaderCandidate := etcdMachines.Filter(collections.Not(collections.HasDeletionTimestamp)).Newest()
 		if etcdLeaderCandidate != nil {
 			if err := workloadCluster.ForwardEtcdLeadership(ctx, deletingMachine, etcdLeaderCandidate); err != nil {
 				return ctrl.Result{}, errors.Wrapf(err, "failed to move leadership to candidate Machine %s", etcdLeaderCandidate.Name)
 			}
 		} else {
-			log.Info("Skip forwarding etcd leadership, because there is no other control plane Machine without a deletionTimestamp")
+			log.Info("Skip forwarding etcd leadership, because there is no other control plane Machine hosting etcd without a deletionTimestamp")
 		}
 
 		// Note: Removing the etcd member will lead to the etcd and the kube-apiserver Pod on the Machine shutting down.
@@ -1164,6 +1903,29 @@ func (r *RKE2ControlPlaneReconciler) reconcilePreTerminateHook(ctx context.Conte
 	return ctrl.Result{RequeueAfter: deleteRequeueAfter}, nil
 }
 
+// acquireEtcdOperationLease acquires the lease serializing the destructive etcd operations on the workload cluster,
+// and returns the func releasing it. A nil func is returned when another etcd operation is in progress.
+func (r *RKE2ControlPlaneReconciler) acquireEtcdOperationLease(ctx context.Context, controlPlane *rke2.ControlPlane) (func(), error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	release, err := r.managementClusterUncached.AcquireEtcdOperationLease(ctx, util.ObjectKey(controlPlane.Cluster))
+	if errors.Is(err, rke2.ErrEtcdOperationInProgress) {
+		log.Info("Waiting for another etcd operation on the workload cluster to complete", "reason", err.Error())
+
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to acquire etcd operation lease")
+	}
+
+	return func() {
+		if err := release(ctx); err != nil {
+			log.Error(err, "Failed to release etcd operation lease")
+		}
+	}, nil
+}
+
 func machineHasOtherPreTerminateHooks(machine *clusterv1.Machine) bool {
 	for k := range machine.Annotations {
 		if strings.HasPrefix(k, clusterv1.PreTerminateDeleteHookAnnotationPrefix) && k != controlplanev1.PreTerminateHookCleanupAnnotation {
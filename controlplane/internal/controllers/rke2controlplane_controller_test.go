@@ -15,6 +15,7 @@ import (
 	. "github.com/onsi/gomega"
 	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
 	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+	rke2kubeconfig "github.com/rancher/cluster-api-provider-rke2/pkg/kubeconfig"
 	"github.com/rancher/cluster-api-provider-rke2/pkg/rke2"
 	"github.com/rancher/cluster-api-provider-rke2/pkg/secret"
 	corev1 "k8s.io/api/core/v1"
@@ -152,6 +153,24 @@ var _ = Describe("Rotate kubeconfig cert", func() {
 
 		Expect(testEnv.Get(ctx, client.ObjectKey{Namespace: ns.Name, Name: kubeconfigSecret.Name}, kubeconfigSecret)).To(Succeed())
 		Expect(kubeconfigSecret.StringData[secret.KubeconfigDataName]).Should(Equal(updatedSecret.StringData[secret.KubeconfigDataName]), "Kubeconfig data must stay the same")
+
+		By("Regenerating the kubeconfig secret when the endpoint changes")
+		migratedEndpoint := clusterv1.APIEndpoint{Host: "lb.example.com", Port: 6443}
+		defer rke2.ForgetClusterCacheInvalidation(clusterKey)
+
+		needsEndpointUpdate, err := rke2kubeconfig.NeedsEndpointUpdate(kubeconfigSecret, migratedEndpoint.String())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(needsEndpointUpdate).To(BeTrue())
+
+		_, err = r.reconcileKubeconfig(ctx, clusterKey, migratedEndpoint, rcp)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(testEnv.Get(ctx, client.ObjectKey{Namespace: ns.Name, Name: kubeconfigSecret.Name}, kubeconfigSecret)).To(Succeed())
+		Expect(string(kubeconfigSecret.Data[secret.KubeconfigDataName])).To(ContainSubstring("server: https://lb.example.com:6443"))
+
+		needsEndpointUpdate, err = rke2kubeconfig.NeedsEndpointUpdate(kubeconfigSecret, migratedEndpoint.String())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(needsEndpointUpdate).To(BeFalse())
 	})
 })
 
@@ -26,6 +26,7 @@ import (
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
@@ -47,6 +48,7 @@ import (
 	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
 	"github.com/rancher/cluster-api-provider-rke2/controlplane/internal/util/ssa"
 	rke2 "github.com/rancher/cluster-api-provider-rke2/pkg/rke2"
+	rke2util "github.com/rancher/cluster-api-provider-rke2/pkg/util"
 )
 
 func (r *RKE2ControlPlaneReconciler) initializeControlPlane(
@@ -73,6 +75,10 @@ func (r *RKE2ControlPlaneReconciler) initializeControlPlane(
 		)
 	}
 
+	if result, err := r.reconcileInfrastructureTemplate(ctx, rcp); err != nil || !result.IsZero() {
+		return result, err
+	}
+
 	bootstrapSpec := controlPlane.InitialControlPlaneConfig()
 	fd := controlPlane.NextFailureDomainForScaleUp(ctx)
 
@@ -103,10 +109,18 @@ func (r *RKE2ControlPlaneReconciler) scaleUpControlPlane(
 	logger := controlPlane.Logger()
 
 	// Run preflight checks to ensure that the control plane is stable before proceeding with a scale up/scale down operation; if not, wait.
-	if result := r.preflightChecks(ctx, controlPlane); !result.IsZero() {
+	if result := r.preflightChecks(ctx, controlPlane, 1); !result.IsZero() {
 		return result, nil
 	}
 
+	if result, err := r.waitForEtcdLearnersPromotion(ctx, controlPlane); err != nil || !result.IsZero() {
+		return result, err
+	}
+
+	if result, err := r.reconcileInfrastructureTemplate(ctx, rcp); err != nil || !result.IsZero() {
+		return result, err
+	}
+
 	// Create the bootstrap configuration
 	bootstrapSpec := controlPlane.JoinControlPlaneConfig()
 	fd := controlPlane.NextFailureDomainForScaleUp(ctx)
@@ -145,9 +159,25 @@ func (r *RKE2ControlPlaneReconciler) scaleDownControlPlane(
 		return ctrl.Result{}, errors.Wrap(err, "failed to select machine for scale down")
 	}
 
+	// Outdated machines of a rolling update can be deleted concurrently, up to what the etcd quorum tolerates.
+	maxDeletingMachines := 1
+
+	if outdatedMachines.Len() > 0 {
+		effective, requested := rke2.RolloutMaxUnavailable(rcp)
+		if effective < requested {
+			logger.Info("Capping the machines deleted at the same time to preserve the etcd quorum",
+				"maxUnavailable", requested, "effectiveMaxUnavailable", effective)
+			r.recorder.Eventf(rcp, corev1.EventTypeNormal, "MaxUnavailableCapped",
+				"Capping maxUnavailable from %d to %d to preserve the etcd quorum of cluster %s/%s",
+				requested, effective, cluster.Namespace, cluster.Name)
+		}
+
+		maxDeletingMachines = effective
+	}
+
 	// Run preflight checks ensuring the control plane is stable before proceeding with a scale up/scale down operation; if not, wait.
 	// Given that we're scaling down, we can exclude the machineToDelete from the preflight checks.
-	if result := r.preflightChecks(ctx, controlPlane, machineToDelete); !result.IsZero() {
+	if result := r.preflightChecks(ctx, controlPlane, maxDeletingMachines, machineToDelete); !result.IsZero() {
 		return result, nil
 	}
 
@@ -158,16 +188,54 @@ func (r *RKE2ControlPlaneReconciler) scaleDownControlPlane(
 	}
 
 	// If etcd leadership is on machine that is about to be deleted, move it to the newest member available.
-	if _, found := controlPlane.RCP.Annotations[controlplanev1.LegacyRKE2ControlPlane]; !found {
-		etcdLeaderCandidate := controlPlane.Machines.Newest()
-		if err := r.workloadCluster.ForwardEtcdLeadership(ctx, machineToDelete, etcdLeaderCandidate); err != nil {
+	// There is nothing to move when the members of an external etcd are not hosted on the machines, or when the machine
+	// does not host an etcd member.
+	if _, found := controlPlane.RCP.Annotations[controlplanev1.LegacyRKE2ControlPlane]; !found && controlPlane.IsEtcdManaged() &&
+		rke2.MachineNodeRoles(machineToDelete).Etcd {
+		workloadCluster, err := controlPlane.GetWorkloadCluster(ctx)
+		if err != nil {
+			logger.Error(err, "Failed to create client to workload cluster")
+
+			return ctrl.Result{}, errors.Wrap(err, "failed to create client to workload cluster")
+		}
+
+		release, err := r.acquireEtcdOperationLease(ctx, controlPlane)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if release == nil {
+			return ctrl.Result{RequeueAfter: etcdOperationInProgressRequeueAfter}, nil
+		}
+		defer release()
+
+		etcdLeaderCandidate := controlPlane.Machines.Filter(rke2.HasEtcdRole()).Newest()
+
+		// When a rollout has surged a new machine, the member RKE2 joined for it replaces the member of the outdated
+		// machine before the machine is deleted, so the cluster never has fewer healthy voting members.
+		if outdatedMachines.Len() > 0 && rke2util.SafeInt32(controlPlane.Machines.Len()) > *rcp.Spec.Replicas &&
+			etcdLeaderCandidate != nil && etcdLeaderCandidate.Name != machineToDelete.Name {
+			replaced, err := workloadCluster.ReplaceEtcdMember(ctx, machineToDelete, etcdLeaderCandidate)
+			if err != nil {
+				logger.Error(err, "Failed to replace the etcd member of the outdated machine", "newMachine", etcdLeaderCandidate.Name)
+
+				return ctrl.Result{}, err
+			}
+
+			if !replaced {
+				logger.Info("Waiting for the etcd member of the outdated machine to be replaced", "newMachine", etcdLeaderCandidate.Name)
+
+				return ctrl.Result{RequeueAfter: etcdMemberReplacementRequeueAfter}, nil
+			}
+		} else if err := workloadCluster.ForwardEtcdLeadership(ctx, machineToDelete, etcdLeaderCandidate); err != nil {
 			logger.Error(err, "Failed to move leadership to candidate machine", "candidate", etcdLeaderCandidate.Name)
 
 			return ctrl.Result{}, err
 		}
 	}
 
-	// NOTE: etcd member removal will be performed by the rke2-cleanup hook after machine completes drain & all volumes are detached.
+	// NOTE: etcd member removal will be performed by the rke2-cleanup hook after machine completes drain & all volumes are detached,
+	// unless the member was already replaced above.
 
 	logger = logger.WithValues("machine", machineToDelete)
 	if err := r.Delete(ctx, machineToDelete); err != nil && !apierrors.IsNotFound(err) {
@@ -207,7 +275,7 @@ func (r *RKE2ControlPlaneReconciler) removePreTerminateHookAnnotationFromMachine
 
 // preflightChecks checks if the control plane is stable before proceeding with a scale up/scale down operation,
 // where stable means that:
-// - There are no machine deletion in progress
+// - There are less than maxDeletingMachines machine deletions in progress
 // - All the health conditions on RCP are true.
 // - All the health conditions on the control plane machines are true.
 // If the control plane is not passing preflight checks, it requeue.
@@ -216,6 +284,7 @@ func (r *RKE2ControlPlaneReconciler) removePreTerminateHookAnnotationFromMachine
 func (r *RKE2ControlPlaneReconciler) preflightChecks(
 	ctx context.Context,
 	controlPlane *rke2.ControlPlane,
+	maxDeletingMachines int,
 	excludeFor ...*clusterv1.Machine,
 ) ctrl.Result {
 	logger := log.FromContext(ctx)
@@ -226,10 +295,11 @@ func (r *RKE2ControlPlaneReconciler) preflightChecks(
 		return ctrl.Result{}
 	}
 
-	// If there are deleting machines, wait for the operation to complete.
-	if controlPlane.HasDeletingMachine() {
+	// If there are as many deleting machines as allowed, wait for the operations to complete.
+	deletingMachines := controlPlane.Machines.Filter(collections.HasDeletionTimestamp)
+	if deletingMachines.Len() >= max(maxDeletingMachines, 1) {
 		logger.Info("Waiting for machines to be deleted", "Machines",
-			strings.Join(controlPlane.Machines.Filter(collections.HasDeletionTimestamp).Names(),
+			strings.Join(deletingMachines.Names(),
 				", ",
 			))
 
@@ -244,7 +314,7 @@ func (r *RKE2ControlPlaneReconciler) preflightChecks(
 	machineErrors := []error{}
 
 loopmachines:
-	for _, machine := range controlPlane.Machines {
+	for _, machine := range controlPlane.Machines.Filter(collections.Not(collections.HasDeletionTimestamp)) {
 		for _, excluded := range excludeFor {
 			// If this machine should be excluded from the individual
 			// health check, continue the out loop.
@@ -272,6 +342,39 @@ loopmachines:
 	return ctrl.Result{}
 }
 
+// waitForEtcdLearnersPromotion requeues the scale up while an etcd member added as learner has not been promoted
+// to a voting member yet, so that control plane replicas join etcd one at a time.
+func (r *RKE2ControlPlaneReconciler) waitForEtcdLearnersPromotion(ctx context.Context, controlPlane *rke2.ControlPlane) (ctrl.Result, error) {
+	// There are no learners to wait for when the members of an external etcd are not hosted on the machines.
+	if _, found := controlPlane.RCP.Annotations[controlplanev1.LegacyRKE2ControlPlane]; found ||
+		!controlPlane.IsEtcdManaged() || controlPlane.Machines.Len() == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	workloadCluster, err := controlPlane.GetWorkloadCluster(ctx)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to create client to workload cluster")
+	}
+
+	learners, err := workloadCluster.EtcdLearnerStatus(ctx)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to get etcd learners status")
+	}
+
+	for _, learner := range learners {
+		if learner.IsPromoted {
+			continue
+		}
+
+		log.FromContext(ctx).Info("Waiting for etcd learner to be promoted before scaling up",
+			"member", learner.Name, "raftIndexLag", learner.RaftIndexLag)
+
+		return ctrl.Result{RequeueAfter: preflightFailedRequeueAfter}, nil
+	}
+
+	return ctrl.Result{}, nil
+}
+
 func preflightCheckCondition(kind string, obj conditions.Getter, condition clusterv1.ConditionType) error {
 	c := conditions.Get(obj, condition)
 	if c == nil {
@@ -294,7 +397,9 @@ func selectMachineForScaleDown(
 	controlPlane *rke2.ControlPlane,
 	outdatedMachines collections.Machines,
 ) (*clusterv1.Machine, error) {
-	machines := controlPlane.Machines
+	// Machines which are already being deleted can't be picked again.
+	machines := controlPlane.Machines.Filter(collections.Not(collections.HasDeletionTimestamp))
+	outdatedMachines = outdatedMachines.Filter(collections.Not(collections.HasDeletionTimestamp))
 
 	switch {
 	case controlPlane.MachineWithDeleteAnnotation(outdatedMachines).Len() > 0:
@@ -314,6 +419,48 @@ func selectMachineForScaleDown(
 	return controlPlane.MachineInFailureDomainWithMostMachines(ctx, machines)
 }
 
+// reconcileInfrastructureTemplate verifies that the infrastructure template referenced by the RKE2ControlPlane exists
+// and is an infrastructure machine template before any new machine is created, and reports the result in the
+// InfrastructureTemplateAvailable condition. A non-zero result is returned when machine creation must wait.
+func (r *RKE2ControlPlaneReconciler) reconcileInfrastructureTemplate(
+	ctx context.Context,
+	rcp *controlplanev1.RKE2ControlPlane,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	ref := rcp.Spec.MachineTemplate.InfrastructureRef
+	template := &unstructured.Unstructured{}
+	template.SetGroupVersionKind(ref.GroupVersionKind())
+
+	key := client.ObjectKey{Name: ref.Name, Namespace: cmp.Or(ref.Namespace, rcp.Namespace)}
+
+	if err := r.Client.Get(ctx, key, template); err != nil {
+		if !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			return ctrl.Result{}, errors.Wrapf(err, "failed to get infrastructure template %s %s", ref.Kind, key)
+		}
+
+		logger.Info("Infrastructure template not found, waiting before creating new machines", "kind", ref.Kind, "template", key)
+		conditions.MarkFalse(rcp, controlplanev1.InfrastructureTemplateAvailableCondition,
+			controlplanev1.InfrastructureTemplateNotFoundReason, clusterv1.ConditionSeverityError,
+			"Infrastructure template %s %s not found", ref.Kind, key)
+
+		return ctrl.Result{RequeueAfter: preflightFailedRequeueAfter}, nil
+	}
+
+	if _, found, err := unstructured.NestedMap(template.Object, "spec", "template"); err != nil || !found {
+		logger.Info("Referenced infrastructure object is not a machine template", "kind", ref.Kind, "template", key)
+		conditions.MarkFalse(rcp, controlplanev1.InfrastructureTemplateAvailableCondition,
+			controlplanev1.InfrastructureTemplateNotFoundReason, clusterv1.ConditionSeverityError,
+			"%s %s is not an infrastructure machine template", ref.Kind, key)
+
+		return ctrl.Result{RequeueAfter: preflightFailedRequeueAfter}, nil
+	}
+
+	conditions.MarkTrue(rcp, controlplanev1.InfrastructureTemplateAvailableCondition)
+
+	return ctrl.Result{}, nil
+}
+
 func (r *RKE2ControlPlaneReconciler) cloneConfigsAndGenerateMachine(
 	ctx context.Context,
 	cluster *clusterv1.Cluster,
@@ -323,6 +470,17 @@ func (r *RKE2ControlPlaneReconciler) cloneConfigsAndGenerateMachine(
 ) error {
 	var errs []error
 
+	// Render the templated fields of the bootstrap configuration for the machine, before any resource is created.
+	machineName := names.SimpleNameGenerator.GenerateName(rcp.Name + "-")
+
+	bootstrapSpec, err := rke2.RenderRKE2ConfigTemplates(rcp, bootstrapSpec, rke2.RKE2ConfigTemplateData{
+		MachineName: machineName,
+		ClusterName: cluster.Name,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to render bootstrap config templates")
+	}
+
 	// Since the cloned resource should eventually have a controller ref for the Machine, we create an
 	// OwnerReference here without the Controller field set
 	infraCloneOwner := &metav1.OwnerReference{
@@ -356,7 +514,7 @@ func (r *RKE2ControlPlaneReconciler) cloneConfigsAndGenerateMachine(
 
 	// Only proceed to generating the Machine if we haven't encountered an error
 	if len(errs) == 0 {
-		if err := r.createMachine(ctx, rcp, cluster, infraRef, bootstrapRef, failureDomain); err != nil {
+		if err := r.createMachine(ctx, rcp, cluster, machineName, infraRef, bootstrapRef, failureDomain); err != nil {
 			errs = append(errs, errors.Wrap(err, "failed to create Machine"))
 		}
 	}
@@ -459,19 +617,23 @@ func (r *RKE2ControlPlaneReconciler) UpdateExternalObject(
 	return nil
 }
 
-// createMachine creates a new Machine object for the control plane.
+// createMachine creates a new Machine object for the control plane, named after the name its bootstrap configuration
+// was rendered for.
 func (r *RKE2ControlPlaneReconciler) createMachine(
 	ctx context.Context,
 	rcp *controlplanev1.RKE2ControlPlane,
 	cluster *clusterv1.Cluster,
+	machineName string,
 	infraRef, bootstrapRef *corev1.ObjectReference,
 	failureDomain *string,
 ) error {
-	machine, err := r.computeDesiredMachine(rcp, cluster, infraRef, bootstrapRef, failureDomain, nil)
+	machine, err := r.computeDesiredMachine(ctx, rcp, cluster, infraRef, bootstrapRef, failureDomain, nil)
 	if err != nil {
 		return errors.Wrap(err, "failed to create Machine: failed to compute desired Machine")
 	}
 
+	machine.Name = machineName
+
 	patchOptions := []client.PatchOption{
 		client.ForceOwnership,
 		client.FieldOwner(rke2ManagerName),
@@ -492,7 +654,7 @@ func (r *RKE2ControlPlaneReconciler) UpdateMachine(
 	cluster *clusterv1.Cluster,
 ) (*clusterv1.Machine, error) {
 	updatedMachine, err := r.computeDesiredMachine(
-		rcp, cluster,
+		ctx, rcp, cluster,
 		&machine.Spec.InfrastructureRef, machine.Spec.Bootstrap.ConfigRef,
 		machine.Spec.FailureDomain, machine,
 	)
@@ -520,6 +682,7 @@ func (r *RKE2ControlPlaneReconciler) UpdateMachine(
 // is a create or update. Example: for a new Machine we have to calculate a new name,
 // while for an existing Machine we have to use the name of the existing Machine.
 func (r *RKE2ControlPlaneReconciler) computeDesiredMachine(
+	ctx context.Context,
 	rcp *controlplanev1.RKE2ControlPlane,
 	cluster *clusterv1.Cluster, infraRef,
 	bootstrapRef *corev1.ObjectReference,
@@ -538,7 +701,11 @@ func (r *RKE2ControlPlaneReconciler) computeDesiredMachine(
 		// Creating a new machine
 		machineName = names.SimpleNameGenerator.GenerateName(rcp.Name + "-")
 
-		desiredVersion := rcp.GetDesiredVersion()
+		desiredVersion, err := rke2.ResolveDesiredVersion(ctx, r.ChannelResolver, rcp)
+		if err != nil {
+			return nil, err
+		}
+
 		version = &desiredVersion
 
 		// Machine's bootstrap config may be missing RKE2Config if it is not the first machine in the control plane.
@@ -550,6 +717,29 @@ func (r *RKE2ControlPlaneReconciler) computeDesiredMachine(
 
 		annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = string(serverConfig)
 		annotations[controlplanev1.PreTerminateHookCleanupAnnotation] = ""
+
+		// Record the hash of the RKE2ConfigSpec the machine is created with, for cheap up to date checks.
+		specHash, err := rke2.RKE2ConfigSpecHash(&rcp.Spec.RKE2ConfigSpec)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to compute RKE2ConfigSpec hash")
+		}
+
+		annotations[controlplanev1.RKE2ConfigSpecHashAnnotation] = specHash
+
+		// Record the registration address and method the machine is configured with, so changing them triggers a
+		// rollout. The first machine registers with the control plane endpoint unless the address method is used.
+		registrationAddress := rke2.RegistrationAddress(rcp)
+		if registrationAddress == "" {
+			registrationAddress = strings.ToLower(cluster.Spec.ControlPlaneEndpoint.Host)
+		}
+
+		annotations[controlplanev1.RegistrationAddressAnnotation] = registrationAddress
+		annotations[controlplanev1.RegistrationMethodAnnotation] = string(rcp.Spec.RegistrationMethod)
+
+		// Record the server defaults the machine is bootstrapped with, so changes to them trigger a rollout.
+		if defaultsHash, ok := rcp.Annotations[controlplanev1.ServerDefaultsHashAnnotation]; ok {
+			annotations[controlplanev1.ServerDefaultsHashAnnotation] = defaultsHash
+		}
 	} else {
 		// Updating an existing machine
 		machineName = existingMachine.Name
@@ -562,6 +752,22 @@ func (r *RKE2ControlPlaneReconciler) computeDesiredMachine(
 		if serverConfig, ok := existingMachine.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation]; ok {
 			annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = serverConfig
 		}
+
+		if defaultsHash, ok := existingMachine.Annotations[controlplanev1.ServerDefaultsHashAnnotation]; ok {
+			annotations[controlplanev1.ServerDefaultsHashAnnotation] = defaultsHash
+		}
+
+		if specHash, ok := existingMachine.Annotations[controlplanev1.RKE2ConfigSpecHashAnnotation]; ok {
+			annotations[controlplanev1.RKE2ConfigSpecHashAnnotation] = specHash
+		}
+
+		if registrationAddress, ok := existingMachine.Annotations[controlplanev1.RegistrationAddressAnnotation]; ok {
+			annotations[controlplanev1.RegistrationAddressAnnotation] = registrationAddress
+		}
+
+		if registrationMethod, ok := existingMachine.Annotations[controlplanev1.RegistrationMethodAnnotation]; ok {
+			annotations[controlplanev1.RegistrationMethodAnnotation] = registrationMethod
+		}
 	}
 
 	// Construct the basic Machine.
@@ -610,6 +816,11 @@ func (r *RKE2ControlPlaneReconciler) computeDesiredMachine(
 		desiredMachine.Annotations[k] = v
 	}
 
+	if bootstrapTimeout := rcp.Spec.MachineTemplate.BootstrapTimeout; bootstrapTimeout != nil {
+		annotationKey := bootstrapTimeoutAnnotationForInfrastructure(rcp.Spec.MachineTemplate.InfrastructureRef)
+		desiredMachine.Annotations[annotationKey] = bootstrapTimeout.Duration.String()
+	}
+
 	// Set other in-place mutable fields
 	desiredMachine.Spec.NodeDrainTimeout = rcp.Spec.MachineTemplate.NodeDrainTimeout
 	desiredMachine.Spec.NodeDeletionTimeout = rcp.Spec.MachineTemplate.NodeDeletionTimeout
@@ -618,6 +829,27 @@ func (r *RKE2ControlPlaneReconciler) computeDesiredMachine(
 	return desiredMachine, nil
 }
 
+// infrastructureBootstrapTimeoutAnnotations maps infrastructure machine template kinds to the annotation
+// their provider honors as a bootstrap timeout.
+var infrastructureBootstrapTimeoutAnnotations = map[string]string{
+	"AWSMachineTemplate":       "aws.infrastructure.cluster.x-k8s.io/bootstrap-timeout",
+	"AzureMachineTemplate":     "azure.infrastructure.cluster.x-k8s.io/bootstrap-timeout",
+	"DockerMachineTemplate":    "docker.infrastructure.cluster.x-k8s.io/bootstrap-timeout",
+	"VSphereMachineTemplate":   "vsphere.infrastructure.cluster.x-k8s.io/bootstrap-timeout",
+	"Metal3MachineTemplate":    "metal3.infrastructure.cluster.x-k8s.io/bootstrap-timeout",
+	"OpenStackMachineTemplate": "openstack.infrastructure.cluster.x-k8s.io/bootstrap-timeout",
+}
+
+// bootstrapTimeoutAnnotationForInfrastructure returns the bootstrap timeout annotation key for the provider
+// of the given infrastructure template, falling back to the generic controlplane annotation for unknown providers.
+func bootstrapTimeoutAnnotationForInfrastructure(infraRef corev1.ObjectReference) string {
+	if annotation, ok := infrastructureBootstrapTimeoutAnnotations[infraRef.Kind]; ok {
+		return annotation
+	}
+
+	return controlplanev1.BootstrapTimeoutAnnotation
+}
+
 // ControlPlaneMachineLabelsForCluster returns a set of labels to add to a control plane machine for this specific cluster.
 func ControlPlaneMachineLabelsForCluster(rcp *controlplanev1.RKE2ControlPlane, clusterName string) map[string]string {
 	labels := map[string]string{}
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/rke2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestComputeDesiredMachineBootstrapTimeout(t *testing.T) {
+	tests := []struct {
+		name                 string
+		infraKind            string
+		bootstrapTimeout     *metav1.Duration
+		expectedAnnotation   string
+		unexpectedAnnotation string
+	}{
+		{
+			name:               "AWS provider gets its own annotation",
+			infraKind:          "AWSMachineTemplate",
+			bootstrapTimeout:   &metav1.Duration{Duration: 20 * time.Minute},
+			expectedAnnotation: "aws.infrastructure.cluster.x-k8s.io/bootstrap-timeout",
+		},
+		{
+			name:               "vSphere provider gets its own annotation",
+			infraKind:          "VSphereMachineTemplate",
+			bootstrapTimeout:   &metav1.Duration{Duration: 45 * time.Minute},
+			expectedAnnotation: "vsphere.infrastructure.cluster.x-k8s.io/bootstrap-timeout",
+		},
+		{
+			name:               "unknown provider falls back to the generic annotation",
+			infraKind:          "FooMachineTemplate",
+			bootstrapTimeout:   &metav1.Duration{Duration: 10 * time.Minute},
+			expectedAnnotation: controlplanev1.BootstrapTimeoutAnnotation,
+		},
+		{
+			name:                 "no annotation when bootstrap timeout is not set",
+			infraKind:            "AWSMachineTemplate",
+			unexpectedAnnotation: "aws.infrastructure.cluster.x-k8s.io/bootstrap-timeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			rcp := &controlplanev1.RKE2ControlPlane{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "rcp",
+					Namespace: "default",
+				},
+				Spec: controlplanev1.RKE2ControlPlaneSpec{
+					Version: "v1.31.1+rke2r1",
+					MachineTemplate: controlplanev1.RKE2ControlPlaneMachineTemplate{
+						InfrastructureRef: corev1.ObjectReference{Kind: tt.infraKind, Name: "infra-template"},
+						BootstrapTimeout:  tt.bootstrapTimeout,
+					},
+				},
+			}
+			cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+			infraRef := &corev1.ObjectReference{Kind: "FooMachine", Name: "infra"}
+			bootstrapRef := &corev1.ObjectReference{Kind: "RKE2Config", Name: "config"}
+
+			r := &RKE2ControlPlaneReconciler{}
+
+			machine, err := r.computeDesiredMachine(context.Background(), rcp, cluster, infraRef, bootstrapRef, nil, nil)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			if tt.expectedAnnotation != "" {
+				g.Expect(machine.Annotations).To(HaveKeyWithValue(tt.expectedAnnotation, tt.bootstrapTimeout.Duration.String()))
+			}
+
+			if tt.unexpectedAnnotation != "" {
+				g.Expect(machine.Annotations).ToNot(HaveKey(tt.unexpectedAnnotation))
+				g.Expect(machine.Annotations).ToNot(HaveKey(controlplanev1.BootstrapTimeoutAnnotation))
+			}
+		})
+	}
+}
+
+func newInfrastructureTemplate(name string, withTemplate bool) *unstructured.Unstructured {
+	template := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{},
+	}}
+	template.SetAPIVersion("infrastructure.cluster.x-k8s.io/v1beta1")
+	template.SetKind("GenericMachineTemplate")
+	template.SetName(name)
+	template.SetNamespace("default")
+
+	if withTemplate {
+		_ = unstructured.SetNestedMap(template.Object, map[string]interface{}{"spec": map[string]interface{}{}}, "spec", "template")
+	}
+
+	return template
+}
+
+func newRCPWithInfrastructureTemplate(name string) *controlplanev1.RKE2ControlPlane {
+	return &controlplanev1.RKE2ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "rcp", Namespace: "default"},
+		Spec: controlplanev1.RKE2ControlPlaneSpec{
+			MachineTemplate: controlplanev1.RKE2ControlPlaneMachineTemplate{
+				InfrastructureRef: corev1.ObjectReference{
+					APIVersion: "infrastructure.cluster.x-k8s.io/v1beta1",
+					Kind:       "GenericMachineTemplate",
+					Name:       name,
+				},
+			},
+		},
+	}
+}
+
+func newControllersTestScheme(g *WithT) *runtime.Scheme {
+	s := runtime.NewScheme()
+	g.Expect(clusterv1.AddToScheme(s)).To(Succeed())
+	g.Expect(controlplanev1.AddToScheme(s)).To(Succeed())
+
+	return s
+}
+
+func TestReconcileInfrastructureTemplate(t *testing.T) {
+	tests := []struct {
+		name           string
+		objs           []client.Object
+		expectRequeue  bool
+		expectedStatus corev1.ConditionStatus
+	}{
+		{
+			name:           "template exists",
+			objs:           []client.Object{newInfrastructureTemplate("infra-template", true)},
+			expectedStatus: corev1.ConditionTrue,
+		},
+		{
+			name:           "template is missing",
+			expectRequeue:  true,
+			expectedStatus: corev1.ConditionFalse,
+		},
+		{
+			name:           "referenced object is not a machine template",
+			objs:           []client.Object{newInfrastructureTemplate("infra-template", false)},
+			expectRequeue:  true,
+			expectedStatus: corev1.ConditionFalse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			r := &RKE2ControlPlaneReconciler{
+				Client: fake.NewClientBuilder().WithScheme(newControllersTestScheme(g)).WithObjects(tt.objs...).Build(),
+			}
+			rcp := newRCPWithInfrastructureTemplate("infra-template")
+
+			result, err := r.reconcileInfrastructureTemplate(context.Background(), rcp)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result.IsZero()).To(Equal(!tt.expectRequeue))
+
+			condition := conditions.Get(rcp, controlplanev1.InfrastructureTemplateAvailableCondition)
+			g.Expect(condition).ToNot(BeNil())
+			g.Expect(condition.Status).To(Equal(tt.expectedStatus))
+
+			if tt.expectedStatus == corev1.ConditionFalse {
+				g.Expect(condition.Reason).To(Equal(controlplanev1.InfrastructureTemplateNotFoundReason))
+			}
+		})
+	}
+}
+
+func TestInitializeControlPlaneWithMissingInfrastructureTemplate(t *testing.T) {
+	g := NewWithT(t)
+
+	fakeClient := fake.NewClientBuilder().WithScheme(newControllersTestScheme(g)).Build()
+	r := &RKE2ControlPlaneReconciler{
+		Client:                    fakeClient,
+		managementClusterUncached: &rke2.Management{Client: fakeClient},
+	}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	rcp := newRCPWithInfrastructureTemplate("missing-template")
+	controlPlane := &rke2.ControlPlane{RCP: rcp, Cluster: cluster}
+
+	result, err := r.initializeControlPlane(context.Background(), cluster, rcp, controlPlane)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(Equal(preflightFailedRequeueAfter))
+	g.Expect(conditions.IsFalse(rcp, controlplanev1.InfrastructureTemplateAvailableCondition)).To(BeTrue())
+
+	machines := &clusterv1.MachineList{}
+	g.Expect(fakeClient.List(context.Background(), machines)).To(Succeed())
+	g.Expect(machines.Items).To(BeEmpty())
+}
@@ -47,6 +47,8 @@ import (
 	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
 	"github.com/rancher/cluster-api-provider-rke2/controlplane/internal/controllers"
 	"github.com/rancher/cluster-api-provider-rke2/pkg/consts"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/rke2"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/secret"
 	"github.com/rancher/cluster-api-provider-rke2/version"
 )
 
@@ -69,6 +71,15 @@ var (
 	webhookPort                    int
 	webhookCertDir                 string
 	healthAddr                     string
+	stuckProvisioningThreshold     time.Duration
+	etcdMaintenanceOpsPerMinute    int
+	etcdLearnerPromotionTimeout    time.Duration
+	etcdRetryAttempts              int
+	etcdRetryInterval              time.Duration
+	rolloutIgnoredRKE2ConfigFields []string
+	healthProbeInterval            time.Duration
+	healthStaleness                time.Duration
+	caProviderSecret               string
 	managerOptions                 = flags.ManagerOptions{}
 )
 
@@ -119,6 +130,39 @@ func InitFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&watchNamespace, "namespace", "",
 		"Namespace that the controller watches to reconcile cluster-api objects. If unspecified, the controller watches for cluster-api objects across all namespaces.") //nolint:lll
 
+	fs.DurationVar(&stuckProvisioningThreshold, "stuck-provisioning-threshold", rke2.DefaultStuckProvisioningThreshold,
+		"Duration after which control plane machines which are not Running yet are reported as stuck provisioning.")
+
+	fs.IntVar(&etcdMaintenanceOpsPerMinute, "etcd-maintenance-ops-per-minute", rke2.DefaultEtcdMaintenanceOpsPerMinute,
+		"Maximum number of etcd maintenance operations, e.g. database status calls, per minute and workload cluster. "+
+			"Operations are not limited if not positive.")
+
+	fs.DurationVar(&etcdLearnerPromotionTimeout, "etcd-learner-promotion-timeout", rke2.DefaultEtcdLearnerPromotionTimeout,
+		"Duration after which the etcd learner of a control plane machine which is not promoted to a voting member yet is "+
+			"removed from the etcd cluster, and the machine remediated. Learners are not removed if not positive, the default.")
+
+	fs.IntVar(&etcdRetryAttempts, "etcd-retry-attempts", rke2.DefaultEtcdRetryAttempts,
+		"Maximum number of attempts of the etcd operations, e.g. the removal of an etcd member, failing with transient "+
+			"errors such as a leader election. Operations are not retried if not greater than 1.")
+
+	fs.DurationVar(&etcdRetryInterval, "etcd-retry-interval", rke2.DefaultEtcdRetryInterval,
+		"Delay before retrying an etcd operation failing with a transient error for the first time, doubled for each retry.")
+
+	fs.StringSliceVar(&rolloutIgnoredRKE2ConfigFields, "rollout-ignored-rke2-config-fields", nil,
+		"Comma separated list of RKE2ConfigSpec field paths, e.g. AgentConfig.Kubelet.ExtraArgs, whose changes don't roll out "+
+			"control plane machines. Machines drift from the RKE2ControlPlane when these fields change.")
+
+	fs.DurationVar(&healthProbeInterval, "workload-cluster-health-probe-interval", 0,
+		"Interval between two background probes of the etcd member health of the workload clusters, whose result is used "+
+			"to check the control plane readiness. Workload clusters are not probed in the background if not positive, the default.")
+
+	fs.DurationVar(&healthStaleness, "workload-cluster-health-staleness", rke2.DefaultWorkloadClusterHealthStaleness,
+		"Age after which the etcd member health probed in the background is no longer used.")
+
+	fs.StringVar(&caProviderSecret, "ca-provider-secret", "",
+		"Namespace/name of a Secret holding the root CA, under the tls.crt and tls.key keys, registered as the \"secret\" "+
+			"certificateAuthorityProvider of the control planes. Must be set on both the control plane and bootstrap providers.")
+
 	fs.IntVar(&webhookPort, "webhook-port", consts.DefaultWebhookPort, "Webhook Server port")
 
 	fs.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs/",
@@ -142,6 +186,11 @@ func main() {
 
 	ctrl.SetLogger(klog.Background())
 
+	if err := rke2.ValidateRKE2ConfigFieldPaths(rolloutIgnoredRKE2ConfigFields); err != nil {
+		setupLog.Error(err, "Unable to start manager: invalid flags")
+		os.Exit(1)
+	}
+
 	restConfig := ctrl.GetConfigOrDie()
 
 	tlsOptions, metricsOptions, err := flags.GetManagerOptions(managerOptions)
@@ -196,6 +245,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Register the CA providers the control planes can use through their certificateAuthorityProvider.
+	if caProviderSecret != "" {
+		if err := secret.RegisterSecretCAProvider(mgr.GetAPIReader(), caProviderSecret); err != nil {
+			setupLog.Error(err, "Unable to start manager: invalid flags")
+			os.Exit(1)
+		}
+	}
+
 	// Setup the context that's going to be used in controllers and for the manager.
 	ctx := ctrl.SetupSignalHandler()
 
@@ -240,6 +297,16 @@ func setupReconcilers(ctx context.Context, mgr ctrl.Manager) {
 		Scheme:              mgr.GetScheme(),
 		WatchFilterValue:    watchFilterValue,
 		SecretCachingClient: secretCachingClient,
+
+		StuckProvisioningThreshold:     stuckProvisioningThreshold,
+		EtcdMaintenanceOpsPerMinute:    etcdMaintenanceOpsPerMinute,
+		EtcdLearnerPromotionTimeout:    etcdLearnerPromotionTimeout,
+		EtcdRetryAttempts:              etcdRetryAttempts,
+		EtcdRetryInterval:              etcdRetryInterval,
+		RolloutIgnoredRKE2ConfigFields: rolloutIgnoredRKE2ConfigFields,
+
+		WorkloadClusterHealthProbeInterval: healthProbeInterval,
+		WorkloadClusterHealthStaleness:     healthStaleness,
 	}).SetupWithManager(ctx, mgr, clusterCacheTrackerClientQPS, clusterCacheTrackerClientBurst, concurrencyNumber); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "RKE2ControlPlane")
 		os.Exit(1)
@@ -21,9 +21,11 @@ import (
 	"crypto/tls"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/rest"
@@ -44,6 +46,7 @@ type ClientGenerator struct {
 	restConfig   *rest.Config
 	tlsConfig    *tls.Config
 	createClient clientCreator
+	pool         *clientPool
 }
 
 type clientCreator func(ctx context.Context, endpoint string) (*Client, error)
@@ -74,6 +77,26 @@ func NewClientGenerator(restConfig *rest.Config, tlsConfig *tls.Config, etcdDial
 	return ecg
 }
 
+// NewPooledClientGenerator returns a new etcdClientGenerator instance which reuses the connection to each etcd member
+// until Close is called. Clients returned by a pooled generator can be closed by callers as usual; this does not close
+// the pooled connection.
+func NewPooledClientGenerator(restConfig *rest.Config, tlsConfig *tls.Config, etcdDialTimeout, etcdCallTimeout time.Duration) *ClientGenerator {
+	ecg := NewClientGenerator(restConfig, tlsConfig, etcdDialTimeout, etcdCallTimeout)
+	ecg.pool = newClientPool(ecg.createClient)
+	ecg.createClient = ecg.pool.get
+
+	return ecg
+}
+
+// Close closes the etcd connections pooled by the generator.
+func (c *ClientGenerator) Close() error {
+	if c.pool == nil {
+		return nil
+	}
+
+	return c.pool.close()
+}
+
 // ForFirstAvailableNode takes a list of nodes and returns a client for the first one that connects.
 func (c *ClientGenerator) ForFirstAvailableNode(ctx context.Context, nodeNames []string) (*Client, error) {
 	// This is an additional safeguard for avoiding this func to return nil, nil.
@@ -187,3 +210,125 @@ func (c *ClientGenerator) getLeaderClient(ctx context.Context, nodeName string,
 func staticPodName(component, nodeName string) string {
 	return fmt.Sprintf("%s-%s", component, nodeName)
 }
+
+// clientPool caches etcd clients per member endpoint. It is safe for concurrent use.
+type clientPool struct {
+	lock    sync.Mutex
+	create  clientCreator
+	clients map[string]*Client
+	closed  bool
+
+	// connections deduplicates the concurrent connections to the same endpoint.
+	connections singleflight.Group
+}
+
+func newClientPool(create clientCreator) *clientPool {
+	return &clientPool{
+		create:  create,
+		clients: map[string]*Client{},
+	}
+}
+
+// errClientPoolClosed is returned when a client is requested from a closed pool.
+var errClientPoolClosed = errors.New("etcd client pool is closed")
+
+// get returns a client for the endpoint, reusing the pooled connection when it is still healthy. The connection is
+// checked, or dialed, without holding the lock of the pool so the other endpoints are not blocked by a slow member,
+// and once for all the concurrent requests for the same endpoint.
+func (p *clientPool) get(ctx context.Context, endpoint string) (*Client, error) {
+	result, err, _ := p.connections.Do(endpoint, func() (interface{}, error) {
+		return p.connect(ctx, endpoint)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Each caller gets its own copy, sharing the pooled connection.
+	client := *result.(*Client)
+
+	return &client, nil
+}
+
+// connect refreshes the pooled client of the endpoint, or replaces it with a new one if its connection is broken.
+func (p *clientPool) connect(ctx context.Context, endpoint string) (*Client, error) {
+	p.lock.Lock()
+	closed := p.closed
+	pooled, ok := p.clients[endpoint]
+	p.lock.Unlock()
+
+	if closed {
+		return nil, errClientPoolClosed
+	}
+
+	if ok {
+		// Refresh the leader and errors reported by the member, this also verifies the connection is still usable.
+		client, err := newEtcdClient(ctx, pooled.EtcdClient, pooled.CallTimeout)
+		if err == nil {
+			client.EtcdClient = pooledEtcd{etcd: pooled.EtcdClient}
+
+			return client, nil
+		}
+
+		p.lock.Lock()
+		// The pool may have been closed, and the client with it, in the meantime.
+		removed := p.clients[endpoint] == pooled
+		if removed {
+			delete(p.clients, endpoint)
+		}
+		p.lock.Unlock()
+
+		if removed {
+			_ = pooled.Close()
+		}
+	}
+
+	client, err := p.create(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		_ = client.Close()
+
+		return nil, errClientPoolClosed
+	}
+
+	p.clients[endpoint] = client
+
+	shared := *client
+	shared.EtcdClient = pooledEtcd{etcd: client.EtcdClient}
+
+	return &shared, nil
+}
+
+// close closes all the pooled clients; clients can't be requested from the pool afterwards.
+func (p *clientPool) close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	errs := []error{}
+
+	for endpoint, client := range p.clients {
+		if err := client.Close(); err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to close etcd client for %s", endpoint))
+		}
+	}
+
+	p.clients = map[string]*Client{}
+	p.closed = true
+
+	return kerrors.NewAggregate(errs)
+}
+
+// pooledEtcd wraps a pooled etcd client so that closing it is left to the pool.
+type pooledEtcd struct {
+	etcd
+}
+
+// Close is a no-op, the connection is closed when the pool is closed.
+func (pooledEtcd) Close() error {
+	return nil
+}
@@ -20,7 +20,10 @@ import (
 	"context"
 	"crypto/tls"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
@@ -228,3 +231,165 @@ func TestForLeader(t *testing.T) {
 		})
 	}
 }
+
+type closeCountingEtcdClient struct {
+	*fake.FakeEtcdClient
+	closed atomic.Int32
+	// statusErr is returned by Status, to simulate a broken connection.
+	statusErr error
+}
+
+func (c *closeCountingEtcdClient) Status(ctx context.Context, endpoint string) (*clientv3.StatusResponse, error) {
+	if c.statusErr != nil {
+		return nil, c.statusErr
+	}
+
+	return c.FakeEtcdClient.Status(ctx, endpoint)
+}
+
+func (c *closeCountingEtcdClient) Close() error {
+	c.closed.Add(1)
+
+	return nil
+}
+
+func newCloseCountingEtcdClient(endpoint string) *closeCountingEtcdClient {
+	return &closeCountingEtcdClient{
+		FakeEtcdClient: &fake.FakeEtcdClient{
+			EtcdEndpoints:  []string{endpoint},
+			StatusResponse: &clientv3.StatusResponse{Leader: 1729},
+		},
+	}
+}
+
+func TestPooledClientGenerator(t *testing.T) {
+	g := NewWithT(t)
+
+	var created atomic.Int32
+
+	etcdClients := map[string]*closeCountingEtcdClient{
+		"etcd-node-1": newCloseCountingEtcdClient("etcd-node-1"),
+		"etcd-node-2": newCloseCountingEtcdClient("etcd-node-2"),
+	}
+
+	subject := NewPooledClientGenerator(&rest.Config{}, &tls.Config{MinVersion: tls.VersionTLS12}, 0, 0)
+	subject.pool.create = func(ctx context.Context, endpoint string) (*Client, error) {
+		created.Add(1)
+
+		return newEtcdClient(ctx, etcdClients[endpoint], time.Second)
+	}
+
+	// Connections are reused across calls, also when requested concurrently.
+	var wg sync.WaitGroup
+
+	errs := make(chan error, 10)
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			client, err := subject.ForFirstAvailableNode(ctx, []string{"node-1"})
+			if err != nil {
+				errs <- err
+
+				return
+			}
+
+			if client.LeaderID != 1729 {
+				errs <- errors.Errorf("unexpected leader %d", client.LeaderID)
+
+				return
+			}
+
+			errs <- client.Close()
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+
+	g.Expect(created.Load()).To(Equal(int32(1)))
+	g.Expect(etcdClients["etcd-node-1"].closed.Load()).To(BeZero())
+
+	_, err := subject.ForFirstAvailableNode(ctx, []string{"node-2"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(created.Load()).To(Equal(int32(2)))
+
+	// Closing the generator closes every pooled connection exactly once.
+	g.Expect(subject.Close()).To(Succeed())
+	g.Expect(etcdClients["etcd-node-1"].closed.Load()).To(Equal(int32(1)))
+	g.Expect(etcdClients["etcd-node-2"].closed.Load()).To(Equal(int32(1)))
+
+	_, err = subject.ForFirstAvailableNode(ctx, []string{"node-1"})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(created.Load()).To(Equal(int32(2)))
+}
+
+func TestPooledClientGeneratorReplacesBrokenConnections(t *testing.T) {
+	g := NewWithT(t)
+
+	broken := newCloseCountingEtcdClient("etcd-node-1")
+	replacement := newCloseCountingEtcdClient("etcd-node-1")
+	clients := []*closeCountingEtcdClient{broken, replacement}
+
+	subject := NewPooledClientGenerator(&rest.Config{}, &tls.Config{MinVersion: tls.VersionTLS12}, 0, 0)
+	subject.pool.create = func(_ context.Context, endpoint string) (*Client, error) {
+		next := clients[0]
+		clients = clients[1:]
+
+		return &Client{Endpoint: endpoint, EtcdClient: next, CallTimeout: time.Second}, nil
+	}
+
+	_, err := subject.ForFirstAvailableNode(ctx, []string{"node-1"})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	broken.statusErr = errors.New("connection lost")
+
+	client, err := subject.ForFirstAvailableNode(ctx, []string{"node-1"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(client.EtcdClient).To(Equal(pooledEtcd{etcd: replacement}))
+	g.Expect(broken.closed.Load()).To(Equal(int32(1)))
+
+	g.Expect(subject.Close()).To(Succeed())
+	g.Expect(replacement.closed.Load()).To(Equal(int32(1)))
+}
+
+func TestPooledClientGeneratorDialsWithoutBlockingOtherEndpoints(t *testing.T) {
+	g := NewWithT(t)
+
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+
+	subject := NewPooledClientGenerator(&rest.Config{}, &tls.Config{MinVersion: tls.VersionTLS12}, 0, 0)
+	subject.pool.create = func(_ context.Context, endpoint string) (*Client, error) {
+		if endpoint == "etcd-node-1" {
+			close(dialing)
+			<-release
+		}
+
+		return &Client{Endpoint: endpoint, EtcdClient: newCloseCountingEtcdClient(endpoint), CallTimeout: time.Second}, nil
+	}
+
+	slowErr := make(chan error, 1)
+
+	go func() {
+		_, err := subject.ForFirstAvailableNode(ctx, []string{"node-1"})
+		slowErr <- err
+	}()
+
+	<-dialing
+
+	// Another endpoint is connected to while the first one is still being dialed.
+	_, err := subject.ForFirstAvailableNode(ctx, []string{"node-2"})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	close(release)
+	g.Expect(<-slowErr).ToNot(HaveOccurred())
+	g.Expect(subject.Close()).To(Succeed())
+}
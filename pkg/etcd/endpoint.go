@@ -0,0 +1,99 @@
+/*
+Copyright 2024 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// NormalizeEndpoint returns the etcd endpoint in a form the etcd client can dial. Hosts without a port get the
+// default etcd client port and IPv6 addresses are enclosed in square brackets, e.g. fd00::1 becomes [fd00::1]:2379.
+// The scheme and path of URL endpoints are preserved. An IPv6 address followed by a port must already be bracketed,
+// as it can't be told apart from an address otherwise.
+func NormalizeEndpoint(endpoint string) string {
+	scheme, hostPort, hasScheme := strings.Cut(endpoint, "://")
+	if !hasScheme {
+		hostPort, scheme = scheme, ""
+	}
+
+	hostPort, path, hasPath := strings.Cut(hostPort, "/")
+	if hostPort == "" {
+		return endpoint
+	}
+
+	if host, port, err := net.SplitHostPort(hostPort); err == nil {
+		hostPort = net.JoinHostPort(host, port)
+	} else {
+		hostPort = net.JoinHostPort(strings.Trim(hostPort, "[]"), strconv.Itoa(etcdPort))
+	}
+
+	if hasPath {
+		hostPort += "/" + path
+	}
+
+	if hasScheme {
+		return scheme + "://" + hostPort
+	}
+
+	return hostPort
+}
+
+// SortEndpointsByIPFamily returns a copy of the endpoints where IP endpoints of the preferred family come first and
+// IP endpoints of the other family last, so that members of a dual-stack cluster are dialed over the cluster primary
+// IP family. The relative order of the endpoints is preserved otherwise.
+func SortEndpointsByIPFamily(endpoints []string, preferIPv6 bool) []string {
+	rank := func(endpoint string) int {
+		ip := endpointIP(endpoint)
+
+		switch {
+		case ip == nil:
+			return 1
+		case (ip.To4() == nil) == preferIPv6:
+			return 0
+		default:
+			return 2
+		}
+	}
+
+	sorted := slices.Clone(endpoints)
+
+	slices.SortStableFunc(sorted, func(a, b string) int {
+		return rank(a) - rank(b)
+	})
+
+	return sorted
+}
+
+// endpointIP returns the IP address of the endpoint host, or nil if the host is not an IP address.
+func endpointIP(endpoint string) net.IP {
+	_, hostPort, hasScheme := strings.Cut(endpoint, "://")
+	if !hasScheme {
+		hostPort = endpoint
+	}
+
+	hostPort, _, _ = strings.Cut(hostPort, "/")
+
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host = strings.Trim(hostPort, "[]")
+	}
+
+	return net.ParseIP(host)
+}
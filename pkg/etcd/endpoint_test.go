@@ -0,0 +1,61 @@
+/*
+Copyright 2024 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNormalizeEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		expected string
+	}{
+		{endpoint: "fd00::1", expected: "[fd00::1]:2379"},
+		{endpoint: "[fd00::1]", expected: "[fd00::1]:2379"},
+		{endpoint: "[fd00::1]:2380", expected: "[fd00::1]:2380"},
+		{endpoint: "https://fd00::1", expected: "https://[fd00::1]:2379"},
+		{endpoint: "https://[fd00::1]:2379", expected: "https://[fd00::1]:2379"},
+		{endpoint: "https://[fd00::1]:2379/", expected: "https://[fd00::1]:2379/"},
+		{endpoint: "10.0.0.1", expected: "10.0.0.1:2379"},
+		{endpoint: "https://10.0.0.1:2379", expected: "https://10.0.0.1:2379"},
+		{endpoint: "https://etcd-0", expected: "https://etcd-0:2379"},
+		{endpoint: "etcd-0:2380", expected: "etcd-0:2380"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(NormalizeEndpoint(tt.endpoint)).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestSortEndpointsByIPFamily(t *testing.T) {
+	g := NewWithT(t)
+
+	endpoints := []string{"https://10.0.0.1:2379", "https://etcd-0:2379", "https://[fd00::1]:2379", "https://10.0.0.2:2379"}
+
+	g.Expect(SortEndpointsByIPFamily(endpoints, true)).To(Equal(
+		[]string{"https://[fd00::1]:2379", "https://etcd-0:2379", "https://10.0.0.1:2379", "https://10.0.0.2:2379"}))
+	g.Expect(SortEndpointsByIPFamily(endpoints, false)).To(Equal(
+		[]string{"https://10.0.0.1:2379", "https://10.0.0.2:2379", "https://etcd-0:2379", "https://[fd00::1]:2379"}))
+	g.Expect(endpoints[0]).To(Equal("https://10.0.0.1:2379"))
+}
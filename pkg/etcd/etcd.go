@@ -20,12 +20,16 @@ import (
 	"context"
 	"crypto/tls"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
 
 	"github.com/rancher/cluster-api-provider-rke2/pkg/proxy"
@@ -37,10 +41,15 @@ type GRPCDial func(ctx context.Context, addr string) (net.Conn, error)
 // etcd wraps the etcd client from etcd's clientv3 package.
 // This interface is implemented by both the clientv3 package and the backoff adapter that adds retries to the client.
 type etcd interface {
+	AlarmDisarm(ctx context.Context, m *clientv3.AlarmMember) (*clientv3.AlarmResponse, error)
 	AlarmList(ctx context.Context) (*clientv3.AlarmResponse, error)
 	Close() error
+	Compact(ctx context.Context, rev int64, opts ...clientv3.CompactOption) (*clientv3.CompactResponse, error)
+	Defragment(ctx context.Context, endpoint string) (*clientv3.DefragmentResponse, error)
 	Endpoints() []string
+	MemberAddAsLearner(ctx context.Context, peerAddrs []string) (*clientv3.MemberAddResponse, error)
 	MemberList(ctx context.Context) (*clientv3.MemberListResponse, error)
+	MemberPromote(ctx context.Context, id uint64) (*clientv3.MemberPromoteResponse, error)
 	MemberRemove(ctx context.Context, id uint64) (*clientv3.MemberRemoveResponse, error)
 	MemberUpdate(ctx context.Context, id uint64, peerURLs []string) (*clientv3.MemberUpdateResponse, error)
 	MoveLeader(ctx context.Context, id uint64) (*clientv3.MoveLeaderResponse, error)
@@ -79,10 +88,60 @@ const (
 	AlarmCorrupt
 )
 
+// ErrCompacted is returned when compacting the key space history at a revision which is already compacted.
+var ErrCompacted = rpctypes.ErrCompacted
+
+// ErrLearnerNotReady is returned when promoting a learner member which is not in sync with the leader yet.
+var ErrLearnerNotReady = rpctypes.ErrMemberLearnerNotReady
+
+// transientErrors are the etcd errors expected to go away on their own, e.g. during a leader election.
+var transientErrors = []error{
+	rpctypes.ErrNoLeader,
+	rpctypes.ErrNotLeader,
+	rpctypes.ErrLeaderChanged,
+	rpctypes.ErrNotCapable,
+	rpctypes.ErrStopped,
+	rpctypes.ErrTimeout,
+	rpctypes.ErrTimeoutDueToLeaderFail,
+	rpctypes.ErrTimeoutDueToConnectionLost,
+	rpctypes.ErrTimeoutWaitAppliedIndex,
+	rpctypes.ErrUnhealthy,
+	rpctypes.ErrTooManyRequests,
+	context.DeadlineExceeded,
+}
+
+// IsTransientError classifies an error returned by an etcd call. Errors raised while the cluster has no leader or is
+// electing one, timeouts, and unavailable or overloaded members are transient and worth retrying, while the other
+// errors, e.g. an unknown member or a learner which is not ready, are terminal as retrying the call right away can't
+// change its outcome.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	for _, transient := range transientErrors {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+
+	if grpcStatus, ok := status.FromError(err); ok {
+		switch grpcStatus.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+			return true
+		}
+	}
+
+	return false
+}
+
 // DefaultCallTimeout represents the duration that the etcd client waits at most
 // for read and write operations to etcd.
 const DefaultCallTimeout = 15 * time.Second
 
+// DefaultQuotaBackendBytes is the default etcd backend database quota, above which etcd raises a NOSPACE alarm.
+const DefaultQuotaBackendBytes int64 = 2 * 1024 * 1024 * 1024
+
 // AlarmTypeName provides a text translation for AlarmType codes.
 var AlarmTypeName = map[AlarmType]string{
 	AlarmOK:      "NONE",
@@ -130,6 +189,7 @@ func pbMemberToMember(m *etcdserverpb.Member) *Member {
 }
 
 // ClientConfiguration describes the configuration for an etcd client.
+// When Proxy has no KubeConfig the endpoint is dialed directly, e.g. for an external etcd cluster.
 type ClientConfiguration struct {
 	Endpoint    string
 	Proxy       proxy.Proxy
@@ -140,23 +200,26 @@ type ClientConfiguration struct {
 
 // NewClient creates a new etcd client with the given configuration.
 func NewClient(ctx context.Context, config ClientConfiguration) (*Client, error) {
-	dialer, err := proxy.NewDialer(config.Proxy)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to create a dialer for etcd client")
-	}
-
 	// Use a specific context with a timeout for the etcd client
 	clientCtx, cancel := context.WithTimeout(context.Background(), config.DialTimeout)
 	defer cancel()
 
 	c := clientv3.Config{
-		// NOTE: endpoint is used only as a host for certificate validation, the network connection is defined by DialOptions.
 		Endpoints: []string{config.Endpoint},
-		DialOptions: []grpc.DialOption{
+		TLS:       config.TLSConfig,
+		Context:   clientCtx,
+	}
+
+	if config.Proxy.KubeConfig != nil {
+		dialer, err := proxy.NewDialer(config.Proxy)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create a dialer for etcd client")
+		}
+
+		// NOTE: endpoint is used only as a host for certificate validation, the network connection is defined by DialOptions.
+		c.DialOptions = []grpc.DialOption{
 			grpc.WithContextDialer(dialer.DialContextWithAddr),
-		},
-		TLS:     config.TLSConfig,
-		Context: clientCtx,
+		}
 	}
 
 	etcdClient, err := clientv3.New(c)
@@ -261,6 +324,31 @@ func (c *Client) RemoveMember(ctx context.Context, id uint64) error {
 	return errors.Wrapf(err, "failed to remove member: %v", id)
 }
 
+// AddLearnerMember adds a learner member with the given peer URLs. The learner does not vote, and thus does not change
+// the quorum of the cluster, until it is promoted.
+func (c *Client) AddLearnerMember(ctx context.Context, peerURLs []string) (*Member, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+
+	response, err := c.EtcdClient.MemberAddAsLearner(ctx, peerURLs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to add etcd learner member with peer URLs %+v", peerURLs)
+	}
+
+	return pbMemberToMember(response.Member), nil
+}
+
+// PromoteMember promotes a learner member to a voting member. The returned error wraps ErrLearnerNotReady while the
+// learner is not in sync with the leader.
+func (c *Client) PromoteMember(ctx context.Context, id uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+
+	_, err := c.EtcdClient.MemberPromote(ctx, id)
+
+	return errors.Wrapf(err, "failed to promote learner member: %v", id)
+}
+
 // UpdateMemberPeerURLs updates the list of peer URLs.
 func (c *Client) UpdateMemberPeerURLs(ctx context.Context, id uint64, peerURLs []string) ([]*Member, error) {
 	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
@@ -299,3 +387,150 @@ func (c *Client) Alarms(ctx context.Context) ([]MemberAlarm, error) {
 
 	return memberAlarms, nil
 }
+
+// DisarmAlarm disarms the given alarm of a cluster member.
+func (c *Client) DisarmAlarm(ctx context.Context, alarm MemberAlarm) error {
+	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+
+	_, err := c.EtcdClient.AlarmDisarm(ctx, &clientv3.AlarmMember{
+		MemberID: alarm.MemberID,
+		Alarm:    etcdserverpb.AlarmType(alarm.Type),
+	})
+
+	return errors.Wrapf(err, "failed to disarm %s alarm of member %v", AlarmTypeName[alarm.Type], alarm.MemberID)
+}
+
+// DBSize returns the size in bytes of the backend database of the member the client is connected to.
+func (c *Client) DBSize(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+
+	status, err := c.EtcdClient.Status(ctx, c.Endpoint)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get etcd status of %s", c.Endpoint)
+	}
+
+	return status.DbSize, nil
+}
+
+// DBStatus is the size of the backend database of an etcd member.
+type DBStatus struct {
+	// Size is the physically allocated size of the database in bytes, which is compared against the quota.
+	Size int64
+
+	// SizeInUse is the logically used size of the database in bytes, the difference with Size is reclaimed on
+	// defragmentation.
+	SizeInUse int64
+}
+
+// DBStatus returns the size of the backend database of the member the client is connected to.
+func (c *Client) DBStatus(ctx context.Context) (*DBStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+
+	status, err := c.EtcdClient.Status(ctx, c.Endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get etcd status of %s", c.Endpoint)
+	}
+
+	return &DBStatus{Size: status.DbSize, SizeInUse: status.DbSizeInUse}, nil
+}
+
+// RaftIndex returns the raft index of the member the client is connected to.
+func (c *Client) RaftIndex(ctx context.Context) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+
+	status, err := c.EtcdClient.Status(ctx, c.Endpoint)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get etcd status of %s", c.Endpoint)
+	}
+
+	return status.RaftIndex, nil
+}
+
+// RaftTerm returns the raft term of the member the client is connected to, which is incremented by every leader
+// election.
+func (c *Client) RaftTerm(ctx context.Context) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+
+	status, err := c.EtcdClient.Status(ctx, c.Endpoint)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get etcd status of %s", c.Endpoint)
+	}
+
+	return status.RaftTerm, nil
+}
+
+// Revision returns the current revision of the key space, as seen by the member the client is connected to.
+func (c *Client) Revision(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+
+	status, err := c.EtcdClient.Status(ctx, c.Endpoint)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get etcd status of %s", c.Endpoint)
+	}
+
+	return status.Header.GetRevision(), nil
+}
+
+// Compact compacts the key space history up to the revision, and waits for the compaction to be applied to the backend
+// database of the members so it can be defragmented afterwards. The returned error wraps ErrCompacted if the history is
+// already compacted at the revision.
+func (c *Client) Compact(ctx context.Context, revision int64) error {
+	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+
+	_, err := c.EtcdClient.Compact(ctx, revision, clientv3.WithCompactPhysical())
+
+	return errors.Wrapf(err, "failed to compact etcd history at revision %d", revision)
+}
+
+// Defragment releases the free space of the backend database of the member the client is connected to back to the
+// filesystem. The member can't serve requests while its database is defragmented.
+func (c *Client) Defragment(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+
+	_, err := c.EtcdClient.Defragment(ctx, c.Endpoint)
+
+	return errors.Wrapf(err, "failed to defragment etcd member %s", c.Endpoint)
+}
+
+// Version returns the etcd server version of the member the client is connected to.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+
+	status, err := c.EtcdClient.Status(ctx, c.Endpoint)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get etcd status of %s", c.Endpoint)
+	}
+
+	return status.Version, nil
+}
+
+// Health returns an error if the member the client is connected to can't report its status, reports errors such as
+// an alarm, or has no leader.
+func (c *Client) Health(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+
+	status, err := c.EtcdClient.Status(ctx, c.Endpoint)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get etcd status of %s", c.Endpoint)
+	}
+
+	if len(status.Errors) > 0 {
+		return errors.Errorf("etcd member %s reports errors: %s", c.Endpoint, strings.Join(status.Errors, ", "))
+	}
+
+	if status.Leader == 0 {
+		return errors.Errorf("etcd member %s has no leader", c.Endpoint)
+	}
+
+	return nil
+}
@@ -17,13 +17,17 @@ limitations under the License.
 package etcd
 
 import (
+	"context"
 	"testing"
 
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
 	etcdfake "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/fake"
 	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -101,3 +105,18 @@ func TestEtcdMembers_WithSuccess(t *testing.T) {
 	g.Expect(updatedMembers[0].PeerURLs).To(HaveLen(2))
 	g.Expect(updatedMembers[0].PeerURLs).To(Equal([]string{"https://1.2.3.4:2000", "https://4.5.6.7:2000"}))
 }
+
+func TestIsTransientError(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(IsTransientError(nil)).To(BeFalse())
+	g.Expect(IsTransientError(errors.Wrap(rpctypes.ErrLeaderChanged, "failed to remove member from etcd"))).To(BeTrue())
+	g.Expect(IsTransientError(rpctypes.ErrNoLeader)).To(BeTrue())
+	g.Expect(IsTransientError(errors.Wrap(context.DeadlineExceeded, "failed to list etcd members"))).To(BeTrue())
+	g.Expect(IsTransientError(status.Error(codes.Unavailable, "connection refused"))).To(BeTrue())
+
+	g.Expect(IsTransientError(rpctypes.ErrMemberNotFound)).To(BeFalse())
+	g.Expect(IsTransientError(errors.Wrap(ErrLearnerNotReady, "failed to promote learner"))).To(BeFalse())
+	g.Expect(IsTransientError(status.Error(codes.PermissionDenied, "permission denied"))).To(BeFalse())
+	g.Expect(IsTransientError(errors.New("etcd certificates are invalid"))).To(BeFalse())
+}
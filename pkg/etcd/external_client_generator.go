@@ -0,0 +1,154 @@
+/*
+Copyright 2024 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ExternalClientGenerator generates etcd clients that connect directly to the members of an etcd cluster which
+// is not hosted on the control plane nodes. It implements ClientFor, node names are ignored since the members
+// are reached through their endpoints. Connections are pooled until Close is called.
+type ExternalClientGenerator struct {
+	endpoints    []string
+	preferIPv6   bool
+	createClient clientCreator
+	pool         *clientPool
+}
+
+// NewExternalClientGenerator returns a new ExternalClientGenerator for the given etcd endpoints.
+// The endpoints are normalized with NormalizeEndpoint, so that IPv6 addresses can be dialed.
+func NewExternalClientGenerator(
+	endpoints []string,
+	tlsConfig *tls.Config,
+	etcdDialTimeout, etcdCallTimeout time.Duration,
+	options ...func(*ExternalClientGenerator),
+) *ExternalClientGenerator {
+	pool := newClientPool(func(ctx context.Context, endpoint string) (*Client, error) {
+		return NewClient(ctx, ClientConfiguration{
+			Endpoint:    endpoint,
+			TLSConfig:   tlsConfig,
+			DialTimeout: etcdDialTimeout,
+			CallTimeout: etcdCallTimeout,
+		})
+	})
+
+	normalized := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		normalized = append(normalized, NormalizeEndpoint(endpoint))
+	}
+
+	generator := &ExternalClientGenerator{
+		endpoints:    normalized,
+		createClient: pool.get,
+		pool:         pool,
+	}
+
+	for _, option := range options {
+		option(generator)
+	}
+
+	return generator
+}
+
+// PreferIPv6 makes the generator dial the IPv6 client URLs of the etcd members first, for clusters whose
+// primary IP family is IPv6.
+func PreferIPv6(prefer bool) func(*ExternalClientGenerator) {
+	return func(c *ExternalClientGenerator) {
+		c.preferIPv6 = prefer
+	}
+}
+
+// Close closes the etcd connections pooled by the generator.
+func (c *ExternalClientGenerator) Close() error {
+	if c.pool == nil {
+		return nil
+	}
+
+	return c.pool.close()
+}
+
+// ForFirstAvailableNode returns a client for the first configured endpoint that connects.
+func (c *ExternalClientGenerator) ForFirstAvailableNode(ctx context.Context, _ []string) (*Client, error) {
+	return c.ForFirstAvailableEndpoint(ctx, c.endpoints)
+}
+
+// ForFirstAvailableEndpoint takes a list of etcd endpoints and returns a client for the first one that connects.
+func (c *ExternalClientGenerator) ForFirstAvailableEndpoint(ctx context.Context, endpoints []string) (*Client, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("invalid argument: no etcd endpoints to connect to")
+	}
+
+	var errs []error
+
+	for _, endpoint := range endpoints {
+		client, err := c.createClient(ctx, endpoint)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		return client, nil
+	}
+
+	return nil, errors.Wrap(kerrors.NewAggregate(errs), "could not establish a connection to any etcd endpoint")
+}
+
+// ForLeader returns a client connected to the etcd leader, using its advertised client URLs.
+func (c *ExternalClientGenerator) ForLeader(ctx context.Context, _ []string) (*Client, error) {
+	client, err := c.ForFirstAvailableNode(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not establish a connection to the etcd leader")
+	}
+
+	members, err := client.Members(ctx)
+	if err != nil {
+		_ = client.Close()
+
+		return nil, errors.Wrap(err, "failed to list etcd members")
+	}
+
+	for _, member := range members {
+		if member.ID != client.LeaderID {
+			continue
+		}
+
+		clientURLs := make([]string, 0, len(member.ClientURLs))
+		for _, url := range member.ClientURLs {
+			clientURLs = append(clientURLs, NormalizeEndpoint(url))
+		}
+
+		if slices.Contains(clientURLs, client.Endpoint) {
+			return client, nil
+		}
+
+		_ = client.Close()
+
+		return c.ForFirstAvailableEndpoint(ctx, SortEndpointsByIPFamily(clientURLs, c.preferIPv6))
+	}
+
+	_ = client.Close()
+
+	return nil, errors.Errorf("etcd leader is reported as %x, but we couldn't find any matching member", client.LeaderID)
+}
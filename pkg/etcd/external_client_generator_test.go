@@ -0,0 +1,174 @@
+/*
+Copyright 2024 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd/fake"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestExternalClientGeneratorForLeader(t *testing.T) {
+	members := &clientv3.MemberListResponse{
+		Members: []*etcdserverpb.Member{
+			{ID: 1234, Name: "etcd-0", ClientURLs: []string{"https://etcd-0:2379"}},
+			{ID: 1729, Name: "etcd-1", ClientURLs: []string{"https://etcd-1:2379"}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		endpoints []string
+		cc        clientCreator
+
+		expectedErr      string
+		expectedEndpoint string
+	}{
+		{
+			name:      "Returns client for the leader endpoint",
+			endpoints: []string{"https://etcd-0:2379", "https://etcd-1:2379"},
+			cc: func(_ context.Context, endpoint string) (*Client, error) {
+				return &Client{
+					Endpoint:   endpoint,
+					LeaderID:   1729,
+					EtcdClient: &fake.FakeEtcdClient{MemberListResponse: members, AlarmResponse: &clientv3.AlarmResponse{}},
+				}, nil
+			},
+			expectedEndpoint: "https://etcd-1:2379",
+		},
+		{
+			name:      "Reuses the first client when it is connected to the leader",
+			endpoints: []string{"https://etcd-down:2379", "https://etcd-0:2379"},
+			cc: func(_ context.Context, endpoint string) (*Client, error) {
+				if endpoint == "https://etcd-down:2379" {
+					return nil, errors.New("connection refused")
+				}
+
+				return &Client{
+					Endpoint:   endpoint,
+					LeaderID:   1234,
+					EtcdClient: &fake.FakeEtcdClient{MemberListResponse: members, AlarmResponse: &clientv3.AlarmResponse{}},
+				}, nil
+			},
+			expectedEndpoint: "https://etcd-0:2379",
+		},
+		{
+			name:      "Returns error when the leader is not a member",
+			endpoints: []string{"https://etcd-0:2379"},
+			cc: func(_ context.Context, endpoint string) (*Client, error) {
+				return &Client{
+					Endpoint:   endpoint,
+					LeaderID:   42,
+					EtcdClient: &fake.FakeEtcdClient{MemberListResponse: members, AlarmResponse: &clientv3.AlarmResponse{}},
+				}, nil
+			},
+			expectedErr: "etcd leader is reported as 2a, but we couldn't find any matching member",
+		},
+		{
+			name:      "Returns error when no endpoint is reachable",
+			endpoints: []string{"https://etcd-0:2379", "https://etcd-1:2379"},
+			cc: func(context.Context, string) (*Client, error) {
+				return nil, errors.New("connection refused")
+			},
+			expectedErr: "could not establish a connection to the etcd leader: could not establish a connection to any etcd endpoint: connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			generator := &ExternalClientGenerator{endpoints: tt.endpoints, createClient: tt.cc}
+
+			client, err := generator.ForLeader(ctx, []string{"ignored-node"})
+			if tt.expectedErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(Equal(tt.expectedErr))
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(client.Endpoint).To(Equal(tt.expectedEndpoint))
+		})
+	}
+}
+
+func TestExternalClientGeneratorWithoutEndpoints(t *testing.T) {
+	g := NewWithT(t)
+
+	generator := NewExternalClientGenerator(nil, nil, 0, 0)
+
+	_, err := generator.ForFirstAvailableEndpoint(ctx, nil)
+	g.Expect(err).To(MatchError("invalid argument: no etcd endpoints to connect to"))
+	g.Expect(generator.Close()).To(Succeed())
+}
+
+func TestExternalClientGeneratorForLeaderIPFamily(t *testing.T) {
+	members := &clientv3.MemberListResponse{
+		Members: []*etcdserverpb.Member{
+			{ID: 1234, Name: "etcd-0", ClientURLs: []string{"https://10.0.0.1:2379", "https://[fd00::1]:2379"}},
+			{ID: 1729, Name: "etcd-1", ClientURLs: []string{"https://10.0.0.2:2379", "https://[fd00::2]:2379"}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		preferIPv6 bool
+
+		expectedEndpoint string
+	}{
+		{
+			name:             "Dials the leader over IPv4 on IPv4 primary clusters",
+			expectedEndpoint: "https://10.0.0.2:2379",
+		},
+		{
+			name:             "Dials the leader over IPv6 on IPv6 primary clusters",
+			preferIPv6:       true,
+			expectedEndpoint: "https://[fd00::2]:2379",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			dialed := []string{}
+			generator := NewExternalClientGenerator([]string{"fd00::1"}, nil, 0, 0, PreferIPv6(tt.preferIPv6))
+			generator.createClient = func(_ context.Context, endpoint string) (*Client, error) {
+				dialed = append(dialed, endpoint)
+
+				return &Client{
+					Endpoint:   endpoint,
+					LeaderID:   1729,
+					EtcdClient: &fake.FakeEtcdClient{MemberListResponse: members, AlarmResponse: &clientv3.AlarmResponse{}},
+				}, nil
+			}
+
+			client, err := generator.ForLeader(ctx, nil)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(client.Endpoint).To(Equal(tt.expectedEndpoint))
+			g.Expect(dialed).To(Equal([]string{"[fd00::1]:2379", tt.expectedEndpoint}))
+		})
+	}
+}
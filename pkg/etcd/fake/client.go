@@ -25,16 +25,26 @@ import (
 
 // FakeEtcdClient represents a testing fake client for etcd interactions.
 type FakeEtcdClient struct { //nolint:revive
-	AlarmResponse        *clientv3.AlarmResponse
-	EtcdEndpoints        []string
-	MemberListResponse   *clientv3.MemberListResponse
-	MemberRemoveResponse *clientv3.MemberRemoveResponse
-	MemberUpdateResponse *clientv3.MemberUpdateResponse
-	MoveLeaderResponse   *clientv3.MoveLeaderResponse
-	StatusResponse       *clientv3.StatusResponse
-	ErrorResponse        error
-	MovedLeader          uint64
-	RemovedMember        uint64
+	AlarmResponse         *clientv3.AlarmResponse
+	CompactResponse       *clientv3.CompactResponse
+	EtcdEndpoints         []string
+	MemberAddResponse     *clientv3.MemberAddResponse
+	MemberListResponse    *clientv3.MemberListResponse
+	MemberPromoteResponse *clientv3.MemberPromoteResponse
+	MemberRemoveResponse  *clientv3.MemberRemoveResponse
+	MemberUpdateResponse  *clientv3.MemberUpdateResponse
+	MoveLeaderResponse    *clientv3.MoveLeaderResponse
+	StatusResponse        *clientv3.StatusResponse
+	ErrorResponse         error
+	MovedLeader           uint64
+	CompactedRevision     int64
+	DefragmentedEndpoints []string
+	AddedLearnerPeerURLs  []string
+	PromotedMember        uint64
+	RemovedMember         uint64
+	UpdatedMember         uint64
+	UpdatedPeerURLs       []string
+	DisarmedAlarms        []*clientv3.AlarmMember
 }
 
 // Endpoints returns available etcd endpoint.
@@ -54,6 +64,27 @@ func (c *FakeEtcdClient) Close() error {
 	return nil
 }
 
+// Compact compacts the key space history at the revision.
+func (c *FakeEtcdClient) Compact(_ context.Context, rev int64, _ ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+	c.CompactedRevision = rev
+
+	return c.CompactResponse, c.ErrorResponse
+}
+
+// Defragment defragments the backend database of the member at the endpoint.
+func (c *FakeEtcdClient) Defragment(_ context.Context, endpoint string) (*clientv3.DefragmentResponse, error) {
+	c.DefragmentedEndpoints = append(c.DefragmentedEndpoints, endpoint)
+
+	return &clientv3.DefragmentResponse{}, c.ErrorResponse
+}
+
+// AlarmDisarm disarms the given alarm.
+func (c *FakeEtcdClient) AlarmDisarm(_ context.Context, m *clientv3.AlarmMember) (*clientv3.AlarmResponse, error) {
+	c.DisarmedAlarms = append(c.DisarmedAlarms, m)
+
+	return c.AlarmResponse, c.ErrorResponse
+}
+
 // AlarmList returns a list or alarms on etcd cluster.
 func (c *FakeEtcdClient) AlarmList(_ context.Context) (*clientv3.AlarmResponse, error) {
 	return c.AlarmResponse, c.ErrorResponse
@@ -64,6 +95,20 @@ func (c *FakeEtcdClient) MemberList(_ context.Context) (*clientv3.MemberListResp
 	return c.MemberListResponse, c.ErrorResponse
 }
 
+// MemberAddAsLearner adds a learner member with the peer URLs.
+func (c *FakeEtcdClient) MemberAddAsLearner(_ context.Context, peerAddrs []string) (*clientv3.MemberAddResponse, error) {
+	c.AddedLearnerPeerURLs = peerAddrs
+
+	return c.MemberAddResponse, c.ErrorResponse
+}
+
+// MemberPromote promotes the learner member by id.
+func (c *FakeEtcdClient) MemberPromote(_ context.Context, i uint64) (*clientv3.MemberPromoteResponse, error) {
+	c.PromotedMember = i
+
+	return c.MemberPromoteResponse, c.ErrorResponse
+}
+
 // MemberRemove removes the member by id.
 func (c *FakeEtcdClient) MemberRemove(_ context.Context, i uint64) (*clientv3.MemberRemoveResponse, error) {
 	c.RemovedMember = i
@@ -72,7 +117,10 @@ func (c *FakeEtcdClient) MemberRemove(_ context.Context, i uint64) (*clientv3.Me
 }
 
 // MemberUpdate updates the member by id.
-func (c *FakeEtcdClient) MemberUpdate(_ context.Context, _ uint64, _ []string) (*clientv3.MemberUpdateResponse, error) {
+func (c *FakeEtcdClient) MemberUpdate(_ context.Context, i uint64, peerURLs []string) (*clientv3.MemberUpdateResponse, error) {
+	c.UpdatedMember = i
+	c.UpdatedPeerURLs = peerURLs
+
 	return c.MemberUpdateResponse, c.ErrorResponse
 }
 
@@ -19,8 +19,13 @@ package kubeconfig
 import (
 	"context"
 	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	"math/big"
+	"time"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
@@ -116,6 +121,65 @@ func New(
 		return nil, errors.Wrap(err, "unable to sign certificate")
 	}
 
+	return newAdminConfig(clusterName, endpoint, clientKey, clientCert, serverCACert), nil
+}
+
+// NewWithTTL creates a new Kubeconfig using the cluster name and specified endpoint, whose admin client certificate
+// expires after the given TTL. The certificate is valid from one minute before its creation to tolerate clock skew.
+func NewWithTTL(
+	clusterName,
+	endpoint string,
+	clientCACert *x509.Certificate, clientCAKey crypto.Signer, serverCACert *x509.Certificate,
+	ttl time.Duration,
+) (*api.Config, error) {
+	if ttl <= 0 {
+		return nil, errors.Errorf("invalid client certificate TTL %s, must be positive", ttl)
+	}
+
+	clientKey, err := certs.NewPrivateKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create private key")
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128)) //nolint:mnd
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to generate serial number")
+	}
+
+	now := time.Now().UTC()
+
+	tmpl := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   "kubernetes-admin",
+			Organization: []string{"system:masters"},
+		},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(ttl),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, &tmpl, clientCACert, clientKey.Public(), clientCAKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to sign certificate")
+	}
+
+	clientCert, err := x509.ParseCertificate(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse signed certificate")
+	}
+
+	return newAdminConfig(clusterName, endpoint, clientKey, clientCert, serverCACert), nil
+}
+
+// newAdminConfig returns the Kubeconfig authenticating to the cluster with the given admin client certificate.
+func newAdminConfig(
+	clusterName,
+	endpoint string,
+	clientKey *rsa.PrivateKey, clientCert *x509.Certificate, serverCACert *x509.Certificate,
+) *api.Config {
 	userName := clusterName + "-admin"
 	contextName := fmt.Sprintf("%s@%s", userName, clusterName)
 
@@ -139,7 +203,7 @@ func New(
 			},
 		},
 		CurrentContext: contextName,
-	}, nil
+	}
 }
 
 // CreateSecret creates the Kubeconfig secret for the given cluster.
@@ -184,6 +248,25 @@ func UpdateSecret(ctx context.Context, c client.Client, clusterName client.Objec
 	return c.Update(ctx, configSecret)
 }
 
+// NeedsEndpointUpdate returns whether the kubeconfig of the secret points to another endpoint than the given one, e.g.
+// after the control plane endpoint of the cluster was migrated to a load balancer.
+func NeedsEndpointUpdate(configSecret *corev1.Secret, endpoint string) (bool, error) {
+	config, err := clientcmd.Load(configSecret.Data[secret.KubeconfigDataName])
+	if err != nil {
+		return false, errors.Wrap(err, "failed to parse kubeconfig")
+	}
+
+	server := "https://" + endpoint
+
+	for _, cluster := range config.Clusters {
+		if cluster.Server != server {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 // GenerateSecret returns a Kubernetes secret for the given Cluster and kubeconfig data.
 func GenerateSecret(cluster *clusterv1.Cluster, data []byte) *corev1.Secret {
 	name := util.ObjectKey(cluster)
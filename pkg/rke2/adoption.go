@@ -0,0 +1,149 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+// adoptionEnabled returns true if the RKE2ControlPlane opted in to the backfill of the annotations of adopted machines.
+func adoptionEnabled(rcp *controlplanev1.RKE2ControlPlane) bool {
+	return rcp.Annotations[controlplanev1.AdoptMachinesAnnotation] == "true"
+}
+
+// BackfillAdoptedMachines adds the annotations which machines created by the RKE2ControlPlane carry, i.e. the server
+// config annotation of the machine and the cloned-from annotations of the infrastructure machine, to the machines
+// missing them, so adopted machines are considered up to date with the current spec and rolled out on later changes.
+// It does nothing unless the RKE2ControlPlane has the AdoptMachinesAnnotation, and skips the machines for which it is
+// not safe, see adoptable. Existing annotations are left untouched, so calling it again is a no-op.
+// It returns the names of the machines which were backfilled.
+func (c *ControlPlane) BackfillAdoptedMachines(ctx context.Context, cl client.Client) ([]string, error) {
+	if !adoptionEnabled(c.RCP) {
+		return nil, nil
+	}
+
+	serverConfig, err := json.Marshal(c.RCP.Spec.ServerConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal server config")
+	}
+
+	backfilled := []string{}
+
+	for _, machine := range c.Machines.SortedByCreationTimestamp() {
+		infraObj := c.InfraResources[machine.Name]
+		if !adoptable(c.RCP, machine, infraObj) {
+			continue
+		}
+
+		changed, err := backfillInfraMachine(ctx, cl, c.RCP, infraObj)
+		if err != nil {
+			return backfilled, err
+		}
+
+		if _, ok := machine.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation]; !ok {
+			patch := client.MergeFrom(machine.DeepCopy())
+
+			if machine.Annotations == nil {
+				machine.Annotations = map[string]string{}
+			}
+
+			machine.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = string(serverConfig)
+
+			if err := cl.Patch(ctx, machine, patch); err != nil {
+				return backfilled, errors.Wrapf(err, "failed to backfill annotations of machine %s", machine.Name)
+			}
+
+			changed = true
+		}
+
+		if changed {
+			backfilled = append(backfilled, machine.Name)
+		}
+	}
+
+	return backfilled, nil
+}
+
+// adoptable returns true if the annotations of the machine can be backfilled: the machine is not being deleted and its
+// infrastructure machine is of the kind created from the infrastructure template of the RKE2ControlPlane, so the
+// cloned-from annotations don't hide a machine of another kind.
+func adoptable(rcp *controlplanev1.RKE2ControlPlane, machine *clusterv1.Machine, infraObj *unstructured.Unstructured) bool {
+	if machine == nil || !machine.DeletionTimestamp.IsZero() || infraObj == nil {
+		return false
+	}
+
+	templateGVK := rcp.Spec.MachineTemplate.InfrastructureRef.GroupVersionKind()
+	infraGVK := infraObj.GroupVersionKind()
+
+	return infraGVK.Group == templateGVK.Group && infraGVK.Kind+"Template" == templateGVK.Kind
+}
+
+// backfillInfraMachine adds the missing cloned-from annotations to the infrastructure machine, and returns true if it
+// was patched.
+func backfillInfraMachine(
+	ctx context.Context,
+	cl client.Client,
+	rcp *controlplanev1.RKE2ControlPlane,
+	infraObj *unstructured.Unstructured,
+) (bool, error) {
+	infraRef := rcp.Spec.MachineTemplate.InfrastructureRef
+	desired := map[string]string{
+		clusterv1.TemplateClonedFromNameAnnotation:      infraRef.Name,
+		clusterv1.TemplateClonedFromGroupKindAnnotation: infraRef.GroupVersionKind().GroupKind().String(),
+	}
+
+	annotations := infraObj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	missing := []string{}
+
+	for key, value := range desired {
+		if _, ok := annotations[key]; !ok {
+			annotations[key] = value
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) == 0 {
+		return false, nil
+	}
+
+	slices.Sort(missing)
+
+	patch := client.MergeFrom(infraObj.DeepCopy())
+	infraObj.SetAnnotations(annotations)
+
+	if err := cl.Patch(ctx, infraObj, patch); err != nil {
+		return false, errors.Wrapf(err, "failed to backfill %s annotations of %s %s",
+			strings.Join(missing, ", "), infraObj.GetKind(), infraObj.GetName())
+	}
+
+	return true, nil
+}
@@ -0,0 +1,128 @@
+package rke2
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+func TestBackfillAdoptedMachines(t *testing.T) {
+	infraGVK := schema.GroupVersionKind{Group: "infrastructure.cluster.x-k8s.io", Version: "v1beta1", Kind: "DockerMachine"}
+
+	testScheme := runtime.NewScheme()
+	NewWithT(t).Expect(clusterv1.AddToScheme(testScheme)).To(Succeed())
+
+	restMapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{infraGVK.GroupVersion()})
+	restMapper.Add(infraGVK, meta.RESTScopeNamespace)
+
+	setup := func(annotations map[string]string) (*ControlPlane, client.Client) {
+		adoptedRCP := &controlplanev1.RKE2ControlPlane{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "rcp", Annotations: annotations},
+			Spec: controlplanev1.RKE2ControlPlaneSpec{
+				ServerConfig: controlplanev1.RKE2ServerConfig{CNI: controlplanev1.Calico},
+				MachineTemplate: controlplanev1.RKE2ControlPlaneMachineTemplate{
+					InfrastructureRef: corev1.ObjectReference{
+						APIVersion: infraGVK.GroupVersion().String(),
+						Kind:       "DockerMachineTemplate",
+						Name:       "cp-template",
+					},
+				},
+			},
+		}
+
+		adopted := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "adopted"}}
+
+		infraMachine := &unstructured.Unstructured{}
+		infraMachine.SetGroupVersionKind(infraGVK)
+		infraMachine.SetNamespace("default")
+		infraMachine.SetName("adopted")
+
+		cl := fake.NewClientBuilder().WithScheme(testScheme).WithRESTMapper(restMapper).
+			WithObjects(adopted, infraMachine).Build()
+
+		return &ControlPlane{
+			RCP:            adoptedRCP,
+			Machines:       collections.FromMachines(adopted),
+			InfraResources: map[string]*unstructured.Unstructured{"adopted": infraMachine},
+		}, cl
+	}
+
+	t.Run("adopted machine is up to date after the backfill", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cp, cl := setup(map[string]string{controlplanev1.AdoptMachinesAnnotation: "true"})
+
+		backfilled, err := cp.BackfillAdoptedMachines(context.Background(), cl)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(backfilled).To(Equal([]string{"adopted"}))
+
+		m := &clusterv1.Machine{}
+		g.Expect(cl.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "adopted"}, m)).To(Succeed())
+		g.Expect(m.Annotations).To(HaveKey(controlplanev1.RKE2ServerConfigurationAnnotation))
+
+		infraMachine := &unstructured.Unstructured{}
+		infraMachine.SetGroupVersionKind(infraGVK)
+		g.Expect(cl.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "adopted"}, infraMachine)).To(Succeed())
+		g.Expect(infraMachine.GetAnnotations()).To(Equal(map[string]string{
+			clusterv1.TemplateClonedFromNameAnnotation:      "cp-template",
+			clusterv1.TemplateClonedFromGroupKindAnnotation: "DockerMachineTemplate.infrastructure.cluster.x-k8s.io",
+		}))
+
+		infraConfigs := map[string]*unstructured.Unstructured{"adopted": infraMachine}
+		g.Expect(matchServerConfig(cp.RCP, m)).To(BeTrue())
+		g.Expect(matchesTemplateClonedFrom(infraConfigs, cp.RCP)(m)).To(BeTrue())
+
+		// Later changes of the spec are detected on the backfilled machine.
+		changed := cp.RCP.DeepCopy()
+		changed.Spec.ServerConfig.CNI = controlplanev1.Cilium
+		changed.Spec.MachineTemplate.InfrastructureRef.Name = "cp-template-v2"
+		g.Expect(matchServerConfig(changed, m)).To(BeFalse())
+		g.Expect(matchesTemplateClonedFrom(infraConfigs, changed)(m)).To(BeFalse())
+
+		// The backfill is idempotent.
+		cp.Machines = collections.FromMachines(m)
+		cp.InfraResources = infraConfigs
+		backfilled, err = cp.BackfillAdoptedMachines(context.Background(), cl)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(backfilled).To(BeEmpty())
+	})
+
+	t.Run("does nothing without the opt-in annotation", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cp, cl := setup(nil)
+
+		backfilled, err := cp.BackfillAdoptedMachines(context.Background(), cl)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(backfilled).To(BeEmpty())
+
+		m := &clusterv1.Machine{}
+		g.Expect(cl.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "adopted"}, m)).To(Succeed())
+		g.Expect(m.Annotations).To(BeEmpty())
+	})
+
+	t.Run("skips infrastructure machines of another kind", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cp, cl := setup(map[string]string{controlplanev1.AdoptMachinesAnnotation: "true"})
+		cp.RCP.Spec.MachineTemplate.InfrastructureRef.Kind = "AWSMachineTemplate"
+
+		backfilled, err := cp.BackfillAdoptedMachines(context.Background(), cl)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(backfilled).To(BeEmpty())
+	})
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+	bsutil "github.com/rancher/cluster-api-provider-rke2/pkg/util"
+)
+
+const (
+	// DefaultChannelServerURL is the URL of the RKE2 release channel server.
+	DefaultChannelServerURL = "https://update.rke2.io/v1-release/channels"
+
+	// DefaultChannelCacheTTL is how long a resolved release channel version is cached.
+	DefaultChannelCacheTTL = 10 * time.Minute
+
+	channelResolveTimeout = 10 * time.Second
+)
+
+// NewDefaultChannelResolver returns a ChannelResolver resolving the release channels against the RKE2 channel server,
+// caching the resolved versions for DefaultChannelCacheTTL.
+func NewDefaultChannelResolver() ChannelResolver {
+	return NewCachedChannelResolver(&HTTPChannelResolver{URL: DefaultChannelServerURL}, DefaultChannelCacheTTL)
+}
+
+// ChannelResolver resolves an RKE2 release channel to the RKE2 version the channel currently points to.
+type ChannelResolver interface {
+	ResolveChannel(ctx context.Context, channel string) (string, error)
+}
+
+// ResolveDesiredVersion returns the desired RKE2 version of the RKE2ControlPlane. When the RKE2ControlPlane has no
+// version but a release channel, the channel is resolved using the given resolver. Without version nor channel,
+// the version is taken from the tag of the runtime image the RKE2 install is pinned with, if any. A runtime image tag
+// which is not an RKE2 version is logged and resolves to an empty version, as if the install was not pinned.
+func ResolveDesiredVersion(ctx context.Context, resolver ChannelResolver, rcp *controlplanev1.RKE2ControlPlane) (string, error) {
+	version := rcp.GetDesiredVersion()
+	if version != "" {
+		return version, nil
+	}
+
+	if rcp.Spec.Channel == "" {
+		if rcp.Spec.AgentConfig.RuntimeImage == "" {
+			return "", nil
+		}
+
+		version, err := bsutil.VersionFromImageRef(rcp.Spec.AgentConfig.RuntimeImage)
+		if err != nil {
+			log.FromContext(ctx).Info("Ignoring runtime image, its tag is not an RKE2 version",
+				"runtimeImage", rcp.Spec.AgentConfig.RuntimeImage, "reason", err.Error())
+
+			return "", nil
+		}
+
+		return version, nil
+	}
+
+	if resolver == nil {
+		return "", errors.Errorf("no resolver for RKE2 release channel %q", rcp.Spec.Channel)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, channelResolveTimeout)
+	defer cancel()
+
+	version, err := resolver.ResolveChannel(ctx, rcp.Spec.Channel)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve RKE2 release channel %q", rcp.Spec.Channel)
+	}
+
+	return version, nil
+}
+
+// HTTPChannelResolver resolves release channels against an RKE2 channel server, which redirects the channel URL
+// to the release page of the channel latest version.
+type HTTPChannelResolver struct {
+	// URL is the base URL of the channel server.
+	URL string
+
+	// Client is the HTTP client used to query the channel server, http.DefaultClient is used if nil.
+	Client *http.Client
+}
+
+// ResolveChannel returns the RKE2 version the channel redirects to.
+func (r *HTTPChannelResolver) ResolveChannel(ctx context.Context, channel string) (string, error) {
+	channelURL, err := url.JoinPath(r.URL, channel)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build channel URL")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, channelURL, http.NoBody)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create channel request")
+	}
+
+	client := http.DefaultClient
+	if r.Client != nil {
+		client = r.Client
+	}
+
+	// Only the redirect location is needed, the release page is not fetched.
+	noRedirectClient := *client
+	noRedirectClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := noRedirectClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to query channel server")
+	}
+	defer resp.Body.Close()
+
+	location, err := resp.Location()
+	if err != nil {
+		return "", errors.Wrapf(err, "channel server did not redirect channel %q, status %s", channel, resp.Status)
+	}
+
+	version := path.Base(location.Path)
+	if !bsutil.IsRKE2Version(version) {
+		return "", errors.Errorf("channel %q resolved to %q, which is not an RKE2 version", channel, version)
+	}
+
+	return version, nil
+}
+
+// CachedChannelResolver caches the versions resolved by another ChannelResolver. It is safe for concurrent use.
+type CachedChannelResolver struct {
+	resolver ChannelResolver
+	ttl      time.Duration
+	now      func() time.Time
+
+	lock  sync.Mutex
+	cache map[string]resolvedChannel
+}
+
+type resolvedChannel struct {
+	version    string
+	resolvedAt time.Time
+}
+
+// NewCachedChannelResolver returns a ChannelResolver caching the versions resolved by the given resolver for ttl.
+func NewCachedChannelResolver(resolver ChannelResolver, ttl time.Duration) *CachedChannelResolver {
+	return &CachedChannelResolver{
+		resolver: resolver,
+		ttl:      ttl,
+		now:      time.Now,
+		cache:    map[string]resolvedChannel{},
+	}
+}
+
+// ResolveChannel returns the cached version of the channel, resolving it again once the cache entry expired.
+// Resolution failures are not cached. The cache is not locked while the channel is resolved, so concurrent
+// resolutions of an expired channel may each query the underlying resolver.
+func (r *CachedChannelResolver) ResolveChannel(ctx context.Context, channel string) (string, error) {
+	if version, ok := r.cached(channel); ok {
+		return version, nil
+	}
+
+	version, err := r.resolver.ResolveChannel(ctx, channel)
+	if err != nil {
+		return "", err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.cache[channel] = resolvedChannel{version: version, resolvedAt: r.now()}
+
+	return version, nil
+}
+
+// cached returns the cached version of the channel, if its cache entry did not expire yet.
+func (r *CachedChannelResolver) cached(channel string) (string, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	cached, ok := r.cache[channel]
+	if !ok || r.now().Sub(cached.resolvedAt) >= r.ttl {
+		return "", false
+	}
+
+	return cached.version, true
+}
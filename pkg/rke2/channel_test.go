@@ -0,0 +1,241 @@
+package rke2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+type fakeChannelResolver struct {
+	versions map[string]string
+	err      error
+	calls    int
+}
+
+func (r *fakeChannelResolver) ResolveChannel(_ context.Context, channel string) (string, error) {
+	r.calls++
+
+	if r.err != nil {
+		return "", r.err
+	}
+
+	return r.versions[channel], nil
+}
+
+// blockingChannelResolver resolves the channels once it is released.
+type blockingChannelResolver struct {
+	started  chan struct{}
+	released chan struct{}
+}
+
+func (r *blockingChannelResolver) ResolveChannel(_ context.Context, channel string) (string, error) {
+	r.started <- struct{}{}
+	<-r.released
+
+	return channel, nil
+}
+
+// matchesResolvedVersion returns whether the machine matches the version of the RCP, resolved as for a reconcile.
+func matchesResolvedVersion(resolver ChannelResolver, rcp *controlplanev1.RKE2ControlPlane, machine *clusterv1.Machine) bool {
+	c := &ControlPlane{RCP: rcp}
+	c.ResolveDesiredVersion(context.Background(), resolver)
+
+	return matchesDesiredVersion(c.rolloutRCP())(machine)
+}
+
+func TestHTTPChannelResolver(t *testing.T) {
+	g := NewWithT(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1-release/channels/stable":
+			http.Redirect(w, r, "https://github.com/rancher/rke2/releases/tag/v1.31.4+rke2r1", http.StatusFound)
+		case "/v1-release/channels/broken":
+			http.Redirect(w, r, "https://github.com/rancher/rke2/releases", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	resolver := &HTTPChannelResolver{URL: server.URL + "/v1-release/channels", Client: server.Client()}
+
+	g.Expect(resolver.ResolveChannel(context.Background(), "stable")).To(Equal("v1.31.4+rke2r1"))
+
+	_, err := resolver.ResolveChannel(context.Background(), "broken")
+	g.Expect(err).To(MatchError(ContainSubstring("not an RKE2 version")))
+
+	_, err = resolver.ResolveChannel(context.Background(), "unknown")
+	g.Expect(err).To(MatchError(ContainSubstring("did not redirect")))
+}
+
+func TestCachedChannelResolver(t *testing.T) {
+	g := NewWithT(t)
+
+	now := time.Now()
+	fake := &fakeChannelResolver{versions: map[string]string{"stable": "v1.31.4+rke2r1"}}
+	resolver := NewCachedChannelResolver(fake, time.Minute)
+	resolver.now = func() time.Time { return now }
+
+	g.Expect(resolver.ResolveChannel(context.Background(), "stable")).To(Equal("v1.31.4+rke2r1"))
+	g.Expect(resolver.ResolveChannel(context.Background(), "stable")).To(Equal("v1.31.4+rke2r1"))
+	g.Expect(fake.calls).To(Equal(1))
+
+	// The channel is resolved again once the cache entry expired.
+	now = now.Add(2 * time.Minute)
+	fake.versions["stable"] = "v1.31.5+rke2r1"
+	g.Expect(resolver.ResolveChannel(context.Background(), "stable")).To(Equal("v1.31.5+rke2r1"))
+	g.Expect(fake.calls).To(Equal(2))
+
+	// Failures are not cached.
+	fake.err = errors.New("channel server unavailable")
+	_, err := resolver.ResolveChannel(context.Background(), "latest")
+	g.Expect(err).To(HaveOccurred())
+	_, err = resolver.ResolveChannel(context.Background(), "latest")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(fake.calls).To(Equal(4))
+}
+
+func TestCachedChannelResolverConcurrentResolutions(t *testing.T) {
+	g := NewWithT(t)
+
+	blocking := &blockingChannelResolver{started: make(chan struct{}), released: make(chan struct{})}
+	resolver := NewCachedChannelResolver(blocking, time.Minute)
+
+	resolved := make(chan string, 2)
+
+	for _, channel := range []string{"stable", "latest"} {
+		go func() {
+			version, _ := resolver.ResolveChannel(context.Background(), channel)
+			resolved <- version
+		}()
+	}
+
+	// Both channels are resolved at the same time, the cache is not locked while one of them is resolved.
+	for range 2 {
+		g.Eventually(blocking.started).Should(Receive())
+	}
+
+	close(blocking.released)
+
+	g.Eventually(resolved).Should(Receive())
+	g.Eventually(resolved).Should(Receive())
+}
+
+func TestMatchesDesiredVersionWithChannel(t *testing.T) {
+	version := "v1.31.4+rke2r1"
+	machine := &clusterv1.Machine{Spec: clusterv1.MachineSpec{Version: &version}}
+
+	tests := []struct {
+		name     string
+		resolver *fakeChannelResolver
+		expected bool
+	}{
+		{
+			name:     "no rollout when the channel still resolves to the machine version",
+			resolver: &fakeChannelResolver{versions: map[string]string{"stable": "v1.31.4+rke2r1"}},
+			expected: true,
+		},
+		{
+			name:     "rollout when the channel moved to a new version",
+			resolver: &fakeChannelResolver{versions: map[string]string{"stable": "v1.31.5+rke2r1"}},
+			expected: false,
+		},
+		{
+			name:     "no rollout when the channel can't be resolved",
+			resolver: &fakeChannelResolver{err: errors.New("channel server unavailable")},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			rcp := &controlplanev1.RKE2ControlPlane{Spec: controlplanev1.RKE2ControlPlaneSpec{Channel: "stable"}}
+
+			g.Expect(matchesResolvedVersion(tt.resolver, rcp, machine)).To(Equal(tt.expected))
+			g.Expect(tt.resolver.calls).To(Equal(1))
+		})
+	}
+
+	t.Run("the channel is ignored when a version is set", func(t *testing.T) {
+		g := NewWithT(t)
+
+		resolver := &fakeChannelResolver{versions: map[string]string{"stable": "v1.31.5+rke2r1"}}
+
+		rcp := &controlplanev1.RKE2ControlPlane{Spec: controlplanev1.RKE2ControlPlaneSpec{Version: version, Channel: "stable"}}
+
+		g.Expect(matchesResolvedVersion(resolver, rcp, machine)).To(BeTrue())
+		g.Expect(resolver.calls).To(BeZero())
+	})
+}
+
+func TestMatchesDesiredVersionWithRuntimeImage(t *testing.T) {
+	version := "v1.31.4+rke2r1"
+	machine := &clusterv1.Machine{Spec: clusterv1.MachineSpec{Version: &version}}
+
+	rcpWithRuntimeImage := func(image string) *controlplanev1.RKE2ControlPlane {
+		rcp := &controlplanev1.RKE2ControlPlane{}
+		rcp.Spec.AgentConfig.RuntimeImage = image
+
+		return rcp
+	}
+
+	tests := []struct {
+		name     string
+		image    string
+		expected bool
+	}{
+		{
+			name:     "no rollout when the runtime image is tagged with the machine version",
+			image:    "registry.example.com:5000/rancher/rke2-runtime:v1.31.4-rke2r1",
+			expected: true,
+		},
+		{
+			name:     "rollout when the runtime image is tagged with a new version",
+			image:    "registry.example.com:5000/rancher/rke2-runtime:v1.31.5-rke2r1",
+			expected: false,
+		},
+		{
+			name:     "no rollout when the version can't be resolved from the runtime image",
+			image:    "registry.example.com:5000/rancher/rke2-runtime:latest",
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(matchesResolvedVersion(nil, rcpWithRuntimeImage(tt.image), machine)).To(Equal(tt.expected))
+		})
+	}
+
+	t.Run("a runtime image not tagged with a version resolves to no version", func(t *testing.T) {
+		g := NewWithT(t)
+
+		resolved, err := ResolveDesiredVersion(context.Background(), nil, rcpWithRuntimeImage("rancher/rke2-runtime:latest"))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(resolved).To(BeEmpty())
+	})
+
+	t.Run("the runtime image is ignored when a version is set", func(t *testing.T) {
+		g := NewWithT(t)
+
+		rcp := rcpWithRuntimeImage("rancher/rke2-runtime:v1.31.5-rke2r1")
+		rcp.Spec.Version = version
+
+		resolved, err := ResolveDesiredVersion(context.Background(), nil, rcp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(resolved).To(Equal(version))
+	})
+}
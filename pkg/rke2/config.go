@@ -18,6 +18,8 @@ package rke2
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"strings"
 
@@ -31,6 +33,7 @@ import (
 	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
 	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
 	"github.com/rancher/cluster-api-provider-rke2/pkg/consts"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/secret"
 	bsutil "github.com/rancher/cluster-api-provider-rke2/pkg/util"
 )
 
@@ -95,8 +98,15 @@ type ServerConfig struct {
 	CloudControllerManagerExtraMounts []string `yaml:"cloud-controller-manager-extra-mount,omitempty"`
 	ClusterDNS                        string   `yaml:"cluster-dns,omitempty"`
 	ClusterDomain                     string   `yaml:"cluster-domain,omitempty"`
+	DatastoreCAFile                   string   `yaml:"datastore-cafile,omitempty"`
+	DatastoreCertFile                 string   `yaml:"datastore-certfile,omitempty"`
+	DatastoreEndpoint                 string   `yaml:"datastore-endpoint,omitempty"`
+	DatastoreKeyFile                  string   `yaml:"datastore-keyfile,omitempty"`
+	DisableAPIserver                  bool     `yaml:"disable-apiserver,omitempty"`
 	DisableCloudController            bool     `yaml:"disable-cloud-controller,omitempty"`
 	DisableComponents                 []string `yaml:"disable,omitempty"`
+	DisableControllerManager          bool     `yaml:"disable-controller-manager,omitempty"`
+	DisableEtcd                       bool     `yaml:"disable-etcd,omitempty"`
 	DisableKubeProxy                  bool     `yaml:"disable-kube-proxy,omitempty"`
 	DisableScheduler                  bool     `yaml:"disable-scheduler,omitempty"`
 	EtcdArgs                          []string `yaml:"etcd-arg,omitempty"`
@@ -134,14 +144,16 @@ type ServerConfig struct {
 	TLSSan                            []string `yaml:"tls-san,omitempty"`
 	EmbeddedRegistry                  bool     `yaml:"embedded-registry,omitempty"`
 
+	// DefaultsHash is the hash of the server defaults ConfigMap content merged into the config, it is not written to
+	// the RKE2 config file.
+	DefaultsHash string `yaml:"-"`
+
 	// We don't expose these fields in the API
 	ClusterCIDR string `yaml:"cluster-cidr,omitempty"`
 	ServiceCIDR string `yaml:"service-cidr,omitempty"`
 
 	// Fields below are missing from our API and RKE2 docs
 	AirgapExtraRegistry       string `yaml:"airgap-extra-registry,omitempty"`
-	DisableAPIserver          bool   `yaml:"disable-apiserver,omitempty"`
-	DisableControllerManager  bool   `yaml:"disable-controller-manager,omitempty"`
 	EgressSelectorMode        string `yaml:"egress-selector-mode,omitempty"`
 	EnablePprof               bool   `yaml:"enable-pprof,omitempty"`
 	EnableServiceLoadBalancer bool   `yaml:"enable-servicelb,omitempty"`
@@ -166,6 +178,67 @@ type ServerConfigOpts struct {
 	Version              string
 }
 
+// configureExternalEtcd points RKE2 to the external etcd endpoints and returns the files holding the user supplied
+// etcd CA and client certificate.
+func configureExternalEtcd(opts ServerConfigOpts, serverConfig *ServerConfig) ([]bootstrapv1.File, error) {
+	etcdCASecret := &corev1.Secret{}
+	if err := opts.Client.Get(opts.Ctx, types.NamespacedName{
+		Name:      secret.Name(opts.Cluster.Name, secret.EtcdServerCA),
+		Namespace: opts.Cluster.Namespace,
+	}, etcdCASecret); err != nil {
+		return nil, fmt.Errorf("failed to get external etcd CA secret: %w", err)
+	}
+
+	caCert, ok := etcdCASecret.Data[secret.TLSCrtDataName]
+	if !ok {
+		return nil, fmt.Errorf("external etcd CA secret is missing %s", secret.TLSCrtDataName)
+	}
+
+	clientSecret := &corev1.Secret{}
+	if err := opts.Client.Get(opts.Ctx, types.NamespacedName{
+		Name:      secret.Name(opts.Cluster.Name, secret.APIServerEtcdClient),
+		Namespace: opts.Cluster.Namespace,
+	}, clientSecret); err != nil {
+		return nil, fmt.Errorf("failed to get external etcd client certificate secret: %w", err)
+	}
+
+	clientCert, ok := clientSecret.Data[secret.TLSCrtDataName]
+	if !ok {
+		return nil, fmt.Errorf("external etcd client certificate secret is missing %s", secret.TLSCrtDataName)
+	}
+
+	clientKey, ok := clientSecret.Data[secret.TLSKeyDataName]
+	if !ok {
+		return nil, fmt.Errorf("external etcd client certificate secret is missing %s", secret.TLSKeyDataName)
+	}
+
+	serverConfig.DatastoreEndpoint = strings.Join(opts.ServerConfig.Etcd.External.Endpoints, ",")
+	serverConfig.DatastoreCAFile = "/etc/rancher/rke2/datastore-ca.crt"
+	serverConfig.DatastoreCertFile = "/etc/rancher/rke2/datastore-client.crt"
+	serverConfig.DatastoreKeyFile = "/etc/rancher/rke2/datastore-client.key"
+
+	return []bootstrapv1.File{
+		{
+			Path:        serverConfig.DatastoreCAFile,
+			Content:     string(caCert),
+			Owner:       consts.DefaultFileOwner,
+			Permissions: "0640",
+		},
+		{
+			Path:        serverConfig.DatastoreCertFile,
+			Content:     string(clientCert),
+			Owner:       consts.DefaultFileOwner,
+			Permissions: "0640",
+		},
+		{
+			Path:        serverConfig.DatastoreKeyFile,
+			Content:     string(clientKey),
+			Owner:       consts.DefaultFileOwner,
+			Permissions: "0600",
+		},
+	}, nil
+}
+
 func newRKE2ServerConfig(opts ServerConfigOpts) (*ServerConfig, []bootstrapv1.File, error) { // nolint:gocyclo
 	rke2ServerConfig := &ServerConfig{}
 	files := []bootstrapv1.File{}
@@ -259,6 +332,12 @@ func newRKE2ServerConfig(opts ServerConfigOpts) (*ServerConfig, []bootstrapv1.Fi
 			rke2ServerConfig.DisableScheduler = true
 		case controlplanev1.CloudController:
 			rke2ServerConfig.DisableCloudController = true
+		case controlplanev1.Etcd:
+			rke2ServerConfig.DisableEtcd = true
+		case controlplanev1.APIServer:
+			rke2ServerConfig.DisableAPIserver = true
+		case controlplanev1.ControllerManager:
+			rke2ServerConfig.DisableControllerManager = true
 		}
 	}
 
@@ -338,6 +417,15 @@ func newRKE2ServerConfig(opts ServerConfigOpts) (*ServerConfig, []bootstrapv1.Fi
 		rke2ServerConfig.EtcdExtraEnv = componentMapToSlice(extraEnv, opts.ServerConfig.Etcd.CustomConfig.ExtraEnv)
 	}
 
+	if opts.ServerConfig.Etcd.External != nil {
+		datastoreFiles, err := configureExternalEtcd(opts, rke2ServerConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		files = append(files, datastoreFiles...)
+	}
+
 	rke2ServerConfig.ServiceNodePortRange = opts.ServerConfig.ServiceNodePortRange
 	rke2ServerConfig.TLSSan = append(opts.ServerConfig.TLSSan, opts.ControlPlaneEndpoint)
 
@@ -367,11 +455,124 @@ func newRKE2ServerConfig(opts ServerConfigOpts) (*ServerConfig, []bootstrapv1.Fi
 		rke2ServerConfig.CloudControllerManagerExtraEnv = componentMapToSlice(extraEnv, opts.ServerConfig.CloudControllerManager.ExtraEnv)
 	}
 
+	if opts.ServerConfig.DefaultsConfigMap != nil {
+		defaultsConfigMap, err := getServerDefaultsConfigMap(opts.Ctx, opts.Client, opts.ServerConfig.DefaultsConfigMap)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rke2ServerConfig.KubeAPIServerArgs = mergeDefaultArgs(
+			parseDefaultArgs(defaultsConfigMap.Data[serverDefaultsKubeAPIServerArgKey]), rke2ServerConfig.KubeAPIServerArgs)
+		rke2ServerConfig.KubeControllerManagerArgs = mergeDefaultArgs(
+			parseDefaultArgs(defaultsConfigMap.Data[serverDefaultsKubeControllerManagerArgKey]), rke2ServerConfig.KubeControllerManagerArgs)
+		rke2ServerConfig.KubeSchedulerArgs = mergeDefaultArgs(
+			parseDefaultArgs(defaultsConfigMap.Data[serverDefaultsKubeSchedulerArgKey]), rke2ServerConfig.KubeSchedulerArgs)
+		rke2ServerConfig.EtcdArgs = mergeDefaultArgs(
+			parseDefaultArgs(defaultsConfigMap.Data[serverDefaultsEtcdArgKey]), rke2ServerConfig.EtcdArgs)
+		rke2ServerConfig.DefaultsHash = serverDefaultsHash(defaultsConfigMap)
+	}
+
 	rke2ServerConfig.EmbeddedRegistry = opts.ServerConfig.EmbeddedRegistry
 
 	return rke2ServerConfig, files, nil
 }
 
+const (
+	serverDefaultsKubeAPIServerArgKey         = "kube-apiserver-arg"
+	serverDefaultsKubeControllerManagerArgKey = "kube-controller-manager-arg"
+	serverDefaultsKubeSchedulerArgKey         = "kube-scheduler-arg"
+	serverDefaultsEtcdArgKey                  = "etcd-arg"
+)
+
+// serverDefaultsKeys lists the keys of the server defaults ConfigMap that are merged into the server config.
+var serverDefaultsKeys = []string{
+	serverDefaultsKubeAPIServerArgKey,
+	serverDefaultsKubeControllerManagerArgKey,
+	serverDefaultsKubeSchedulerArgKey,
+	serverDefaultsEtcdArgKey,
+}
+
+func getServerDefaultsConfigMap(ctx context.Context, cl client.Client, ref *corev1.ObjectReference) (*corev1.ConfigMap, error) {
+	defaultsConfigMap := &corev1.ConfigMap{}
+	if err := cl.Get(ctx, types.NamespacedName{
+		Name:      ref.Name,
+		Namespace: ref.Namespace,
+	}, defaultsConfigMap); err != nil {
+		return nil, fmt.Errorf("failed to get server defaults config map: %w", err)
+	}
+
+	return defaultsConfigMap, nil
+}
+
+// ServerDefaultsHash returns a hash of the server args held by the referenced defaults ConfigMap.
+// An empty string is returned when no defaults ConfigMap is referenced.
+func ServerDefaultsHash(ctx context.Context, cl client.Client, ref *corev1.ObjectReference) (string, error) {
+	if ref == nil {
+		return "", nil
+	}
+
+	defaultsConfigMap, err := getServerDefaultsConfigMap(ctx, cl, ref)
+	if err != nil {
+		return "", err
+	}
+
+	return serverDefaultsHash(defaultsConfigMap), nil
+}
+
+// serverDefaultsHash returns a hash of the server args held by the given defaults ConfigMap, so the hash recorded for
+// a server config is computed from the same ConfigMap content that was merged into it.
+func serverDefaultsHash(defaultsConfigMap *corev1.ConfigMap) string {
+	hash := sha256.New()
+
+	for _, key := range serverDefaultsKeys {
+		fmt.Fprintf(hash, "%s=%q\n", key, parseDefaultArgs(defaultsConfigMap.Data[key]))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// parseDefaultArgs splits a newline separated list of args, skipping empty lines.
+func parseDefaultArgs(value string) []string {
+	args := []string{}
+
+	for _, line := range strings.Split(value, "\n") {
+		if arg := strings.TrimSpace(line); arg != "" {
+			args = append(args, arg)
+		}
+	}
+
+	return args
+}
+
+// mergeDefaultArgs merges default args with the configured args. Configured args take precedence,
+// a default arg is dropped when the same flag is already present in args.
+func mergeDefaultArgs(defaults, args []string) []string {
+	if len(defaults) == 0 {
+		return args
+	}
+
+	configured := map[string]bool{}
+	for _, arg := range args {
+		configured[argFlagName(arg)] = true
+	}
+
+	merged := []string{}
+
+	for _, arg := range defaults {
+		if !configured[argFlagName(arg)] {
+			merged = append(merged, arg)
+		}
+	}
+
+	return append(merged, args...)
+}
+
+func argFlagName(arg string) string {
+	name, _, _ := strings.Cut(arg, "=")
+
+	return name
+}
+
 type rke2AgentConfig struct {
 	ContainerRuntimeEndpoint       string   `yaml:"container-runtime-endpoint,omitempty"`
 	CloudProviderConfig            string   `yaml:"cloud-provider-config,omitempty"`
@@ -105,6 +105,7 @@ var _ = Describe("RKE2ServerConfig", func() {
 						controlplanev1.KubeProxy,
 						controlplanev1.Scheduler,
 						controlplanev1.CloudController,
+						controlplanev1.ControllerManager,
 					},
 				},
 				Etcd: controlplanev1.EtcdConfig{
@@ -186,6 +187,8 @@ var _ = Describe("RKE2ServerConfig", func() {
 		Expect(rke2ServerConfig.DisableKubeProxy).To(BeTrue())
 		Expect(rke2ServerConfig.DisableCloudController).To(BeTrue())
 		Expect(rke2ServerConfig.DisableScheduler).To(BeTrue())
+		Expect(rke2ServerConfig.DisableControllerManager).To(BeTrue())
+		Expect(rke2ServerConfig.DisableEtcd).To(BeFalse())
 		// Expect(rke2ServerConfig.EtcdDisableSnapshots).To(BeFalse())
 		Expect(rke2ServerConfig.EtcdExposeMetrics).To(Equal(serverConfig.Etcd.ExposeMetrics))
 		Expect(rke2ServerConfig.EtcdS3).To(BeTrue())
@@ -248,6 +251,159 @@ var _ = Describe("RKE2ServerConfig", func() {
 	})
 })
 
+var _ = Describe("RKE2 server defaults", func() {
+	var (
+		defaultsConfigMap *corev1.ConfigMap
+		defaultsRef       *corev1.ObjectReference
+		opts              ServerConfigOpts
+	)
+
+	BeforeEach(func() {
+		defaultsConfigMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "rke2-server-defaults",
+				Namespace: "test",
+			},
+			Data: map[string]string{
+				"kube-apiserver-arg": "audit-log-maxage=30\nprofiling=false\n",
+				"kube-scheduler-arg": "profiling=false",
+				"etcd-arg":           "quota-backend-bytes=8589934592",
+			},
+		}
+		defaultsRef = &corev1.ObjectReference{
+			Name:      defaultsConfigMap.Name,
+			Namespace: defaultsConfigMap.Namespace,
+		}
+		opts = ServerConfigOpts{
+			Token: "just-a-test-token",
+			Ctx:   context.Background(),
+			ServerConfig: controlplanev1.RKE2ServerConfig{
+				DefaultsConfigMap: defaultsRef,
+				KubeAPIServer: &bootstrapv1.ComponentConfig{
+					ExtraArgs: []string{"profiling=true", "anonymous-auth=false"},
+				},
+				KubeControllerManager: &bootstrapv1.ComponentConfig{
+					ExtraArgs: []string{"terminated-pod-gc-threshold=10"},
+				},
+			},
+		}
+	})
+
+	It("should merge defaults with the lowest precedence", func() {
+		opts.Client = fake.NewClientBuilder().WithObjects(defaultsConfigMap).Build()
+
+		rke2ServerConfig, _, err := GenerateInitControlPlaneConfig(opts)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(rke2ServerConfig.KubeAPIServerArgs).To(Equal([]string{"audit-log-maxage=30", "profiling=true", "anonymous-auth=false"}))
+		Expect(rke2ServerConfig.KubeSchedulerArgs).To(Equal([]string{"profiling=false"}))
+		Expect(rke2ServerConfig.KubeControllerManagerArgs).To(Equal([]string{"terminated-pod-gc-threshold=10"}))
+		Expect(rke2ServerConfig.EtcdArgs).To(Equal([]string{"quota-backend-bytes=8589934592"}))
+
+		// The hash of the merged defaults is recorded with the config, from the same ConfigMap read.
+		hash, err := ServerDefaultsHash(context.Background(), opts.Client, defaultsRef)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rke2ServerConfig.DefaultsHash).To(Equal(hash))
+	})
+
+	It("should fail when the defaults config map is missing", func() {
+		opts.Client = fake.NewClientBuilder().Build()
+
+		_, _, err := GenerateInitControlPlaneConfig(opts)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should change the defaults hash only when the server args change", func() {
+		cl := fake.NewClientBuilder().WithObjects(defaultsConfigMap).Build()
+
+		hash, err := ServerDefaultsHash(context.Background(), cl, defaultsRef)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(hash).ToNot(BeEmpty())
+
+		defaultsConfigMap.Data["unrelated"] = "value"
+		Expect(cl.Update(context.Background(), defaultsConfigMap)).To(Succeed())
+
+		unchangedHash, err := ServerDefaultsHash(context.Background(), cl, defaultsRef)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(unchangedHash).To(Equal(hash))
+
+		defaultsConfigMap.Data["kube-apiserver-arg"] = "audit-log-maxage=60"
+		Expect(cl.Update(context.Background(), defaultsConfigMap)).To(Succeed())
+
+		changedHash, err := ServerDefaultsHash(context.Background(), cl, defaultsRef)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changedHash).ToNot(Equal(hash))
+	})
+
+	It("should return an empty hash without a defaults config map", func() {
+		hash, err := ServerDefaultsHash(context.Background(), fake.NewClientBuilder().Build(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(hash).To(BeEmpty())
+	})
+})
+
+var _ = Describe("RKE2 external etcd", func() {
+	var (
+		etcdCA     *corev1.Secret
+		etcdClient *corev1.Secret
+		opts       ServerConfigOpts
+	)
+
+	BeforeEach(func() {
+		etcdCA = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "test"},
+			Data:       map[string][]byte{"tls.crt": []byte("ca")},
+		}
+		etcdClient = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-apiserver-etcd-client", Namespace: "test"},
+			Data: map[string][]byte{
+				"tls.crt": []byte("cert"),
+				"tls.key": []byte("key"),
+			},
+		}
+		opts = ServerConfigOpts{
+			Cluster: v1beta1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "test"}},
+			Token:   "just-a-test-token",
+			Ctx:     context.Background(),
+			ServerConfig: controlplanev1.RKE2ServerConfig{
+				Etcd: controlplanev1.EtcdConfig{
+					External: &controlplanev1.ExternalEtcd{
+						Endpoints: []string{"https://etcd-0:2379", "https://etcd-1:2379"},
+					},
+				},
+			},
+		}
+	})
+
+	It("should point RKE2 to the external datastore", func() {
+		opts.Client = fake.NewClientBuilder().WithObjects(etcdCA, etcdClient).Build()
+
+		rke2ServerConfig, files, err := GenerateInitControlPlaneConfig(opts)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(rke2ServerConfig.DatastoreEndpoint).To(Equal("https://etcd-0:2379,https://etcd-1:2379"))
+		Expect(rke2ServerConfig.DatastoreCAFile).To(Equal("/etc/rancher/rke2/datastore-ca.crt"))
+		Expect(rke2ServerConfig.DatastoreCertFile).To(Equal("/etc/rancher/rke2/datastore-client.crt"))
+		Expect(rke2ServerConfig.DatastoreKeyFile).To(Equal("/etc/rancher/rke2/datastore-client.key"))
+
+		contents := map[string]string{}
+		for _, file := range files {
+			contents[file.Path] = file.Content
+		}
+
+		Expect(contents).To(HaveKeyWithValue(rke2ServerConfig.DatastoreCAFile, "ca"))
+		Expect(contents).To(HaveKeyWithValue(rke2ServerConfig.DatastoreCertFile, "cert"))
+		Expect(contents).To(HaveKeyWithValue(rke2ServerConfig.DatastoreKeyFile, "key"))
+	})
+
+	It("should fail when the etcd client certificate is missing", func() {
+		opts.Client = fake.NewClientBuilder().WithObjects(etcdCA).Build()
+
+		_, _, err := GenerateInitControlPlaneConfig(opts)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
 var _ = Describe("RKE2 Agent Config", func() {
 	var opts *AgentConfigOpts
 
@@ -19,28 +19,42 @@ package rke2
 import (
 	"context"
 	"sort"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apiserver/pkg/storage/names"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/controllers/external"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/certs"
 	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	capifd "sigs.k8s.io/cluster-api/util/failuredomains"
 	"sigs.k8s.io/cluster-api/util/patch"
 
 	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
 	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/secret"
+	bsutil "github.com/rancher/cluster-api-provider-rke2/pkg/util"
 )
 
+// ErrControlPlaneEndpointChanged is returned when the control plane endpoint of the cluster changed since its workload
+// cluster was built. The workload cluster is dropped and built again on the next call, so the operation is expected to
+// be retried.
+var ErrControlPlaneEndpointChanged = errors.New("control plane endpoint changed")
+
 // ControlPlane holds business logic around control planes.
 // It should never need to connect to a service, that responsibility lies outside of this struct.
 // Going forward we should be trying to add more logic to here and reduce the amount of logic in the reconciler.
@@ -56,8 +70,33 @@ type ControlPlane struct {
 	Rke2Configs    map[string]*bootstrapv1.RKE2Config
 	InfraResources map[string]*unstructured.Unstructured
 
+	// fileContents holds the content of the files of the RCP and machine RKE2Configs which come from a secret.
+	fileContents fileContents
+
+	// AdditionalRolloutMatchers are machine filters evaluated after the built-in RCP configuration checks.
+	// Machines which do not satisfy all of them are rolled out.
+	AdditionalRolloutMatchers []collections.Func
+
+	// RolloutIgnoredRKE2ConfigFields are RKE2ConfigSpec field paths, in the format of the
+	// RKE2ConfigIgnoreFieldsAnnotation, which are ignored when comparing the machines RKE2Config with the RCP in addition
+	// to the ones listed in the annotation. Changing these fields does not roll out the machines, so they drift from the
+	// RCP until they are replaced for another reason.
+	RolloutIgnoredRKE2ConfigFields []string
+
+	// DesiredVersion is the RKE2 version the machines are compared with when the RCP has no version, resolved once per
+	// reconcile from its release channel or runtime image, see ResolveDesiredVersion. Machines are not compared by
+	// version if it is empty.
+	DesiredVersion string
+
 	managementCluster ManagementCluster
 	workloadCluster   WorkloadCluster
+
+	// clusterCertificates are the key pairs of the cluster certificates by purpose, looked up once per reconcile, see
+	// ClusterCertificates.
+	clusterCertificates map[secret.Purpose]*certs.KeyPair
+
+	// workloadClusterEndpoint is the control plane endpoint of the cluster when its workload cluster was built.
+	workloadClusterEndpoint clusterv1.APIEndpoint
 }
 
 // NewControlPlane returns an instantiated ControlPlane.
@@ -79,6 +118,11 @@ func NewControlPlane(
 		return nil, err
 	}
 
+	fileContents, err := getFileContents(ctx, client, rcp, rke2Configs)
+	if err != nil {
+		return nil, err
+	}
+
 	patchHelpers := map[string]*patch.Helper{}
 
 	for name, machine := range ownedMachines {
@@ -101,6 +145,7 @@ func NewControlPlane(
 		machinesPatchHelpers: patchHelpers,
 		Rke2Configs:          rke2Configs,
 		InfraResources:       infraObjects,
+		fileContents:         fileContents,
 		reconciliationTime:   metav1.Now(),
 		managementCluster:    managementCluster,
 	}, nil
@@ -302,7 +347,7 @@ func (c *ControlPlane) MachinesNeedingRollout() collections.Machines {
 	// Return machines if they are scheduled for rollout or if with an outdated configuration.
 	return machines.AnyFilter(
 		// Machines that do not match with RCP config.
-		collections.Not(matchesRCPConfiguration(c.InfraResources, c.Rke2Configs, c.RCP)),
+		collections.Not(matchesRCPConfiguration(c.InfraResources, c.Rke2Configs, c.fileContents, c.rolloutRCP(), c.AdditionalRolloutMatchers...)),
 	)
 }
 
@@ -314,12 +359,72 @@ func (c *ControlPlane) UpToDateMachines() collections.Machines {
 	// Filter machines if they are scheduled for rollout or if with an outdated configuration.
 	machines.AnyFilter(
 		// Machines that do not match with RCP config.
-		collections.Not(matchesRCPConfiguration(c.InfraResources, c.Rke2Configs, c.RCP)),
+		collections.Not(matchesRCPConfiguration(c.InfraResources, c.Rke2Configs, c.fileContents, c.rolloutRCP(), c.AdditionalRolloutMatchers...)),
 	)
 
 	return machines.Difference(c.MachinesNeedingRollout())
 }
 
+// UpdateMachinesUpToDateCondition sets the UpToDate condition on each machine not being deleted, reporting
+// the first RCP configuration check the machine fails as the reason. It also records the number of matching and
+// mismatching machines, by reason, as the rollout decision metrics of the cluster.
+func (c *ControlPlane) UpdateMachinesUpToDateCondition() {
+	matched := 0
+	mismatches := map[string]int{}
+	rcp := c.rolloutRCP()
+
+	for _, machine := range c.Machines.Filter(collections.Not(collections.HasDeletionTimestamp)) {
+		reason := rcpConfigurationMismatchReason(c.InfraResources, c.Rke2Configs, c.fileContents, rcp, machine, c.AdditionalRolloutMatchers...)
+		if reason == "" {
+			conditions.MarkTrue(machine, controlplanev1.MachineUpToDateCondition)
+
+			matched++
+
+			continue
+		}
+
+		conditions.MarkFalse(machine, controlplanev1.MachineUpToDateCondition, reason, clusterv1.ConditionSeverityInfo,
+			"Machine %s does not match the RKE2ControlPlane configuration and requires a rollout", machine.Name)
+
+		mismatches[reason]++
+	}
+
+	if c.Cluster != nil {
+		recordRolloutDecisions(util.ObjectKey(c.Cluster), matched, mismatches)
+	}
+}
+
+// rolloutRCP returns the RCP the machines are compared with to decide whether they need a rollout, i.e. the RCP
+// ignoring the RolloutIgnoredRKE2ConfigFields as well.
+// The RCP is compared with the machines as if its version was the DesiredVersion when it has no version.
+func (c *ControlPlane) rolloutRCP() *controlplanev1.RKE2ControlPlane {
+	rcp := withIgnoredRKE2ConfigFields(c.RCP, c.RolloutIgnoredRKE2ConfigFields)
+	if rcp.Spec.Version != "" || c.DesiredVersion == "" {
+		return rcp
+	}
+
+	if rcp == c.RCP {
+		rcp = c.RCP.DeepCopy()
+	}
+
+	rcp.Spec.Version = c.DesiredVersion
+
+	return rcp
+}
+
+// ResolveDesiredVersion resolves the DesiredVersion of the control plane, using the resolver for release channels.
+// Resolution failures are logged and leave the DesiredVersion empty, so that a channel server outage does not trigger
+// a rollout.
+func (c *ControlPlane) ResolveDesiredVersion(ctx context.Context, resolver ChannelResolver) {
+	version, err := ResolveDesiredVersion(ctx, resolver, c.RCP)
+	if err != nil {
+		log.FromContext(ctx).Info("Skipping version check of machines, the desired version can't be resolved",
+			"channel", c.RCP.Spec.Channel, "runtimeImage", c.RCP.Spec.AgentConfig.RuntimeImage, "reason", err.Error())
+	}
+
+	c.DesiredVersion = version
+}
+
 // GetInfraResources fetches the external infrastructure resource for each machine in the collection
 // and returns a map of machine.Name -> infraResource.
 func GetInfraResources(ctx context.Context, cl client.Client, machines collections.Machines) (map[string]*unstructured.Unstructured, error) {
@@ -341,6 +446,98 @@ func GetInfraResources(ctx context.Context, cl client.Client, machines collectio
 	return result, nil
 }
 
+// InfrastructureTemplateStatus counts the machines of the control plane whose infrastructure machine was cloned from
+// the current infrastructure template of the RCP, and the ones cloned from another template, so the progress of a
+// template rollout can be reported. Machines are matched as by matchesTemplateClonedFrom, so machines whose
+// infrastructure machine is missing or has no cloned-from annotations are counted as up-to-date.
+func (c *ControlPlane) InfrastructureTemplateStatus() *controlplanev1.InfrastructureTemplateStatus {
+	upToDate := c.Machines.Filter(matchesTemplateClonedFrom(c.InfraResources, c.RCP))
+
+	return &controlplanev1.InfrastructureTemplateStatus{
+		Name:             c.RCP.Spec.MachineTemplate.InfrastructureRef.Name,
+		UpToDateReplicas: bsutil.SafeInt32(len(upToDate)),
+		OutdatedReplicas: bsutil.SafeInt32(len(c.Machines) - len(upToDate)),
+	}
+}
+
+// MachinesWithMissingInfrastructureTemplate returns the sorted names of the machines whose infrastructure machine was
+// cloned from an infrastructure template which no longer exists, according to its cloned-from annotations.
+// Infrastructure machines without these annotations, e.g. adopted machines, are ignored. Unlike matchesTemplateClonedFrom
+// this is a diagnostic only: a missing template does not make the machine outdated.
+func MachinesWithMissingInfrastructureTemplate(
+	ctx context.Context,
+	cl client.Client,
+	infraConfigs map[string]*unstructured.Unstructured,
+) ([]string, error) {
+	type templateKey struct {
+		groupKind string
+		key       client.ObjectKey
+	}
+
+	missingTemplates := map[templateKey]bool{}
+	machineNames := []string{}
+
+	for machineName, infraObj := range infraConfigs {
+		clonedFromName, ok1 := infraObj.GetAnnotations()[clusterv1.TemplateClonedFromNameAnnotation]
+		clonedFromGroupKind, ok2 := infraObj.GetAnnotations()[clusterv1.TemplateClonedFromGroupKindAnnotation]
+
+		if !ok1 || !ok2 {
+			continue
+		}
+
+		template := templateKey{
+			groupKind: clonedFromGroupKind,
+			key:       client.ObjectKey{Namespace: infraObj.GetNamespace(), Name: clonedFromName},
+		}
+
+		missing, checked := missingTemplates[template]
+		if !checked {
+			var err error
+
+			missing, err = isTemplateMissing(ctx, cl, schema.ParseGroupKind(template.groupKind), template.key)
+			if err != nil {
+				return nil, err
+			}
+
+			missingTemplates[template] = missing
+		}
+
+		if missing {
+			machineNames = append(machineNames, machineName)
+		}
+	}
+
+	sort.Strings(machineNames)
+
+	return machineNames, nil
+}
+
+// isTemplateMissing returns true if the template of the given kind does not exist, including when the kind itself
+// is no longer served by the API server.
+func isTemplateMissing(ctx context.Context, cl client.Client, groupKind schema.GroupKind, key client.ObjectKey) (bool, error) {
+	mapping, err := cl.RESTMapper().RESTMapping(groupKind)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return true, nil
+		}
+
+		return false, errors.Wrapf(err, "failed to get REST mapping of %s", groupKind)
+	}
+
+	template := &metav1.PartialObjectMetadata{}
+	template.SetGroupVersionKind(mapping.GroupVersionKind)
+
+	if err := cl.Get(ctx, key, template); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+
+		return false, errors.Wrapf(err, "failed to get %s %s", groupKind, key)
+	}
+
+	return false, nil
+}
+
 // GetRKE2Configs fetches the RKE2 config for each machine in the collection and returns a map of machine.Name -> RKE2Config.
 func GetRKE2Configs(ctx context.Context, cl client.Client, machines collections.Machines) (map[string]*bootstrapv1.RKE2Config, error) {
 	result := map[string]*bootstrapv1.RKE2Config{}
@@ -371,9 +568,61 @@ func GetRKE2Configs(ctx context.Context, cl client.Client, machines collections.
 	return result, nil
 }
 
+// fileContents maps the secret file sources to the content of the file.
+type fileContents map[bootstrapv1.SecretFileSource]string
+
+// getFileContents fetches the content of the files of the RCP and of the RKE2Configs which come from a secret. Files
+// whose secret or secret key is missing are left out, as they are not compared when deciding whether a machine
+// requires a rollout.
+func getFileContents(
+	ctx context.Context,
+	cl client.Client,
+	rcp *controlplanev1.RKE2ControlPlane,
+	rke2Configs map[string]*bootstrapv1.RKE2Config,
+) (fileContents, error) {
+	result := fileContents{}
+
+	if rcp == nil {
+		return result, nil
+	}
+
+	specs := []*bootstrapv1.RKE2ConfigSpec{&rcp.Spec.RKE2ConfigSpec}
+	for _, rke2Config := range rke2Configs {
+		specs = append(specs, &rke2Config.Spec)
+	}
+
+	for _, spec := range specs {
+		for _, file := range spec.Files {
+			if file.ContentFrom == nil {
+				continue
+			}
+
+			source := file.ContentFrom.Secret
+			if _, found := result[source]; found {
+				continue
+			}
+
+			fileSecret := &corev1.Secret{}
+			if err := cl.Get(ctx, client.ObjectKey{Name: source.Name, Namespace: rcp.Namespace}, fileSecret); err != nil {
+				if apierrors.IsNotFound(errors.Cause(err)) {
+					continue
+				}
+
+				return nil, errors.Wrapf(err, "failed to retrieve secret %s for file %s", source.Name, file.Path)
+			}
+
+			if content, found := fileSecret.Data[source.Key]; found {
+				result[source] = string(content)
+			}
+		}
+	}
+
+	return result, nil
+}
+
 // IsEtcdManaged returns true if the control plane relies on a managed etcd.
 func (c *ControlPlane) IsEtcdManaged() bool {
-	return true
+	return c.RCP == nil || c.RCP.Spec.ServerConfig.Etcd.External == nil
 }
 
 // MachinesToBeRemediatedByRCP returns the list of control plane machines to be remediated by RCP.
@@ -407,6 +656,7 @@ func (c *ControlPlane) PatchMachines(ctx context.Context) error {
 				controlplanev1.MachineAgentHealthyCondition,
 				controlplanev1.MachineEtcdMemberHealthyCondition,
 				controlplanev1.NodeMetadataUpToDate,
+				controlplanev1.MachineUpToDateCondition,
 			}}); err != nil {
 				if machine.Status.NodeRef != nil {
 					_ = machine.Status.NodeRef.Name
@@ -433,23 +683,116 @@ func (c *ControlPlane) HasHealthyMachineStillProvisioning() bool {
 	return len(c.HealthyMachines().Filter(collections.Not(collections.HasNode()))) > 0
 }
 
+// MachinesStuckProvisioning returns the control plane machines which are not Running longer than the threshold after
+// their creation, so they can be reported or remediated before they block a rollout.
+func (c *ControlPlane) MachinesStuckProvisioning(threshold time.Duration) collections.Machines {
+	return c.Machines.Filter(IsStuckProvisioning(threshold))
+}
+
+// ClusterCertificates returns the key pairs of the cluster certificates by purpose, i.e. the cluster CAs and the etcd
+// certificates used to connect to etcd. They are looked up in one pass the first time they are needed in the
+// reconcile and reused afterwards, e.g. when the workload cluster is built again. Certificates whose secret does not
+// exist are missing from the returned key pairs.
+func (c *ControlPlane) ClusterCertificates(ctx context.Context) (map[secret.Purpose]*certs.KeyPair, error) {
+	if c.clusterCertificates != nil {
+		return c.clusterCertificates, nil
+	}
+
+	keyPairs, err := c.managementCluster.GetClusterCertificates(ctx, client.ObjectKeyFromObject(c.Cluster),
+		c.clusterCertificatePurposes()...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.clusterCertificates = keyPairs
+
+	return keyPairs, nil
+}
+
+// clusterCertificatePurposes returns the purposes of the cluster certificates looked up for the reconcile. The
+// apiserver etcd client certificate is only supplied by the user for an external etcd.
+func (c *ControlPlane) clusterCertificatePurposes() []secret.Purpose {
+	purposes := []secret.Purpose{secret.ClusterCA, secret.ClientClusterCA, secret.EtcdServerCA}
+	if !c.IsEtcdManaged() {
+		purposes = append(purposes, secret.APIServerEtcdClient)
+	}
+
+	return purposes
+}
+
 // GetWorkloadCluster builds a cluster object.
-// The cluster comes with an etcd client generator to connect to any etcd pod living on a managed machine.
+// The cluster comes with an etcd client generator to connect to any etcd pod living on a managed machine,
+// or to the external etcd endpoints when etcd is not managed.
+// The operations changing the etcd cluster are skipped while they are paused by the EtcdOperationsPausedAnnotation.
+// The workload cluster is built once and reused, unless the control plane endpoint of the Cluster of the control plane
+// changed since then, e.g. when the Cluster is refreshed during an endpoint migration: it is then closed and dropped,
+// and an error wrapping ErrControlPlaneEndpointChanged is returned, so that the next call builds it again from the
+// kubeconfig regenerated for the new endpoint.
 func (c *ControlPlane) GetWorkloadCluster(ctx context.Context) (WorkloadCluster, error) {
 	if c.workloadCluster != nil {
+		if endpoint := c.Cluster.Spec.ControlPlaneEndpoint; endpoint != c.workloadClusterEndpoint {
+			return nil, c.dropWorkloadCluster(endpoint)
+		}
+
 		return c.workloadCluster, nil
 	}
 
-	workloadCluster, err := c.managementCluster.GetWorkloadCluster(ctx, client.ObjectKeyFromObject(c.Cluster))
+	var externalEtcd *controlplanev1.ExternalEtcd
+	if !c.IsEtcdManaged() {
+		externalEtcd = c.RCP.Spec.ServerConfig.Etcd.External
+	}
+
+	clusterKey := client.ObjectKeyFromObject(c.Cluster)
+
+	keyPairs, err := c.ClusterCertificates(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	// The workload cluster is built with the certificates already looked up for the reconcile.
+	ctx = withClusterCertificates(ctx, clusterKey, c.clusterCertificatePurposes(), keyPairs)
+
+	workloadCluster, err := c.managementCluster.GetWorkloadCluster(ctx, clusterKey, externalEtcd)
+	if err != nil {
+		return nil, err
+	}
+
+	if EtcdOperationsPaused(c.RCP) {
+		workloadCluster = &etcdPausedWorkloadCluster{WorkloadCluster: workloadCluster}
+	}
+
 	c.workloadCluster = workloadCluster
+	c.workloadClusterEndpoint = c.Cluster.Spec.ControlPlaneEndpoint
 
 	return c.workloadCluster, nil
 }
 
+// dropWorkloadCluster closes and drops the workload cluster built for a previous control plane endpoint, and returns
+// an error wrapping ErrControlPlaneEndpointChanged.
+func (c *ControlPlane) dropWorkloadCluster(endpoint clusterv1.APIEndpoint) error {
+	c.Logger().Info("Control plane endpoint changed, dropping the workload cluster client",
+		"previousEndpoint", c.workloadClusterEndpoint.String(), "endpoint", endpoint.String())
+
+	if err := c.workloadCluster.Close(); err != nil {
+		c.Logger().Error(err, "Failed to close the workload cluster client")
+	}
+
+	previousEndpoint := c.workloadClusterEndpoint
+	c.workloadCluster, c.workloadClusterEndpoint = nil, clusterv1.APIEndpoint{}
+
+	return errors.Wrapf(ErrControlPlaneEndpointChanged, "control plane endpoint of cluster %s changed from %s to %s",
+		c.Cluster.Name, previousEndpoint.String(), endpoint.String())
+}
+
+// Close releases the connections held by the workload cluster of the control plane, if any was built.
+func (c *ControlPlane) Close() error {
+	if c.workloadCluster == nil {
+		return nil
+	}
+
+	return c.workloadCluster.Close()
+}
+
 // machinesByDeletionTimestamp sorts a list of Machines by deletion timestamp, using their names as a tie breaker.
 // Machines without DeletionTimestamp go after machines with this field set.
 type machinesByDeletionTimestamp []*clusterv1.Machine
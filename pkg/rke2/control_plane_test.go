@@ -0,0 +1,223 @@
+package rke2
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/secret"
+)
+
+func TestMachinesWithMissingInfrastructureTemplate(t *testing.T) {
+	g := NewWithT(t)
+
+	templateGVK := schema.GroupVersionKind{
+		Group:   "infrastructure.cluster.x-k8s.io",
+		Version: "v1beta1",
+		Kind:    "DockerMachineTemplate",
+	}
+
+	template := &unstructured.Unstructured{}
+	template.SetGroupVersionKind(templateGVK)
+	template.SetNamespace("default")
+	template.SetName("existing-template")
+
+	infraMachine := func(clonedFrom map[string]string) *unstructured.Unstructured {
+		infraObj := &unstructured.Unstructured{}
+		infraObj.SetNamespace("default")
+		infraObj.SetAnnotations(clonedFrom)
+
+		return infraObj
+	}
+
+	clonedFrom := func(groupKind, name string) map[string]string {
+		return map[string]string{
+			clusterv1.TemplateClonedFromGroupKindAnnotation: groupKind,
+			clusterv1.TemplateClonedFromNameAnnotation:      name,
+		}
+	}
+
+	restMapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{templateGVK.GroupVersion()})
+	restMapper.Add(templateGVK, meta.RESTScopeNamespace)
+
+	cl := fake.NewClientBuilder().WithRESTMapper(restMapper).WithObjects(template).Build()
+
+	infraConfigs := map[string]*unstructured.Unstructured{
+		"up-to-date":    infraMachine(clonedFrom(templateGVK.GroupKind().String(), "existing-template")),
+		"dangling":      infraMachine(clonedFrom(templateGVK.GroupKind().String(), "deleted-template")),
+		"dangling-kind": infraMachine(clonedFrom("AWSMachineTemplate.infrastructure.cluster.x-k8s.io", "some-template")),
+		"adopted":       infraMachine(nil),
+	}
+
+	machineNames, err := MachinesWithMissingInfrastructureTemplate(context.Background(), cl, infraConfigs)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(machineNames).To(Equal([]string{"dangling", "dangling-kind"}))
+
+	// A dangling reference does not make the machine outdated.
+	danglingRCP := rcp.DeepCopy()
+	danglingRCP.Spec.MachineTemplate.InfrastructureRef.Kind = templateGVK.Kind
+	danglingRCP.Spec.MachineTemplate.InfrastructureRef.APIVersion = templateGVK.GroupVersion().String()
+	danglingRCP.Spec.MachineTemplate.InfrastructureRef.Name = "deleted-template"
+
+	danglingMachine := machine.DeepCopy()
+	danglingMachine.Name = "dangling"
+
+	g.Expect(matchesTemplateClonedFrom(infraConfigs, danglingRCP)(danglingMachine)).To(BeTrue())
+}
+
+func TestInfrastructureTemplateStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	infraMachine := func(templateName string) *unstructured.Unstructured {
+		infraObj := &unstructured.Unstructured{}
+		infraObj.SetAnnotations(map[string]string{
+			clusterv1.TemplateClonedFromGroupKindAnnotation: "DockerMachineTemplate.infrastructure.cluster.x-k8s.io",
+			clusterv1.TemplateClonedFromNameAnnotation:      templateName,
+		})
+
+		return infraObj
+	}
+
+	templateRCP := &controlplanev1.RKE2ControlPlane{}
+	templateRCP.Spec.MachineTemplate.InfrastructureRef = corev1.ObjectReference{
+		APIVersion: "infrastructure.cluster.x-k8s.io/v1beta1",
+		Kind:       "DockerMachineTemplate",
+		Name:       "template-v2",
+	}
+
+	machines := collections.Machines{}
+	for _, name := range []string{"machine-1", "machine-2", "machine-3", "machine-4", "machine-5"} {
+		machines.Insert(&clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+
+	c := &ControlPlane{
+		RCP:      templateRCP,
+		Machines: machines,
+		InfraResources: map[string]*unstructured.Unstructured{
+			"machine-1": infraMachine("template-v2"),
+			"machine-2": infraMachine("template-v2"),
+			"machine-3": infraMachine("template-v1"),
+			"machine-4": infraMachine("template-v1"),
+			// The infrastructure machine of machine-5 is missing, so it is not considered outdated.
+		},
+	}
+
+	g.Expect(c.InfrastructureTemplateStatus()).To(Equal(&controlplanev1.InfrastructureTemplateStatus{
+		Name:             "template-v2",
+		UpToDateReplicas: 3,
+		OutdatedReplicas: 2,
+	}))
+}
+
+// endpointManagementCluster is a ManagementCluster building fake workload clusters.
+type endpointManagementCluster struct {
+	ManagementCluster
+	workloadClusters        []*closingWorkloadCluster
+	certificateLookups      int
+	workloadClusterKeyPairs []map[secret.Purpose]*certs.KeyPair
+}
+
+func (m *endpointManagementCluster) GetClusterCertificates(
+	context.Context,
+	client.ObjectKey,
+	...secret.Purpose,
+) (map[secret.Purpose]*certs.KeyPair, error) {
+	m.certificateLookups++
+
+	return map[secret.Purpose]*certs.KeyPair{secret.EtcdServerCA: {Cert: []byte("etcd-cert")}}, nil
+}
+
+func (m *endpointManagementCluster) GetWorkloadCluster(
+	ctx context.Context,
+	clusterKey client.ObjectKey,
+	_ *controlplanev1.ExternalEtcd,
+) (WorkloadCluster, error) {
+	keyPairs, missing := reconcileClusterCertificates(ctx, clusterKey, []secret.Purpose{secret.EtcdServerCA})
+	if len(missing) == 0 {
+		m.workloadClusterKeyPairs = append(m.workloadClusterKeyPairs, keyPairs)
+	}
+
+	workloadCluster := &closingWorkloadCluster{}
+	m.workloadClusters = append(m.workloadClusters, workloadCluster)
+
+	return workloadCluster, nil
+}
+
+// closingWorkloadCluster is a WorkloadCluster recording whether it was closed.
+type closingWorkloadCluster struct {
+	WorkloadCluster
+	closed bool
+}
+
+func (w *closingWorkloadCluster) Close() error {
+	w.closed = true
+
+	return nil
+}
+
+func TestGetWorkloadClusterControlPlaneEndpointChange(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+		Spec: clusterv1.ClusterSpec{
+			ControlPlaneEndpoint: clusterv1.APIEndpoint{Host: "10.0.0.10", Port: 6443},
+		},
+	}
+
+	managementCluster := &endpointManagementCluster{}
+
+	c := &ControlPlane{
+		RCP:               &controlplanev1.RKE2ControlPlane{},
+		Cluster:           cluster,
+		managementCluster: managementCluster,
+	}
+
+	workloadCluster, err := c.GetWorkloadCluster(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(managementCluster.workloadClusters).To(HaveLen(1))
+
+	// The workload cluster is reused while the endpoint does not change.
+	reused, err := c.GetWorkloadCluster(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(reused).To(BeIdenticalTo(workloadCluster))
+	g.Expect(managementCluster.workloadClusters).To(HaveLen(1))
+
+	// The endpoint of the Cluster is migrated to a load balancer.
+	cluster.Spec.ControlPlaneEndpoint = clusterv1.APIEndpoint{Host: "lb.example.com", Port: 6443}
+
+	_, err = c.GetWorkloadCluster(ctx)
+	g.Expect(err).To(MatchError(ErrControlPlaneEndpointChanged))
+	g.Expect(err.Error()).To(ContainSubstring("lb.example.com:6443"))
+	g.Expect(managementCluster.workloadClusters[0].closed).To(BeTrue())
+
+	// The retry builds a workload cluster for the new endpoint.
+	rebuilt, err := c.GetWorkloadCluster(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(managementCluster.workloadClusters).To(HaveLen(2))
+	g.Expect(rebuilt).To(BeIdenticalTo(managementCluster.workloadClusters[1]))
+	g.Expect(c.workloadClusterEndpoint.Host).To(Equal("lb.example.com"))
+
+	reused, err = c.GetWorkloadCluster(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(reused).To(BeIdenticalTo(rebuilt))
+
+	// The certificates are looked up once for the reconcile and passed on to every workload cluster build.
+	g.Expect(managementCluster.certificateLookups).To(Equal(1))
+	g.Expect(managementCluster.workloadClusterKeyPairs).To(HaveLen(2))
+	g.Expect(managementCluster.workloadClusterKeyPairs[1][secret.EtcdServerCA].Cert).To(Equal([]byte("etcd-cert")))
+}
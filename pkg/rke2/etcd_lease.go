@@ -0,0 +1,142 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/utils/ptr"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// EtcdOperationLeaseDuration is how long the etcd operation lease is held without being released,
+	// after which it can be taken over, e.g. when the controller crashed during the operation.
+	EtcdOperationLeaseDuration = 2 * time.Minute
+
+	etcdOperationLeaseSuffix = "-etcd-operation"
+)
+
+// ErrEtcdOperationInProgress is returned when acquiring the etcd operation lease of a cluster which is already held.
+var ErrEtcdOperationInProgress = errors.New("another etcd operation is in progress")
+
+// ReleaseFunc releases a lease acquired from the management cluster.
+type ReleaseFunc func(ctx context.Context) error
+
+// AcquireEtcdOperationLease acquires the Lease serializing the destructive etcd operations of the workload cluster,
+// e.g. member removal or leadership forwarding, across reconciles and controller replicas. The Lease is created next
+// to the Cluster and expires after EtcdOperationLeaseDuration if it is not released. An error wrapping
+// ErrEtcdOperationInProgress is returned when the Lease is held by another caller.
+func (m *Management) AcquireEtcdOperationLease(ctx context.Context, clusterKey ctrlclient.ObjectKey) (ReleaseFunc, error) {
+	return acquireLease(ctx, m.Client, ctrlclient.ObjectKey{
+		Namespace: clusterKey.Namespace,
+		Name:      clusterKey.Name + etcdOperationLeaseSuffix,
+	}, EtcdOperationLeaseDuration, time.Now)
+}
+
+func acquireLease(
+	ctx context.Context,
+	cl ctrlclient.Client,
+	key ctrlclient.ObjectKey,
+	duration time.Duration,
+	now func() time.Time,
+) (ReleaseFunc, error) {
+	holder := leaseHolderIdentity()
+	acquireTime := metav1.NewMicroTime(now())
+
+	lease := &coordinationv1.Lease{}
+	if err := cl.Get(ctx, key, lease); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "failed to get lease %s", key)
+		}
+
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+		}
+		setLeaseHolder(lease, holder, acquireTime, duration)
+
+		if err := cl.Create(ctx, lease); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				return nil, errors.Wrapf(ErrEtcdOperationInProgress, "lease %s was acquired concurrently", key)
+			}
+
+			return nil, errors.Wrapf(err, "failed to create lease %s", key)
+		}
+	} else {
+		if lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity != "" && !leaseExpired(lease, now()) {
+			return nil, errors.Wrapf(ErrEtcdOperationInProgress, "lease %s is held by %s", key, *lease.Spec.HolderIdentity)
+		}
+
+		// The update fails with a conflict if another caller takes over the lease concurrently.
+		setLeaseHolder(lease, holder, acquireTime, duration)
+
+		if err := cl.Update(ctx, lease); err != nil {
+			if apierrors.IsConflict(err) {
+				return nil, errors.Wrapf(ErrEtcdOperationInProgress, "lease %s was acquired concurrently", key)
+			}
+
+			return nil, errors.Wrapf(err, "failed to acquire lease %s", key)
+		}
+	}
+
+	log.FromContext(ctx).V(4).Info("Acquired lease", "lease", key, "holder", holder)
+
+	resourceVersion := lease.ResourceVersion
+
+	return func(ctx context.Context) error {
+		// The lease is only deleted if it was not taken over after expiring.
+		err := cl.Delete(ctx, lease, ctrlclient.Preconditions{ResourceVersion: &resourceVersion})
+		if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+			return errors.Wrapf(err, "failed to release lease %s", key)
+		}
+
+		return nil
+	}, nil
+}
+
+func setLeaseHolder(lease *coordinationv1.Lease, holder string, acquireTime metav1.MicroTime, duration time.Duration) {
+	lease.Spec.HolderIdentity = ptr.To(holder)
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(duration.Seconds()))
+	lease.Spec.AcquireTime = &acquireTime
+	lease.Spec.RenewTime = &acquireTime
+}
+
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+
+	return now.After(lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+// leaseHolderIdentity returns a holder identity unique to the caller, prefixed with the controller hostname.
+func leaseHolderIdentity() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return hostname + "_" + rand.String(8)
+}
@@ -0,0 +1,101 @@
+package rke2
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAcquireEtcdOperationLease(t *testing.T) {
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "cluster"}
+	leaseKey := client.ObjectKey{Namespace: "default", Name: "cluster-etcd-operation"}
+
+	t.Run("only one of concurrent callers acquires the lease", func(t *testing.T) {
+		g := NewWithT(t)
+
+		m := &Management{Client: fake.NewClientBuilder().Build()}
+
+		const callers = 5
+
+		var (
+			wg       sync.WaitGroup
+			mu       sync.Mutex
+			acquired int
+			errs     []error
+		)
+
+		for range callers {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, err := m.AcquireEtcdOperationLease(context.Background(), clusterKey)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				if err == nil {
+					acquired++
+				} else {
+					errs = append(errs, err)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		g.Expect(acquired).To(Equal(1))
+		g.Expect(errs).To(HaveLen(callers - 1))
+
+		for _, err := range errs {
+			g.Expect(err).To(MatchError(ErrEtcdOperationInProgress))
+		}
+	})
+
+	t.Run("the lease can be acquired again once released", func(t *testing.T) {
+		g := NewWithT(t)
+
+		m := &Management{Client: fake.NewClientBuilder().Build()}
+
+		release, err := m.AcquireEtcdOperationLease(context.Background(), clusterKey)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = m.AcquireEtcdOperationLease(context.Background(), clusterKey)
+		g.Expect(err).To(MatchError(ErrEtcdOperationInProgress))
+
+		g.Expect(release(context.Background())).To(Succeed())
+		g.Expect(apierrors.IsNotFound(m.Client.Get(context.Background(), leaseKey, &coordinationv1.Lease{}))).To(BeTrue())
+
+		_, err = m.AcquireEtcdOperationLease(context.Background(), clusterKey)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+
+	t.Run("an expired lease is taken over and not released by its previous holder", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cl := fake.NewClientBuilder().Build()
+		now := time.Now()
+
+		crashedRelease, err := acquireLease(context.Background(), cl, leaseKey, time.Minute, func() time.Time {
+			return now.Add(-2 * time.Minute)
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = acquireLease(context.Background(), cl, leaseKey, time.Minute, func() time.Time { return now })
+		g.Expect(err).ToNot(HaveOccurred())
+
+		g.Expect(crashedRelease(context.Background())).To(Succeed())
+
+		lease := &coordinationv1.Lease{}
+		g.Expect(cl.Get(context.Background(), leaseKey, lease)).To(Succeed())
+		g.Expect(lease.Spec.RenewTime.Time).To(BeTemporally("~", now, time.Second))
+	})
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"time"
+
+	"github.com/blang/semver/v4"
+	"github.com/pkg/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+)
+
+// ErrEtcdOperationsPaused is returned by the etcd operations of a workload cluster which can't be skipped without
+// blocking the caller, e.g. the removal of the etcd member of a deleted machine, while the etcd operations are paused.
+var ErrEtcdOperationsPaused = errors.New("etcd operations are paused")
+
+// EtcdOperationsPaused returns true if the etcd operations of the control plane are paused by the
+// EtcdOperationsPausedAnnotation.
+func EtcdOperationsPaused(rcp *controlplanev1.RKE2ControlPlane) bool {
+	return rcp.GetAnnotations()[controlplanev1.EtcdOperationsPausedAnnotation] == "true"
+}
+
+// etcdPausedWorkloadCluster is a WorkloadCluster whose operations changing the etcd cluster are skipped, so an operator
+// can perform a manual maintenance of etcd without the controller interfering. The operations reading the etcd status
+// are not affected.
+type etcdPausedWorkloadCluster struct {
+	WorkloadCluster
+}
+
+// ReconcileEtcdMembers does not remove any etcd member while the etcd operations are paused.
+func (w *etcdPausedWorkloadCluster) ReconcileEtcdMembers(ctx context.Context, _ []string, _ semver.Version) ([]string, error) {
+	log.FromContext(ctx).Info("Skipping etcd members reconciliation, etcd operations are paused")
+
+	return nil, nil
+}
+
+// ReconcileEtcdPeerURLs does not update any etcd member peer URL while the etcd operations are paused.
+func (w *etcdPausedWorkloadCluster) ReconcileEtcdPeerURLs(ctx context.Context) ([]string, error) {
+	log.FromContext(ctx).Info("Skipping etcd peer URLs reconciliation, etcd operations are paused")
+
+	return nil, nil
+}
+
+// ClearEtcdAlarms does not disarm any etcd alarm while the etcd operations are paused.
+func (w *etcdPausedWorkloadCluster) ClearEtcdAlarms(ctx context.Context, _ ClearEtcdAlarmsOptions) ([]etcd.MemberAlarm, error) {
+	log.FromContext(ctx).Info("Skipping etcd alarms clearing, etcd operations are paused")
+
+	return nil, nil
+}
+
+// CompactEtcd does not compact the etcd history while the etcd operations are paused.
+func (w *etcdPausedWorkloadCluster) CompactEtcd(ctx context.Context, _ int64) (int64, error) {
+	log.FromContext(ctx).Info("Skipping etcd history compaction, etcd operations are paused")
+
+	return 0, nil
+}
+
+// DefragmentEtcd does not defragment any etcd member while the etcd operations are paused.
+func (w *etcdPausedWorkloadCluster) DefragmentEtcd(ctx context.Context, _ int64) ([]string, error) {
+	log.FromContext(ctx).Info("Skipping etcd defragmentation, etcd operations are paused")
+
+	return nil, nil
+}
+
+// EvacuateEtcdLearnerOnFailure does not remove any etcd learner while the etcd operations are paused.
+func (w *etcdPausedWorkloadCluster) EvacuateEtcdLearnerOnFailure(
+	ctx context.Context,
+	_ collections.Machines,
+	_ time.Duration,
+) ([]string, error) {
+	log.FromContext(ctx).Info("Skipping etcd learners evacuation, etcd operations are paused")
+
+	return nil, nil
+}
+
+// RemoveEtcdMemberForMachine returns an error wrapping ErrEtcdOperationsPaused, rather than skipping the removal, so the
+// machine is not deleted while its etcd member is still part of the cluster.
+func (w *etcdPausedWorkloadCluster) RemoveEtcdMemberForMachine(ctx context.Context, machine *clusterv1.Machine) error {
+	if machine == nil {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Skipping etcd member removal, etcd operations are paused", "machine", machine.Name)
+
+	return errors.Wrapf(ErrEtcdOperationsPaused, "failed to remove etcd member of machine %s", machine.Name)
+}
+
+// ForwardEtcdLeadership returns an error wrapping ErrEtcdOperationsPaused, rather than skipping the move, so the leader
+// machine is not deleted while it still holds the etcd leadership.
+func (w *etcdPausedWorkloadCluster) ForwardEtcdLeadership(
+	ctx context.Context,
+	machine *clusterv1.Machine,
+	_ *clusterv1.Machine,
+) error {
+	if machine == nil {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Skipping etcd leadership forwarding, etcd operations are paused", "machine", machine.Name)
+
+	return errors.Wrapf(ErrEtcdOperationsPaused, "failed to forward etcd leadership of machine %s", machine.Name)
+}
+
+// ReplaceEtcdMember returns an error wrapping ErrEtcdOperationsPaused, rather than reporting the replacement as pending,
+// so the caller does not wait for a replacement which does not progress.
+func (w *etcdPausedWorkloadCluster) ReplaceEtcdMember(
+	ctx context.Context,
+	oldMachine *clusterv1.Machine,
+	_ *clusterv1.Machine,
+) (bool, error) {
+	if oldMachine == nil {
+		return true, nil
+	}
+
+	log.FromContext(ctx).Info("Skipping etcd member replacement, etcd operations are paused", "machine", oldMachine.Name)
+
+	return false, errors.Wrapf(ErrEtcdOperationsPaused, "failed to replace etcd member of machine %s", oldMachine.Name)
+}
@@ -0,0 +1,113 @@
+package rke2
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blang/semver/v4"
+	. "github.com/onsi/gomega"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	etcdfake "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/fake"
+)
+
+func TestEtcdOperationsPaused(t *testing.T) {
+	g := NewWithT(t)
+
+	pausedRCP := &controlplanev1.RKE2ControlPlane{}
+	g.Expect(EtcdOperationsPaused(pausedRCP)).To(BeFalse())
+
+	pausedRCP.Annotations = map[string]string{controlplanev1.EtcdOperationsPausedAnnotation: "false"}
+	g.Expect(EtcdOperationsPaused(pausedRCP)).To(BeFalse())
+
+	pausedRCP.Annotations[controlplanev1.EtcdOperationsPausedAnnotation] = "true"
+	g.Expect(EtcdOperationsPaused(pausedRCP)).To(BeTrue())
+}
+
+func TestEtcdPausedWorkloadCluster(t *testing.T) {
+	g := NewWithT(t)
+
+	controlPlaneNode := func(name string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{labelNodeRoleControlPlane: "true"},
+			},
+		}
+	}
+
+	fakeEtcdClient := &etcdfake.FakeEtcdClient{
+		MemberListResponse: &clientv3.MemberListResponse{
+			Members: []*pb.Member{
+				{Name: "cp1", ID: uint64(1)},
+				{Name: "cp2", ID: uint64(2)},
+				{Name: "cp3", ID: uint64(3)},
+			},
+		},
+		AlarmResponse: &clientv3.AlarmResponse{
+			Alarms: []*pb.AlarmMember{{MemberID: uint64(1), Alarm: pb.AlarmType_NOSPACE}},
+		},
+	}
+
+	w := &etcdPausedWorkloadCluster{
+		WorkloadCluster: &Workload{
+			Client: fake.NewClientBuilder().WithObjects(controlPlaneNode("cp1"), controlPlaneNode("cp2")).Build(),
+			etcdClientGenerator: &fakeEtcdClientGenerator{
+				forNodesClient:  &etcd.Client{EtcdClient: fakeEtcdClient},
+				forLeaderClient: &etcd.Client{EtcdClient: fakeEtcdClient},
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	// The operations changing etcd are skipped.
+	removed, err := w.ReconcileEtcdMembers(ctx, []string{"cp1", "cp2"}, semver.MustParse("1.30.0"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(removed).To(BeEmpty())
+	g.Expect(fakeEtcdClient.RemovedMember).To(BeZero())
+
+	alarms, err := w.ClearEtcdAlarms(ctx, ClearEtcdAlarmsOptions{Force: true})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(alarms).To(BeEmpty())
+	g.Expect(fakeEtcdClient.DisarmedAlarms).To(BeEmpty())
+
+	compacted, err := w.CompactEtcd(ctx, 0)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(compacted).To(BeZero())
+	g.Expect(fakeEtcdClient.CompactedRevision).To(BeZero())
+
+	defragmented, err := w.DefragmentEtcd(ctx, 0)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(defragmented).To(BeEmpty())
+	g.Expect(fakeEtcdClient.DefragmentedEndpoints).To(BeEmpty())
+
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "machine-cp3"},
+		Status:     clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "cp3"}},
+	}
+	g.Expect(w.RemoveEtcdMemberForMachine(ctx, machine)).To(MatchError(ErrEtcdOperationsPaused))
+	g.Expect(w.ForwardEtcdLeadership(ctx, machine, &clusterv1.Machine{})).To(MatchError(ErrEtcdOperationsPaused))
+
+	replaced, err := w.ReplaceEtcdMember(ctx, machine, &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "machine-cp4"},
+		Status:     clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "cp4"}},
+	})
+	g.Expect(err).To(MatchError(ErrEtcdOperationsPaused))
+	g.Expect(replaced).To(BeFalse())
+	g.Expect(fakeEtcdClient.AddedLearnerPeerURLs).To(BeEmpty())
+	g.Expect(fakeEtcdClient.RemovedMember).To(BeZero())
+	g.Expect(fakeEtcdClient.MovedLeader).To(BeZero())
+
+	// The operations reading etcd proceed.
+	members, err := w.EtcdMembers(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(members).To(ConsistOf("cp1", "cp2", "cp3"))
+}
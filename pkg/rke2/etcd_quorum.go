@@ -0,0 +1,186 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	etcdutil "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/util"
+)
+
+// MachineRemovalSafety is the projection of the control plane after the removal of a machine.
+type MachineRemovalSafety struct {
+	// Safe is true if the machine can be removed without leaving the cluster without control plane machines
+	// or the etcd cluster without quorum.
+	Safe bool
+
+	// Reason explains why the machine can't be safely removed, it is empty if the removal is safe.
+	Reason string
+
+	// TargetVoters is the number of voting etcd members left after the removal.
+	TargetVoters int
+
+	// TargetHealthyVoters is the number of voting etcd members left after the removal whose machine reports
+	// the etcd member as healthy.
+	TargetHealthyVoters int
+
+	// TargetQuorum is the number of voting etcd members required for quorum after the removal.
+	TargetQuorum int
+}
+
+// CanSafelyRemoveMachine projects the control plane after the removal of the machine, and reports whether at least
+// one machine hosting the API server, one machine hosting etcd and a quorum of healthy etcd voting members are left.
+// The machines are the cluster machines, as returned by GetMachinesForCluster, and the members are the etcd members,
+// as returned by EtcdLearnerStatus. Only machines hosting etcd are counted in the etcd quorum, so removing a
+// control-plane-only machine never affects it, and learners are not counted as voters, so removing a learner never
+// affects it either. A member without a corresponding etcd machine is considered unhealthy. Worker machines are
+// ignored.
+func CanSafelyRemoveMachine(
+	machines collections.Machines,
+	members []EtcdLearnerStatus,
+	machine *clusterv1.Machine,
+) MachineRemovalSafety {
+	remainingMachines := machines.
+		Filter(IsControlPlaneMachine, collections.Not(collections.HasDeletionTimestamp)).
+		Filter(func(m *clusterv1.Machine) bool { return m.Name != machine.Name })
+	if remainingMachines.Len() == 0 {
+		return MachineRemovalSafety{Reason: "it is the last control plane machine"}
+	}
+
+	roles := MachineNodeRoles(machine)
+
+	if roles.ControlPlane && remainingMachines.Filter(HasControlPlaneRole()).Len() == 0 {
+		return MachineRemovalSafety{Reason: "it is the last control plane machine hosting the API server"}
+	}
+
+	if !roles.Etcd {
+		// Removing a control-plane-only machine does not change the quorum.
+		return MachineRemovalSafety{Safe: true}
+	}
+
+	if remainingMachines.Filter(HasEtcdRole()).Len() == 0 {
+		return MachineRemovalSafety{Reason: "it is the last control plane machine hosting etcd"}
+	}
+
+	if len(members) == 0 {
+		return MachineRemovalSafety{Reason: "no etcd member was found to assess the etcd quorum"}
+	}
+
+	etcdMachines := machines.Filter(IsControlPlaneMachine, HasEtcdRole())
+
+	safety := MachineRemovalSafety{}
+
+	for _, member := range members {
+		nodeName := etcdutil.NodeNameFromMember(&etcd.Member{Name: member.Name})
+
+		if machine.Status.NodeRef != nil && machine.Status.NodeRef.Name == nodeName {
+			if !member.IsPromoted {
+				// Removing a learner does not change the quorum.
+				return MachineRemovalSafety{Safe: true}
+			}
+
+			continue
+		}
+
+		if !member.IsPromoted {
+			continue
+		}
+
+		safety.TargetVoters++
+
+		for _, m := range etcdMachines {
+			if m.Status.NodeRef != nil && m.Status.NodeRef.Name == nodeName &&
+				conditions.IsTrue(m, controlplanev1.MachineEtcdMemberHealthyCondition) {
+				safety.TargetHealthyVoters++
+
+				break
+			}
+		}
+	}
+
+	// See https://etcd.io/docs/v3.3/faq/#what-is-failure-tolerance for fault tolerance formula explanation.
+	safety.TargetQuorum = (safety.TargetVoters / 2) + 1 //nolint:mnd
+	safety.Safe = safety.TargetVoters > 0 && safety.TargetHealthyVoters >= safety.TargetQuorum
+
+	if !safety.Safe {
+		safety.Reason = fmt.Sprintf("%d healthy etcd voting members would be left out of %d, while %d are required for quorum",
+			safety.TargetHealthyVoters, safety.TargetVoters, safety.TargetQuorum)
+	}
+
+	return safety
+}
+
+// RolloutMaxUnavailable returns the number of outdated control plane machines that can be deleted at the same time
+// during a rolling update, along with the number requested by the rolling update strategy of the RKE2ControlPlane.
+// The requested number defaults to 1, percentages are of the desired replicas rounded down, and it is at least 1.
+// The effective number is capped to the failure tolerance of the etcd cluster reported in the status, i.e. the number
+// of healthy voting members above the quorum, so that deleting machines never breaks the quorum. Learners are not
+// voting members, and stale members are voting members which are not healthy. It is never lower than 1 so that
+// rollouts can progress, the preflight checks holding the deletion while the control plane is unhealthy. It is 1 when
+// the etcd members are not known yet, and not capped when etcd is external.
+func RolloutMaxUnavailable(rcp *controlplanev1.RKE2ControlPlane) (effective int, requested int) {
+	requested = 1
+
+	if rcp.Spec.RolloutStrategy != nil && rcp.Spec.RolloutStrategy.RollingUpdate != nil &&
+		rcp.Spec.RolloutStrategy.RollingUpdate.MaxUnavailable != nil {
+		replicas := 1
+		if rcp.Spec.Replicas != nil {
+			replicas = int(*rcp.Spec.Replicas)
+		}
+
+		if value, err := intstr.GetScaledValueFromIntOrPercent(
+			rcp.Spec.RolloutStrategy.RollingUpdate.MaxUnavailable, replicas, false); err == nil {
+			requested = max(value, 1)
+		}
+	}
+
+	if rcp.Spec.ServerConfig.Etcd.External != nil {
+		return requested, requested
+	}
+
+	if rcp.Status.Etcd == nil || len(rcp.Status.Etcd.Members) == 0 {
+		return 1, requested
+	}
+
+	voters, healthyVoters := 0, 0
+
+	for _, member := range rcp.Status.Etcd.Members {
+		if member.IsLearner {
+			continue
+		}
+
+		voters++
+
+		if !member.Stale {
+			healthyVoters++
+		}
+	}
+
+	// See https://etcd.io/docs/v3.3/faq/#what-is-failure-tolerance for fault tolerance formula explanation.
+	quorum := (voters / 2) + 1 //nolint:mnd
+	tolerance := healthyVoters - quorum
+
+	return min(requested, max(tolerance, 1)), requested
+}
@@ -0,0 +1,333 @@
+package rke2
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+func TestCanSafelyRemoveMachine(t *testing.T) {
+	// controlPlaneMachine returns the machine hosting the node-<i> etcd member.
+	controlPlaneMachine := func(i int, etcdHealthy bool) *clusterv1.Machine {
+		machine := &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   fmt.Sprintf("machine-%d", i),
+				Labels: ControlPlaneLabelsForCluster("cluster"),
+			},
+			Spec:   clusterv1.MachineSpec{ClusterName: "cluster"},
+			Status: clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: fmt.Sprintf("node-%d", i)}},
+		}
+
+		if etcdHealthy {
+			conditions.MarkTrue(machine, controlplanev1.MachineEtcdMemberHealthyCondition)
+		} else {
+			conditions.MarkFalse(machine, controlplanev1.MachineEtcdMemberHealthyCondition,
+				controlplanev1.EtcdMemberInspectionFailedReason, clusterv1.ConditionSeverityError, "")
+		}
+
+		return machine
+	}
+
+	// cluster returns the machines and etcd members of a control plane, with the given health per machine
+	// and the machines with the given indexes hosting learners.
+	cluster := func(healthy []bool, learners ...int) (collections.Machines, []EtcdLearnerStatus) {
+		machines := collections.New()
+		members := []EtcdLearnerStatus{}
+
+		for i, etcdHealthy := range healthy {
+			machines.Insert(controlPlaneMachine(i, etcdHealthy))
+			members = append(members, EtcdLearnerStatus{
+				Name:       fmt.Sprintf("node-%d-1a2b3c4d", i),
+				ID:         uint64(i + 1),
+				IsPromoted: true,
+			})
+		}
+
+		for _, i := range learners {
+			members[i].IsPromoted = false
+		}
+
+		return machines, members
+	}
+
+	tests := []struct {
+		name         string
+		healthy      []bool
+		learners     []int
+		remove       int
+		expectSafe   bool
+		expectVoters int
+		expectQuorum int
+	}{
+		{
+			name:         "3 nodes: removing a healthy machine leaves 2 healthy voters",
+			healthy:      []bool{true, true, true},
+			remove:       0,
+			expectSafe:   true,
+			expectVoters: 2,
+			expectQuorum: 2,
+		},
+		{
+			name:         "3 nodes: removing a healthy machine with another unhealthy loses quorum",
+			healthy:      []bool{true, true, false},
+			remove:       0,
+			expectVoters: 2,
+			expectQuorum: 2,
+		},
+		{
+			name:         "3 nodes: removing the unhealthy machine keeps quorum",
+			healthy:      []bool{true, true, false},
+			remove:       2,
+			expectSafe:   true,
+			expectVoters: 2,
+			expectQuorum: 2,
+		},
+		{
+			name:         "5 nodes: removing a healthy machine with another unhealthy keeps quorum",
+			healthy:      []bool{true, true, true, true, false},
+			remove:       0,
+			expectSafe:   true,
+			expectVoters: 4,
+			expectQuorum: 3,
+		},
+		{
+			name:         "5 nodes: removing a healthy machine with two others unhealthy loses quorum",
+			healthy:      []bool{true, true, true, false, false},
+			remove:       0,
+			expectVoters: 4,
+			expectQuorum: 3,
+		},
+		{
+			name:         "5 nodes: removing an unhealthy machine with another unhealthy keeps quorum",
+			healthy:      []bool{true, true, true, false, false},
+			remove:       4,
+			expectSafe:   true,
+			expectVoters: 4,
+			expectQuorum: 3,
+		},
+		{
+			name:         "learners are not counted as voters",
+			healthy:      []bool{true, true, true, true},
+			learners:     []int{3},
+			remove:       0,
+			expectSafe:   true,
+			expectVoters: 2,
+			expectQuorum: 2,
+		},
+		{
+			name:         "a healthy learner does not make up for an unhealthy voter",
+			healthy:      []bool{true, true, false, true},
+			learners:     []int{3},
+			remove:       0,
+			expectVoters: 2,
+			expectQuorum: 2,
+		},
+		{
+			name:       "removing a learner is always safe",
+			healthy:    []bool{true, false, false, true},
+			learners:   []int{3},
+			remove:     3,
+			expectSafe: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			machines, members := cluster(tt.healthy, tt.learners...)
+
+			safety := CanSafelyRemoveMachine(machines, members, machines[fmt.Sprintf("machine-%d", tt.remove)])
+			g.Expect(safety.Safe).To(Equal(tt.expectSafe))
+			g.Expect(safety.TargetVoters).To(Equal(tt.expectVoters))
+			g.Expect(safety.TargetQuorum).To(Equal(tt.expectQuorum))
+
+			if tt.expectSafe {
+				g.Expect(safety.Reason).To(BeEmpty())
+			} else {
+				g.Expect(safety.Reason).ToNot(BeEmpty())
+			}
+		})
+	}
+
+	t.Run("the last control plane machine can't be removed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		machines, members := cluster([]bool{true})
+
+		safety := CanSafelyRemoveMachine(machines, members, machines["machine-0"])
+		g.Expect(safety.Safe).To(BeFalse())
+		g.Expect(safety.Reason).To(ContainSubstring("last control plane machine"))
+	})
+
+	// withoutComponents records on the machine a server config disabling the given components.
+	withoutComponents := func(machine *clusterv1.Machine, components ...controlplanev1.DisabledKubernetesComponent) {
+		serverConfig, err := json.Marshal(controlplanev1.RKE2ServerConfig{
+			DisableComponents: controlplanev1.DisableComponents{KubernetesComponents: components},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		machine.SetAnnotations(map[string]string{controlplanev1.RKE2ServerConfigurationAnnotation: string(serverConfig)})
+	}
+
+	t.Run("only machines hosting etcd are counted in the etcd quorum", func(t *testing.T) {
+		g := NewWithT(t)
+
+		// 3 etcd-only machines, one of them unhealthy, and 2 control-plane-only machines.
+		machines, members := cluster([]bool{true, true, false})
+		for i := range 3 {
+			withoutComponents(machines[fmt.Sprintf("machine-%d", i)],
+				controlplanev1.APIServer, controlplanev1.ControllerManager, controlplanev1.Scheduler)
+		}
+
+		for i := 3; i < 5; i++ {
+			machine := controlPlaneMachine(i, true)
+			withoutComponents(machine, controlplanev1.Etcd)
+			machines.Insert(machine)
+		}
+
+		safety := CanSafelyRemoveMachine(machines, members, machines["machine-0"])
+		g.Expect(safety.Safe).To(BeFalse())
+		g.Expect(safety.TargetVoters).To(Equal(2))
+		g.Expect(safety.TargetHealthyVoters).To(Equal(1))
+		g.Expect(safety.TargetQuorum).To(Equal(2))
+
+		safety = CanSafelyRemoveMachine(machines, members, machines["machine-2"])
+		g.Expect(safety.Safe).To(BeTrue())
+		g.Expect(safety.TargetVoters).To(Equal(2))
+		g.Expect(safety.TargetHealthyVoters).To(Equal(2))
+
+		g.Expect(CanSafelyRemoveMachine(machines, members, machines["machine-3"]).Safe).To(BeTrue())
+	})
+
+	t.Run("a member hosted on a control-plane-only machine is not counted as healthy", func(t *testing.T) {
+		g := NewWithT(t)
+
+		machines, members := cluster([]bool{true, true, true})
+		withoutComponents(machines["machine-2"], controlplanev1.Etcd)
+
+		safety := CanSafelyRemoveMachine(machines, members, machines["machine-0"])
+		g.Expect(safety.Safe).To(BeFalse())
+		g.Expect(safety.TargetVoters).To(Equal(2))
+		g.Expect(safety.TargetHealthyVoters).To(Equal(1))
+	})
+
+	t.Run("the last machine hosting etcd or the API server can't be removed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		machines, members := cluster([]bool{true, true})
+		withoutComponents(machines["machine-0"], controlplanev1.APIServer, controlplanev1.ControllerManager, controlplanev1.Scheduler)
+		withoutComponents(machines["machine-1"], controlplanev1.Etcd)
+
+		safety := CanSafelyRemoveMachine(machines, members, machines["machine-0"])
+		g.Expect(safety.Safe).To(BeFalse())
+		g.Expect(safety.Reason).To(ContainSubstring("hosting etcd"))
+
+		safety = CanSafelyRemoveMachine(machines, members, machines["machine-1"])
+		g.Expect(safety.Safe).To(BeFalse())
+		g.Expect(safety.Reason).To(ContainSubstring("hosting the API server"))
+	})
+
+	t.Run("the removal is unsafe without etcd members", func(t *testing.T) {
+		g := NewWithT(t)
+
+		machines, _ := cluster([]bool{true, true, true})
+
+		g.Expect(CanSafelyRemoveMachine(machines, nil, machines["machine-0"]).Safe).To(BeFalse())
+	})
+}
+
+func TestRolloutMaxUnavailable(t *testing.T) {
+	// controlPlane returns a control plane requesting maxUnavailable, with the given etcd members.
+	controlPlane := func(replicas int32, maxUnavailable intstr.IntOrString, members ...controlplanev1.EtcdMemberStatus) *controlplanev1.RKE2ControlPlane {
+		rcp := &controlplanev1.RKE2ControlPlane{
+			Spec: controlplanev1.RKE2ControlPlaneSpec{
+				Replicas: ptr.To(replicas),
+				RolloutStrategy: &controlplanev1.RolloutStrategy{
+					Type:          controlplanev1.RollingUpdateStrategyType,
+					RollingUpdate: &controlplanev1.RollingUpdate{MaxUnavailable: &maxUnavailable},
+				},
+			},
+			Status: controlplanev1.RKE2ControlPlaneStatus{Etcd: &controlplanev1.EtcdStatus{Members: map[string]controlplanev1.EtcdMemberStatus{}}},
+		}
+
+		for i, member := range members {
+			rcp.Status.Etcd.Members[fmt.Sprintf("node-%d", i)] = member
+		}
+
+		return rcp
+	}
+
+	voter := controlplanev1.EtcdMemberStatus{}
+	learner := controlplanev1.EtcdMemberStatus{IsLearner: true}
+	stale := controlplanev1.EtcdMemberStatus{Stale: true}
+
+	t.Run("clamps maxUnavailable to the etcd failure tolerance", func(t *testing.T) {
+		g := NewWithT(t)
+
+		effective, requested := RolloutMaxUnavailable(controlPlane(3, intstr.FromInt32(2), voter, voter, voter))
+		g.Expect(requested).To(Equal(2))
+		g.Expect(effective).To(Equal(1))
+
+		effective, requested = RolloutMaxUnavailable(controlPlane(5, intstr.FromInt32(3), voter, voter, voter, voter, voter))
+		g.Expect(requested).To(Equal(3))
+		g.Expect(effective).To(Equal(2))
+	})
+
+	t.Run("does not count learners nor stale members", func(t *testing.T) {
+		g := NewWithT(t)
+
+		effective, _ := RolloutMaxUnavailable(controlPlane(5, intstr.FromInt32(2), voter, voter, voter, learner, learner))
+		g.Expect(effective).To(Equal(1))
+
+		effective, _ = RolloutMaxUnavailable(controlPlane(5, intstr.FromInt32(2), voter, voter, voter, voter, stale))
+		g.Expect(effective).To(Equal(1))
+	})
+
+	t.Run("scales percentages against the replicas", func(t *testing.T) {
+		g := NewWithT(t)
+
+		effective, requested := RolloutMaxUnavailable(controlPlane(5, intstr.FromString("50%"), voter, voter, voter, voter, voter))
+		g.Expect(requested).To(Equal(2))
+		g.Expect(effective).To(Equal(2))
+	})
+
+	t.Run("defaults to 1 and never caps below 1", func(t *testing.T) {
+		g := NewWithT(t)
+
+		rcp := controlPlane(3, intstr.FromInt32(0), voter, stale, stale)
+		rcp.Spec.RolloutStrategy.RollingUpdate.MaxUnavailable = nil
+
+		effective, requested := RolloutMaxUnavailable(rcp)
+		g.Expect(requested).To(Equal(1))
+		g.Expect(effective).To(Equal(1))
+
+		// The members are not known yet.
+		effective, _ = RolloutMaxUnavailable(controlPlane(5, intstr.FromInt32(2)))
+		g.Expect(effective).To(Equal(1))
+	})
+
+	t.Run("is not capped with external etcd", func(t *testing.T) {
+		g := NewWithT(t)
+
+		rcp := controlPlane(3, intstr.FromInt32(2))
+		rcp.Spec.ServerConfig.Etcd.External = &controlplanev1.ExternalEtcd{}
+
+		effective, _ := RolloutMaxUnavailable(rcp)
+		g.Expect(effective).To(Equal(2))
+	})
+}
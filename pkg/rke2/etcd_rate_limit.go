@@ -0,0 +1,111 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultEtcdMaintenanceOpsPerMinute is the default number of etcd maintenance operations allowed per minute and
+// cluster.
+const DefaultEtcdMaintenanceOpsPerMinute = 10
+
+// ErrEtcdMaintenanceRateLimited is returned by the etcd maintenance operations of a workload cluster when the
+// operations allowed per minute for the cluster have been used up.
+var ErrEtcdMaintenanceRateLimited = errors.New("etcd maintenance operation rate limited")
+
+// EtcdMaintenanceRateLimiter throttles the etcd maintenance operations, e.g. the database status, alarm,
+// defragmentation and snapshot calls, with a
+// token bucket per cluster, so that frequent reconciles don't overload etcd. It is safe for concurrent use, and must
+// outlive the workload clusters as they are built for every reconcile.
+type EtcdMaintenanceRateLimiter struct {
+	opsPerMinute int
+
+	lock     sync.Mutex
+	limiters map[ctrlclient.ObjectKey]*rate.Limiter
+}
+
+// NewEtcdMaintenanceRateLimiter returns a rate limiter allowing opsPerMinute etcd maintenance operations per minute and
+// cluster, with bursts of up to opsPerMinute operations. Operations are not limited if opsPerMinute is not positive.
+func NewEtcdMaintenanceRateLimiter(opsPerMinute int) *EtcdMaintenanceRateLimiter {
+	return &EtcdMaintenanceRateLimiter{
+		opsPerMinute: opsPerMinute,
+		limiters:     map[ctrlclient.ObjectKey]*rate.Limiter{},
+	}
+}
+
+// Allow consumes a token of the cluster for the operation, or returns an error wrapping ErrEtcdMaintenanceRateLimited
+// with the time until the next token is available. Rejected operations don't consume tokens, and are expected to be
+// retried on a later reconcile rather than blocking the current one.
+func (l *EtcdMaintenanceRateLimiter) Allow(clusterKey ctrlclient.ObjectKey, operation string) error {
+	if l == nil || l.opsPerMinute <= 0 {
+		return nil
+	}
+
+	reservation := l.limiterFor(clusterKey).Reserve()
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+
+		return errors.Wrapf(ErrEtcdMaintenanceRateLimited, "%s on cluster %s exceeds %d operations per minute, retry in %s",
+			operation, clusterKey, l.opsPerMinute, delay.Round(time.Second))
+	}
+
+	return nil
+}
+
+func (l *EtcdMaintenanceRateLimiter) limiterFor(clusterKey ctrlclient.ObjectKey) *rate.Limiter {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	limiter, ok := l.limiters[clusterKey]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Every(time.Minute/time.Duration(l.opsPerMinute)), l.opsPerMinute)
+		l.limiters[clusterKey] = limiter
+	}
+
+	return limiter
+}
+
+// Forget drops the token bucket of the cluster, e.g. when the cluster is deleted, so the limiters of deleted clusters
+// don't accumulate for the lifetime of the controller.
+func (l *EtcdMaintenanceRateLimiter) Forget(clusterKey ctrlclient.ObjectKey) {
+	if l == nil {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	delete(l.limiters, clusterKey)
+}
+
+// ForgetEtcdMaintenance forgets the etcd maintenance operations of the workload cluster throttled by the
+// EtcdMaintenanceRateLimiter of the management cluster, e.g. when the cluster is deleted.
+func (m *Management) ForgetEtcdMaintenance(clusterKey ctrlclient.ObjectKey) {
+	m.EtcdMaintenanceRateLimiter.Forget(clusterKey)
+}
+
+// allowEtcdMaintenance returns an error wrapping ErrEtcdMaintenanceRateLimited if the etcd maintenance operation is
+// throttled for the workload cluster.
+func (w *Workload) allowEtcdMaintenance(operation string) error {
+	return w.etcdMaintenanceLimiter.Allow(w.clusterKey, operation)
+}
@@ -0,0 +1,58 @@
+package rke2
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestEtcdMaintenanceRateLimiter(t *testing.T) {
+	cluster := client.ObjectKey{Namespace: "default", Name: "cluster"}
+	otherCluster := client.ObjectKey{Namespace: "default", Name: "other-cluster"}
+
+	t.Run("rejects the calls beyond the limit", func(t *testing.T) {
+		g := NewWithT(t)
+
+		limiter := NewEtcdMaintenanceRateLimiter(2)
+		w := &Workload{clusterKey: cluster, etcdMaintenanceLimiter: limiter}
+
+		g.Expect(w.allowEtcdMaintenance("reading etcd database status")).To(Succeed())
+		g.Expect(w.allowEtcdMaintenance("reading etcd database status")).To(Succeed())
+
+		err := w.allowEtcdMaintenance("clearing etcd alarms")
+		g.Expect(err).To(MatchError(ErrEtcdMaintenanceRateLimited))
+		g.Expect(err.Error()).To(ContainSubstring("clearing etcd alarms on cluster default/cluster exceeds 2 operations per minute"))
+
+		// Clusters are limited independently.
+		g.Expect(limiter.Allow(otherCluster, "reading etcd database status")).To(Succeed())
+	})
+
+	t.Run("does not limit when disabled", func(t *testing.T) {
+		g := NewWithT(t)
+
+		limiter := NewEtcdMaintenanceRateLimiter(0)
+		for range 100 {
+			g.Expect(limiter.Allow(cluster, "reading etcd database status")).To(Succeed())
+		}
+
+		g.Expect((&Workload{}).allowEtcdMaintenance("reading etcd database status")).To(Succeed())
+	})
+
+	t.Run("forgets the limiters of deleted clusters", func(t *testing.T) {
+		g := NewWithT(t)
+
+		limiter := NewEtcdMaintenanceRateLimiter(1)
+		m := &Management{EtcdMaintenanceRateLimiter: limiter}
+
+		g.Expect(limiter.Allow(cluster, "reading etcd database status")).To(Succeed())
+		g.Expect(limiter.Allow(otherCluster, "reading etcd database status")).To(Succeed())
+		g.Expect(limiter.Allow(cluster, "reading etcd database status")).To(MatchError(ErrEtcdMaintenanceRateLimited))
+
+		m.ForgetEtcdMaintenance(cluster)
+		g.Expect(limiter.limiters).To(HaveLen(1))
+		g.Expect(limiter.Allow(cluster, "reading etcd database status")).To(Succeed())
+
+		(&Management{}).ForgetEtcdMaintenance(cluster)
+	})
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+)
+
+const (
+	// DefaultEtcdRetryAttempts is the default number of attempts of an etcd operation failing with transient errors.
+	DefaultEtcdRetryAttempts = 4
+
+	// DefaultEtcdRetryInterval is the default delay before retrying an etcd operation for the first time.
+	DefaultEtcdRetryInterval = 200 * time.Millisecond
+)
+
+// NewEtcdRetryBackoff returns the backoff of the etcd operations of the workload clusters failing with transient
+// errors, making up to attempts attempts, and doubling the delay between two attempts from interval. Operations are not
+// retried if attempts is not greater than 1.
+func NewEtcdRetryBackoff(attempts int, interval time.Duration) wait.Backoff {
+	return wait.Backoff{
+		Duration: interval,
+		Factor:   2,   //nolint:mnd
+		Jitter:   0.1, //nolint:mnd
+		Steps:    attempts,
+	}
+}
+
+// retryEtcdOperation runs the etcd operation, and runs it again with the etcd retry backoff of the workload cluster as
+// long as it fails with a transient error, see etcd.IsTransientError. The error of the last attempt is returned once the
+// attempts are used up or the context is done. The operation is expected to be idempotent, e.g. to check whether a
+// member is already removed before removing it.
+func (w *Workload) retryEtcdOperation(ctx context.Context, operation string, run func() error) error {
+	backoff := NewEtcdRetryBackoff(DefaultEtcdRetryAttempts, DefaultEtcdRetryInterval)
+	if w.etcdRetryBackoff != nil {
+		backoff = *w.etcdRetryBackoff
+	}
+
+	for {
+		err := run()
+		if err == nil || !etcd.IsTransientError(err) || backoff.Steps <= 1 {
+			return err
+		}
+
+		delay := backoff.Step()
+		log.FromContext(ctx).V(4).Info("Retrying etcd operation after a transient error",
+			"operation", operation, "delay", delay.String(), "reason", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
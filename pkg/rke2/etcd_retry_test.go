@@ -0,0 +1,146 @@
+package rke2
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	etcdfake "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/fake"
+)
+
+func TestRetryEtcdOperation(t *testing.T) {
+	backoff := NewEtcdRetryBackoff(3, time.Millisecond)
+	w := &Workload{etcdRetryBackoff: &backoff}
+
+	t.Run("retries a transient error until the operation succeeds", func(t *testing.T) {
+		g := NewWithT(t)
+
+		attempts := 0
+		err := w.retryEtcdOperation(context.Background(), "removing etcd member", func() error {
+			attempts++
+			if attempts < 3 {
+				return rpctypes.ErrLeaderChanged
+			}
+
+			return nil
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(attempts).To(Equal(3))
+	})
+
+	t.Run("does not retry a terminal error", func(t *testing.T) {
+		g := NewWithT(t)
+
+		attempts := 0
+		err := w.retryEtcdOperation(context.Background(), "removing etcd member", func() error {
+			attempts++
+
+			return rpctypes.ErrMemberNotFound
+		})
+		g.Expect(err).To(MatchError(rpctypes.ErrMemberNotFound))
+		g.Expect(attempts).To(Equal(1))
+	})
+
+	t.Run("returns the last transient error once the attempts are used up", func(t *testing.T) {
+		g := NewWithT(t)
+
+		attempts := 0
+		err := w.retryEtcdOperation(context.Background(), "removing etcd member", func() error {
+			attempts++
+
+			return rpctypes.ErrNoLeader
+		})
+		g.Expect(err).To(MatchError(rpctypes.ErrNoLeader))
+		g.Expect(attempts).To(Equal(3))
+	})
+
+	t.Run("stops retrying once the context is done", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		slowBackoff := NewEtcdRetryBackoff(3, time.Hour)
+		attempts := 0
+		err := (&Workload{etcdRetryBackoff: &slowBackoff}).retryEtcdOperation(ctx, "removing etcd member", func() error {
+			attempts++
+
+			return rpctypes.ErrNoLeader
+		})
+		g.Expect(err).To(MatchError(rpctypes.ErrNoLeader))
+		g.Expect(attempts).To(Equal(1))
+	})
+}
+
+func TestRemoveEtcdMemberForMachineRetriesTransientErrors(t *testing.T) {
+	g := NewWithT(t)
+
+	controlPlaneNode := func(name string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{labelNodeRoleControlPlane: "true"},
+		}}
+	}
+
+	etcdClient := &etcdfake.FakeEtcdClient{
+		MemberListResponse: &clientv3.MemberListResponse{
+			Members: []*pb.Member{
+				{Name: "cp1", ID: uint64(1)},
+				{Name: "cp2", ID: uint64(2)},
+			},
+		},
+		AlarmResponse: &clientv3.AlarmResponse{},
+	}
+
+	clientAttempts := 0
+	backoff := NewEtcdRetryBackoff(DefaultEtcdRetryAttempts, time.Millisecond)
+	w := &Workload{
+		Client: fake.NewClientBuilder().WithObjects(controlPlaneNode("cp1"), controlPlaneNode("cp2")).Build(),
+		etcdClientGenerator: &fakeEtcdClientGenerator{
+			forNodesClientFunc: func(_ []string) (*etcd.Client, error) {
+				clientAttempts++
+				// The first attempt hits a leader election.
+				if clientAttempts == 1 {
+					return nil, rpctypes.ErrLeaderChanged
+				}
+
+				return &etcd.Client{EtcdClient: etcdClient}, nil
+			},
+		},
+		etcdRetryBackoff: &backoff,
+	}
+
+	machine := &clusterv1.Machine{Status: clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "cp1"}}}
+
+	g.Expect(w.RemoveEtcdMemberForMachine(context.Background(), machine)).To(Succeed())
+	g.Expect(clientAttempts).To(Equal(2))
+	g.Expect(etcdClient.RemovedMember).To(Equal(uint64(1)))
+
+	t.Run("does not retry terminal errors", func(t *testing.T) {
+		g := NewWithT(t)
+
+		clientAttempts = 0
+		w.etcdClientGenerator = &fakeEtcdClientGenerator{
+			forNodesClientFunc: func(_ []string) (*etcd.Client, error) {
+				clientAttempts++
+
+				return nil, errors.New("etcd certificates are invalid")
+			},
+		}
+
+		g.Expect(w.RemoveEtcdMemberForMachine(context.Background(), machine)).ToNot(Succeed())
+		g.Expect(clientAttempts).To(Equal(1))
+	})
+}
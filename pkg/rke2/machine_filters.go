@@ -1,35 +1,210 @@
 package rke2
 
 import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"net"
+	"path"
 	"reflect"
+	"slices"
+	"strings"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/cluster-api/util/conditions"
 
 	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
 	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
 	bsutil "github.com/rancher/cluster-api-provider-rke2/pkg/util"
 )
 
+// rcpMatcher is a machine filter used to decide whether a machine matches the RCP configuration,
+// along with the reason reported when the machine does not match.
+type rcpMatcher struct {
+	reason string
+	match  collections.Func
+}
+
+// rcpConfigurationMatchers returns the ordered list of matchers a machine must satisfy to be up to date with the RCP.
+// The additional matchers are evaluated after the built-in ones and report the CustomRolloutCriteriaMismatch reason.
+func rcpConfigurationMatchers(
+	infraConfigs map[string]*unstructured.Unstructured,
+	machineConfigs map[string]*bootstrapv1.RKE2Config,
+	contents fileContents,
+	rcp *controlplanev1.RKE2ControlPlane,
+	additionalMatchers ...collections.Func,
+) []rcpMatcher {
+	// Templated RKE2ConfigSpec fields are compared with the RCP templates rendered for the machine, so per-machine values
+	// match. The templates are rendered once per machine, and every matcher of the RKE2ConfigSpec gets the rendered RCP.
+	renderedRCPs := map[string]*controlplanev1.RKE2ControlPlane{}
+	rendered := func(newMatcher func(rcp *controlplanev1.RKE2ControlPlane) collections.Func) collections.Func {
+		if _, ok := rcp.GetAnnotations()[controlplanev1.RKE2ConfigTemplatedFieldsAnnotation]; !ok {
+			return newMatcher(rcp)
+		}
+
+		return func(machine *clusterv1.Machine) bool {
+			if machine == nil {
+				return newMatcher(rcp)(machine)
+			}
+
+			machineRCP, ok := renderedRCPs[machine.Name]
+			if !ok {
+				machineRCP = renderedRCP(rcp, machine)
+				renderedRCPs[machine.Name] = machineRCP
+			}
+
+			return newMatcher(machineRCP)(machine)
+		}
+	}
+
+	// The fields listed in the RKE2ConfigIgnoreFieldsAnnotation are cleared from the RCP and the machine RKE2Configs the
+	// dedicated matchers of the RKE2ConfigSpec compare, so they are ignored consistently with matchesRKE2BootstrapConfig.
+	ignoredFields := ignoredRKE2ConfigFields(rcp)
+	comparedConfigs := machineConfigsWithoutRKE2ConfigFields(machineConfigs, ignoredFields)
+	dedicated := func(
+		newMatcher func(machineConfigs map[string]*bootstrapv1.RKE2Config, rcp *controlplanev1.RKE2ControlPlane) collections.Func,
+	) collections.Func {
+		return rendered(func(rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+			return newMatcher(comparedConfigs, rcpWithoutRKE2ConfigFields(rcp, ignoredFields))
+		})
+	}
+
+	matchers := []rcpMatcher{
+		{reason: controlplanev1.VersionMismatchReason, match: matchesDesiredVersion(rcp)},
+		{reason: controlplanev1.ServerConfigMismatchReason, match: func(machine *clusterv1.Machine) bool {
+			return machine == nil || matchServerConfig(rcp, machine)
+		}},
+		{reason: controlplanev1.CloudProviderMismatchReason, match: func(machine *clusterv1.Machine) bool {
+			return machine == nil || matchCloudProvider(rcp, machine)
+		}},
+		{reason: controlplanev1.AuditPolicyChangedReason, match: dedicated(
+			func(machineConfigs map[string]*bootstrapv1.RKE2Config, rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+				return matchesAuditPolicy(machineConfigs, contents, rcp)
+			})},
+		{reason: controlplanev1.PSAConfigChangedReason, match: dedicated(
+			func(machineConfigs map[string]*bootstrapv1.RKE2Config, rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+				return matchesPSAConfig(machineConfigs, contents, rcp)
+			})},
+		{reason: controlplanev1.APIServerArgsChangedReason, match: func(machine *clusterv1.Machine) bool {
+			return machine == nil || matchComponentArgs(rcp, machine, kubeAPIServerConfig)
+		}},
+		{reason: controlplanev1.ControllerManagerArgsChangedReason, match: func(machine *clusterv1.Machine) bool {
+			return machine == nil || matchComponentArgs(rcp, machine, kubeControllerManagerConfig)
+		}},
+		{reason: controlplanev1.SchedulerArgsChangedReason, match: func(machine *clusterv1.Machine) bool {
+			return machine == nil || matchComponentArgs(rcp, machine, kubeSchedulerConfig)
+		}},
+		{reason: controlplanev1.NodeRolesMismatchReason, match: func(machine *clusterv1.Machine) bool {
+			return machine == nil || matchNodeRoles(rcp, machine)
+		}},
+		{reason: controlplanev1.DisabledComponentsMismatchReason, match: func(machine *clusterv1.Machine) bool {
+			return machine == nil || matchDisabledComponents(rcp, machine)
+		}},
+		{reason: controlplanev1.ServerDefaultsMismatchReason, match: func(machine *clusterv1.Machine) bool {
+			return machine == nil || matchServerDefaults(machineConfigs, rcp, machine)
+		}},
+		{reason: controlplanev1.RegistrationAddressChangedReason, match: func(machine *clusterv1.Machine) bool {
+			return machine == nil || matchRegistrationAddress(rcp, machine)
+		}},
+		{reason: controlplanev1.TLSSANChangedReason, match: func(machine *clusterv1.Machine) bool {
+			return machine == nil || matchTLSSANs(rcp, machine)
+		}},
+		{reason: controlplanev1.RegistriesConfigMismatchReason, match: dedicated(matchesRegistriesConfig)},
+		{reason: controlplanev1.DataDirChangedReason, match: dedicated(matchesDataDirConfig)},
+		{reason: controlplanev1.ContainerdConfigChangedReason, match: dedicated(
+			func(machineConfigs map[string]*bootstrapv1.RKE2Config, rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+				return matchesContainerdConfig(machineConfigs, contents, rcp)
+			})},
+		{reason: controlplanev1.NodeAddressConfigChangedReason, match: dedicated(matchesNodeAddressConfig)},
+		{reason: controlplanev1.KubeletConfigMismatchReason, match: dedicated(matchesKubeletConfigFiles)},
+		{reason: controlplanev1.KubeletConfigChangedReason, match: dedicated(matchesKubeletAgentConfig)},
+		{reason: controlplanev1.BootstrapConfigMismatchReason, match: rendered(func(rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+			return matchesRKE2BootstrapConfig(machineConfigs, contents, rcp)
+		})},
+		{reason: controlplanev1.BootstrapRendererChangedReason, match: matchesBootstrapRenderer(machineConfigs)},
+		{reason: controlplanev1.InfrastructureTemplateMismatchReason, match: matchesTemplateClonedFrom(infraConfigs, rcp)},
+	}
+
+	for _, additionalMatcher := range additionalMatchers {
+		if additionalMatcher == nil {
+			continue
+		}
+
+		matchers = append(matchers, rcpMatcher{reason: controlplanev1.CustomRolloutCriteriaMismatchReason, match: additionalMatcher})
+	}
+
+	return matchers
+}
+
 // matchesRCPConfiguration returns a filter to find all machines that matches with RCP config and do not require any rollout.
-// Kubernetes version, infrastructure template, and RKE2Config field need to be equivalent.
+// Kubernetes version, infrastructure template, and RKE2Config field need to be equivalent, and the machine must
+// satisfy all the additional matchers.
 func matchesRCPConfiguration(
 	infraConfigs map[string]*unstructured.Unstructured,
 	machineConfigs map[string]*bootstrapv1.RKE2Config,
+	contents fileContents,
 	rcp *controlplanev1.RKE2ControlPlane,
+	additionalMatchers ...collections.Func,
 ) func(machine *clusterv1.Machine) bool {
-	return collections.And(
-		matchesKubernetesOrRKE2Version(rcp.GetDesiredVersion()),
-		matchesRKE2BootstrapConfig(machineConfigs, rcp),
-		matchesTemplateClonedFrom(infraConfigs, rcp),
-	)
+	matchers := rcpConfigurationMatchers(infraConfigs, machineConfigs, contents, rcp, additionalMatchers...)
+	filters := make([]collections.Func, 0, len(matchers))
+
+	for _, matcher := range matchers {
+		filters = append(filters, matcher.match)
+	}
+
+	return collections.And(filters...)
+}
+
+// rcpConfigurationMismatchReason returns the reason of the first matcher the machine does not satisfy,
+// or an empty string if the machine matches the RCP configuration.
+func rcpConfigurationMismatchReason(
+	infraConfigs map[string]*unstructured.Unstructured,
+	machineConfigs map[string]*bootstrapv1.RKE2Config,
+	contents fileContents,
+	rcp *controlplanev1.RKE2ControlPlane,
+	machine *clusterv1.Machine,
+	additionalMatchers ...collections.Func,
+) string {
+	for _, matcher := range rcpConfigurationMatchers(infraConfigs, machineConfigs, contents, rcp, additionalMatchers...) {
+		if !matcher.match(machine) {
+			return matcher.reason
+		}
+	}
+
+	return ""
 }
 
 // matchesRKE2BootstrapConfig checks if machine's RKE2ConfigSpec is equivalent with RCP's RKE2ConfigSpec.
-func matchesRKE2BootstrapConfig(machineConfigs map[string]*bootstrapv1.RKE2Config, rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+// Fields listed in the RKE2ConfigIgnoreFieldsAnnotation of the RCP are not compared, and neither are the pre and post
+// RKE2 commands listed in its RKE2ConfigInjectedCommandsAnnotation. Machines whose RKE2Config can't be
+// found match, unless the RCP RolloutOnMissingBootstrapConfigAnnotation is "true".
+// Files are compared by path and by their resolved content, so a file whose content moved from the spec to a secret, or
+// the other way around, does not require a rollout. Files whose content can't be resolved are not compared.
+func matchesRKE2BootstrapConfig(
+	machineConfigs map[string]*bootstrapv1.RKE2Config,
+	contents fileContents,
+	rcp *controlplanev1.RKE2ControlPlane,
+) collections.Func {
+	ignoredFields := ignoredRKE2ConfigFields(rcp)
+	injectedCommands := injectedRKE2Commands(rcp)
+	rolloutOnMissingBootstrapConfig := rcp.GetAnnotations()[controlplanev1.RolloutOnMissingBootstrapConfigAnnotation] == "true"
+
+	// A failure to compute the hash only disables the fast path below.
+	rcpSpecHash, _ := RKE2ConfigSpecHash(&rcp.Spec.RKE2ConfigSpec)
+
 	return func(machine *clusterv1.Machine) bool {
 		if machine == nil {
 			return true
@@ -40,6 +215,11 @@ func matchesRKE2BootstrapConfig(machineConfigs map[string]*bootstrapv1.RKE2Confi
 			return false
 		}
 
+		// Machines created with the current RCP RKE2ConfigSpec match without comparing the whole spec.
+		if rcpSpecHash != "" && machine.GetAnnotations()[controlplanev1.RKE2ConfigSpecHashAnnotation] == rcpSpecHash {
+			return true
+		}
+
 		bootstrapRef := machine.Spec.Bootstrap.ConfigRef
 		if bootstrapRef == nil {
 			// Missing bootstrap reference should not be considered as unmatching.
@@ -50,8 +230,9 @@ func matchesRKE2BootstrapConfig(machineConfigs map[string]*bootstrapv1.RKE2Confi
 		machineConfig, found := machineConfigs[machine.Name]
 		if !found {
 			// Return true here because failing to get KubeadmConfig should not be considered as unmatching.
-			// This is a safety precaution to avoid rolling out machines if the client or the api-server is misbehaving.
-			return true
+			// This is a safety precaution to avoid rolling out machines if the client or the api-server is misbehaving,
+			// unless the RCP opts into rolling out these machines.
+			return !rolloutOnMissingBootstrapConfig
 		}
 
 		if _, ok := machineConfig.Annotations["cluster-api.cattle.io/turtles-system-agent"]; ok {
@@ -73,112 +254,1511 @@ func matchesRKE2BootstrapConfig(machineConfigs map[string]*bootstrapv1.RKE2Confi
 				machineConfig.Spec.Files = files
 			}
 
-			cmds := []string{}
+			// Filter out commands that are injected by the Rancher Turtles webhook
+			machineConfig.Spec.PostRKE2Commands = withoutInjectedCommands(machineConfig.Spec.PostRKE2Commands,
+				turtlesInjectedPostRKE2Commands)
+		}
 
-			for _, cmd := range machineConfig.Spec.PostRKE2Commands { // Filter out commands that are injected by the Rancher Turtles webhook
-				if cmd == "sh /opt/system-agent-install.sh" {
-					continue
-				}
+		machineSpec := normalizeRKE2ConfigSpec(&machineConfig.Spec)
+		rcpSpec := normalizeRKE2ConfigSpec(&rcp.Spec.RKE2ConfigSpec)
 
-				cmds = append(cmds, cmd)
-			}
+		// Commands injected by other provisioning tools are filtered out from both specs, the order of the other
+		// commands is still compared.
+		for _, spec := range []*bootstrapv1.RKE2ConfigSpec{machineSpec, rcpSpec} {
+			spec.PreRKE2Commands = withoutInjectedCommands(spec.PreRKE2Commands, injectedCommands)
+			spec.PostRKE2Commands = withoutInjectedCommands(spec.PostRKE2Commands, injectedCommands)
+		}
 
-			if len(cmds) == 0 {
-				machineConfig.Spec.PostRKE2Commands = nil // Set to nil because rcp.Spec.RKE2ConfigSpec.PostRKE2Commands will be nil if no commands are present
-			} else {
-				machineConfig.Spec.PostRKE2Commands = cmds
-			}
+		// Node labels CAPI propagates from the machine are applied whether they are listed in the RKE2 config or not.
+		machineSpec.AgentConfig.NodeLabels = withoutCAPIOwnedNodeLabels(machine, machineSpec.AgentConfig.NodeLabels)
+		rcpSpec.AgentConfig.NodeLabels = withoutCAPIOwnedNodeLabels(machine, rcpSpec.AgentConfig.NodeLabels)
+
+		machineSpec.Files, rcpSpec.Files = resolveFileContents(machineSpec.Files, rcpSpec.Files, contents)
+
+		for _, field := range ignoredFields {
+			clearField(reflect.ValueOf(machineSpec).Elem(), field)
+			clearField(reflect.ValueOf(rcpSpec).Elem(), field)
 		}
 
 		// Check if RCP AgentConfig and machineBootstrapConfig matches
-		return reflect.DeepEqual(machineConfig.Spec, rcp.Spec.RKE2ConfigSpec)
+		return reflect.DeepEqual(machineSpec, rcpSpec)
 	}
 }
 
-// matchServerConfig checks if RKE2Configs in the ControlPlane object and the machine annotation match.
-func matchServerConfig(rcp *controlplanev1.RKE2ControlPlane, machine *clusterv1.Machine) bool {
-	machineServerConfigStr, ok := machine.GetAnnotations()[controlplanev1.RKE2ServerConfigurationAnnotation]
-	if !ok {
-		// We don't have enough information to make a decision; don't' trigger a roll out.
-		return true
+// withoutCAPIOwnedNodeLabels returns the RKE2 node labels, in the key=value format, without the labels owned by CAPI.
+// CAPI propagates the machine labels of its managed domains to the node in place, and records the labels it owns in
+// the cluster.x-k8s.io/labels-from-machine node annotation. A node label which is also set with the same value on the
+// machine in one of these domains is thus owned by CAPI, and adding or removing it from the RKE2 config does not
+// change the node. All the other node labels are owned by the RKE2 config and are only applied when the node registers.
+func withoutCAPIOwnedNodeLabels(machine *clusterv1.Machine, nodeLabels []string) []string {
+	if len(nodeLabels) == 0 {
+		return nodeLabels
 	}
 
-	machineServerConfig := &controlplanev1.RKE2ServerConfig{}
-	// RKE2ServerConfig annotation is not correct, need to rollout new machine
-	if err := json.Unmarshal([]byte(machineServerConfigStr), &machineServerConfig); err != nil {
-		return false
+	labels := make([]string, 0, len(nodeLabels))
+
+	for _, nodeLabel := range nodeLabels {
+		key, value, _ := strings.Cut(nodeLabel, "=")
+
+		if machineValue, ok := machine.Labels[key]; ok && machineValue == value && isCAPIManagedNodeLabel(key) {
+			continue
+		}
+
+		labels = append(labels, nodeLabel)
 	}
 
-	if machineServerConfig == nil {
-		machineServerConfig = &controlplanev1.RKE2ServerConfig{}
+	if len(labels) == 0 {
+		return nil
 	}
 
-	var rcpServerConfig *controlplanev1.RKE2ServerConfig
-	if reflect.DeepEqual(rcp.Spec.ServerConfig, controlplanev1.RKE2ServerConfig{}) {
-		// If the ServerConfig is empty, initialize a new RKE2ServerConfig
-		rcpServerConfig = &controlplanev1.RKE2ServerConfig{}
-	} else {
-		// Otherwise, take the address of the existing ServerConfig
-		rcpServerConfig = &rcp.Spec.ServerConfig
+	return labels
+}
+
+// isCAPIManagedNodeLabel returns true if CAPI propagates the machine label with the given key to the node.
+func isCAPIManagedNodeLabel(key string) bool {
+	domain, _, found := strings.Cut(key, "/")
+	if !found {
+		return false
 	}
 
-	// Compare and return
-	return reflect.DeepEqual(machineServerConfig, rcpServerConfig)
+	return domain == clusterv1.NodeRoleLabelPrefix ||
+		domain == clusterv1.NodeRestrictionLabelDomain || strings.HasSuffix(domain, "."+clusterv1.NodeRestrictionLabelDomain) ||
+		domain == clusterv1.ManagedNodeLabelDomain || strings.HasSuffix(domain, "."+clusterv1.ManagedNodeLabelDomain)
 }
 
-// matchesTemplateClonedFrom returns a filter to find all machines that match a given RCP infra template.
-func matchesTemplateClonedFrom(infraConfigs map[string]*unstructured.Unstructured, rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+// matchesRegistriesConfig checks if the private registries configuration and the system default registry of the machine's
+// RKE2Config are equivalent with the RCP's RKE2ConfigSpec. Mirrors, registry configs and mirror endpoints are compared
+// regardless of their order.
+func matchesRegistriesConfig(machineConfigs map[string]*bootstrapv1.RKE2Config, rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+	rcpRegistry := normalizeRegistry(rcp.Spec.RKE2ConfigSpec.PrivateRegistriesConfig)
+
 	return func(machine *clusterv1.Machine) bool {
-		if machine == nil {
+		if machine == nil || machine.Spec.Bootstrap.ConfigRef == nil {
+			return true
+		}
+
+		machineConfig, found := machineConfigs[machine.Name]
+		if !found {
+			// Consistently with matchesRKE2BootstrapConfig, a missing RKE2Config is not considered as unmatching.
+			return true
+		}
+
+		if machineConfig.Spec.AgentConfig.SystemDefaultRegistry != rcp.Spec.RKE2ConfigSpec.AgentConfig.SystemDefaultRegistry {
 			return false
 		}
 
-		infraObj, found := infraConfigs[machine.Name]
+		return reflect.DeepEqual(normalizeRegistry(machineConfig.Spec.PrivateRegistriesConfig), rcpRegistry)
+	}
+}
+
+// matchesKubeletConfigFiles returns a filter to find all machines whose kubelet configuration files match the RCP.
+// Kubelet configuration files are the files referenced by the kubelet config argument, or located in the directory
+// referenced by the kubelet config-dir argument, of either the RCP or the machine RKE2Config. They are compared
+// separately from the other files so that a change to the kubelet configuration is reported with its own reason.
+func matchesKubeletConfigFiles(machineConfigs map[string]*bootstrapv1.RKE2Config, rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+	return func(machine *clusterv1.Machine) bool {
+		if machine == nil || machine.Spec.Bootstrap.ConfigRef == nil {
+			return true
+		}
+
+		machineConfig, found := machineConfigs[machine.Name]
 		if !found {
-			// Return true here because failing to get infrastructure machine should not be considered as unmatching.
+			// Consistently with matchesRKE2BootstrapConfig, a missing RKE2Config is not considered as unmatching.
 			return true
 		}
 
-		clonedFromName, ok1 := infraObj.GetAnnotations()[clusterv1.TemplateClonedFromNameAnnotation]
-		clonedFromGroupKind, ok2 := infraObj.GetAnnotations()[clusterv1.TemplateClonedFromGroupKindAnnotation]
+		isKubeletConfigFile := kubeletConfigFileFunc(&rcp.Spec.RKE2ConfigSpec, &machineConfig.Spec)
 
-		if !ok1 || !ok2 {
-			// All rcp cloned infra machines should have this annotation.
-			// Missing the annotation may be due to older version machines or adopted machines.
-			// Should not be considered as mismatch.
+		return reflect.DeepEqual(
+			filterFiles(machineConfig.Spec.Files, isKubeletConfigFile),
+			filterFiles(rcp.Spec.RKE2ConfigSpec.Files, isKubeletConfigFile),
+		)
+	}
+}
+
+// matchesDataDirConfig returns a filter to find all machines whose RKE2 data directory and kubelet binary path match
+// the RCP. Both are compared before the other settings of the RKE2 agent config, as a change requires the node to be
+// rebuilt: they can't be applied in place. Paths are compared after the normalization of normalizeAgentPath.
+func matchesDataDirConfig(machineConfigs map[string]*bootstrapv1.RKE2Config, rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+	rcpDataDir := normalizeAgentPath(rcp.Spec.AgentConfig.DataDir, defaultDataDir)
+	rcpKubeletPath := normalizeAgentPath(rcp.Spec.AgentConfig.KubeletPath, "")
+
+	return func(machine *clusterv1.Machine) bool {
+		if machine == nil || machine.Spec.Bootstrap.ConfigRef == nil {
 			return true
 		}
 
-		// Check if the machine's infrastructure reference has been created from the current RCP infrastructure template.
-		if clonedFromName != rcp.Spec.MachineTemplate.InfrastructureRef.Name ||
-			clonedFromGroupKind != rcp.Spec.MachineTemplate.InfrastructureRef.GroupVersionKind().GroupKind().String() {
-			return false
+		machineConfig, found := machineConfigs[machine.Name]
+		if !found {
+			// Consistently with matchesRKE2BootstrapConfig, a missing RKE2Config is not considered as unmatching.
+			return true
 		}
 
-		return true
+		return normalizeAgentPath(machineConfig.Spec.AgentConfig.DataDir, defaultDataDir) == rcpDataDir &&
+			normalizeAgentPath(machineConfig.Spec.AgentConfig.KubeletPath, "") == rcpKubeletPath
 	}
 }
 
-// matchesKubernetesVersion returns a filter to find all machines that match a given Kubernetes or RKE2 version.
-func matchesKubernetesOrRKE2Version(rke2Version string) func(*clusterv1.Machine) bool {
+// containerdConfigTemplates are the paths, relative to the RKE2 data directory, of the templates RKE2 renders the
+// containerd config from, for containerd 1.x and 2.x.
+var containerdConfigTemplates = []string{
+	"agent/etc/containerd/config.toml.tmpl",
+	"agent/etc/containerd/config-v3.toml.tmpl",
+}
+
+// matchesContainerdConfig returns a filter to find all machines whose containerd config templates match the RCP, e.g.
+// to customize the sandbox image or the registry authentication. The templates are the files of the RKE2Config at the
+// containerd config template paths of the data directory of the machine or the RCP, with the content of the files
+// coming from a secret resolved. They are compared separately from the other files so that a containerd config change
+// is reported with its own reason.
+func matchesContainerdConfig(
+	machineConfigs map[string]*bootstrapv1.RKE2Config,
+	contents fileContents,
+	rcp *controlplanev1.RKE2ControlPlane,
+) collections.Func {
+	return func(machine *clusterv1.Machine) bool {
+		if machine == nil || machine.Spec.Bootstrap.ConfigRef == nil {
+			return true
+		}
+
+		machineConfig, found := machineConfigs[machine.Name]
+		if !found {
+			// Consistently with matchesRKE2BootstrapConfig, a missing RKE2Config is not considered as unmatching.
+			return true
+		}
+
+		isContainerdConfigTemplate := containerdConfigTemplateFunc(&rcp.Spec.RKE2ConfigSpec, &machineConfig.Spec)
+		machineFiles, rcpFiles := resolveFileContents(
+			filterFiles(machineConfig.Spec.Files, isContainerdConfigTemplate),
+			filterFiles(rcp.Spec.RKE2ConfigSpec.Files, isContainerdConfigTemplate),
+			contents,
+		)
+
+		return reflect.DeepEqual(machineFiles, rcpFiles)
+	}
+}
+
+// containerdConfigTemplateFunc returns a function telling whether a file path is a containerd config template in the
+// data directory of any of the given specs.
+func containerdConfigTemplateFunc(specs ...*bootstrapv1.RKE2ConfigSpec) func(path string) bool {
+	templates := []string{}
+
+	for _, spec := range specs {
+		dataDir := normalizeAgentPath(spec.AgentConfig.DataDir, defaultDataDir)
+		for _, configTemplate := range containerdConfigTemplates {
+			templates = append(templates, path.Join(dataDir, configTemplate))
+		}
+	}
+
+	return func(filePath string) bool {
+		return filePath != "" && slices.Contains(templates, path.Clean(filePath))
+	}
+}
+
+// matchesKubeletAgentConfig returns a filter to find all machines whose kubelet settings of the RKE2 agent config, i.e.
+// the kubelet component config, match the RCP. They are compared separately from the rest of the
+// RKE2Config so that a kubelet change is reported with its own reason, after the normalization of normalizeKubeletConfig.
+// Kubelet fields listed in the RKE2ConfigIgnoreFieldsAnnotation of the RCP are not compared.
+func matchesKubeletAgentConfig(machineConfigs map[string]*bootstrapv1.RKE2Config, rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+	ignoredFields := ignoredRKE2ConfigFields(rcp)
+	rcpKubelet := kubeletAgentConfig(&rcp.Spec.RKE2ConfigSpec, ignoredFields)
+
+	return func(machine *clusterv1.Machine) bool {
+		if machine == nil || machine.Spec.Bootstrap.ConfigRef == nil {
+			return true
+		}
+
+		machineConfig, found := machineConfigs[machine.Name]
+		if !found {
+			// Consistently with matchesRKE2BootstrapConfig, a missing RKE2Config is not considered as unmatching.
+			return true
+		}
+
+		return reflect.DeepEqual(kubeletAgentConfig(&machineConfig.Spec, ignoredFields), rcpKubelet)
+	}
+}
+
+// matchesNodeAddressConfig returns a filter to find all machines whose node address settings, i.e. the node-ip kubelet
+// arg, match the RCP. They are compared before the other kubelet settings so that a change of the node addresses, which
+// also changes the addresses of the etcd members, is reported with its own reason. The addresses are compared after
+// the normalization of normalizeKubeletConfig, so reordering them does not require a rollout; as the first address picks
+// the primary IP family of a dual-stack node, the nodes keep their primary IP family until they are replaced then.
+func matchesNodeAddressConfig(machineConfigs map[string]*bootstrapv1.RKE2Config, rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+	ignoredFields := ignoredRKE2ConfigFields(rcp)
+	rcpNodeAddresses := nodeAddressArgs(kubeletAgentConfig(&rcp.Spec.RKE2ConfigSpec, ignoredFields))
+
+	return func(machine *clusterv1.Machine) bool {
+		if machine == nil || machine.Spec.Bootstrap.ConfigRef == nil {
+			return true
+		}
+
+		machineConfig, found := machineConfigs[machine.Name]
+		if !found {
+			// Consistently with matchesRKE2BootstrapConfig, a missing RKE2Config is not considered as unmatching.
+			return true
+		}
+
+		return slices.Equal(nodeAddressArgs(kubeletAgentConfig(&machineConfig.Spec, ignoredFields)), rcpNodeAddresses)
+	}
+}
+
+// nodeAddressArgs returns the node address args of the normalized kubelet settings of the given spec.
+func nodeAddressArgs(spec *bootstrapv1.RKE2ConfigSpec) []string {
+	if spec.AgentConfig.Kubelet == nil {
+		return nil
+	}
+
+	args := []string{}
+
+	for _, arg := range spec.AgentConfig.Kubelet.ExtraArgs {
+		if flag, _, _ := strings.Cut(arg, "="); slices.Contains(kubeletNodeAddressArgs, flag) {
+			args = append(args, arg)
+		}
+	}
+
+	return args
+}
+
+// kubeletAgentConfig returns a spec holding only the normalized kubelet settings of the given spec, without the
+// ignored fields.
+func kubeletAgentConfig(spec *bootstrapv1.RKE2ConfigSpec, ignoredFields [][][]int) *bootstrapv1.RKE2ConfigSpec {
+	kubelet := &bootstrapv1.RKE2ConfigSpec{
+		AgentConfig: bootstrapv1.RKE2AgentConfig{
+			Kubelet: spec.AgentConfig.Kubelet.DeepCopy(),
+		},
+	}
+
+	normalizeKubeletConfig(kubelet.AgentConfig.Kubelet)
+
+	for _, field := range ignoredFields {
+		clearField(reflect.ValueOf(kubelet).Elem(), field)
+	}
+
+	return kubelet
+}
+
+// kubeletConfigFileFunc returns a function telling whether a file path is a kubelet configuration file according to
+// the kubelet config and config-dir arguments of any of the given specs.
+func kubeletConfigFileFunc(specs ...*bootstrapv1.RKE2ConfigSpec) func(path string) bool {
+	configFiles := []string{}
+	configDirs := []string{}
+
+	for _, spec := range specs {
+		if spec.AgentConfig.Kubelet == nil {
+			continue
+		}
+
+		for _, arg := range spec.AgentConfig.Kubelet.ExtraArgs {
+			name, value, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			if value == "" {
+				continue
+			}
+
+			switch name {
+			case "config":
+				configFiles = append(configFiles, value)
+			case "config-dir":
+				configDirs = append(configDirs, strings.TrimSuffix(value, "/")+"/")
+			}
+		}
+	}
+
+	return func(filePath string) bool {
+		if slices.Contains(configFiles, filePath) {
+			return true
+		}
+
+		return slices.ContainsFunc(configDirs, func(dir string) bool {
+			return strings.HasPrefix(filePath, dir)
+		})
+	}
+}
+
+// matchesAuditPolicy returns a filter to find all machines whose audit policy configuration matches the RCP. The
+// audit configuration is made of the audit args of the kube-apiserver, the audit policy secret of the server config, and
+// the files referenced by an audit-policy-file arg, whose content coming from a secret is resolved before comparison.
+// It is compared before the other kube-apiserver args and the RKE2Config files so that an audit policy change is
+// reported with its own reason. The audit args are applied without a rollout when in place server config updates
+// apply to the machine, so they always match then.
+func matchesAuditPolicy(
+	machineConfigs map[string]*bootstrapv1.RKE2Config,
+	contents fileContents,
+	rcp *controlplanev1.RKE2ControlPlane,
+) collections.Func {
+	rcpAuditArgs := auditArgs(&rcp.Spec.ServerConfig)
+
 	return func(machine *clusterv1.Machine) bool {
 		if machine == nil {
-			return false
+			return true
 		}
 
-		if machine.Spec.Version == nil {
-			return false
+		auditServerConfigs := []*controlplanev1.RKE2ServerConfig{&rcp.Spec.ServerConfig}
+
+		// A missing annotation doesn't trigger a roll out, an invalid one is reported as a server config mismatch.
+		if machineServerConfig, ok := recordedServerConfig(machine); ok {
+			if !inPlaceServerConfigUpdatesApply(rcp, machine) && !slices.Equal(auditArgs(machineServerConfig), rcpAuditArgs) {
+				return false
+			}
+
+			if normalizeCloudProviderConfigMap(machineServerConfig.AuditPolicySecret, machine.Namespace) !=
+				normalizeCloudProviderConfigMap(rcp.Spec.ServerConfig.AuditPolicySecret, rcp.Namespace) {
+				return false
+			}
+
+			auditServerConfigs = append(auditServerConfigs, machineServerConfig)
 		}
 
-		if bsutil.IsRKE2Version(*machine.Spec.Version) {
-			return bsutil.CompareVersions(*machine.Spec.Version, rke2Version)
+		if machine.Spec.Bootstrap.ConfigRef == nil {
+			return true
 		}
 
-		rcpKubeVersion, err := bsutil.Rke2ToKubeVersion(rke2Version)
-		if err != nil {
+		machineConfig, found := machineConfigs[machine.Name]
+		if !found {
+			// Consistently with matchesRKE2BootstrapConfig, a missing RKE2Config is not considered as unmatching.
 			return true
 		}
 
-		return bsutil.CompareVersions(*machine.Spec.Version, rcpKubeVersion)
+		isAuditPolicyFile := auditPolicyFileFunc(auditServerConfigs...)
+		machineFiles, rcpFiles := resolveFileContents(
+			filterFiles(machineConfig.Spec.Files, isAuditPolicyFile),
+			filterFiles(rcp.Spec.RKE2ConfigSpec.Files, isAuditPolicyFile),
+			contents,
+		)
+
+		return reflect.DeepEqual(machineFiles, rcpFiles)
 	}
 }
+
+// auditArgs returns the normalized kube-apiserver args of the server config configuring auditing, i.e. the audit
+// policy file, and the audit log and webhook backends.
+func auditArgs(serverConfig *controlplanev1.RKE2ServerConfig) []string {
+	var args []string
+
+	for _, arg := range componentArgs(serverConfig.KubeAPIServer) {
+		arg = strings.TrimLeft(arg, "-")
+		if strings.HasPrefix(arg, "audit-") {
+			args = append(args, arg)
+		}
+	}
+
+	return normalizeArgs(args)
+}
+
+// auditPolicyFileFunc returns a function telling whether a file path is an audit policy file according to the
+// kube-apiserver audit-policy-file args of any of the given server configs.
+func auditPolicyFileFunc(serverConfigs ...*controlplanev1.RKE2ServerConfig) func(path string) bool {
+	policyFiles := []string{}
+
+	for _, serverConfig := range serverConfigs {
+		for _, arg := range auditArgs(serverConfig) {
+			if name, value, _ := strings.Cut(arg, "="); name == "audit-policy-file" && value != "" {
+				policyFiles = append(policyFiles, value)
+			}
+		}
+	}
+
+	return func(filePath string) bool {
+		return slices.Contains(policyFiles, filePath)
+	}
+}
+
+// matchesPSAConfig returns a filter to find all machines whose PodSecurityAdmission configuration matches the RCP. The
+// podSecurityAdmissionConfigFile path of the machine RKE2Config is compared with the RCP, as well as the content of
+// the PodSecurityAdmission config files, referenced by this path or by the kube-apiserver admission-control-config-file
+// arg, with the content of the files coming from a secret resolved. The other files are left to
+// matchesRKE2BootstrapConfig.
+func matchesPSAConfig(
+	machineConfigs map[string]*bootstrapv1.RKE2Config,
+	contents fileContents,
+	rcp *controlplanev1.RKE2ControlPlane,
+) collections.Func {
+	return func(machine *clusterv1.Machine) bool {
+		if machine == nil || machine.Spec.Bootstrap.ConfigRef == nil {
+			return true
+		}
+
+		machineConfig, found := machineConfigs[machine.Name]
+		if !found {
+			// Consistently with matchesRKE2BootstrapConfig, a missing RKE2Config is not considered as unmatching.
+			return true
+		}
+
+		if machineConfig.Spec.AgentConfig.PodSecurityAdmissionConfigFile != rcp.Spec.AgentConfig.PodSecurityAdmissionConfigFile {
+			return false
+		}
+
+		configFiles := []string{rcp.Spec.AgentConfig.PodSecurityAdmissionConfigFile}
+		configFiles = append(configFiles, admissionConfigFiles(&rcp.Spec.ServerConfig)...)
+
+		if machineServerConfig, ok := recordedServerConfig(machine); ok {
+			configFiles = append(configFiles, admissionConfigFiles(machineServerConfig)...)
+		}
+
+		isPSAConfigFile := func(filePath string) bool {
+			return filePath != "" && slices.Contains(configFiles, filePath)
+		}
+
+		machineFiles, rcpFiles := resolveFileContents(
+			filterFiles(machineConfig.Spec.Files, isPSAConfigFile),
+			filterFiles(rcp.Spec.RKE2ConfigSpec.Files, isPSAConfigFile),
+			contents,
+		)
+
+		return reflect.DeepEqual(machineFiles, rcpFiles)
+	}
+}
+
+// admissionConfigFiles returns the admission config files of the server config, i.e. the values of the kube-apiserver
+// admission-control-config-file args, which configure the PodSecurityAdmission plugin.
+func admissionConfigFiles(serverConfig *controlplanev1.RKE2ServerConfig) []string {
+	var files []string
+
+	for _, arg := range componentArgs(serverConfig.KubeAPIServer) {
+		if name, value, _ := strings.Cut(strings.TrimLeft(arg, "-"), "="); name == "admission-control-config-file" && value != "" {
+			files = append(files, value)
+		}
+	}
+
+	return files
+}
+
+// resolveFileContents returns copies of the machine and RCP files with the content of the files coming from a secret
+// inlined. Files present on both sides whose content can't be resolved are left out of both, so a secret which is
+// missing or can't be read never causes a rollout.
+func resolveFileContents(machineFiles, rcpFiles []bootstrapv1.File, contents fileContents) ([]bootstrapv1.File, []bootstrapv1.File) {
+	resolve := func(files []bootstrapv1.File) ([]bootstrapv1.File, map[string]bool) {
+		unresolved := map[string]bool{}
+
+		var resolved []bootstrapv1.File
+
+		for _, file := range files {
+			if file.ContentFrom != nil {
+				content, found := contents[file.ContentFrom.Secret]
+				if !found {
+					unresolved[file.Path] = true
+				} else {
+					file.Content = content
+					file.ContentFrom = nil
+				}
+			}
+
+			resolved = append(resolved, file)
+		}
+
+		return resolved, unresolved
+	}
+
+	machineResolved, machineUnresolved := resolve(machineFiles)
+	rcpResolved, rcpUnresolved := resolve(rcpFiles)
+
+	machinePaths := map[string]bool{}
+	for _, file := range machineResolved {
+		machinePaths[file.Path] = true
+	}
+
+	rcpPaths := map[string]bool{}
+	for _, file := range rcpResolved {
+		rcpPaths[file.Path] = true
+	}
+
+	compared := func(path string) bool {
+		return !machinePaths[path] || !rcpPaths[path] || (!machineUnresolved[path] && !rcpUnresolved[path])
+	}
+
+	return filterFiles(machineResolved, compared), filterFiles(rcpResolved, compared)
+}
+
+// filterFiles returns the files whose path satisfies the filter, sorted by path. No matching file is returned as nil.
+func filterFiles(files []bootstrapv1.File, filter func(path string) bool) []bootstrapv1.File {
+	var filtered []bootstrapv1.File
+
+	for _, file := range files {
+		if filter(file.Path) {
+			filtered = append(filtered, file)
+		}
+	}
+
+	slices.SortStableFunc(filtered, func(a, b bootstrapv1.File) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return filtered
+}
+
+// matchesBootstrapRenderer returns a filter to find all machines whose bootstrap data was rendered with the current
+// templates of the bootstrap provider. The bootstrap provider only reports outdated bootstrap data when renderer
+// drift detection is enabled, so machines are never considered unmatching otherwise.
+func matchesBootstrapRenderer(machineConfigs map[string]*bootstrapv1.RKE2Config) collections.Func {
+	return func(machine *clusterv1.Machine) bool {
+		if machine == nil || machine.Spec.Bootstrap.ConfigRef == nil {
+			return true
+		}
+
+		machineConfig, found := machineConfigs[machine.Name]
+		if !found {
+			return true
+		}
+
+		return !conditions.IsFalse(machineConfig, bootstrapv1.BootstrapDataUpToDateCondition)
+	}
+}
+
+// ignoredRKE2ConfigFields parses the RKE2ConfigIgnoreFieldsAnnotation of the RCP into the field index paths to ignore
+// when comparing RKE2ConfigSpecs. Unknown field paths are logged and skipped.
+func ignoredRKE2ConfigFields(rcp *controlplanev1.RKE2ControlPlane) [][][]int {
+	value, ok := rcp.GetAnnotations()[controlplanev1.RKE2ConfigIgnoreFieldsAnnotation]
+	if !ok {
+		return nil
+	}
+
+	var fields [][][]int
+
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		field, err := resolveFieldPath(reflect.TypeOf(bootstrapv1.RKE2ConfigSpec{}), path)
+		if err != nil {
+			klog.Background().Info("Ignoring unknown RKE2ConfigSpec field path",
+				"namespace", rcp.Namespace, "name", rcp.Name, "annotation", controlplanev1.RKE2ConfigIgnoreFieldsAnnotation,
+				"path", path, "reason", err.Error())
+
+			continue
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// rcpWithoutRKE2ConfigFields returns a shallow copy of the RCP whose RKE2ConfigSpec fields at the given index paths
+// are cleared, or the RCP itself if there is no field to clear.
+func rcpWithoutRKE2ConfigFields(rcp *controlplanev1.RKE2ControlPlane, fields [][][]int) *controlplanev1.RKE2ControlPlane {
+	if len(fields) == 0 {
+		return rcp
+	}
+
+	stripped := *rcp
+	stripped.Spec.RKE2ConfigSpec = *rcp.Spec.RKE2ConfigSpec.DeepCopy()
+
+	for _, field := range fields {
+		clearField(reflect.ValueOf(&stripped.Spec.RKE2ConfigSpec).Elem(), field)
+	}
+
+	return &stripped
+}
+
+// machineConfigsWithoutRKE2ConfigFields returns copies of the machine RKE2Configs whose RKE2ConfigSpec fields at the
+// given index paths are cleared, or the RKE2Configs themselves if there is no field to clear.
+func machineConfigsWithoutRKE2ConfigFields(
+	machineConfigs map[string]*bootstrapv1.RKE2Config,
+	fields [][][]int,
+) map[string]*bootstrapv1.RKE2Config {
+	if len(fields) == 0 {
+		return machineConfigs
+	}
+
+	stripped := make(map[string]*bootstrapv1.RKE2Config, len(machineConfigs))
+
+	for name, machineConfig := range machineConfigs {
+		if machineConfig == nil {
+			stripped[name] = nil
+
+			continue
+		}
+
+		config := *machineConfig
+		config.Spec = *machineConfig.Spec.DeepCopy()
+
+		for _, field := range fields {
+			clearField(reflect.ValueOf(&config.Spec).Elem(), field)
+		}
+
+		stripped[name] = &config
+	}
+
+	return stripped
+}
+
+// ValidateRKE2ConfigFieldPaths returns an error if one of the RKE2ConfigSpec field paths, in the format of the
+// RKE2ConfigIgnoreFieldsAnnotation, can't be resolved.
+func ValidateRKE2ConfigFieldPaths(paths []string) error {
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		if _, err := resolveFieldPath(reflect.TypeOf(bootstrapv1.RKE2ConfigSpec{}), path); err != nil {
+			return fmt.Errorf("invalid RKE2ConfigSpec field path %q: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// withIgnoredRKE2ConfigFields returns the RKE2ControlPlane with the given RKE2ConfigSpec field paths appended to the
+// ones listed in its RKE2ConfigIgnoreFieldsAnnotation, so that the rollout matchers ignore both. The RKE2ControlPlane is
+// returned as is when there is no path, and copied otherwise.
+func withIgnoredRKE2ConfigFields(rcp *controlplanev1.RKE2ControlPlane, paths []string) *controlplanev1.RKE2ControlPlane {
+	if len(paths) == 0 {
+		return rcp
+	}
+
+	rcp = rcp.DeepCopy()
+
+	ignored := slices.Clone(paths)
+	if value := rcp.GetAnnotations()[controlplanev1.RKE2ConfigIgnoreFieldsAnnotation]; value != "" {
+		ignored = append([]string{value}, ignored...)
+	}
+
+	if rcp.Annotations == nil {
+		rcp.Annotations = map[string]string{}
+	}
+
+	rcp.Annotations[controlplanev1.RKE2ConfigIgnoreFieldsAnnotation] = strings.Join(ignored, ",")
+
+	return rcp
+}
+
+// turtlesInjectedPostRKE2Commands are the post RKE2 commands injected by the Rancher Turtles webhook.
+var turtlesInjectedPostRKE2Commands = []string{"sh /opt/system-agent-install.sh"}
+
+// injectedRKE2Commands returns the commands listed in the RKE2ConfigInjectedCommandsAnnotation of the RCP. An invalid
+// annotation is logged and ignored.
+func injectedRKE2Commands(rcp *controlplanev1.RKE2ControlPlane) []string {
+	value, ok := rcp.GetAnnotations()[controlplanev1.RKE2ConfigInjectedCommandsAnnotation]
+	if !ok {
+		return nil
+	}
+
+	var commands []string
+	if err := json.Unmarshal([]byte(value), &commands); err != nil {
+		klog.Background().Info("Ignoring invalid injected RKE2 commands",
+			"namespace", rcp.Namespace, "name", rcp.Name, "annotation", controlplanev1.RKE2ConfigInjectedCommandsAnnotation,
+			"reason", err.Error())
+
+		return nil
+	}
+
+	return commands
+}
+
+// withoutInjectedCommands returns the commands without the injected ones, keeping their order. It returns nil rather
+// than an empty list, as the commands of a spec without commands are nil.
+func withoutInjectedCommands(commands, injected []string) []string {
+	if len(injected) == 0 {
+		return commands
+	}
+
+	filtered := []string{}
+
+	for _, command := range commands {
+		if !slices.Contains(injected, command) {
+			filtered = append(filtered, command)
+		}
+	}
+
+	if len(filtered) == 0 {
+		return nil
+	}
+
+	return filtered
+}
+
+// resolveFieldPath resolves a dot separated field path, e.g. "AgentConfig.NodeName", into the index sequences of the
+// fields along the path. Each path segment matches, case-insensitively, either the Go field name or its JSON name.
+func resolveFieldPath(t reflect.Type, path string) ([][]int, error) {
+	var field [][]int
+
+	for _, segment := range strings.Split(path, ".") {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+
+		if t.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("can't select field %q of non-struct type %s", segment, t)
+		}
+
+		structField, found := lookupStructField(t, segment)
+		if !found {
+			return nil, fmt.Errorf("field %q not found in %s", segment, t.Name())
+		}
+
+		field = append(field, structField.Index)
+		t = structField.Type
+	}
+
+	return field, nil
+}
+
+// lookupStructField returns the field of the struct type, including promoted fields, matching the given name.
+func lookupStructField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for _, structField := range reflect.VisibleFields(t) {
+		if !structField.IsExported() {
+			continue
+		}
+
+		jsonName, _, _ := strings.Cut(structField.Tag.Get("json"), ",")
+		if strings.EqualFold(structField.Name, name) || (jsonName != "" && strings.EqualFold(jsonName, name)) {
+			return structField, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// clearField sets the field at the resolved field path of the struct value to its zero value.
+// Nothing is done if a pointer along the path is nil.
+func clearField(v reflect.Value, field [][]int) {
+	for _, index := range field {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.FieldByIndex(index)
+	}
+
+	v.Set(reflect.Zero(v.Type()))
+}
+
+// matchServerConfig checks if RKE2Configs in the ControlPlane object and the machine annotation match.
+func matchServerConfig(rcp *controlplanev1.RKE2ControlPlane, machine *clusterv1.Machine) bool {
+	machineServerConfigStr, ok := machine.GetAnnotations()[controlplanev1.RKE2ServerConfigurationAnnotation]
+	if !ok {
+		// We don't have enough information to make a decision; don't' trigger a roll out.
+		return true
+	}
+
+	machineServerConfig := &controlplanev1.RKE2ServerConfig{}
+	// RKE2ServerConfig annotation is not correct, need to rollout new machine
+	if err := json.Unmarshal([]byte(machineServerConfigStr), &machineServerConfig); err != nil {
+		return false
+	}
+
+	if machineServerConfig == nil {
+		machineServerConfig = &controlplanev1.RKE2ServerConfig{}
+	}
+
+	var rcpServerConfig *controlplanev1.RKE2ServerConfig
+	if reflect.DeepEqual(rcp.Spec.ServerConfig, controlplanev1.RKE2ServerConfig{}) {
+		// If the ServerConfig is empty, initialize a new RKE2ServerConfig
+		rcpServerConfig = &controlplanev1.RKE2ServerConfig{}
+	} else {
+		// Otherwise, take the address of the existing ServerConfig
+		rcpServerConfig = &rcp.Spec.ServerConfig
+	}
+
+	machineServerConfig = normalizeRKE2ServerConfig(machineServerConfig)
+	rcpServerConfig = normalizeRKE2ServerConfig(rcpServerConfig)
+
+	// Disabled components are compared by matchDisabledComponents, which reports a dedicated reason.
+	machineServerConfig.DisableComponents = controlplanev1.DisableComponents{}
+	rcpServerConfig.DisableComponents = controlplanev1.DisableComponents{}
+
+	// The cloud provider is compared by matchCloudProvider, which reports a dedicated reason.
+	machineServerConfig.CloudProviderName, machineServerConfig.CloudProviderConfigMap = "", nil
+	rcpServerConfig.CloudProviderName, rcpServerConfig.CloudProviderConfigMap = "", nil
+
+	// The audit policy secret is compared by matchesAuditPolicy, which reports a dedicated reason.
+	machineServerConfig.AuditPolicySecret = nil
+	rcpServerConfig.AuditPolicySecret = nil
+
+	// The TLS SANs are compared by matchTLSSANs, which reports a dedicated reason.
+	machineServerConfig.TLSSan = nil
+	rcpServerConfig.TLSSan = nil
+
+	// The component args are compared by matchComponentArgs, which reports a dedicated reason per component.
+	clearComponentArgs(machineServerConfig)
+	clearComponentArgs(rcpServerConfig)
+
+	// The etcd snapshot schedule and retention are applied in place rather than rolled out, when enabled.
+	if inPlaceServerConfigUpdatesApply(rcp, machine) {
+		clearEtcdSnapshotConfig(machineServerConfig)
+		clearEtcdSnapshotConfig(rcpServerConfig)
+	}
+
+	// Compare and return
+	return reflect.DeepEqual(machineServerConfig, rcpServerConfig)
+}
+
+// matchCloudProvider checks if the cloud provider name and cloud provider config of the RKE2ControlPlane match the
+// ones recorded in the machine annotation. Names are compared case-insensitively, and the config map references by
+// namespace and name only, as the other fields of the reference are not used to read the cloud config.
+func matchCloudProvider(rcp *controlplanev1.RKE2ControlPlane, machine *clusterv1.Machine) bool {
+	machineServerConfigStr, ok := machine.GetAnnotations()[controlplanev1.RKE2ServerConfigurationAnnotation]
+	if !ok {
+		// We don't have enough information to make a decision; don't trigger a roll out.
+		return true
+	}
+
+	machineServerConfig := &controlplanev1.RKE2ServerConfig{}
+	if err := json.Unmarshal([]byte(machineServerConfigStr), &machineServerConfig); err != nil {
+		// An invalid annotation is reported as a server config mismatch.
+		return true
+	}
+
+	if machineServerConfig == nil {
+		machineServerConfig = &controlplanev1.RKE2ServerConfig{}
+	}
+
+	return normalizeCloudProviderName(machineServerConfig.CloudProviderName) ==
+		normalizeCloudProviderName(rcp.Spec.ServerConfig.CloudProviderName) &&
+		normalizeCloudProviderConfigMap(machineServerConfig.CloudProviderConfigMap, machine.Namespace) ==
+			normalizeCloudProviderConfigMap(rcp.Spec.ServerConfig.CloudProviderConfigMap, rcp.Namespace)
+}
+
+// matchComponentArgs checks if the extra args of a control plane component of the RKE2ControlPlane match the ones
+// recorded in the machine annotation, regardless of their order and duplicates. The args are applied without a
+// rollout when in place server config updates apply to the machine, so they always match then.
+func matchComponentArgs(
+	rcp *controlplanev1.RKE2ControlPlane,
+	machine *clusterv1.Machine,
+	component func(*controlplanev1.RKE2ServerConfig) *bootstrapv1.ComponentConfig,
+) bool {
+	if inPlaceServerConfigUpdatesApply(rcp, machine) {
+		return true
+	}
+
+	machineServerConfig, ok := recordedServerConfig(machine)
+	if !ok {
+		// A missing annotation doesn't trigger a roll out, an invalid one is reported as a server config mismatch.
+		return true
+	}
+
+	return slices.Equal(
+		normalizeArgs(componentArgs(component(machineServerConfig))),
+		normalizeArgs(componentArgs(component(&rcp.Spec.ServerConfig))),
+	)
+}
+
+func kubeAPIServerConfig(serverConfig *controlplanev1.RKE2ServerConfig) *bootstrapv1.ComponentConfig {
+	return serverConfig.KubeAPIServer
+}
+
+func kubeControllerManagerConfig(serverConfig *controlplanev1.RKE2ServerConfig) *bootstrapv1.ComponentConfig {
+	return serverConfig.KubeControllerManager
+}
+
+func kubeSchedulerConfig(serverConfig *controlplanev1.RKE2ServerConfig) *bootstrapv1.ComponentConfig {
+	return serverConfig.KubeScheduler
+}
+
+// componentArgs returns the extra args of the component config, which may be nil.
+func componentArgs(componentConfig *bootstrapv1.ComponentConfig) []string {
+	if componentConfig == nil {
+		return nil
+	}
+
+	return componentConfig.ExtraArgs
+}
+
+// normalizeCloudProviderName returns the cloud provider name in lower case, without surrounding spaces.
+func normalizeCloudProviderName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// normalizeCloudProviderConfigMap returns the namespace/name key of the cloud provider config map reference, with
+// the namespace defaulted to the given one, or an empty string if there is no reference.
+func normalizeCloudProviderConfigMap(ref *corev1.ObjectReference, defaultNamespace string) string {
+	if ref == nil || ref.Name == "" {
+		return ""
+	}
+
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+
+	return namespace + "/" + ref.Name
+}
+
+// matchDisabledComponents checks if the set of components disabled by the RKE2ControlPlane matches the one recorded
+// in the machine annotation, regardless of the order the components are listed in.
+func matchDisabledComponents(rcp *controlplanev1.RKE2ControlPlane, machine *clusterv1.Machine) bool {
+	machineServerConfigStr, ok := machine.GetAnnotations()[controlplanev1.RKE2ServerConfigurationAnnotation]
+	if !ok {
+		// We don't have enough information to make a decision; don't trigger a roll out.
+		return true
+	}
+
+	machineServerConfig := &controlplanev1.RKE2ServerConfig{}
+	if err := json.Unmarshal([]byte(machineServerConfigStr), &machineServerConfig); err != nil {
+		// An invalid annotation is reported as a server config mismatch.
+		return true
+	}
+
+	if machineServerConfig == nil {
+		machineServerConfig = &controlplanev1.RKE2ServerConfig{}
+	}
+
+	return reflect.DeepEqual(
+		normalizeDisableComponents(machineServerConfig.DisableComponents),
+		normalizeDisableComponents(rcp.Spec.ServerConfig.DisableComponents),
+	)
+}
+
+// matchServerDefaults checks if the server defaults hash recorded for the machine matches the one on the
+// RKE2ControlPlane. The hash recorded on the machine RKE2Config, computed from the defaults its bootstrap data was
+// rendered with, takes precedence over the one copied from the RKE2ControlPlane when the machine was created.
+func matchServerDefaults(
+	machineConfigs map[string]*bootstrapv1.RKE2Config,
+	rcp *controlplanev1.RKE2ControlPlane,
+	machine *clusterv1.Machine,
+) bool {
+	machineDefaultsHash, ok := machine.GetAnnotations()[controlplanev1.ServerDefaultsHashAnnotation]
+	if machineConfig := machineConfigs[machine.Name]; machineConfig != nil {
+		if configDefaultsHash, found := machineConfig.GetAnnotations()[controlplanev1.ServerDefaultsHashAnnotation]; found {
+			machineDefaultsHash, ok = configDefaultsHash, true
+		}
+	}
+
+	if !ok {
+		// We don't have enough information to make a decision; don't trigger a roll out.
+		return true
+	}
+
+	rcpDefaultsHash, ok := rcp.GetAnnotations()[controlplanev1.ServerDefaultsHashAnnotation]
+	if !ok {
+		// Removing the defaults ConfigMap reference changes the server config, which is detected separately.
+		return true
+	}
+
+	return machineDefaultsHash == rcpDefaultsHash
+}
+
+// RegistrationAddress returns the address the machines of the RKE2ControlPlane register with, resolved for its
+// registration method: the registrationAddress for the "address" method, and otherwise the first of the available
+// server addresses computed for the method, i.e. the control plane endpoint host or the IP of a control plane node.
+// It is empty while the available server addresses are not known.
+func RegistrationAddress(rcp *controlplanev1.RKE2ControlPlane) string {
+	if rcp.Spec.RegistrationMethod == controlplanev1.RegistrationMethodAddress {
+		return strings.ToLower(strings.TrimSpace(rcp.Spec.RegistrationAddress))
+	}
+
+	if len(rcp.Status.AvailableServerIPs) == 0 {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimSpace(rcp.Status.AvailableServerIPs[0]))
+}
+
+// isNodeIPRegistrationMethod returns true if the registration method resolves to the IP of a control plane node,
+// rather than to a fixed address.
+func isNodeIPRegistrationMethod(method controlplanev1.RegistrationMethod) bool {
+	switch method {
+	case controlplanev1.RegistrationMethodFavourInternalIPs,
+		controlplanev1.RegistrationMethodInternalIPs,
+		controlplanev1.RegistrationMethodExternalIPs:
+		return true
+	default:
+		return false
+	}
+}
+
+// matchRegistrationAddress checks if the registration address recorded on the machine matches the one the
+// RKE2ControlPlane resolves for its registration method, so the machines are reconfigured when the fixed registration
+// address, e.g. of a load balancer or the control plane endpoint, changes, or when the registration method moves
+// between a fixed address and the node IPs. The address resolved for the node IP methods changes as control plane
+// nodes are replaced, while registered RKE2 agents keep track of every server, so only the method is compared then.
+func matchRegistrationAddress(rcp *controlplanev1.RKE2ControlPlane, machine *clusterv1.Machine) bool {
+	machineAddress, ok := machine.GetAnnotations()[controlplanev1.RegistrationAddressAnnotation]
+	if !ok {
+		// We don't have enough information to make a decision; don't trigger a roll out.
+		return true
+	}
+
+	machineAddress = strings.ToLower(strings.TrimSpace(machineAddress))
+
+	machineMethod, ok := machine.GetAnnotations()[controlplanev1.RegistrationMethodAnnotation]
+	if !ok {
+		// Machines created before the registration method was recorded only record the address of the "address"
+		// registration method, and an empty address otherwise.
+		if rcp.Spec.RegistrationMethod != controlplanev1.RegistrationMethodAddress {
+			return machineAddress == ""
+		}
+
+		return machineAddress == RegistrationAddress(rcp)
+	}
+
+	if isNodeIPRegistrationMethod(rcp.Spec.RegistrationMethod) {
+		return isNodeIPRegistrationMethod(controlplanev1.RegistrationMethod(machineMethod))
+	}
+
+	registrationAddress := RegistrationAddress(rcp)
+	if registrationAddress == "" {
+		// The available server addresses are not known yet; don't trigger a roll out.
+		return true
+	}
+
+	return machineAddress == registrationAddress
+}
+
+// matchTLSSANs checks if the TLS SANs of the RKE2ControlPlane match the ones recorded in the machine annotation,
+// regardless of their order. When the server config is applied in place, SANs added to the RKE2ControlPlane are
+// matched too, as restarting rke2-server re-issues its serving certificate with them; removed SANs still require a
+// roll out, as they are kept in the certificate.
+func matchTLSSANs(rcp *controlplanev1.RKE2ControlPlane, machine *clusterv1.Machine) bool {
+	machineServerConfig, ok := recordedServerConfig(machine)
+	if !ok {
+		// A missing annotation doesn't trigger a roll out, an invalid one is reported as a server config mismatch.
+		return true
+	}
+
+	machineSANs := normalizeTLSSANs(machineServerConfig.TLSSan)
+	rcpSANs := normalizeTLSSANs(rcp.Spec.ServerConfig.TLSSan)
+
+	if inPlaceServerConfigUpdatesApply(rcp, machine) {
+		for _, san := range machineSANs {
+			if _, found := slices.BinarySearch(rcpSANs, san); !found {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return slices.Equal(machineSANs, rcpSANs)
+}
+
+// matchesTemplateClonedFrom returns a filter to find all machines that match a given RCP infra template.
+func matchesTemplateClonedFrom(infraConfigs map[string]*unstructured.Unstructured, rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+	return func(machine *clusterv1.Machine) bool {
+		if machine == nil {
+			return false
+		}
+
+		infraObj, found := infraConfigs[machine.Name]
+		if !found {
+			// Return true here because failing to get infrastructure machine should not be considered as unmatching.
+			return true
+		}
+
+		clonedFromName, ok1 := infraObj.GetAnnotations()[clusterv1.TemplateClonedFromNameAnnotation]
+		clonedFromGroupKind, ok2 := infraObj.GetAnnotations()[clusterv1.TemplateClonedFromGroupKindAnnotation]
+
+		if !ok1 || !ok2 {
+			// All rcp cloned infra machines should have this annotation.
+			// Missing the annotation may be due to older version machines or adopted machines.
+			// Should not be considered as mismatch.
+			return true
+		}
+
+		// Check if the machine's infrastructure reference has been created from the current RCP infrastructure template.
+		if clonedFromName != rcp.Spec.MachineTemplate.InfrastructureRef.Name ||
+			clonedFromGroupKind != rcp.Spec.MachineTemplate.InfrastructureRef.GroupVersionKind().GroupKind().String() {
+			return false
+		}
+
+		return true
+	}
+}
+
+// matchesDesiredVersion returns a filter to find all machines running the desired version of the RCP. The version of an
+// RCP following a release channel, or pinned with a runtime image, is resolved once per reconcile, see
+// ControlPlane.DesiredVersion. If the version can't be resolved all machines are considered matching, so that a channel
+// server outage or an unexpected tag does not trigger a rollout.
+func matchesDesiredVersion(rcp *controlplanev1.RKE2ControlPlane) collections.Func {
+	version := rcp.GetDesiredVersion()
+	if version == "" {
+		return func(*clusterv1.Machine) bool {
+			return true
+		}
+	}
+
+	return matchesKubernetesOrRKE2Version(version)
+}
+
+// matchesKubernetesOrRKE2Version returns a filter to find all machines that match a given Kubernetes or RKE2 version.
+func matchesKubernetesOrRKE2Version(rke2Version string) func(*clusterv1.Machine) bool {
+	return func(machine *clusterv1.Machine) bool {
+		if machine == nil {
+			return false
+		}
+
+		if machine.Spec.Version == nil {
+			return false
+		}
+
+		if bsutil.IsRKE2Version(*machine.Spec.Version) {
+			return bsutil.CompareVersions(*machine.Spec.Version, rke2Version)
+		}
+
+		rcpKubeVersion, err := bsutil.Rke2ToKubeVersion(rke2Version)
+		if err != nil {
+			return true
+		}
+
+		return bsutil.CompareVersions(*machine.Spec.Version, rcpKubeVersion)
+	}
+}
+
+// HasProviderID returns a filter to find all machines whose infrastructure provider has set the ProviderID.
+func HasProviderID() collections.Func {
+	return func(machine *clusterv1.Machine) bool {
+		return machine != nil && machine.Spec.ProviderID != nil && *machine.Spec.ProviderID != ""
+	}
+}
+
+// NeedsProviderID returns a filter to find all machines still waiting for the infrastructure provider
+// to set the ProviderID, i.e. machines which are not provisioned yet.
+func NeedsProviderID() collections.Func {
+	return collections.Not(HasProviderID())
+}
+
+// IsControlPlaneMachine returns true if the machine has the control plane label, i.e. it is a control plane machine
+// rather than a worker machine. It is a collections.Func, and is false for a nil machine.
+func IsControlPlaneMachine(machine *clusterv1.Machine) bool {
+	if machine == nil {
+		return false
+	}
+
+	_, ok := machine.GetLabels()[clusterv1.MachineControlPlaneLabel]
+
+	return ok
+}
+
+// HasBootstrapDataSecret returns a filter to find all machines whose bootstrap data secret exists and holds the
+// bootstrap data, as a machine can be up to date with the RKE2Config while the bootstrap provider has not populated
+// the secret yet. Machines whose secret can't be read are not matched, so they are not treated as ready.
+func HasBootstrapDataSecret(ctx context.Context, reader ctrlclient.Reader) collections.Func {
+	return func(machine *clusterv1.Machine) bool {
+		if machine == nil || machine.Spec.Bootstrap.DataSecretName == nil || *machine.Spec.Bootstrap.DataSecretName == "" {
+			return false
+		}
+
+		secret := &corev1.Secret{}
+		key := ctrlclient.ObjectKey{Namespace: machine.Namespace, Name: *machine.Spec.Bootstrap.DataSecretName}
+
+		if err := reader.Get(ctx, key, secret); err != nil {
+			if !apierrors.IsNotFound(err) {
+				log.FromContext(ctx).Error(err, "Failed to get bootstrap data secret", "machine", machine.Name,
+					"secret", key.Name)
+			}
+
+			return false
+		}
+
+		return len(secret.Data["value"]) > 0
+	}
+}
+
+// DefaultStuckProvisioningThreshold is the default duration after which a machine which is not Running yet is
+// considered stuck provisioning.
+const DefaultStuckProvisioningThreshold = 30 * time.Minute
+
+// IsStuckProvisioning returns a filter to find all machines which are not Running longer than the threshold after
+// their creation, e.g. because the infrastructure or the node never came up. Machines being deleted are not
+// provisioning, so they are never considered stuck. The filter only identifies candidates for remediation.
+func IsStuckProvisioning(threshold time.Duration) collections.Func {
+	return isStuckProvisioningAt(time.Now(), threshold)
+}
+
+func isStuckProvisioningAt(now time.Time, threshold time.Duration) collections.Func {
+	return func(machine *clusterv1.Machine) bool {
+		if machine == nil || !machine.DeletionTimestamp.IsZero() {
+			return false
+		}
+
+		switch clusterv1.MachinePhase(machine.Status.Phase) {
+		case clusterv1.MachinePhaseRunning, clusterv1.MachinePhaseDeleting, clusterv1.MachinePhaseDeleted:
+			return false
+		}
+
+		return now.Sub(machine.CreationTimestamp.Time) > threshold
+	}
+}
+
+// RKE2ConfigSpecHash returns a stable hash of the normalized RKE2ConfigSpec, so that specs only differing
+// in the order of set-like fields, e.g. the component extra args or the node taints, have the same hash.
+func RKE2ConfigSpecHash(spec *bootstrapv1.RKE2ConfigSpec) (string, error) {
+	// encoding/json sorts map keys, so the output does not depend on the map iteration order.
+	data, err := json.Marshal(normalizeRKE2ConfigSpec(spec))
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal RKE2ConfigSpec: %w", err)
+	}
+
+	hash := sha256.Sum256(data)
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// normalizeRKE2ConfigSpec returns a copy of the RKE2ConfigSpec with the component extra args sorted and deduplicated,
+// and the node taints and the files sorted, so that specs only differing in the order of these lists are considered
+// equal. The given spec is not modified.
+func normalizeRKE2ConfigSpec(spec *bootstrapv1.RKE2ConfigSpec) *bootstrapv1.RKE2ConfigSpec {
+	normalized := spec.DeepCopy()
+
+	normalizeKubeletConfig(normalized.AgentConfig.Kubelet)
+	normalizeComponentConfig(normalized.AgentConfig.KubeProxy)
+	normalized.AgentConfig.NodeTaints = normalizeTaints(normalized.AgentConfig.NodeTaints)
+	normalized.AgentConfig.DataDir = normalizeAgentPath(normalized.AgentConfig.DataDir, defaultDataDir)
+	normalized.AgentConfig.KubeletPath = normalizeAgentPath(normalized.AgentConfig.KubeletPath, "")
+	normalized.PrivateRegistriesConfig = normalizeRegistry(normalized.PrivateRegistriesConfig)
+	normalized.Files = filterFiles(normalized.Files, func(string) bool { return true })
+
+	return normalized
+}
+
+// defaultDataDir is the RKE2 data directory used when the RKE2 agent config does not override it.
+const defaultDataDir = "/var/lib/rancher/rke2"
+
+// normalizeAgentPath returns the path of an RKE2 agent config override in its clean form, or defaultPath if not set.
+func normalizeAgentPath(agentPath, defaultPath string) string {
+	if agentPath == "" {
+		return defaultPath
+	}
+
+	return path.Clean(agentPath)
+}
+
+// normalizeRegistry returns a copy of the registries configuration with empty maps normalized to nil and the mirror
+// endpoints stripped of trailing slashes and duplicates, and sorted.
+func normalizeRegistry(registry bootstrapv1.Registry) bootstrapv1.Registry {
+	normalized := *registry.DeepCopy()
+
+	if len(normalized.Mirrors) == 0 {
+		normalized.Mirrors = nil
+	}
+
+	if len(normalized.Configs) == 0 {
+		normalized.Configs = nil
+	}
+
+	for name, mirror := range normalized.Mirrors {
+		endpoints := []string{}
+		seen := map[string]bool{}
+
+		for _, endpoint := range mirror.Endpoint {
+			endpoint = strings.TrimSuffix(endpoint, "/")
+			if seen[endpoint] {
+				continue
+			}
+
+			seen[endpoint] = true
+			endpoints = append(endpoints, endpoint)
+		}
+
+		slices.Sort(endpoints)
+
+		mirror.Endpoint = nil
+		if len(endpoints) > 0 {
+			mirror.Endpoint = endpoints
+		}
+
+		if len(mirror.Rewrite) == 0 {
+			mirror.Rewrite = nil
+		}
+
+		normalized.Mirrors[name] = mirror
+	}
+
+	return normalized
+}
+
+// normalizeRKE2ServerConfig returns a copy of the RKE2ServerConfig with the component extra args sorted and deduplicated,
+// so that configurations only differing in the order of the arguments are considered equal. The given config is not modified.
+func normalizeRKE2ServerConfig(serverConfig *controlplanev1.RKE2ServerConfig) *controlplanev1.RKE2ServerConfig {
+	normalized := serverConfig.DeepCopy()
+
+	normalizeComponentConfig(normalized.KubeAPIServer)
+	normalizeComponentConfig(normalized.KubeControllerManager)
+	normalizeComponentConfig(normalized.KubeScheduler)
+	normalizeComponentConfig(normalized.CloudControllerManager)
+	normalizeComponentConfig(normalized.Etcd.CustomConfig)
+
+	return normalized
+}
+
+// normalizeDisableComponents returns a copy of the disabled components with both lists sorted and deduplicated.
+// Empty lists are normalized to nil.
+func normalizeDisableComponents(disableComponents controlplanev1.DisableComponents) controlplanev1.DisableComponents {
+	normalized := controlplanev1.DisableComponents{}
+
+	if len(disableComponents.KubernetesComponents) > 0 {
+		normalized.KubernetesComponents = slices.Clone(disableComponents.KubernetesComponents)
+		slices.Sort(normalized.KubernetesComponents)
+		normalized.KubernetesComponents = slices.Compact(normalized.KubernetesComponents)
+	}
+
+	if len(disableComponents.PluginComponents) > 0 {
+		normalized.PluginComponents = slices.Clone(disableComponents.PluginComponents)
+		slices.Sort(normalized.PluginComponents)
+		normalized.PluginComponents = slices.Compact(normalized.PluginComponents)
+	}
+
+	return normalized
+}
+
+// normalizeComponentConfig normalizes the component extra args in place, see normalizeArgs.
+func normalizeComponentConfig(componentConfig *bootstrapv1.ComponentConfig) {
+	if componentConfig == nil {
+		return
+	}
+
+	componentConfig.ExtraArgs = normalizeArgs(componentConfig.ExtraArgs)
+}
+
+// kubeletListArgs are the kubelet args whose value is a comma separated list of independent entries, e.g. the eviction
+// thresholds "memory.available<100Mi,nodefs.available<10%".
+var kubeletListArgs = []string{
+	"eviction-hard", "eviction-soft", "eviction-soft-grace-period", "eviction-minimum-reclaim",
+	"feature-gates", "kube-reserved", "system-reserved",
+}
+
+// kubeletNodeAddressArgs are the kubelet args whose value is a comma separated list of node IP addresses.
+var kubeletNodeAddressArgs = []string{"node-ip"}
+
+// normalizeKubeletConfig normalizes the kubelet extra args in place: on top of normalizeComponentConfig, the leading
+// dashes of the flags are removed and the entries of the list args, e.g. the eviction thresholds, are sorted, as the
+// kubelet does not depend on their order. The node IP addresses are sorted in their canonical form as well. Empty maps
+// are normalized to nil.
+func normalizeKubeletConfig(kubelet *bootstrapv1.ComponentConfig) {
+	if kubelet == nil {
+		return
+	}
+
+	for i, arg := range kubelet.ExtraArgs {
+		arg = strings.TrimLeft(strings.TrimSpace(arg), "-")
+
+		if flag, value, found := strings.Cut(arg, "="); found && slices.Contains(kubeletListArgs, flag) {
+			entries := strings.Split(value, ",")
+			for j := range entries {
+				entries[j] = strings.TrimSpace(entries[j])
+			}
+
+			slices.Sort(entries)
+			arg = flag + "=" + strings.Join(slices.Compact(entries), ",")
+		} else if found && slices.Contains(kubeletNodeAddressArgs, flag) {
+			arg = flag + "=" + normalizeNodeIPs(value)
+		}
+
+		kubelet.ExtraArgs[i] = arg
+	}
+
+	normalizeComponentConfig(kubelet)
+
+	if len(kubelet.ExtraEnv) == 0 {
+		kubelet.ExtraEnv = nil
+	}
+
+	if len(kubelet.ExtraMounts) == 0 {
+		kubelet.ExtraMounts = nil
+	}
+}
+
+// normalizeNodeIPs returns the comma separated IP addresses in their canonical form, sorted and without duplicates.
+// Entries which are not IP addresses are kept as is.
+func normalizeNodeIPs(value string) string {
+	ips := strings.Split(value, ",")
+	for i := range ips {
+		ips[i] = strings.TrimSpace(ips[i])
+
+		if ip := net.ParseIP(ips[i]); ip != nil {
+			ips[i] = ip.String()
+		}
+	}
+
+	slices.Sort(ips)
+
+	return strings.Join(slices.Compact(ips), ",")
+}
+
+// componentSetArgs are the component args whose values accumulate when the arg is repeated, each value being a comma
+// separated list of independent entries, e.g. the admission plugins or the kubelet eviction thresholds. The components
+// do not depend on the order of their entries.
+var componentSetArgs = append([]string{
+	"api-audiences", "enable-admission-plugins", "disable-admission-plugins", "service-account-key-file",
+}, kubeletListArgs...)
+
+// normalizeArgs returns a copy of the args sorted by flag, which the components do not depend on. As the components
+// keep the last value of a repeated flag, only the last value of each flag is kept, except for the componentSetArgs
+// whose entries are merged, sorted and deduplicated. Empty args are normalized to nil.
+func normalizeArgs(args []string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+
+	lastArgs := map[string]string{}
+	setEntries := map[string][]string{}
+
+	for _, arg := range args {
+		flag, value, found := strings.Cut(arg, "=")
+		if !found || !slices.Contains(componentSetArgs, strings.TrimLeft(flag, "-")) {
+			lastArgs[flag] = arg
+
+			continue
+		}
+
+		for _, entry := range strings.Split(value, ",") {
+			setEntries[flag] = append(setEntries[flag], strings.TrimSpace(entry))
+		}
+	}
+
+	normalized := make([]string, 0, len(lastArgs)+len(setEntries))
+	for _, arg := range lastArgs {
+		normalized = append(normalized, arg)
+	}
+
+	for flag, entries := range setEntries {
+		slices.Sort(entries)
+		normalized = append(normalized, flag+"="+strings.Join(slices.Compact(entries), ","))
+	}
+
+	slices.Sort(normalized)
+
+	return normalized
+}
+
+// normalizeTLSSANs returns a copy of the TLS SANs, trimmed, lowercased, sorted and deduplicated, as DNS names are
+// case-insensitive. Empty SANs are dropped and empty lists are normalized to nil.
+func normalizeTLSSANs(sans []string) []string {
+	var normalized []string
+
+	for _, san := range sans {
+		if san = strings.ToLower(strings.TrimSpace(san)); san != "" {
+			normalized = append(normalized, san)
+		}
+	}
+
+	slices.Sort(normalized)
+
+	return slices.Compact(normalized)
+}
+
+// normalizeTaints returns a copy of the taints, in the key=value:effect format, sorted by key, value and effect.
+// Empty taints are normalized to nil.
+func normalizeTaints(taints []string) []string {
+	if len(taints) == 0 {
+		return nil
+	}
+
+	normalized := slices.Clone(taints)
+	slices.SortStableFunc(normalized, func(a, b string) int {
+		aKey, aValue, aEffect := splitTaint(a)
+		bKey, bValue, bEffect := splitTaint(b)
+
+		return cmp.Or(
+			cmp.Compare(aKey, bKey),
+			cmp.Compare(aValue, bValue),
+			cmp.Compare(aEffect, bEffect),
+		)
+	})
+
+	return normalized
+}
+
+// splitTaint splits a taint in the key=value:effect format into its key, value and effect.
+func splitTaint(taint string) (key, value, effect string) {
+	keyValue, effect, _ := strings.Cut(taint, ":")
+	key, value, _ = strings.Cut(keyValue, "=")
+
+	return key, value, effect
+}
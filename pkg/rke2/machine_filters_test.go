@@ -1,14 +1,25 @@
 package rke2
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
 	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
@@ -70,6 +81,306 @@ var _ = Describe("ServerConfigMatching", func() {
 	})
 })
 
+var _ = Describe("cloud provider matching", func() {
+	var (
+		cloudRCP *controlplanev1.RKE2ControlPlane
+		m        *clusterv1.Machine
+	)
+
+	BeforeEach(func() {
+		cloudRCP = rcp.DeepCopy()
+		cloudRCP.Spec.ServerConfig.CloudProviderConfigMap = &corev1.ObjectReference{
+			Kind:      "ConfigMap",
+			Namespace: "example",
+			Name:      "cloud-config",
+		}
+
+		m = machine.DeepCopy()
+		m.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = "{\"cni\":\"calico\",\"cloudProviderName\":\"aws\"," +
+			"\"cloudProviderConfigMap\":{\"name\":\"cloud-config\"},\"clusterDomain\":\"example.com\"}"
+	})
+
+	It("should not roll out machines with an equivalent cloud config reference", func() {
+		Expect(matchCloudProvider(cloudRCP, m)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, cloudRCP, m)).To(BeEmpty())
+	})
+
+	It("should roll out machines when migrating from the in-tree to an external cloud provider", func() {
+		cloudRCP.Spec.ServerConfig.CloudProviderName = "external"
+		cloudRCP.Spec.ServerConfig.CloudProviderConfigMap = nil
+
+		Expect(matchCloudProvider(cloudRCP, m)).To(BeFalse())
+		Expect(matchServerConfig(cloudRCP, m)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, cloudRCP, m)).To(Equal(controlplanev1.CloudProviderMismatchReason))
+	})
+
+	It("should roll out machines when the cloud config changed", func() {
+		cloudRCP.Spec.ServerConfig.CloudProviderConfigMap.Name = "other-cloud-config"
+
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, cloudRCP, m)).To(Equal(controlplanev1.CloudProviderMismatchReason))
+	})
+
+	It("should not roll out machines without a recorded server config", func() {
+		cloudRCP.Spec.ServerConfig.CloudProviderName = "external"
+		delete(m.Annotations, controlplanev1.RKE2ServerConfigurationAnnotation)
+
+		Expect(matchCloudProvider(cloudRCP, m)).To(BeTrue())
+	})
+})
+
+var _ = Describe("in place server config updates", func() {
+	var (
+		inPlaceRCP *controlplanev1.RKE2ControlPlane
+		m          *clusterv1.Machine
+	)
+
+	BeforeEach(func() {
+		inPlaceRCP = rcp.DeepCopy()
+		inPlaceRCP.Annotations = map[string]string{controlplanev1.InPlaceServerConfigUpdatesAnnotation: "true"}
+
+		m = machine.DeepCopy()
+	})
+
+	It("should not roll out machines when only hot-reloadable fields changed", func() {
+		inPlaceRCP.Spec.ServerConfig.KubeAPIServer = &bootstrapv1.ComponentConfig{ExtraArgs: []string{"audit-log-maxage=30"}}
+		inPlaceRCP.Spec.ServerConfig.KubeScheduler = &bootstrapv1.ComponentConfig{ExtraArgs: []string{"v=2"}}
+
+		Expect(matchServerConfig(inPlaceRCP, m)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, inPlaceRCP, m)).To(BeEmpty())
+	})
+
+	It("should roll out machines when other fields changed", func() {
+		inPlaceRCP.Spec.ServerConfig.KubeAPIServer = &bootstrapv1.ComponentConfig{
+			ExtraArgs: []string{"audit-log-maxage=30"},
+			ExtraEnv:  map[string]string{"GOGC": "50"},
+		}
+
+		Expect(matchServerConfig(inPlaceRCP, m)).To(BeFalse())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, inPlaceRCP, m)).To(Equal(controlplanev1.ServerConfigMismatchReason))
+	})
+
+	It("should roll out machines when in place updates are not enabled", func() {
+		delete(inPlaceRCP.Annotations, controlplanev1.InPlaceServerConfigUpdatesAnnotation)
+		inPlaceRCP.Spec.ServerConfig.KubeAPIServer = &bootstrapv1.ComponentConfig{ExtraArgs: []string{"audit-log-maxage=30"}}
+
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, inPlaceRCP, m)).To(Equal(controlplanev1.APIServerArgsChangedReason))
+	})
+
+	It("should roll out machines when the server config uses a defaults ConfigMap", func() {
+		inPlaceRCP.Spec.ServerConfig.KubeAPIServer = &bootstrapv1.ComponentConfig{ExtraArgs: []string{"audit-log-maxage=30"}}
+		inPlaceRCP.Spec.ServerConfig.DefaultsConfigMap = &corev1.ObjectReference{Name: "defaults"}
+		m.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = "{\"cni\":\"calico\",\"cloudProviderName\":\"aws\"," +
+			"\"clusterDomain\":\"example.com\",\"defaultsConfigMap\":{\"name\":\"defaults\"}}"
+
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, inPlaceRCP, m)).To(Equal(controlplanev1.APIServerArgsChangedReason))
+	})
+})
+
+var _ = Describe("component args matching", func() {
+	var (
+		argsRCP *controlplanev1.RKE2ControlPlane
+		m       *clusterv1.Machine
+	)
+
+	BeforeEach(func() {
+		argsRCP = rcp.DeepCopy()
+		argsRCP.Spec.ServerConfig.KubeAPIServer = &bootstrapv1.ComponentConfig{ExtraArgs: []string{"audit-log-maxage=30"}}
+		argsRCP.Spec.ServerConfig.KubeScheduler = &bootstrapv1.ComponentConfig{ExtraArgs: []string{"v=2", "bind-address=0.0.0.0"}}
+
+		m = machine.DeepCopy()
+		m.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = "{\"cni\":\"calico\",\"cloudProviderName\":\"aws\"," +
+			"\"clusterDomain\":\"example.com\",\"kubeAPIServer\":{\"extraArgs\":[\"audit-log-maxage=30\"]}," +
+			"\"kubeScheduler\":{\"extraArgs\":[\"bind-address=0.0.0.0\",\"v=2\",\"v=2\"]}}"
+	})
+
+	It("should not roll out machines whose args only differ in order and duplicates", func() {
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, argsRCP, m)).To(BeEmpty())
+	})
+
+	It("should report a scheduler-only change", func() {
+		argsRCP.Spec.ServerConfig.KubeScheduler.ExtraArgs = []string{"v=4", "bind-address=0.0.0.0"}
+
+		Expect(matchServerConfig(argsRCP, m)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, argsRCP, m)).To(Equal(controlplanev1.SchedulerArgsChangedReason))
+	})
+
+	It("should report a kube-controller-manager change", func() {
+		argsRCP.Spec.ServerConfig.KubeControllerManager = &bootstrapv1.ComponentConfig{ExtraArgs: []string{"node-monitor-period=10s"}}
+
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, argsRCP, m)).To(Equal(controlplanev1.ControllerManagerArgsChangedReason))
+	})
+
+	It("should report a kube-apiserver change", func() {
+		argsRCP.Spec.ServerConfig.KubeAPIServer = nil
+
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, argsRCP, m)).To(Equal(controlplanev1.APIServerArgsChangedReason))
+	})
+})
+
+var _ = Describe("disabled components matching", func() {
+	var (
+		disableRCP *controlplanev1.RKE2ControlPlane
+		m          *clusterv1.Machine
+	)
+
+	BeforeEach(func() {
+		disableRCP = rcp.DeepCopy()
+		disableRCP.Spec.ServerConfig.DisableComponents = controlplanev1.DisableComponents{
+			KubernetesComponents: []controlplanev1.DisabledKubernetesComponent{controlplanev1.KubeProxy, controlplanev1.CloudController},
+			PluginComponents:     []controlplanev1.DisabledPluginComponent{controlplanev1.MetricsServer, controlplanev1.IngressNginx},
+		}
+
+		m = machine.DeepCopy()
+		m.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = "{\"cni\":\"calico\",\"cloudProviderName\":\"aws\"," +
+			"\"clusterDomain\":\"example.com\",\"disableComponents\":{\"kubernetesComponents\":[\"cloudController\",\"kubeProxy\"]," +
+			"\"pluginComponents\":[\"rke2-ingress-nginx\",\"rke2-metrics-server\",\"rke2-ingress-nginx\"]}}"
+	})
+
+	It("should not roll out machines when the disabled components are reordered", func() {
+		Expect(matchDisabledComponents(disableRCP, m)).To(BeTrue())
+		Expect(matchServerConfig(disableRCP, m)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, disableRCP, m)).To(BeEmpty())
+	})
+
+	It("should roll out machines when a component is disabled", func() {
+		disableRCP.Spec.ServerConfig.DisableComponents.PluginComponents = append(
+			disableRCP.Spec.ServerConfig.DisableComponents.PluginComponents, controlplanev1.CoreDNS)
+
+		Expect(matchDisabledComponents(disableRCP, m)).To(BeFalse())
+		Expect(matchServerConfig(disableRCP, m)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, disableRCP, m)).
+			To(Equal(controlplanev1.DisabledComponentsMismatchReason))
+	})
+})
+
+var _ = Describe("TLS SANs matching", func() {
+	var (
+		sanRCP *controlplanev1.RKE2ControlPlane
+		m      *clusterv1.Machine
+	)
+
+	BeforeEach(func() {
+		sanRCP = rcp.DeepCopy()
+		sanRCP.Spec.ServerConfig.TLSSan = []string{"api.example.com", "10.0.0.10"}
+
+		m = machine.DeepCopy()
+		m.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = "{\"cni\":\"calico\",\"cloudProviderName\":\"aws\"," +
+			"\"clusterDomain\":\"example.com\",\"tlsSan\":[\"10.0.0.10\",\"API.example.com\",\"10.0.0.10\"]}"
+	})
+
+	It("should not roll out machines when the SANs are reordered", func() {
+		Expect(matchTLSSANs(sanRCP, m)).To(BeTrue())
+		Expect(matchServerConfig(sanRCP, m)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, sanRCP, m)).To(BeEmpty())
+	})
+
+	It("should roll out machines when a SAN is added", func() {
+		sanRCP.Spec.ServerConfig.TLSSan = append(sanRCP.Spec.ServerConfig.TLSSan, "api-internal.example.com")
+
+		Expect(matchTLSSANs(sanRCP, m)).To(BeFalse())
+		Expect(matchServerConfig(sanRCP, m)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, sanRCP, m)).To(Equal(controlplanev1.TLSSANChangedReason))
+	})
+
+	It("should not roll out machines when a SAN is added in place", func() {
+		sanRCP.Annotations = map[string]string{controlplanev1.InPlaceServerConfigUpdatesAnnotation: "true"}
+		sanRCP.Spec.ServerConfig.TLSSan = append(sanRCP.Spec.ServerConfig.TLSSan, "api-internal.example.com")
+
+		Expect(matchTLSSANs(sanRCP, m)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, sanRCP, m)).To(BeEmpty())
+	})
+
+	It("should roll out machines when a SAN is removed in place", func() {
+		sanRCP.Annotations = map[string]string{controlplanev1.InPlaceServerConfigUpdatesAnnotation: "true"}
+		sanRCP.Spec.ServerConfig.TLSSan = []string{"api.example.com"}
+
+		Expect(matchTLSSANs(sanRCP, m)).To(BeFalse())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, sanRCP, m)).To(Equal(controlplanev1.TLSSANChangedReason))
+	})
+})
+
+var _ = Describe("node roles matching", func() {
+	var (
+		rolesRCP *controlplanev1.RKE2ControlPlane
+		m        *clusterv1.Machine
+	)
+
+	BeforeEach(func() {
+		rolesRCP = rcp.DeepCopy()
+		rolesRCP.Spec.ServerConfig.DisableComponents = controlplanev1.DisableComponents{
+			KubernetesComponents: []controlplanev1.DisabledKubernetesComponent{controlplanev1.Etcd},
+		}
+
+		m = machine.DeepCopy()
+		m.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = "{\"cni\":\"calico\",\"cloudProviderName\":\"aws\"," +
+			"\"clusterDomain\":\"example.com\",\"disableComponents\":{\"kubernetesComponents\":[\"etcd\"]}}"
+	})
+
+	It("should read the machine roles from the recorded server config", func() {
+		Expect(MachineNodeRoles(m)).To(Equal(NodeRoles{ControlPlane: true}))
+		Expect(RCPNodeRoles(rolesRCP)).To(Equal(NodeRoles{ControlPlane: true}))
+		Expect(HasEtcdRole()(m)).To(BeFalse())
+		Expect(HasControlPlaneRole()(m)).To(BeTrue())
+	})
+
+	It("should consider machines without a recorded server config as hosting both roles", func() {
+		delete(m.Annotations, controlplanev1.RKE2ServerConfigurationAnnotation)
+
+		Expect(MachineNodeRoles(m)).To(Equal(NodeRoles{Etcd: true, ControlPlane: true}))
+	})
+
+	It("should not roll out machines with the same roles", func() {
+		Expect(matchNodeRoles(rolesRCP, m)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, rolesRCP, m)).To(BeEmpty())
+	})
+
+	It("should roll out machines when their roles change", func() {
+		rolesRCP.Spec.ServerConfig.DisableComponents.KubernetesComponents = []controlplanev1.DisabledKubernetesComponent{
+			controlplanev1.APIServer, controlplanev1.ControllerManager, controlplanev1.Scheduler,
+		}
+
+		Expect(matchNodeRoles(rolesRCP, m)).To(BeFalse())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, rolesRCP, m)).To(Equal(controlplanev1.NodeRolesMismatchReason))
+	})
+})
+
+var _ = Describe("missing bootstrap config matching", func() {
+	var (
+		strictRCP *controlplanev1.RKE2ControlPlane
+		m         *clusterv1.Machine
+	)
+
+	BeforeEach(func() {
+		strictRCP = rcp.DeepCopy()
+		m = machine.DeepCopy()
+	})
+
+	It("should not roll out machines whose RKE2Config is missing by default", func() {
+		machineConfigs := map[string]*bootstrapv1.RKE2Config{}
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, strictRCP)(m)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, strictRCP, m)).To(BeEmpty())
+	})
+
+	It("should roll out machines whose RKE2Config is missing when the RCP opts in", func() {
+		strictRCP.Annotations = map[string]string{controlplanev1.RolloutOnMissingBootstrapConfigAnnotation: "true"}
+		machineConfigs := map[string]*bootstrapv1.RKE2Config{}
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, strictRCP)(m)).To(BeFalse())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, strictRCP, m)).
+			To(Equal(controlplanev1.BootstrapConfigMismatchReason))
+	})
+
+	It("should not roll out machines whose RKE2Config is found when the RCP opts in", func() {
+		strictRCP.Annotations = map[string]string{controlplanev1.RolloutOnMissingBootstrapConfigAnnotation: "true"}
+		machineConfigs := map[string]*bootstrapv1.RKE2Config{
+			m.Name: {Spec: *strictRCP.Spec.RKE2ConfigSpec.DeepCopy()},
+		}
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, strictRCP)(m)).To(BeTrue())
+	})
+})
+
 var _ = Describe("matchAgentConfig", func() {
 	It("should match Agent Config", func() {
 		machineConfigs := map[string]*bootstrapv1.RKE2Config{
@@ -88,7 +399,7 @@ var _ = Describe("matchAgentConfig", func() {
 		}
 		machineCollection := collections.FromMachines(&machine)
 		Expect(len(machineCollection)).To(Equal(1))
-		matches := machineCollection.AnyFilter(matchesRKE2BootstrapConfig(machineConfigs, &rcp))
+		matches := machineCollection.AnyFilter(matchesRKE2BootstrapConfig(machineConfigs, nil, &rcp))
 
 		Expect(len(matches)).To(Equal(1))
 		Expect(matches.Oldest().Name).To(Equal("machine-test"))
@@ -113,7 +424,7 @@ var _ = Describe("matchAgentConfig", func() {
 		}
 		machineCollection := collections.FromMachines(&machine)
 		Expect(len(machineCollection)).To(Equal(1))
-		matches := machineCollection.AnyFilter(matchesRKE2BootstrapConfig(machineConfigs, &rcp))
+		matches := machineCollection.AnyFilter(matchesRKE2BootstrapConfig(machineConfigs, nil, &rcp))
 
 		Expect(len(matches)).To(Equal(0))
 	},
@@ -137,7 +448,7 @@ var _ = Describe("matchAgentConfig", func() {
 		}
 		machineCollection := collections.FromMachines(&machine)
 		Expect(len(machineCollection)).To(Equal(1))
-		matches := machineCollection.AnyFilter(matchesRKE2BootstrapConfig(machineConfigs, &rcp))
+		matches := machineCollection.AnyFilter(matchesRKE2BootstrapConfig(machineConfigs, nil, &rcp))
 
 		Expect(len(matches)).To(Equal(0))
 	},
@@ -159,3 +470,1418 @@ var _ = Describe("matching Kubernetes Version", func() {
 		machine.Spec.Version = &k8sMachineVersion
 	})
 })
+
+var _ = Describe("machine up-to-date condition", func() {
+	var machineConfigs map[string]*bootstrapv1.RKE2Config
+
+	BeforeEach(func() {
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {
+				Spec: bootstrapv1.RKE2ConfigSpec{
+					AgentConfig: bootstrapv1.RKE2AgentConfig{
+						NodeLabels: []string{"hello=world"},
+					},
+				},
+			},
+		}
+	})
+
+	It("should report no mismatch reason for an up-to-date machine", func() {
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, &rcp, &machine)).To(BeEmpty())
+	})
+
+	It("should report the failing matcher as the mismatch reason", func() {
+		outdatedVersion := "v1.23.1"
+		versionMismatch := machine.DeepCopy()
+		versionMismatch.Spec.Version = &outdatedVersion
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, &rcp, versionMismatch)).
+			To(Equal(controlplanev1.VersionMismatchReason))
+
+		serverConfigMismatch := machine.DeepCopy()
+		serverConfigMismatch.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = "{\"cni\":\"cilium\"}"
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, &rcp, serverConfigMismatch)).
+			To(Equal(controlplanev1.ServerConfigMismatchReason))
+
+		machineConfigs["machine-test"].Spec.PreRKE2Commands = []string{"test"}
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, &rcp, &machine)).
+			To(Equal(controlplanev1.BootstrapConfigMismatchReason))
+	})
+
+	It("should set and clear the UpToDate condition on machines", func() {
+		m := machine.DeepCopy()
+		cp := &ControlPlane{
+			RCP:         &rcp,
+			Machines:    collections.FromMachines(m),
+			Rke2Configs: machineConfigs,
+		}
+
+		machineConfigs["machine-test"].Spec.PreRKE2Commands = []string{"test"}
+		cp.UpdateMachinesUpToDateCondition()
+		Expect(conditions.IsFalse(m, controlplanev1.MachineUpToDateCondition)).To(BeTrue())
+		Expect(conditions.GetReason(m, controlplanev1.MachineUpToDateCondition)).
+			To(Equal(controlplanev1.BootstrapConfigMismatchReason))
+
+		machineConfigs["machine-test"].Spec.PreRKE2Commands = nil
+		cp.UpdateMachinesUpToDateCondition()
+		Expect(conditions.IsTrue(m, controlplanev1.MachineUpToDateCondition)).To(BeTrue())
+		Expect(conditions.GetReason(m, controlplanev1.MachineUpToDateCondition)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("additional rollout matchers", func() {
+	var (
+		machineConfigs map[string]*bootstrapv1.RKE2Config
+		hasNoOSLabel   collections.Func
+	)
+
+	BeforeEach(func() {
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: *rcp.Spec.RKE2ConfigSpec.DeepCopy()},
+		}
+		hasNoOSLabel = func(machine *clusterv1.Machine) bool {
+			_, ok := machine.Labels["example.com/os-image"]
+
+			return !ok
+		}
+	})
+
+	It("should roll out machines which do not satisfy an additional matcher", func() {
+		m := machine.DeepCopy()
+		Expect(matchesRCPConfiguration(nil, machineConfigs, nil, &rcp, hasNoOSLabel)(m)).To(BeTrue())
+
+		m.Labels = map[string]string{"example.com/os-image": "sle-micro-5.5"}
+		Expect(matchesRCPConfiguration(nil, machineConfigs, nil, &rcp)(m)).To(BeTrue())
+		Expect(matchesRCPConfiguration(nil, machineConfigs, nil, &rcp, nil, hasNoOSLabel)(m)).To(BeFalse())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, &rcp, m, hasNoOSLabel)).
+			To(Equal(controlplanev1.CustomRolloutCriteriaMismatchReason))
+	})
+
+	It("should report built-in mismatches before additional ones", func() {
+		m := machine.DeepCopy()
+		m.Labels = map[string]string{"example.com/os-image": "sle-micro-5.5"}
+		machineConfigs["machine-test"].Spec.PreRKE2Commands = []string{"test"}
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, &rcp, m, hasNoOSLabel)).
+			To(Equal(controlplanev1.BootstrapConfigMismatchReason))
+	})
+
+	It("should take the control plane additional matchers into account", func() {
+		m := machine.DeepCopy()
+		m.Labels = map[string]string{"example.com/os-image": "sle-micro-5.5"}
+		cp := &ControlPlane{
+			RCP:                       &rcp,
+			Machines:                  collections.FromMachines(m),
+			Rke2Configs:               machineConfigs,
+			AdditionalRolloutMatchers: []collections.Func{hasNoOSLabel},
+		}
+
+		Expect(cp.MachinesNeedingRollout().Names()).To(ConsistOf("machine-test"))
+		Expect(cp.UpToDateMachines()).To(BeEmpty())
+
+		cp.UpdateMachinesUpToDateCondition()
+		Expect(conditions.GetReason(m, controlplanev1.MachineUpToDateCondition)).
+			To(Equal(controlplanev1.CustomRolloutCriteriaMismatchReason))
+	})
+})
+
+var _ = Describe("server defaults matching", func() {
+	It("should roll out machines when the server defaults change", func() {
+		defaultsRCP := rcp.DeepCopy()
+		defaultsRCP.Annotations = map[string]string{controlplanev1.ServerDefaultsHashAnnotation: "new-hash"}
+
+		upToDate := machine.DeepCopy()
+		upToDate.Annotations[controlplanev1.ServerDefaultsHashAnnotation] = "new-hash"
+		Expect(matchServerDefaults(nil, defaultsRCP, upToDate)).To(BeTrue())
+
+		outdated := machine.DeepCopy()
+		outdated.Annotations[controlplanev1.ServerDefaultsHashAnnotation] = "old-hash"
+		Expect(matchServerDefaults(nil, defaultsRCP, outdated)).To(BeFalse())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, defaultsRCP, outdated)).
+			To(Equal(controlplanev1.ServerDefaultsMismatchReason))
+	})
+
+	It("should not roll out machines without a recorded defaults hash", func() {
+		defaultsRCP := rcp.DeepCopy()
+		defaultsRCP.Annotations = map[string]string{controlplanev1.ServerDefaultsHashAnnotation: "new-hash"}
+
+		Expect(matchServerDefaults(nil, defaultsRCP, &machine)).To(BeTrue())
+	})
+
+	It("should prefer the defaults hash the bootstrap data was rendered with", func() {
+		defaultsRCP := rcp.DeepCopy()
+		defaultsRCP.Annotations = map[string]string{controlplanev1.ServerDefaultsHashAnnotation: "new-hash"}
+
+		// The defaults changed between the creation of the machine and the rendering of its bootstrap data.
+		configured := machine.DeepCopy()
+		configured.Annotations[controlplanev1.ServerDefaultsHashAnnotation] = "old-hash"
+		machineConfigs := map[string]*bootstrapv1.RKE2Config{
+			configured.Name: {ObjectMeta: v1.ObjectMeta{
+				Annotations: map[string]string{controlplanev1.ServerDefaultsHashAnnotation: "new-hash"},
+			}},
+		}
+		Expect(matchServerDefaults(machineConfigs, defaultsRCP, configured)).To(BeTrue())
+
+		machineConfigs[configured.Name].Annotations[controlplanev1.ServerDefaultsHashAnnotation] = "old-hash"
+		configured.Annotations[controlplanev1.ServerDefaultsHashAnnotation] = "new-hash"
+		Expect(matchServerDefaults(machineConfigs, defaultsRCP, configured)).To(BeFalse())
+	})
+})
+
+var _ = Describe("registration address matching", func() {
+	var addressRCP *controlplanev1.RKE2ControlPlane
+
+	BeforeEach(func() {
+		addressRCP = rcp.DeepCopy()
+		addressRCP.Spec.RegistrationMethod = controlplanev1.RegistrationMethodAddress
+		addressRCP.Spec.RegistrationAddress = "lb.example.com"
+	})
+
+	It("should roll out machines when the registration address changes", func() {
+		configured := machine.DeepCopy()
+		configured.Annotations[controlplanev1.RegistrationAddressAnnotation] = "lb.example.com"
+		Expect(matchRegistrationAddress(addressRCP, configured)).To(BeTrue())
+
+		addressRCP.Spec.RegistrationAddress = "new-lb.example.com"
+		Expect(matchRegistrationAddress(addressRCP, configured)).To(BeFalse())
+		Expect(rcpConfigurationMismatchReason(nil, nil, nil, addressRCP, configured)).
+			To(Equal(controlplanev1.RegistrationAddressChangedReason))
+	})
+
+	It("should roll out machines when the registration address is set or unset", func() {
+		nodeIPs := machine.DeepCopy()
+		nodeIPs.Annotations[controlplanev1.RegistrationAddressAnnotation] = ""
+		Expect(matchRegistrationAddress(addressRCP, nodeIPs)).To(BeFalse())
+		Expect(matchRegistrationAddress(&rcp, nodeIPs)).To(BeTrue())
+
+		fixedAddress := machine.DeepCopy()
+		fixedAddress.Annotations[controlplanev1.RegistrationAddressAnnotation] = "lb.example.com"
+		Expect(matchRegistrationAddress(&rcp, fixedAddress)).To(BeFalse())
+	})
+
+	It("should ignore the case and surrounding spaces of the address", func() {
+		configured := machine.DeepCopy()
+		configured.Annotations[controlplanev1.RegistrationAddressAnnotation] = "lb.example.com"
+		addressRCP.Spec.RegistrationAddress = " LB.example.com "
+
+		Expect(matchRegistrationAddress(addressRCP, configured)).To(BeTrue())
+	})
+
+	It("should not roll out machines without a recorded registration address", func() {
+		Expect(matchRegistrationAddress(addressRCP, &machine)).To(BeTrue())
+	})
+
+	It("should roll out machines when the resolved control plane endpoint changes", func() {
+		endpointRCP := rcp.DeepCopy()
+		endpointRCP.Spec.RegistrationMethod = controlplanev1.RegistrationMethodControlPlaneEndpoint
+		endpointRCP.Status.AvailableServerIPs = []string{"cp.example.com"}
+
+		configured := machine.DeepCopy()
+		configured.Annotations[controlplanev1.RegistrationAddressAnnotation] = "cp.example.com"
+		configured.Annotations[controlplanev1.RegistrationMethodAnnotation] = string(controlplanev1.RegistrationMethodControlPlaneEndpoint)
+		Expect(matchRegistrationAddress(endpointRCP, configured)).To(BeTrue())
+
+		endpointRCP.Status.AvailableServerIPs = []string{"new-cp.example.com"}
+		Expect(matchRegistrationAddress(endpointRCP, configured)).To(BeFalse())
+
+		endpointRCP.Status.AvailableServerIPs = nil
+		Expect(matchRegistrationAddress(endpointRCP, configured)).To(BeTrue())
+	})
+
+	It("should only compare the registration method of machines registered with a node IP", func() {
+		nodeIPRCP := rcp.DeepCopy()
+		nodeIPRCP.Spec.RegistrationMethod = controlplanev1.RegistrationMethodInternalIPs
+		nodeIPRCP.Status.AvailableServerIPs = []string{"10.0.0.2"}
+
+		configured := machine.DeepCopy()
+		configured.Annotations[controlplanev1.RegistrationAddressAnnotation] = "10.0.0.1"
+		configured.Annotations[controlplanev1.RegistrationMethodAnnotation] = string(controlplanev1.RegistrationMethodFavourInternalIPs)
+		Expect(matchRegistrationAddress(nodeIPRCP, configured)).To(BeTrue())
+
+		Expect(matchRegistrationAddress(addressRCP, configured)).To(BeFalse())
+
+		configured.Annotations[controlplanev1.RegistrationAddressAnnotation] = "lb.example.com"
+		configured.Annotations[controlplanev1.RegistrationMethodAnnotation] = string(controlplanev1.RegistrationMethodAddress)
+		Expect(matchRegistrationAddress(nodeIPRCP, configured)).To(BeFalse())
+	})
+})
+
+var _ = Describe("extra args normalization", func() {
+	It("should match when kubelet extra args only differ in order", func() {
+		rcpWithArgs := rcp.DeepCopy()
+		rcpWithArgs.Spec.AgentConfig.Kubelet = &bootstrapv1.ComponentConfig{
+			ExtraArgs: []string{"max-pods=200", "node-status-update-frequency=10s"},
+		}
+		machineConfigs := map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {
+				Spec: bootstrapv1.RKE2ConfigSpec{
+					AgentConfig: bootstrapv1.RKE2AgentConfig{
+						NodeLabels: []string{"hello=world"},
+						Kubelet: &bootstrapv1.ComponentConfig{
+							ExtraArgs: []string{"node-status-update-frequency=10s", "max-pods=200", "max-pods=200"},
+						},
+					},
+				},
+			},
+		}
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, rcpWithArgs)(&machine)).To(BeTrue())
+		Expect(rcpWithArgs.Spec.AgentConfig.Kubelet.ExtraArgs).To(Equal([]string{"max-pods=200", "node-status-update-frequency=10s"}))
+		Expect(machineConfigs["machine-test"].Spec.AgentConfig.Kubelet.ExtraArgs).
+			To(Equal([]string{"node-status-update-frequency=10s", "max-pods=200", "max-pods=200"}))
+	})
+
+	It("should not match when kubelet extra args differ", func() {
+		rcpWithArgs := rcp.DeepCopy()
+		rcpWithArgs.Spec.AgentConfig.Kubelet = &bootstrapv1.ComponentConfig{
+			ExtraArgs: []string{"max-pods=200"},
+		}
+		machineConfigs := map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {
+				Spec: bootstrapv1.RKE2ConfigSpec{
+					AgentConfig: bootstrapv1.RKE2AgentConfig{
+						NodeLabels: []string{"hello=world"},
+						Kubelet: &bootstrapv1.ComponentConfig{
+							ExtraArgs: []string{"max-pods=110"},
+						},
+					},
+				},
+			},
+		}
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, rcpWithArgs)(&machine)).To(BeFalse())
+	})
+
+	It("should match when kube-apiserver extra args only differ in order", func() {
+		rcpWithArgs := rcp.DeepCopy()
+		rcpWithArgs.Spec.ServerConfig.KubeAPIServer = &bootstrapv1.ComponentConfig{
+			ExtraArgs: []string{"audit-log-maxage=30", "anonymous-auth=false"},
+		}
+		m := machine.DeepCopy()
+		m.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = "{\"cni\":\"calico\",\"cloudProviderName\":\"aws\"," +
+			"\"clusterDomain\":\"example.com\",\"kubeAPIServer\":{\"extraArgs\":[\"anonymous-auth=false\",\"audit-log-maxage=30\"]}}"
+
+		Expect(matchServerConfig(rcpWithArgs, m)).To(BeTrue())
+		Expect(rcpWithArgs.Spec.ServerConfig.KubeAPIServer.ExtraArgs).To(Equal([]string{"audit-log-maxage=30", "anonymous-auth=false"}))
+	})
+
+	It("should compare repeated args by their last value", func() {
+		Expect(normalizeArgs([]string{"v=2", "audit-log-maxage=30", "v=4"})).To(Equal([]string{"audit-log-maxage=30", "v=4"}))
+		Expect(normalizeArgs([]string{"v=2", "v=4"})).ToNot(Equal(normalizeArgs([]string{"v=4", "v=2"})))
+	})
+
+	It("should compare the entries of set-like args as sets", func() {
+		Expect(normalizeArgs([]string{
+			"enable-admission-plugins=PodSecurity,NodeRestriction",
+			"service-account-key-file=/etc/sa-2.pub",
+			"service-account-key-file=/etc/sa-1.pub",
+		})).To(Equal(normalizeArgs([]string{
+			"service-account-key-file=/etc/sa-1.pub",
+			"enable-admission-plugins=NodeRestriction",
+			"service-account-key-file=/etc/sa-2.pub",
+			"enable-admission-plugins=PodSecurity,NodeRestriction",
+		})))
+
+		Expect(normalizeArgs([]string{"service-account-key-file=/etc/sa-1.pub", "service-account-key-file=/etc/sa-2.pub"})).
+			ToNot(Equal(normalizeArgs([]string{"service-account-key-file=/etc/sa-2.pub"})))
+	})
+})
+
+var _ = Describe("node taints normalization", func() {
+	newMachineConfigs := func(taints ...string) map[string]*bootstrapv1.RKE2Config {
+		return map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {
+				Spec: bootstrapv1.RKE2ConfigSpec{
+					AgentConfig: bootstrapv1.RKE2AgentConfig{
+						NodeLabels: []string{"hello=world"},
+						NodeTaints: taints,
+					},
+				},
+			},
+		}
+	}
+
+	It("should not roll out when the taints only differ in order", func() {
+		rcpWithTaints := rcp.DeepCopy()
+		rcpWithTaints.Spec.AgentConfig.NodeTaints = []string{
+			"node-role.kubernetes.io/control-plane=true:NoSchedule",
+			"dedicated=infra:NoExecute",
+			"dedicated=infra:NoSchedule",
+		}
+		machineConfigs := newMachineConfigs(
+			"dedicated=infra:NoSchedule",
+			"node-role.kubernetes.io/control-plane=true:NoSchedule",
+			"dedicated=infra:NoExecute",
+		)
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, rcpWithTaints)(&machine)).To(BeTrue())
+		Expect(rcpWithTaints.Spec.AgentConfig.NodeTaints[0]).To(Equal("node-role.kubernetes.io/control-plane=true:NoSchedule"))
+		Expect(machineConfigs["machine-test"].Spec.AgentConfig.NodeTaints[0]).To(Equal("dedicated=infra:NoSchedule"))
+	})
+
+	It("should roll out when a taint is added", func() {
+		rcpWithTaints := rcp.DeepCopy()
+		rcpWithTaints.Spec.AgentConfig.NodeTaints = []string{
+			"dedicated=infra:NoSchedule",
+			"node-role.kubernetes.io/control-plane=true:NoSchedule",
+		}
+		machineConfigs := newMachineConfigs("dedicated=infra:NoSchedule")
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, rcpWithTaints)(&machine)).To(BeFalse())
+	})
+
+	It("should sort taints by key, value and effect", func() {
+		Expect(normalizeTaints([]string{"b=1:NoSchedule", "a=2:NoSchedule", "a=1:PreferNoSchedule", "a=1:NoExecute", "a:NoSchedule"})).
+			To(Equal([]string{"a:NoSchedule", "a=1:NoExecute", "a=1:PreferNoSchedule", "a=2:NoSchedule", "b=1:NoSchedule"}))
+	})
+})
+
+var _ = Describe("control plane machine filter", func() {
+	It("should only match machines with the control plane label", func() {
+		controlPlaneMachine := &clusterv1.Machine{ObjectMeta: v1.ObjectMeta{
+			Name:   "control-plane",
+			Labels: ControlPlaneLabelsForCluster("rke2-cluster"),
+		}}
+		workerMachine := &clusterv1.Machine{ObjectMeta: v1.ObjectMeta{
+			Name:   "worker",
+			Labels: map[string]string{clusterv1.ClusterNameLabel: "rke2-cluster"},
+		}}
+
+		Expect(IsControlPlaneMachine(controlPlaneMachine)).To(BeTrue())
+		Expect(IsControlPlaneMachine(workerMachine)).To(BeFalse())
+		Expect(IsControlPlaneMachine(&clusterv1.Machine{})).To(BeFalse())
+		Expect(IsControlPlaneMachine(nil)).To(BeFalse())
+
+		machines := collections.FromMachines(controlPlaneMachine, workerMachine)
+		Expect(machines.Filter(IsControlPlaneMachine).Names()).To(ConsistOf("control-plane"))
+		Expect(machines.Filter(collections.Not(IsControlPlaneMachine)).Names()).To(ConsistOf("worker"))
+	})
+})
+
+var _ = Describe("provider ID filters", func() {
+	newMachine := func(name string, providerID *string) *clusterv1.Machine {
+		return &clusterv1.Machine{
+			ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "example"},
+			Spec:       clusterv1.MachineSpec{ProviderID: providerID},
+		}
+	}
+
+	var machines collections.Machines
+
+	BeforeEach(func() {
+		providerID := "aws:///eu-central-1a/i-0123456789abcdef0"
+		emptyProviderID := ""
+
+		machines = collections.FromMachines(
+			newMachine("provisioned", &providerID),
+			newMachine("no-provider-id", nil),
+			newMachine("empty-provider-id", &emptyProviderID),
+		)
+	})
+
+	It("should only match machines with a ProviderID", func() {
+		Expect(machines.Filter(HasProviderID()).Names()).To(ConsistOf("provisioned"))
+	})
+
+	It("should match machines without a ProviderID or with an empty one", func() {
+		Expect(machines.Filter(NeedsProviderID()).Names()).To(ConsistOf("no-provider-id", "empty-provider-id"))
+	})
+})
+
+var _ = Describe("bootstrap data secret machine filter", func() {
+	newMachine := func(name string, dataSecretName *string) *clusterv1.Machine {
+		return &clusterv1.Machine{
+			ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "example"},
+			Spec:       clusterv1.MachineSpec{Bootstrap: clusterv1.Bootstrap{DataSecretName: dataSecretName}},
+		}
+	}
+
+	newSecret := func(name string, data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "example"}, Data: data}
+	}
+
+	It("should only match machines whose bootstrap data secret is populated", func() {
+		reader := fake.NewClientBuilder().WithObjects(
+			newSecret("populated", map[string][]byte{"value": []byte("#cloud-config")}),
+			newSecret("empty", map[string][]byte{"value": {}}),
+			newSecret("no-value", nil),
+		).Build()
+
+		machines := collections.FromMachines(
+			newMachine("populated", ptr.To("populated")),
+			newMachine("empty", ptr.To("empty")),
+			newMachine("no-value", ptr.To("no-value")),
+			newMachine("missing", ptr.To("missing")),
+			newMachine("no-secret-name", nil),
+		)
+
+		Expect(machines.Filter(HasBootstrapDataSecret(context.Background(), reader)).Names()).To(ConsistOf("populated"))
+	})
+})
+
+var _ = Describe("ignored RKE2Config fields", func() {
+	newMachineConfigs := func(mutate func(spec *bootstrapv1.RKE2ConfigSpec)) map[string]*bootstrapv1.RKE2Config {
+		spec := rcp.Spec.RKE2ConfigSpec.DeepCopy()
+		mutate(spec)
+
+		return map[string]*bootstrapv1.RKE2Config{"machine-test": {Spec: *spec}}
+	}
+	rcpIgnoring := func(fields string) *controlplanev1.RKE2ControlPlane {
+		rcpWithAnnotation := rcp.DeepCopy()
+		rcpWithAnnotation.Annotations = map[string]string{controlplanev1.RKE2ConfigIgnoreFieldsAnnotation: fields}
+
+		return rcpWithAnnotation
+	}
+
+	It("should ignore top-level and nested fields listed in the annotation", func() {
+		machineConfigs := newMachineConfigs(func(spec *bootstrapv1.RKE2ConfigSpec) {
+			spec.AgentConfig.NodeNamePrefix = "node-1"
+			spec.PreRKE2Commands = []string{"hostnamectl set-hostname node-1"}
+		})
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, &rcp)(&machine)).To(BeFalse())
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, rcpIgnoring("AgentConfig.NodeName, PreRKE2Commands"))(&machine)).To(BeTrue())
+		Expect(machineConfigs["machine-test"].Spec.AgentConfig.NodeNamePrefix).To(Equal("node-1"))
+	})
+
+	It("should ignore fields behind pointers", func() {
+		rcpWithKubeletArgs := rcpIgnoring("agentConfig.kubelet.extraArgs")
+		rcpWithKubeletArgs.Spec.AgentConfig.Kubelet = &bootstrapv1.ComponentConfig{ExtraArgs: []string{"max-pods=110"}}
+		machineConfigs := newMachineConfigs(func(spec *bootstrapv1.RKE2ConfigSpec) {
+			spec.AgentConfig.Kubelet = &bootstrapv1.ComponentConfig{ExtraArgs: []string{"max-pods=110", "hostname-override=node-1"}}
+		})
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, rcpWithKubeletArgs)(&machine)).To(BeTrue())
+	})
+
+	It("should still compare fields which are not ignored", func() {
+		machineConfigs := newMachineConfigs(func(spec *bootstrapv1.RKE2ConfigSpec) {
+			spec.AgentConfig.NodeNamePrefix = "node-1"
+			spec.AgentConfig.NodeLabels = []string{"hello=node-1"}
+		})
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, rcpIgnoring("AgentConfig.NodeName"))(&machine)).To(BeFalse())
+	})
+
+	It("should skip unknown field paths", func() {
+		machineConfigs := newMachineConfigs(func(spec *bootstrapv1.RKE2ConfigSpec) {
+			spec.PreRKE2Commands = []string{"hostnamectl set-hostname node-1"}
+		})
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, rcpIgnoring("AgentConfig.DoesNotExist,Files.Path,PreRKE2Commands"))(&machine)).
+			To(BeTrue())
+	})
+
+	It("should reject invalid field paths", func() {
+		specType := reflect.TypeOf(bootstrapv1.RKE2ConfigSpec{})
+
+		_, err := resolveFieldPath(specType, "AgentConfig.DoesNotExist")
+		Expect(err).To(HaveOccurred())
+
+		_, err = resolveFieldPath(specType, "PreRKE2Commands.Foo")
+		Expect(err).To(HaveOccurred())
+
+		field, err := resolveFieldPath(specType, "AgentConfig.NodeName")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(field).To(HaveLen(2))
+	})
+
+	It("should not roll out machines when a field ignored by the controller changes", func() {
+		m := machine.DeepCopy()
+		machineConfigs := newMachineConfigs(func(spec *bootstrapv1.RKE2ConfigSpec) {
+			spec.PreRKE2Commands = []string{"hostnamectl set-hostname node-1"}
+			spec.AgentConfig.NodeNamePrefix = "node-1"
+		})
+		cp := &ControlPlane{
+			RCP:         rcpIgnoring("AgentConfig.NodeName"),
+			Machines:    collections.FromMachines(m),
+			Rke2Configs: machineConfigs,
+		}
+
+		Expect(cp.MachinesNeedingRollout().Names()).To(ConsistOf("machine-test"))
+
+		cp.RolloutIgnoredRKE2ConfigFields = []string{"PreRKE2Commands"}
+		Expect(cp.MachinesNeedingRollout()).To(BeEmpty())
+		Expect(cp.UpToDateMachines().Names()).To(ConsistOf("machine-test"))
+
+		cp.UpdateMachinesUpToDateCondition()
+		Expect(conditions.IsTrue(m, controlplanev1.MachineUpToDateCondition)).To(BeTrue())
+
+		// The annotation of the RCP is left untouched.
+		Expect(cp.RCP.Annotations).To(Equal(map[string]string{controlplanev1.RKE2ConfigIgnoreFieldsAnnotation: "AgentConfig.NodeName"}))
+	})
+
+	It("should validate the field paths ignored by the controller", func() {
+		Expect(ValidateRKE2ConfigFieldPaths([]string{"PreRKE2Commands", " agentConfig.kubelet.extraArgs", ""})).To(Succeed())
+		Expect(ValidateRKE2ConfigFieldPaths([]string{"AgentConfig.DoesNotExist"})).
+			To(MatchError(ContainSubstring(`invalid RKE2ConfigSpec field path "AgentConfig.DoesNotExist"`)))
+	})
+})
+
+var _ = Describe("injected RKE2 commands", func() {
+	rcpInjecting := func(commands string) *controlplanev1.RKE2ControlPlane {
+		rcpWithCommands := rcp.DeepCopy()
+		rcpWithCommands.Spec.PreRKE2Commands = []string{"modprobe br_netfilter", "sysctl --system"}
+		rcpWithCommands.Spec.PostRKE2Commands = []string{"touch /run/rke2-ready"}
+		rcpWithCommands.Annotations = map[string]string{controlplanev1.RKE2ConfigInjectedCommandsAnnotation: commands}
+
+		return rcpWithCommands
+	}
+	machineConfigs := func(preCommands, postCommands []string) map[string]*bootstrapv1.RKE2Config {
+		spec := rcp.Spec.RKE2ConfigSpec.DeepCopy()
+		spec.PreRKE2Commands = preCommands
+		spec.PostRKE2Commands = postCommands
+
+		return map[string]*bootstrapv1.RKE2Config{"machine-test": {Spec: *spec}}
+	}
+
+	It("should ignore injected commands", func() {
+		rcpWithCommands := rcpInjecting(`["sh /opt/provisioner/register.sh", "echo provisioned"]`)
+		configs := machineConfigs(
+			[]string{"sh /opt/provisioner/register.sh", "modprobe br_netfilter", "sysctl --system"},
+			[]string{"touch /run/rke2-ready", "echo provisioned"},
+		)
+
+		Expect(matchesRKE2BootstrapConfig(configs, nil, rcpWithCommands)(&machine)).To(BeTrue())
+		Expect(matchesRKE2BootstrapConfig(configs, nil, rcpInjecting(`[]`))(&machine)).To(BeFalse())
+	})
+
+	It("should still compare the order of the user commands", func() {
+		rcpWithCommands := rcpInjecting(`["sh /opt/provisioner/register.sh"]`)
+		configs := machineConfigs(
+			[]string{"sysctl --system", "sh /opt/provisioner/register.sh", "modprobe br_netfilter"},
+			[]string{"touch /run/rke2-ready"},
+		)
+
+		Expect(matchesRKE2BootstrapConfig(configs, nil, rcpWithCommands)(&machine)).To(BeFalse())
+	})
+
+	It("should ignore an invalid annotation", func() {
+		configs := machineConfigs(
+			[]string{"sh /opt/provisioner/register.sh", "modprobe br_netfilter", "sysctl --system"},
+			[]string{"touch /run/rke2-ready"},
+		)
+
+		Expect(matchesRKE2BootstrapConfig(configs, nil, rcpInjecting("sh /opt/provisioner/register.sh"))(&machine)).To(BeFalse())
+	})
+})
+
+var _ = Describe("templated RKE2Config fields", func() {
+	var (
+		templatedRCP   *controlplanev1.RKE2ControlPlane
+		machineConfigs map[string]*bootstrapv1.RKE2Config
+	)
+
+	BeforeEach(func() {
+		templatedRCP = rcp.DeepCopy()
+		templatedRCP.Annotations = map[string]string{controlplanev1.RKE2ConfigTemplatedFieldsAnnotation: "AgentConfig.NodeLabels"}
+		templatedRCP.Spec.AgentConfig.NodeLabels = []string{"hello=world", "machine={{ .MachineName }}"}
+
+		spec := templatedRCP.Spec.RKE2ConfigSpec.DeepCopy()
+		spec.AgentConfig.NodeLabels = []string{"hello=world", "machine=machine-test"}
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{"machine-test": {Spec: *spec}}
+	})
+
+	It("should not roll out machines whose node label is rendered for them", func() {
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, templatedRCP, &machine)).To(BeEmpty())
+	})
+
+	It("should roll out machines when the template changes", func() {
+		templatedRCP.Spec.AgentConfig.NodeLabels[1] = "machine={{ .ClusterName }}-{{ .MachineName }}"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, templatedRCP, &machine)).
+			To(Equal(controlplanev1.BootstrapConfigMismatchReason))
+	})
+
+	It("should compare the templates unrendered without the annotation", func() {
+		templatedRCP.Annotations = nil
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, templatedRCP, &machine)).
+			To(Equal(controlplanev1.BootstrapConfigMismatchReason))
+	})
+
+	It("should render the templated fields compared by the dedicated matchers", func() {
+		templatedRCP.Annotations[controlplanev1.RKE2ConfigTemplatedFieldsAnnotation] = "AgentConfig.NodeLabels,AgentConfig.Kubelet.ExtraArgs"
+		templatedRCP.Spec.AgentConfig.Kubelet = &bootstrapv1.ComponentConfig{
+			ExtraArgs: []string{"hostname-override={{ .MachineName }}"},
+		}
+		machineConfigs["machine-test"].Spec.AgentConfig.Kubelet = &bootstrapv1.ComponentConfig{
+			ExtraArgs: []string{"hostname-override=machine-test"},
+		}
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, templatedRCP, &machine)).To(BeEmpty())
+
+		templatedRCP.Annotations[controlplanev1.RKE2ConfigTemplatedFieldsAnnotation] = "AgentConfig.NodeLabels"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, templatedRCP, &machine)).
+			To(Equal(controlplanev1.KubeletConfigChangedReason))
+	})
+
+	It("should render the templated fields for a machine", func() {
+		rendered, err := RenderRKE2ConfigTemplates(templatedRCP, &templatedRCP.Spec.RKE2ConfigSpec,
+			RKE2ConfigTemplateData{MachineName: "machine-1", ClusterName: "rke2-cluster"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rendered.AgentConfig.NodeLabels).To(Equal([]string{"hello=world", "machine=machine-1"}))
+		Expect(templatedRCP.Spec.AgentConfig.NodeLabels[1]).To(Equal("machine={{ .MachineName }}"))
+	})
+
+	It("should fail to render fields which are not strings or unknown keys", func() {
+		templatedRCP.Annotations[controlplanev1.RKE2ConfigTemplatedFieldsAnnotation] = "AgentConfig.Kubelet"
+		templatedRCP.Spec.AgentConfig.Kubelet = &bootstrapv1.ComponentConfig{}
+
+		_, err := RenderRKE2ConfigTemplates(templatedRCP, &templatedRCP.Spec.RKE2ConfigSpec, RKE2ConfigTemplateData{})
+		Expect(err).To(MatchError(ContainSubstring("only strings and lists of strings can be templated")))
+
+		templatedRCP.Annotations[controlplanev1.RKE2ConfigTemplatedFieldsAnnotation] = "AgentConfig.NodeLabels"
+		templatedRCP.Spec.AgentConfig.NodeLabels = []string{"zone={{ .Zone }}"}
+
+		_, err = RenderRKE2ConfigTemplates(templatedRCP, &templatedRCP.Spec.RKE2ConfigSpec, RKE2ConfigTemplateData{})
+		Expect(err).To(MatchError(ContainSubstring(`failed to render RKE2ConfigSpec field "AgentConfig.NodeLabels"`)))
+	})
+})
+
+var _ = Describe("RKE2ConfigSpec hash", func() {
+	newSpec := func(args, taints []string) *bootstrapv1.RKE2ConfigSpec {
+		spec := rcp.Spec.RKE2ConfigSpec.DeepCopy()
+		spec.AgentConfig.Kubelet = &bootstrapv1.ComponentConfig{ExtraArgs: args}
+		spec.AgentConfig.NodeTaints = taints
+		spec.AgentConfig.NodeAnnotations = map[string]string{}
+
+		for i := range 32 {
+			spec.AgentConfig.NodeAnnotations[fmt.Sprintf("example.com/annotation-%d", i)] = strconv.Itoa(i)
+		}
+
+		return spec
+	}
+
+	It("should be stable", func() {
+		spec := newSpec([]string{"max-pods=110"}, []string{"dedicated=infra:NoSchedule"})
+
+		expected, err := RKE2ConfigSpecHash(spec)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(expected).ToNot(BeEmpty())
+
+		for range 10 {
+			Expect(RKE2ConfigSpecHash(spec.DeepCopy())).To(Equal(expected))
+		}
+	})
+
+	It("should not change when set-like fields are reordered", func() {
+		hash, err := RKE2ConfigSpecHash(newSpec(
+			[]string{"max-pods=110", "v=2"},
+			[]string{"dedicated=infra:NoSchedule", "node-role.kubernetes.io/control-plane=true:NoSchedule"}))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(RKE2ConfigSpecHash(newSpec(
+			[]string{"v=2", "max-pods=110"},
+			[]string{"node-role.kubernetes.io/control-plane=true:NoSchedule", "dedicated=infra:NoSchedule"}))).To(Equal(hash))
+	})
+
+	It("should change when the spec changes", func() {
+		hash, err := RKE2ConfigSpecHash(newSpec([]string{"max-pods=110"}, nil))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(RKE2ConfigSpecHash(newSpec([]string{"max-pods=250"}, nil))).ToNot(Equal(hash))
+	})
+
+	It("should match machines annotated with the current hash without comparing the spec", func() {
+		hash, err := RKE2ConfigSpecHash(&rcp.Spec.RKE2ConfigSpec)
+		Expect(err).ToNot(HaveOccurred())
+
+		hashedMachine := machine.DeepCopy()
+		hashedMachine.Annotations[controlplanev1.RKE2ConfigSpecHashAnnotation] = hash
+		driftedConfigs := map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: bootstrapv1.RKE2ConfigSpec{PreRKE2Commands: []string{"echo drift"}}},
+		}
+
+		Expect(matchesRKE2BootstrapConfig(driftedConfigs, nil, &rcp)(hashedMachine)).To(BeTrue())
+	})
+
+	It("should fall back to comparing the spec when the hash differs", func() {
+		staleMachine := machine.DeepCopy()
+		staleMachine.Annotations[controlplanev1.RKE2ConfigSpecHashAnnotation] = "stale"
+
+		matchingConfigs := map[string]*bootstrapv1.RKE2Config{"machine-test": {Spec: *rcp.Spec.RKE2ConfigSpec.DeepCopy()}}
+		Expect(matchesRKE2BootstrapConfig(matchingConfigs, nil, &rcp)(staleMachine)).To(BeTrue())
+
+		driftedConfigs := map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: bootstrapv1.RKE2ConfigSpec{PreRKE2Commands: []string{"echo drift"}}},
+		}
+		Expect(matchesRKE2BootstrapConfig(driftedConfigs, nil, &rcp)(staleMachine)).To(BeFalse())
+	})
+})
+
+var _ = Describe("registries config matching", func() {
+	var (
+		registriesRCP  *controlplanev1.RKE2ControlPlane
+		machineConfigs map[string]*bootstrapv1.RKE2Config
+	)
+
+	BeforeEach(func() {
+		registriesRCP = rcp.DeepCopy()
+		registriesRCP.Spec.AgentConfig.SystemDefaultRegistry = "registry.example.com"
+		registriesRCP.Spec.PrivateRegistriesConfig = bootstrapv1.Registry{
+			Mirrors: map[string]bootstrapv1.Mirror{
+				"docker.io": {Endpoint: []string{"https://registry.example.com", "https://mirror.example.com"}},
+				"quay.io":   {Endpoint: []string{"https://registry.example.com"}},
+			},
+		}
+
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: *registriesRCP.Spec.RKE2ConfigSpec.DeepCopy()},
+		}
+	})
+
+	It("should not roll out machines when the mirror endpoints are reordered", func() {
+		machineConfigs["machine-test"].Spec.PrivateRegistriesConfig.Mirrors["docker.io"] = bootstrapv1.Mirror{
+			Endpoint: []string{"https://mirror.example.com", "https://registry.example.com/", "https://registry.example.com"},
+		}
+		machineConfigs["machine-test"].Spec.PrivateRegistriesConfig.Mirrors["quay.io"] = bootstrapv1.Mirror{
+			Endpoint: []string{"https://registry.example.com/"},
+		}
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, registriesRCP, &machine)).To(BeEmpty())
+	})
+
+	It("should roll out machines when a mirror endpoint changed", func() {
+		machineConfigs["machine-test"].Spec.PrivateRegistriesConfig.Mirrors["quay.io"] = bootstrapv1.Mirror{
+			Endpoint: []string{"https://other-registry.example.com"},
+		}
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, registriesRCP, &machine)).
+			To(Equal(controlplanev1.RegistriesConfigMismatchReason))
+	})
+
+	It("should roll out machines when the system default registry changed", func() {
+		machineConfigs["machine-test"].Spec.AgentConfig.SystemDefaultRegistry = "old-registry.example.com"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, registriesRCP, &machine)).
+			To(Equal(controlplanev1.RegistriesConfigMismatchReason))
+	})
+
+	It("should not roll out machines when the changed registries config is ignored", func() {
+		registriesRCP.Annotations = map[string]string{
+			controlplanev1.RKE2ConfigIgnoreFieldsAnnotation: "PrivateRegistriesConfig",
+		}
+		machineConfigs["machine-test"].Spec.PrivateRegistriesConfig.Mirrors["quay.io"] = bootstrapv1.Mirror{
+			Endpoint: []string{"https://other-registry.example.com"},
+		}
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, registriesRCP, &machine)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("node labels ownership", func() {
+	var (
+		labelsRCP      *controlplanev1.RKE2ControlPlane
+		machineConfigs map[string]*bootstrapv1.RKE2Config
+		m              *clusterv1.Machine
+	)
+
+	BeforeEach(func() {
+		labelsRCP = rcp.DeepCopy()
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: *rcp.Spec.RKE2ConfigSpec.DeepCopy()},
+		}
+		m = machine.DeepCopy()
+		m.Labels = map[string]string{
+			"node-role.kubernetes.io/worker":  "true",
+			"tier.node.cluster.x-k8s.io/name": "db",
+			"example.com/tier":                "db",
+		}
+	})
+
+	It("should not roll out machines when node labels propagated by CAPI move to the RKE2 config", func() {
+		labelsRCP.Spec.AgentConfig.NodeLabels = append(labelsRCP.Spec.AgentConfig.NodeLabels,
+			"node-role.kubernetes.io/worker=true", "tier.node.cluster.x-k8s.io/name=db")
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, labelsRCP)(m)).To(BeTrue())
+	})
+
+	It("should not roll out machines when node labels propagated by CAPI are removed from the RKE2 config", func() {
+		machineConfigs["machine-test"].Spec.AgentConfig.NodeLabels = append(
+			machineConfigs["machine-test"].Spec.AgentConfig.NodeLabels, "node-role.kubernetes.io/worker=true")
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, labelsRCP)(m)).To(BeTrue())
+	})
+
+	It("should roll out machines when a CAPI managed node label is only set in the RKE2 config", func() {
+		labelsRCP.Spec.AgentConfig.NodeLabels = append(labelsRCP.Spec.AgentConfig.NodeLabels, "node-role.kubernetes.io/storage=true")
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, labelsRCP)(m)).To(BeFalse())
+	})
+
+	It("should roll out machines when a CAPI managed node label value differs from the machine", func() {
+		labelsRCP.Spec.AgentConfig.NodeLabels = append(labelsRCP.Spec.AgentConfig.NodeLabels, "tier.node.cluster.x-k8s.io/name=web")
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, labelsRCP)(m)).To(BeFalse())
+	})
+
+	It("should roll out machines when a node label owned by the RKE2 config changes", func() {
+		labelsRCP.Spec.AgentConfig.NodeLabels = append(labelsRCP.Spec.AgentConfig.NodeLabels, "example.com/tier=db")
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, labelsRCP)(m)).To(BeFalse())
+	})
+})
+
+var _ = Describe("bootstrap renderer matching", func() {
+	var machineConfigs map[string]*bootstrapv1.RKE2Config
+
+	BeforeEach(func() {
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: *rcp.Spec.RKE2ConfigSpec.DeepCopy()},
+		}
+	})
+
+	It("should not roll out machines when the bootstrap data is up to date", func() {
+		conditions.MarkTrue(machineConfigs["machine-test"], bootstrapv1.BootstrapDataUpToDateCondition)
+
+		Expect(matchesBootstrapRenderer(machineConfigs)(&machine)).To(BeTrue())
+	})
+
+	It("should not roll out machines when renderer drift is not reported", func() {
+		Expect(matchesBootstrapRenderer(machineConfigs)(&machine)).To(BeTrue())
+	})
+
+	It("should roll out machines when the bootstrap data was rendered with outdated templates", func() {
+		conditions.MarkFalse(machineConfigs["machine-test"], bootstrapv1.BootstrapDataUpToDateCondition,
+			bootstrapv1.RendererChangedReason, clusterv1.ConditionSeverityInfo, "")
+
+		Expect(matchesBootstrapRenderer(machineConfigs)(&machine)).To(BeFalse())
+	})
+})
+
+var _ = Describe("kubelet config file matching", func() {
+	var (
+		kubeletRCP     *controlplanev1.RKE2ControlPlane
+		machineConfigs map[string]*bootstrapv1.RKE2Config
+	)
+
+	BeforeEach(func() {
+		kubeletRCP = rcp.DeepCopy()
+		kubeletRCP.Spec.AgentConfig.Kubelet = &bootstrapv1.ComponentConfig{
+			ExtraArgs: []string{"config=/etc/rancher/rke2/kubelet.yaml", "config-dir=/etc/rancher/rke2/kubelet.conf.d/"},
+		}
+		kubeletRCP.Spec.Files = []bootstrapv1.File{
+			{Path: "/etc/rancher/rke2/kubelet.yaml", Content: "apiVersion: kubelet.config.k8s.io/v1beta1\nkind: KubeletConfiguration\nmaxPods: 110\n"},
+			{Path: "/etc/rancher/rke2/kubelet.conf.d/10-eviction.conf", Content: "evictionHard:\n  memory.available: 100Mi\n"},
+			{Path: "/etc/motd", Content: "welcome"},
+		}
+
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: *kubeletRCP.Spec.RKE2ConfigSpec.DeepCopy()},
+		}
+	})
+
+	It("should not roll out machines when the kubelet config files are unchanged", func() {
+		files := machineConfigs["machine-test"].Spec.Files
+		files[0], files[1] = files[1], files[0]
+
+		Expect(matchesKubeletConfigFiles(machineConfigs, kubeletRCP)(&machine)).To(BeTrue())
+	})
+
+	It("should roll out machines when the kubelet config file content changed", func() {
+		machineConfigs["machine-test"].Spec.Files[0].Content = "apiVersion: kubelet.config.k8s.io/v1beta1\nkind: KubeletConfiguration\nmaxPods: 250\n"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, kubeletRCP, &machine)).
+			To(Equal(controlplanev1.KubeletConfigMismatchReason))
+	})
+
+	It("should roll out machines when a kubelet config drop-in changed", func() {
+		machineConfigs["machine-test"].Spec.Files[1].Content = "evictionHard:\n  memory.available: 200Mi\n"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, kubeletRCP, &machine)).
+			To(Equal(controlplanev1.KubeletConfigMismatchReason))
+	})
+
+	It("should roll out machines when a kubelet config file was added", func() {
+		machineConfigs["machine-test"].Spec.Files = machineConfigs["machine-test"].Spec.Files[1:]
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, kubeletRCP, &machine)).
+			To(Equal(controlplanev1.KubeletConfigMismatchReason))
+	})
+
+	It("should roll out machines when migrating from kubelet args to a kubelet config file", func() {
+		machineConfigs["machine-test"].Spec.AgentConfig.Kubelet = &bootstrapv1.ComponentConfig{ExtraArgs: []string{"max-pods=110"}}
+		machineConfigs["machine-test"].Spec.Files = []bootstrapv1.File{{Path: "/etc/motd", Content: "welcome"}}
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, kubeletRCP, &machine)).
+			To(Equal(controlplanev1.KubeletConfigMismatchReason))
+	})
+
+	It("should report other file changes as a bootstrap config mismatch", func() {
+		machineConfigs["machine-test"].Spec.Files[2].Content = "goodbye"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, kubeletRCP, &machine)).
+			To(Equal(controlplanev1.BootstrapConfigMismatchReason))
+	})
+})
+
+var _ = Describe("kubelet agent config matching", func() {
+	var (
+		kubeletRCP     *controlplanev1.RKE2ControlPlane
+		machineConfigs map[string]*bootstrapv1.RKE2Config
+	)
+
+	BeforeEach(func() {
+		kubeletRCP = rcp.DeepCopy()
+		kubeletRCP.Spec.AgentConfig.Kubelet = &bootstrapv1.ComponentConfig{
+			ExtraArgs: []string{"max-pods=110", "eviction-hard=memory.available<100Mi,nodefs.available<10%"},
+		}
+
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: *kubeletRCP.Spec.RKE2ConfigSpec.DeepCopy()},
+		}
+	})
+
+	It("should report a kubelet eviction threshold change with its own reason", func() {
+		kubeletRCP.Spec.AgentConfig.Kubelet.ExtraArgs[1] = "eviction-hard=memory.available<500Mi,nodefs.available<10%"
+
+		Expect(matchesKubeletAgentConfig(machineConfigs, kubeletRCP)(&machine)).To(BeFalse())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, kubeletRCP, &machine)).
+			To(Equal(controlplanev1.KubeletConfigChangedReason))
+	})
+
+	It("should report a kubelet binary path change as a data dir change", func() {
+		kubeletRCP.Spec.AgentConfig.KubeletPath = "/opt/bin/kubelet"
+
+		Expect(matchesKubeletAgentConfig(machineConfigs, kubeletRCP)(&machine)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, kubeletRCP, &machine)).
+			To(Equal(controlplanev1.DataDirChangedReason))
+	})
+
+	It("should match when the kubelet args only differ in order or in the order of the eviction thresholds", func() {
+		machineConfigs["machine-test"].Spec.AgentConfig.Kubelet.ExtraArgs = []string{
+			"--eviction-hard=nodefs.available<10%,memory.available<100Mi", "max-pods=110",
+		}
+
+		Expect(matchesKubeletAgentConfig(machineConfigs, kubeletRCP)(&machine)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, kubeletRCP, &machine)).To(BeEmpty())
+	})
+
+	It("should not compare the ignored kubelet fields", func() {
+		kubeletRCP.Annotations = map[string]string{controlplanev1.RKE2ConfigIgnoreFieldsAnnotation: "AgentConfig.Kubelet"}
+		kubeletRCP.Spec.AgentConfig.Kubelet.ExtraArgs = []string{"max-pods=250"}
+
+		Expect(matchesKubeletAgentConfig(machineConfigs, kubeletRCP)(&machine)).To(BeTrue())
+	})
+
+	It("should report other agent config changes as a bootstrap config mismatch", func() {
+		kubeletRCP.Spec.AgentConfig.NodeNamePrefix = "renamed"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, kubeletRCP, &machine)).
+			To(Equal(controlplanev1.BootstrapConfigMismatchReason))
+	})
+})
+
+var _ = Describe("data dir config matching", func() {
+	var (
+		dataDirRCP     *controlplanev1.RKE2ControlPlane
+		machineConfigs map[string]*bootstrapv1.RKE2Config
+	)
+
+	BeforeEach(func() {
+		dataDirRCP = rcp.DeepCopy()
+		dataDirRCP.Spec.AgentConfig.DataDir = "/data/rke2"
+
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: *dataDirRCP.Spec.RKE2ConfigSpec.DeepCopy()},
+		}
+	})
+
+	It("should roll out machines when the data dir changed", func() {
+		dataDirRCP.Spec.AgentConfig.DataDir = "/mnt/rke2"
+
+		Expect(matchesDataDirConfig(machineConfigs, dataDirRCP)(&machine)).To(BeFalse())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, dataDirRCP, &machine)).
+			To(Equal(controlplanev1.DataDirChangedReason))
+	})
+
+	It("should not roll out machines when the changed data dir is ignored", func() {
+		dataDirRCP.Annotations = map[string]string{controlplanev1.RKE2ConfigIgnoreFieldsAnnotation: "AgentConfig.DataDir"}
+		dataDirRCP.Spec.AgentConfig.DataDir = "/mnt/rke2"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, dataDirRCP, &machine)).To(BeEmpty())
+	})
+
+	It("should match when the data dir is set to the default or only differs by a trailing slash", func() {
+		machineConfigs["machine-test"].Spec.AgentConfig.DataDir = "/data/rke2/"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, dataDirRCP, &machine)).To(BeEmpty())
+
+		dataDirRCP.Spec.AgentConfig.DataDir = ""
+		machineConfigs["machine-test"].Spec.AgentConfig.DataDir = "/var/lib/rancher/rke2"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, dataDirRCP, &machine)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("containerd config matching", func() {
+	var (
+		containerdRCP  *controlplanev1.RKE2ControlPlane
+		machineConfigs map[string]*bootstrapv1.RKE2Config
+	)
+
+	BeforeEach(func() {
+		containerdRCP = rcp.DeepCopy()
+		containerdRCP.Spec.Files = []bootstrapv1.File{
+			{Path: "/etc/motd", Content: "hello"},
+			{
+				Path:    "/var/lib/rancher/rke2/agent/etc/containerd/config.toml.tmpl",
+				Content: "{{ template \"base\" . }}\n[plugins.\"io.containerd.grpc.v1.cri\"]\n  sandbox_image = \"registry.example.com/pause:3.9\"\n",
+			},
+		}
+
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: *containerdRCP.Spec.RKE2ConfigSpec.DeepCopy()},
+		}
+	})
+
+	It("should roll out machines when the containerd config template changes", func() {
+		containerdRCP.Spec.Files[1].Content = strings.ReplaceAll(containerdRCP.Spec.Files[1].Content, "pause:3.9", "pause:3.10")
+
+		Expect(matchesContainerdConfig(machineConfigs, nil, containerdRCP)(&machine)).To(BeFalse())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, containerdRCP, &machine)).
+			To(Equal(controlplanev1.ContainerdConfigChangedReason))
+	})
+
+	It("should roll out machines when a containerd config template is added in the data dir", func() {
+		containerdRCP.Spec.AgentConfig.DataDir = "/data/rke2/"
+		machineConfigs["machine-test"].Spec.AgentConfig.DataDir = "/data/rke2"
+		containerdRCP.Spec.Files = append(containerdRCP.Spec.Files,
+			bootstrapv1.File{Path: "/data/rke2/agent/etc/containerd/config-v3.toml.tmpl", Content: "{{ template \"base\" . }}"})
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, containerdRCP, &machine)).
+			To(Equal(controlplanev1.ContainerdConfigChangedReason))
+	})
+
+	It("should resolve the content of the containerd config template from a secret", func() {
+		machineConfigs["machine-test"].Spec.Files[1].Content = ""
+		machineConfigs["machine-test"].Spec.Files[1].ContentFrom = &bootstrapv1.FileSource{
+			Secret: bootstrapv1.SecretFileSource{Name: "containerd-config", Key: "config.toml.tmpl"},
+		}
+		contents := fileContents{
+			{Name: "containerd-config", Key: "config.toml.tmpl"}: containerdRCP.Spec.Files[1].Content,
+		}
+
+		Expect(matchesContainerdConfig(machineConfigs, contents, containerdRCP)(&machine)).To(BeTrue())
+
+		contents[bootstrapv1.SecretFileSource{Name: "containerd-config", Key: "config.toml.tmpl"}] = "{{ template \"base\" . }}"
+
+		Expect(matchesContainerdConfig(machineConfigs, contents, containerdRCP)(&machine)).To(BeFalse())
+	})
+
+	It("should report other file changes as a bootstrap config mismatch", func() {
+		containerdRCP.Spec.Files[0].Content = "bye"
+
+		Expect(matchesContainerdConfig(machineConfigs, nil, containerdRCP)(&machine)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, containerdRCP, &machine)).
+			To(Equal(controlplanev1.BootstrapConfigMismatchReason))
+	})
+})
+
+var _ = Describe("node address config matching", func() {
+	var (
+		nodeIPRCP      *controlplanev1.RKE2ControlPlane
+		machineConfigs map[string]*bootstrapv1.RKE2Config
+	)
+
+	BeforeEach(func() {
+		nodeIPRCP = rcp.DeepCopy()
+		nodeIPRCP.Spec.AgentConfig.Kubelet = &bootstrapv1.ComponentConfig{
+			ExtraArgs: []string{"max-pods=110", "node-ip=10.0.0.10,fd00::10"},
+		}
+
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: *nodeIPRCP.Spec.RKE2ConfigSpec.DeepCopy()},
+		}
+	})
+
+	It("should match when the node IPs are reordered", func() {
+		machineConfigs["machine-test"].Spec.AgentConfig.Kubelet.ExtraArgs = []string{
+			"--node-ip=fd00:0:0::10, 10.0.0.10", "max-pods=110",
+		}
+
+		Expect(matchesNodeAddressConfig(machineConfigs, nodeIPRCP)(&machine)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, nodeIPRCP, &machine)).To(BeEmpty())
+	})
+
+	It("should report a node IP change with its own reason", func() {
+		nodeIPRCP.Spec.AgentConfig.Kubelet.ExtraArgs[1] = "node-ip=10.0.0.20,fd00::10"
+
+		Expect(matchesNodeAddressConfig(machineConfigs, nodeIPRCP)(&machine)).To(BeFalse())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, nodeIPRCP, &machine)).
+			To(Equal(controlplanev1.NodeAddressConfigChangedReason))
+	})
+
+	It("should report a node IP added to the kubelet args with its own reason", func() {
+		machineConfigs["machine-test"].Spec.AgentConfig.Kubelet.ExtraArgs = []string{"max-pods=110"}
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, nil, nodeIPRCP, &machine)).
+			To(Equal(controlplanev1.NodeAddressConfigChangedReason))
+	})
+})
+
+var _ = Describe("audit policy matching", func() {
+	const policyPath = "/etc/rancher/rke2/audit-policy.yaml"
+
+	var (
+		auditRCP       *controlplanev1.RKE2ControlPlane
+		auditMachine   *clusterv1.Machine
+		machineConfigs map[string]*bootstrapv1.RKE2Config
+		secretContent  fileContents
+	)
+
+	policySource := bootstrapv1.SecretFileSource{Name: "audit-policy", Key: "policy.yaml"}
+
+	// recordServerConfig records the server config of the RCP on the machine, as done when creating it.
+	recordServerConfig := func() {
+		serverConfig, err := json.Marshal(auditRCP.Spec.ServerConfig)
+		Expect(err).ToNot(HaveOccurred())
+
+		auditMachine.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = string(serverConfig)
+	}
+
+	BeforeEach(func() {
+		auditRCP = rcp.DeepCopy()
+		auditRCP.Spec.ServerConfig.KubeAPIServer = &bootstrapv1.ComponentConfig{
+			ExtraArgs: []string{"audit-policy-file=" + policyPath, "audit-log-maxage=30", "anonymous-auth=false"},
+		}
+		auditRCP.Spec.Files = []bootstrapv1.File{
+			{Path: policyPath, ContentFrom: &bootstrapv1.FileSource{Secret: policySource}},
+			{Path: "/etc/motd", Content: "welcome"},
+		}
+
+		auditMachine = machine.DeepCopy()
+		recordServerConfig()
+
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: *auditRCP.Spec.RKE2ConfigSpec.DeepCopy()},
+		}
+		secretContent = fileContents{policySource: "rules:\n- level: Metadata\n"}
+	})
+
+	It("should match machines with the same audit policy", func() {
+		Expect(matchesAuditPolicy(machineConfigs, secretContent, auditRCP)(auditMachine)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, secretContent, auditRCP, auditMachine)).To(BeEmpty())
+	})
+
+	It("should report an audit policy content change with its own reason", func() {
+		// The machine was bootstrapped with the policy inlined, which then moved to a secret with another content.
+		machineConfigs["machine-test"].Spec.Files[0] = bootstrapv1.File{Path: policyPath, Content: "rules:\n- level: Metadata\n"}
+		secretContent[policySource] = "rules:\n- level: RequestResponse\n"
+
+		Expect(matchesAuditPolicy(machineConfigs, secretContent, auditRCP)(auditMachine)).To(BeFalse())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, secretContent, auditRCP, auditMachine)).
+			To(Equal(controlplanev1.AuditPolicyChangedReason))
+	})
+
+	It("should match machines whose audit policy moved to a secret with the same content", func() {
+		machineConfigs["machine-test"].Spec.Files[0] = bootstrapv1.File{Path: policyPath, Content: "rules:\n- level: Metadata\n"}
+
+		Expect(matchesAuditPolicy(machineConfigs, secretContent, auditRCP)(auditMachine)).To(BeTrue())
+	})
+
+	It("should not roll out machines when the audit policy content can't be resolved", func() {
+		Expect(matchesAuditPolicy(machineConfigs, fileContents{}, auditRCP)(auditMachine)).To(BeTrue())
+	})
+
+	It("should report an audit log arg change with its own reason", func() {
+		auditRCP.Spec.ServerConfig.KubeAPIServer.ExtraArgs[1] = "--audit-log-maxage=7"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, secretContent, auditRCP, auditMachine)).
+			To(Equal(controlplanev1.AuditPolicyChangedReason))
+	})
+
+	It("should report an audit policy secret change with its own reason", func() {
+		auditRCP.Spec.ServerConfig.AuditPolicySecret = &corev1.ObjectReference{Name: "audit-policy-v2"}
+
+		Expect(matchServerConfig(auditRCP, auditMachine)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, secretContent, auditRCP, auditMachine)).
+			To(Equal(controlplanev1.AuditPolicyChangedReason))
+	})
+
+	It("should report other kube-apiserver arg changes as such", func() {
+		auditRCP.Spec.ServerConfig.KubeAPIServer.ExtraArgs[2] = "anonymous-auth=true"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, secretContent, auditRCP, auditMachine)).
+			To(Equal(controlplanev1.APIServerArgsChangedReason))
+	})
+})
+
+var _ = Describe("PodSecurityAdmission config matching", func() {
+	const psaPath = "/etc/rancher/rke2/psa.yaml"
+
+	var (
+		psaRCP         *controlplanev1.RKE2ControlPlane
+		machineConfigs map[string]*bootstrapv1.RKE2Config
+		secretContent  fileContents
+	)
+
+	psaSource := bootstrapv1.SecretFileSource{Name: "psa-config", Key: "psa.yaml"}
+	psaConfig := func(enforce string) string {
+		return "apiVersion: apiserver.config.k8s.io/v1\nkind: AdmissionConfiguration\nplugins:\n" +
+			"- name: PodSecurity\n  configuration:\n    defaults:\n      enforce: " + enforce + "\n"
+	}
+
+	BeforeEach(func() {
+		psaRCP = rcp.DeepCopy()
+		psaRCP.Spec.AgentConfig.PodSecurityAdmissionConfigFile = psaPath
+		psaRCP.Spec.Files = []bootstrapv1.File{
+			{Path: psaPath, ContentFrom: &bootstrapv1.FileSource{Secret: psaSource}},
+			{Path: "/etc/motd", Content: "welcome"},
+		}
+
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: *psaRCP.Spec.RKE2ConfigSpec.DeepCopy()},
+		}
+		secretContent = fileContents{psaSource: psaConfig("baseline")}
+	})
+
+	It("should match machines with the same PodSecurityAdmission config", func() {
+		Expect(matchesPSAConfig(machineConfigs, secretContent, psaRCP)(&machine)).To(BeTrue())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, secretContent, psaRCP, &machine)).To(BeEmpty())
+	})
+
+	It("should report an enforce level change with its own reason", func() {
+		// The machine was bootstrapped with the baseline config inlined, which then moved to a restricted config.
+		machineConfigs["machine-test"].Spec.Files[0] = bootstrapv1.File{Path: psaPath, Content: psaConfig("baseline")}
+		secretContent[psaSource] = psaConfig("restricted")
+
+		Expect(matchesPSAConfig(machineConfigs, secretContent, psaRCP)(&machine)).To(BeFalse())
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, secretContent, psaRCP, &machine)).
+			To(Equal(controlplanev1.PSAConfigChangedReason))
+	})
+
+	It("should match machines whose PodSecurityAdmission config moved to a secret with the same content", func() {
+		machineConfigs["machine-test"].Spec.Files[0] = bootstrapv1.File{Path: psaPath, Content: psaConfig("baseline")}
+
+		Expect(matchesPSAConfig(machineConfigs, secretContent, psaRCP)(&machine)).To(BeTrue())
+	})
+
+	It("should compare the admission config file of the kube-apiserver", func() {
+		const admissionPath = "/etc/rancher/rke2/admission.yaml"
+
+		psaRCP.Spec.AgentConfig.PodSecurityAdmissionConfigFile = ""
+		psaRCP.Spec.ServerConfig.KubeAPIServer = &bootstrapv1.ComponentConfig{
+			ExtraArgs: []string{"--admission-control-config-file=" + admissionPath},
+		}
+		psaRCP.Spec.Files = []bootstrapv1.File{{Path: admissionPath, Content: psaConfig("restricted")}}
+		machineConfigs["machine-test"].Spec.AgentConfig.PodSecurityAdmissionConfigFile = ""
+		machineConfigs["machine-test"].Spec.Files = []bootstrapv1.File{{Path: admissionPath, Content: psaConfig("baseline")}}
+
+		Expect(matchesPSAConfig(machineConfigs, secretContent, psaRCP)(&machine)).To(BeFalse())
+	})
+
+	It("should report a PodSecurityAdmission config file path change with its own reason", func() {
+		machineConfigs["machine-test"].Spec.AgentConfig.PodSecurityAdmissionConfigFile = "/etc/rancher/rke2/psa-old.yaml"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, secretContent, psaRCP, &machine)).
+			To(Equal(controlplanev1.PSAConfigChangedReason))
+	})
+
+	It("should not roll out machines when the PodSecurityAdmission config can't be resolved", func() {
+		Expect(matchesPSAConfig(machineConfigs, fileContents{}, psaRCP)(&machine)).To(BeTrue())
+	})
+})
+
+var _ = Describe("files matching", func() {
+	var (
+		filesRCP       *controlplanev1.RKE2ControlPlane
+		machineConfigs map[string]*bootstrapv1.RKE2Config
+		secretContent  fileContents
+	)
+
+	secretFile := func(path, secretName string) bootstrapv1.File {
+		return bootstrapv1.File{
+			Path:        path,
+			ContentFrom: &bootstrapv1.FileSource{Secret: bootstrapv1.SecretFileSource{Name: secretName, Key: "content"}},
+		}
+	}
+
+	BeforeEach(func() {
+		filesRCP = rcp.DeepCopy()
+		filesRCP.Spec.Files = []bootstrapv1.File{
+			{Path: "/etc/motd", Content: "welcome"},
+			{Path: "/etc/issue", Content: "hello"},
+		}
+
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{
+			"machine-test": {Spec: *filesRCP.Spec.RKE2ConfigSpec.DeepCopy()},
+		}
+
+		secretContent = fileContents{{Name: "motd", Key: "content"}: "welcome"}
+	})
+
+	It("should match machines whose files are reordered", func() {
+		files := machineConfigs["machine-test"].Spec.Files
+		files[0], files[1] = files[1], files[0]
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, nil, filesRCP)(&machine)).To(BeTrue())
+	})
+
+	It("should match machines whose file content moved to a secret with the same content", func() {
+		filesRCP.Spec.Files[0] = secretFile("/etc/motd", "motd")
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, secretContent, filesRCP)(&machine)).To(BeTrue())
+	})
+
+	It("should roll out machines whose file content moved to a secret with another content", func() {
+		filesRCP.Spec.Files[0] = secretFile("/etc/motd", "motd")
+		secretContent[bootstrapv1.SecretFileSource{Name: "motd", Key: "content"}] = "goodbye"
+
+		Expect(rcpConfigurationMismatchReason(nil, machineConfigs, secretContent, filesRCP, &machine)).
+			To(Equal(controlplanev1.BootstrapConfigMismatchReason))
+	})
+
+	It("should not roll out machines when the file content can't be resolved", func() {
+		filesRCP.Spec.Files[0] = secretFile("/etc/motd", "missing")
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, secretContent, filesRCP)(&machine)).To(BeTrue())
+	})
+
+	It("should roll out machines when a file was added", func() {
+		filesRCP.Spec.Files = append(filesRCP.Spec.Files, secretFile("/etc/hosts", "missing"))
+
+		Expect(matchesRKE2BootstrapConfig(machineConfigs, secretContent, filesRCP)(&machine)).To(BeFalse())
+	})
+})
+
+var _ = Describe("stuck provisioning machines", func() {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	machineCreated := func(age time.Duration, phase clusterv1.MachinePhase) *clusterv1.Machine {
+		m := machine.DeepCopy()
+		m.CreationTimestamp = v1.NewTime(now.Add(-age))
+		m.Status.Phase = string(phase)
+
+		return m
+	}
+
+	It("should not flag a machine which was just created", func() {
+		Expect(isStuckProvisioningAt(now, 30*time.Minute)(machineCreated(time.Minute, clusterv1.MachinePhaseProvisioning))).To(BeFalse())
+	})
+
+	It("should flag a machine provisioning for an hour", func() {
+		Expect(isStuckProvisioningAt(now, 30*time.Minute)(machineCreated(time.Hour, clusterv1.MachinePhaseProvisioning))).To(BeTrue())
+		Expect(isStuckProvisioningAt(now, 30*time.Minute)(machineCreated(time.Hour, clusterv1.MachinePhasePending))).To(BeTrue())
+	})
+
+	It("should not flag running or deleting machines", func() {
+		Expect(isStuckProvisioningAt(now, 30*time.Minute)(machineCreated(time.Hour, clusterv1.MachinePhaseRunning))).To(BeFalse())
+
+		deleting := machineCreated(time.Hour, clusterv1.MachinePhaseProvisioning)
+		deleting.DeletionTimestamp = &v1.Time{Time: now}
+		Expect(isStuckProvisioningAt(now, 30*time.Minute)(deleting)).To(BeFalse())
+	})
+
+	It("should compose with the other machine filters", func() {
+		stuck := machineCreated(time.Hour, clusterv1.MachinePhaseProvisioning)
+		stuck.Name = "stuck"
+		running := machineCreated(time.Hour, clusterv1.MachinePhaseRunning)
+		running.Name = "running"
+
+		cp := &ControlPlane{Machines: collections.FromMachines(stuck, running)}
+		Expect(cp.MachinesStuckProvisioning(30 * time.Minute).Names()).To(ConsistOf("stuck"))
+		Expect(cp.Machines.Filter(collections.And(IsStuckProvisioning(30*time.Minute), NeedsProviderID())).Names()).To(ConsistOf("stuck"))
+	})
+})
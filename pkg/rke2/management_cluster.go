@@ -24,11 +24,20 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"maps"
 	"math/big"
+	"net"
+	"slices"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
@@ -38,12 +47,23 @@ import (
 	"sigs.k8s.io/cluster-api/util/certs"
 	"sigs.k8s.io/cluster-api/util/collections"
 
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
 	"github.com/rancher/cluster-api-provider-rke2/pkg/secret"
+	bsutil "github.com/rancher/cluster-api-provider-rke2/pkg/util"
 )
 
 const (
 	// DefaultWorkloadTimeout is the default timeout for the management cluster.
 	DefaultWorkloadTimeout = 30 * time.Second
+
+	// DefaultMachineListPageSize is the default page size used when listing machines incrementally.
+	DefaultMachineListPageSize int64 = 100
+
+	// DefaultWorkloadClusterConcurrency is the default number of workload clusters built concurrently.
+	DefaultWorkloadClusterConcurrency = 10
+
+	// DefaultWorkloadProbeTimeout is the timeout of the calls made with a workload cluster reader for probes.
+	DefaultWorkloadProbeTimeout = 5 * time.Second
 )
 
 // ManagementCluster defines all behaviors necessary for something to function as a management cluster.
@@ -51,7 +71,14 @@ type ManagementCluster interface {
 	ctrlclient.Reader
 
 	GetMachinesForCluster(ctx context.Context, cluster ctrlclient.ObjectKey, filters ...collections.Func) (collections.Machines, error)
-	GetWorkloadCluster(ctx context.Context, clusterKey ctrlclient.ObjectKey) (WorkloadCluster, error)
+	GetControlPlaneMachines(ctx context.Context, cluster ctrlclient.ObjectKey, filters ...collections.Func) (collections.Machines, error)
+	GetWorkloadCluster(ctx context.Context, clusterKey ctrlclient.ObjectKey, externalEtcd *controlplanev1.ExternalEtcd) (WorkloadCluster, error)
+	GetWorkloadClusterReader(ctx context.Context, clusterKey ctrlclient.ObjectKey) (ctrlclient.Reader, error)
+	GetClusterCertificates(ctx context.Context, clusterKey ctrlclient.ObjectKey, purposes ...secret.Purpose) (map[secret.Purpose]*certs.KeyPair, error)
+	AcquireEtcdOperationLease(ctx context.Context, clusterKey ctrlclient.ObjectKey) (ReleaseFunc, error)
+	WatchWorkloadClusterHealth(ctx context.Context, clusterKey ctrlclient.ObjectKey)
+	StopWatchingWorkloadClusterHealth(clusterKey ctrlclient.ObjectKey)
+	ForgetEtcdMaintenance(clusterKey ctrlclient.ObjectKey)
 }
 
 // Management holds operations on the management cluster.
@@ -59,6 +86,26 @@ type Management struct {
 	Client              ctrlclient.Client
 	SecretCachingClient ctrlclient.Reader
 	ClusterCache        clustercache.ClusterCache
+
+	// APIReader reads from the API server without the cache, it is required by GetMachinesForClusterPaginated as the
+	// cache ignores Limit and Continue and always returns the full list.
+	APIReader ctrlclient.Reader
+
+	// Recorder records an event on the Cluster whenever connecting to its workload cluster fails, if set.
+	Recorder record.EventRecorder
+
+	// EtcdMaintenanceRateLimiter throttles the etcd maintenance operations of the workload clusters, if set.
+	EtcdMaintenanceRateLimiter *EtcdMaintenanceRateLimiter
+
+	// EtcdRetryBackoff is the backoff of the etcd operations of the workload clusters failing with transient errors,
+	// the default backoff of NewEtcdRetryBackoff is used if not set.
+	EtcdRetryBackoff *wait.Backoff
+
+	// HealthProber probes the health of the watched workload clusters in the background, if set.
+	HealthProber *WorkloadClusterHealthProber
+
+	// connections tracks the workload clusters a client was built for, see ListClustersUsingWorkloadConnection.
+	connections workloadConnections
 }
 
 // RemoteClusterConnectionError represents a failure to connect to a remote cluster.
@@ -70,6 +117,66 @@ type RemoteClusterConnectionError struct {
 func (e *RemoteClusterConnectionError) Error() string { return e.Name + ": " + e.Err.Error() }
 func (e *RemoteClusterConnectionError) Unwrap() error { return e.Err }
 
+// IsRetryable reports whether the connection failure is expected to go away on its own,
+// e.g. the API server is not reachable yet, rather than requiring user intervention.
+func (e *RemoteClusterConnectionError) IsRetryable() bool { return IsRetryableConnectionError(e.Err) }
+
+// IsRetryableConnectionError classifies an error returned while connecting to a workload cluster.
+// DNS failures, refused connections and timeouts are transient and worth retrying, while
+// authentication and TLS verification failures are terminal until the credentials or certificates change.
+func IsRetryableConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if isTerminalConnectionError(err) {
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var opErr *net.OpError
+
+	return errors.As(err, &opErr)
+}
+
+// isTerminalConnectionError returns true for authentication, authorization and certificate errors.
+func isTerminalConnectionError(err error) bool {
+	if apierrors.IsUnauthorized(err) || apierrors.IsForbidden(err) {
+		return true
+	}
+
+	var (
+		unknownAuthorityErr x509.UnknownAuthorityError
+		certInvalidErr      x509.CertificateInvalidError
+		hostnameErr         x509.HostnameError
+		verificationErr     *tls.CertificateVerificationError
+		recordHeaderErr     tls.RecordHeaderError
+	)
+
+	return errors.As(err, &unknownAuthorityErr) ||
+		errors.As(err, &certInvalidErr) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &verificationErr) ||
+		errors.As(err, &recordHeaderErr)
+}
+
 // Get implements ctrlclient.Reader.
 func (m *Management) Get(ctx context.Context, key ctrlclient.ObjectKey, obj ctrlclient.Object, opts ...ctrlclient.GetOption) error {
 	return m.Client.Get(ctx, key, obj, opts...)
@@ -106,14 +213,110 @@ func (m *Management) GetMachinesForCluster(
 	return machines.Filter(filters...), nil
 }
 
+// GetControlPlaneMachines returns the control plane machines of the target cluster, same as GetMachinesForCluster
+// filtered with collections.ControlPlaneMachines, but the control plane label is part of the List label selector
+// so worker machines are not fetched at all. Filters are applied to the listed control plane machines.
+func (m *Management) GetControlPlaneMachines(
+	ctx context.Context,
+	cluster ctrlclient.ObjectKey,
+	filters ...collections.Func,
+) (collections.Machines, error) {
+	logger := log.FromContext(ctx)
+	selector := map[string]string{
+		clusterv1.ClusterNameLabel: cluster.Name,
+	}
+	ml := &clusterv1.MachineList{}
+
+	logger.V(5).Info("Getting List of control plane machines for Cluster")
+
+	if err := m.Client.List(ctx, ml,
+		ctrlclient.InNamespace(cluster.Namespace),
+		ctrlclient.MatchingLabels(selector),
+		ctrlclient.HasLabels{clusterv1.MachineControlPlaneLabel},
+	); err != nil {
+		return nil, errors.Wrap(err, "failed to list control plane machines")
+	}
+
+	logger.V(5).Info("End of listing control plane machines for cluster")
+
+	machines := collections.FromMachineList(ml)
+
+	return machines.Filter(filters...), nil
+}
+
+// GetMachinesForClusterPaginated returns the machines associated with the target cluster, same as GetMachinesForCluster,
+// but lists them page by page from the APIReader using Limit and Continue tokens. Filters are applied to each page as
+// it is fetched, so only a page and the matching machines are retained in memory.
+// If pageSize is not positive, DefaultMachineListPageSize is used.
+func (m *Management) GetMachinesForClusterPaginated(
+	ctx context.Context,
+	cluster ctrlclient.ObjectKey,
+	pageSize int64,
+	filters ...collections.Func,
+) (collections.Machines, error) {
+	logger := log.FromContext(ctx)
+	selector := map[string]string{
+		clusterv1.ClusterNameLabel: cluster.Name,
+	}
+
+	if m.APIReader == nil {
+		return nil, errors.New("paginated listing of machines requires an uncached API reader")
+	}
+
+	if pageSize <= 0 {
+		pageSize = DefaultMachineListPageSize
+	}
+
+	machines := collections.New()
+	continueToken := ""
+
+	logger.V(5).Info("Getting paginated list of machines for Cluster", "pageSize", pageSize)
+
+	for {
+		ml := &clusterv1.MachineList{}
+
+		if err := m.APIReader.List(ctx, ml,
+			ctrlclient.InNamespace(cluster.Namespace),
+			ctrlclient.MatchingLabels(selector),
+			ctrlclient.Limit(pageSize),
+			ctrlclient.Continue(continueToken),
+		); err != nil {
+			return nil, errors.Wrap(err, "failed to list machines")
+		}
+
+		for _, machine := range collections.FromMachineList(ml).Filter(filters...) {
+			machines.Insert(machine)
+		}
+
+		continueToken = ml.GetContinue()
+		if continueToken == "" {
+			break
+		}
+	}
+
+	logger.V(5).Info("End of paginated listing of machines for cluster")
+
+	return machines, nil
+}
+
 const (
 	// RKE2ControlPlaneControllerName defines the controller used when creating clients.
 	RKE2ControlPlaneControllerName = "rke2-controlplane-controller"
 )
 
 // GetWorkloadCluster builds a cluster object.
-// The cluster comes with an etcd client generator to connect to any etcd pod living on a managed machine.
-func (m *Management) GetWorkloadCluster(ctx context.Context, clusterKey ctrlclient.ObjectKey) (WorkloadCluster, error) {
+// The cluster comes with an etcd client generator to connect to any etcd pod living on a managed machine,
+// or to the external etcd endpoints when externalEtcd is set.
+func (m *Management) GetWorkloadCluster(
+	ctx context.Context,
+	clusterKey ctrlclient.ObjectKey,
+	externalEtcd *controlplanev1.ExternalEtcd,
+) (_ WorkloadCluster, retErr error) {
+	defer func() {
+		m.recordConnectionError(ctx, clusterKey, retErr)
+		m.recordConnectionSuccess(clusterKey, retErr)
+	}()
+
 	restConfig, err := remote.RESTConfig(ctx, RKE2ControlPlaneControllerName, m.Client, clusterKey)
 	if err != nil {
 		return nil, err
@@ -121,38 +324,359 @@ func (m *Management) GetWorkloadCluster(ctx context.Context, clusterKey ctrlclie
 
 	restConfig.Timeout = DefaultWorkloadTimeout
 
-	c, err := ctrlclient.New(restConfig, ctrlclient.Options{Scheme: scheme.Scheme})
+	// A client supporting watches is used, so that callers can wait for nodes to become ready.
+	c, err := ctrlclient.NewWithWatch(restConfig, ctrlclient.Options{Scheme: scheme.Scheme})
 	if err != nil {
 		return nil, &RemoteClusterConnectionError{Name: clusterKey.String(), Err: err}
 	}
 
+	if externalEtcd != nil {
+		return m.NewExternalEtcdWorkload(ctx, c, restConfig, clusterKey, externalEtcd.Endpoints)
+	}
+
 	return m.NewWorkload(ctx, c, restConfig, clusterKey)
 }
 
-func (m *Management) getEtcdCAKeyPair(ctx context.Context, cl ctrlclient.Reader, clusterKey ctrlclient.ObjectKey) (*certs.KeyPair, error) {
-	certificates := secret.Certificates{&secret.ManagedCertificate{
-		Purpose:  secret.EtcdServerCA,
-		External: true,
-	}}
-	secretName := secret.Name(clusterKey.Name, secret.EtcdServerCA)
+// GetWorkloadClusterReader returns a read-only client of the workload cluster intended for health probes, e.g. reading
+// the node status. Reads are served by the ClusterCache when available and not invalidated, and every call is bound to
+// DefaultWorkloadProbeTimeout, so a probe never hangs on an unresponsive workload cluster. The returned reader does
+// not implement any write operation, even through a type assertion.
+func (m *Management) GetWorkloadClusterReader(ctx context.Context, clusterKey ctrlclient.ObjectKey) (_ ctrlclient.Reader, retErr error) {
+	defer func() {
+		m.recordConnectionError(ctx, clusterKey, retErr)
+		m.recordConnectionSuccess(clusterKey, retErr)
+	}()
+
+	if m.ClusterCache != nil && m.clusterCacheUpToDate(ctx, clusterKey) {
+		reader, err := m.ClusterCache.GetReader(ctx, clusterKey)
+		if err != nil {
+			return nil, &RemoteClusterConnectionError{Name: clusterKey.String(), Err: err}
+		}
+
+		return &probeReader{reader: reader, timeout: DefaultWorkloadProbeTimeout}, nil
+	}
+
+	restConfig, err := remote.RESTConfig(ctx, RKE2ControlPlaneControllerName, m.Client, clusterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	restConfig.Timeout = DefaultWorkloadProbeTimeout
 
-	// Try to get the certificate via the cached ctrlclient.
-	if err := certificates.Lookup(ctx, cl, clusterKey); err != nil {
-		// Return error if we got an errors which is not a NotFound error.
-		return nil, errors.Wrapf(err, "failed to get secret CA bundle; etcd CA bundle %s/%s", clusterKey.Namespace, secretName)
+	c, err := ctrlclient.New(restConfig, ctrlclient.Options{Scheme: scheme.Scheme})
+	if err != nil {
+		return nil, &RemoteClusterConnectionError{Name: clusterKey.String(), Err: err}
 	}
 
-	var keypair *certs.KeyPair
+	return &probeReader{reader: c, timeout: DefaultWorkloadProbeTimeout}, nil
+}
+
+// probeReader only exposes the read operations of a client, each one bound to the timeout.
+type probeReader struct {
+	reader  ctrlclient.Reader
+	timeout time.Duration
+}
+
+// Get implements ctrlclient.Reader.
+func (r *probeReader) Get(ctx context.Context, key ctrlclient.ObjectKey, obj ctrlclient.Object, opts ...ctrlclient.GetOption) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.reader.Get(ctx, key, obj, opts...)
+}
 
-	if s, err := certificates[0].Lookup(ctx, cl, clusterKey); err != nil {
-		return nil, errors.Wrapf(err, "failed to get secret; etcd CA bundle %s/%s", clusterKey.Namespace, secretName)
-	} else if s == nil {
-		log.FromContext(ctx).Info("Secret is empty, skipping etcd client creation")
+// List implements ctrlclient.Reader.
+func (r *probeReader) List(ctx context.Context, list ctrlclient.ObjectList, opts ...ctrlclient.ListOption) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.reader.List(ctx, list, opts...)
+}
 
-		return keypair, nil
+// WorkloadClusterResult is the outcome of building the workload cluster of a single cluster in bulk.
+type WorkloadClusterResult struct {
+	WorkloadCluster WorkloadCluster
+	Err             error
+}
+
+// GetWorkloadClusters builds the workload clusters of the given clusters, same as GetWorkloadCluster without external
+// etcd, using at most concurrency workers. A failure only affects the result of its cluster, and is always reported
+// as a RemoteClusterConnectionError naming the cluster. If concurrency is not positive,
+// DefaultWorkloadClusterConcurrency is used.
+func (m *Management) GetWorkloadClusters(
+	ctx context.Context,
+	clusterKeys []ctrlclient.ObjectKey,
+	concurrency int,
+) map[ctrlclient.ObjectKey]WorkloadClusterResult {
+	return getWorkloadClusters(ctx, clusterKeys, concurrency, func(ctx context.Context, clusterKey ctrlclient.ObjectKey) (WorkloadCluster, error) {
+		return m.GetWorkloadCluster(ctx, clusterKey, nil)
+	})
+}
+
+func getWorkloadClusters(
+	ctx context.Context,
+	clusterKeys []ctrlclient.ObjectKey,
+	concurrency int,
+	getWorkloadCluster func(ctx context.Context, clusterKey ctrlclient.ObjectKey) (WorkloadCluster, error),
+) map[ctrlclient.ObjectKey]WorkloadClusterResult {
+	if concurrency <= 0 {
+		concurrency = DefaultWorkloadClusterConcurrency
+	}
+
+	var (
+		lock    sync.Mutex
+		wg      sync.WaitGroup
+		workers = make(chan struct{}, concurrency)
+		results = make(map[ctrlclient.ObjectKey]WorkloadClusterResult, len(clusterKeys))
+	)
+
+	for _, clusterKey := range clusterKeys {
+		wg.Add(1)
+
+		workers <- struct{}{}
+
+		go func() {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+
+			workloadCluster, err := getWorkloadCluster(ctx, clusterKey)
+
+			var connectionErr *RemoteClusterConnectionError
+			if err != nil && !errors.As(err, &connectionErr) {
+				err = &RemoteClusterConnectionError{Name: clusterKey.String(), Err: err}
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			results[clusterKey] = WorkloadClusterResult{WorkloadCluster: workloadCluster, Err: err}
+		}()
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// getExternalEtcdTLSConfig builds the TLS configuration used to connect to an external etcd cluster from the
+// user supplied etcd CA and apiserver etcd client certificate secrets.
+func (m *Management) getExternalEtcdTLSConfig(ctx context.Context, clusterKey ctrlclient.ObjectKey) (*tls.Config, error) {
+	keyPairs, err := m.GetClusterCertificates(ctx, clusterKey, secret.EtcdServerCA, secret.APIServerEtcdClient)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get external etcd certificates")
+	}
+
+	caKeyPair, found := keyPairs[secret.EtcdServerCA]
+	if !found {
+		return nil, errors.Errorf("external etcd CA certificate secret %s not found", secret.Name(clusterKey.Name, secret.EtcdServerCA))
+	}
+
+	clientKeyPair, found := keyPairs[secret.APIServerEtcdClient]
+	if !found {
+		return nil, errors.Errorf("external etcd client certificate secret %s not found",
+			secret.Name(clusterKey.Name, secret.APIServerEtcdClient))
+	}
+
+	clientCert, err := tls.X509KeyPair(clientKeyPair.Cert, clientKeyPair.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse external etcd client certificate")
+	}
+
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caKeyPair.Cert) {
+		return nil, errors.New("failed to parse external etcd CA certificate")
+	}
+
+	return &tls.Config{
+		RootCAs:      caPool,
+		Certificates: []tls.Certificate{clientCert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// GetClusterCertificate retrieves the key pair of the cluster certificate with the given purpose, e.g. secret.ClusterCA.
+// Reads go through the secret caching client when available. The cache can be stale right after the secret was created,
+// so on a cache miss the lookup is retried against the live client before giving up with a NotFound error.
+func (m *Management) GetClusterCertificate(
+	ctx context.Context,
+	clusterKey ctrlclient.ObjectKey,
+	purpose secret.Purpose,
+) (*certs.KeyPair, error) {
+	keyPairs, err := m.GetClusterCertificates(ctx, clusterKey, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	keypair, found := keyPairs[purpose]
+	if !found {
+		name := secret.Name(clusterKey.Name, purpose)
+
+		return nil, errors.Wrapf(apierrors.NewNotFound(corev1.Resource("secrets"), name),
+			"failed to get certificate secret %s/%s", clusterKey.Namespace, name)
+	}
+
+	return keypair, nil
+}
+
+// GetClusterCertificates retrieves the key pairs of the cluster certificates with the given purposes in one pass, so
+// that the certificates needed by a reconcile are read once and can be reused. Reads go through the secret caching
+// client when available, and only the certificates missing from the cache are retried against the live client.
+// Certificates whose secret does not exist are missing from the returned key pairs. Certificates already looked up for
+// the reconcile of the cluster, see ControlPlane.ClusterCertificates, are not read again.
+func (m *Management) GetClusterCertificates(
+	ctx context.Context,
+	clusterKey ctrlclient.ObjectKey,
+	purposes ...secret.Purpose,
+) (map[secret.Purpose]*certs.KeyPair, error) {
+	keyPairs, missing := reconcileClusterCertificates(ctx, clusterKey, purposes)
+	if len(missing) == 0 {
+		return keyPairs, nil
 	}
 
-	return certificates[0].GetKeyPair(), nil
+	purposes = missing
+
+	if m.SecretCachingClient != nil {
+		cached, err := lookupClusterCertificates(ctx, m.SecretCachingClient, clusterKey, purposes)
+		if err != nil {
+			return nil, err
+		}
+
+		maps.Copy(keyPairs, cached)
+		missing = slices.DeleteFunc(slices.Clone(purposes), func(purpose secret.Purpose) bool {
+			_, found := cached[purpose]
+
+			return found
+		})
+
+		if len(missing) == 0 {
+			return keyPairs, nil
+		}
+
+		log.FromContext(ctx).V(4).Info("Certificate secrets not found in cache, retrying with the live client", "purposes", missing)
+	}
+
+	live, err := lookupClusterCertificates(ctx, m.Client, clusterKey, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	maps.Copy(keyPairs, live)
+
+	return keyPairs, nil
+}
+
+// clusterCertificatesContextKey is the context key of the cluster certificates looked up for a reconcile.
+type clusterCertificatesContextKey struct{}
+
+// clusterCertificatesLookup is the outcome of looking up the certificates of a cluster with the given purposes.
+type clusterCertificatesLookup struct {
+	clusterKey ctrlclient.ObjectKey
+	purposes   []secret.Purpose
+	keyPairs   map[secret.Purpose]*certs.KeyPair
+}
+
+// withClusterCertificates returns a context carrying the key pairs of the certificates of the cluster looked up for
+// the reconcile with the given purposes, so that GetClusterCertificates does not read them again.
+func withClusterCertificates(
+	ctx context.Context,
+	clusterKey ctrlclient.ObjectKey,
+	purposes []secret.Purpose,
+	keyPairs map[secret.Purpose]*certs.KeyPair,
+) context.Context {
+	return context.WithValue(ctx, clusterCertificatesContextKey{}, &clusterCertificatesLookup{
+		clusterKey: clusterKey,
+		purposes:   purposes,
+		keyPairs:   keyPairs,
+	})
+}
+
+// reconcileClusterCertificates returns the key pairs of the certificates with the given purposes already looked up
+// for the reconcile of the cluster, along with the purposes which were not looked up yet.
+func reconcileClusterCertificates(
+	ctx context.Context,
+	clusterKey ctrlclient.ObjectKey,
+	purposes []secret.Purpose,
+) (map[secret.Purpose]*certs.KeyPair, []secret.Purpose) {
+	keyPairs := map[secret.Purpose]*certs.KeyPair{}
+
+	lookup, ok := ctx.Value(clusterCertificatesContextKey{}).(*clusterCertificatesLookup)
+	if !ok || lookup.clusterKey != clusterKey {
+		return keyPairs, purposes
+	}
+
+	missing := []secret.Purpose{}
+
+	for _, purpose := range purposes {
+		if !slices.Contains(lookup.purposes, purpose) {
+			missing = append(missing, purpose)
+
+			continue
+		}
+
+		if keyPair, found := lookup.keyPairs[purpose]; found {
+			keyPairs[purpose] = keyPair
+		}
+	}
+
+	return keyPairs, missing
+}
+
+func lookupClusterCertificates(
+	ctx context.Context,
+	cl ctrlclient.Reader,
+	clusterKey ctrlclient.ObjectKey,
+	purposes []secret.Purpose,
+) (map[secret.Purpose]*certs.KeyPair, error) {
+	certificates := make(secret.Certificates, 0, len(purposes))
+	for _, purpose := range purposes {
+		certificates = append(certificates, &secret.ManagedCertificate{Purpose: purpose, External: true})
+	}
+
+	keyPairs, err := certificates.LookupAll(ctx, cl, clusterKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get certificate secrets of cluster %s", clusterKey)
+	}
+
+	return keyPairs, nil
+}
+
+// getClusterToken returns the RKE2 token of the cluster, or an empty string if the token secret does not exist.
+// The secret is read through the secret caching client when available, as it is needed on every reconcile, and only
+// retried against the live client when it is not found in the cache, e.g. right after its creation.
+func (m *Management) getClusterToken(ctx context.Context, clusterKey ctrlclient.ObjectKey) (string, error) {
+	tokenKey := ctrlclient.ObjectKey{Namespace: clusterKey.Namespace, Name: bsutil.TokenName(clusterKey.Name)}
+	tokenSecret := &corev1.Secret{}
+
+	if m.SecretCachingClient != nil {
+		err := m.SecretCachingClient.Get(ctx, tokenKey, tokenSecret)
+		if err == nil {
+			return string(tokenSecret.Data["value"]), nil
+		}
+
+		if !apierrors.IsNotFound(err) {
+			return "", errors.Wrap(err, "failed to get cluster token secret")
+		}
+
+		log.FromContext(ctx).V(4).Info("Cluster token secret not found in cache, retrying with the live client")
+	}
+
+	err := m.Client.Get(ctx, tokenKey, tokenSecret)
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get cluster token secret")
+	}
+
+	return string(tokenSecret.Data["value"]), nil
+}
+
+// getEtcdCAKeyPair retrieves the etcd CA key pair for the cluster.
+func (m *Management) getEtcdCAKeyPair(ctx context.Context, clusterKey ctrlclient.ObjectKey) (*certs.KeyPair, error) {
+	return m.GetClusterCertificate(ctx, clusterKey, secret.EtcdServerCA)
 }
 
 func generateClientCert(caCertEncoded, caKeyEncoded []byte, clientKey *rsa.PrivateKey) (tls.Certificate, error) {
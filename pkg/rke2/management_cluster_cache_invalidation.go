@@ -0,0 +1,97 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"sync"
+
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// clusterCacheInvalidations records the control plane endpoints the ClusterCache must connect to before its entries of
+// the workload clusters are used again. The zero value is ready to use.
+type clusterCacheInvalidations struct {
+	lock      sync.Mutex
+	endpoints map[ctrlclient.ObjectKey]clusterv1.APIEndpoint
+}
+
+var invalidatedClusterCacheEntries = &clusterCacheInvalidations{}
+
+// invalidate records the ClusterCache entry of the workload cluster is stale until it connects to the endpoint.
+func (i *clusterCacheInvalidations) invalidate(clusterKey ctrlclient.ObjectKey, endpoint clusterv1.APIEndpoint) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.endpoints == nil {
+		i.endpoints = map[ctrlclient.ObjectKey]clusterv1.APIEndpoint{}
+	}
+
+	i.endpoints[clusterKey] = endpoint
+}
+
+// endpoint returns the endpoint the ClusterCache entry of the workload cluster must connect to, if it was invalidated.
+func (i *clusterCacheInvalidations) endpoint(clusterKey ctrlclient.ObjectKey) (clusterv1.APIEndpoint, bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	endpoint, found := i.endpoints[clusterKey]
+
+	return endpoint, found
+}
+
+// forget drops the invalidation of the ClusterCache entry of the workload cluster.
+func (i *clusterCacheInvalidations) forget(clusterKey ctrlclient.ObjectKey) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	delete(i.endpoints, clusterKey)
+}
+
+// InvalidateClusterCache marks the ClusterCache entry of the workload cluster as stale until it is connected to the
+// given control plane endpoint, e.g. once the kubeconfig of the cluster was regenerated for a new endpoint. The
+// ClusterCache only reconnects once its health probes of the previous endpoint fail, the workload cluster readers are
+// built from the kubeconfig in the meantime.
+func InvalidateClusterCache(clusterKey ctrlclient.ObjectKey, endpoint clusterv1.APIEndpoint) {
+	invalidatedClusterCacheEntries.invalidate(clusterKey, endpoint)
+}
+
+// ForgetClusterCacheInvalidation drops the invalidation of the ClusterCache entry of the cluster, e.g. once its control
+// plane is deleted.
+func ForgetClusterCacheInvalidation(clusterKey ctrlclient.ObjectKey) {
+	invalidatedClusterCacheEntries.forget(clusterKey)
+}
+
+// clusterCacheUpToDate returns whether the ClusterCache entry of the workload cluster can be used, i.e. it was not
+// invalidated, or the ClusterCache connected to the new control plane endpoint since.
+func (m *Management) clusterCacheUpToDate(ctx context.Context, clusterKey ctrlclient.ObjectKey) bool {
+	endpoint, invalidated := invalidatedClusterCacheEntries.endpoint(clusterKey)
+	if !invalidated {
+		return true
+	}
+
+	restConfig, err := m.ClusterCache.GetRESTConfig(ctx, clusterKey)
+	if err != nil || restConfig.Host != "https://"+endpoint.String() {
+		return false
+	}
+
+	invalidatedClusterCacheEntries.forget(clusterKey)
+
+	return true
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// WorkloadConnection is a workload cluster the management cluster is connected to.
+type WorkloadConnection struct {
+	// Cluster is the key of the Cluster.
+	Cluster ctrlclient.ObjectKey
+
+	// LastSuccess is the last time a client of the workload cluster was built, or the ClusterCache connection to it was
+	// probed successfully, whichever is the latest.
+	LastSuccess time.Time
+
+	// Cached is true if the ClusterCache holds a connection to the workload cluster.
+	Cached bool
+}
+
+// workloadConnections tracks the last time a client of each workload cluster was built. The zero value is ready to use.
+type workloadConnections struct {
+	lock        sync.Mutex
+	lastSuccess map[ctrlclient.ObjectKey]time.Time
+}
+
+// succeeded records a client of the workload cluster was built.
+func (c *workloadConnections) succeeded(clusterKey ctrlclient.ObjectKey, at time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.lastSuccess == nil {
+		c.lastSuccess = map[ctrlclient.ObjectKey]time.Time{}
+	}
+
+	c.lastSuccess[clusterKey] = at
+}
+
+// snapshot returns the last time a client of each workload cluster was built, forgetting the clusters which are not
+// kept.
+func (c *workloadConnections) snapshot(keep func(ctrlclient.ObjectKey) bool) map[ctrlclient.ObjectKey]time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	snapshot := make(map[ctrlclient.ObjectKey]time.Time, len(c.lastSuccess))
+
+	for clusterKey, lastSuccess := range c.lastSuccess {
+		if !keep(clusterKey) {
+			delete(c.lastSuccess, clusterKey)
+
+			continue
+		}
+
+		snapshot[clusterKey] = lastSuccess
+	}
+
+	return snapshot
+}
+
+// recordConnectionSuccess records a client of the workload cluster was built, unless building it failed.
+func (m *Management) recordConnectionSuccess(clusterKey ctrlclient.ObjectKey, err error) {
+	if err != nil {
+		return
+	}
+
+	m.connections.succeeded(clusterKey, time.Now())
+}
+
+// ListClustersUsingWorkloadConnection returns the clusters the management cluster is connected to, i.e. those for which
+// GetWorkloadCluster or GetWorkloadClusterReader built a client, or the ClusterCache holds a connection, along with the
+// last time the connection succeeded. It reports the clusters affected by an issue of the management cluster, sorted
+// by namespace and name. Deleted clusters are forgotten.
+func (m *Management) ListClustersUsingWorkloadConnection(ctx context.Context) ([]WorkloadConnection, error) {
+	clusters := &clusterv1.ClusterList{}
+	if err := m.Client.List(ctx, clusters); err != nil {
+		return nil, errors.Wrap(err, "failed to list clusters")
+	}
+
+	existing := make(map[ctrlclient.ObjectKey]bool, len(clusters.Items))
+	for i := range clusters.Items {
+		existing[ctrlclient.ObjectKeyFromObject(&clusters.Items[i])] = true
+	}
+
+	built := m.connections.snapshot(func(clusterKey ctrlclient.ObjectKey) bool { return existing[clusterKey] })
+
+	connections := []WorkloadConnection{}
+
+	for i := range clusters.Items {
+		connection := WorkloadConnection{Cluster: ctrlclient.ObjectKeyFromObject(&clusters.Items[i])}
+		connection.LastSuccess = built[connection.Cluster]
+
+		if m.ClusterCache != nil {
+			lastProbeSuccess := m.ClusterCache.GetLastProbeSuccessTimestamp(ctx, connection.Cluster)
+			connection.Cached = !lastProbeSuccess.IsZero()
+
+			if lastProbeSuccess.After(connection.LastSuccess) {
+				connection.LastSuccess = lastProbeSuccess
+			}
+		}
+
+		if connection.LastSuccess.IsZero() {
+			continue
+		}
+
+		connections = append(connections, connection)
+	}
+
+	slices.SortFunc(connections, func(a, b WorkloadConnection) int {
+		if a.Cluster.Namespace != b.Cluster.Namespace {
+			return strings.Compare(a.Cluster.Namespace, b.Cluster.Namespace)
+		}
+
+		return strings.Compare(a.Cluster.Name, b.Cluster.Name)
+	})
+
+	return connections, nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// RemoteClusterConnectionFailedReason is the reason of the events recorded when connecting to a workload cluster fails.
+	RemoteClusterConnectionFailedReason = "RemoteClusterConnectionFailed"
+
+	// RetryableConnectionErrorClass is the class of the connection errors expected to go away on their own.
+	RetryableConnectionErrorClass = "retryable"
+
+	// TerminalConnectionErrorClass is the class of the connection errors requiring user intervention.
+	TerminalConnectionErrorClass = "terminal"
+)
+
+var remoteClusterConnectionErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "caprke2_remote_cluster_connection_errors_total",
+	Help: "Total number of failed connections to workload clusters.",
+}, []string{
+	"cluster", "class",
+})
+
+func init() {
+	metrics.Registry.MustRegister(remoteClusterConnectionErrors)
+}
+
+// Class returns the class of the connection failure, RetryableConnectionErrorClass or TerminalConnectionErrorClass.
+func (e *RemoteClusterConnectionError) Class() string {
+	if e.IsRetryable() {
+		return RetryableConnectionErrorClass
+	}
+
+	return TerminalConnectionErrorClass
+}
+
+// recordConnectionError counts the connection failure to the workload cluster, and records a warning event on the
+// Cluster when the Management has a recorder. Errors which are not a RemoteClusterConnectionError are ignored.
+func (m *Management) recordConnectionError(ctx context.Context, clusterKey ctrlclient.ObjectKey, err error) {
+	var connectionErr *RemoteClusterConnectionError
+	if !errors.As(err, &connectionErr) {
+		return
+	}
+
+	remoteClusterConnectionErrors.WithLabelValues(clusterKey.String(), connectionErr.Class()).Inc()
+
+	if m.Recorder == nil {
+		return
+	}
+
+	ref := &corev1.ObjectReference{
+		APIVersion: clusterv1.GroupVersion.String(),
+		Kind:       "Cluster",
+		Namespace:  clusterKey.Namespace,
+		Name:       clusterKey.Name,
+	}
+
+	// The UID lets the event show up when describing the Cluster, it is left empty if the Cluster can't be read.
+	cluster := &clusterv1.Cluster{}
+	if m.Client != nil && m.Client.Get(ctx, clusterKey, cluster) == nil {
+		ref.UID = cluster.UID
+	}
+
+	m.Recorder.Eventf(ref, corev1.EventTypeWarning, RemoteClusterConnectionFailedReason,
+		"Failed to connect to the workload cluster (%s): %v", connectionErr.Class(), connectionErr.Err)
+}
@@ -0,0 +1,837 @@
+package rke2
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/secret"
+	bsutil "github.com/rancher/cluster-api-provider-rke2/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/controllers/clustercache"
+	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// pagingMachineReader is an uncached reader serving Machines the way the API server does, which the fake client does
+// not implement: only the items of the requested page are copied into the list, and the continue token is the offset
+// of the next item to return.
+type pagingMachineReader struct {
+	client.Reader
+	machines []clusterv1.Machine
+
+	// pages counts the lists served, and maxListed is the largest number of machines returned by a single list.
+	pages     int
+	maxListed int
+}
+
+func newPagingMachineReader(objs ...client.Object) *pagingMachineReader {
+	r := &pagingMachineReader{}
+	for _, obj := range objs {
+		r.machines = append(r.machines, *obj.(*clusterv1.Machine))
+	}
+
+	return r
+}
+
+func (r *pagingMachineReader) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	ml, ok := list.(*clusterv1.MachineList)
+	if !ok {
+		return fmt.Errorf("unexpected list type %T", list)
+	}
+
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+
+	matching := make([]*clusterv1.Machine, 0, len(r.machines))
+
+	for i := range r.machines {
+		machine := &r.machines[i]
+		if listOpts.Namespace != "" && machine.Namespace != listOpts.Namespace {
+			continue
+		}
+
+		if listOpts.LabelSelector != nil && !listOpts.LabelSelector.Matches(labels.Set(machine.Labels)) {
+			continue
+		}
+
+		matching = append(matching, machine)
+	}
+
+	offset := 0
+	if listOpts.Continue != "" {
+		var err error
+		if offset, err = strconv.Atoi(listOpts.Continue); err != nil {
+			return err
+		}
+	}
+
+	end := len(matching)
+	if listOpts.Limit > 0 {
+		end = min(offset+int(listOpts.Limit), end)
+	}
+
+	ml.Items = make([]clusterv1.Machine, 0, end-offset)
+	for _, machine := range matching[offset:end] {
+		ml.Items = append(ml.Items, *machine.DeepCopy())
+	}
+
+	ml.Continue = ""
+	if end < len(matching) {
+		ml.Continue = strconv.Itoa(end)
+	}
+
+	r.pages++
+	r.maxListed = max(r.maxListed, len(ml.Items))
+
+	return nil
+}
+
+// clientFor returns a client serving the lists of Machines from the reader, as a cache would without pagination.
+func (r *pagingMachineReader) clientFor() client.Client {
+	return fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithInterceptorFuncs(interceptor.Funcs{
+			List: func(ctx context.Context, _ client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				return r.List(ctx, list, opts...)
+			},
+		}).
+		Build()
+}
+
+func newMachinesForCluster(count int, clusterName string) []client.Object {
+	objs := make([]client.Object, 0, count)
+
+	for i := range count {
+		labels := map[string]string{clusterv1.ClusterNameLabel: clusterName}
+		if i%2 == 0 {
+			labels[clusterv1.MachineControlPlaneLabel] = ""
+		}
+
+		objs = append(objs, &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("machine-%04d", i),
+				Namespace: "default",
+				Labels:    labels,
+			},
+			Spec: clusterv1.MachineSpec{ClusterName: clusterName},
+		})
+	}
+
+	return objs
+}
+
+func TestGetMachinesForClusterPaginated(t *testing.T) {
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "cluster"}
+
+	tests := []struct {
+		name          string
+		machines      int
+		pageSize      int64
+		filters       []collections.Func
+		expectedCount int
+		expectedPages int
+	}{
+		{
+			name:          "returns all machines across pages",
+			machines:      25,
+			pageSize:      10,
+			expectedCount: 25,
+			expectedPages: 3,
+		},
+		{
+			name:          "applies filters on each page",
+			machines:      25,
+			pageSize:      10,
+			filters:       []collections.Func{collections.ControlPlaneMachines(clusterKey.Name)},
+			expectedCount: 13,
+			expectedPages: 3,
+		},
+		{
+			name:          "uses the default page size when not set",
+			machines:      150,
+			pageSize:      0,
+			expectedCount: 150,
+			expectedPages: 2,
+		},
+		{
+			name:          "returns an empty collection when there are no machines",
+			machines:      0,
+			pageSize:      10,
+			expectedCount: 0,
+			expectedPages: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			apiReader := newPagingMachineReader(append(newMachinesForCluster(tt.machines, clusterKey.Name),
+				&clusterv1.Machine{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "other-cluster-machine",
+						Namespace: clusterKey.Namespace,
+						Labels:    map[string]string{clusterv1.ClusterNameLabel: "other"},
+					},
+				})...)
+
+			m := &Management{Client: apiReader.clientFor(), APIReader: apiReader}
+
+			machines, err := m.GetMachinesForClusterPaginated(context.Background(), clusterKey, tt.pageSize, tt.filters...)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(machines).To(HaveLen(tt.expectedCount))
+			g.Expect(apiReader.pages).To(Equal(tt.expectedPages))
+			g.Expect(apiReader.maxListed).To(BeNumerically("<=", max(tt.pageSize, DefaultMachineListPageSize)))
+
+			unpaginated, err := m.GetMachinesForCluster(context.Background(), clusterKey, tt.filters...)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(machines.Names()).To(ConsistOf(unpaginated.Names()))
+		})
+	}
+}
+
+func TestGetControlPlaneMachines(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "cluster"}
+	listed := 0
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(newMachinesForCluster(10, clusterKey.Name)...).
+		WithObjects(&clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "other-cluster-machine",
+				Namespace: clusterKey.Namespace,
+				Labels: map[string]string{
+					clusterv1.ClusterNameLabel:         "other",
+					clusterv1.MachineControlPlaneLabel: "",
+				},
+			},
+		}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				if err := c.List(ctx, list, opts...); err != nil {
+					return err
+				}
+
+				if ml, ok := list.(*clusterv1.MachineList); ok {
+					listed += len(ml.Items)
+				}
+
+				return nil
+			},
+		}).
+		Build()
+
+	m := &Management{Client: fakeClient}
+
+	machines, err := m.GetControlPlaneMachines(context.Background(), clusterKey)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(machines).To(HaveLen(5))
+	g.Expect(machines.Filter(collections.Not(collections.ControlPlaneMachines(clusterKey.Name)))).To(BeEmpty())
+
+	// Worker machines are excluded by the List label selector, not filtered out afterwards.
+	g.Expect(listed).To(Equal(5))
+
+	filtered, err := m.GetControlPlaneMachines(context.Background(), clusterKey, func(machine *clusterv1.Machine) bool {
+		return machine.Name == "machine-0000" || machine.Name == "machine-0001"
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(filtered.Names()).To(ConsistOf("machine-0000"))
+}
+
+func TestGetWorkloadClusters(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterKeys := []client.ObjectKey{}
+	for i := range 20 {
+		clusterKeys = append(clusterKeys, client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("cluster-%d", i)})
+	}
+
+	const concurrency = 3
+
+	var (
+		lock           sync.Mutex
+		inFlight, peak int
+		refusedErr     = &RemoteClusterConnectionError{Name: "default/cluster-1", Err: syscall.ECONNREFUSED}
+	)
+
+	results := getWorkloadClusters(context.Background(), clusterKeys, concurrency,
+		func(_ context.Context, clusterKey client.ObjectKey) (WorkloadCluster, error) {
+			lock.Lock()
+			inFlight++
+			peak = max(peak, inFlight)
+			lock.Unlock()
+
+			defer func() {
+				lock.Lock()
+				inFlight--
+				lock.Unlock()
+			}()
+
+			time.Sleep(10 * time.Millisecond)
+
+			switch clusterKey.Name {
+			case "cluster-0":
+				return nil, errors.New("kubeconfig secret not found")
+			case "cluster-1":
+				return nil, refusedErr
+			}
+
+			return &Workload{}, nil
+		})
+
+	g.Expect(peak).To(Equal(concurrency))
+	g.Expect(results).To(HaveLen(len(clusterKeys)))
+
+	var connectionErr *RemoteClusterConnectionError
+
+	g.Expect(errors.As(results[clusterKeys[0]].Err, &connectionErr)).To(BeTrue())
+	g.Expect(connectionErr.Name).To(Equal("default/cluster-0"))
+	g.Expect(connectionErr.Err).To(MatchError("kubeconfig secret not found"))
+	g.Expect(results[clusterKeys[0]].WorkloadCluster).To(BeNil())
+
+	g.Expect(results[clusterKeys[1]].Err).To(BeIdenticalTo(refusedErr))
+
+	for _, clusterKey := range clusterKeys[2:] {
+		g.Expect(results[clusterKey].Err).ToNot(HaveOccurred())
+		g.Expect(results[clusterKey].WorkloadCluster).ToNot(BeNil())
+	}
+}
+
+// benchmarkGetMachines lists 1000 machines, of which the filter keeps half, either at once or page by page from an
+// uncached reader. Besides the allocations, it reports the largest number of machines held by a single list, which
+// bounds the memory of the paginated listing to a page.
+func benchmarkGetMachines(b *testing.B, paginated bool) {
+	b.Helper()
+
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "cluster"}
+	apiReader := newPagingMachineReader(newMachinesForCluster(1000, clusterKey.Name)...)
+
+	m := &Management{Client: apiReader.clientFor(), APIReader: apiReader}
+	filter := collections.ControlPlaneMachines(clusterKey.Name)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		var err error
+		if paginated {
+			_, err = m.GetMachinesForClusterPaginated(context.Background(), clusterKey, DefaultMachineListPageSize, filter)
+		} else {
+			_, err = m.GetMachinesForCluster(context.Background(), clusterKey, filter)
+		}
+
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(apiReader.maxListed), "machines/list")
+}
+
+func BenchmarkGetMachinesForCluster1000(b *testing.B) {
+	benchmarkGetMachines(b, false)
+}
+
+func BenchmarkGetMachinesForClusterPaginated1000(b *testing.B) {
+	benchmarkGetMachines(b, true)
+}
+
+// readerClusterCache is a ClusterCache only serving a reader for the workload cluster.
+type readerClusterCache struct {
+	clustercache.ClusterCache
+	reader           client.Reader
+	err              error
+	lastProbeSuccess map[client.ObjectKey]time.Time
+}
+
+func (c *readerClusterCache) GetReader(context.Context, client.ObjectKey) (client.Reader, error) {
+	return c.reader, c.err
+}
+
+func (c *readerClusterCache) GetLastProbeSuccessTimestamp(_ context.Context, cluster client.ObjectKey) time.Time {
+	return c.lastProbeSuccess[cluster]
+}
+
+func TestGetWorkloadClusterReader(t *testing.T) {
+	g := NewWithT(t)
+
+	var hasDeadline bool
+
+	workloadClient := fake.NewClientBuilder().
+		WithObjects(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				_, hasDeadline = ctx.Deadline()
+
+				return c.Get(ctx, key, obj, opts...)
+			},
+		}).
+		Build()
+
+	m := &Management{ClusterCache: &readerClusterCache{reader: workloadClient}}
+
+	reader, err := m.GetWorkloadClusterReader(context.Background(), client.ObjectKey{Namespace: "default", Name: "cluster"})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(reader.Get(context.Background(), client.ObjectKey{Name: "node-1"}, &corev1.Node{})).To(Succeed())
+	g.Expect(hasDeadline).To(BeTrue())
+
+	// Writes are rejected, the reader does not expose the write operations of the underlying client.
+	_, isWriter := reader.(client.Writer)
+	g.Expect(isWriter).To(BeFalse())
+
+	_, isClient := reader.(client.Client)
+	g.Expect(isClient).To(BeFalse())
+}
+
+func TestRecordConnectionError(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "flaky-cluster"}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: clusterKey.Namespace, Name: clusterKey.Name, UID: "cluster-uid"}}
+
+	testScheme := runtime.NewScheme()
+	g.Expect(clusterv1.AddToScheme(testScheme)).To(Succeed())
+
+	recorder := record.NewFakeRecorder(10)
+	m := &Management{
+		Client:       fake.NewClientBuilder().WithScheme(testScheme).WithObjects(cluster).Build(),
+		ClusterCache: &readerClusterCache{err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}},
+		Recorder:     recorder,
+	}
+
+	retryable := remoteClusterConnectionErrors.WithLabelValues(clusterKey.String(), RetryableConnectionErrorClass)
+	before := testutil.ToFloat64(retryable)
+
+	_, err := m.GetWorkloadClusterReader(context.Background(), clusterKey)
+	g.Expect(err).To(HaveOccurred())
+
+	g.Expect(testutil.ToFloat64(retryable)).To(Equal(before + 1))
+	g.Expect(recorder.Events).To(Receive(And(
+		ContainSubstring(corev1.EventTypeWarning),
+		ContainSubstring(RemoteClusterConnectionFailedReason),
+		ContainSubstring("retryable"),
+	)))
+
+	t.Run("terminal errors are counted separately", func(t *testing.T) {
+		g := NewWithT(t)
+
+		m.ClusterCache = &readerClusterCache{err: apierrors.NewUnauthorized("invalid token")}
+
+		terminal := remoteClusterConnectionErrors.WithLabelValues(clusterKey.String(), TerminalConnectionErrorClass)
+		before := testutil.ToFloat64(terminal)
+
+		_, err := m.GetWorkloadClusterReader(context.Background(), clusterKey)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(testutil.ToFloat64(terminal)).To(Equal(before + 1))
+		g.Expect(recorder.Events).To(Receive(ContainSubstring("terminal")))
+	})
+}
+
+func TestListClustersUsingWorkloadConnection(t *testing.T) {
+	g := NewWithT(t)
+
+	testScheme := runtime.NewScheme()
+	g.Expect(clusterv1.AddToScheme(testScheme)).To(Succeed())
+
+	cluster := func(namespace, name string) *clusterv1.Cluster {
+		return &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+
+	connected := client.ObjectKey{Namespace: "default", Name: "connected"}
+	cached := client.ObjectKey{Namespace: "default", Name: "cached"}
+	deleted := client.ObjectKey{Namespace: "other", Name: "deleted"}
+
+	probedAt := time.Now().Add(-time.Minute)
+
+	managementClient := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		cluster(connected.Namespace, connected.Name),
+		cluster(cached.Namespace, cached.Name),
+		cluster(deleted.Namespace, deleted.Name),
+		cluster("default", "disconnected"),
+	).Build()
+
+	m := &Management{
+		Client: managementClient,
+		ClusterCache: &readerClusterCache{
+			reader:           fake.NewClientBuilder().Build(),
+			lastProbeSuccess: map[client.ObjectKey]time.Time{cached: probedAt},
+		},
+	}
+
+	connections, err := m.ListClustersUsingWorkloadConnection(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(connections).To(Equal([]WorkloadConnection{{Cluster: cached, LastSuccess: probedAt, Cached: true}}))
+
+	before := time.Now()
+
+	for _, clusterKey := range []client.ObjectKey{connected, deleted} {
+		_, err := m.GetWorkloadClusterReader(context.Background(), clusterKey)
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+
+	g.Expect(managementClient.Delete(context.Background(), cluster(deleted.Namespace, deleted.Name))).To(Succeed())
+
+	connections, err = m.ListClustersUsingWorkloadConnection(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(connections).To(HaveLen(2))
+	g.Expect(connections[0]).To(Equal(WorkloadConnection{Cluster: cached, LastSuccess: probedAt, Cached: true}))
+	g.Expect(connections[1].Cluster).To(Equal(connected))
+	g.Expect(connections[1].Cached).To(BeFalse())
+	g.Expect(connections[1].LastSuccess).To(BeTemporally(">=", before))
+
+	// The deleted cluster is forgotten.
+	g.Expect(m.connections.lastSuccess).To(HaveKey(connected))
+	g.Expect(m.connections.lastSuccess).ToNot(HaveKey(deleted))
+}
+
+func TestGetEtcdCAKeyPairFallsBackToLiveClient(t *testing.T) {
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "cluster"}
+	etcdCA := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secret.Name(clusterKey.Name, secret.EtcdServerCA),
+			Namespace: clusterKey.Namespace,
+		},
+		Data: map[string][]byte{
+			secret.TLSCrtDataName: []byte("cert"),
+			secret.TLSKeyDataName: []byte("key"),
+		},
+	}
+
+	tests := []struct {
+		name           string
+		cachedObjs     []client.Object
+		liveObjs       []client.Object
+		cachedErr      error
+		expectErr      bool
+		expectNotFound bool
+		expectKeyPair  bool
+	}{
+		{
+			name:          "cache hit",
+			cachedObjs:    []client.Object{etcdCA},
+			expectKeyPair: true,
+		},
+		{
+			name:          "cache miss falls back to the live client",
+			liveObjs:      []client.Object{etcdCA},
+			expectKeyPair: true,
+		},
+		{
+			name:           "secret missing in both cache and live client",
+			expectErr:      true,
+			expectNotFound: true,
+		},
+		{
+			name:      "cache errors other than NotFound are returned",
+			liveObjs:  []client.Object{etcdCA},
+			cachedErr: errors.New("cache unavailable"),
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cachedBuilder := fake.NewClientBuilder().WithObjects(tt.cachedObjs...)
+			if tt.cachedErr != nil {
+				cachedBuilder = cachedBuilder.WithInterceptorFuncs(interceptor.Funcs{
+					Get: func(_ context.Context, _ client.WithWatch, _ client.ObjectKey, _ client.Object, _ ...client.GetOption) error {
+						return tt.cachedErr
+					},
+				})
+			}
+
+			m := &Management{
+				Client:              fake.NewClientBuilder().WithObjects(tt.liveObjs...).Build(),
+				SecretCachingClient: cachedBuilder.Build(),
+			}
+
+			keypair, err := m.getEtcdCAKeyPair(context.Background(), clusterKey)
+			if tt.expectErr {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(apierrors.IsNotFound(err)).To(Equal(tt.expectNotFound))
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+
+			if tt.expectKeyPair {
+				g.Expect(keypair).ToNot(BeNil())
+				g.Expect(keypair.Cert).To(Equal([]byte("cert")))
+			}
+		})
+	}
+}
+
+func TestRemoteClusterConnectionErrorIsRetryable(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://10.0.0.1:6443/api", Err: err}
+	}
+
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{
+			name: "connection refused",
+			err: urlErr(&net.OpError{
+				Op:  "dial",
+				Net: "tcp",
+				Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED},
+			}),
+			retryable: true,
+		},
+		{
+			name:      "dial error without a known cause",
+			err:       urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("network is unreachable")}),
+			retryable: true,
+		},
+		{
+			name:      "DNS lookup failure",
+			err:       urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "cluster.example.com", IsNotFound: true}}),
+			retryable: true,
+		},
+		{
+			name:      "context deadline exceeded",
+			err:       fmt.Errorf("failed to get API group resources: %w", context.DeadlineExceeded),
+			retryable: true,
+		},
+		{
+			name:      "unknown certificate authority",
+			err:       urlErr(x509.UnknownAuthorityError{}),
+			retryable: false,
+		},
+		{
+			name:      "certificate does not match the host",
+			err:       urlErr(x509.HostnameError{Certificate: &x509.Certificate{}, Host: "10.0.0.1"}),
+			retryable: false,
+		},
+		{
+			name:      "expired certificate",
+			err:       urlErr(x509.CertificateInvalidError{Cert: &x509.Certificate{}, Reason: x509.Expired}),
+			retryable: false,
+		},
+		{
+			name:      "unauthorized",
+			err:       apierrors.NewUnauthorized("invalid bearer token"),
+			retryable: false,
+		},
+		{
+			name:      "forbidden",
+			err:       apierrors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "", errors.New("denied")),
+			retryable: false,
+		},
+		{
+			name:      "unclassified error",
+			err:       errors.New("something went wrong"),
+			retryable: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			connErr := &RemoteClusterConnectionError{Name: "default/cluster", Err: tt.err}
+			g.Expect(connErr.IsRetryable()).To(Equal(tt.retryable))
+			g.Expect(IsRetryableConnectionError(fmt.Errorf("wrapped: %w", connErr))).To(Equal(tt.retryable))
+		})
+	}
+}
+
+func TestGetClusterCertificate(t *testing.T) {
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "cluster"}
+	certificateSecret := func(purpose secret.Purpose) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secret.Name(clusterKey.Name, purpose),
+				Namespace: clusterKey.Namespace,
+			},
+			Data: map[string][]byte{
+				secret.TLSCrtDataName: []byte(string(purpose) + "-cert"),
+				secret.TLSKeyDataName: []byte(string(purpose) + "-key"),
+			},
+		}
+	}
+
+	purposes := []secret.Purpose{
+		secret.EtcdCA,
+		secret.EtcdServerCA,
+		secret.ClusterCA,
+		secret.ClientClusterCA,
+		secret.APIServerEtcdClient,
+		secret.ServiceAccount,
+	}
+
+	for _, purpose := range purposes {
+		t.Run(string(purpose), func(t *testing.T) {
+			t.Run("reads through the secret caching client", func(t *testing.T) {
+				g := NewWithT(t)
+
+				m := &Management{
+					Client:              fake.NewClientBuilder().Build(),
+					SecretCachingClient: fake.NewClientBuilder().WithObjects(certificateSecret(purpose)).Build(),
+				}
+
+				keypair, err := m.GetClusterCertificate(context.Background(), clusterKey, purpose)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(keypair.Cert).To(Equal([]byte(string(purpose) + "-cert")))
+				g.Expect(keypair.Key).To(Equal([]byte(string(purpose) + "-key")))
+			})
+
+			t.Run("falls back to the live client on a cache miss", func(t *testing.T) {
+				g := NewWithT(t)
+
+				m := &Management{
+					Client:              fake.NewClientBuilder().WithObjects(certificateSecret(purpose)).Build(),
+					SecretCachingClient: fake.NewClientBuilder().Build(),
+				}
+
+				keypair, err := m.GetClusterCertificate(context.Background(), clusterKey, purpose)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(keypair.Cert).To(Equal([]byte(string(purpose) + "-cert")))
+			})
+
+			t.Run("returns a NotFound error when the secret is missing", func(t *testing.T) {
+				g := NewWithT(t)
+
+				m := &Management{
+					Client:              fake.NewClientBuilder().Build(),
+					SecretCachingClient: fake.NewClientBuilder().Build(),
+				}
+
+				keypair, err := m.GetClusterCertificate(context.Background(), clusterKey, purpose)
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+				g.Expect(keypair).To(BeNil())
+			})
+		})
+	}
+}
+
+func TestGetClusterToken(t *testing.T) {
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "cluster"}
+	tokenSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: bsutil.TokenName(clusterKey.Name), Namespace: clusterKey.Namespace},
+		Data:       map[string][]byte{"value": []byte("token")},
+	}
+
+	t.Run("reads through the secret caching client", func(t *testing.T) {
+		g := NewWithT(t)
+
+		m := &Management{
+			Client: fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Get: func(_ context.Context, _ client.WithWatch, key client.ObjectKey, _ client.Object, _ ...client.GetOption) error {
+					return fmt.Errorf("unexpected live read of %s", key)
+				},
+			}).Build(),
+			SecretCachingClient: fake.NewClientBuilder().WithObjects(tokenSecret.DeepCopy()).Build(),
+		}
+
+		token, err := m.getClusterToken(context.Background(), clusterKey)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(token).To(Equal("token"))
+	})
+
+	t.Run("falls back to the live client on a cache miss", func(t *testing.T) {
+		g := NewWithT(t)
+
+		m := &Management{
+			Client:              fake.NewClientBuilder().WithObjects(tokenSecret.DeepCopy()).Build(),
+			SecretCachingClient: fake.NewClientBuilder().Build(),
+		}
+
+		token, err := m.getClusterToken(context.Background(), clusterKey)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(token).To(Equal("token"))
+	})
+
+	t.Run("returns an empty token when the secret is missing", func(t *testing.T) {
+		g := NewWithT(t)
+
+		m := &Management{
+			Client:              fake.NewClientBuilder().Build(),
+			SecretCachingClient: fake.NewClientBuilder().Build(),
+		}
+
+		token, err := m.getClusterToken(context.Background(), clusterKey)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(token).To(BeEmpty())
+	})
+}
+
+func TestGetClusterCertificates(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "cluster"}
+	certificateSecret := func(purpose secret.Purpose) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: secret.Name(clusterKey.Name, purpose), Namespace: clusterKey.Namespace},
+			Data:       map[string][]byte{secret.TLSCrtDataName: []byte(string(purpose) + "-cert")},
+		}
+	}
+
+	liveReads := []string{}
+	m := &Management{
+		Client: fake.NewClientBuilder().WithObjects(certificateSecret(secret.EtcdServerCA)).
+			WithInterceptorFuncs(interceptor.Funcs{
+				Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					liveReads = append(liveReads, key.Name)
+
+					return c.Get(ctx, key, obj, opts...)
+				},
+			}).Build(),
+		SecretCachingClient: fake.NewClientBuilder().
+			WithObjects(certificateSecret(secret.ClusterCA), certificateSecret(secret.ClientClusterCA)).Build(),
+	}
+
+	keyPairs, err := m.GetClusterCertificates(context.Background(), clusterKey,
+		secret.ClusterCA, secret.ClientClusterCA, secret.EtcdServerCA, secret.EtcdCA)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(keyPairs).To(HaveLen(3))
+	g.Expect(keyPairs[secret.ClusterCA].Cert).To(Equal([]byte("ca-cert")))
+	g.Expect(keyPairs[secret.ClientClusterCA].Cert).To(Equal([]byte("cca-cert")))
+	g.Expect(keyPairs[secret.EtcdServerCA].Cert).To(Equal([]byte("etcd-cert")))
+	g.Expect(keyPairs).ToNot(HaveKey(secret.EtcdCA))
+
+	// Only the certificates missing from the cache are read with the live client.
+	g.Expect(liveReads).To(ConsistOf("cluster-etcd", "cluster-peer-etcd"))
+
+	// The certificates already looked up for the reconcile are not read again, even when their secret is missing.
+	liveReads = []string{}
+	ctx := withClusterCertificates(context.Background(), clusterKey, []secret.Purpose{secret.EtcdServerCA, secret.EtcdCA}, keyPairs)
+
+	reused, err := m.GetClusterCertificates(ctx, clusterKey, secret.EtcdServerCA, secret.EtcdCA, secret.ClusterCA)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(reused).To(HaveLen(2))
+	g.Expect(reused[secret.EtcdServerCA]).To(BeIdenticalTo(keyPairs[secret.EtcdServerCA]))
+	g.Expect(reused[secret.ClusterCA].Cert).To(Equal([]byte("ca-cert")))
+	g.Expect(liveReads).To(BeEmpty())
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"encoding/json"
+	"slices"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+// NodeRoles are the RKE2 server roles hosted by a control plane machine. RKE2 servers host both roles unless
+// etcd is disabled, which makes a control-plane-only server, or the API server is disabled, which makes an
+// etcd-only server.
+type NodeRoles struct {
+	// Etcd is true if the machine hosts an etcd member.
+	Etcd bool
+
+	// ControlPlane is true if the machine hosts the API server.
+	ControlPlane bool
+}
+
+// nodeRolesFromServerConfig returns the roles of the servers configured with the given server config.
+func nodeRolesFromServerConfig(serverConfig *controlplanev1.RKE2ServerConfig) NodeRoles {
+	disabled := serverConfig.DisableComponents.KubernetesComponents
+
+	return NodeRoles{
+		Etcd:         !slices.Contains(disabled, controlplanev1.Etcd),
+		ControlPlane: !slices.Contains(disabled, controlplanev1.APIServer),
+	}
+}
+
+// RCPNodeRoles returns the roles of the machines created for the RKE2ControlPlane.
+func RCPNodeRoles(rcp *controlplanev1.RKE2ControlPlane) NodeRoles {
+	return nodeRolesFromServerConfig(&rcp.Spec.ServerConfig)
+}
+
+// MachineNodeRoles returns the roles of the machine, read from the RKE2ControlPlane server config recorded on the
+// machine when it was created. Machines without a valid recorded server config host both roles, as RKE2 servers do
+// by default.
+func MachineNodeRoles(machine *clusterv1.Machine) NodeRoles {
+	machineServerConfigStr, ok := machine.GetAnnotations()[controlplanev1.RKE2ServerConfigurationAnnotation]
+	if !ok {
+		return NodeRoles{Etcd: true, ControlPlane: true}
+	}
+
+	machineServerConfig := &controlplanev1.RKE2ServerConfig{}
+	if err := json.Unmarshal([]byte(machineServerConfigStr), &machineServerConfig); err != nil || machineServerConfig == nil {
+		return NodeRoles{Etcd: true, ControlPlane: true}
+	}
+
+	return nodeRolesFromServerConfig(machineServerConfig)
+}
+
+// HasEtcdRole returns a filter to find all machines hosting an etcd member.
+func HasEtcdRole() collections.Func {
+	return func(machine *clusterv1.Machine) bool {
+		return machine != nil && MachineNodeRoles(machine).Etcd
+	}
+}
+
+// HasControlPlaneRole returns a filter to find all machines hosting the API server.
+func HasControlPlaneRole() collections.Func {
+	return func(machine *clusterv1.Machine) bool {
+		return machine != nil && MachineNodeRoles(machine).ControlPlane
+	}
+}
+
+// matchNodeRoles checks if the roles of the machine match the roles of the machines created for the RKE2ControlPlane.
+func matchNodeRoles(rcp *controlplanev1.RKE2ControlPlane, machine *clusterv1.Machine) bool {
+	return MachineNodeRoles(machine) == RCPNodeRoles(rcp)
+}
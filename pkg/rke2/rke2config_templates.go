@@ -0,0 +1,180 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"k8s.io/klog/v2"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+// RKE2ConfigTemplateData is the data the templated RKE2ConfigSpec fields are rendered with for a machine.
+type RKE2ConfigTemplateData struct {
+	// MachineName is the name of the machine.
+	MachineName string
+
+	// ClusterName is the name of the cluster of the machine.
+	ClusterName string
+}
+
+// RenderRKE2ConfigTemplates returns a copy of the RKE2ConfigSpec of a machine of the RKE2ControlPlane, with the fields
+// listed in its RKE2ConfigTemplatedFieldsAnnotation rendered as Go templates with the data of the machine. Unknown
+// field paths are skipped, and the spec is returned unchanged when no field is templated.
+func RenderRKE2ConfigTemplates(
+	rcp *controlplanev1.RKE2ControlPlane,
+	spec *bootstrapv1.RKE2ConfigSpec,
+	data RKE2ConfigTemplateData,
+) (*bootstrapv1.RKE2ConfigSpec, error) {
+	rendered := spec.DeepCopy()
+
+	for path, field := range templatedRKE2ConfigFields(rcp) {
+		if err := renderField(reflect.ValueOf(rendered).Elem(), field, data); err != nil {
+			return nil, fmt.Errorf("failed to render RKE2ConfigSpec field %q: %w", path, err)
+		}
+	}
+
+	return rendered, nil
+}
+
+// renderedRKE2ConfigSpec returns the RKE2ConfigSpec of the RCP with its templated fields rendered for the machine. The
+// templates are returned unrendered if they fail to render, in which case no machine can be created from them either.
+func renderedRKE2ConfigSpec(rcp *controlplanev1.RKE2ControlPlane, machine *clusterv1.Machine) *bootstrapv1.RKE2ConfigSpec {
+	rendered, err := RenderRKE2ConfigTemplates(rcp, &rcp.Spec.RKE2ConfigSpec, RKE2ConfigTemplateData{
+		MachineName: machine.Name,
+		ClusterName: machine.Spec.ClusterName,
+	})
+	if err != nil {
+		klog.Background().Info("Failed to render the templated RKE2ConfigSpec fields",
+			"namespace", rcp.Namespace, "name", rcp.Name, "machine", machine.Name, "reason", err.Error())
+
+		return &rcp.Spec.RKE2ConfigSpec
+	}
+
+	return rendered
+}
+
+// renderedRCP returns a copy of the RCP whose RKE2ConfigSpec has its templated fields rendered for the machine, or the
+// RCP itself when none of its fields is templated.
+func renderedRCP(rcp *controlplanev1.RKE2ControlPlane, machine *clusterv1.Machine) *controlplanev1.RKE2ControlPlane {
+	if _, ok := rcp.GetAnnotations()[controlplanev1.RKE2ConfigTemplatedFieldsAnnotation]; !ok || machine == nil {
+		return rcp
+	}
+
+	rendered := *rcp
+	rendered.Spec.RKE2ConfigSpec = *renderedRKE2ConfigSpec(rcp, machine)
+
+	return &rendered
+}
+
+// templatedRKE2ConfigFields parses the RKE2ConfigTemplatedFieldsAnnotation of the RCP into the field index paths to
+// render, by field path. Unknown field paths are logged and skipped.
+func templatedRKE2ConfigFields(rcp *controlplanev1.RKE2ControlPlane) map[string][][]int {
+	value, ok := rcp.GetAnnotations()[controlplanev1.RKE2ConfigTemplatedFieldsAnnotation]
+	if !ok {
+		return nil
+	}
+
+	fields := map[string][][]int{}
+
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		field, err := resolveFieldPath(reflect.TypeOf(bootstrapv1.RKE2ConfigSpec{}), path)
+		if err != nil {
+			klog.Background().Info("Ignoring unknown RKE2ConfigSpec field path",
+				"namespace", rcp.Namespace, "name", rcp.Name, "annotation", controlplanev1.RKE2ConfigTemplatedFieldsAnnotation,
+				"path", path, "reason", err.Error())
+
+			continue
+		}
+
+		fields[path] = field
+	}
+
+	return fields
+}
+
+// renderField renders the string, or each string of the list of strings, at the resolved field path of the struct
+// value as a Go template. Nothing is done if a pointer along the path is nil.
+func renderField(v reflect.Value, field [][]int, data RKE2ConfigTemplateData) error {
+	for _, index := range field {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return nil
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.FieldByIndex(index)
+	}
+
+	switch {
+	case v.Kind() == reflect.String:
+		rendered, err := renderTemplate(v.String(), data)
+		if err != nil {
+			return err
+		}
+
+		v.SetString(rendered)
+
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		for i := range v.Len() {
+			rendered, err := renderTemplate(v.Index(i).String(), data)
+			if err != nil {
+				return err
+			}
+
+			v.Index(i).SetString(rendered)
+		}
+
+	default:
+		return fmt.Errorf("only strings and lists of strings can be templated, not %s", v.Type())
+	}
+
+	return nil
+}
+
+// renderTemplate renders the text as a Go template with the data, failing on missing keys.
+func renderTemplate(text string, data RKE2ConfigTemplateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", err
+	}
+
+	return rendered.String(), nil
+}
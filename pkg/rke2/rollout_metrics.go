@@ -0,0 +1,78 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// MatchedRolloutDecision is the result of the machines up to date with the RKE2ControlPlane configuration.
+	MatchedRolloutDecision = "matched"
+
+	// MismatchedRolloutDecision is the result of the machines requiring a rollout.
+	MismatchedRolloutDecision = "mismatched"
+)
+
+var (
+	rolloutDecisionMachines = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "caprke2_rollout_decision_machines",
+		Help: "Number of control plane machines matching or not the RKE2ControlPlane configuration at the last reconcile.",
+	}, []string{
+		"cluster", "result",
+	})
+
+	rolloutMismatchedMachines = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "caprke2_rollout_mismatched_machines",
+		Help: "Number of control plane machines requiring a rollout at the last reconcile, by mismatch reason.",
+	}, []string{
+		"cluster", "reason",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(rolloutDecisionMachines, rolloutMismatchedMachines)
+}
+
+// recordRolloutDecisions replaces the rollout decision metrics of the cluster with the given number of matching
+// machines and of mismatching machines by reason. The reasons are the MachineUpToDateCondition reasons, so the
+// cardinality is bounded, and reasons without machines at this reconcile are dropped.
+func recordRolloutDecisions(clusterKey ctrlclient.ObjectKey, matched int, mismatches map[string]int) {
+	cluster := clusterKey.String()
+
+	mismatched := 0
+
+	rolloutMismatchedMachines.DeletePartialMatch(prometheus.Labels{"cluster": cluster})
+
+	for reason, count := range mismatches {
+		rolloutMismatchedMachines.WithLabelValues(cluster, reason).Set(float64(count))
+		mismatched += count
+	}
+
+	rolloutDecisionMachines.WithLabelValues(cluster, MatchedRolloutDecision).Set(float64(matched))
+	rolloutDecisionMachines.WithLabelValues(cluster, MismatchedRolloutDecision).Set(float64(mismatched))
+}
+
+// ForgetRolloutDecisions removes the rollout decision metrics of the cluster, e.g. once its control plane is deleted.
+func ForgetRolloutDecisions(clusterKey ctrlclient.ObjectKey) {
+	labels := prometheus.Labels{"cluster": clusterKey.String()}
+
+	rolloutDecisionMachines.DeletePartialMatch(labels)
+	rolloutMismatchedMachines.DeletePartialMatch(labels)
+}
@@ -0,0 +1,71 @@
+package rke2
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+func TestRolloutDecisionMetrics(t *testing.T) {
+	g := NewWithT(t)
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "rollout-metrics"}}
+	clusterName := "default/rollout-metrics"
+
+	outdatedVersion := "v1.23.1"
+
+	upToDate := machine.DeepCopy()
+	upToDate.Name = "up-to-date"
+
+	versionMismatch := machine.DeepCopy()
+	versionMismatch.Name = "version-mismatch"
+	versionMismatch.Spec.Version = &outdatedVersion
+
+	otherVersionMismatch := versionMismatch.DeepCopy()
+	otherVersionMismatch.Name = "other-version-mismatch"
+
+	serverConfigMismatch := machine.DeepCopy()
+	serverConfigMismatch.Name = "server-config-mismatch"
+	serverConfigMismatch.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = "{\"cni\":\"cilium\"}"
+
+	// Machines being deleted are not rolled out, and not counted.
+	deleting := versionMismatch.DeepCopy()
+	deleting.Name = "deleting"
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	cp := &ControlPlane{
+		RCP:      rcp.DeepCopy(),
+		Cluster:  cluster,
+		Machines: collections.FromMachines(upToDate, versionMismatch, otherVersionMismatch, serverConfigMismatch, deleting),
+	}
+
+	cp.UpdateMachinesUpToDateCondition()
+
+	g.Expect(testutil.ToFloat64(rolloutDecisionMachines.WithLabelValues(clusterName, MatchedRolloutDecision))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(rolloutDecisionMachines.WithLabelValues(clusterName, MismatchedRolloutDecision))).To(Equal(3.0))
+	g.Expect(testutil.ToFloat64(rolloutMismatchedMachines.WithLabelValues(clusterName, controlplanev1.VersionMismatchReason))).
+		To(Equal(2.0))
+	g.Expect(testutil.ToFloat64(rolloutMismatchedMachines.WithLabelValues(clusterName, controlplanev1.ServerConfigMismatchReason))).
+		To(Equal(1.0))
+
+	// The metrics reflect the last reconcile only.
+	cp.Machines = collections.FromMachines(upToDate, serverConfigMismatch)
+	cp.UpdateMachinesUpToDateCondition()
+
+	g.Expect(testutil.ToFloat64(rolloutDecisionMachines.WithLabelValues(clusterName, MatchedRolloutDecision))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(rolloutDecisionMachines.WithLabelValues(clusterName, MismatchedRolloutDecision))).To(Equal(1.0))
+	g.Expect(testutil.CollectAndCount(rolloutMismatchedMachines)).To(Equal(1))
+
+	ForgetRolloutDecisions(util.ObjectKey(cluster))
+	g.Expect(testutil.CollectAndCount(rolloutDecisionMachines)).To(BeZero())
+	g.Expect(testutil.CollectAndCount(rolloutMismatchedMachines)).To(BeZero())
+}
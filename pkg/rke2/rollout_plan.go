@@ -0,0 +1,133 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+// RolloutPlan summarizes which control plane machines are outdated, why, and in which order they should be rolled out.
+type RolloutPlan struct {
+	// UpToDate are the names of the machines matching the RKE2ControlPlane configuration.
+	UpToDate []string
+
+	// Outdated maps the reason of the first RKE2ControlPlane configuration check failed by the outdated machines to
+	// their names.
+	Outdated map[string][]string
+
+	// Order are the names of the outdated machines in the recommended rollout order.
+	Order []string
+}
+
+// UpToDateCount returns the number of machines matching the RKE2ControlPlane configuration.
+func (p *RolloutPlan) UpToDateCount() int {
+	return len(p.UpToDate)
+}
+
+// OutdatedCount returns the number of machines requiring a rollout.
+func (p *RolloutPlan) OutdatedCount() int {
+	return len(p.Order)
+}
+
+// ControlPlaneRolloutPlan classifies the machines not being deleted against the RKE2ControlPlane configuration, using
+// the same checks as the rollout, and returns the plan to roll out the outdated ones. Files whose content comes from a
+// secret are not compared, as their content is not resolved.
+//
+// The recommended order is etcd-safe: machines which do not host etcd come first, as their removal never affects the
+// etcd quorum, followed by the machines with an unhealthy etcd member, as their removal does not lower the number of
+// healthy members, and finally the other etcd machines. Within each group the oldest machines come first.
+func ControlPlaneRolloutPlan(
+	infraConfigs map[string]*unstructured.Unstructured,
+	machineConfigs map[string]*bootstrapv1.RKE2Config,
+	rcp *controlplanev1.RKE2ControlPlane,
+	machines collections.Machines,
+) *RolloutPlan {
+	return controlPlaneRolloutPlan(infraConfigs, machineConfigs, nil, rcp, machines)
+}
+
+// RolloutPlan returns the plan to roll out the outdated machines of the control plane.
+func (c *ControlPlane) RolloutPlan() *RolloutPlan {
+	return controlPlaneRolloutPlan(c.InfraResources, c.Rke2Configs, c.fileContents, c.rolloutRCP(), c.Machines, c.AdditionalRolloutMatchers...)
+}
+
+func controlPlaneRolloutPlan(
+	infraConfigs map[string]*unstructured.Unstructured,
+	machineConfigs map[string]*bootstrapv1.RKE2Config,
+	contents fileContents,
+	rcp *controlplanev1.RKE2ControlPlane,
+	machines collections.Machines,
+	additionalMatchers ...collections.Func,
+) *RolloutPlan {
+	plan := &RolloutPlan{Outdated: map[string][]string{}}
+	outdated := []*clusterv1.Machine{}
+
+	for _, machine := range machines.Filter(collections.Not(collections.HasDeletionTimestamp)).SortedByCreationTimestamp() {
+		reason := rcpConfigurationMismatchReason(infraConfigs, machineConfigs, contents, rcp, machine, additionalMatchers...)
+		if reason == "" {
+			plan.UpToDate = append(plan.UpToDate, machine.Name)
+
+			continue
+		}
+
+		plan.Outdated[reason] = append(plan.Outdated[reason], machine.Name)
+		outdated = append(outdated, machine)
+	}
+
+	slices.SortStableFunc(outdated, func(a, b *clusterv1.Machine) int {
+		if priority := rolloutPriority(a) - rolloutPriority(b); priority != 0 {
+			return priority
+		}
+
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			if a.CreationTimestamp.Before(&b.CreationTimestamp) {
+				return -1
+			}
+
+			return 1
+		}
+
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	for _, machine := range outdated {
+		plan.Order = append(plan.Order, machine.Name)
+	}
+
+	return plan
+}
+
+// rolloutPriority returns the group of the machine in the rollout order, lower groups are rolled out first.
+func rolloutPriority(machine *clusterv1.Machine) int {
+	switch {
+	case !MachineNodeRoles(machine).Etcd:
+		return 0
+	case conditions.IsFalse(machine, controlplanev1.MachineEtcdMemberHealthyCondition):
+		return 1
+	default:
+		return 2 //nolint:mnd
+	}
+}
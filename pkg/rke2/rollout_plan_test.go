@@ -0,0 +1,93 @@
+package rke2
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+var _ = Describe("control plane rollout plan", func() {
+	var (
+		machines       collections.Machines
+		machineConfigs map[string]*bootstrapv1.RKE2Config
+		created        time.Time
+	)
+
+	// planMachine adds a machine created the given number of minutes after the first one, matching the RCP.
+	planMachine := func(name string, minutes int) *clusterv1.Machine {
+		m := machine.DeepCopy()
+		m.Name = name
+		m.CreationTimestamp = v1.NewTime(created.Add(time.Duration(minutes) * time.Minute))
+		m.Spec.Bootstrap.ConfigRef.Name = name
+
+		machines.Insert(m)
+		machineConfigs[name] = &bootstrapv1.RKE2Config{Spec: *rcp.Spec.RKE2ConfigSpec.DeepCopy()}
+
+		return m
+	}
+
+	BeforeEach(func() {
+		machines = collections.New()
+		machineConfigs = map[string]*bootstrapv1.RKE2Config{}
+		created = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	})
+
+	It("should group the outdated machines by reason", func() {
+		planMachine("up-to-date", 0)
+		planMachine("old-version", 1).Spec.Version = ptr.To("v1.23.0")
+		planMachine("other-version", 2).Spec.Version = ptr.To("v1.23.0")
+		planMachine("other-config", 3)
+		machineConfigs["other-config"].Spec.PreRKE2Commands = []string{"echo hello"}
+
+		deleting := planMachine("deleting", 4)
+		deleting.DeletionTimestamp = &v1.Time{Time: created}
+		deleting.Spec.Version = ptr.To("v1.23.0")
+
+		plan := ControlPlaneRolloutPlan(nil, machineConfigs, &rcp, machines)
+		Expect(plan.UpToDate).To(Equal([]string{"up-to-date"}))
+		Expect(plan.UpToDateCount()).To(Equal(1))
+		Expect(plan.OutdatedCount()).To(Equal(3))
+		Expect(plan.Outdated).To(Equal(map[string][]string{
+			controlplanev1.VersionMismatchReason:         {"old-version", "other-version"},
+			controlplanev1.BootstrapConfigMismatchReason: {"other-config"},
+		}))
+	})
+
+	It("should roll out the oldest machines first", func() {
+		planMachine("newest", 3).Spec.Version = ptr.To("v1.23.0")
+		planMachine("oldest", 1).Spec.Version = ptr.To("v1.23.0")
+		planMachine("older", 2).Spec.Version = ptr.To("v1.23.0")
+
+		Expect(ControlPlaneRolloutPlan(nil, machineConfigs, &rcp, machines).Order).To(Equal([]string{"oldest", "older", "newest"}))
+	})
+
+	It("should roll out the machines without a healthy etcd member first", func() {
+		planMachine("etcd-healthy", 1).Spec.Version = ptr.To("v1.23.0")
+
+		unhealthy := planMachine("etcd-unhealthy", 2)
+		unhealthy.Spec.Version = ptr.To("v1.23.0")
+		conditions.MarkFalse(unhealthy, controlplanev1.MachineEtcdMemberHealthyCondition,
+			controlplanev1.EtcdMemberInspectionFailedReason, clusterv1.ConditionSeverityError, "")
+
+		controlPlaneOnly := planMachine("control-plane-only", 3)
+		controlPlaneOnly.Annotations = map[string]string{
+			controlplanev1.RKE2ServerConfigurationAnnotation: "{\"cni\":\"calico\",\"cloudProviderName\":\"aws\"," +
+				"\"clusterDomain\":\"example.com\",\"disableComponents\":{\"kubernetesComponents\":[\"etcd\"]}}",
+		}
+
+		plan := ControlPlaneRolloutPlan(nil, machineConfigs, &rcp, machines)
+		Expect(plan.Order).To(Equal([]string{"control-plane-only", "etcd-unhealthy", "etcd-healthy"}))
+		Expect(plan.Outdated[controlplanev1.NodeRolesMismatchReason]).To(Equal([]string{"control-plane-only"}))
+	})
+})
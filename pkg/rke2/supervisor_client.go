@@ -0,0 +1,204 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/proxy"
+)
+
+const (
+	// supervisorAPIPrefix is the path prefix of the RKE2 supervisor API.
+	supervisorAPIPrefix = "/v1-rke2"
+
+	// supervisorUser is the user servers authenticate to the supervisor API as, using the cluster token as password.
+	supervisorUser = "server"
+
+	supervisorCallTimeout = 30 * time.Second
+)
+
+// supervisorClient calls the RKE2 supervisor API of a server.
+type supervisorClient interface {
+	// SecretsEncryptionStatus returns the secrets encryption status reported by the server.
+	SecretsEncryptionStatus(ctx context.Context) (*supervisorEncryptionState, error)
+
+	// SetSecretsEncryptionStage requests the server to move secrets encryption to the given stage.
+	SetSecretsEncryptionStage(ctx context.Context, stage SecretsEncryptionStage) error
+
+	// TokenAccepted returns true if the server accepts the token the client authenticates with.
+	TokenAccepted(ctx context.Context) (bool, error)
+}
+
+// supervisorClientFor returns a client for the supervisor API of the server running on the given node.
+type supervisorClientFor func(nodeName string) (supervisorClient, error)
+
+// supervisorClientForToken returns a client for the supervisor API of the server running on the given node,
+// authenticating with the given token.
+type supervisorClientForToken func(nodeName, token string) (supervisorClient, error)
+
+// supervisorEncryptionState is the secrets encryption status returned by the supervisor API.
+type supervisorEncryptionState struct {
+	Stage     string `json:"stage"`
+	ActiveKey string `json:"activekey"`
+	Enable    *bool  `json:"enable,omitempty"`
+	HashMatch bool   `json:"hashmatch,omitempty"`
+	HashError string `json:"hasherror,omitempty"`
+}
+
+// supervisorEncryptionRequest is the secrets encryption request sent to the supervisor API.
+type supervisorEncryptionRequest struct {
+	Stage *string `json:"stage,omitempty"`
+	Force bool    `json:"force"`
+}
+
+// httpSupervisorClient calls the supervisor API over HTTPS, authenticating with the cluster token.
+type httpSupervisorClient struct {
+	client  *http.Client
+	baseURL string
+	token   string
+}
+
+// newSupervisorClientGenerator returns a supervisorClientFor reaching the supervisor API of the servers by port-forwarding
+// to their kube-apiserver pod, which runs on the host network.
+func newSupervisorClientGenerator(restConfig *rest.Config, token string) supervisorClientFor {
+	clientFor := newSupervisorClientForTokenGenerator(restConfig)
+
+	return func(nodeName string) (supervisorClient, error) {
+		return clientFor(nodeName, token)
+	}
+}
+
+// newSupervisorClientForTokenGenerator returns a supervisorClientForToken reaching the supervisor API of the servers as
+// newSupervisorClientGenerator does.
+func newSupervisorClientForTokenGenerator(restConfig *rest.Config) supervisorClientForToken {
+	return func(nodeName, token string) (supervisorClient, error) {
+		dialer, err := proxy.NewDialer(proxy.Proxy{
+			Kind:       "pods",
+			Namespace:  metav1.NamespaceSystem,
+			KubeConfig: rest.CopyConfig(restConfig),
+			Port:       DefaultRKE2JoinPort,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create supervisor dialer")
+		}
+
+		podName := staticPodName(KubeAPIServerComponent, nodeName)
+
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, podName)
+			},
+			TLSClientConfig: &tls.Config{
+				MinVersion:         tls.VersionTLS12,
+				InsecureSkipVerify: true, //nolint:gosec // The connection is tunneled through the authenticated API server.
+			},
+		}
+
+		return &httpSupervisorClient{
+			client:  &http.Client{Transport: transport, Timeout: supervisorCallTimeout},
+			baseURL: "https://" + net.JoinHostPort(podName, strconv.Itoa(DefaultRKE2JoinPort)) + supervisorAPIPrefix,
+			token:   token,
+		}, nil
+	}
+}
+
+// SecretsEncryptionStatus returns the secrets encryption status reported by the server.
+func (c *httpSupervisorClient) SecretsEncryptionStatus(ctx context.Context) (*supervisorEncryptionState, error) {
+	body, err := c.do(ctx, http.MethodGet, "/encrypt/status", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &supervisorEncryptionState{}
+	if err := json.Unmarshal(body, state); err != nil {
+		return nil, errors.Wrap(err, "failed to decode secrets encryption status")
+	}
+
+	return state, nil
+}
+
+// SetSecretsEncryptionStage requests the server to move secrets encryption to the given stage.
+func (c *httpSupervisorClient) SetSecretsEncryptionStage(ctx context.Context, stage SecretsEncryptionStage) error {
+	stageName := string(stage)
+
+	request, err := json.Marshal(supervisorEncryptionRequest{Stage: &stageName})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, http.MethodPut, "/encrypt/config", request)
+
+	return err
+}
+
+// TokenAccepted returns true if the server accepts the token the client authenticates with. The readiness endpoint is
+// called, as it is authenticated but has no side effect; a server which is not ready still accepts the token.
+func (c *httpSupervisorClient) TokenAccepted(ctx context.Context) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/readyz", http.NoBody)
+	if err != nil {
+		return false, err
+	}
+
+	req.SetBasicAuth(supervisorUser, c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to call supervisor API /readyz")
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden, nil
+}
+
+func (c *httpSupervisorClient) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(supervisorUser, c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to call supervisor API %s", path)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read supervisor API %s response", path)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("supervisor API %s returned %s: %s", path, resp.Status, bytes.TrimSpace(respBody))
+	}
+
+	return respBody, nil
+}
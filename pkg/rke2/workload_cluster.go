@@ -21,6 +21,10 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
 	"strings"
 	"time"
 
@@ -29,8 +33,10 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/rest"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -44,20 +50,49 @@ import (
 
 	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
 	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	bsutil "github.com/rancher/cluster-api-provider-rke2/pkg/util"
 )
 
 const (
 	labelNodeRoleControlPlane = "node-role.kubernetes.io/master"
+	labelNodeRoleServer       = "node-role.kubernetes.io/control-plane"
+	labelNodeRoleEtcd         = "node-role.kubernetes.io/etcd"
 	remoteEtcdTimeout         = 30 * time.Second
 	etcdDialTimeout           = 10 * time.Second
 	etcdCallTimeout           = 15 * time.Second
 	minimalNodeCount          = 2
 	rke2ServingSecretKey      = "rke2-serving" //nolint: gosec
+
+	// nodeRKE2VersionAnnotation is an optional node annotation reporting the RKE2 version installed on the node.
+	// When it is missing, the kubelet version reported by the node is used instead.
+	nodeRKE2VersionAnnotation = "rke2.io/version"
+
+	// bootstrapTokenExpirationKey and bootstrapTokenUsageAuthenticationKey are keys of bootstrap token secrets.
+	bootstrapTokenExpirationKey          = "expiration"
+	bootstrapTokenUsageAuthenticationKey = "usage-bootstrap-authentication"
 )
 
 // ErrControlPlaneMinNodes is returned when the control plane has fewer than 2 nodes.
 var ErrControlPlaneMinNodes = errors.New("cluster has fewer than 2 control plane nodes; removing an etcd member is not supported")
 
+// ErrBootstrapTokensExpired is returned when all the bootstrap tokens of the workload cluster are expired.
+var ErrBootstrapTokensExpired = errors.New("bootstrap tokens are expired")
+
+// ErrNotSupportedWithExternalEtcd is returned by operations which only make sense for the embedded RKE2 etcd.
+var ErrNotSupportedWithExternalEtcd = errors.New("operation is not supported when using an external etcd")
+
+// ErrWorkerVersionSkew is returned when worker nodes lag the control plane by more than the supported version skew.
+var ErrWorkerVersionSkew = errors.New("worker nodes exceed the supported version skew")
+
+// ErrEtcdOverQuota is returned when a NOSPACE alarm is not cleared because the etcd database is still over quota.
+var ErrEtcdOverQuota = errors.New("etcd database is still over quota")
+
+// ErrNoHealthyEtcdLeaderCandidate is returned when there is no healthy etcd member to forward the leadership to.
+var ErrNoHealthyEtcdLeaderCandidate = errors.New("no healthy etcd member available to forward leadership to")
+
+// MaxWorkerMinorVersionSkew is the number of minor versions the kubelet is allowed to lag behind the kube-apiserver.
+const MaxWorkerMinorVersionSkew = 3
+
 // WorkloadCluster defines all behaviors necessary to upgrade kubernetes on a workload cluster.
 type WorkloadCluster interface {
 	// Basic health and status checks.
@@ -65,17 +100,55 @@ type WorkloadCluster interface {
 	UpdateNodeMetadata(ctx context.Context, controlPlane *ControlPlane) error
 
 	ClusterStatus(ctx context.Context) ClusterStatus
+	CheckBootstrapTokens(ctx context.Context) error
+	CheckWorkerVersionSkew(ctx context.Context, controlPlaneVersion string) error
+	NodeRKE2Versions(ctx context.Context, expectedVersion string) (map[string]NodeVersionStatus, error)
 	UpdateAgentConditions(controlPlane *ControlPlane)
 	UpdateEtcdConditions(controlPlane *ControlPlane)
+	UpdateEtcdMembersStatus(ctx context.Context, controlPlane *ControlPlane)
+	WaitForNodeReady(ctx context.Context, providerID string) error
+	CheckAPIServerReachableFromPods(ctx context.Context) (*APIServerReachability, error)
+	ControlPlaneComponentHealth(ctx context.Context) ([]ComponentHealth, error)
+	AddonStatus(ctx context.Context, rcp *controlplanev1.RKE2ControlPlane, manifests []*unstructured.Unstructured) (map[string]AddonStatus, error)
 	// Upgrade related tasks.
 
 	//	AllowBootstrapTokensToGetNodes(ctx context.Context) error
 
 	// State recovery tasks.
 	RemoveEtcdMemberForMachine(ctx context.Context, machine *clusterv1.Machine) error
+	RemoveNode(ctx context.Context, providerID string) error
+	DrainNode(ctx context.Context, nodeName string, opts DrainOptions) (*DrainResult, error)
+	EnsureControlPlaneLabels(ctx context.Context, machines collections.Machines) error
+	EnsureNodeTaintsRemovedOnReady(ctx context.Context, rcp *controlplanev1.RKE2ControlPlane, machines collections.Machines) ([]string, error)
+	ReapplyRKE2TokenIfMissing(ctx context.Context, machines collections.Machines) (bool, error)
+	GetNodeInternalIPs(ctx context.Context, machines collections.Machines) (map[string]string, error)
+	RestartControlPlaneComponent(ctx context.Context, component ControlPlaneComponent, nodeName string) error
+	ReconcileRKE2ServerConfigInPlace(ctx context.Context, controlPlane *ControlPlane) (bool, error)
 	ForwardEtcdLeadership(ctx context.Context, machine *clusterv1.Machine, leaderCandidate *clusterv1.Machine) error
 	ReconcileEtcdMembers(ctx context.Context, nodeNames []string, version semver.Version) ([]string, error)
 	EtcdMembers(ctx context.Context) ([]string, error)
+	DetectOrphanedEtcdMembers(ctx context.Context) ([]uint64, error)
+	ReconcileEtcdPeerURLs(ctx context.Context) ([]string, error)
+	EtcdLearnerStatus(ctx context.Context) ([]EtcdLearnerStatus, error)
+	EvacuateEtcdLearnerOnFailure(ctx context.Context, machines collections.Machines, timeout time.Duration) ([]string, error)
+	ReplaceEtcdMember(ctx context.Context, oldMachine, newMachine *clusterv1.Machine) (bool, error)
+	ListControlPlaneNodesWithEtcdMember(ctx context.Context, machines collections.Machines) ([]ControlPlaneNodeEtcdMember, error)
+	ClearEtcdAlarms(ctx context.Context, opts ClearEtcdAlarmsOptions) ([]etcd.MemberAlarm, error)
+	EtcdDBStatus(ctx context.Context, quotaBackendBytes int64) ([]EtcdMemberDBStatus, error)
+	CompactEtcd(ctx context.Context, keepRevisions int64) (int64, error)
+	DefragmentEtcd(ctx context.Context, quotaBackendBytes int64) ([]string, error)
+	EtcdVersions(ctx context.Context) ([]EtcdMemberVersion, error)
+	EtcdLeaderChanges(ctx context.Context) (*EtcdLeaderChanges, error)
+	VerifyEtcdSnapshotTarget(ctx context.Context, target *EtcdS3Target) (EtcdSnapshotTargetVerification, error)
+	CertificateExpiry(ctx context.Context) ([]CertificateExpiry, error)
+	GetKubeconfig(ctx context.Context, clusterKey ctrlclient.ObjectKey, ttl time.Duration) ([]byte, error)
+	EnsureSecretsEncryption(ctx context.Context, desired SecretsEncryptionSpec) (*SecretsEncryptionProgress, error)
+	ReconcileAddons(ctx context.Context, manifests []*unstructured.Unstructured) error
+	ReconcileControlPlaneVIP(ctx context.Context, rcp *controlplanev1.RKE2ControlPlane) (bool, error)
+	ControlPlaneReady(ctx context.Context) *ControlPlaneReadiness
+
+	// Close releases the etcd connections held by the workload cluster.
+	Close() error
 }
 
 // Workload defines operations on workload clusters.
@@ -85,6 +158,46 @@ type Workload struct {
 	Nodes               map[string]*corev1.Node
 	nodePatchHelpers    map[string]*patch.Helper
 	etcdClientGenerator etcd.ClientFor
+
+	// externalEtcd is set when the control plane uses an etcd cluster which is not hosted on its nodes.
+	externalEtcd *etcd.ExternalClientGenerator
+
+	// apiServerAddress is the host:port address of the workload cluster API server.
+	apiServerAddress string
+
+	// supervisorClientFor is set when the cluster token is known, so the RKE2 supervisor API of the servers can be called.
+	supervisorClientFor supervisorClientFor
+
+	// supervisorClientForToken calls the RKE2 supervisor API of the servers with any token, e.g. to find the token they
+	// accept.
+	supervisorClientForToken supervisorClientForToken
+
+	// preferredIPFamily is the primary IP family of the cluster, whose node addresses are preferred on dual-stack nodes.
+	preferredIPFamily corev1.IPFamily
+
+	// clusterKey and etcdMaintenanceLimiter throttle the etcd maintenance operations of the cluster, if set.
+	clusterKey             ctrlclient.ObjectKey
+	etcdMaintenanceLimiter *EtcdMaintenanceRateLimiter
+
+	// etcdRetryBackoff is the backoff of the etcd operations failing with transient errors, the default backoff of
+	// NewEtcdRetryBackoff is used if not set.
+	etcdRetryBackoff *wait.Backoff
+
+	// managementClient reads the cluster certificates, and repairs the cluster token, stored in the management cluster.
+	managementClient ctrlclient.Client
+
+	// etcdPeerProber checks that an etcd peer URL can be connected to, etcd peer URLs are not updated if not set.
+	etcdPeerProber etcdPeerProber
+
+	// componentHealthProber calls the health endpoints of the control plane components, which are not called if not set.
+	componentHealthProber componentHealthProber
+
+	// componentHealthTransport is the transport of the componentHealthProber, whose port-forwards are closed with the
+	// workload, if set.
+	componentHealthTransport *http.Transport
+
+	// healthProber caches the etcd member health of the cluster when it is watched, if set.
+	healthProber *WorkloadClusterHealthProber
 }
 
 // NewWorkload is creating a new ClusterWorkload instance.
@@ -98,20 +211,35 @@ func (m *Management) NewWorkload(
 		Client:           cl,
 		Nodes:            map[string]*corev1.Node{},
 		nodePatchHelpers: map[string]*patch.Helper{},
+		apiServerAddress: apiServerAddress(restConfig.Host),
+
+		clusterKey:             clusterKey,
+		etcdMaintenanceLimiter: m.EtcdMaintenanceRateLimiter,
+		etcdRetryBackoff:       m.EtcdRetryBackoff,
+		managementClient:       m.Client,
+		etcdPeerProber:         newEtcdPeerProber(restConfig),
+		healthProber:           m.HealthProber,
+	}
+
+	cluster := &clusterv1.Cluster{}
+	if err := m.Client.Get(ctx, clusterKey, cluster); ctrlclient.IgnoreNotFound(err) != nil {
+		return nil, errors.Wrap(err, "failed to get cluster")
+	}
+
+	workload.preferredIPFamily = preferredIPFamily(cluster)
+	workload.componentHealthProber, workload.componentHealthTransport = newComponentHealthProber(restConfig)
+
+	if err := m.setSupervisorClients(ctx, workload, restConfig, clusterKey); err != nil {
+		return nil, err
 	}
 
 	restConfig = rest.CopyConfig(restConfig)
 	restConfig.Timeout = remoteEtcdTimeout
 
 	// Retrieves the etcd CA key Pair
-	etcdKeyPair, err := m.getEtcdCAKeyPair(ctx, m.SecretCachingClient, clusterKey)
+	etcdKeyPair, err := m.getEtcdCAKeyPair(ctx, clusterKey)
 	if ctrlclient.IgnoreNotFound(err) != nil {
 		return nil, err
-	} else if apierrors.IsNotFound(err) {
-		etcdKeyPair, err = m.getEtcdCAKeyPair(ctx, m.Client, clusterKey)
-		if ctrlclient.IgnoreNotFound(err) != nil {
-			return nil, err
-		}
 	}
 
 	if apierrors.IsNotFound(err) || etcdKeyPair == nil {
@@ -149,11 +277,121 @@ func (m *Management) NewWorkload(
 		MinVersion:   tls.VersionTLS12,
 	}
 	tlsConfig.InsecureSkipVerify = true
-	workload.etcdClientGenerator = etcd.NewClientGenerator(restConfig, tlsConfig, etcdDialTimeout, etcdCallTimeout)
+	workload.etcdClientGenerator = etcd.NewPooledClientGenerator(restConfig, tlsConfig, etcdDialTimeout, etcdCallTimeout)
+
+	return workload, nil
+}
+
+// NewExternalEtcdWorkload is creating a new ClusterWorkload instance for a control plane using an external etcd cluster.
+// etcd operations are routed to the given endpoints using the user supplied etcd client certificate.
+func (m *Management) NewExternalEtcdWorkload(
+	ctx context.Context,
+	cl ctrlclient.Client,
+	restConfig *rest.Config,
+	clusterKey ctrlclient.ObjectKey,
+	endpoints []string,
+) (*Workload, error) {
+	tlsConfig, err := m.getExternalEtcdTLSConfig(ctx, clusterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := &clusterv1.Cluster{}
+	if err := m.Client.Get(ctx, clusterKey, cluster); err != nil {
+		return nil, errors.Wrap(err, "failed to get cluster")
+	}
+
+	generator := etcd.NewExternalClientGenerator(endpoints, tlsConfig, etcdDialTimeout, etcdCallTimeout,
+		etcd.PreferIPv6(isIPv6PrimaryCluster(cluster)))
+
+	workload := &Workload{
+		Client:              cl,
+		Nodes:               map[string]*corev1.Node{},
+		nodePatchHelpers:    map[string]*patch.Helper{},
+		etcdClientGenerator: generator,
+		externalEtcd:        generator,
+		apiServerAddress:    apiServerAddress(cluster.Spec.ControlPlaneEndpoint.String()),
+		preferredIPFamily:   preferredIPFamily(cluster),
+
+		clusterKey:             clusterKey,
+		etcdMaintenanceLimiter: m.EtcdMaintenanceRateLimiter,
+		etcdRetryBackoff:       m.EtcdRetryBackoff,
+		managementClient:       m.Client,
+	}
+
+	// The RKE2 supervisor API is served by the servers whether etcd is embedded or external.
+	if err := m.setSupervisorClients(ctx, workload, restConfig, clusterKey); err != nil {
+		return nil, err
+	}
 
 	return workload, nil
 }
 
+// setSupervisorClients sets the clients of the RKE2 supervisor API of the servers on the workload, the one using the
+// cluster token only when the token is known.
+func (m *Management) setSupervisorClients(
+	ctx context.Context,
+	workload *Workload,
+	restConfig *rest.Config,
+	clusterKey ctrlclient.ObjectKey,
+) error {
+	workload.supervisorClientForToken = newSupervisorClientForTokenGenerator(restConfig)
+
+	token, err := m.getClusterToken(ctx, clusterKey)
+	if err != nil {
+		return err
+	}
+
+	if token != "" {
+		workload.supervisorClientFor = newSupervisorClientGenerator(restConfig, token)
+	}
+
+	return nil
+}
+
+// preferredIPFamily returns the primary IP family of the cluster.
+func preferredIPFamily(cluster *clusterv1.Cluster) corev1.IPFamily {
+	if isIPv6PrimaryCluster(cluster) {
+		return corev1.IPv6Protocol
+	}
+
+	return corev1.IPv4Protocol
+}
+
+// isIPv6PrimaryCluster returns true if the first pod CIDR of the cluster, or the first service CIDR when no pod CIDR is
+// set, is an IPv6 CIDR. This is the primary IP family of IPv6-only and IPv6 first dual-stack clusters.
+func isIPv6PrimaryCluster(cluster *clusterv1.Cluster) bool {
+	if cluster.Spec.ClusterNetwork == nil {
+		return false
+	}
+
+	for _, cidrs := range []*clusterv1.NetworkRanges{cluster.Spec.ClusterNetwork.Pods, cluster.Spec.ClusterNetwork.Services} {
+		if cidrs == nil || len(cidrs.CIDRBlocks) == 0 {
+			continue
+		}
+
+		ip, _, err := net.ParseCIDR(cidrs.CIDRBlocks[0])
+
+		return err == nil && ip.To4() == nil
+	}
+
+	return false
+}
+
+// Close closes the port-forwards of the control plane component health probes, and the etcd connections pooled by the
+// workload cluster etcd client generator.
+func (w *Workload) Close() error {
+	if w.componentHealthTransport != nil {
+		w.componentHealthTransport.CloseIdleConnections()
+	}
+
+	if closer, ok := w.etcdClientGenerator.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
 // InitWorkload prepares workload for evaluating status conditions.
 func (w *Workload) InitWorkload(ctx context.Context, cp *ControlPlane) error {
 	nodes, err := w.getControlPlaneNodes(ctx)
@@ -283,6 +521,170 @@ func (w *Workload) ClusterStatus(ctx context.Context) ClusterStatus {
 	return status
 }
 
+// CheckBootstrapTokens verifies that nodes can still join the workload cluster.
+// RKE2 nodes join using the cluster token, which does not expire. When bootstrap tokens were created in the cluster
+// (e.g. with "rke2 token create") at least one of them must be usable for authentication and not expired, otherwise
+// ErrBootstrapTokensExpired is returned.
+func (w *Workload) CheckBootstrapTokens(ctx context.Context) error {
+	secrets := &corev1.SecretList{}
+	if err := w.List(ctx, secrets, ctrlclient.InNamespace(metav1.NamespaceSystem)); err != nil {
+		return errors.Wrap(err, "failed to list bootstrap token secrets")
+	}
+
+	now := time.Now()
+	tokens := 0
+
+	for i := range secrets.Items {
+		tokenSecret := &secrets.Items[i]
+		if tokenSecret.Type != corev1.SecretTypeBootstrapToken {
+			continue
+		}
+
+		tokens++
+
+		if isBootstrapTokenUsable(tokenSecret, now) {
+			return nil
+		}
+	}
+
+	if tokens == 0 {
+		return nil
+	}
+
+	return errors.Wrapf(ErrBootstrapTokensExpired, "none of the %d bootstrap tokens can be used to join nodes", tokens)
+}
+
+// isBootstrapTokenUsable returns true if the bootstrap token secret can be used for authentication and is not expired.
+func isBootstrapTokenUsable(tokenSecret *corev1.Secret, now time.Time) bool {
+	if string(tokenSecret.Data[bootstrapTokenUsageAuthenticationKey]) != "true" {
+		return false
+	}
+
+	expiration, ok := tokenSecret.Data[bootstrapTokenExpirationKey]
+	if !ok || len(expiration) == 0 {
+		return true
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, string(expiration))
+	if err != nil {
+		return false
+	}
+
+	return now.Before(expiresAt)
+}
+
+// NodeVersionStatus reports the RKE2 version expected on a node and the version it actually runs.
+type NodeVersionStatus struct {
+	// Expected is the desired RKE2 version.
+	Expected string
+	// Actual is the version reported by the node, either an RKE2 version or a Kubernetes version.
+	Actual string
+	// Matches is true if the actual version corresponds to the expected version.
+	Matches bool
+}
+
+// NodeRKE2Versions returns, for each node of the workload cluster, the expected and actual running version.
+// The actual version is read from the RKE2 version annotation if present, otherwise from the kubelet version.
+// Nodes only reporting a Kubernetes version are compared against the Kubernetes version of the expected RKE2 version.
+func (w *Workload) NodeRKE2Versions(ctx context.Context, expectedVersion string) (map[string]NodeVersionStatus, error) {
+	nodes := &corev1.NodeList{}
+	if err := w.List(ctx, nodes); err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+
+	versions := make(map[string]NodeVersionStatus, len(nodes.Items))
+
+	for _, node := range nodes.Items {
+		actualVersion := nodeVersion(&node)
+
+		versions[node.Name] = NodeVersionStatus{
+			Expected: expectedVersion,
+			Actual:   actualVersion,
+			Matches:  nodeVersionMatches(actualVersion, expectedVersion),
+		}
+	}
+
+	return versions, nil
+}
+
+// CheckWorkerVersionSkew verifies that no worker node lags the control plane by more than MaxWorkerMinorVersionSkew
+// minor versions, otherwise ErrWorkerVersionSkew is returned. Nodes whose version can't be parsed are ignored.
+func (w *Workload) CheckWorkerVersionSkew(ctx context.Context, controlPlaneVersion string) error {
+	cpVersion, err := semver.ParseTolerant(controlPlaneVersion)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse control plane version %q", controlPlaneVersion)
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := w.List(ctx, nodes); err != nil {
+		return errors.Wrap(err, "failed to list nodes")
+	}
+
+	skewed := []string{}
+
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if _, ok := node.Labels[labelNodeRoleControlPlane]; ok {
+			continue
+		}
+
+		workerVersion, err := semver.ParseTolerant(nodeVersion(node))
+		if err != nil {
+			continue
+		}
+
+		if exceedsWorkerVersionSkew(cpVersion, workerVersion) {
+			skewed = append(skewed, fmt.Sprintf("%s (%s)", node.Name, nodeVersion(node)))
+		}
+	}
+
+	if len(skewed) == 0 {
+		return nil
+	}
+
+	sort.Strings(skewed)
+
+	return errors.Wrapf(ErrWorkerVersionSkew, "nodes %s lag control plane version %s by more than %d minor versions",
+		strings.Join(skewed, ", "), controlPlaneVersion, MaxWorkerMinorVersionSkew)
+}
+
+// exceedsWorkerVersionSkew returns true if the worker version is more than MaxWorkerMinorVersionSkew
+// minor versions older than the control plane version.
+func exceedsWorkerVersionSkew(controlPlaneVersion, workerVersion semver.Version) bool {
+	if workerVersion.Major != controlPlaneVersion.Major {
+		return workerVersion.Major < controlPlaneVersion.Major
+	}
+
+	return controlPlaneVersion.Minor > workerVersion.Minor+MaxWorkerMinorVersionSkew
+}
+
+// nodeVersion returns the RKE2 version annotation of the node, falling back to the kubelet version.
+func nodeVersion(node *corev1.Node) string {
+	if version, ok := node.Annotations[nodeRKE2VersionAnnotation]; ok && version != "" {
+		return version
+	}
+
+	return node.Status.NodeInfo.KubeletVersion
+}
+
+// nodeVersionMatches compares the version reported by a node with the expected RKE2 version.
+func nodeVersionMatches(actualVersion, expectedVersion string) bool {
+	if actualVersion == "" || expectedVersion == "" {
+		return false
+	}
+
+	if bsutil.IsRKE2Version(actualVersion) {
+		return bsutil.CompareVersions(actualVersion, expectedVersion)
+	}
+
+	expectedKubeVersion, err := bsutil.Rke2ToKubeVersion(expectedVersion)
+	if err != nil {
+		return false
+	}
+
+	return bsutil.CompareVersions(actualVersion, expectedKubeVersion)
+}
+
 func hasProvisioningMachine(machines collections.Machines) bool {
 	for _, machine := range machines {
 		if machine.Status.NodeRef == nil {
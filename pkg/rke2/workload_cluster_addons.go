@@ -0,0 +1,245 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+const (
+	helmChartKind       = "HelmChart"
+	helmChartConfigKind = "HelmChartConfig"
+	helmCattleGroup     = "helm.cattle.io"
+
+	coreDNSDeploymentName       = "rke2-coredns-rke2-coredns"
+	metricsServerDeploymentName = "rke2-metrics-server"
+)
+
+// AddonStatus describes the readiness of an addon deployed in the workload cluster.
+type AddonStatus struct {
+	// Ready is the number of ready replicas of the addon.
+	Ready int32
+
+	// Desired is the number of desired replicas of the addon.
+	Desired int32
+}
+
+// IsReady returns true if all the desired replicas of the addon are ready.
+func (s AddonStatus) IsReady() bool {
+	return s.Ready >= s.Desired
+}
+
+// AddonManifests returns the helm.cattle.io HelmChart and HelmChartConfig objects contained in the
+// manifests ConfigMap referenced by the RKE2ControlPlane, sorted by ConfigMap key.
+func AddonManifests(configMap *corev1.ConfigMap) ([]*unstructured.Unstructured, error) {
+	keys := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	manifests := []*unstructured.Unstructured{}
+
+	for _, key := range keys {
+		decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewBufferString(configMap.Data[key]), 4096)
+
+		for {
+			obj := &unstructured.Unstructured{}
+			if err := decoder.Decode(&obj.Object); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				return nil, errors.Wrapf(err, "failed to decode manifest %s", key)
+			}
+
+			if obj.Object == nil || obj.GroupVersionKind().Group != helmCattleGroup {
+				continue
+			}
+
+			if kind := obj.GetKind(); kind != helmChartKind && kind != helmChartConfigKind {
+				continue
+			}
+
+			if obj.GetNamespace() == "" {
+				obj.SetNamespace(metav1.NamespaceSystem)
+			}
+
+			manifests = append(manifests, obj)
+		}
+	}
+
+	return manifests, nil
+}
+
+// AddonStatus returns the readiness of the RKE2 bundled coredns and metrics-server addons, unless disabled in the
+// RKE2ControlPlane, and of the given HelmCharts, keyed by addon name.
+func (w *Workload) AddonStatus(
+	ctx context.Context,
+	rcp *controlplanev1.RKE2ControlPlane,
+	manifests []*unstructured.Unstructured,
+) (map[string]AddonStatus, error) {
+	disabled := sets.New(rcp.Spec.ServerConfig.DisableComponents.PluginComponents...)
+	statuses := map[string]AddonStatus{}
+
+	for component, deploymentName := range map[controlplanev1.DisabledPluginComponent]string{
+		controlplanev1.CoreDNS:       coreDNSDeploymentName,
+		controlplanev1.MetricsServer: metricsServerDeploymentName,
+	} {
+		if disabled.Has(component) {
+			continue
+		}
+
+		status, err := w.deploymentAddonStatus(ctx, deploymentName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get status of addon %s", component)
+		}
+
+		statuses[string(component)] = status
+	}
+
+	for _, manifest := range manifests {
+		if manifest.GetKind() != helmChartKind {
+			continue
+		}
+
+		status, err := w.helmChartAddonStatus(ctx, manifest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get status of HelmChart %s", manifest.GetName())
+		}
+
+		statuses[manifest.GetName()] = status
+	}
+
+	return statuses, nil
+}
+
+func (w *Workload) deploymentAddonStatus(ctx context.Context, name string) (AddonStatus, error) {
+	deployment := &appsv1.Deployment{}
+	if err := w.Get(ctx, ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: name}, deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			// A missing deployment of an enabled addon is reported as not ready.
+			return AddonStatus{Desired: 1}, nil
+		}
+
+		return AddonStatus{}, err
+	}
+
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+
+	return AddonStatus{Ready: deployment.Status.ReadyReplicas, Desired: desired}, nil
+}
+
+// helmChartAddonStatus reports a HelmChart as ready once its helm install job succeeded.
+func (w *Workload) helmChartAddonStatus(ctx context.Context, manifest *unstructured.Unstructured) (AddonStatus, error) {
+	helmChart := &unstructured.Unstructured{}
+	helmChart.SetGroupVersionKind(manifest.GroupVersionKind())
+
+	if err := w.Get(ctx, ctrlclient.ObjectKeyFromObject(manifest), helmChart); err != nil {
+		if apierrors.IsNotFound(err) {
+			return AddonStatus{Desired: 1}, nil
+		}
+
+		return AddonStatus{}, err
+	}
+
+	jobName, _, _ := unstructured.NestedString(helmChart.Object, "status", "jobName")
+	if jobName == "" {
+		jobName = "helm-install-" + helmChart.GetName()
+	}
+
+	job := &batchv1.Job{}
+	if err := w.Get(ctx, ctrlclient.ObjectKey{Namespace: helmChart.GetNamespace(), Name: jobName}, job); err != nil {
+		if apierrors.IsNotFound(err) {
+			return AddonStatus{Desired: 1}, nil
+		}
+
+		return AddonStatus{}, err
+	}
+
+	if job.Status.Succeeded > 0 {
+		return AddonStatus{Ready: 1, Desired: 1}, nil
+	}
+
+	return AddonStatus{Desired: 1}, nil
+}
+
+// ReconcileAddons re-applies the given HelmChartConfigs when they are missing from the workload cluster
+// or their spec drifted from the manifest.
+func (w *Workload) ReconcileAddons(ctx context.Context, manifests []*unstructured.Unstructured) error {
+	var errs []error
+
+	for _, manifest := range manifests {
+		if manifest.GetKind() != helmChartConfigKind {
+			continue
+		}
+
+		if err := w.reconcileHelmChartConfig(ctx, manifest); err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to reconcile HelmChartConfig %s/%s", manifest.GetNamespace(), manifest.GetName()))
+		}
+	}
+
+	return kerrors.NewAggregate(errs)
+}
+
+func (w *Workload) reconcileHelmChartConfig(ctx context.Context, manifest *unstructured.Unstructured) error {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(manifest.GroupVersionKind())
+
+	if err := w.Get(ctx, ctrlclient.ObjectKeyFromObject(manifest), existing); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		log.FromContext(ctx).Info("Recreating missing HelmChartConfig", "HelmChartConfig", ctrlclient.ObjectKeyFromObject(manifest))
+
+		return w.Create(ctx, manifest.DeepCopy())
+	}
+
+	if equality.Semantic.DeepEqual(existing.Object["spec"], manifest.Object["spec"]) {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Reapplying drifted HelmChartConfig", "HelmChartConfig", ctrlclient.ObjectKeyFromObject(manifest))
+
+	existing.Object["spec"] = manifest.DeepCopy().Object["spec"]
+
+	return w.Update(ctx, existing)
+}
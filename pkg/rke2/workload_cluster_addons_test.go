@@ -0,0 +1,177 @@
+package rke2
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+const addonManifests = `apiVersion: helm.cattle.io/v1
+kind: HelmChartConfig
+metadata:
+  name: rke2-coredns
+  namespace: kube-system
+spec:
+  valuesContent: |-
+    replicaCount: 2
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unrelated
+---
+apiVersion: helm.cattle.io/v1
+kind: HelmChart
+metadata:
+  name: cert-manager
+spec:
+  chart: cert-manager
+`
+
+func newAddonsTestScheme(g *WithT) *runtime.Scheme {
+	s := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+
+	for _, kind := range []string{helmChartKind, helmChartConfigKind} {
+		gv := schema.GroupVersion{Group: helmCattleGroup, Version: "v1"}
+		s.AddKnownTypeWithName(gv.WithKind(kind), &unstructured.Unstructured{})
+		s.AddKnownTypeWithName(gv.WithKind(kind+"List"), &unstructured.UnstructuredList{})
+	}
+
+	return s
+}
+
+func parseAddonManifests(g *WithT) []*unstructured.Unstructured {
+	manifests, err := AddonManifests(&corev1.ConfigMap{Data: map[string]string{"addons.yaml": addonManifests}})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	return manifests
+}
+
+func TestAddonManifests(t *testing.T) {
+	g := NewWithT(t)
+
+	manifests := parseAddonManifests(g)
+	g.Expect(manifests).To(HaveLen(2))
+	g.Expect(manifests[0].GetKind()).To(Equal(helmChartConfigKind))
+	g.Expect(manifests[1].GetKind()).To(Equal(helmChartKind))
+	g.Expect(manifests[1].GetNamespace()).To(Equal(metav1.NamespaceSystem))
+
+	_, err := AddonManifests(&corev1.ConfigMap{Data: map[string]string{"broken.yaml": "kind: [HelmChart"}})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestAddonStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	coreDNS := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: coreDNSDeploymentName, Namespace: metav1.NamespaceSystem},
+		Spec:       appsv1.DeploymentSpec{Replicas: ptr.To[int32](2)},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+	}
+	helmChart := &unstructured.Unstructured{}
+	helmChart.SetAPIVersion("helm.cattle.io/v1")
+	helmChart.SetKind(helmChartKind)
+	helmChart.SetName("cert-manager")
+	helmChart.SetNamespace(metav1.NamespaceSystem)
+	installJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "helm-install-cert-manager", Namespace: metav1.NamespaceSystem},
+		Status:     batchv1.JobStatus{Succeeded: 1},
+	}
+
+	rcp := &controlplanev1.RKE2ControlPlane{}
+	rcp.Spec.ServerConfig.DisableComponents.PluginComponents = []controlplanev1.DisabledPluginComponent{controlplanev1.MetricsServer}
+
+	w := &Workload{
+		Client: fake.NewClientBuilder().WithScheme(newAddonsTestScheme(g)).WithObjects(coreDNS, helmChart, installJob).Build(),
+	}
+
+	statuses, err := w.AddonStatus(context.Background(), rcp, parseAddonManifests(g))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(statuses).To(Equal(map[string]AddonStatus{
+		string(controlplanev1.CoreDNS): {Ready: 1, Desired: 2},
+		"cert-manager":                 {Ready: 1, Desired: 1},
+	}))
+	g.Expect(statuses[string(controlplanev1.CoreDNS)].IsReady()).To(BeFalse())
+
+	// Enabled addons which are missing from the workload cluster are not ready.
+	rcp.Spec.ServerConfig.DisableComponents.PluginComponents = nil
+	w.Client = fake.NewClientBuilder().WithScheme(newAddonsTestScheme(g)).Build()
+
+	statuses, err = w.AddonStatus(context.Background(), rcp, parseAddonManifests(g))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(statuses).To(HaveLen(3))
+
+	for name, status := range statuses {
+		g.Expect(status.IsReady()).To(BeFalse(), name)
+	}
+}
+
+func TestReconcileAddons(t *testing.T) {
+	tests := []struct {
+		name          string
+		objs          []client.Object
+		expectedValue string
+	}{
+		{
+			name:          "recreates a missing HelmChartConfig",
+			expectedValue: "replicaCount: 2",
+		},
+		{
+			name: "reapplies a drifted HelmChartConfig",
+			objs: []client.Object{func() client.Object {
+				drifted := &unstructured.Unstructured{}
+				drifted.SetAPIVersion("helm.cattle.io/v1")
+				drifted.SetKind(helmChartConfigKind)
+				drifted.SetName("rke2-coredns")
+				drifted.SetNamespace(metav1.NamespaceSystem)
+				_ = unstructured.SetNestedField(drifted.Object, "replicaCount: 5", "spec", "valuesContent")
+
+				return drifted
+			}()},
+			expectedValue: "replicaCount: 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			w := &Workload{
+				Client: fake.NewClientBuilder().WithScheme(newAddonsTestScheme(g)).WithObjects(tt.objs...).Build(),
+			}
+
+			g.Expect(w.ReconcileAddons(context.Background(), parseAddonManifests(g))).To(Succeed())
+
+			helmChartConfig := &unstructured.Unstructured{}
+			helmChartConfig.SetAPIVersion("helm.cattle.io/v1")
+			helmChartConfig.SetKind(helmChartConfigKind)
+			g.Expect(w.Get(context.Background(), client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: "rke2-coredns"}, helmChartConfig)).
+				To(Succeed())
+
+			value, _, _ := unstructured.NestedString(helmChartConfig.Object, "spec", "valuesContent")
+			g.Expect(value).To(Equal(tt.expectedValue))
+
+			// HelmCharts are not reapplied, RKE2 deploys them from the manifests directory.
+			helmChart := &unstructured.Unstructured{}
+			helmChart.SetAPIVersion("helm.cattle.io/v1")
+			helmChart.SetKind(helmChartKind)
+			err := w.Get(context.Background(), client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: "cert-manager"}, helmChart)
+			g.Expect(err).To(HaveOccurred())
+		})
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// inClusterProbeLabels are the labels of the CoreDNS pods, which only become ready once they can reach the API server
+// through the kubernetes service, so they are used as an in-cluster reachability probe.
+var inClusterProbeLabels = map[string]string{"k8s-app": "kube-dns"}
+
+// ErrAPIServerUnreachableFromPods is returned when the API server can't be reached through the kubernetes service.
+var ErrAPIServerUnreachableFromPods = errors.New("API server is not reachable from the pods")
+
+// APIServerReachability reports whether the API server is reachable through the in-cluster kubernetes service.
+type APIServerReachability struct {
+	// Endpoints are the addresses of the kubernetes service endpoints.
+	Endpoints []string
+
+	// UnhealthyEndpoints are the endpoint addresses which don't point to a healthy API server, with the reason.
+	UnhealthyEndpoints map[string]string
+
+	// MissingAPIServers are the control plane nodes running a healthy API server which is not an endpoint of the
+	// kubernetes service, e.g. while it is being added during a scale up. They don't make the check fail.
+	MissingAPIServers []string
+
+	// Probed is true if the in-cluster probe ran, it does not while the probe pods are not deployed yet, e.g. while the
+	// first control plane node is bootstrapped.
+	Probed bool
+
+	// ProbeReachable is true if the in-cluster probe reached the API server.
+	ProbeReachable bool
+}
+
+// CheckAPIServerReachableFromPods checks that the API server is reachable from the pods, through the kubernetes
+// service of the default namespace, as reaching it from the management cluster doesn't guarantee it. Every address of
+// the service EndpointSlices must belong to a control plane node running a ready kube-apiserver pod, and the CoreDNS
+// pods, which need to reach the API server through the service to become ready, are used as an in-cluster probe.
+// The probe is skipped when no CoreDNS pod is deployed yet.
+//
+// The returned error wraps ErrAPIServerUnreachableFromPods if an endpoint is unhealthy or the probe failed, the
+// returned reachability reports the details in both cases.
+func (w *Workload) CheckAPIServerReachableFromPods(ctx context.Context) (*APIServerReachability, error) {
+	endpointSlices := &discoveryv1.EndpointSliceList{}
+	if err := w.List(ctx, endpointSlices,
+		ctrlclient.InNamespace(metav1.NamespaceDefault),
+		ctrlclient.MatchingLabels{discoveryv1.LabelServiceName: "kubernetes"},
+	); err != nil {
+		return nil, errors.Wrap(err, "failed to list kubernetes service endpoint slices")
+	}
+
+	apiServers, err := w.apiServersByAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reachability := &APIServerReachability{UnhealthyEndpoints: map[string]string{}}
+	endpointNodes := map[string]bool{}
+
+	for _, slice := range endpointSlices.Items {
+		for _, endpoint := range slice.Endpoints {
+			for _, address := range endpoint.Addresses {
+				reachability.Endpoints = append(reachability.Endpoints, address)
+
+				apiServer, found := apiServers[address]
+
+				switch {
+				case !found:
+					reachability.UnhealthyEndpoints[address] = "address does not belong to a control plane node"
+				case !apiServer.ready:
+					reachability.UnhealthyEndpoints[address] = fmt.Sprintf("kube-apiserver is not ready on node %s", apiServer.nodeName)
+				case endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready:
+					reachability.UnhealthyEndpoints[address] = "endpoint is not ready"
+				default:
+					endpointNodes[apiServer.nodeName] = true
+				}
+			}
+		}
+	}
+
+	for _, apiServer := range apiServers {
+		if apiServer.ready && !endpointNodes[apiServer.nodeName] && !slices.Contains(reachability.MissingAPIServers, apiServer.nodeName) {
+			reachability.MissingAPIServers = append(reachability.MissingAPIServers, apiServer.nodeName)
+		}
+	}
+
+	slices.Sort(reachability.Endpoints)
+	slices.Sort(reachability.MissingAPIServers)
+
+	if err := w.probeAPIServerFromPods(ctx, reachability); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(reachability.Endpoints) == 0:
+		return reachability, errors.Wrap(ErrAPIServerUnreachableFromPods, "the kubernetes service has no endpoints")
+	case len(reachability.UnhealthyEndpoints) > 0:
+		unhealthy := make([]string, 0, len(reachability.UnhealthyEndpoints))
+		for address, reason := range reachability.UnhealthyEndpoints {
+			unhealthy = append(unhealthy, address+": "+reason)
+		}
+
+		slices.Sort(unhealthy)
+
+		return reachability, errors.Wrapf(ErrAPIServerUnreachableFromPods, "unhealthy kubernetes service endpoints: %s",
+			strings.Join(unhealthy, ", "))
+	case reachability.Probed && !reachability.ProbeReachable:
+		return reachability, errors.Wrap(ErrAPIServerUnreachableFromPods, "no CoreDNS pod is ready")
+	}
+
+	return reachability, nil
+}
+
+// apiServerStatus is the status of the kube-apiserver running on a control plane node.
+type apiServerStatus struct {
+	nodeName string
+	ready    bool
+}
+
+// apiServersByAddress returns the status of the kube-apiserver of the control plane nodes, by node address.
+func (w *Workload) apiServersByAddress(ctx context.Context) (map[string]apiServerStatus, error) {
+	nodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list control plane nodes")
+	}
+
+	apiServers := map[string]apiServerStatus{}
+
+	for _, node := range nodes.Items {
+		pod := &corev1.Pod{}
+		podKey := ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: staticPodName(KubeAPIServerComponent, node.Name)}
+
+		status := apiServerStatus{nodeName: node.Name}
+		if err := w.Get(ctx, podKey, pod); err == nil {
+			status.ready = podReady(pod)
+		}
+
+		for _, address := range node.Status.Addresses {
+			if address.Type == corev1.NodeInternalIP || address.Type == corev1.NodeExternalIP {
+				apiServers[address.Address] = status
+			}
+		}
+	}
+
+	return apiServers, nil
+}
+
+// probeAPIServerFromPods reports whether the CoreDNS pods reach the API server from within the cluster.
+func (w *Workload) probeAPIServerFromPods(ctx context.Context, reachability *APIServerReachability) error {
+	pods := &corev1.PodList{}
+	if err := w.List(ctx, pods, ctrlclient.InNamespace(metav1.NamespaceSystem), ctrlclient.MatchingLabels(inClusterProbeLabels)); err != nil {
+		return errors.Wrap(err, "failed to list CoreDNS pods")
+	}
+
+	for i := range pods.Items {
+		if pods.Items[i].DeletionTimestamp != nil {
+			continue
+		}
+
+		reachability.Probed = true
+
+		if podReady(&pods.Items[i]) {
+			reachability.ProbeReachable = true
+
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package rke2
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCheckAPIServerReachableFromPods(t *testing.T) {
+	controlPlaneNode := func(name, address string) *corev1.Node {
+		node := readyNode(name, "", corev1.ConditionTrue)
+		node.Labels = map[string]string{labelNodeRoleControlPlane: "true"}
+		node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: address}}
+
+		return node
+	}
+
+	pod := func(namespace, name string, labels map[string]string, ready corev1.ConditionStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+			Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}}},
+		}
+	}
+
+	apiServerPod := func(nodeName string, ready corev1.ConditionStatus) *corev1.Pod {
+		return pod(metav1.NamespaceSystem, "kube-apiserver-"+nodeName, nil, ready)
+	}
+
+	coreDNSPod := func(ready corev1.ConditionStatus) *corev1.Pod {
+		return pod(metav1.NamespaceSystem, "rke2-coredns-rke2-coredns-abcde", inClusterProbeLabels, ready)
+	}
+
+	endpointSlice := func(addresses ...string) *discoveryv1.EndpointSlice {
+		endpoints := []discoveryv1.Endpoint{}
+		for _, address := range addresses {
+			endpoints = append(endpoints, discoveryv1.Endpoint{
+				Addresses:  []string{address},
+				Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)},
+			})
+		}
+
+		return &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: metav1.NamespaceDefault,
+				Name:      "kubernetes",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "kubernetes"},
+			},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints:   endpoints,
+		}
+	}
+
+	workload := func(objects ...client.Object) *Workload {
+		return &Workload{Client: fake.NewClientBuilder().WithObjects(objects...).Build()}
+	}
+
+	t.Run("succeeds when every endpoint is a healthy API server", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := workload(
+			controlPlaneNode("node-1", "10.0.0.1"), apiServerPod("node-1", corev1.ConditionTrue),
+			controlPlaneNode("node-2", "10.0.0.2"), apiServerPod("node-2", corev1.ConditionTrue),
+			endpointSlice("10.0.0.1", "10.0.0.2"),
+			coreDNSPod(corev1.ConditionTrue),
+		)
+
+		reachability, err := w.CheckAPIServerReachableFromPods(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(reachability.Endpoints).To(Equal([]string{"10.0.0.1", "10.0.0.2"}))
+		g.Expect(reachability.UnhealthyEndpoints).To(BeEmpty())
+		g.Expect(reachability.Probed).To(BeTrue())
+		g.Expect(reachability.ProbeReachable).To(BeTrue())
+	})
+
+	t.Run("reports the unhealthy endpoints", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := workload(
+			controlPlaneNode("node-1", "10.0.0.1"), apiServerPod("node-1", corev1.ConditionTrue),
+			controlPlaneNode("node-2", "10.0.0.2"), apiServerPod("node-2", corev1.ConditionFalse),
+			controlPlaneNode("node-3", "10.0.0.3"), apiServerPod("node-3", corev1.ConditionTrue),
+			endpointSlice("10.0.0.1", "10.0.0.2", "10.0.0.9"),
+			coreDNSPod(corev1.ConditionTrue),
+		)
+
+		reachability, err := w.CheckAPIServerReachableFromPods(context.Background())
+		g.Expect(err).To(MatchError(ErrAPIServerUnreachableFromPods))
+		g.Expect(reachability.UnhealthyEndpoints).To(HaveLen(2))
+		g.Expect(reachability.UnhealthyEndpoints).To(HaveKeyWithValue("10.0.0.2", ContainSubstring("node-2")))
+		g.Expect(reachability.UnhealthyEndpoints).To(HaveKey("10.0.0.9"))
+		g.Expect(reachability.MissingAPIServers).To(Equal([]string{"node-3"}))
+	})
+
+	t.Run("fails when the in-cluster probe can't reach the API server", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := workload(
+			controlPlaneNode("node-1", "10.0.0.1"), apiServerPod("node-1", corev1.ConditionTrue),
+			endpointSlice("10.0.0.1"),
+			coreDNSPod(corev1.ConditionFalse),
+		)
+
+		reachability, err := w.CheckAPIServerReachableFromPods(context.Background())
+		g.Expect(err).To(MatchError(ErrAPIServerUnreachableFromPods))
+		g.Expect(reachability.UnhealthyEndpoints).To(BeEmpty())
+		g.Expect(reachability.Probed).To(BeTrue())
+		g.Expect(reachability.ProbeReachable).To(BeFalse())
+	})
+
+	t.Run("skips the probe on a single API server being bootstrapped", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := workload(
+			controlPlaneNode("node-1", "10.0.0.1"), apiServerPod("node-1", corev1.ConditionTrue),
+			endpointSlice("10.0.0.1"),
+		)
+
+		reachability, err := w.CheckAPIServerReachableFromPods(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(reachability.Probed).To(BeFalse())
+	})
+}
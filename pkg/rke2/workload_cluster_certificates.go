@@ -0,0 +1,220 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// CertificateExpiryWarningThreshold is how long before their expiry workload cluster certificates are reported
+	// as expiring.
+	CertificateExpiryWarningThreshold = 30 * 24 * time.Hour
+
+	// APIServerCertificateName names the serving certificate presented by the API server.
+	APIServerCertificateName = "kube-apiserver"
+
+	// apiServerCertificateProbeInterval is how long the expiry of the API server serving certificate is cached for,
+	// so the API server is not dialed on every reconcile.
+	apiServerCertificateProbeInterval = time.Hour
+
+	certificateDialTimeout = 10 * time.Second
+)
+
+// CertificateExpiry is the expiry of a serving certificate of the workload cluster.
+type CertificateExpiry struct {
+	// Name identifies the certificate, i.e. kube-apiserver or the name of the secret it was read from.
+	Name string
+
+	// NotAfter is the time the certificate expires at.
+	NotAfter time.Time
+}
+
+// CertificateExpiry returns the expiry of the serving certificate presented by the API server, and of the rke2-serving
+// certificate of the RKE2 supervisor once it has been created. The kubelet certificates are not returned, as they are
+// only available on the nodes. The API server is dialed at most once per apiServerCertificateProbeInterval, the expiry
+// being cached in between.
+func (w *Workload) CertificateExpiry(ctx context.Context) ([]CertificateExpiry, error) {
+	expiries := []CertificateExpiry{}
+
+	if w.apiServerAddress != "" {
+		notAfter, err := probedAPIServerCertificates.notAfter(ctx, w.clusterKey, w.apiServerAddress)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to inspect the API server serving certificate")
+		}
+
+		expiries = append(expiries, CertificateExpiry{Name: APIServerCertificateName, NotAfter: notAfter})
+	}
+
+	servingSecret := &corev1.Secret{}
+
+	err := w.Get(ctx, ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: rke2ServingSecretKey}, servingSecret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, errors.Wrapf(err, "failed to get %s secret", rke2ServingSecretKey)
+	}
+
+	if err == nil {
+		notAfter, err := certificateNotAfter(servingSecret.Data[corev1.TLSCertKey])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s certificate", rke2ServingSecretKey)
+		}
+
+		expiries = append(expiries, CertificateExpiry{Name: rke2ServingSecretKey, NotAfter: notAfter})
+	}
+
+	return expiries, nil
+}
+
+// apiServerCertificateProbe is the expiry of the API server serving certificate presented at an address.
+type apiServerCertificateProbe struct {
+	address  string
+	notAfter time.Time
+	probedAt time.Time
+}
+
+// apiServerCertificatesTracker caches the expiry of the API server serving certificate of workload clusters. The zero
+// value is ready to use.
+type apiServerCertificatesTracker struct {
+	lock   sync.Mutex
+	probes map[ctrlclient.ObjectKey]apiServerCertificateProbe
+}
+
+var probedAPIServerCertificates = &apiServerCertificatesTracker{}
+
+// notAfter returns the expiry of the API server serving certificate of the workload cluster, dialing the API server
+// only when the cached expiry is older than apiServerCertificateProbeInterval or was probed at another address.
+// Failed probes are not cached.
+func (t *apiServerCertificatesTracker) notAfter(
+	ctx context.Context,
+	clusterKey ctrlclient.ObjectKey,
+	address string,
+) (time.Time, error) {
+	t.lock.Lock()
+	probe, ok := t.probes[clusterKey]
+	t.lock.Unlock()
+
+	if ok && probe.address == address && time.Since(probe.probedAt) < apiServerCertificateProbeInterval {
+		return probe.notAfter, nil
+	}
+
+	notAfter, err := servingCertificateNotAfter(ctx, address)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.probes == nil {
+		t.probes = map[ctrlclient.ObjectKey]apiServerCertificateProbe{}
+	}
+
+	t.probes[clusterKey] = apiServerCertificateProbe{address: address, notAfter: notAfter, probedAt: time.Now()}
+
+	return notAfter, nil
+}
+
+// forget drops the API server serving certificate expiry cached for the workload cluster.
+func (t *apiServerCertificatesTracker) forget(clusterKey ctrlclient.ObjectKey) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.probes, clusterKey)
+}
+
+// ForgetAPIServerCertificate drops the API server serving certificate expiry cached for the cluster, e.g. once its
+// control plane is deleted.
+func ForgetAPIServerCertificate(clusterKey ctrlclient.ObjectKey) {
+	probedAPIServerCertificates.forget(clusterKey)
+}
+
+// servingCertificateNotAfter returns the expiry of the serving certificate presented at the given address.
+// The certificate is not verified, as only its expiry is inspected.
+func servingCertificateNotAfter(ctx context.Context, address string) (time.Time, error) {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: certificateDialTimeout},
+		Config: &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: true, //nolint:gosec // The connection is only used to read the certificate expiry.
+		},
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer conn.Close()
+
+	peerCertificates := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(peerCertificates) == 0 {
+		return time.Time{}, errors.Errorf("no certificate presented by %s", address)
+	}
+
+	return peerCertificates[0].NotAfter, nil
+}
+
+// certificateNotAfter returns the expiry of the first certificate of the PEM data.
+func certificateNotAfter(data []byte) (time.Time, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}, errors.New("no PEM certificate found")
+	}
+
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return certificate.NotAfter, nil
+}
+
+// apiServerAddress returns the host:port address of the API server from a rest config host, which is either a URL
+// or a host with an optional port.
+func apiServerAddress(host string) string {
+	if host == "" {
+		return ""
+	}
+
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+
+	hostURL, err := url.Parse(host)
+	if err != nil || hostURL.Hostname() == "" {
+		return ""
+	}
+
+	if hostURL.Port() == "" {
+		return net.JoinHostPort(hostURL.Hostname(), "443")
+	}
+
+	return hostURL.Host
+}
@@ -0,0 +1,117 @@
+package rke2
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCertificateExpiry(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	notAfter := server.Certificate().NotAfter
+
+	defer ForgetAPIServerCertificate(ctrlclient.ObjectKey{})
+
+	t.Run("returns the API server certificate expiry", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{
+			Client:           fake.NewClientBuilder().Build(),
+			apiServerAddress: apiServerAddress(server.URL),
+		}
+
+		expiries, err := w.CertificateExpiry(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(expiries).To(ConsistOf(CertificateExpiry{Name: APIServerCertificateName, NotAfter: notAfter}))
+	})
+
+	t.Run("returns the rke2-serving certificate expiry", func(t *testing.T) {
+		g := NewWithT(t)
+
+		servingSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceSystem, Name: rke2ServingSecretKey},
+			Data: map[string][]byte{
+				corev1.TLSCertKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}),
+			},
+		}
+
+		w := &Workload{
+			Client:           fake.NewClientBuilder().WithObjects(servingSecret).Build(),
+			apiServerAddress: apiServerAddress(server.URL),
+		}
+
+		expiries, err := w.CertificateExpiry(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(expiries).To(ConsistOf(
+			CertificateExpiry{Name: APIServerCertificateName, NotAfter: notAfter},
+			CertificateExpiry{Name: rke2ServingSecretKey, NotAfter: notAfter},
+		))
+	})
+
+	t.Run("fails when the API server can't be reached", func(t *testing.T) {
+		g := NewWithT(t)
+
+		closed := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		closed.Close()
+
+		w := &Workload{
+			Client:           fake.NewClientBuilder().Build(),
+			apiServerAddress: apiServerAddress(closed.URL),
+		}
+
+		_, err := w.CertificateExpiry(context.Background())
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("caches the API server certificate expiry", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cachedServer := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+		clusterKey := ctrlclient.ObjectKey{Namespace: "default", Name: "cached"}
+		defer ForgetAPIServerCertificate(clusterKey)
+
+		w := &Workload{
+			Client:           fake.NewClientBuilder().Build(),
+			apiServerAddress: apiServerAddress(cachedServer.URL),
+			clusterKey:       clusterKey,
+		}
+
+		expiries, err := w.CertificateExpiry(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(expiries).To(HaveLen(1))
+
+		// The API server is not dialed again until the cached expiry is stale.
+		cachedServer.Close()
+
+		cached, err := w.CertificateExpiry(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cached).To(Equal(expiries))
+
+		ForgetAPIServerCertificate(clusterKey)
+
+		_, err = w.CertificateExpiry(context.Background())
+		g.Expect(err).To(HaveOccurred())
+	})
+}
+
+func TestAPIServerAddress(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(apiServerAddress("https://10.0.0.1:6443")).To(Equal("10.0.0.1:6443"))
+	g.Expect(apiServerAddress("https://api.example.com")).To(Equal("api.example.com:443"))
+	g.Expect(apiServerAddress("api.example.com:6443")).To(Equal("api.example.com:6443"))
+	g.Expect(apiServerAddress("https://[fd00::1]:6443")).To(Equal("[fd00::1]:6443"))
+	g.Expect(apiServerAddress(":0")).To(BeEmpty())
+	g.Expect(apiServerAddress("")).To(BeEmpty())
+}
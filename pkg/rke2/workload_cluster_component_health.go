@@ -0,0 +1,274 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/proxy"
+)
+
+// EtcdComponent is the etcd static pod, only run on the servers when the control plane does not use an external etcd.
+const EtcdComponent ControlPlaneComponent = "etcd"
+
+// componentHealthProbeTimeout is the timeout of each health endpoint call.
+const componentHealthProbeTimeout = 5 * time.Second
+
+// componentHealthEndpoint is a health endpoint served by a control plane component on the host network of the servers.
+type componentHealthEndpoint struct {
+	port   int
+	scheme string
+	path   string
+}
+
+// componentHealthEndpoints are the health endpoints of each control plane component, as probed by the kubelet.
+var componentHealthEndpoints = map[ControlPlaneComponent][]componentHealthEndpoint{
+	KubeAPIServerComponent: {
+		{port: 6443, scheme: "https", path: "/healthz"},
+		{port: 6443, scheme: "https", path: "/livez"},
+	},
+	KubeControllerManagerComponent: {
+		{port: 10257, scheme: "https", path: "/healthz"},
+	},
+	KubeSchedulerComponent: {
+		{port: 10259, scheme: "https", path: "/healthz"},
+		{port: 10259, scheme: "https", path: "/livez"},
+	},
+	EtcdComponent: {
+		{port: 2381, scheme: "http", path: "/health"},
+	},
+}
+
+// ComponentHealth is the health of a control plane component on a control plane node.
+type ComponentHealth struct {
+	// NodeName is the name of the control plane node.
+	NodeName string
+
+	// Component is the control plane component.
+	Component ControlPlaneComponent
+
+	// Healthy is true if the static pod of the component is ready and its health endpoints succeed.
+	Healthy bool
+
+	// Reason explains why the component is not healthy, empty if Healthy is true.
+	Reason string
+}
+
+// componentHealthProber calls the health endpoint of the component running on the given node, and returns an error
+// if it does not succeed.
+type componentHealthProber func(ctx context.Context, component ControlPlaneComponent, nodeName string, endpoint componentHealthEndpoint) error
+
+// ControlPlaneComponentHealth returns the health of the kube-apiserver, kube-controller-manager, kube-scheduler and,
+// unless the control plane uses an external etcd, etcd on each control plane node, as a replacement for the deprecated
+// ComponentStatus API. A component is healthy if its static pod is ready and its /healthz and /livez endpoints, the
+// /health endpoint for etcd, succeed when called on the node. Endpoints requiring authentication are not taken into
+// account, and endpoints are only checked when the workload cluster can be reached through a port-forward. Entries
+// are ordered by node, then by component.
+func (w *Workload) ControlPlaneComponentHealth(ctx context.Context) ([]ComponentHealth, error) {
+	nodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list control plane nodes")
+	}
+
+	components := []ControlPlaneComponent{KubeAPIServerComponent, KubeControllerManagerComponent, KubeSchedulerComponent}
+	if w.externalEtcd == nil {
+		components = append(components, EtcdComponent)
+	}
+
+	slices.SortFunc(nodes.Items, func(a, b corev1.Node) int { return strings.Compare(a.Name, b.Name) })
+
+	health := make([]ComponentHealth, 0, len(nodes.Items)*len(components))
+
+	for _, node := range nodes.Items {
+		for _, component := range components {
+			reason, err := w.componentNotHealthyReason(ctx, component, node.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			health = append(health, ComponentHealth{
+				NodeName:  node.Name,
+				Component: component,
+				Healthy:   reason == "",
+				Reason:    reason,
+			})
+		}
+	}
+
+	return health, nil
+}
+
+// componentNotHealthyReason returns why the component is not healthy on the node, or an empty string if it is.
+func (w *Workload) componentNotHealthyReason(ctx context.Context, component ControlPlaneComponent, nodeName string) (string, error) {
+	pod := &corev1.Pod{}
+
+	err := w.Get(ctx, ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: staticPodName(component, nodeName)}, pod)
+	if apierrors.IsNotFound(err) {
+		return "static pod not found", nil
+	}
+
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get %s pod on node %s", component, nodeName)
+	}
+
+	if !podReady(pod) {
+		return podNotReadyReason(pod), nil
+	}
+
+	if w.componentHealthProber == nil {
+		return "", nil
+	}
+
+	for _, endpoint := range componentHealthEndpoints[component] {
+		if err := w.componentHealthProber(ctx, component, nodeName, endpoint); err != nil {
+			return fmt.Sprintf("GET %s: %s", endpoint.path, err.Error()), nil
+		}
+	}
+
+	return "", nil
+}
+
+// podNotReadyReason returns why the pod is not ready, from the state of its containers when they report one.
+func podNotReadyReason(pod *corev1.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		switch {
+		case status.State.Waiting != nil:
+			return fmt.Sprintf("container %s is waiting: %s, restart count %d",
+				status.Name, status.State.Waiting.Reason, status.RestartCount)
+		case status.State.Terminated != nil:
+			return fmt.Sprintf("container %s is terminated: %s, restart count %d",
+				status.Name, status.State.Terminated.Reason, status.RestartCount)
+		case !status.Ready:
+			return fmt.Sprintf("container %s is not ready, restart count %d", status.Name, status.RestartCount)
+		}
+	}
+
+	return "pod is not ready"
+}
+
+// newComponentHealthProber returns a componentHealthProber calling the health endpoints of the components by
+// port-forwarding to their static pod, which runs on the host network, so the endpoints bound to the loopback
+// interface of the node can be reached. An endpoint rejecting the anonymous call is not considered failing.
+// The calls share the returned transport, so the port-forwards are kept alive and reused across the probes of the
+// workload cluster until its idle connections are closed.
+func newComponentHealthProber(restConfig *rest.Config) (componentHealthProber, *http.Transport) {
+	var lock sync.Mutex
+
+	// The proxy dialers forward to a single port, one dialer is used per health endpoint port.
+	dialers := map[string]*proxy.Dialer{}
+
+	dialerFor := func(port string) (*proxy.Dialer, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if dialer, ok := dialers[port]; ok {
+			return dialer, nil
+		}
+
+		portNumber, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid health endpoint port %q", port)
+		}
+
+		dialer, err := proxy.NewDialer(proxy.Proxy{
+			Kind:       "pods",
+			Namespace:  metav1.NamespaceSystem,
+			KubeConfig: rest.CopyConfig(restConfig),
+			Port:       portNumber,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create health endpoint dialer")
+		}
+
+		dialers[port] = dialer
+
+		return dialer, nil
+	}
+
+	transport := &http.Transport{
+		// The address is the static pod name and the port of the health endpoint.
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			podName, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+
+			dialer, err := dialerFor(port)
+			if err != nil {
+				return nil, err
+			}
+
+			return dialer.DialContext(ctx, network, podName)
+		},
+		TLSClientConfig: &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: true, //nolint:gosec // The connection is tunneled through the authenticated API server.
+		},
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   componentHealthProbeTimeout,
+	}
+
+	prober := func(ctx context.Context, component ControlPlaneComponent, nodeName string, endpoint componentHealthEndpoint) error {
+		podName := staticPodName(component, nodeName)
+		url := endpoint.scheme + "://" + net.JoinHostPort(podName, strconv.Itoa(endpoint.port)) + endpoint.path
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusUnauthorized, http.StatusForbidden:
+			// Drain the body so the connection can be reused.
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+
+			return nil
+		default:
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+			return errors.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+	}
+
+	return prober, transport
+}
@@ -0,0 +1,116 @@
+package rke2
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+)
+
+func TestControlPlaneComponentHealth(t *testing.T) {
+	controlPlaneNode := func(name string) *corev1.Node {
+		node := readyNode(name, "", corev1.ConditionTrue)
+		node.Labels = map[string]string{labelNodeRoleControlPlane: "true"}
+
+		return node
+	}
+	componentPod := func(component ControlPlaneComponent, nodeName string, ready corev1.ConditionStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceSystem, Name: staticPodName(component, nodeName)},
+			Status: corev1.PodStatus{
+				Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+				ContainerStatuses: []corev1.ContainerStatus{{Name: string(component), Ready: ready == corev1.ConditionTrue}},
+			},
+		}
+	}
+	healthyPods := func(nodeName string, components ...ControlPlaneComponent) []client.Object {
+		pods := []client.Object{}
+		for _, component := range components {
+			pods = append(pods, componentPod(component, nodeName, corev1.ConditionTrue))
+		}
+
+		return pods
+	}
+
+	t.Run("reports a degraded scheduler pod", func(t *testing.T) {
+		g := NewWithT(t)
+
+		degradedScheduler := componentPod(KubeSchedulerComponent, "node-2", corev1.ConditionFalse)
+		degradedScheduler.Status.ContainerStatuses[0].RestartCount = 7
+		degradedScheduler.Status.ContainerStatuses[0].State.Waiting = &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}
+
+		objects := []client.Object{controlPlaneNode("node-1"), controlPlaneNode("node-2"), degradedScheduler}
+		objects = append(objects, healthyPods("node-1",
+			KubeAPIServerComponent, KubeControllerManagerComponent, KubeSchedulerComponent, EtcdComponent)...)
+		objects = append(objects, healthyPods("node-2", KubeAPIServerComponent, KubeControllerManagerComponent)...)
+
+		probed := []string{}
+		w := &Workload{
+			Client: fake.NewClientBuilder().WithObjects(objects...).Build(),
+			componentHealthProber: func(_ context.Context, component ControlPlaneComponent, nodeName string, endpoint componentHealthEndpoint) error {
+				probed = append(probed, nodeName+"/"+string(component)+endpoint.path)
+
+				return nil
+			},
+		}
+
+		health, err := w.ControlPlaneComponentHealth(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(health).To(Equal([]ComponentHealth{
+			{NodeName: "node-1", Component: KubeAPIServerComponent, Healthy: true},
+			{NodeName: "node-1", Component: KubeControllerManagerComponent, Healthy: true},
+			{NodeName: "node-1", Component: KubeSchedulerComponent, Healthy: true},
+			{NodeName: "node-1", Component: EtcdComponent, Healthy: true},
+			{NodeName: "node-2", Component: KubeAPIServerComponent, Healthy: true},
+			{NodeName: "node-2", Component: KubeControllerManagerComponent, Healthy: true},
+			{
+				NodeName:  "node-2",
+				Component: KubeSchedulerComponent,
+				Reason:    "container kube-scheduler is waiting: CrashLoopBackOff, restart count 7",
+			},
+			{NodeName: "node-2", Component: EtcdComponent, Reason: "static pod not found"},
+		}))
+
+		// The health endpoints of the components whose pod is not ready are not called.
+		g.Expect(probed).To(ContainElements("node-1/kube-scheduler/healthz", "node-1/kube-scheduler/livez", "node-1/etcd/health"))
+		g.Expect(probed).ToNot(ContainElement(HavePrefix("node-2/kube-scheduler")))
+	})
+
+	t.Run("reports failing health endpoints", func(t *testing.T) {
+		g := NewWithT(t)
+
+		objects := []client.Object{controlPlaneNode("node-1")}
+		objects = append(objects, healthyPods("node-1", KubeAPIServerComponent, KubeControllerManagerComponent, KubeSchedulerComponent)...)
+
+		w := &Workload{
+			Client:       fake.NewClientBuilder().WithObjects(objects...).Build(),
+			externalEtcd: &etcd.ExternalClientGenerator{},
+			componentHealthProber: func(_ context.Context, component ControlPlaneComponent, _ string, endpoint componentHealthEndpoint) error {
+				if component == KubeSchedulerComponent && endpoint.path == "/livez" {
+					return errors.New("500 Internal Server Error: [-]leaderElection failed")
+				}
+
+				return nil
+			},
+		}
+
+		health, err := w.ControlPlaneComponentHealth(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(health).To(Equal([]ComponentHealth{
+			{NodeName: "node-1", Component: KubeAPIServerComponent, Healthy: true},
+			{NodeName: "node-1", Component: KubeControllerManagerComponent, Healthy: true},
+			{
+				NodeName:  "node-1",
+				Component: KubeSchedulerComponent,
+				Reason:    "GET /livez: 500 Internal Server Error: [-]leaderElection failed",
+			},
+		}))
+	})
+}
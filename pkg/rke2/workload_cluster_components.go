@@ -0,0 +1,158 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"sigs.k8s.io/cluster-api/util"
+)
+
+// ControlPlaneComponent is a control plane component run by RKE2 as a static pod on the servers.
+type ControlPlaneComponent string
+
+const (
+	// KubeAPIServerComponent is the kube-apiserver static pod.
+	KubeAPIServerComponent ControlPlaneComponent = "kube-apiserver"
+
+	// KubeControllerManagerComponent is the kube-controller-manager static pod.
+	KubeControllerManagerComponent ControlPlaneComponent = "kube-controller-manager"
+
+	// KubeSchedulerComponent is the kube-scheduler static pod.
+	KubeSchedulerComponent ControlPlaneComponent = "kube-scheduler"
+)
+
+const (
+	// controlPlaneComponentRestartTimeout is how long a restarted component has to become healthy again.
+	controlPlaneComponentRestartTimeout = 5 * time.Minute
+
+	// controlPlaneComponentPollInterval is how often the restarted component is checked.
+	controlPlaneComponentPollInterval = time.Second
+)
+
+// ErrUnsupportedControlPlaneComponent is returned when restarting a component which is not a control plane static pod.
+var ErrUnsupportedControlPlaneComponent = errors.New("unsupported control plane component")
+
+// ErrLastAPIServer is returned when restarting the API server of the only ready control plane node.
+var ErrLastAPIServer = errors.New("the API server is not running on any other control plane node")
+
+// ErrControlPlaneComponentNotHealthy is returned when a restarted component doesn't become healthy again in time.
+var ErrControlPlaneComponentNotHealthy = errors.New("control plane component is not healthy")
+
+// RestartControlPlaneComponent restarts the static pod of the component on the given node, so configuration changes
+// which don't require a rollout are applied in place. The mirror pod is deleted, which makes the kubelet sync the
+// static pod from the manifest written by RKE2 again, and the call waits for a new pod to be ready. The returned error
+// wraps ErrControlPlaneComponentNotHealthy if it isn't ready in time. The API server is never restarted on the only
+// ready control plane node, as the workload cluster would be unreachable while it restarts.
+func (w *Workload) RestartControlPlaneComponent(ctx context.Context, component ControlPlaneComponent, nodeName string) error {
+	switch component {
+	case KubeAPIServerComponent, KubeControllerManagerComponent, KubeSchedulerComponent:
+	default:
+		return errors.Wrapf(ErrUnsupportedControlPlaneComponent, "cannot restart %s", component)
+	}
+
+	if component == KubeAPIServerComponent {
+		if err := w.checkOtherAPIServerAvailable(ctx, nodeName); err != nil {
+			return err
+		}
+	}
+
+	podKey := ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: staticPodName(component, nodeName)}
+
+	pod := &corev1.Pod{}
+	if err := w.Get(ctx, podKey, pod); err != nil {
+		return errors.Wrapf(err, "failed to get %s pod on node %s", component, nodeName)
+	}
+
+	previousUID := pod.UID
+
+	if err := w.Delete(ctx, pod, ctrlclient.Preconditions{UID: &previousUID}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete %s pod on node %s", component, nodeName)
+	}
+
+	log.FromContext(ctx).Info("Restarted control plane component", "component", component, "node", nodeName)
+
+	ctx, cancel := context.WithTimeout(ctx, controlPlaneComponentRestartTimeout)
+	defer cancel()
+
+	notReadyReason := "pod has not been recreated yet"
+
+	for {
+		pod := &corev1.Pod{}
+
+		err := w.Get(ctx, podKey, pod)
+
+		switch {
+		case err != nil && !apierrors.IsNotFound(err):
+			notReadyReason = err.Error()
+		case err == nil && pod.UID != previousUID:
+			if podReady(pod) {
+				return nil
+			}
+
+			notReadyReason = "pod is not ready"
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ErrControlPlaneComponentNotHealthy, "%s on node %s: %s", component, nodeName, notReadyReason)
+		case <-time.After(controlPlaneComponentPollInterval):
+		}
+	}
+}
+
+// checkOtherAPIServerAvailable returns an error wrapping ErrLastAPIServer unless a control plane node other than the
+// given one is ready.
+func (w *Workload) checkOtherAPIServerAvailable(ctx context.Context, nodeName string) error {
+	nodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list control plane nodes")
+	}
+
+	for i := range nodes.Items {
+		if nodes.Items[i].Name != nodeName && util.IsNodeReady(&nodes.Items[i]) {
+			return nil
+		}
+	}
+
+	return errors.Wrapf(ErrLastAPIServer, "refusing to restart the API server on node %s", nodeName)
+}
+
+// staticPodName returns the name of the mirror pod of the component static pod on the given node.
+func staticPodName(component ControlPlaneComponent, nodeName string) string {
+	return fmt.Sprintf("%s-%s", component, nodeName)
+}
+
+// podReady returns true if the pod reports Ready=true.
+func podReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
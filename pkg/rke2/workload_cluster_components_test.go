@@ -0,0 +1,99 @@
+package rke2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRestartControlPlaneComponent(t *testing.T) {
+	controlPlaneNode := func(name string, ready corev1.ConditionStatus) *corev1.Node {
+		node := readyNode(name, "", ready)
+		node.Labels = map[string]string{labelNodeRoleControlPlane: "true"}
+
+		return node
+	}
+
+	componentPod := func(name string, uid types.UID, ready corev1.ConditionStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceSystem, Name: name, UID: uid},
+			Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}}},
+		}
+	}
+
+	podKey := client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: "kube-scheduler-node-1"}
+
+	t.Run("waits for the restarted component to be ready", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cl := fake.NewClientBuilder().WithObjects(
+			controlPlaneNode("node-1", corev1.ConditionTrue),
+			componentPod("kube-scheduler-node-1", "old", corev1.ConditionTrue),
+		).Build()
+		w := &Workload{Client: cl}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		go func() {
+			// The kubelet recreates the mirror pod once it has been deleted.
+			for !apierrors.IsNotFound(cl.Get(ctx, podKey, &corev1.Pod{})) {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			_ = cl.Create(ctx, componentPod("kube-scheduler-node-1", "", corev1.ConditionTrue))
+		}()
+
+		g.Expect(w.RestartControlPlaneComponent(ctx, KubeSchedulerComponent, "node-1")).To(Succeed())
+	})
+
+	t.Run("fails when the restarted component doesn't become ready", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cl := fake.NewClientBuilder().WithObjects(
+			controlPlaneNode("node-1", corev1.ConditionTrue),
+			componentPod("kube-scheduler-node-1", "old", corev1.ConditionTrue),
+		).Build()
+		w := &Workload{Client: cl}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		err := w.RestartControlPlaneComponent(ctx, KubeSchedulerComponent, "node-1")
+		g.Expect(err).To(MatchError(ErrControlPlaneComponentNotHealthy))
+		g.Expect(err.Error()).To(ContainSubstring("pod has not been recreated yet"))
+	})
+
+	t.Run("refuses to restart the API server on the only ready control plane node", func(t *testing.T) {
+		g := NewWithT(t)
+
+		apiServerPod := componentPod("kube-apiserver-node-1", "old", corev1.ConditionTrue)
+		cl := fake.NewClientBuilder().WithObjects(
+			controlPlaneNode("node-1", corev1.ConditionTrue),
+			controlPlaneNode("node-2", corev1.ConditionFalse),
+			apiServerPod,
+		).Build()
+		w := &Workload{Client: cl}
+
+		err := w.RestartControlPlaneComponent(context.Background(), KubeAPIServerComponent, "node-1")
+		g.Expect(err).To(MatchError(ErrLastAPIServer))
+		g.Expect(cl.Get(context.Background(), client.ObjectKeyFromObject(apiServerPod), &corev1.Pod{})).To(Succeed())
+	})
+
+	t.Run("refuses to restart other components", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{Client: fake.NewClientBuilder().Build()}
+
+		err := w.RestartControlPlaneComponent(context.Background(), ControlPlaneComponent("etcd"), "node-1")
+		g.Expect(err).To(MatchError(ErrUnsupportedControlPlaneComponent))
+	})
+}
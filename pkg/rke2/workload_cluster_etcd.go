@@ -19,15 +19,22 @@ package rke2
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/blang/semver/v4"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
 	etcdutil "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/util"
 )
 
@@ -37,6 +44,10 @@ func (w *Workload) ReconcileEtcdMembers(ctx context.Context, nodeNames []string,
 	allRemovedMembers := []string{}
 	allErrs := []error{}
 
+	if w.externalEtcd != nil {
+		return nil, errors.Wrap(ErrNotSupportedWithExternalEtcd, "etcd members are not bound to nodes")
+	}
+
 	// Return early for clusters without an etcd certificate secret
 	if w.etcdClientGenerator == nil {
 		return allRemovedMembers, nil
@@ -92,9 +103,101 @@ loopmembers:
 	return removedMembers, errs
 }
 
+// DetectOrphanedEtcdMembers returns the IDs of the etcd members without a corresponding control plane node, as left
+// behind by an ungraceful node replacement. A member corresponds to a node when its name was generated from the node
+// name and, if the node reports its addresses, when one of its peer URLs points to one of these addresses; so when a
+// node is replaced by a node with the same name, the member of the previous node is reported as orphaned.
+// Members which have not started yet are never reported, as they are still joining the cluster.
+func (w *Workload) DetectOrphanedEtcdMembers(ctx context.Context) ([]uint64, error) {
+	if w.externalEtcd != nil {
+		return nil, errors.Wrap(ErrNotSupportedWithExternalEtcd, "etcd members are not bound to nodes")
+	}
+
+	// Return early for clusters without an etcd certificate secret
+	if w.etcdClientGenerator == nil {
+		return nil, nil
+	}
+
+	nodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list control plane nodes")
+	}
+
+	nodeNames := make([]string, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		nodeNames = append(nodeNames, node.Name)
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	orphans := []uint64{}
+
+loopmembers:
+	for _, member := range members {
+		if member.Name == "" {
+			continue
+		}
+
+		for i := range nodes.Items {
+			if etcdMemberMatchesNode(member, &nodes.Items[i]) {
+				continue loopmembers
+			}
+		}
+
+		orphans = append(orphans, member.ID)
+	}
+
+	return orphans, nil
+}
+
+// etcdMemberMatchesNode returns true if the member name was generated from the node name and, when both the member
+// and the node report addresses, one of the member peer URLs points to one of the node addresses.
+func etcdMemberMatchesNode(member *etcd.Member, node *corev1.Node) bool {
+	if etcdutil.NodeNameFromMember(member) != node.Name {
+		return false
+	}
+
+	if len(member.PeerURLs) == 0 || len(node.Status.Addresses) == 0 {
+		return true
+	}
+
+	return etcdPeerURLsMatchNode(member, node)
+}
+
+// etcdPeerURLsMatchNode returns true if one of the member peer URLs points to one of the node addresses.
+func etcdPeerURLsMatchNode(member *etcd.Member, node *corev1.Node) bool {
+	for _, peerURL := range member.PeerURLs {
+		u, err := url.Parse(peerURL)
+		if err != nil {
+			continue
+		}
+
+		for _, address := range node.Status.Addresses {
+			if address.Address == u.Hostname() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // RemoveEtcdMemberForMachine removes the etcd member from the target cluster's etcd cluster.
 // Removing the last remaining member of the cluster is not supported.
 func (w *Workload) RemoveEtcdMemberForMachine(ctx context.Context, machine *clusterv1.Machine) error {
+	if w.externalEtcd != nil {
+		return errors.Wrap(ErrNotSupportedWithExternalEtcd, "etcd members are not bound to machines")
+	}
+
 	if machine == nil || machine.Status.NodeRef == nil {
 		// Nothing to do, no node for Machine
 		return nil
@@ -103,7 +206,14 @@ func (w *Workload) RemoveEtcdMemberForMachine(ctx context.Context, machine *clus
 	return w.removeMemberForNode(ctx, machine.Status.NodeRef.Name)
 }
 
+// removeMemberForNode removes the etcd member of the node, retrying on transient etcd errors.
 func (w *Workload) removeMemberForNode(ctx context.Context, name string) error {
+	return w.retryEtcdOperation(ctx, "removing etcd member", func() error {
+		return w.tryRemoveMemberForNode(ctx, name)
+	})
+}
+
+func (w *Workload) tryRemoveMemberForNode(ctx context.Context, name string) error {
 	controlPlaneNodes, err := w.getControlPlaneNodes(ctx)
 	if err != nil {
 		return err
@@ -155,8 +265,20 @@ func (w *Workload) removeMemberForNode(ctx context.Context, name string) error {
 	return nil
 }
 
-// ForwardEtcdLeadership forwards etcd leadership to the first follower.
+// ForwardEtcdLeadership forwards etcd leadership away from the member of the given machine, if it is the leader.
+// The leadership is moved to the member of the leader candidate when it is healthy, otherwise to the first healthy peer.
+// The leadership is forwarded again on transient etcd errors, e.g. when another election took place meanwhile.
 func (w *Workload) ForwardEtcdLeadership(ctx context.Context, machine *clusterv1.Machine, leaderCandidate *clusterv1.Machine) error {
+	return w.retryEtcdOperation(ctx, "forwarding etcd leadership", func() error {
+		return w.forwardEtcdLeadership(ctx, machine, leaderCandidate)
+	})
+}
+
+func (w *Workload) forwardEtcdLeadership(ctx context.Context, machine *clusterv1.Machine, leaderCandidate *clusterv1.Machine) error {
+	if w.externalEtcd != nil {
+		return errors.Wrap(ErrNotSupportedWithExternalEtcd, "etcd leadership is not bound to machines")
+	}
+
 	if machine == nil || machine.Status.NodeRef == nil {
 		return nil
 	}
@@ -201,10 +323,25 @@ func (w *Workload) ForwardEtcdLeadership(ctx context.Context, machine *clusterv1
 		return nil
 	}
 
-	// Move the leader to the provided candidate.
+	// Move the leader to the provided candidate, or to any other healthy peer if the candidate can't take over.
 	nextLeader := etcdutil.MemberForName(members, leaderCandidate.Status.NodeRef.Name)
+	if !isHealthyEtcdLeaderCandidate(nextLeader, currentMember) {
+		log.FromContext(ctx).Info(fmt.Sprintf("Etcd member of node %s can't take over leadership, looking for another healthy peer",
+			leaderCandidate.Status.NodeRef.Name))
+
+		nextLeader = nil
+
+		for _, member := range members {
+			if isHealthyEtcdLeaderCandidate(member, currentMember) {
+				nextLeader = member
+
+				break
+			}
+		}
+	}
+
 	if nextLeader == nil {
-		return errors.Errorf("failed to get etcd member from node %q", leaderCandidate.Status.NodeRef.Name)
+		return errors.Wrapf(ErrNoHealthyEtcdLeaderCandidate, "failed to forward leadership of etcd member %s", currentMember.Name)
 	}
 
 	log.FromContext(ctx).Info(fmt.Sprintf("Moving leader from %s to %s", currentMember.Name, nextLeader.Name))
@@ -216,6 +353,16 @@ func (w *Workload) ForwardEtcdLeadership(ctx context.Context, machine *clusterv1
 	return nil
 }
 
+// isHealthyEtcdLeaderCandidate returns true if the member is a started voting member without alarms,
+// other than the current leader.
+func isHealthyEtcdLeaderCandidate(member, currentLeader *etcd.Member) bool {
+	return member != nil &&
+		member.ID != currentLeader.ID &&
+		member.Name != "" &&
+		!member.IsLearner &&
+		len(member.Alarms) == 0
+}
+
 // EtcdMemberStatus contains status information for a single etcd member.
 type EtcdMemberStatus struct {
 	Name       string
@@ -226,13 +373,60 @@ type EtcdMemberStatus struct {
 //
 // NOTE: This methods uses control plane machines/nodes only to get in contact with etcd,
 // but then it relies on etcd as ultimate source of truth for the list of members.
-// This is intended to allow informed decisions on actions impacting etcd quorum.
+// This is intended to allow informed decisions on actions impacting etcd quorum. The members are listed again on
+// transient etcd errors.
 func (w *Workload) EtcdMembers(ctx context.Context) ([]string, error) {
+	var names []string
+
+	err := w.retryEtcdOperation(ctx, "listing etcd members", func() error {
+		var err error
+
+		names, err = w.etcdMembers(ctx)
+
+		return err
+	})
+
+	return names, err
+}
+
+func (w *Workload) etcdMembers(ctx context.Context) ([]string, error) {
 	// Return early for clusters without an etcd certificate secret
 	if w.etcdClientGenerator == nil {
 		return []string{}, nil
 	}
 
+	nodeNames, err := w.etcdNodeNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	names := []string{}
+	for _, member := range members {
+		// Convert etcd member to node name
+		names = append(names, etcdutil.NodeNameFromMember(member))
+	}
+
+	return names, nil
+}
+
+// etcdNodeNames returns the names of the control plane nodes used to get in contact with etcd.
+// External etcd members are reached through their endpoints rather than through control plane nodes.
+func (w *Workload) etcdNodeNames(ctx context.Context) ([]string, error) {
+	if w.externalEtcd != nil {
+		return nil, nil
+	}
+
 	nodes, err := w.getControlPlaneNodes(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to list control plane nodes")
@@ -243,6 +437,38 @@ func (w *Workload) EtcdMembers(ctx context.Context) ([]string, error) {
 		nodeNames = append(nodeNames, node.Name)
 	}
 
+	return nodeNames, nil
+}
+
+// EtcdLearnerStatus describes the progress of an etcd member towards becoming a voting member.
+type EtcdLearnerStatus struct {
+	// Name is the name of the etcd member, empty if the member has not started yet.
+	Name string
+
+	// ID is the ID of the etcd member.
+	ID uint64
+
+	// RaftIndexLag is the number of raft entries the learner is behind the leader. It is always 0 for promoted members.
+	RaftIndexLag uint64
+
+	// IsPromoted is true once the member is a voting member.
+	IsPromoted bool
+}
+
+// EtcdLearnerStatus returns the promotion status of the etcd members, along with the raft index lag of the learners
+// relative to the leader. Voting members are reported as promoted. Learners which have not started yet are reported
+// with the whole leader raft index as lag.
+func (w *Workload) EtcdLearnerStatus(ctx context.Context) ([]EtcdLearnerStatus, error) {
+	// Return early for clusters without an etcd certificate secret
+	if w.etcdClientGenerator == nil {
+		return nil, nil
+	}
+
+	nodeNames, err := w.etcdNodeNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create etcd client")
@@ -254,11 +480,584 @@ func (w *Workload) EtcdMembers(ctx context.Context) ([]string, error) {
 		return nil, errors.Wrap(err, "failed to list etcd members using etcd client")
 	}
 
-	names := []string{}
+	leaderIndex, err := etcdClient.RaftIndex(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the raft index of the etcd leader")
+	}
+
+	statuses := make([]EtcdLearnerStatus, 0, len(members))
+
 	for _, member := range members {
-		// Convert etcd member to node name
-		names = append(names, etcdutil.NodeNameFromMember(member))
+		status := EtcdLearnerStatus{Name: member.Name, ID: member.ID, IsPromoted: !member.IsLearner}
+
+		if member.IsLearner {
+			lag, err := w.etcdLearnerLag(ctx, member, leaderIndex)
+			if err != nil {
+				return nil, err
+			}
+
+			status.RaftIndexLag = lag
+		}
+
+		statuses = append(statuses, status)
 	}
 
-	return names, nil
+	return statuses, nil
+}
+
+// etcdLearnerLag returns the number of raft entries the learner is behind the leader raft index.
+func (w *Workload) etcdLearnerLag(ctx context.Context, learner *etcd.Member, leaderIndex uint64) (uint64, error) {
+	if learner.Name == "" {
+		// The learner has not started yet.
+		return leaderIndex, nil
+	}
+
+	learnerClient, err := w.etcdMemberClient(ctx, learner)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to connect to etcd learner %s", learner.Name)
+	}
+	defer learnerClient.Close()
+
+	learnerIndex, err := learnerClient.RaftIndex(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if learnerIndex >= leaderIndex {
+		return 0, nil
+	}
+
+	return leaderIndex - learnerIndex, nil
+}
+
+// ClearEtcdAlarmsOptions selects the etcd alarms disarmed by ClearEtcdAlarms.
+type ClearEtcdAlarmsOptions struct {
+	// AlarmTypes are the types of the alarms to disarm, NOSPACE alone when empty. A CORRUPT alarm is only disarmed
+	// when listed, as it reports a data corruption which must be resolved first.
+	AlarmTypes []etcd.AlarmType
+	// QuotaBackendBytes is the etcd quota the database of a member must be below for its NOSPACE alarm to be
+	// disarmed, zero standing for the default etcd quota.
+	QuotaBackendBytes int64
+	// Force disarms NOSPACE alarms even when the database of the member is not below the quota.
+	Force bool
+}
+
+// ClearEtcdAlarms disarms the active alarms of the etcd cluster of the types selected by the options and returns the
+// alarms which were cleared. A NOSPACE alarm is only cleared when the database of the member is back below the quota,
+// e.g. after compaction and defragmentation, as etcd would raise it again right away, unless forced. The call is
+// rejected with ErrEtcdMaintenanceRateLimited when the etcd maintenance operations of the cluster are throttled.
+func (w *Workload) ClearEtcdAlarms(ctx context.Context, opts ClearEtcdAlarmsOptions) ([]etcd.MemberAlarm, error) {
+	// Return early for clusters without an etcd certificate secret
+	if w.etcdClientGenerator == nil {
+		return nil, nil
+	}
+
+	if err := w.allowEtcdMaintenance("clearing etcd alarms"); err != nil {
+		return nil, err
+	}
+
+	alarmTypes := opts.AlarmTypes
+	if len(alarmTypes) == 0 {
+		alarmTypes = []etcd.AlarmType{etcd.AlarmNoSpace}
+	}
+
+	quotaBackendBytes := opts.QuotaBackendBytes
+	if quotaBackendBytes <= 0 {
+		quotaBackendBytes = etcd.DefaultQuotaBackendBytes
+	}
+
+	nodeNames, err := w.etcdNodeNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	alarms, err := etcdClient.Alarms(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cleared := []etcd.MemberAlarm{}
+	errs := []error{}
+
+	for _, alarm := range alarms {
+		if !slices.Contains(alarmTypes, alarm.Type) {
+			log.FromContext(ctx).Info("Keeping etcd alarm", "alarm", etcd.AlarmTypeName[alarm.Type], "memberID", alarm.MemberID)
+
+			continue
+		}
+
+		if alarm.Type == etcd.AlarmNoSpace && !opts.Force {
+			if err := w.checkEtcdMemberBelowQuota(ctx, members, alarm.MemberID, quotaBackendBytes); err != nil {
+				errs = append(errs, err)
+
+				continue
+			}
+		}
+
+		if err := etcdClient.DisarmAlarm(ctx, alarm); err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		log.FromContext(ctx).Info("Cleared etcd alarm", "alarm", etcd.AlarmTypeName[alarm.Type], "memberID", alarm.MemberID)
+
+		cleared = append(cleared, alarm)
+	}
+
+	return cleared, kerrors.NewAggregate(errs)
+}
+
+// checkEtcdMemberBelowQuota returns an error if the database of the member is not below the quota.
+func (w *Workload) checkEtcdMemberBelowQuota(
+	ctx context.Context,
+	members []*etcd.Member,
+	memberID uint64,
+	quotaBackendBytes int64,
+) error {
+	var member *etcd.Member
+
+	for _, m := range members {
+		if m.ID == memberID {
+			member = m
+
+			break
+		}
+	}
+
+	if member == nil {
+		return errors.Errorf("failed to find etcd member %v", memberID)
+	}
+
+	memberClient, err := w.etcdMemberClient(ctx, member)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to etcd member %s", member.Name)
+	}
+	defer memberClient.Close()
+
+	size, err := memberClient.DBSize(ctx)
+	if err != nil {
+		return err
+	}
+
+	if size >= quotaBackendBytes {
+		return errors.Wrapf(ErrEtcdOverQuota, "database of etcd member %s is %d bytes, the quota is %d bytes",
+			member.Name, size, quotaBackendBytes)
+	}
+
+	return nil
+}
+
+// EtcdDBQuotaWarningPercent is the share of the etcd quota, in percent, above which the database of a member should
+// be compacted and defragmented before etcd raises a NOSPACE alarm.
+const EtcdDBQuotaWarningPercent = 80
+
+// EtcdMemberDBStatus describes the size of the database of an etcd member relative to the etcd quota.
+type EtcdMemberDBStatus struct {
+	// Name is the name of the etcd member.
+	Name string
+
+	// ID is the ID of the etcd member.
+	ID uint64
+
+	// DBSize is the physically allocated size of the database in bytes.
+	DBSize int64
+
+	// DBSizeInUse is the logically used size of the database in bytes.
+	DBSizeInUse int64
+
+	// Quota is the configured etcd quota in bytes.
+	Quota int64
+
+	// PercentFull is the share of the quota used by the database, in percent.
+	PercentFull int64
+}
+
+// EtcdQuotaBackendBytes returns the etcd quota configured for the RKE2ControlPlane with the quota-backend-bytes etcd
+// argument, or the default etcd quota if it is not set or invalid.
+func EtcdQuotaBackendBytes(rcp *controlplanev1.RKE2ControlPlane) int64 {
+	quota := etcd.DefaultQuotaBackendBytes
+
+	customConfig := rcp.Spec.ServerConfig.Etcd.CustomConfig
+	if customConfig == nil {
+		return quota
+	}
+
+	for _, arg := range customConfig.ExtraArgs {
+		value, found := strings.CutPrefix(arg, "quota-backend-bytes=")
+		if !found {
+			continue
+		}
+
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil && parsed > 0 {
+			quota = parsed
+		}
+	}
+
+	return quota
+}
+
+// EtcdDBStatus returns the database size of the started etcd members along with how full it is relative to the given
+// quota, as the etcd status API does not report the configured quota. A zero quota stands for the default etcd quota.
+// Members which can't be reached are left out and reported in the returned error. The call is rejected with
+// ErrEtcdMaintenanceRateLimited when the etcd maintenance operations of the cluster are throttled.
+func (w *Workload) EtcdDBStatus(ctx context.Context, quotaBackendBytes int64) ([]EtcdMemberDBStatus, error) {
+	// Return early for clusters without an etcd certificate secret
+	if w.etcdClientGenerator == nil {
+		return nil, nil
+	}
+
+	if err := w.allowEtcdMaintenance("reading etcd database status"); err != nil {
+		return nil, err
+	}
+
+	if quotaBackendBytes <= 0 {
+		quotaBackendBytes = etcd.DefaultQuotaBackendBytes
+	}
+
+	nodeNames, err := w.etcdNodeNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	statuses := make([]EtcdMemberDBStatus, 0, len(members))
+	errs := []error{}
+
+	for _, member := range members {
+		if member.Name == "" {
+			// The member has not started yet.
+			continue
+		}
+
+		status, err := w.etcdMemberDBStatus(ctx, member)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to get the database size of etcd member %s", member.Name))
+
+			continue
+		}
+
+		statuses = append(statuses, EtcdMemberDBStatus{
+			Name:        member.Name,
+			ID:          member.ID,
+			DBSize:      status.Size,
+			DBSizeInUse: status.SizeInUse,
+			Quota:       quotaBackendBytes,
+			PercentFull: status.Size * 100 / quotaBackendBytes, //nolint:mnd
+		})
+	}
+
+	return statuses, kerrors.NewAggregate(errs)
+}
+
+// CompactEtcd compacts the etcd key space history, keeping the last keepRevisions revisions, and returns the revision
+// the history was compacted at. Compacting frees the space of the superseded key versions within the database, which
+// a defragmentation then returns to the filesystem, so it is expected to run before defragmenting the members. The
+// compaction revision never exceeds the current revision, and 0 is returned without compacting when there are no
+// more than keepRevisions revisions, or when the history is already compacted at the compaction revision.
+func (w *Workload) CompactEtcd(ctx context.Context, keepRevisions int64) (int64, error) {
+	if keepRevisions < 0 {
+		return 0, errors.Errorf("invalid number of etcd revisions to keep: %d", keepRevisions)
+	}
+
+	// Return early for clusters without an etcd certificate secret
+	if w.etcdClientGenerator == nil {
+		return 0, nil
+	}
+
+	if err := w.allowEtcdMaintenance("compacting etcd"); err != nil {
+		return 0, err
+	}
+
+	nodeNames, err := w.etcdNodeNames(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	currentRevision, err := etcdClient.Revision(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	revision := currentRevision - keepRevisions
+	if revision <= 0 {
+		return 0, nil
+	}
+
+	if err := etcdClient.Compact(ctx, revision); err != nil {
+		if errors.Is(err, etcd.ErrCompacted) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	log.FromContext(ctx).Info("Compacted etcd history", "revision", revision, "currentRevision", currentRevision)
+
+	return revision, nil
+}
+
+// DefragmentEtcd defragments, one at a time, the databases of the started etcd members which exceed
+// EtcdDBQuotaWarningPercent of the given quota, and returns the names of the defragmented members. A zero quota stands
+// for the default etcd quota. A member can't serve requests while its database is defragmented, so the members are
+// expected to be compacted beforehand and defragmented only when needed. Members which can't be defragmented are
+// reported in the returned error. The call is rejected with ErrEtcdMaintenanceRateLimited when the etcd maintenance
+// operations of the cluster are throttled.
+func (w *Workload) DefragmentEtcd(ctx context.Context, quotaBackendBytes int64) ([]string, error) {
+	// Return early for clusters without an etcd certificate secret
+	if w.etcdClientGenerator == nil {
+		return nil, nil
+	}
+
+	if err := w.allowEtcdMaintenance("defragmenting etcd"); err != nil {
+		return nil, err
+	}
+
+	if quotaBackendBytes <= 0 {
+		quotaBackendBytes = etcd.DefaultQuotaBackendBytes
+	}
+
+	nodeNames, err := w.etcdNodeNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	defragmented := []string{}
+	errs := []error{}
+
+	for _, member := range members {
+		if member.Name == "" {
+			// The member has not started yet.
+			continue
+		}
+
+		done, err := w.defragmentEtcdMember(ctx, member, quotaBackendBytes)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to defragment etcd member %s", member.Name))
+
+			continue
+		}
+
+		if done {
+			defragmented = append(defragmented, member.Name)
+		}
+	}
+
+	return defragmented, kerrors.NewAggregate(errs)
+}
+
+// defragmentEtcdMember defragments the database of the member if it exceeds EtcdDBQuotaWarningPercent of the quota,
+// and returns whether it was defragmented.
+func (w *Workload) defragmentEtcdMember(ctx context.Context, member *etcd.Member, quotaBackendBytes int64) (bool, error) {
+	memberClient, err := w.etcdMemberClient(ctx, member)
+	if err != nil {
+		return false, err
+	}
+	defer memberClient.Close()
+
+	status, err := memberClient.DBStatus(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if status.Size*100/quotaBackendBytes <= EtcdDBQuotaWarningPercent { //nolint:mnd
+		return false, nil
+	}
+
+	if err := memberClient.Defragment(ctx); err != nil {
+		return false, err
+	}
+
+	log.FromContext(ctx).Info("Defragmented etcd member", "member", member.Name, "dbSize", status.Size,
+		"dbSizeInUse", status.SizeInUse)
+
+	return true, nil
+}
+
+func (w *Workload) etcdMemberDBStatus(ctx context.Context, member *etcd.Member) (*etcd.DBStatus, error) {
+	memberClient, err := w.etcdMemberClient(ctx, member)
+	if err != nil {
+		return nil, err
+	}
+	defer memberClient.Close()
+
+	return memberClient.DBStatus(ctx)
+}
+
+// UpdateEtcdMembersStatus refreshes the etcd members reported in the RKE2ControlPlane status.
+// Members which can't be reached keep their last known details and are flagged as stale.
+func (w *Workload) UpdateEtcdMembersStatus(ctx context.Context, controlPlane *ControlPlane) {
+	// Return early for clusters without an etcd certificate secret
+	if w.etcdClientGenerator == nil {
+		return
+	}
+
+	logger := log.FromContext(ctx)
+
+	var previous map[string]controlplanev1.EtcdMemberStatus
+	if controlPlane.RCP.Status.Etcd != nil {
+		previous = controlPlane.RCP.Status.Etcd.Members
+	}
+
+	nodeNames := sets.List(sets.KeySet(w.Nodes))
+	if len(nodeNames) == 0 && w.externalEtcd == nil {
+		return
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
+	if err != nil {
+		logger.V(4).Info("Unable to connect to the etcd leader, reporting etcd members as stale", "err", err.Error())
+		controlPlane.RCP.Status.Etcd = staleEtcdStatus(previous)
+
+		return
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		logger.V(4).Info("Unable to list etcd members, reporting etcd members as stale", "err", err.Error())
+		controlPlane.RCP.Status.Etcd = staleEtcdStatus(previous)
+
+		return
+	}
+
+	unreachable := sets.New[string]()
+
+	for _, member := range members {
+		if member.Name == "" {
+			// The member has not started yet.
+			unreachable.Insert(etcdMemberStatusKey(member))
+
+			continue
+		}
+
+		memberClient, err := w.etcdMemberClient(ctx, member)
+		if err != nil {
+			unreachable.Insert(etcdMemberStatusKey(member))
+
+			continue
+		}
+
+		_ = memberClient.Close()
+	}
+
+	controlPlane.RCP.Status.Etcd = &controlplanev1.EtcdStatus{
+		Members: etcdMembersStatus(previous, members, etcdClient.LeaderID, unreachable),
+	}
+}
+
+// etcdMemberClient returns a client connected to the given member, through its node for the embedded etcd or
+// through its client URLs for an external etcd.
+func (w *Workload) etcdMemberClient(ctx context.Context, member *etcd.Member) (*etcd.Client, error) {
+	if w.externalEtcd != nil {
+		return w.externalEtcd.ForFirstAvailableEndpoint(ctx, member.ClientURLs)
+	}
+
+	return w.etcdClientGenerator.ForFirstAvailableNode(ctx, []string{etcdutil.NodeNameFromMember(member)})
+}
+
+// etcdMembersStatus maps etcd members to their status, keyed by member name. Unreachable members keep the details
+// reported in previous, if any, and are flagged as stale. Members that are no longer part of etcd are dropped.
+func etcdMembersStatus(
+	previous map[string]controlplanev1.EtcdMemberStatus,
+	members []*etcd.Member,
+	leaderID uint64,
+	unreachable sets.Set[string],
+) map[string]controlplanev1.EtcdMemberStatus {
+	statuses := make(map[string]controlplanev1.EtcdMemberStatus, len(members))
+
+	for _, member := range members {
+		key := etcdMemberStatusKey(member)
+		stale := unreachable.Has(key)
+
+		if last, found := previous[key]; found && stale {
+			last.Stale = true
+			statuses[key] = last
+
+			continue
+		}
+
+		status := controlplanev1.EtcdMemberStatus{
+			ID:        fmt.Sprintf("%x", member.ID),
+			IsLearner: member.IsLearner,
+			IsLeader:  member.ID == leaderID,
+			Stale:     stale,
+		}
+
+		if len(member.PeerURLs) > 0 {
+			status.PeerURL = member.PeerURLs[0]
+		}
+
+		if len(member.ClientURLs) > 0 {
+			status.ClientURL = member.ClientURLs[0]
+		}
+
+		statuses[key] = status
+	}
+
+	return statuses
+}
+
+// staleEtcdStatus returns the previously reported etcd members, all flagged as stale.
+func staleEtcdStatus(previous map[string]controlplanev1.EtcdMemberStatus) *controlplanev1.EtcdStatus {
+	if len(previous) == 0 {
+		return nil
+	}
+
+	statuses := make(map[string]controlplanev1.EtcdMemberStatus, len(previous))
+
+	for key, status := range previous {
+		status.Stale = true
+		statuses[key] = status
+	}
+
+	return &controlplanev1.EtcdStatus{Members: statuses}
+}
+
+// etcdMemberStatusKey returns the key of the member in the status map, members which have not started yet
+// have no name and are reported by ID.
+func etcdMemberStatusKey(member *etcd.Member) string {
+	if member.Name == "" {
+		return fmt.Sprintf("%x", member.ID)
+	}
+
+	return member.Name
 }
@@ -0,0 +1,180 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+)
+
+var etcdLeaderChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "caprke2_etcd_leader_changes_total",
+	Help: "Total number of etcd leader changes observed in workload clusters.",
+}, []string{
+	"cluster",
+})
+
+func init() {
+	metrics.Registry.MustRegister(etcdLeaderChanges)
+}
+
+// EtcdMemberLeaderChanges is the number of etcd leader changes seen by an etcd member.
+type EtcdMemberLeaderChanges struct {
+	// Name is the name of the etcd member, empty if the member has not started yet.
+	Name string
+
+	// ID is the ID of the etcd member.
+	ID uint64
+
+	// LeaderChanges is the number of leader changes seen by the member, 0 if it is unknown.
+	LeaderChanges uint64
+}
+
+// EtcdLeaderChanges is the number of leader changes of an etcd cluster.
+type EtcdLeaderChanges struct {
+	// Total is the number of leader changes of the etcd cluster, the highest number seen by its members.
+	Total uint64
+
+	// Members are the leader changes seen by each etcd member.
+	Members []EtcdMemberLeaderChanges
+}
+
+// EtcdLeaderChanges returns the number of leader changes seen by each etcd member, and by the etcd cluster as a whole.
+// The etcd status API does not expose the leader changes counter of the member metrics, so the raft term of each
+// member is reported instead: it is incremented by every election, including those which fail to elect a leader,
+// which are as much a sign of etcd instability. Members which have not started yet or can't be reached are returned
+// without leader changes, the latter are also reported in the returned error.
+func (w *Workload) EtcdLeaderChanges(ctx context.Context) (*EtcdLeaderChanges, error) {
+	// Return early for clusters without an etcd certificate secret
+	if w.etcdClientGenerator == nil {
+		return nil, nil
+	}
+
+	nodeNames, err := w.etcdNodeNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	changes := &EtcdLeaderChanges{Members: make([]EtcdMemberLeaderChanges, 0, len(members))}
+	errs := []error{}
+
+	for _, member := range members {
+		memberChanges := EtcdMemberLeaderChanges{Name: member.Name, ID: member.ID}
+
+		if member.Name != "" {
+			memberChanges.LeaderChanges, err = w.etcdMemberRaftTerm(ctx, member)
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "failed to get the leader changes of etcd member %s", member.Name))
+			}
+		}
+
+		changes.Total = max(changes.Total, memberChanges.LeaderChanges)
+		changes.Members = append(changes.Members, memberChanges)
+	}
+
+	return changes, kerrors.NewAggregate(errs)
+}
+
+func (w *Workload) etcdMemberRaftTerm(ctx context.Context, member *etcd.Member) (uint64, error) {
+	memberClient, err := w.etcdMemberClient(ctx, member)
+	if err != nil {
+		return 0, err
+	}
+	defer memberClient.Close()
+
+	return memberClient.RaftTerm(ctx)
+}
+
+// etcdLeaderChangesTracker records the etcd leader changes of workload clusters between reconciles. The zero value is
+// ready to use.
+type etcdLeaderChangesTracker struct {
+	lock sync.Mutex
+	last map[ctrlclient.ObjectKey]uint64
+}
+
+var observedEtcdLeaderChanges = &etcdLeaderChangesTracker{}
+
+// observe records the leader changes of the etcd cluster of the workload cluster, and returns the number of leader
+// changes since the previous observation.
+func (t *etcdLeaderChangesTracker) observe(clusterKey ctrlclient.ObjectKey, changes *EtcdLeaderChanges) uint64 {
+	if changes == nil || changes.Total == 0 {
+		return 0
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.last == nil {
+		t.last = map[ctrlclient.ObjectKey]uint64{}
+	}
+
+	last, seen := t.last[clusterKey]
+	t.last[clusterKey] = changes.Total
+
+	if !seen || changes.Total < last {
+		return 0
+	}
+
+	return changes.Total - last
+}
+
+// forget drops the leader changes recorded for the workload cluster.
+func (t *etcdLeaderChangesTracker) forget(clusterKey ctrlclient.ObjectKey) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.last, clusterKey)
+}
+
+// ObserveEtcdLeaderChanges records the leader changes of the etcd cluster of the workload cluster, counts the leader
+// changes since the previous observation in the caprke2_etcd_leader_changes_total metric, and returns them. The first
+// observation of a cluster, and an observation with fewer leader changes than the previous one, e.g. after the etcd
+// cluster was restored from a snapshot, return 0.
+func ObserveEtcdLeaderChanges(clusterKey ctrlclient.ObjectKey, changes *EtcdLeaderChanges) uint64 {
+	delta := observedEtcdLeaderChanges.observe(clusterKey, changes)
+	if delta > 0 {
+		etcdLeaderChanges.WithLabelValues(clusterKey.String()).Add(float64(delta))
+	}
+
+	return delta
+}
+
+// ForgetEtcdLeaderChanges drops the leader changes recorded for the cluster and its metric, e.g. once its control plane
+// is deleted.
+func ForgetEtcdLeaderChanges(clusterKey ctrlclient.ObjectKey) {
+	observedEtcdLeaderChanges.forget(clusterKey)
+	etcdLeaderChanges.DeleteLabelValues(clusterKey.String())
+}
@@ -0,0 +1,100 @@
+package rke2
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	corev1 "k8s.io/api/core/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	etcdfake "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/fake"
+)
+
+func TestEtcdLeaderChanges(t *testing.T) {
+	g := NewWithT(t)
+
+	memberTerms := map[string]uint64{
+		"node-1": 5,
+		"node-2": 5,
+		// This member did not see the last election yet.
+		"node-3": 4,
+	}
+
+	w := &Workload{
+		Client: &fakeClient{list: &corev1.NodeList{
+			Items: []corev1.Node{nodeNamed("node-1"), nodeNamed("node-2"), nodeNamed("node-3")},
+		}},
+		etcdClientGenerator: &fakeEtcdClientGenerator{
+			forLeaderClient: &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{
+				MemberListResponse: &clientv3.MemberListResponse{
+					Members: []*pb.Member{
+						{Name: "node-1-1a2b3c4d", ID: uint64(1)},
+						{Name: "node-2-1a2b3c4d", ID: uint64(2)},
+						{Name: "node-3-1a2b3c4d", ID: uint64(3)},
+						// This member is still joining the cluster.
+						{ID: uint64(4), IsLearner: true},
+					},
+				},
+				AlarmResponse: &clientv3.AlarmResponse{},
+			}},
+			forNodesClientFunc: func(nodeNames []string) (*etcd.Client, error) {
+				return &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{
+					StatusResponse: &clientv3.StatusResponse{RaftTerm: memberTerms[nodeNames[0]]},
+				}}, nil
+			},
+		},
+	}
+
+	clusterKey := ctrlclient.ObjectKey{Namespace: "default", Name: "leader-changes"}
+	defer ForgetEtcdLeaderChanges(clusterKey)
+
+	changes, err := w.EtcdLeaderChanges(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(changes).To(Equal(&EtcdLeaderChanges{
+		Total: 5,
+		Members: []EtcdMemberLeaderChanges{
+			{Name: "node-1-1a2b3c4d", ID: 1, LeaderChanges: 5},
+			{Name: "node-2-1a2b3c4d", ID: 2, LeaderChanges: 5},
+			{Name: "node-3-1a2b3c4d", ID: 3, LeaderChanges: 4},
+			{ID: 4},
+		},
+	}))
+
+	// The leader changes before the first observation are not reported.
+	g.Expect(ObserveEtcdLeaderChanges(clusterKey, changes)).To(BeZero())
+
+	t.Run("reports the leader changes since the previous reconcile", func(t *testing.T) {
+		g := NewWithT(t)
+
+		memberTerms["node-1"], memberTerms["node-2"], memberTerms["node-3"] = 8, 7, 8
+
+		changes, err := w.EtcdLeaderChanges(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(changes.Total).To(Equal(uint64(8)))
+		g.Expect(ObserveEtcdLeaderChanges(clusterKey, changes)).To(Equal(uint64(3)))
+
+		// The leader did not change since.
+		g.Expect(ObserveEtcdLeaderChanges(clusterKey, changes)).To(BeZero())
+	})
+
+	t.Run("starts over when the leader changes are reset", func(t *testing.T) {
+		g := NewWithT(t)
+
+		// The etcd cluster was restored from a snapshot.
+		memberTerms["node-1"], memberTerms["node-2"], memberTerms["node-3"] = 2, 2, 2
+
+		changes, err := w.EtcdLeaderChanges(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ObserveEtcdLeaderChanges(clusterKey, changes)).To(BeZero())
+
+		memberTerms["node-1"] = 3
+
+		changes, err = w.EtcdLeaderChanges(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ObserveEtcdLeaderChanges(clusterKey, changes)).To(Equal(uint64(1)))
+	})
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/cluster-api/util/collections"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DefaultEtcdLearnerPromotionTimeout is the default duration after which an etcd learner which is not promoted to a
+// voting member yet is considered as failing. Learners are not evacuated by default.
+const DefaultEtcdLearnerPromotionTimeout time.Duration = 0
+
+// etcdLearnersTracker records when the etcd learners of workload clusters were first seen. The zero value is ready to
+// use.
+type etcdLearnersTracker struct {
+	lock      sync.Mutex
+	firstSeen map[ctrlclient.ObjectKey]map[uint64]time.Time
+}
+
+var observedEtcdLearners = &etcdLearnersTracker{}
+
+// observe records the current etcd learners of the workload cluster, forgetting the members which are no longer
+// learners, and returns when each of them was first seen.
+func (t *etcdLearnersTracker) observe(clusterKey ctrlclient.ObjectKey, learnerIDs []uint64) map[uint64]time.Time {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.firstSeen == nil {
+		t.firstSeen = map[ctrlclient.ObjectKey]map[uint64]time.Time{}
+	}
+
+	previous := t.firstSeen[clusterKey]
+	current := make(map[uint64]time.Time, len(learnerIDs))
+
+	for _, id := range learnerIDs {
+		firstSeen, ok := previous[id]
+		if !ok {
+			firstSeen = time.Now()
+		}
+
+		current[id] = firstSeen
+	}
+
+	t.firstSeen[clusterKey] = current
+
+	return current
+}
+
+// forget drops the etcd learners recorded for the workload cluster.
+func (t *etcdLearnersTracker) forget(clusterKey ctrlclient.ObjectKey) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.firstSeen, clusterKey)
+}
+
+// ForgetEtcdLearners drops the etcd learners recorded for the cluster, e.g. once its control plane is deleted.
+func ForgetEtcdLearners(clusterKey ctrlclient.ObjectKey) {
+	observedEtcdLearners.forget(clusterKey)
+}
+
+// EvacuateEtcdLearnerOnFailure removes from the etcd cluster the learners which are still not promoted to voting
+// members after the promotion timeout, so a new server which never catches up with the leader does not block the
+// scale up of the control plane, and returns the names of the machines whose learner was removed so they can be
+// remediated. The time spent by a learner is measured from the first reconcile it was seen as a learner in, and only
+// learners matching a node of one of the given machines are removed; learners which have not started yet are left to
+// join the cluster.
+// Removing a learner is always safe, as learners are not voting members and don't count towards the etcd quorum.
+// Nothing is removed if the timeout is not positive.
+func (w *Workload) EvacuateEtcdLearnerOnFailure(
+	ctx context.Context,
+	machines collections.Machines,
+	timeout time.Duration,
+) ([]string, error) {
+	if w.externalEtcd != nil {
+		return nil, errors.Wrap(ErrNotSupportedWithExternalEtcd, "etcd members are not bound to nodes")
+	}
+
+	// Return early for clusters without an etcd certificate secret
+	if w.etcdClientGenerator == nil || timeout <= 0 {
+		return nil, nil
+	}
+
+	nodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list control plane nodes")
+	}
+
+	nodeNames := make([]string, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		nodeNames = append(nodeNames, node.Name)
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	learnerIDs := []uint64{}
+
+	for _, member := range members {
+		if member.IsLearner {
+			learnerIDs = append(learnerIDs, member.ID)
+		}
+	}
+
+	learnersFirstSeen := observedEtcdLearners.observe(w.clusterKey, learnerIDs)
+	evacuated := []string{}
+
+	for _, member := range members {
+		if !member.IsLearner || member.Name == "" {
+			continue
+		}
+
+		for i := range nodes.Items {
+			node := &nodes.Items[i]
+			if !etcdMemberMatchesNode(member, node) {
+				continue
+			}
+
+			machineName := machineNameForNode(machines, node)
+			if machineName == "" || time.Since(learnersFirstSeen[member.ID]) <= timeout {
+				break
+			}
+
+			if err := etcdClient.RemoveMember(ctx, member.ID); err != nil {
+				return evacuated, errors.Wrapf(err, "failed to remove etcd learner %s", member.Name)
+			}
+
+			log.FromContext(ctx).Info("Removed etcd learner not promoted within the promotion timeout",
+				"member", member.Name, "machine", machineName, "timeout", timeout)
+
+			evacuated = append(evacuated, machineName)
+
+			break
+		}
+	}
+
+	return evacuated, nil
+}
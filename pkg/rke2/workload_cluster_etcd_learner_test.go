@@ -0,0 +1,142 @@
+package rke2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	etcdfake "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/fake"
+)
+
+func TestEvacuateEtcdLearnerOnFailure(t *testing.T) {
+	machineForNode := func(nodeName string) *clusterv1.Machine {
+		return &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine-" + nodeName},
+			Status:     clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: nodeName}},
+		}
+	}
+	machines := collections.FromMachines(machineForNode("node-1"), machineForNode("node-2"))
+	clusterKey := ctrlclient.ObjectKey{Namespace: "default", Name: "learners"}
+
+	// The learner of node-2 never catches up with the leader, so it is never promoted.
+	learnerNeverCatchingUp := func() *etcdfake.FakeEtcdClient {
+		return &etcdfake.FakeEtcdClient{
+			MemberListResponse: &clientv3.MemberListResponse{
+				Members: []*pb.Member{
+					{Name: "node-1-a1b2c3", ID: uint64(1)},
+					{Name: "node-2-d4e5f6", ID: uint64(2), IsLearner: true},
+					{ID: uint64(3), IsLearner: true},
+				},
+			},
+			AlarmResponse:  &clientv3.AlarmResponse{},
+			StatusResponse: &clientv3.StatusResponse{RaftIndex: 100},
+		}
+	}
+	workload := func(etcdClient *etcdfake.FakeEtcdClient) *Workload {
+		return &Workload{
+			Client: &fakeClient{list: &corev1.NodeList{
+				Items: []corev1.Node{nodeNamed("node-1"), nodeNamed("node-2")},
+			}},
+			etcdClientGenerator: &fakeEtcdClientGenerator{
+				forLeaderClient: &etcd.Client{EtcdClient: etcdClient},
+			},
+			clusterKey: clusterKey,
+		}
+	}
+	// learnerSeenAgo records the learner of node-2 as first seen the given duration ago.
+	learnerSeenAgo := func(age time.Duration) {
+		ForgetEtcdLearners(clusterKey)
+		observedEtcdLearners.observe(clusterKey, []uint64{2})
+		observedEtcdLearners.firstSeen[clusterKey][2] = time.Now().Add(-age)
+	}
+
+	defer ForgetEtcdLearners(clusterKey)
+
+	t.Run("removes a learner not promoted within the timeout", func(t *testing.T) {
+		g := NewWithT(t)
+
+		etcdClient := learnerNeverCatchingUp()
+		learnerSeenAgo(time.Hour)
+
+		evacuated, err := workload(etcdClient).EvacuateEtcdLearnerOnFailure(context.Background(), machines, 30*time.Minute)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(evacuated).To(Equal([]string{"machine-node-2"}))
+		g.Expect(etcdClient.RemovedMember).To(Equal(uint64(2)))
+	})
+
+	t.Run("keeps a learner within the timeout", func(t *testing.T) {
+		g := NewWithT(t)
+
+		etcdClient := learnerNeverCatchingUp()
+		learnerSeenAgo(time.Minute)
+
+		evacuated, err := workload(etcdClient).EvacuateEtcdLearnerOnFailure(context.Background(), machines, 30*time.Minute)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(evacuated).To(BeEmpty())
+		g.Expect(etcdClient.RemovedMember).To(BeZero())
+	})
+
+	t.Run("measures the time spent as a learner from when it was first seen", func(t *testing.T) {
+		g := NewWithT(t)
+
+		// The node of the learner was created long ago, e.g. a server rejoining the cluster after a member removal.
+		ForgetEtcdLearners(clusterKey)
+
+		etcdClient := learnerNeverCatchingUp()
+
+		evacuated, err := workload(etcdClient).EvacuateEtcdLearnerOnFailure(context.Background(), machines, 30*time.Minute)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(evacuated).To(BeEmpty())
+		g.Expect(etcdClient.RemovedMember).To(BeZero())
+		g.Expect(observedEtcdLearners.firstSeen[clusterKey]).To(HaveKey(uint64(2)))
+	})
+
+	t.Run("forgets a learner once promoted", func(t *testing.T) {
+		g := NewWithT(t)
+
+		learnerSeenAgo(time.Hour)
+
+		etcdClient := learnerNeverCatchingUp()
+		etcdClient.MemberListResponse.Members[1].IsLearner = false
+
+		evacuated, err := workload(etcdClient).EvacuateEtcdLearnerOnFailure(context.Background(), machines, 30*time.Minute)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(evacuated).To(BeEmpty())
+		g.Expect(observedEtcdLearners.firstSeen[clusterKey]).ToNot(HaveKey(uint64(2)))
+	})
+
+	t.Run("keeps a learner without a machine", func(t *testing.T) {
+		g := NewWithT(t)
+
+		etcdClient := learnerNeverCatchingUp()
+		learnerSeenAgo(time.Hour)
+
+		evacuated, err := workload(etcdClient).EvacuateEtcdLearnerOnFailure(context.Background(),
+			collections.FromMachines(machineForNode("node-1")), 30*time.Minute)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(evacuated).To(BeEmpty())
+		g.Expect(etcdClient.RemovedMember).To(BeZero())
+	})
+
+	t.Run("does nothing without a timeout", func(t *testing.T) {
+		g := NewWithT(t)
+
+		etcdClient := learnerNeverCatchingUp()
+		learnerSeenAgo(time.Hour)
+
+		evacuated, err := workload(etcdClient).EvacuateEtcdLearnerOnFailure(context.Background(), machines, 0)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(evacuated).To(BeEmpty())
+		g.Expect(etcdClient.RemovedMember).To(BeZero())
+	})
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+)
+
+// ControlPlaneNodeEtcdMember joins a control plane node with its machine and its etcd member.
+type ControlPlaneNodeEtcdMember struct {
+	// NodeName is the name of the node, empty if HasNode is false.
+	NodeName string
+
+	// ProviderID is the provider ID of the node, empty if HasNode is false.
+	ProviderID string
+
+	// MachineName is the name of the machine of the node, empty if no machine references the node.
+	MachineName string
+
+	// EtcdMemberName is the name of the etcd member, empty if HasEtcdMember is false or the member has not started yet.
+	EtcdMemberName string
+
+	// EtcdMemberID is the ID of the etcd member, 0 if HasEtcdMember is false.
+	EtcdMemberID uint64
+
+	// IsLearner is true if the etcd member is a learner.
+	IsLearner bool
+
+	// Healthy is true if the node is ready and its etcd member is started, reachable and has no alarm.
+	Healthy bool
+
+	// HasNode is false for an etcd member without control plane node, e.g. left behind by a replaced node.
+	HasNode bool
+
+	// HasEtcdMember is false for a control plane node without etcd member, e.g. a node which has not joined etcd yet.
+	HasEtcdMember bool
+}
+
+// ListControlPlaneNodesWithEtcdMember returns the control plane nodes joined with the given machines and the etcd
+// members, so that decisions depending on all of them don't need several round trips. Nodes and members are joined as
+// in DetectOrphanedEtcdMembers, and machines by node reference or provider ID. Nodes without etcd member and members
+// without node are reported with HasEtcdMember, respectively HasNode, set to false. Members are not listed when the
+// cluster does not provide etcd certificates. Entries are sorted by node name, then by etcd member ID.
+func (w *Workload) ListControlPlaneNodesWithEtcdMember(
+	ctx context.Context,
+	machines collections.Machines,
+) ([]ControlPlaneNodeEtcdMember, error) {
+	if w.externalEtcd != nil {
+		return nil, errors.Wrap(ErrNotSupportedWithExternalEtcd, "etcd members are not bound to nodes")
+	}
+
+	nodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list control plane nodes")
+	}
+
+	members := []*etcd.Member{}
+	reachable := map[uint64]bool{}
+
+	if w.etcdClientGenerator != nil && len(nodes.Items) > 0 {
+		members, reachable, err = w.etcdMembersReachability(ctx, nodes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	joined := make([]ControlPlaneNodeEtcdMember, 0, len(nodes.Items))
+	matched := map[uint64]bool{}
+
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		entry := ControlPlaneNodeEtcdMember{
+			NodeName:    node.Name,
+			ProviderID:  node.Spec.ProviderID,
+			MachineName: machineNameForNode(machines, node),
+			HasNode:     true,
+		}
+
+		for _, member := range members {
+			if !matched[member.ID] && etcdMemberMatchesNode(member, node) {
+				matched[member.ID] = true
+				setEtcdMember(&entry, member)
+				entry.Healthy = util.IsNodeReady(node) && member.Name != "" && reachable[member.ID] && len(member.Alarms) == 0
+
+				break
+			}
+		}
+
+		joined = append(joined, entry)
+	}
+
+	for _, member := range members {
+		if matched[member.ID] {
+			continue
+		}
+
+		entry := ControlPlaneNodeEtcdMember{}
+		setEtcdMember(&entry, member)
+		joined = append(joined, entry)
+	}
+
+	slices.SortStableFunc(joined, func(a, b ControlPlaneNodeEtcdMember) int {
+		return cmp.Or(cmp.Compare(a.NodeName, b.NodeName), cmp.Compare(a.EtcdMemberID, b.EtcdMemberID))
+	})
+
+	return joined, nil
+}
+
+// etcdMembersReachability lists the etcd members through the control plane nodes, along with whether the started
+// members can be connected to.
+func (w *Workload) etcdMembersReachability(ctx context.Context, nodes *corev1.NodeList) ([]*etcd.Member, map[uint64]bool, error) {
+	nodeNames := make([]string, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		nodeNames = append(nodeNames, node.Name)
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	reachable := map[uint64]bool{}
+
+	for _, member := range members {
+		if member.Name == "" {
+			continue
+		}
+
+		memberClient, err := w.etcdMemberClient(ctx, member)
+		if err != nil {
+			continue
+		}
+
+		_ = memberClient.Close()
+		reachable[member.ID] = true
+	}
+
+	return members, reachable, nil
+}
+
+// machineNameForNode returns the name of the machine referencing the node, or with the provider ID of the node.
+func machineNameForNode(machines collections.Machines, node *corev1.Node) string {
+	for _, machine := range machines {
+		if machine.Status.NodeRef != nil && machine.Status.NodeRef.Name == node.Name {
+			return machine.Name
+		}
+
+		if node.Spec.ProviderID != "" && machine.Spec.ProviderID != nil && *machine.Spec.ProviderID == node.Spec.ProviderID {
+			return machine.Name
+		}
+	}
+
+	return ""
+}
+
+func setEtcdMember(entry *ControlPlaneNodeEtcdMember, member *etcd.Member) {
+	entry.HasEtcdMember = true
+	entry.EtcdMemberName = member.Name
+	entry.EtcdMemberID = member.ID
+	entry.IsLearner = member.IsLearner
+}
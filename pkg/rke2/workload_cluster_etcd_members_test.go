@@ -0,0 +1,146 @@
+package rke2
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	etcdfake "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/fake"
+)
+
+func TestListControlPlaneNodesWithEtcdMember(t *testing.T) {
+	machines := collections.FromMachines(
+		&clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine-1"},
+			Status:     clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "node-1"}},
+		},
+		// The node of this machine is not referenced yet.
+		&clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine-2"},
+			Spec:       clusterv1.MachineSpec{ProviderID: ptr.To("aws:///node-2")},
+		},
+	)
+
+	nodes := func() *corev1.NodeList {
+		return &corev1.NodeList{Items: []corev1.Node{
+			*readyNode("node-1", "aws:///node-1", corev1.ConditionTrue),
+			*readyNode("node-2", "aws:///node-2", corev1.ConditionTrue),
+			// This node has not joined etcd yet.
+			*readyNode("node-3", "aws:///node-3", corev1.ConditionFalse),
+		}}
+	}
+
+	t.Run("joins nodes, machines and etcd members", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{
+			Client: &fakeClient{list: nodes()},
+			etcdClientGenerator: &fakeEtcdClientGenerator{
+				forLeaderClient: &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{
+					MemberListResponse: &clientv3.MemberListResponse{
+						Members: []*pb.Member{
+							{Name: "node-1-1a2b3c4d", ID: uint64(1)},
+							{Name: "node-2-1a2b3c4d", ID: uint64(2), IsLearner: true},
+							// The node of this member no longer exists.
+							{Name: "node-4-1a2b3c4d", ID: uint64(4)},
+						},
+					},
+					AlarmResponse: &clientv3.AlarmResponse{},
+				}},
+				forNodesClient: &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{}},
+			},
+		}
+
+		joined, err := w.ListControlPlaneNodesWithEtcdMember(context.Background(), machines)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(joined).To(Equal([]ControlPlaneNodeEtcdMember{
+			{
+				EtcdMemberName: "node-4-1a2b3c4d",
+				EtcdMemberID:   4,
+				HasEtcdMember:  true,
+			},
+			{
+				NodeName:       "node-1",
+				ProviderID:     "aws:///node-1",
+				MachineName:    "machine-1",
+				EtcdMemberName: "node-1-1a2b3c4d",
+				EtcdMemberID:   1,
+				Healthy:        true,
+				HasNode:        true,
+				HasEtcdMember:  true,
+			},
+			{
+				NodeName:       "node-2",
+				ProviderID:     "aws:///node-2",
+				MachineName:    "machine-2",
+				EtcdMemberName: "node-2-1a2b3c4d",
+				EtcdMemberID:   2,
+				IsLearner:      true,
+				Healthy:        true,
+				HasNode:        true,
+				HasEtcdMember:  true,
+			},
+			{
+				NodeName:   "node-3",
+				ProviderID: "aws:///node-3",
+				HasNode:    true,
+			},
+		}))
+	})
+
+	t.Run("reports members which cannot be reached as not healthy", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{
+			Client: &fakeClient{list: nodes()},
+			etcdClientGenerator: &fakeEtcdClientGenerator{
+				forLeaderClient: &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{
+					MemberListResponse: &clientv3.MemberListResponse{
+						Members: []*pb.Member{{Name: "node-1-1a2b3c4d", ID: uint64(1)}},
+					},
+					AlarmResponse: &clientv3.AlarmResponse{},
+				}},
+				forNodesErr: errors.New("no client"),
+			},
+		}
+
+		joined, err := w.ListControlPlaneNodesWithEtcdMember(context.Background(), machines)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(joined).To(HaveLen(3))
+		g.Expect(joined[0].HasEtcdMember).To(BeTrue())
+		g.Expect(joined[0].Healthy).To(BeFalse())
+	})
+
+	t.Run("lists nodes without members for clusters without etcd certificates", func(t *testing.T) {
+		g := NewWithT(t)
+
+		joined, err := (&Workload{Client: &fakeClient{list: nodes()}}).ListControlPlaneNodesWithEtcdMember(
+			context.Background(), machines)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(joined).To(HaveLen(3))
+
+		for _, entry := range joined {
+			g.Expect(entry.HasNode).To(BeTrue())
+			g.Expect(entry.HasEtcdMember).To(BeFalse())
+		}
+	})
+
+	t.Run("is not supported with an external etcd", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := (&Workload{externalEtcd: &etcd.ExternalClientGenerator{}}).ListControlPlaneNodesWithEtcdMember(
+			context.Background(), machines)
+		g.Expect(err).To(MatchError(ErrNotSupportedWithExternalEtcd))
+	})
+}
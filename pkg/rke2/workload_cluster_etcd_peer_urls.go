@@ -0,0 +1,211 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	etcdutil "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/util"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/proxy"
+)
+
+// etcdPeerPort is the port etcd members listen on for peer communication when their peer URL does not tell.
+const etcdPeerPort = "2380"
+
+// etcdPeerProber checks that the etcd member of the node can be connected to on the peer URL.
+type etcdPeerProber func(ctx context.Context, nodeName, peerURL string) error
+
+// ReconcileEtcdPeerURLs updates the peer URLs of the etcd members which no longer point to an address of their control
+// plane node, e.g. after the node IPs changed during a cloud migration, and returns the names of the updated members.
+// The new peer URL keeps the scheme and port of the current one, with the preferred address of the node. It is only
+// committed once the member could be connected to on its port, so a member is never pointed to a port it does not
+// listen on. Members
+// without node, nodes without address and members which have not started yet are left untouched. As updating a member
+// goes through consensus, this recovers clusters whose quorum is still reachable.
+func (w *Workload) ReconcileEtcdPeerURLs(ctx context.Context) ([]string, error) {
+	if w.externalEtcd != nil {
+		return nil, errors.Wrap(ErrNotSupportedWithExternalEtcd, "etcd members are not bound to nodes")
+	}
+
+	// Return early for clusters without an etcd certificate secret
+	if w.etcdClientGenerator == nil {
+		return nil, nil
+	}
+
+	nodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list control plane nodes")
+	}
+
+	nodeNames := make([]string, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		nodeNames = append(nodeNames, node.Name)
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	if w.etcdPeerProber == nil {
+		return nil, errors.New("etcd peer URLs can't be verified without a prober")
+	}
+
+	updated := []string{}
+	errs := []error{}
+
+	for _, member := range members {
+		if member.Name == "" {
+			continue
+		}
+
+		node := etcdMemberNode(member, nodes)
+		if node == nil || len(node.Status.Addresses) == 0 || etcdMemberMatchesNode(member, node) {
+			continue
+		}
+
+		peerURL := etcdPeerURLForNode(member, node, w.preferredIPFamily)
+		if peerURL == "" {
+			continue
+		}
+
+		if err := w.etcdPeerProber(ctx, node.Name, peerURL); err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to connect to peer URL %s of etcd member %s", peerURL, member.Name))
+
+			continue
+		}
+
+		if _, err := etcdClient.UpdateMemberPeerURLs(ctx, member.ID, []string{peerURL}); err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		log.FromContext(ctx).Info("Updated etcd member peer URLs", "member", member.Name,
+			"previousPeerURLs", member.PeerURLs, "peerURL", peerURL)
+
+		updated = append(updated, member.Name)
+	}
+
+	return updated, kerrors.NewAggregate(errs)
+}
+
+// etcdMemberNode returns the node the member name was generated from, regardless of the member peer URLs.
+func etcdMemberNode(member *etcd.Member, nodes *corev1.NodeList) *corev1.Node {
+	nodeName := etcdutil.NodeNameFromMember(member)
+
+	for i := range nodes.Items {
+		if nodes.Items[i].Name == nodeName {
+			return &nodes.Items[i]
+		}
+	}
+
+	return nil
+}
+
+// etcdPeerURLForNode returns the peer URL of the member with the host replaced by the preferred address of the node,
+// or an empty string if the node has no usable address.
+func etcdPeerURLForNode(member *etcd.Member, node *corev1.Node, preferredIPFamily corev1.IPFamily) string {
+	address := nodeAddress(node, preferredIPFamily)
+	if address == "" {
+		return ""
+	}
+
+	peerURL := &url.URL{Scheme: "https"}
+	port := etcdPeerPort
+
+	if len(member.PeerURLs) > 0 {
+		if current, err := url.Parse(member.PeerURLs[0]); err == nil && current.Scheme != "" {
+			peerURL.Scheme = current.Scheme
+
+			if current.Port() != "" {
+				port = current.Port()
+			}
+		}
+	}
+
+	peerURL.Host = net.JoinHostPort(address, port)
+
+	return peerURL.String()
+}
+
+// newEtcdPeerProber returns an etcdPeerProber port-forwarding, through the API server, to the peer port of the etcd pod
+// of the node, which runs on the host network, as the management cluster can't be expected to reach the node addresses.
+// A TLS handshake checks that etcd listens on the port. Its certificate is not verified, and no peer certificate is
+// presented, so an alert of etcd rejecting the handshake is a successful probe too.
+func newEtcdPeerProber(restConfig *rest.Config) etcdPeerProber {
+	return func(ctx context.Context, nodeName, peerURL string) error {
+		u, err := url.Parse(peerURL)
+		if err != nil {
+			return errors.Wrapf(err, "invalid peer URL %s", peerURL)
+		}
+
+		port, err := strconv.Atoi(u.Port())
+		if err != nil {
+			return errors.Wrapf(err, "invalid port of peer URL %s", peerURL)
+		}
+
+		dialer, err := proxy.NewDialer(proxy.Proxy{
+			Kind:       "pods",
+			Namespace:  metav1.NamespaceSystem,
+			KubeConfig: rest.CopyConfig(restConfig),
+			Port:       port,
+		}, proxy.DialTimeout(etcdDialTimeout))
+		if err != nil {
+			return errors.Wrap(err, "failed to create etcd peer dialer")
+		}
+
+		conn, err := dialer.DialContext(ctx, "tcp", staticPodName(EtcdComponent, nodeName))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(ctx, etcdDialTimeout)
+		defer cancel()
+
+		tlsConn := tls.Client(conn, &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: true, //nolint:gosec // Only checks that etcd listens on the port, no data is exchanged.
+		})
+
+		var alert tls.AlertError
+		if err := tlsConn.HandshakeContext(ctx); err != nil && !errors.As(err, &alert) {
+			return errors.Wrapf(err, "etcd does not listen on port %d of node %s", port, nodeName)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,90 @@
+package rke2
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	etcdfake "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/fake"
+)
+
+func TestReconcileEtcdPeerURLs(t *testing.T) {
+	nodeWithAddress := func(name, address string) corev1.Node {
+		node := nodeNamed(name)
+		node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: address}}
+
+		return node
+	}
+
+	// setup returns a workload cluster whose node-2 moved from 10.0.0.2 to 10.1.0.2, and its etcd client.
+	setup := func(probe etcdPeerProber) (*Workload, *etcdfake.FakeEtcdClient) {
+		etcdClient := &etcdfake.FakeEtcdClient{
+			AlarmResponse: &clientv3.AlarmResponse{},
+			MemberListResponse: &clientv3.MemberListResponse{
+				Members: []*pb.Member{
+					{Name: "node-1-1a2b3c4d", ID: uint64(1), PeerURLs: []string{"https://10.0.0.1:2380"}},
+					{Name: "node-2-1a2b3c4d", ID: uint64(2), PeerURLs: []string{"https://10.0.0.2:2380"}},
+					// The node of this member no longer exists.
+					{Name: "node-3-1a2b3c4d", ID: uint64(3), PeerURLs: []string{"https://10.0.0.3:2380"}},
+					// This member is still joining the cluster.
+					{ID: uint64(4), PeerURLs: []string{"https://10.0.0.4:2380"}, IsLearner: true},
+				},
+			},
+			MemberUpdateResponse: &clientv3.MemberUpdateResponse{},
+		}
+
+		return &Workload{
+			Client: &fakeClient{list: &corev1.NodeList{
+				Items: []corev1.Node{nodeWithAddress("node-1", "10.0.0.1"), nodeWithAddress("node-2", "10.1.0.2")},
+			}},
+			etcdClientGenerator: &fakeEtcdClientGenerator{forLeaderClient: &etcd.Client{EtcdClient: etcdClient}},
+			etcdPeerProber:      probe,
+		}, etcdClient
+	}
+
+	t.Run("updates the peer URL of a member whose node address changed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		probed := []string{}
+		w, etcdClient := setup(func(_ context.Context, nodeName, peerURL string) error {
+			probed = append(probed, nodeName+" "+peerURL)
+
+			return nil
+		})
+
+		updated, err := w.ReconcileEtcdPeerURLs(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(updated).To(ConsistOf("node-2-1a2b3c4d"))
+		g.Expect(probed).To(ConsistOf("node-2 https://10.1.0.2:2380"))
+		g.Expect(etcdClient.UpdatedMember).To(Equal(uint64(2)))
+		g.Expect(etcdClient.UpdatedPeerURLs).To(Equal([]string{"https://10.1.0.2:2380"}))
+	})
+
+	t.Run("does not update the peer URL when the new one can't be connected to", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w, etcdClient := setup(func(_ context.Context, _, _ string) error {
+			return errors.New("connection refused")
+		})
+
+		updated, err := w.ReconcileEtcdPeerURLs(context.Background())
+		g.Expect(err).To(MatchError(ContainSubstring("failed to connect to peer URL https://10.1.0.2:2380")))
+		g.Expect(updated).To(BeEmpty())
+		g.Expect(etcdClient.UpdatedMember).To(BeZero())
+	})
+
+	t.Run("is not supported with an external etcd", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{externalEtcd: &etcd.ExternalClientGenerator{}}
+
+		_, err := w.ReconcileEtcdPeerURLs(context.Background())
+		g.Expect(err).To(MatchError(ErrNotSupportedWithExternalEtcd))
+	})
+}
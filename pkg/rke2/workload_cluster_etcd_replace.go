@@ -0,0 +1,328 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	etcdutil "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/util"
+)
+
+// ErrEtcdQuorumAtRisk is returned when an etcd member replacement step would leave less than a quorum of healthy
+// voting members.
+var ErrEtcdQuorumAtRisk = errors.New("etcd quorum would be at risk")
+
+// ErrEtcdMemberReplacementRolledBack is returned when the new etcd member of a replacement was removed again as it is
+// not healthy, the new machine is then expected to be replaced.
+var ErrEtcdMemberReplacementRolledBack = errors.New("etcd member replacement was rolled back")
+
+// EtcdMemberReplacementRollbackTimeout is the duration after which a promoted etcd member of a replacement which is
+// still not healthy is removed again.
+const EtcdMemberReplacementRollbackTimeout = 5 * time.Minute
+
+// etcdMemberReplacementsTracker records since when the new etcd members of replacements are not healthy. The zero
+// value is ready to use.
+type etcdMemberReplacementsTracker struct {
+	lock           sync.Mutex
+	unhealthySince map[ctrlclient.ObjectKey]map[uint64]time.Time
+}
+
+var etcdMemberReplacements = &etcdMemberReplacementsTracker{}
+
+// observe records whether the member is healthy, and returns since when it is not healthy, or the zero time if it is.
+func (t *etcdMemberReplacementsTracker) observe(clusterKey ctrlclient.ObjectKey, memberID uint64, healthy bool) time.Time {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.unhealthySince == nil {
+		t.unhealthySince = map[ctrlclient.ObjectKey]map[uint64]time.Time{}
+	}
+
+	if healthy {
+		delete(t.unhealthySince[clusterKey], memberID)
+
+		return time.Time{}
+	}
+
+	if t.unhealthySince[clusterKey] == nil {
+		t.unhealthySince[clusterKey] = map[uint64]time.Time{}
+	}
+
+	since, ok := t.unhealthySince[clusterKey][memberID]
+	if !ok {
+		since = time.Now()
+		t.unhealthySince[clusterKey][memberID] = since
+	}
+
+	return since
+}
+
+// forget drops the members recorded for the workload cluster.
+func (t *etcdMemberReplacementsTracker) forget(clusterKey ctrlclient.ObjectKey) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.unhealthySince, clusterKey)
+}
+
+// ForgetEtcdMemberReplacements drops the etcd member replacements recorded for the cluster, e.g. once its control
+// plane is deleted.
+func ForgetEtcdMemberReplacements(clusterKey ctrlclient.ObjectKey) {
+	etcdMemberReplacements.forget(clusterKey)
+}
+
+// ReplaceEtcdMember replaces the etcd member of the old machine with the member of the new machine, removing the old
+// member only once the new one is a healthy voting member, so the cluster never has fewer healthy voting members than
+// before the replacement. The new member is added as a learner by the RKE2 server of the new machine when it joins
+// the cluster, and is found by the name of its node or, before the machine has a node reference, by the machine
+// addresses. Each call performs at most one of the following steps, and returns true once the old member is removed,
+// so it is expected to be called on every reconcile until then:
+//  1. the learner is promoted to a voting member, once it is started and in sync with the leader, unless RKE2 already
+//     did;
+//  2. the etcd leadership is moved to the new member, if the old member holds it;
+//  3. the old member is removed, if the new member is healthy and enough healthy voting members remain for a quorum.
+//
+// A failed step leaves the cluster as it was before the step, and is retried on the next call. A learner which never
+// starts or catches up is left to EvacuateEtcdLearnerOnFailure, as it does not vote. A promoted member which is still
+// not healthy after EtcdMemberReplacementRollbackTimeout is removed again, restoring the initial voting members, and
+// an error wrapping ErrEtcdMemberReplacementRolledBack is returned.
+func (w *Workload) ReplaceEtcdMember(ctx context.Context, oldMachine, newMachine *clusterv1.Machine) (bool, error) {
+	if w.externalEtcd != nil {
+		return false, errors.Wrap(ErrNotSupportedWithExternalEtcd, "etcd members are not bound to machines")
+	}
+
+	// There is no member to replace.
+	if oldMachine == nil || oldMachine.Status.NodeRef == nil {
+		return true, nil
+	}
+
+	if newMachine == nil {
+		return false, nil
+	}
+
+	if w.etcdClientGenerator == nil {
+		return false, errors.New("etcd certificates are not available to replace the etcd member")
+	}
+
+	logger := log.FromContext(ctx).WithValues("oldMachine", oldMachine.Name, "newMachine", newMachine.Name)
+
+	nodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to list control plane nodes")
+	}
+
+	nodeNames := make([]string, 0, len(nodes.Items))
+	for i := range nodes.Items {
+		nodeNames = append(nodeNames, nodes.Items[i].Name)
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	var oldMember *etcd.Member
+
+	for _, member := range members {
+		if member.Name != "" && etcdutil.NodeNameFromMember(member) == oldMachine.Status.NodeRef.Name {
+			oldMember = member
+		}
+	}
+
+	// The old member is already gone.
+	if oldMember == nil {
+		return true, nil
+	}
+
+	newMember := replacementEtcdMember(members, newMachine, nodes.Items)
+
+	switch {
+	case newMember == nil || newMember.Name == "":
+		logger.V(2).Info("Waiting for RKE2 to join the etcd member of the new machine")
+
+		return false, nil
+
+	case newMember.IsLearner:
+		if err := etcdClient.PromoteMember(ctx, newMember.ID); err != nil {
+			if errors.Is(err, etcd.ErrLearnerNotReady) {
+				logger.V(2).Info("Waiting for the etcd learner member of the new machine to catch up", "member", newMember.Name)
+
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		logger.Info("Promoted etcd learner member of the new machine", "member", newMember.Name)
+
+		return false, nil
+	}
+
+	healthy := map[uint64]bool{}
+	voters, healthyVoters := 0, 0
+
+	var newMemberErr error
+
+	for _, member := range members {
+		if member.IsLearner {
+			continue
+		}
+
+		voters++
+
+		err := w.etcdMemberHealth(ctx, member)
+		if err == nil {
+			healthy[member.ID] = true
+			healthyVoters++
+		}
+
+		if member.ID == newMember.ID {
+			newMemberErr = err
+		}
+	}
+
+	if unhealthySince := etcdMemberReplacements.observe(w.clusterKey, newMember.ID, healthy[newMember.ID]); !unhealthySince.IsZero() {
+		if time.Since(unhealthySince) <= EtcdMemberReplacementRollbackTimeout {
+			logger.V(2).Info("Waiting for the etcd member of the new machine to be healthy", "member", newMember.Name,
+				"error", newMemberErr.Error())
+
+			return false, nil
+		}
+
+		// The new member raises the quorum without adding a healthy member, remove it to restore the initial voting members.
+		if err := etcdClient.RemoveMember(ctx, newMember.ID); err != nil {
+			return false, errors.Wrapf(err, "failed to roll back the unhealthy etcd member %s of machine %s", newMember.Name, newMachine.Name)
+		}
+
+		etcdMemberReplacements.observe(w.clusterKey, newMember.ID, true)
+		logger.Info("Removed the unhealthy etcd member of the new machine", "member", newMember.Name)
+
+		return false, errors.Wrapf(ErrEtcdMemberReplacementRolledBack, "etcd member %s of machine %s is not healthy: %v",
+			newMember.Name, newMachine.Name, newMemberErr)
+	}
+
+	remainingHealthyVoters := healthyVoters
+	if healthy[oldMember.ID] {
+		remainingHealthyVoters--
+	}
+
+	if quorum := (voters-1)/2 + 1; remainingHealthyVoters < quorum {
+		return false, errors.Wrapf(ErrEtcdQuorumAtRisk, "removing etcd member %s would leave %d healthy voting members, %d are required",
+			oldMember.Name, remainingHealthyVoters, quorum)
+	}
+
+	if etcdClient.LeaderID == oldMember.ID {
+		if err := etcdClient.MoveLeader(ctx, newMember.ID); err != nil {
+			return false, err
+		}
+
+		logger.Info("Moved etcd leadership to the member of the new machine", "member", newMember.Name)
+
+		return false, nil
+	}
+
+	if err := etcdClient.RemoveMember(ctx, oldMember.ID); err != nil {
+		return false, err
+	}
+
+	logger.Info("Removed etcd member of the old machine", "member", oldMember.Name)
+
+	return true, nil
+}
+
+// replacementEtcdMember returns the etcd member of the new machine, either started or added for its node but not
+// started yet, or nil if there is none. Members are matched with the node of the machine if it has one, or with the
+// machine addresses otherwise.
+func replacementEtcdMember(members []*etcd.Member, machine *clusterv1.Machine, nodes []corev1.Node) *etcd.Member {
+	var node *corev1.Node
+
+	if machine.Status.NodeRef != nil {
+		for i := range nodes {
+			if nodes[i].Name == machine.Status.NodeRef.Name {
+				node = &nodes[i]
+			}
+		}
+	}
+
+	for _, member := range members {
+		switch {
+		case node != nil && member.Name != "" && etcdMemberMatchesNode(member, node):
+			return member
+		case node != nil && member.Name == "" && etcdPeerURLsMatchNode(member, node):
+			return member
+		case node == nil && etcdPeerURLsMatchMachine(member, machine):
+			return member
+		}
+	}
+
+	return nil
+}
+
+// etcdPeerURLsMatchMachine returns true if one of the member peer URLs points to one of the machine addresses.
+func etcdPeerURLsMatchMachine(member *etcd.Member, machine *clusterv1.Machine) bool {
+	for _, peerURL := range member.PeerURLs {
+		u, err := url.Parse(peerURL)
+		if err != nil {
+			continue
+		}
+
+		for _, address := range machine.Status.Addresses {
+			if address.Address == u.Hostname() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// etcdMemberHealth returns an error if the member is not started, can't be connected to, or reports an error, e.g.
+// an alarm, or no leader in its status. The readiness of its node is not considered, as a new node is not ready before
+// its CNI is, while its etcd member already is.
+func (w *Workload) etcdMemberHealth(ctx context.Context, member *etcd.Member) error {
+	if member.Name == "" {
+		return errors.New("etcd member is not started")
+	}
+
+	if len(member.Alarms) > 0 {
+		return errors.Errorf("etcd member has %d alarms", len(member.Alarms))
+	}
+
+	memberClient, err := w.etcdMemberClient(ctx, member)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to etcd member")
+	}
+	defer memberClient.Close()
+
+	return memberClient.Health(ctx)
+}
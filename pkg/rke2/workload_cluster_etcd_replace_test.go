@@ -0,0 +1,439 @@
+package rke2
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+)
+
+// fakeEtcdCluster is an etcd fake keeping track of the members through their addition, promotion and removal, and
+// recording the lowest number of voting members.
+type fakeEtcdCluster struct {
+	client      *etcd.Client
+	members     []*pb.Member
+	nextID      uint64
+	inSync      bool
+	unreachable []string
+	errs        map[string]error
+	minVoters   int
+
+	// statusErrors are the errors reported in the status of the members, keyed by the name of their node.
+	statusErrors map[string][]string
+}
+
+func (c *fakeEtcdCluster) voters() int {
+	voters := 0
+
+	for _, member := range c.members {
+		if !member.IsLearner {
+			voters++
+		}
+	}
+
+	return voters
+}
+
+func (c *fakeEtcdCluster) recordVoters() {
+	c.minVoters = min(c.minVoters, c.voters())
+}
+
+func (c *fakeEtcdCluster) memberNames() []string {
+	names := []string{}
+	for _, member := range c.members {
+		names = append(names, member.Name)
+	}
+
+	return names
+}
+
+// join simulates the RKE2 server of a new node adding its member as a learner with its peer URL.
+func (c *fakeEtcdCluster) join(peerURL string) {
+	c.nextID++
+	c.members = append(c.members, &pb.Member{ID: c.nextID, PeerURLs: []string{peerURL}, IsLearner: true})
+}
+
+// start simulates the RKE2 server of a node starting the unstarted member with its peer URL.
+func (c *fakeEtcdCluster) start(peerURL, name string) {
+	for _, member := range c.members {
+		if member.Name == "" && slices.Contains(member.PeerURLs, peerURL) {
+			member.Name = name
+		}
+	}
+}
+
+func (c *fakeEtcdCluster) AlarmDisarm(context.Context, *clientv3.AlarmMember) (*clientv3.AlarmResponse, error) {
+	return &clientv3.AlarmResponse{}, nil
+}
+
+func (c *fakeEtcdCluster) AlarmList(context.Context) (*clientv3.AlarmResponse, error) {
+	return &clientv3.AlarmResponse{}, nil
+}
+
+func (c *fakeEtcdCluster) Close() error {
+	return nil
+}
+
+func (c *fakeEtcdCluster) Compact(context.Context, int64, ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+	return &clientv3.CompactResponse{}, nil
+}
+
+func (c *fakeEtcdCluster) Defragment(context.Context, string) (*clientv3.DefragmentResponse, error) {
+	return &clientv3.DefragmentResponse{}, nil
+}
+
+func (c *fakeEtcdCluster) Endpoints() []string {
+	return []string{"https://10.0.0.1:2379"}
+}
+
+func (c *fakeEtcdCluster) MemberAddAsLearner(_ context.Context, peerAddrs []string) (*clientv3.MemberAddResponse, error) {
+	if err := c.errs["add"]; err != nil {
+		return nil, err
+	}
+
+	c.nextID++
+	member := &pb.Member{ID: c.nextID, PeerURLs: peerAddrs, IsLearner: true}
+	c.members = append(c.members, member)
+
+	return &clientv3.MemberAddResponse{Member: member}, nil
+}
+
+func (c *fakeEtcdCluster) MemberList(context.Context) (*clientv3.MemberListResponse, error) {
+	members := make([]*pb.Member, 0, len(c.members))
+	for _, member := range c.members {
+		members = append(members, &pb.Member{
+			ID:        member.ID,
+			Name:      member.Name,
+			PeerURLs:  member.PeerURLs,
+			IsLearner: member.IsLearner,
+		})
+	}
+
+	return &clientv3.MemberListResponse{Members: members}, nil
+}
+
+func (c *fakeEtcdCluster) MemberPromote(_ context.Context, id uint64) (*clientv3.MemberPromoteResponse, error) {
+	if err := c.errs["promote"]; err != nil {
+		return nil, err
+	}
+
+	if !c.inSync {
+		return nil, rpctypes.ErrMemberLearnerNotReady
+	}
+
+	for _, member := range c.members {
+		if member.ID == id {
+			member.IsLearner = false
+		}
+	}
+
+	c.recordVoters()
+
+	return &clientv3.MemberPromoteResponse{}, nil
+}
+
+func (c *fakeEtcdCluster) MemberRemove(_ context.Context, id uint64) (*clientv3.MemberRemoveResponse, error) {
+	if err := c.errs["remove"]; err != nil {
+		return nil, err
+	}
+
+	c.members = slices.DeleteFunc(c.members, func(member *pb.Member) bool { return member.ID == id })
+	c.recordVoters()
+
+	return &clientv3.MemberRemoveResponse{}, nil
+}
+
+func (c *fakeEtcdCluster) MemberUpdate(context.Context, uint64, []string) (*clientv3.MemberUpdateResponse, error) {
+	return &clientv3.MemberUpdateResponse{}, nil
+}
+
+func (c *fakeEtcdCluster) MoveLeader(_ context.Context, id uint64) (*clientv3.MoveLeaderResponse, error) {
+	if err := c.errs["moveLeader"]; err != nil {
+		return nil, err
+	}
+
+	c.client.LeaderID = id
+
+	return &clientv3.MoveLeaderResponse{}, nil
+}
+
+func (c *fakeEtcdCluster) Status(_ context.Context, endpoint string) (*clientv3.StatusResponse, error) {
+	return &clientv3.StatusResponse{Leader: c.client.LeaderID, Errors: c.statusErrors[endpoint]}, nil
+}
+
+func TestReplaceEtcdMember(t *testing.T) {
+	const newPeerURL = "https://10.0.0.4:2380"
+
+	controlPlaneNode := func(name, address string) client.Object {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{labelNodeRoleControlPlane: "true"}},
+			Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: address}}},
+		}
+	}
+
+	machine := func(name, nodeName string) *clusterv1.Machine {
+		return &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: nodeName}},
+		}
+	}
+
+	oldMachine := machine("machine-3", "node-3")
+	newMachine := machine("machine-4", "node-4")
+
+	// setup builds a workload cluster of three etcd members, whose leader is the member of the old machine.
+	setup := func() (*Workload, *fakeEtcdCluster) {
+		ForgetEtcdMemberReplacements(client.ObjectKey{})
+
+		cluster := &fakeEtcdCluster{
+			members: []*pb.Member{
+				{ID: 1, Name: "node-1-1a2b3c4d", PeerURLs: []string{"https://10.0.0.1:2380"}},
+				{ID: 2, Name: "node-2-1a2b3c4d", PeerURLs: []string{"https://10.0.0.2:2380"}},
+				{ID: 3, Name: "node-3-1a2b3c4d", PeerURLs: []string{"https://10.0.0.3:2380"}},
+			},
+			nextID:       3,
+			errs:         map[string]error{},
+			minVoters:    3,
+			statusErrors: map[string][]string{},
+		}
+		cluster.client = &etcd.Client{EtcdClient: cluster, LeaderID: 3}
+
+		w := &Workload{
+			Client: fake.NewClientBuilder().WithObjects(
+				controlPlaneNode("node-1", "10.0.0.1"),
+				controlPlaneNode("node-2", "10.0.0.2"),
+				controlPlaneNode("node-3", "10.0.0.3"),
+				controlPlaneNode("node-4", "10.0.0.4"),
+			).Build(),
+			etcdClientGenerator: &fakeEtcdClientGenerator{
+				forLeaderClient: cluster.client,
+				forNodesClientFunc: func(nodeNames []string) (*etcd.Client, error) {
+					if slices.Contains(cluster.unreachable, nodeNames[0]) {
+						return nil, errors.New("unreachable")
+					}
+
+					return &etcd.Client{EtcdClient: cluster, Endpoint: nodeNames[0]}, nil
+				},
+			},
+		}
+
+		return w, cluster
+	}
+
+	// promote runs the replacement up to the promotion of the member RKE2 joined for the new machine.
+	promote := func(g *WithT, w *Workload, cluster *fakeEtcdCluster) {
+		cluster.join(newPeerURL)
+		cluster.start(newPeerURL, "node-4-5e6f7a8b")
+		cluster.inSync = true
+
+		replaced, err := w.ReplaceEtcdMember(context.Background(), oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeFalse())
+		g.Expect(cluster.voters()).To(Equal(4))
+	}
+
+	t.Run("waits for RKE2 to join, promotes, then removes without reducing the voting members", func(t *testing.T) {
+		g := NewWithT(t)
+		ctx := context.Background()
+
+		w, cluster := setup()
+
+		// Nothing happens before RKE2 joins the member of the new machine.
+		replaced, err := w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeFalse())
+		g.Expect(cluster.members).To(HaveLen(3))
+
+		// The learner is not promoted before it starts and catches up.
+		cluster.join(newPeerURL)
+
+		replaced, err = w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeFalse())
+
+		cluster.start(newPeerURL, "node-4-5e6f7a8b")
+
+		replaced, err = w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeFalse())
+		g.Expect(cluster.voters()).To(Equal(3))
+
+		// The learner is promoted.
+		cluster.inSync = true
+
+		replaced, err = w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeFalse())
+		g.Expect(cluster.voters()).To(Equal(4))
+
+		// The leadership is moved away from the old member.
+		replaced, err = w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeFalse())
+		g.Expect(cluster.client.LeaderID).To(Equal(uint64(4)))
+
+		// The old member is removed.
+		replaced, err = w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeTrue())
+		g.Expect(cluster.memberNames()).To(Equal([]string{"node-1-1a2b3c4d", "node-2-1a2b3c4d", "node-4-5e6f7a8b"}))
+		g.Expect(cluster.minVoters).To(Equal(3))
+
+		// The replacement is complete.
+		replaced, err = w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeTrue())
+	})
+
+	t.Run("retries failed steps without changing the members", func(t *testing.T) {
+		g := NewWithT(t)
+		ctx := context.Background()
+
+		w, cluster := setup()
+		cluster.join(newPeerURL)
+		cluster.start(newPeerURL, "node-4-5e6f7a8b")
+		cluster.inSync = true
+		cluster.errs["promote"] = errors.New("etcdserver: request timed out")
+
+		_, err := w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).To(MatchError(ContainSubstring("request timed out")))
+		g.Expect(cluster.voters()).To(Equal(3))
+
+		delete(cluster.errs, "promote")
+
+		replaced, err := w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeFalse())
+		g.Expect(cluster.voters()).To(Equal(4))
+
+		cluster.errs["moveLeader"] = errors.New("etcdserver: leader changed")
+
+		_, err = w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).To(MatchError(ContainSubstring("leader changed")))
+		g.Expect(cluster.client.LeaderID).To(Equal(uint64(3)))
+		g.Expect(cluster.members).To(HaveLen(4))
+
+		delete(cluster.errs, "moveLeader")
+
+		replaced, err = w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeFalse())
+
+		replaced, err = w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeTrue())
+		g.Expect(cluster.minVoters).To(Equal(3))
+	})
+
+	t.Run("waits for the new member to be healthy before removing the old one", func(t *testing.T) {
+		g := NewWithT(t)
+		ctx := context.Background()
+
+		w, cluster := setup()
+		promote(g, w, cluster)
+
+		cluster.statusErrors["node-4"] = []string{"memberID:4 alarm:NOSPACE"}
+
+		for range 2 {
+			replaced, err := w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(replaced).To(BeFalse())
+			g.Expect(cluster.members).To(HaveLen(4))
+			g.Expect(cluster.client.LeaderID).To(Equal(uint64(3)))
+		}
+
+		// The new member recovers.
+		delete(cluster.statusErrors, "node-4")
+
+		replaced, err := w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeFalse())
+		g.Expect(cluster.client.LeaderID).To(Equal(uint64(4)))
+	})
+
+	t.Run("rolls back a promoted member which stays unhealthy", func(t *testing.T) {
+		g := NewWithT(t)
+		ctx := context.Background()
+
+		w, cluster := setup()
+		promote(g, w, cluster)
+
+		cluster.unreachable = []string{"node-4"}
+
+		// A single failed connection does not roll back the new member.
+		replaced, err := w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeFalse())
+		g.Expect(cluster.members).To(HaveLen(4))
+
+		etcdMemberReplacements.lock.Lock()
+		etcdMemberReplacements.unhealthySince[client.ObjectKey{}][4] = time.Now().Add(-EtcdMemberReplacementRollbackTimeout - time.Second)
+		etcdMemberReplacements.lock.Unlock()
+
+		replaced, err = w.ReplaceEtcdMember(ctx, oldMachine, newMachine)
+		g.Expect(err).To(MatchError(ErrEtcdMemberReplacementRolledBack))
+		g.Expect(replaced).To(BeFalse())
+		g.Expect(cluster.memberNames()).To(Equal([]string{"node-1-1a2b3c4d", "node-2-1a2b3c4d", "node-3-1a2b3c4d"}))
+		g.Expect(cluster.client.LeaderID).To(Equal(uint64(3)))
+	})
+
+	t.Run("does not remove the old member without a quorum of healthy members", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w, cluster := setup()
+		promote(g, w, cluster)
+
+		cluster.unreachable = []string{"node-1", "node-2"}
+
+		replaced, err := w.ReplaceEtcdMember(context.Background(), oldMachine, newMachine)
+		g.Expect(err).To(MatchError(ErrEtcdQuorumAtRisk))
+		g.Expect(replaced).To(BeFalse())
+		g.Expect(cluster.members).To(HaveLen(4))
+		g.Expect(cluster.client.LeaderID).To(Equal(uint64(3)))
+	})
+
+	t.Run("finds the member of a new machine without a node by its addresses", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w, cluster := setup()
+		cluster.join(newPeerURL)
+		cluster.start(newPeerURL, "node-4-5e6f7a8b")
+		cluster.inSync = true
+
+		newMachine := &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine-4"},
+			Status: clusterv1.MachineStatus{
+				Addresses: clusterv1.MachineAddresses{{Type: clusterv1.MachineInternalIP, Address: "10.0.0.4"}},
+			},
+		}
+
+		replaced, err := w.ReplaceEtcdMember(context.Background(), oldMachine, newMachine)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeFalse())
+		g.Expect(cluster.voters()).To(Equal(4))
+	})
+
+	t.Run("waits for the member of the new machine", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w, cluster := setup()
+
+		replaced, err := w.ReplaceEtcdMember(context.Background(), oldMachine, machine("machine-5", "node-5"))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replaced).To(BeFalse())
+		g.Expect(cluster.members).To(HaveLen(3))
+	})
+}
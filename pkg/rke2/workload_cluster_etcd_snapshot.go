@@ -0,0 +1,350 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+const (
+	defaultEtcdS3Endpoint = "s3.amazonaws.com"
+	// defaultEtcdS3Region is the default of the etcd-s3-region RKE2 option.
+	defaultEtcdS3Region = "us-east-1"
+
+	etcdS3RequestTimeout = 30 * time.Second
+)
+
+var (
+	// ErrEtcdSnapshotTargetUnauthorized is returned when the S3 etcd snapshot target rejects the configured credentials.
+	ErrEtcdSnapshotTargetUnauthorized = errors.New("etcd snapshot S3 target rejected the credentials")
+
+	// ErrEtcdSnapshotTargetUnreachable is returned when the S3 etcd snapshot target endpoint can't be reached.
+	ErrEtcdSnapshotTargetUnreachable = errors.New("etcd snapshot S3 target is unreachable")
+
+	// ErrEtcdSnapshotBucketNotFound is returned when the bucket of the S3 etcd snapshot target does not exist.
+	ErrEtcdSnapshotBucketNotFound = errors.New("etcd snapshot S3 bucket does not exist")
+)
+
+// EtcdSnapshotTargetVerification is the outcome of the verification of an etcd snapshot target.
+type EtcdSnapshotTargetVerification string
+
+const (
+	// EtcdSnapshotTargetVerified means the S3 target was reachable and writable with the configured credentials.
+	EtcdSnapshotTargetVerified EtcdSnapshotTargetVerification = "Verified"
+
+	// EtcdSnapshotTargetSkipped means only local snapshots are configured, there is no S3 target to verify.
+	EtcdSnapshotTargetSkipped EtcdSnapshotTargetVerification = "Skipped"
+
+	// EtcdSnapshotTargetUnverified means the S3 target could not be verified, either because it failed the
+	// verification or because the nodes authenticate with their IAM role, which is not available to the controller.
+	EtcdSnapshotTargetUnverified EtcdSnapshotTargetVerification = "Unverified"
+)
+
+// EtcdS3Target is the S3 target etcd snapshots are uploaded to, along with the credentials of the referenced secret.
+type EtcdS3Target struct {
+	Endpoint           string
+	Bucket             string
+	Region             string
+	Folder             string
+	AccessKeyID        string
+	SecretAccessKey    string
+	CACert             []byte
+	InsecureSkipVerify bool
+}
+
+// GetEtcdS3Target returns the S3 etcd snapshot target of the RKE2ControlPlane, reading the credentials and endpoint CA
+// from the referenced secrets. Nil is returned when only local snapshots are configured.
+func GetEtcdS3Target(ctx context.Context, cl ctrlclient.Reader, rcp *controlplanev1.RKE2ControlPlane) (*EtcdS3Target, error) {
+	s3 := rcp.Spec.ServerConfig.Etcd.BackupConfig.S3
+	if s3 == nil {
+		return nil, nil
+	}
+
+	target := &EtcdS3Target{
+		Endpoint:           s3.Endpoint,
+		Bucket:             s3.Bucket,
+		Region:             s3.Region,
+		Folder:             s3.Folder,
+		InsecureSkipVerify: !s3.EnforceSSLVerify,
+	}
+
+	if s3.S3CredentialSecret != nil {
+		credentials := &corev1.Secret{}
+		key := ctrlclient.ObjectKey{Namespace: s3.S3CredentialSecret.Namespace, Name: s3.S3CredentialSecret.Name}
+
+		if err := cl.Get(ctx, key, credentials); err != nil {
+			return nil, errors.Wrap(err, "failed to get aws credentials secret")
+		}
+
+		target.AccessKeyID = string(credentials.Data["aws_access_key_id"])
+		target.SecretAccessKey = string(credentials.Data["aws_secret_access_key"])
+	}
+
+	if s3.EndpointCASecret != nil {
+		endpointCA := &corev1.Secret{}
+		key := ctrlclient.ObjectKey{Namespace: s3.EndpointCASecret.Namespace, Name: s3.EndpointCASecret.Name}
+
+		if err := cl.Get(ctx, key, endpointCA); err != nil {
+			return nil, errors.Wrap(err, "failed to get endpoint CA secret")
+		}
+
+		target.CACert = endpointCA.Data["ca.pem"]
+	}
+
+	return target, nil
+}
+
+// VerifyEtcdSnapshotTarget checks that the S3 etcd snapshot target is reachable and writable, by checking the bucket
+// exists and writing then deleting a test object in the snapshot folder. Failures wrap
+// ErrEtcdSnapshotTargetUnauthorized, ErrEtcdSnapshotTargetUnreachable or ErrEtcdSnapshotBucketNotFound when the cause
+// is known, and are reported as EtcdSnapshotTargetUnverified.
+// The check runs from the management cluster, not from the nodes uploading the snapshots: a target only reachable
+// from the management cluster network, or only from the nodes network, is not detected. For the same reason, a target
+// without credentials is reported as EtcdSnapshotTargetUnverified, as the nodes then authenticate with their IAM role.
+// EtcdSnapshotTargetSkipped is returned when the target is nil, i.e. only local snapshots are configured.
+// The call is rejected with ErrEtcdMaintenanceRateLimited when the etcd maintenance operations of the cluster are
+// throttled.
+func (w *Workload) VerifyEtcdSnapshotTarget(ctx context.Context, target *EtcdS3Target) (EtcdSnapshotTargetVerification, error) {
+	logger := log.FromContext(ctx)
+
+	if target == nil {
+		logger.V(4).Info("Only local etcd snapshots are configured, skipping S3 target verification")
+
+		return EtcdSnapshotTargetSkipped, nil
+	}
+
+	if target.AccessKeyID == "" || target.SecretAccessKey == "" {
+		logger.V(4).Info("Etcd snapshot S3 target uses IAM authentication, it can't be verified from the management cluster")
+
+		return EtcdSnapshotTargetUnverified, nil
+	}
+
+	if err := w.allowEtcdMaintenance("verifying etcd snapshot target"); err != nil {
+		return EtcdSnapshotTargetUnverified, err
+	}
+
+	client, err := newEtcdS3Client(target)
+	if err != nil {
+		return EtcdSnapshotTargetUnverified, err
+	}
+
+	if err := client.do(ctx, http.MethodHead, "", nil); err != nil {
+		return EtcdSnapshotTargetUnverified, errors.Wrapf(err, "failed to check bucket %q", target.Bucket)
+	}
+
+	key := strings.Trim(target.Folder+"/.capi-rke2-verify-"+rand.String(8), "/")
+
+	if err := client.do(ctx, http.MethodPut, key, []byte("verify")); err != nil {
+		return EtcdSnapshotTargetUnverified, errors.Wrapf(err, "failed to write test object %q to bucket %q", key, target.Bucket)
+	}
+
+	if err := client.do(ctx, http.MethodDelete, key, nil); err != nil {
+		return EtcdSnapshotTargetUnverified, errors.Wrapf(err, "failed to delete test object %q from bucket %q", key, target.Bucket)
+	}
+
+	logger.V(4).Info("Verified etcd snapshot S3 target", "endpoint", client.endpoint.Host, "bucket", target.Bucket,
+		"region", client.region)
+
+	return EtcdSnapshotTargetVerified, nil
+}
+
+// etcdS3Client sends path-style requests to an S3 bucket, signed with AWS signature version 4. No S3 client is a
+// dependency of the module, so the signature only covers the bodiless HEAD and DELETE requests and the small PUT
+// request of the verification.
+type etcdS3Client struct {
+	target     *EtcdS3Target
+	endpoint   *url.URL
+	httpClient *http.Client
+	now        func() time.Time
+
+	// region is the region the requests are signed for: the configured region, or the RKE2 default until S3 redirects
+	// to the region of the bucket.
+	region string
+}
+
+func newEtcdS3Client(target *EtcdS3Target) (*etcdS3Client, error) {
+	endpoint := target.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEtcdS3Endpoint
+	}
+
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid etcd snapshot S3 endpoint %q", target.Endpoint)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: target.InsecureSkipVerify, //nolint:gosec // Mirrors the etcd-s3-skip-ssl-verify RKE2 option.
+	}
+
+	if len(target.CACert) > 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(target.CACert) {
+			return nil, errors.New("failed to parse etcd snapshot S3 endpoint CA certificate")
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	region := target.Region
+	if region == "" {
+		region = defaultEtcdS3Region
+	}
+
+	return &etcdS3Client{
+		target:   target,
+		endpoint: endpointURL,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   etcdS3RequestTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		now:    time.Now,
+		region: region,
+	}, nil
+}
+
+// do sends a signed request for the object key of the bucket, or for the bucket itself when key is empty,
+// and maps the failures to the etcd snapshot target errors. When no region is configured and S3 reports the bucket
+// lives in another region than the default one, the request is signed again for the region of the bucket.
+func (c *etcdS3Client) do(ctx context.Context, method, key string, body []byte) error {
+	resp, err := c.send(ctx, method, key, body)
+	if err != nil {
+		return err
+	}
+
+	if bucketRegion := resp.Header.Get("X-Amz-Bucket-Region"); c.target.Region == "" && bucketRegion != "" &&
+		bucketRegion != c.region && resp.StatusCode >= http.StatusMultipleChoices {
+		resp.Body.Close()
+
+		c.region = bucketRegion
+
+		if resp, err = c.send(ctx, method, key, body); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < http.StatusMultipleChoices:
+		return nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return errors.Wrapf(ErrEtcdSnapshotTargetUnauthorized, "S3 responded %s", resp.Status)
+	case resp.StatusCode == http.StatusNotFound && key == "":
+		return errors.Wrapf(ErrEtcdSnapshotBucketNotFound, "S3 responded %s", resp.Status)
+	default:
+		return errors.Errorf("S3 responded %s", resp.Status)
+	}
+}
+
+// send sends a signed request for the object key of the bucket, or for the bucket itself when key is empty.
+// Redirects are not followed, as S3 redirects requests signed for the wrong region.
+func (c *etcdS3Client) send(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	requestURL := *c.endpoint
+	requestURL.Path = strings.TrimSuffix(requestURL.Path, "/") + "/" + c.target.Bucket
+
+	if key != "" {
+		requestURL.Path += "/" + key
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create S3 request")
+	}
+
+	c.sign(req, body)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(ErrEtcdSnapshotTargetUnreachable, "%s", err)
+	}
+
+	return resp, nil
+}
+
+// sign adds the AWS signature version 4 authorization headers to the request, for the region of the client.
+func (c *etcdS3Client) sign(req *http.Request, body []byte) {
+	region := c.region
+	now := c.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+c.target.SecretAccessKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.target.AccessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(signingKey, stringToSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,220 @@
+package rke2
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+// fakeS3 emulates the S3 API calls used to verify an etcd snapshot target.
+type fakeS3 struct {
+	lock       sync.Mutex
+	bucket     string
+	region     string
+	denyWrites bool
+	requests   []string
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	switch {
+	case !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access-key/"):
+		w.WriteHeader(http.StatusForbidden)
+	case !strings.Contains(r.Header.Get("Authorization"), "/"+s.region+"/s3/aws4_request"):
+		w.Header().Set("X-Amz-Bucket-Region", s.region)
+		w.WriteHeader(http.StatusMovedPermanently)
+	case s.denyWrites && r.Method == http.MethodPut:
+		w.WriteHeader(http.StatusForbidden)
+	case !strings.HasPrefix(r.URL.Path, "/"+s.bucket):
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func TestVerifyEtcdSnapshotTarget(t *testing.T) {
+	s3 := &fakeS3{bucket: "snapshots", region: "eu-central-1"}
+	server := httptest.NewTLSServer(s3)
+
+	defer server.Close()
+
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	target := func(mutate func(*EtcdS3Target)) *EtcdS3Target {
+		target := &EtcdS3Target{
+			Endpoint:        server.Listener.Addr().String(),
+			Bucket:          "snapshots",
+			Region:          "eu-central-1",
+			Folder:          "cluster-a",
+			AccessKeyID:     "access-key",
+			SecretAccessKey: "secret-key",
+			CACert:          caCert,
+		}
+
+		if mutate != nil {
+			mutate(target)
+		}
+
+		return target
+	}
+
+	tests := []struct {
+		name       string
+		target     *EtcdS3Target
+		denyWrites bool
+		expected   EtcdSnapshotTargetVerification
+		expectErr  error
+		requests   int
+	}{
+		{
+			name:     "skips the verification when only local snapshots are configured",
+			target:   nil,
+			expected: EtcdSnapshotTargetSkipped,
+			requests: 0,
+		},
+		{
+			name:     "does not verify the target when the nodes use IAM authentication",
+			target:   target(func(t *EtcdS3Target) { t.AccessKeyID, t.SecretAccessKey = "", "" }),
+			expected: EtcdSnapshotTargetUnverified,
+			requests: 0,
+		},
+		{
+			name:     "checks the bucket, writes and deletes a test object",
+			target:   target(nil),
+			expected: EtcdSnapshotTargetVerified,
+			requests: 3,
+		},
+		{
+			name:     "signs the requests for the region of the bucket when no region is configured",
+			target:   target(func(t *EtcdS3Target) { t.Region = "" }),
+			expected: EtcdSnapshotTargetVerified,
+			requests: 4,
+		},
+		{
+			name:      "does not override the configured region",
+			target:    target(func(t *EtcdS3Target) { t.Region = "us-west-2" }),
+			expected:  EtcdSnapshotTargetUnverified,
+			expectErr: errors.New("S3 responded 301 Moved Permanently"),
+			requests:  1,
+		},
+		{
+			name:      "reports rejected credentials",
+			target:    target(func(t *EtcdS3Target) { t.AccessKeyID = "wrong-key" }),
+			expectErr: ErrEtcdSnapshotTargetUnauthorized,
+			requests:  1,
+		},
+		{
+			name:       "reports a denied write",
+			target:     target(nil),
+			denyWrites: true,
+			expectErr:  ErrEtcdSnapshotTargetUnauthorized,
+			requests:   2,
+		},
+		{
+			name:      "reports a missing bucket",
+			target:    target(func(t *EtcdS3Target) { t.Bucket = "missing" }),
+			expectErr: ErrEtcdSnapshotBucketNotFound,
+			requests:  1,
+		},
+		{
+			name:      "reports an unreachable endpoint",
+			target:    target(func(t *EtcdS3Target) { t.Endpoint = "127.0.0.1:1" }),
+			expectErr: ErrEtcdSnapshotTargetUnreachable,
+			requests:  0,
+		},
+		{
+			name:      "reports an untrusted endpoint as unreachable",
+			target:    target(func(t *EtcdS3Target) { t.CACert = nil }),
+			expectErr: ErrEtcdSnapshotTargetUnreachable,
+			requests:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			s3.lock.Lock()
+			s3.denyWrites, s3.requests = tt.denyWrites, nil
+			s3.lock.Unlock()
+
+			verification, err := (&Workload{}).VerifyEtcdSnapshotTarget(context.Background(), tt.target)
+			if tt.expectErr != nil {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.expectErr.Error())))
+				g.Expect(verification).To(Equal(EtcdSnapshotTargetUnverified))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(verification).To(Equal(tt.expected))
+			}
+
+			g.Expect(s3.requests).To(HaveLen(tt.requests))
+
+			if tt.expected == EtcdSnapshotTargetVerified {
+				requests := s3.requests[len(s3.requests)-3:]
+				g.Expect(requests[0]).To(Equal("HEAD /snapshots"))
+				g.Expect(requests[1]).To(HavePrefix("PUT /snapshots/cluster-a/.capi-rke2-verify-"))
+				g.Expect(requests[2]).To(Equal(strings.Replace(requests[1], "PUT", "DELETE", 1)))
+			}
+		})
+	}
+}
+
+func TestGetEtcdS3Target(t *testing.T) {
+	g := NewWithT(t)
+
+	rcp := &controlplanev1.RKE2ControlPlane{ObjectMeta: metav1.ObjectMeta{Namespace: "default"}}
+
+	target, err := GetEtcdS3Target(context.Background(), fake.NewClientBuilder().Build(), rcp)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(target).To(BeNil())
+
+	rcp.Spec.ServerConfig.Etcd.BackupConfig.S3 = &controlplanev1.EtcdS3{
+		Endpoint:           "minio.example.com:9000",
+		Bucket:             "snapshots",
+		EnforceSSLVerify:   true,
+		S3CredentialSecret: &corev1.ObjectReference{Namespace: "default", Name: "s3-credentials"},
+		EndpointCASecret:   &corev1.ObjectReference{Namespace: "default", Name: "s3-ca"},
+	}
+
+	cl := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "s3-credentials"},
+			Data: map[string][]byte{
+				"aws_access_key_id":     []byte("access-key"),
+				"aws_secret_access_key": []byte("secret-key"),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "s3-ca"},
+			Data:       map[string][]byte{"ca.pem": []byte("ca")},
+		},
+	).Build()
+
+	target, err = GetEtcdS3Target(context.Background(), cl, rcp)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(target).To(Equal(&EtcdS3Target{
+		Endpoint:        "minio.example.com:9000",
+		Bucket:          "snapshots",
+		AccessKeyID:     "access-key",
+		SecretAccessKey: "secret-key",
+		CACert:          []byte("ca"),
+	}))
+}
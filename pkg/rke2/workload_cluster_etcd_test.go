@@ -24,6 +24,8 @@ import (
 
 	"github.com/blang/semver/v4"
 	. "github.com/onsi/gomega"
+	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
 	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
 	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
@@ -294,9 +296,11 @@ func TestForwardEtcdLeadership(t *testing.T) {
 		tests := []struct {
 			name               string
 			leaderCandidate    *clusterv1.Machine
+			alarms             []*pb.AlarmMember
 			etcdMoveErr        error
 			expectedMoveLeader uint64
 			expectErr          bool
+			expectedErr        error
 		}{
 			{
 				name: "it moves the etcd leadership to the leader candidate",
@@ -314,11 +318,40 @@ func TestForwardEtcdLeadership(t *testing.T) {
 				expectErr:   true,
 			},
 			{
-				name: "returns error if the leader candidate doesn't exist in etcd",
+				name: "moves the etcd leadership to a healthy peer if the leader candidate doesn't exist in etcd",
 				leaderCandidate: defaultMachine(func(m *clusterv1.Machine) {
 					m.Status.NodeRef.Name = "some other node"
 				}),
-				expectErr: true,
+				expectedMoveLeader: 1034,
+			},
+			{
+				name: "moves the etcd leadership to a healthy peer if the leader candidate has alarms",
+				leaderCandidate: defaultMachine(func(m *clusterv1.Machine) {
+					m.Status.NodeRef.Name = "candidate-node"
+				}),
+				alarms: []*pb.AlarmMember{
+					{MemberID: uint64(12345), Alarm: pb.AlarmType_NOSPACE},
+				},
+				expectedMoveLeader: 1034,
+			},
+			{
+				name: "does not move the etcd leadership to itself",
+				leaderCandidate: defaultMachine(func(m *clusterv1.Machine) {
+					m.Status.NodeRef.Name = "current-leader"
+				}),
+				expectedMoveLeader: 1034,
+			},
+			{
+				name: "returns error if no healthy peer exists",
+				leaderCandidate: defaultMachine(func(m *clusterv1.Machine) {
+					m.Status.NodeRef.Name = "candidate-node"
+				}),
+				alarms: []*pb.AlarmMember{
+					{MemberID: uint64(1034), Alarm: pb.AlarmType_CORRUPT},
+					{MemberID: uint64(12345), Alarm: pb.AlarmType_NOSPACE},
+				},
+				expectErr:   true,
+				expectedErr: ErrNoHealthyEtcdLeaderCandidate,
 			},
 		}
 
@@ -338,7 +371,7 @@ func TestForwardEtcdLeadership(t *testing.T) {
 						},
 					},
 					AlarmResponse: &clientv3.AlarmResponse{
-						Alarms: []*pb.AlarmMember{},
+						Alarms: append([]*pb.AlarmMember{}, tt.alarms...),
 					},
 				}
 
@@ -359,6 +392,9 @@ func TestForwardEtcdLeadership(t *testing.T) {
 				err := w.ForwardEtcdLeadership(ctx, currentLeader, tt.leaderCandidate)
 				if tt.expectErr {
 					g.Expect(err).To(HaveOccurred())
+					if tt.expectedErr != nil {
+						g.Expect(errors.Is(err, tt.expectedErr)).To(BeTrue())
+					}
 					return
 				}
 				g.Expect(err).ToNot(HaveOccurred())
@@ -595,3 +631,609 @@ func nodeNamed(name string) corev1.Node {
 	}
 	return node
 }
+
+func TestUpdateEtcdMembersStatus(t *testing.T) {
+	leaderClient := &etcd.Client{
+		LeaderID: 1,
+		EtcdClient: &etcdfake.FakeEtcdClient{
+			MemberListResponse: &clientv3.MemberListResponse{
+				Members: []*pb.Member{
+					{ID: 1, Name: "cp1-a1b2", PeerURLs: []string{"https://10.0.0.1:2380"}, ClientURLs: []string{"https://10.0.0.1:2379"}},
+					{ID: 26, Name: "cp2-c3d4", PeerURLs: []string{"https://10.0.0.2:2380"}, ClientURLs: []string{"https://10.0.0.2:2379"}},
+					{ID: 3, PeerURLs: []string{"https://10.0.0.3:2380"}, IsLearner: true},
+				},
+			},
+			AlarmResponse: &clientv3.AlarmResponse{},
+		},
+	}
+	nodes := map[string]*corev1.Node{
+		"cp1": {ObjectMeta: metav1.ObjectMeta{Name: "cp1"}},
+		"cp2": {ObjectMeta: metav1.ObjectMeta{Name: "cp2"}},
+	}
+	previous := &controlplanev1.EtcdStatus{
+		Members: map[string]controlplanev1.EtcdMemberStatus{
+			"cp2-c3d4": {ID: "1a", PeerURL: "https://10.0.0.20:2380", IsLeader: true},
+			"removed":  {ID: "ff"},
+		},
+	}
+
+	tests := []struct {
+		name                string
+		previous            *controlplanev1.EtcdStatus
+		etcdClientGenerator etcd.ClientFor
+		expected            *controlplanev1.EtcdStatus
+	}{
+		{
+			name:     "maps reachable members into the status",
+			previous: previous,
+			etcdClientGenerator: &fakeEtcdClientGenerator{
+				forLeaderClient: leaderClient,
+				forNodesClient:  &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{}},
+			},
+			expected: &controlplanev1.EtcdStatus{
+				Members: map[string]controlplanev1.EtcdMemberStatus{
+					"cp1-a1b2": {ID: "1", PeerURL: "https://10.0.0.1:2380", ClientURL: "https://10.0.0.1:2379", IsLeader: true},
+					"cp2-c3d4": {ID: "1a", PeerURL: "https://10.0.0.2:2380", ClientURL: "https://10.0.0.2:2379"},
+					"3":        {ID: "3", PeerURL: "https://10.0.0.3:2380", IsLearner: true, Stale: true},
+				},
+			},
+		},
+		{
+			name:     "keeps the last known details of unreachable members",
+			previous: previous,
+			etcdClientGenerator: &fakeEtcdClientGenerator{
+				forLeaderClient: leaderClient,
+				forNodesClientFunc: func(n []string) (*etcd.Client, error) {
+					if n[0] == "cp2" {
+						return nil, errors.New("connection refused")
+					}
+
+					return &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{}}, nil
+				},
+			},
+			expected: &controlplanev1.EtcdStatus{
+				Members: map[string]controlplanev1.EtcdMemberStatus{
+					"cp1-a1b2": {ID: "1", PeerURL: "https://10.0.0.1:2380", ClientURL: "https://10.0.0.1:2379", IsLeader: true},
+					"cp2-c3d4": {ID: "1a", PeerURL: "https://10.0.0.20:2380", IsLeader: true, Stale: true},
+					"3":        {ID: "3", PeerURL: "https://10.0.0.3:2380", IsLearner: true, Stale: true},
+				},
+			},
+		},
+		{
+			name:     "flags all members as stale when etcd can't be reached",
+			previous: previous,
+			etcdClientGenerator: &fakeEtcdClientGenerator{
+				forLeaderErr: errors.New("no leader"),
+			},
+			expected: &controlplanev1.EtcdStatus{
+				Members: map[string]controlplanev1.EtcdMemberStatus{
+					"cp2-c3d4": {ID: "1a", PeerURL: "https://10.0.0.20:2380", IsLeader: true, Stale: true},
+					"removed":  {ID: "ff", Stale: true},
+				},
+			},
+		},
+		{
+			name: "reports nothing when etcd can't be reached and no members are known",
+			etcdClientGenerator: &fakeEtcdClientGenerator{
+				forLeaderErr: errors.New("no leader"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			w := &Workload{
+				Nodes:               nodes,
+				etcdClientGenerator: tt.etcdClientGenerator,
+			}
+			cp := &ControlPlane{
+				RCP: &controlplanev1.RKE2ControlPlane{
+					Status: controlplanev1.RKE2ControlPlaneStatus{Etcd: tt.previous.DeepCopy()},
+				},
+			}
+
+			w.UpdateEtcdMembersStatus(context.TODO(), cp)
+			g.Expect(cp.RCP.Status.Etcd).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestExternalEtcdOperationsNotSupported(t *testing.T) {
+	g := NewWithT(t)
+
+	machine := &clusterv1.Machine{
+		Status: clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "cp1"}},
+	}
+	leaderCandidate := &clusterv1.Machine{
+		Status: clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "cp2"}},
+	}
+
+	external := etcd.NewExternalClientGenerator([]string{"https://etcd-0:2379"}, nil, 0, 0)
+	w := &Workload{
+		Client:              fake.NewClientBuilder().Build(),
+		etcdClientGenerator: external,
+		externalEtcd:        external,
+	}
+
+	err := w.RemoveEtcdMemberForMachine(context.Background(), machine)
+	g.Expect(errors.Is(err, ErrNotSupportedWithExternalEtcd)).To(BeTrue())
+
+	err = w.ForwardEtcdLeadership(context.Background(), machine, leaderCandidate)
+	g.Expect(errors.Is(err, ErrNotSupportedWithExternalEtcd)).To(BeTrue())
+
+	_, err = w.ReconcileEtcdMembers(context.Background(), []string{"cp1"}, semver.MustParse("1.31.1"))
+	g.Expect(errors.Is(err, ErrNotSupportedWithExternalEtcd)).To(BeTrue())
+}
+
+func TestClearEtcdAlarms(t *testing.T) {
+	tests := []struct {
+		name            string
+		dbSize          int64
+		opts            ClearEtcdAlarmsOptions
+		expectedCleared []etcd.MemberAlarm
+		expectedErr     error
+	}{
+		{
+			name:   "clears only the NOSPACE alarm by default",
+			dbSize: etcd.DefaultQuotaBackendBytes / 2,
+			expectedCleared: []etcd.MemberAlarm{
+				{MemberID: 1, Type: etcd.AlarmNoSpace},
+			},
+		},
+		{
+			name:   "clears the CORRUPT alarm when selected",
+			dbSize: etcd.DefaultQuotaBackendBytes / 2,
+			opts:   ClearEtcdAlarmsOptions{AlarmTypes: []etcd.AlarmType{etcd.AlarmNoSpace, etcd.AlarmCorrupt}},
+			expectedCleared: []etcd.MemberAlarm{
+				{MemberID: 1, Type: etcd.AlarmNoSpace},
+				{MemberID: 2, Type: etcd.AlarmCorrupt},
+			},
+		},
+		{
+			name:   "clears only the CORRUPT alarm when selected alone",
+			dbSize: etcd.DefaultQuotaBackendBytes / 2,
+			opts:   ClearEtcdAlarmsOptions{AlarmTypes: []etcd.AlarmType{etcd.AlarmCorrupt}},
+			expectedCleared: []etcd.MemberAlarm{
+				{MemberID: 2, Type: etcd.AlarmCorrupt},
+			},
+		},
+		{
+			name:            "keeps the NOSPACE alarm when the database is still over quota",
+			dbSize:          etcd.DefaultQuotaBackendBytes,
+			expectedCleared: []etcd.MemberAlarm{},
+			expectedErr:     ErrEtcdOverQuota,
+		},
+		{
+			name:            "keeps the NOSPACE alarm when the database is over the configured quota",
+			dbSize:          etcd.DefaultQuotaBackendBytes / 2,
+			opts:            ClearEtcdAlarmsOptions{QuotaBackendBytes: etcd.DefaultQuotaBackendBytes / 4},
+			expectedCleared: []etcd.MemberAlarm{},
+			expectedErr:     ErrEtcdOverQuota,
+		},
+		{
+			name:   "clears the NOSPACE alarm when the database is below the configured quota",
+			dbSize: etcd.DefaultQuotaBackendBytes,
+			opts:   ClearEtcdAlarmsOptions{QuotaBackendBytes: etcd.DefaultQuotaBackendBytes * 4},
+			expectedCleared: []etcd.MemberAlarm{
+				{MemberID: 1, Type: etcd.AlarmNoSpace},
+			},
+		},
+		{
+			name:   "clears the NOSPACE alarm of a database over quota when forced",
+			dbSize: etcd.DefaultQuotaBackendBytes,
+			opts:   ClearEtcdAlarmsOptions{Force: true},
+			expectedCleared: []etcd.MemberAlarm{
+				{MemberID: 1, Type: etcd.AlarmNoSpace},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			leaderEtcdClient := &etcdfake.FakeEtcdClient{
+				MemberListResponse: &clientv3.MemberListResponse{
+					Members: []*pb.Member{
+						{Name: "node-1", ID: uint64(1)},
+						{Name: "node-2", ID: uint64(2)},
+					},
+				},
+				AlarmResponse: &clientv3.AlarmResponse{
+					Alarms: []*pb.AlarmMember{
+						{MemberID: uint64(1), Alarm: pb.AlarmType_NOSPACE},
+						{MemberID: uint64(2), Alarm: pb.AlarmType_CORRUPT},
+					},
+				},
+			}
+			memberEtcdClient := &etcdfake.FakeEtcdClient{
+				StatusResponse: &clientv3.StatusResponse{DbSize: tt.dbSize},
+			}
+
+			w := &Workload{
+				Client: &fakeClient{list: &corev1.NodeList{
+					Items: []corev1.Node{nodeNamed("node-1"), nodeNamed("node-2")},
+				}},
+				etcdClientGenerator: &fakeEtcdClientGenerator{
+					forLeaderClient: &etcd.Client{EtcdClient: leaderEtcdClient},
+					forNodesClient:  &etcd.Client{EtcdClient: memberEtcdClient},
+				},
+			}
+
+			cleared, err := w.ClearEtcdAlarms(context.Background(), tt.opts)
+			if tt.expectedErr != nil {
+				g.Expect(errors.Is(err, tt.expectedErr)).To(BeTrue())
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			g.Expect(cleared).To(Equal(tt.expectedCleared))
+			g.Expect(leaderEtcdClient.DisarmedAlarms).To(HaveLen(len(tt.expectedCleared)))
+		})
+	}
+
+	t.Run("does nothing for clusters without etcd certificates", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cleared, err := (&Workload{}).ClearEtcdAlarms(context.Background(), ClearEtcdAlarmsOptions{})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cleared).To(BeEmpty())
+	})
+}
+
+func TestEtcdLearnerStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	leaderEtcdClient := &etcdfake.FakeEtcdClient{
+		MemberListResponse: &clientv3.MemberListResponse{
+			Members: []*pb.Member{
+				{Name: "node-1-a1b2c3", ID: uint64(1)},
+				{Name: "node-2-d4e5f6", ID: uint64(2), IsLearner: true},
+				{ID: uint64(3), IsLearner: true},
+			},
+		},
+		AlarmResponse:  &clientv3.AlarmResponse{},
+		StatusResponse: &clientv3.StatusResponse{RaftIndex: 100},
+	}
+	learnerEtcdClient := &etcdfake.FakeEtcdClient{
+		StatusResponse: &clientv3.StatusResponse{RaftIndex: 40},
+	}
+
+	var dialedNodes []string
+
+	w := &Workload{
+		Client: &fakeClient{list: &corev1.NodeList{
+			Items: []corev1.Node{nodeNamed("node-1"), nodeNamed("node-2")},
+		}},
+		etcdClientGenerator: &fakeEtcdClientGenerator{
+			forLeaderClient: &etcd.Client{EtcdClient: leaderEtcdClient},
+			forNodesClientFunc: func(nodeNames []string) (*etcd.Client, error) {
+				dialedNodes = append(dialedNodes, nodeNames...)
+
+				return &etcd.Client{EtcdClient: learnerEtcdClient}, nil
+			},
+		},
+	}
+
+	statuses, err := w.EtcdLearnerStatus(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(statuses).To(Equal([]EtcdLearnerStatus{
+		{Name: "node-1-a1b2c3", ID: 1, IsPromoted: true},
+		{Name: "node-2-d4e5f6", ID: 2, RaftIndexLag: 60},
+		{ID: 3, RaftIndexLag: 100},
+	}))
+	g.Expect(dialedNodes).To(Equal([]string{"node-2"}))
+
+	// The learner caught up with the leader but is not promoted yet.
+	learnerEtcdClient.StatusResponse = &clientv3.StatusResponse{RaftIndex: 100}
+	leaderEtcdClient.MemberListResponse.Members = leaderEtcdClient.MemberListResponse.Members[:2]
+
+	statuses, err = w.EtcdLearnerStatus(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(statuses).To(ContainElement(EtcdLearnerStatus{Name: "node-2-d4e5f6", ID: 2}))
+
+	// The learner is promoted to a voting member.
+	leaderEtcdClient.MemberListResponse.Members[1].IsLearner = false
+
+	statuses, err = w.EtcdLearnerStatus(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(statuses).To(ContainElement(EtcdLearnerStatus{Name: "node-2-d4e5f6", ID: 2, IsPromoted: true}))
+
+	t.Run("does nothing for clusters without etcd certificates", func(t *testing.T) {
+		g := NewWithT(t)
+
+		statuses, err := (&Workload{}).EtcdLearnerStatus(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(statuses).To(BeEmpty())
+	})
+}
+
+func TestDetectOrphanedEtcdMembers(t *testing.T) {
+	nodeWithAddress := func(name, address string) corev1.Node {
+		node := nodeNamed(name)
+		node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: address}}
+
+		return node
+	}
+
+	t.Run("reports members without a corresponding node", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{
+			Client: &fakeClient{list: &corev1.NodeList{
+				Items: []corev1.Node{nodeWithAddress("node-1", "10.0.0.1"), nodeWithAddress("node-2", "10.0.0.2")},
+			}},
+			etcdClientGenerator: &fakeEtcdClientGenerator{
+				forLeaderClient: &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{
+					AlarmResponse: &clientv3.AlarmResponse{},
+					MemberListResponse: &clientv3.MemberListResponse{
+						Members: []*pb.Member{
+							{Name: "node-1-1a2b3c4d", ID: uint64(1), PeerURLs: []string{"https://10.0.0.1:2380"}},
+							{Name: "node-2-1a2b3c4d", ID: uint64(2), PeerURLs: []string{"https://10.0.0.2:2380"}},
+							// The node of this member no longer exists.
+							{Name: "node-3-1a2b3c4d", ID: uint64(3), PeerURLs: []string{"https://10.0.0.3:2380"}},
+							// This member was left behind by the previous node-2, which was replaced ungracefully.
+							{Name: "node-2-5e6f7a8b", ID: uint64(4), PeerURLs: []string{"https://10.0.0.4:2380"}},
+							// This member is still joining the cluster.
+							{ID: uint64(5), PeerURLs: []string{"https://10.0.0.5:2380"}, IsLearner: true},
+						},
+					},
+				}},
+			},
+		}
+
+		orphans, err := w.DetectOrphanedEtcdMembers(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(orphans).To(ConsistOf(uint64(3), uint64(4)))
+	})
+
+	t.Run("matches members by name when nodes don't report addresses", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{
+			Client: &fakeClient{list: &corev1.NodeList{Items: []corev1.Node{nodeNamed("node-1")}}},
+			etcdClientGenerator: &fakeEtcdClientGenerator{
+				forLeaderClient: &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{
+					AlarmResponse: &clientv3.AlarmResponse{},
+					MemberListResponse: &clientv3.MemberListResponse{
+						Members: []*pb.Member{
+							{Name: "node-1-1a2b3c4d", ID: uint64(1), PeerURLs: []string{"https://10.0.0.1:2380"}},
+						},
+					},
+				}},
+			},
+		}
+
+		orphans, err := w.DetectOrphanedEtcdMembers(context.Background())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(orphans).To(BeEmpty())
+	})
+
+	t.Run("is not supported with an external etcd", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := (&Workload{externalEtcd: &etcd.ExternalClientGenerator{}}).DetectOrphanedEtcdMembers(context.Background())
+		g.Expect(err).To(MatchError(ErrNotSupportedWithExternalEtcd))
+	})
+}
+
+func TestEtcdDBStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	quota := int64(1000)
+	dbSizes := map[string]int64{"node-1": 100, "node-2": 800, "node-3": 950}
+
+	leaderEtcdClient := &etcdfake.FakeEtcdClient{
+		AlarmResponse: &clientv3.AlarmResponse{},
+		MemberListResponse: &clientv3.MemberListResponse{
+			Members: []*pb.Member{
+				{Name: "node-1-a1b2c3", ID: uint64(1)},
+				{Name: "node-2-d4e5f6", ID: uint64(2)},
+				{Name: "node-3-a7b8c9", ID: uint64(3)},
+				{ID: uint64(4), IsLearner: true},
+			},
+		},
+	}
+
+	w := &Workload{
+		Client: &fakeClient{list: &corev1.NodeList{
+			Items: []corev1.Node{nodeNamed("node-1"), nodeNamed("node-2"), nodeNamed("node-3")},
+		}},
+		etcdClientGenerator: &fakeEtcdClientGenerator{
+			forLeaderClient: &etcd.Client{EtcdClient: leaderEtcdClient},
+			forNodesClientFunc: func(nodeNames []string) (*etcd.Client, error) {
+				return &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{
+					StatusResponse: &clientv3.StatusResponse{DbSize: dbSizes[nodeNames[0]], DbSizeInUse: dbSizes[nodeNames[0]] / 2},
+				}}, nil
+			},
+		},
+	}
+
+	statuses, err := w.EtcdDBStatus(context.Background(), quota)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(statuses).To(Equal([]EtcdMemberDBStatus{
+		{Name: "node-1-a1b2c3", ID: 1, DBSize: 100, DBSizeInUse: 50, Quota: quota, PercentFull: 10},
+		{Name: "node-2-d4e5f6", ID: 2, DBSize: 800, DBSizeInUse: 400, Quota: quota, PercentFull: 80},
+		{Name: "node-3-a7b8c9", ID: 3, DBSize: 950, DBSizeInUse: 475, Quota: quota, PercentFull: 95},
+	}))
+
+	t.Run("defaults to the etcd quota", func(t *testing.T) {
+		g := NewWithT(t)
+
+		statuses, err := w.EtcdDBStatus(context.Background(), 0)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(statuses).To(HaveLen(3))
+		g.Expect(statuses[0].Quota).To(Equal(etcd.DefaultQuotaBackendBytes))
+		g.Expect(statuses[0].PercentFull).To(BeZero())
+	})
+
+	t.Run("does nothing for clusters without etcd certificates", func(t *testing.T) {
+		g := NewWithT(t)
+
+		statuses, err := (&Workload{}).EtcdDBStatus(context.Background(), quota)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(statuses).To(BeEmpty())
+	})
+}
+
+func TestCompactEtcd(t *testing.T) {
+	workload := func(etcdClient *etcdfake.FakeEtcdClient) *Workload {
+		return &Workload{
+			Client: &fakeClient{list: &corev1.NodeList{Items: []corev1.Node{nodeNamed("node-1")}}},
+			etcdClientGenerator: &fakeEtcdClientGenerator{
+				forLeaderClient: &etcd.Client{EtcdClient: etcdClient},
+			},
+		}
+	}
+
+	revision := func(current int64) *clientv3.StatusResponse {
+		return &clientv3.StatusResponse{Header: &pb.ResponseHeader{Revision: current}}
+	}
+
+	t.Run("compacts the history up to the revisions to keep", func(t *testing.T) {
+		g := NewWithT(t)
+
+		etcdClient := &etcdfake.FakeEtcdClient{StatusResponse: revision(1000)}
+
+		compacted, err := workload(etcdClient).CompactEtcd(context.Background(), 100)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(compacted).To(Equal(int64(900)))
+		g.Expect(etcdClient.CompactedRevision).To(Equal(int64(900)))
+	})
+
+	t.Run("compacts the whole history without revisions to keep", func(t *testing.T) {
+		g := NewWithT(t)
+
+		etcdClient := &etcdfake.FakeEtcdClient{StatusResponse: revision(1000)}
+
+		compacted, err := workload(etcdClient).CompactEtcd(context.Background(), 0)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(compacted).To(Equal(int64(1000)))
+	})
+
+	t.Run("does not compact a history shorter than the revisions to keep", func(t *testing.T) {
+		g := NewWithT(t)
+
+		etcdClient := &etcdfake.FakeEtcdClient{StatusResponse: revision(50)}
+
+		compacted, err := workload(etcdClient).CompactEtcd(context.Background(), 100)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(compacted).To(BeZero())
+		g.Expect(etcdClient.CompactedRevision).To(BeZero())
+	})
+
+	t.Run("ignores a history already compacted at the revision", func(t *testing.T) {
+		g := NewWithT(t)
+
+		etcdClient := &etcdfake.FakeEtcdClient{StatusResponse: revision(1000), ErrorResponse: etcd.ErrCompacted}
+
+		compacted, err := workload(etcdClient).CompactEtcd(context.Background(), 100)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(compacted).To(BeZero())
+	})
+
+	t.Run("returns compaction errors", func(t *testing.T) {
+		g := NewWithT(t)
+
+		etcdClient := &etcdfake.FakeEtcdClient{StatusResponse: revision(1000), ErrorResponse: errors.New("request timed out")}
+
+		_, err := workload(etcdClient).CompactEtcd(context.Background(), 100)
+		g.Expect(err).To(MatchError(ContainSubstring("request timed out")))
+	})
+
+	t.Run("rejects a negative number of revisions to keep", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := workload(&etcdfake.FakeEtcdClient{StatusResponse: revision(1000)}).CompactEtcd(context.Background(), -1)
+		g.Expect(err).To(HaveOccurred())
+	})
+}
+
+func TestDefragmentEtcd(t *testing.T) {
+	const quota = int64(1000)
+
+	workload := func(dbSize int64) (*Workload, *etcdfake.FakeEtcdClient) {
+		memberEtcdClient := &etcdfake.FakeEtcdClient{
+			StatusResponse: &clientv3.StatusResponse{DbSize: dbSize},
+		}
+
+		return &Workload{
+			Client: &fakeClient{list: &corev1.NodeList{
+				Items: []corev1.Node{nodeNamed("node-1"), nodeNamed("node-2")},
+			}},
+			etcdClientGenerator: &fakeEtcdClientGenerator{
+				forLeaderClient: &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{
+					AlarmResponse: &clientv3.AlarmResponse{},
+					MemberListResponse: &clientv3.MemberListResponse{
+						Members: []*pb.Member{
+							{Name: "node-1-a1b2c3", ID: uint64(1)},
+							{Name: "node-2-d4e5f6", ID: uint64(2)},
+							{ID: uint64(3)},
+						},
+					},
+				}},
+				forNodesClient: &etcd.Client{EtcdClient: memberEtcdClient, Endpoint: "https://10.0.0.1:2379"},
+			},
+		}, memberEtcdClient
+	}
+
+	t.Run("defragments the started members near the quota", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w, memberEtcdClient := workload(900)
+
+		defragmented, err := w.DefragmentEtcd(context.Background(), quota)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(defragmented).To(Equal([]string{"node-1-a1b2c3", "node-2-d4e5f6"}))
+		g.Expect(memberEtcdClient.DefragmentedEndpoints).To(HaveLen(2))
+	})
+
+	t.Run("does not defragment members below the quota warning", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w, memberEtcdClient := workload(500)
+
+		defragmented, err := w.DefragmentEtcd(context.Background(), quota)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(defragmented).To(BeEmpty())
+		g.Expect(memberEtcdClient.DefragmentedEndpoints).To(BeEmpty())
+	})
+
+	t.Run("is rejected when the etcd maintenance operations are throttled", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w, memberEtcdClient := workload(900)
+		w.clusterKey = client.ObjectKey{Namespace: "default", Name: "cluster"}
+		w.etcdMaintenanceLimiter = NewEtcdMaintenanceRateLimiter(1)
+
+		_, err := w.DefragmentEtcd(context.Background(), quota)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = w.DefragmentEtcd(context.Background(), quota)
+		g.Expect(err).To(MatchError(ErrEtcdMaintenanceRateLimited))
+		g.Expect(memberEtcdClient.DefragmentedEndpoints).To(HaveLen(2))
+	})
+
+	t.Run("does nothing for clusters without etcd certificates", func(t *testing.T) {
+		g := NewWithT(t)
+
+		defragmented, err := (&Workload{}).DefragmentEtcd(context.Background(), quota)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(defragmented).To(BeEmpty())
+	})
+}
+
+func TestEtcdQuotaBackendBytes(t *testing.T) {
+	g := NewWithT(t)
+
+	rcp := &controlplanev1.RKE2ControlPlane{}
+	g.Expect(EtcdQuotaBackendBytes(rcp)).To(Equal(etcd.DefaultQuotaBackendBytes))
+
+	rcp.Spec.ServerConfig.Etcd.CustomConfig = &bootstrapv1.ComponentConfig{ExtraArgs: []string{"quota-backend-bytes=8589934592"}}
+	g.Expect(EtcdQuotaBackendBytes(rcp)).To(Equal(int64(8589934592)))
+
+	rcp.Spec.ServerConfig.Etcd.CustomConfig.ExtraArgs = []string{"quota-backend-bytes=invalid"}
+	g.Expect(EtcdQuotaBackendBytes(rcp)).To(Equal(etcd.DefaultQuotaBackendBytes))
+}
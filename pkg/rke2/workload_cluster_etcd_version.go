@@ -0,0 +1,245 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	etcdutil "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/util"
+)
+
+// ErrEtcdVersionMismatch is returned by CheckEtcdVersion while some etcd members don't report the expected version.
+var ErrEtcdVersionMismatch = errors.New("etcd members don't report the expected version")
+
+// rke2EtcdVersions maps the RKE2 minor releases to the etcd minor version they embed, ordered by RKE2 release: an
+// RKE2 release embeds the etcd version of the last entry which is not newer than its own minor release.
+var rke2EtcdVersions = []struct {
+	rke2 semver.Version
+	etcd string
+}{
+	{rke2: semver.MustParse("1.18.0"), etcd: "3.4"},
+	{rke2: semver.MustParse("1.22.0"), etcd: "3.5"},
+	{rke2: semver.MustParse("1.34.0"), etcd: "3.6"},
+}
+
+// rke2EtcdVersionsLastRelease is the last RKE2 minor release known to embed the etcd version of the last entry of
+// rke2EtcdVersions. Newer releases are not mapped, as they may embed a newer etcd version than this table knows of.
+var rke2EtcdVersionsLastRelease = semver.MustParse("1.35.0")
+
+// EtcdVersionForRKE2Version returns the etcd minor version, e.g. "3.5", embedded in the given RKE2 version, or false if
+// the RKE2 version can't be parsed, predates the known releases or is newer than rke2EtcdVersionsLastRelease. Only the
+// minor versions are mapped, as the etcd patch version changes between the patch releases of RKE2, and etcd members
+// only need to agree on the minor version.
+func EtcdVersionForRKE2Version(rke2Version string) (string, bool) {
+	version, err := semver.ParseTolerant(rke2Version)
+	if err != nil {
+		return "", false
+	}
+
+	minor := semver.Version{Major: version.Major, Minor: version.Minor}
+	if minor.GT(rke2EtcdVersionsLastRelease) {
+		return "", false
+	}
+
+	etcdVersion := ""
+
+	for _, release := range rke2EtcdVersions {
+		if minor.LT(release.rke2) {
+			break
+		}
+
+		etcdVersion = release.etcd
+	}
+
+	return etcdVersion, etcdVersion != ""
+}
+
+// EtcdMemberVersion is the etcd server version reported by an etcd member.
+type EtcdMemberVersion struct {
+	// Name is the name of the etcd member, empty if the member has not started yet.
+	Name string
+
+	// ID is the ID of the etcd member.
+	ID uint64
+
+	// Version is the etcd server version reported by the member, e.g. "3.5.16", empty if it is unknown.
+	Version string
+}
+
+// EtcdVersions returns the etcd server version reported by each etcd member through the etcd status API.
+// Members which have not started yet or can't be reached are returned with an empty version, the latter are also
+// reported in the returned error.
+func (w *Workload) EtcdVersions(ctx context.Context) ([]EtcdMemberVersion, error) {
+	// Return early for clusters without an etcd certificate secret
+	if w.etcdClientGenerator == nil {
+		return nil, nil
+	}
+
+	nodeNames, err := w.etcdNodeNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForLeader(ctx, nodeNames)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	versions := make([]EtcdMemberVersion, 0, len(members))
+	errs := []error{}
+
+	for _, member := range members {
+		version := EtcdMemberVersion{Name: member.Name, ID: member.ID}
+
+		if member.Name != "" {
+			version.Version, err = w.etcdMemberVersion(ctx, member)
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "failed to get the version of etcd member %s", member.Name))
+			}
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, kerrors.NewAggregate(errs)
+}
+
+func (w *Workload) etcdMemberVersion(ctx context.Context, member *etcd.Member) (string, error) {
+	memberClient, err := w.etcdMemberClient(ctx, member)
+	if err != nil {
+		return "", err
+	}
+	defer memberClient.Close()
+
+	return memberClient.Version(ctx)
+}
+
+// EtcdVersionMismatches returns the etcd members whose version differs from the expected one, described as
+// "<name>=<version>". Versions are compared as semantic versions, with or without a "v" prefix, and only on the minor
+// version when the expected version has no patch version, e.g. "3.5". Members with an unknown version are reported as
+// they can't be confirmed to run the expected version.
+func EtcdVersionMismatches(versions []EtcdMemberVersion, expected string) []string {
+	expectedVersion, expectedErr := semver.ParseTolerant(expected)
+	minorOnly := strings.Count(strings.TrimPrefix(strings.TrimSpace(expected), "v"), ".") == 1
+	mismatches := []string{}
+
+	for _, member := range versions {
+		version, err := semver.ParseTolerant(member.Version)
+		if minorOnly {
+			version = semver.Version{Major: version.Major, Minor: version.Minor}
+		}
+
+		if expectedErr == nil && err == nil && version.EQ(expectedVersion) {
+			continue
+		}
+
+		name := member.Name
+		if name == "" {
+			name = fmt.Sprintf("%x", member.ID)
+		}
+
+		reported := member.Version
+		if reported == "" {
+			reported = "unknown"
+		}
+
+		mismatches = append(mismatches, name+"="+reported)
+	}
+
+	return mismatches
+}
+
+// CheckEtcdVersion returns an error wrapping ErrEtcdVersionMismatch until all etcd members of the workload cluster
+// report the expected etcd version, e.g. the version embedded in the RKE2 release the control plane is upgraded to.
+// Callers are expected to requeue rather than progress the rollout on this error, so the etcd cluster does not
+// linger with mixed versions. Workload clusters without etcd certificates are not checked.
+func CheckEtcdVersion(ctx context.Context, workloadCluster WorkloadCluster, expected string) error {
+	versions, err := workloadCluster.EtcdVersions(ctx)
+	if err != nil && len(versions) == 0 {
+		return errors.Wrap(err, "failed to get etcd versions")
+	}
+
+	if mismatches := EtcdVersionMismatches(versions, expected); len(mismatches) > 0 {
+		return errors.Wrapf(ErrEtcdVersionMismatch, "expected etcd version %s, got %s", expected, strings.Join(mismatches, ", "))
+	}
+
+	return nil
+}
+
+// CheckMachinesEtcdVersion returns an error wrapping ErrEtcdVersionMismatch while the etcd member of a control plane
+// machine does not report the etcd version embedded in the RKE2 version of the machine, e.g. while the member of an
+// upgraded machine still runs the etcd of the previous RKE2 release. Unlike CheckEtcdVersion it holds while a rollout
+// mixes RKE2 versions, so callers can block the rollout progression on it. Members of machines whose RKE2 version is
+// not mapped to an etcd version, and members which can't be associated with a machine, are not checked. Members
+// reporting a newer etcd version than expected are not reported either, as waiting would never resolve the mismatch,
+// e.g. when an RKE2 patch release embeds a newer etcd minor version than rke2EtcdVersions knows of.
+func CheckMachinesEtcdVersion(ctx context.Context, workloadCluster WorkloadCluster, machines collections.Machines) error {
+	versions, err := workloadCluster.EtcdVersions(ctx)
+	if err != nil && len(versions) == 0 {
+		return errors.Wrap(err, "failed to get etcd versions")
+	}
+
+	expectedByNode := map[string]string{}
+
+	for _, machine := range machines {
+		if machine.Status.NodeRef == nil || machine.Spec.Version == nil {
+			continue
+		}
+
+		if expected, ok := EtcdVersionForRKE2Version(*machine.Spec.Version); ok {
+			expectedByNode[machine.Status.NodeRef.Name] = expected
+		}
+	}
+
+	mismatches := []string{}
+
+	for _, version := range versions {
+		expected, ok := expectedByNode[etcdutil.NodeNameFromMember(&etcd.Member{Name: version.Name})]
+		if version.Name == "" || !ok {
+			continue
+		}
+
+		if reported, err := semver.ParseTolerant(version.Version); err == nil && reported.GT(semver.MustParse(expected+".0")) {
+			continue
+		}
+
+		for _, mismatch := range EtcdVersionMismatches([]EtcdMemberVersion{version}, expected) {
+			mismatches = append(mismatches, mismatch+" (expected "+expected+")")
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return errors.Wrapf(ErrEtcdVersionMismatch, "etcd members don't run the etcd version of their RKE2 version: %s",
+			strings.Join(mismatches, ", "))
+	}
+
+	return nil
+}
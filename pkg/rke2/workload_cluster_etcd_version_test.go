@@ -0,0 +1,160 @@
+package rke2
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	etcdfake "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/fake"
+)
+
+func TestEtcdVersions(t *testing.T) {
+	g := NewWithT(t)
+
+	memberVersions := map[string]string{
+		"node-1": "3.5.16",
+		"node-2": "3.5.16",
+		"node-3": "3.5.13",
+	}
+
+	leaderEtcdClient := &etcdfake.FakeEtcdClient{
+		MemberListResponse: &clientv3.MemberListResponse{
+			Members: []*pb.Member{
+				{Name: "node-1-1a2b3c4d", ID: uint64(1)},
+				{Name: "node-2-1a2b3c4d", ID: uint64(2)},
+				{Name: "node-3-1a2b3c4d", ID: uint64(3)},
+				// This member is still joining the cluster.
+				{ID: uint64(4), IsLearner: true},
+			},
+		},
+		AlarmResponse: &clientv3.AlarmResponse{},
+	}
+
+	w := &Workload{
+		Client: &fakeClient{list: &corev1.NodeList{
+			Items: []corev1.Node{nodeNamed("node-1"), nodeNamed("node-2"), nodeNamed("node-3")},
+		}},
+		etcdClientGenerator: &fakeEtcdClientGenerator{
+			forLeaderClient: &etcd.Client{EtcdClient: leaderEtcdClient},
+			forNodesClientFunc: func(nodeNames []string) (*etcd.Client, error) {
+				return &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{
+					StatusResponse: &clientv3.StatusResponse{Version: memberVersions[nodeNames[0]]},
+				}}, nil
+			},
+		},
+	}
+
+	versions, err := w.EtcdVersions(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(versions).To(Equal([]EtcdMemberVersion{
+		{Name: "node-1-1a2b3c4d", ID: 1, Version: "3.5.16"},
+		{Name: "node-2-1a2b3c4d", ID: 2, Version: "3.5.16"},
+		{Name: "node-3-1a2b3c4d", ID: 3, Version: "3.5.13"},
+		{ID: 4},
+	}))
+
+	g.Expect(EtcdVersionMismatches(versions, "v3.5.16")).To(Equal([]string{"node-3-1a2b3c4d=3.5.13", "4=unknown"}))
+
+	err = CheckEtcdVersion(context.Background(), w, "v3.5.16")
+	g.Expect(err).To(MatchError(ErrEtcdVersionMismatch))
+	g.Expect(err.Error()).To(ContainSubstring("node-3-1a2b3c4d=3.5.13"))
+
+	t.Run("passes once all members report the expected version", func(t *testing.T) {
+		g := NewWithT(t)
+
+		memberVersions["node-3"] = "3.5.16"
+		// The learner started and was promoted.
+		leaderEtcdClient.MemberListResponse.Members[3] = &pb.Member{Name: "node-4-1a2b3c4d", ID: uint64(4)}
+		memberVersions["node-4"] = "3.5.16"
+
+		g.Expect(CheckEtcdVersion(context.Background(), w, "3.5.16")).To(Succeed())
+	})
+}
+
+func TestEtcdVersionForRKE2Version(t *testing.T) {
+	g := NewWithT(t)
+
+	for rke2Version, expected := range map[string]string{
+		"v1.21.14+rke2r1": "3.4",
+		"v1.22.0+rke2r1":  "3.5",
+		"v1.31.4+rke2r1":  "3.5",
+		"v1.34.1+rke2r1":  "3.6",
+		"v1.35.0+rke2r1":  "3.6",
+	} {
+		etcdVersion, ok := EtcdVersionForRKE2Version(rke2Version)
+		g.Expect(ok).To(BeTrue(), rke2Version)
+		g.Expect(etcdVersion).To(Equal(expected), rke2Version)
+	}
+
+	_, ok := EtcdVersionForRKE2Version("v1.17.0+rke2r1")
+	g.Expect(ok).To(BeFalse())
+
+	_, ok = EtcdVersionForRKE2Version("not-a-version")
+	g.Expect(ok).To(BeFalse())
+
+	// Releases newer than the table are not mapped, they may embed a newer etcd version.
+	_, ok = EtcdVersionForRKE2Version("v1.36.0+rke2r1")
+	g.Expect(ok).To(BeFalse())
+}
+
+type etcdVersionsWorkloadCluster struct {
+	WorkloadCluster
+	versions []EtcdMemberVersion
+}
+
+func (w *etcdVersionsWorkloadCluster) EtcdVersions(_ context.Context) ([]EtcdMemberVersion, error) {
+	return w.versions, nil
+}
+
+func TestCheckMachinesEtcdVersion(t *testing.T) {
+	g := NewWithT(t)
+
+	machineWithVersion := func(name, version string) *clusterv1.Machine {
+		return &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       clusterv1.MachineSpec{Version: ptr.To(version)},
+			Status:     clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: name}},
+		}
+	}
+
+	// An upgrade from RKE2 v1.33 to v1.34 is in progress, the etcd members of the old machines run etcd 3.5.
+	machines := collections.FromMachines(
+		machineWithVersion("node-1", "v1.33.5+rke2r1"),
+		machineWithVersion("node-2", "v1.33.5+rke2r1"),
+		machineWithVersion("node-3", "v1.34.1+rke2r1"),
+	)
+
+	w := &etcdVersionsWorkloadCluster{versions: []EtcdMemberVersion{
+		{Name: "node-1-1a2b3c4d", ID: 1, Version: "3.5.21"},
+		{Name: "node-2-1a2b3c4d", ID: 2, Version: "3.5.21"},
+		{Name: "node-3-1a2b3c4d", ID: 3, Version: "3.5.21"},
+		// This member is still joining the cluster.
+		{ID: 4},
+	}}
+
+	err := CheckMachinesEtcdVersion(context.Background(), w, machines)
+	g.Expect(err).To(MatchError(ErrEtcdVersionMismatch))
+	g.Expect(err.Error()).To(ContainSubstring("node-3-1a2b3c4d=3.5.21 (expected 3.6)"))
+	g.Expect(err.Error()).NotTo(ContainSubstring("node-1"))
+
+	w.versions[2].Version = "3.6.4"
+	g.Expect(CheckMachinesEtcdVersion(context.Background(), w, machines)).To(Succeed())
+
+	// A member running a newer etcd version than expected does not block the rollout, waiting would not resolve it.
+	w.versions[2].Version = "3.7.0"
+	g.Expect(CheckMachinesEtcdVersion(context.Background(), w, machines)).To(Succeed())
+
+	// Neither does a machine whose RKE2 version is newer than the known releases.
+	machines.Insert(machineWithVersion("node-4", "v1.36.0+rke2r1"))
+	w.versions[3] = EtcdMemberVersion{Name: "node-4-1a2b3c4d", ID: 4, Version: "3.5.21"}
+	g.Expect(CheckMachinesEtcdVersion(context.Background(), w, machines)).To(Succeed())
+}
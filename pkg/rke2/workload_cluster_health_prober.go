@@ -0,0 +1,290 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// DefaultWorkloadClusterHealthProbeInterval is the default interval between two background health probes of a
+	// workload cluster.
+	DefaultWorkloadClusterHealthProbeInterval = 30 * time.Second
+
+	// DefaultWorkloadClusterHealthStaleness is the default age after which the health of a workload cluster is probed
+	// again rather than read from the cache.
+	DefaultWorkloadClusterHealthStaleness = 2 * DefaultWorkloadClusterHealthProbeInterval
+)
+
+// WorkloadClusterHealth is the health of a workload cluster, as probed at a given time.
+type WorkloadClusterHealth struct {
+	// Members are the control plane nodes joined with their machine and etcd member, reporting the node readiness and
+	// the etcd member health, as returned by WorkloadCluster.ListControlPlaneNodesWithEtcdMember.
+	Members []ControlPlaneNodeEtcdMember
+
+	// Err is the error which prevented the probe from completing, nil if it succeeded.
+	Err error
+
+	// ProbedAt is the time of the probe.
+	ProbedAt time.Time
+}
+
+// workloadClusterHealthProbe probes the health of a workload cluster.
+type workloadClusterHealthProbe func(ctx context.Context, clusterKey ctrlclient.ObjectKey) ([]ControlPlaneNodeEtcdMember, error)
+
+// WorkloadClusterHealthProber probes the health of the watched workload clusters in the background, and caches the
+// results so reconciles can read a fresh enough health without connecting to the workload cluster. It is safe for
+// concurrent use, and must outlive the workload clusters as they are built for every reconcile.
+type WorkloadClusterHealthProber struct {
+	interval  time.Duration
+	staleness time.Duration
+	now       func() time.Time
+
+	lock    sync.Mutex
+	health  map[ctrlclient.ObjectKey]WorkloadClusterHealth
+	watches map[ctrlclient.ObjectKey]*workloadClusterHealthWatch
+}
+
+// workloadClusterHealthWatch is the background probing of a watched workload cluster.
+type workloadClusterHealthWatch struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// refreshing is set while a stale health is probed again on behalf of a read.
+	refreshing bool
+}
+
+// NewWorkloadClusterHealthProber returns a prober probing each watched workload cluster every interval, whose results
+// are read from the cache as long as they are not older than staleness. The defaults are used for the durations which
+// are not positive.
+func NewWorkloadClusterHealthProber(interval, staleness time.Duration) *WorkloadClusterHealthProber {
+	if interval <= 0 {
+		interval = DefaultWorkloadClusterHealthProbeInterval
+	}
+
+	if staleness <= 0 {
+		staleness = DefaultWorkloadClusterHealthStaleness
+	}
+
+	return &WorkloadClusterHealthProber{
+		interval:  interval,
+		staleness: staleness,
+		now:       time.Now,
+		health:    map[ctrlclient.ObjectKey]WorkloadClusterHealth{},
+		watches:   map[ctrlclient.ObjectKey]*workloadClusterHealthWatch{},
+	}
+}
+
+// WatchWorkloadClusterHealth starts probing the health of the workload cluster in the background with the
+// WorkloadClusterHealthProber of the management cluster, until the context is done or the watch is stopped. The context
+// must thus outlive the reconcile, e.g. be the context of the manager. Watching a cluster which is already watched, or
+// watching without a WorkloadClusterHealthProber, does nothing. Clusters using an external etcd are not supported.
+func (m *Management) WatchWorkloadClusterHealth(ctx context.Context, clusterKey ctrlclient.ObjectKey) {
+	m.HealthProber.watch(ctx, clusterKey, m.probeWorkloadClusterHealth)
+}
+
+// StopWatchingWorkloadClusterHealth stops probing the health of the workload cluster in the background, and forgets
+// its cached health, e.g. when the cluster is deleted.
+func (m *Management) StopWatchingWorkloadClusterHealth(clusterKey ctrlclient.ObjectKey) {
+	m.HealthProber.stopWatching(clusterKey)
+}
+
+// WorkloadClusterHealth returns the health of the workload cluster cached by the WorkloadClusterHealthProber of the
+// management cluster. A stale health of a watched cluster is returned as is while it is probed again in the
+// background, the health is only probed synchronously when it has never been probed, or without a
+// WorkloadClusterHealthProber.
+func (m *Management) WorkloadClusterHealth(ctx context.Context, clusterKey ctrlclient.ObjectKey) WorkloadClusterHealth {
+	return m.HealthProber.get(ctx, clusterKey, m.probeWorkloadClusterHealth)
+}
+
+// probeWorkloadClusterHealth lists the control plane nodes of the workload cluster joined with their etcd member.
+func (m *Management) probeWorkloadClusterHealth(ctx context.Context, clusterKey ctrlclient.ObjectKey) ([]ControlPlaneNodeEtcdMember, error) {
+	machines, err := m.GetControlPlaneMachines(ctx, clusterKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get control plane machines")
+	}
+
+	workloadCluster, err := m.GetWorkloadCluster(ctx, clusterKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer workloadCluster.Close()
+
+	return workloadCluster.ListControlPlaneNodesWithEtcdMember(ctx, machines)
+}
+
+func (p *WorkloadClusterHealthProber) watch(ctx context.Context, clusterKey ctrlclient.ObjectKey, probe workloadClusterHealthProbe) {
+	if p == nil {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, found := p.watches[clusterKey]; found {
+		return
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	w := &workloadClusterHealthWatch{ctx: watchCtx, cancel: cancel}
+	p.watches[clusterKey] = w
+
+	go func() {
+		defer p.forget(clusterKey, w)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			p.probe(watchCtx, clusterKey, w, probe)
+
+			select {
+			case <-watchCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *WorkloadClusterHealthProber) stopWatching(clusterKey ctrlclient.ObjectKey) {
+	if p == nil {
+		return
+	}
+
+	p.lock.Lock()
+	w, found := p.watches[clusterKey]
+	p.lock.Unlock()
+
+	if found {
+		w.cancel()
+		p.forget(clusterKey, w)
+	}
+}
+
+func (p *WorkloadClusterHealthProber) get(
+	ctx context.Context,
+	clusterKey ctrlclient.ObjectKey,
+	probe workloadClusterHealthProbe,
+) WorkloadClusterHealth {
+	if p == nil {
+		members, err := probe(ctx, clusterKey)
+
+		return WorkloadClusterHealth{Members: members, Err: err, ProbedAt: time.Now()}
+	}
+
+	p.lock.Lock()
+	health, found := p.health[clusterKey]
+	w := p.watches[clusterKey]
+
+	if found && p.now().Sub(health.ProbedAt) <= p.staleness {
+		p.lock.Unlock()
+
+		return health
+	}
+
+	if found && w != nil {
+		if !w.refreshing {
+			w.refreshing = true
+
+			go func() {
+				p.probe(w.ctx, clusterKey, w, probe)
+
+				p.lock.Lock()
+				defer p.lock.Unlock()
+
+				w.refreshing = false
+			}()
+		}
+
+		p.lock.Unlock()
+
+		return health
+	}
+
+	p.lock.Unlock()
+
+	return p.probe(ctx, clusterKey, nil, probe)
+}
+
+// cached returns the cached health of a watched cluster, if it is fresh enough.
+func (p *WorkloadClusterHealthProber) cached(clusterKey ctrlclient.ObjectKey) (WorkloadClusterHealth, bool) {
+	if p == nil {
+		return WorkloadClusterHealth{}, false
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	health, found := p.health[clusterKey]
+	if _, watched := p.watches[clusterKey]; !found || !watched || p.now().Sub(health.ProbedAt) > p.staleness {
+		return WorkloadClusterHealth{}, false
+	}
+
+	return health, true
+}
+
+// probe probes the health of the cluster and caches it, unless it is probed by a watch which has been stopped since.
+func (p *WorkloadClusterHealthProber) probe(
+	ctx context.Context,
+	clusterKey ctrlclient.ObjectKey,
+	w *workloadClusterHealthWatch,
+	probe workloadClusterHealthProbe,
+) WorkloadClusterHealth {
+	probedAt := p.now()
+	members, err := probe(ctx, clusterKey)
+
+	if err != nil {
+		log.FromContext(ctx).V(4).Info("Failed to probe workload cluster health", "cluster", clusterKey, "error", err.Error())
+	}
+
+	health := WorkloadClusterHealth{Members: members, Err: err, ProbedAt: probedAt}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if w != nil && p.watches[clusterKey] != w {
+		return health
+	}
+
+	// A concurrent probe which started later wins.
+	if previous, found := p.health[clusterKey]; !found || !previous.ProbedAt.After(probedAt) {
+		p.health[clusterKey] = health
+	}
+
+	return health
+}
+
+// forget stops caching the health of a cluster which is no longer watched by the given watch. A newer watch of the
+// cluster is kept.
+func (p *WorkloadClusterHealthProber) forget(clusterKey ctrlclient.ObjectKey, w *workloadClusterHealthWatch) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.watches[clusterKey] != w {
+		return
+	}
+
+	delete(p.watches, clusterKey)
+	delete(p.health, clusterKey)
+}
@@ -0,0 +1,214 @@
+package rke2
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestWorkloadClusterHealthProber(t *testing.T) {
+	cluster := client.ObjectKey{Namespace: "default", Name: "cluster"}
+
+	t.Run("uses the cached health when fresh and probes again when stale", func(t *testing.T) {
+		g := NewWithT(t)
+
+		now := time.Now()
+		prober := NewWorkloadClusterHealthProber(time.Minute, 2*time.Minute)
+		prober.now = func() time.Time { return now }
+
+		probes := 0
+		probe := func(context.Context, client.ObjectKey) ([]ControlPlaneNodeEtcdMember, error) {
+			probes++
+
+			return []ControlPlaneNodeEtcdMember{{NodeName: "node-1", Healthy: probes == 1}}, nil
+		}
+
+		health := prober.get(context.Background(), cluster, probe)
+		g.Expect(probes).To(Equal(1))
+		g.Expect(health.Err).ToNot(HaveOccurred())
+		g.Expect(health.ProbedAt).To(Equal(now))
+		g.Expect(health.Members).To(Equal([]ControlPlaneNodeEtcdMember{{NodeName: "node-1", Healthy: true}}))
+
+		// The cached health is fresh enough.
+		now = now.Add(2 * time.Minute)
+
+		health = prober.get(context.Background(), cluster, probe)
+		g.Expect(probes).To(Equal(1))
+		g.Expect(health.Members[0].Healthy).To(BeTrue())
+
+		// The cached health is stale.
+		now = now.Add(time.Second)
+
+		health = prober.get(context.Background(), cluster, probe)
+		g.Expect(probes).To(Equal(2))
+		g.Expect(health.ProbedAt).To(Equal(now))
+		g.Expect(health.Members[0].Healthy).To(BeFalse())
+	})
+
+	t.Run("caches failed probes", func(t *testing.T) {
+		g := NewWithT(t)
+
+		prober := NewWorkloadClusterHealthProber(0, 0)
+		probe := func(context.Context, client.ObjectKey) ([]ControlPlaneNodeEtcdMember, error) {
+			return nil, errors.New("connection refused")
+		}
+
+		health := prober.get(context.Background(), cluster, probe)
+		g.Expect(health.Err).To(MatchError("connection refused"))
+
+		health = prober.get(context.Background(), cluster, func(context.Context, client.ObjectKey) ([]ControlPlaneNodeEtcdMember, error) {
+			return []ControlPlaneNodeEtcdMember{{NodeName: "node-1", Healthy: true}}, nil
+		})
+		g.Expect(health.Err).To(MatchError("connection refused"))
+	})
+
+	t.Run("probes the watched clusters in the background", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		prober := NewWorkloadClusterHealthProber(10*time.Millisecond, time.Hour)
+
+		probed := make(chan struct{}, 10)
+		probe := func(context.Context, client.ObjectKey) ([]ControlPlaneNodeEtcdMember, error) {
+			select {
+			case probed <- struct{}{}:
+			default:
+			}
+
+			return []ControlPlaneNodeEtcdMember{{NodeName: "node-1", Healthy: true}}, nil
+		}
+
+		prober.watch(ctx, cluster, probe)
+		prober.watch(ctx, cluster, probe)
+
+		g.Eventually(probed).Should(Receive())
+		g.Eventually(probed).Should(Receive())
+
+		// Reading the health does not probe the cluster again.
+		health := prober.get(ctx, cluster, func(context.Context, client.ObjectKey) ([]ControlPlaneNodeEtcdMember, error) {
+			return nil, errors.New("unexpected probe")
+		})
+		g.Expect(health.Err).ToNot(HaveOccurred())
+		g.Expect(health.Members).To(HaveLen(1))
+
+		// The cluster is forgotten once the watch stops.
+		cancel()
+
+		g.Eventually(func() bool {
+			prober.lock.Lock()
+			defer prober.lock.Unlock()
+
+			_, watched := prober.watches[cluster]
+
+			return watched
+		}).Should(BeFalse())
+	})
+
+	t.Run("refreshes the stale health of a watched cluster in the background", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var now atomic.Int64
+		now.Store(time.Now().UnixNano())
+
+		prober := NewWorkloadClusterHealthProber(time.Hour, time.Minute)
+		prober.now = func() time.Time { return time.Unix(0, now.Load()) }
+
+		probed := make(chan bool, 10)
+
+		var healthy atomic.Bool
+		healthy.Store(true)
+
+		probe := func(context.Context, client.ObjectKey) ([]ControlPlaneNodeEtcdMember, error) {
+			defer func() { probed <- true }()
+
+			return []ControlPlaneNodeEtcdMember{{NodeName: "node-1", Healthy: healthy.Load()}}, nil
+		}
+
+		prober.watch(context.Background(), cluster, probe)
+		defer prober.stopWatching(cluster)
+
+		g.Eventually(probed).Should(Receive())
+
+		now.Add(int64(2 * time.Minute))
+		healthy.Store(false)
+
+		// The stale health is returned without waiting for the probe.
+		health := prober.get(context.Background(), cluster, probe)
+		g.Expect(health.Members[0].Healthy).To(BeTrue())
+
+		_, fresh := prober.cached(cluster)
+		g.Expect(fresh).To(BeFalse())
+
+		g.Eventually(probed).Should(Receive())
+		g.Eventually(func() bool {
+			health, fresh := prober.cached(cluster)
+
+			return fresh && !health.Members[0].Healthy
+		}).Should(BeTrue())
+	})
+
+	t.Run("stops probing and forgets a cluster which is no longer watched", func(t *testing.T) {
+		g := NewWithT(t)
+
+		prober := NewWorkloadClusterHealthProber(10*time.Millisecond, time.Hour)
+
+		probed := make(chan struct{}, 10)
+		probe := func(context.Context, client.ObjectKey) ([]ControlPlaneNodeEtcdMember, error) {
+			select {
+			case probed <- struct{}{}:
+			default:
+			}
+
+			return []ControlPlaneNodeEtcdMember{{NodeName: "node-1", Healthy: true}}, nil
+		}
+
+		prober.watch(context.Background(), cluster, probe)
+		g.Eventually(probed).Should(Receive())
+
+		_, fresh := prober.cached(cluster)
+		g.Expect(fresh).To(BeTrue())
+
+		prober.stopWatching(cluster)
+
+		_, fresh = prober.cached(cluster)
+		g.Expect(fresh).To(BeFalse())
+
+		// Drain a probe which was in flight while stopping.
+		time.Sleep(50 * time.Millisecond)
+
+		for len(probed) > 0 {
+			<-probed
+		}
+
+		g.Consistently(probed, 100*time.Millisecond).ShouldNot(Receive())
+		prober.lock.Lock()
+		defer prober.lock.Unlock()
+
+		g.Expect(prober.health).To(BeEmpty())
+	})
+
+	t.Run("probes on every read without a prober", func(t *testing.T) {
+		g := NewWithT(t)
+
+		probes := 0
+		probe := func(context.Context, client.ObjectKey) ([]ControlPlaneNodeEtcdMember, error) {
+			probes++
+
+			return nil, nil
+		}
+
+		var prober *WorkloadClusterHealthProber
+
+		prober.watch(context.Background(), cluster, probe)
+		prober.get(context.Background(), cluster, probe)
+		prober.get(context.Background(), cluster, probe)
+		g.Expect(probes).To(Equal(2))
+	})
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+const (
+	// serverManifestsDirectory is the directory of the servers whose manifests are applied by RKE2.
+	serverManifestsDirectory = "/var/lib/rancher/rke2/server/manifests"
+
+	// kubeVIPNameLabel is the label identifying the kube-vip DaemonSet.
+	kubeVIPNameLabel = "app.kubernetes.io/name"
+
+	// deployAddonKind is the kind of the objects tracking the manifests of the server manifests directory applied by
+	// the RKE2 deploy controller.
+	deployAddonKind = "Addon"
+)
+
+// deployAddonGroupVersion is the group version of the Addons of the RKE2 deploy controller.
+var deployAddonGroupVersion = schema.GroupVersion{Group: "k3s.cattle.io", Version: "v1"}
+
+// kubeVIPNames are the values of the kubeVIPNameLabel of a kube-vip DaemonSet, the latter being the one of the
+// kube-vip documentation manifests.
+var kubeVIPNames = []string{"kube-vip", "kube-vip-ds"}
+
+// kubeVIPAddressEnvVars are the environment variables of the kube-vip container holding the VIP address, the latter
+// being the legacy name.
+var kubeVIPAddressEnvVars = []string{"address", "vip_address"}
+
+// KubeVIPManifest is the kube-vip DaemonSet declared in a manifest file of the RKE2ControlPlane.
+type KubeVIPManifest struct {
+	// Path is the path of the manifest file in the RKE2 server manifests directory.
+	Path string
+	// DaemonSet is the kube-vip DaemonSet declared in the manifest file.
+	DaemonSet *appsv1.DaemonSet
+}
+
+// GetKubeVIPManifest returns the kube-vip DaemonSet declared in a manifest file of the RKE2ControlPlane, written to
+// the RKE2 server manifests directory, or nil if kube-vip is not configured this way. Only files with an inline, not
+// encoded content are inspected, and a kube-vip DaemonSet is a DaemonSet labeled as kube-vip with a VIP address.
+func GetKubeVIPManifest(rcp *controlplanev1.RKE2ControlPlane) (*KubeVIPManifest, error) {
+	for _, file := range rcp.Spec.Files {
+		if path.Dir(file.Path) != serverManifestsDirectory || file.Content == "" || file.Encoding != "" {
+			continue
+		}
+
+		decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewBufferString(file.Content), 4096)
+
+		for {
+			obj := &unstructured.Unstructured{}
+			if err := decoder.Decode(&obj.Object); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				return nil, errors.Wrapf(err, "failed to decode manifest %s", file.Path)
+			}
+
+			if obj.Object == nil || obj.GroupVersionKind() != appsv1.SchemeGroupVersion.WithKind("DaemonSet") {
+				continue
+			}
+
+			daemonSet := &appsv1.DaemonSet{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, daemonSet); err != nil {
+				return nil, errors.Wrapf(err, "failed to convert DaemonSet %s of manifest %s", obj.GetName(), file.Path)
+			}
+
+			if !isKubeVIPDaemonSet(daemonSet) || kubeVIPAddress(daemonSet) == "" {
+				continue
+			}
+
+			if daemonSet.Namespace == "" {
+				daemonSet.Namespace = metav1.NamespaceSystem
+			}
+
+			return &KubeVIPManifest{Path: file.Path, DaemonSet: daemonSet}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// isKubeVIPDaemonSet returns true if the DaemonSet or its pod template is labeled as kube-vip.
+func isKubeVIPDaemonSet(daemonSet *appsv1.DaemonSet) bool {
+	return slices.Contains(kubeVIPNames, daemonSet.Labels[kubeVIPNameLabel]) ||
+		slices.Contains(kubeVIPNames, daemonSet.Spec.Template.Labels[kubeVIPNameLabel])
+}
+
+// kubeVIPAddress returns the VIP address of the containers of the DaemonSet, empty if it has none.
+func kubeVIPAddress(daemonSet *appsv1.DaemonSet) string {
+	for _, container := range daemonSet.Spec.Template.Spec.Containers {
+		for _, name := range kubeVIPAddressEnvVars {
+			for _, env := range container.Env {
+				if env.Name == name && env.Value != "" {
+					return env.Value
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// ReconcileControlPlaneVIP ensures the kube-vip DaemonSet of the workload cluster advertises the VIP address of the
+// kube-vip manifest configured in the RKE2ControlPlane. The DaemonSet is owned by the RKE2 deploy controller applying
+// the manifest, so it is never written here: if it is missing or its VIP address drifted, the deploy controller is
+// requested to apply the manifest again. The rest of the DaemonSet is not compared, as the servers apply their own
+// copy of the manifest. It does nothing if kube-vip is not configured in the RKE2ControlPlane, and returns true if the
+// manifest was requested to be applied again.
+func (w *Workload) ReconcileControlPlaneVIP(ctx context.Context, rcp *controlplanev1.RKE2ControlPlane) (bool, error) {
+	manifest, err := GetKubeVIPManifest(rcp)
+	if err != nil {
+		return false, err
+	}
+
+	if manifest == nil {
+		return false, nil
+	}
+
+	desiredAddress := kubeVIPAddress(manifest.DaemonSet)
+	key := ctrlclient.ObjectKeyFromObject(manifest.DaemonSet)
+	existing := &appsv1.DaemonSet{}
+
+	if err := w.Get(ctx, key, existing); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, errors.Wrapf(err, "failed to get kube-vip DaemonSet %s", key)
+		}
+
+		log.FromContext(ctx).Info("Reapplying the manifest of the missing kube-vip DaemonSet", "DaemonSet", key,
+			"manifest", manifest.Path, "address", desiredAddress)
+
+		return w.redeployServerManifest(ctx, manifest.Path)
+	}
+
+	if kubeVIPAddress(existing) == desiredAddress {
+		return false, nil
+	}
+
+	log.FromContext(ctx).Info("Reapplying the manifest of the kube-vip DaemonSet with a drifted VIP address",
+		"DaemonSet", key, "manifest", manifest.Path, "address", kubeVIPAddress(existing), "desiredAddress", desiredAddress)
+
+	return w.redeployServerManifest(ctx, manifest.Path)
+}
+
+// redeployServerManifest requests the RKE2 deploy controller to apply again a manifest file of the server manifests
+// directory, by clearing the checksum of the Addon tracking the file, named after the file without its extension: the
+// deploy controller only applies a manifest whose checksum differs from the one of its Addon. It returns false if the
+// manifest was not deployed yet, or if it is already pending to be applied again.
+func (w *Workload) redeployServerManifest(ctx context.Context, manifestPath string) (bool, error) {
+	name := strings.TrimSuffix(path.Base(manifestPath), path.Ext(manifestPath))
+	key := ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: name}
+
+	addon := &unstructured.Unstructured{}
+	addon.SetGroupVersionKind(deployAddonGroupVersion.WithKind(deployAddonKind))
+
+	if err := w.Get(ctx, key, addon); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, errors.Wrapf(err, "failed to get Addon %s of manifest %s", key, manifestPath)
+	}
+
+	checksum, _, err := unstructured.NestedString(addon.Object, "spec", "checksum")
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get checksum of Addon %s", key)
+	}
+
+	if checksum == "" {
+		return false, nil
+	}
+
+	patch := ctrlclient.MergeFrom(addon.DeepCopy())
+
+	if err := unstructured.SetNestedField(addon.Object, "", "spec", "checksum"); err != nil {
+		return false, errors.Wrapf(err, "failed to clear checksum of Addon %s", key)
+	}
+
+	if err := w.Patch(ctx, addon, patch); err != nil {
+		return false, errors.Wrapf(err, "failed to patch Addon %s", key)
+	}
+
+	return true, nil
+}
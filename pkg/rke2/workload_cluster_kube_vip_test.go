@@ -0,0 +1,205 @@
+package rke2
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+const kubeVIPManifest = `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: kube-vip
+  namespace: kube-system
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: kube-vip-ds
+  namespace: kube-system
+  labels:
+    app.kubernetes.io/name: kube-vip-ds
+spec:
+  selector:
+    matchLabels:
+      name: kube-vip-ds
+  template:
+    metadata:
+      labels:
+        name: kube-vip-ds
+    spec:
+      containers:
+      - name: kube-vip
+        image: ghcr.io/kube-vip/kube-vip:v0.6.0
+        args:
+        - manager
+        env:
+        - name: vip_arp
+          value: "true"
+        - name: address
+          value: 192.168.9.230
+`
+
+func newKubeVIPTestScheme(g *WithT) *runtime.Scheme {
+	s := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+	s.AddKnownTypeWithName(deployAddonGroupVersion.WithKind(deployAddonKind), &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(deployAddonGroupVersion.WithKind(deployAddonKind+"List"), &unstructured.UnstructuredList{})
+
+	return s
+}
+
+func newKubeVIPAddon(checksum string) *unstructured.Unstructured {
+	addon := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"checksum": checksum},
+	}}
+	addon.SetGroupVersionKind(deployAddonGroupVersion.WithKind(deployAddonKind))
+	addon.SetNamespace(metav1.NamespaceSystem)
+	addon.SetName("kube-vip")
+
+	return addon
+}
+
+func TestGetKubeVIPManifest(t *testing.T) {
+	g := NewWithT(t)
+
+	unlabeled := strings.Replace(kubeVIPManifest, "app.kubernetes.io/name: kube-vip-ds", "app.kubernetes.io/name: other", 1)
+
+	manifest, err := GetKubeVIPManifest(&controlplanev1.RKE2ControlPlane{
+		Spec: controlplanev1.RKE2ControlPlaneSpec{
+			RKE2ConfigSpec: bootstrapv1.RKE2ConfigSpec{
+				Files: []bootstrapv1.File{{
+					Path:    "/var/lib/rancher/rke2/server/manifests/kube-vip.yaml",
+					Content: unlabeled,
+				}},
+			},
+		},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(manifest).To(BeNil())
+}
+
+func TestReconcileControlPlaneVIP(t *testing.T) {
+	rcp := &controlplanev1.RKE2ControlPlane{
+		Spec: controlplanev1.RKE2ControlPlaneSpec{
+			RKE2ConfigSpec: bootstrapv1.RKE2ConfigSpec{
+				Files: []bootstrapv1.File{{
+					Path:    "/var/lib/rancher/rke2/server/manifests/kube-vip.yaml",
+					Content: kubeVIPManifest,
+				}},
+			},
+		},
+	}
+	daemonSetKey := client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: "kube-vip-ds"}
+	addonKey := client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: "kube-vip"}
+
+	addonChecksum := func(g *WithT, w *Workload) string {
+		addon := &unstructured.Unstructured{}
+		addon.SetGroupVersionKind(deployAddonGroupVersion.WithKind(deployAddonKind))
+		g.Expect(w.Get(context.Background(), addonKey, addon)).To(Succeed())
+
+		checksum, _, err := unstructured.NestedString(addon.Object, "spec", "checksum")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		return checksum
+	}
+
+	t.Run("requests the manifest of a DaemonSet with a drifted VIP address to be reapplied", func(t *testing.T) {
+		g := NewWithT(t)
+
+		manifest, err := GetKubeVIPManifest(rcp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(manifest).ToNot(BeNil())
+		g.Expect(manifest.Path).To(Equal("/var/lib/rancher/rke2/server/manifests/kube-vip.yaml"))
+
+		drifted := manifest.DaemonSet.DeepCopy()
+		drifted.Spec.Template.Spec.Containers[0].Env[1].Value = "192.168.9.100"
+
+		w := &Workload{
+			Client: fake.NewClientBuilder().WithScheme(newKubeVIPTestScheme(g)).
+				WithObjects(drifted, newKubeVIPAddon("abc123")).Build(),
+		}
+
+		reapplied, err := w.ReconcileControlPlaneVIP(context.Background(), rcp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(reapplied).To(BeTrue())
+		g.Expect(addonChecksum(g, w)).To(BeEmpty())
+
+		// The DaemonSet is left to the RKE2 deploy controller.
+		daemonSet := &appsv1.DaemonSet{}
+		g.Expect(w.Get(context.Background(), daemonSetKey, daemonSet)).To(Succeed())
+		g.Expect(daemonSet.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "address", Value: "192.168.9.100"}))
+
+		// The manifest is not requested again while it is pending to be reapplied.
+		reapplied, err = w.ReconcileControlPlaneVIP(context.Background(), rcp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(reapplied).To(BeFalse())
+	})
+
+	t.Run("does nothing when the DaemonSet advertises the VIP address", func(t *testing.T) {
+		g := NewWithT(t)
+
+		manifest, err := GetKubeVIPManifest(rcp)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		w := &Workload{
+			Client: fake.NewClientBuilder().WithScheme(newKubeVIPTestScheme(g)).
+				WithObjects(manifest.DaemonSet, newKubeVIPAddon("abc123")).Build(),
+		}
+
+		reapplied, err := w.ReconcileControlPlaneVIP(context.Background(), rcp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(reapplied).To(BeFalse())
+		g.Expect(addonChecksum(g, w)).To(Equal("abc123"))
+	})
+
+	t.Run("requests the manifest of a missing DaemonSet to be reapplied", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{
+			Client: fake.NewClientBuilder().WithScheme(newKubeVIPTestScheme(g)).
+				WithObjects(newKubeVIPAddon("abc123")).Build(),
+		}
+
+		reapplied, err := w.ReconcileControlPlaneVIP(context.Background(), rcp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(reapplied).To(BeTrue())
+		g.Expect(addonChecksum(g, w)).To(BeEmpty())
+		g.Expect(w.Get(context.Background(), daemonSetKey, &appsv1.DaemonSet{})).ToNot(Succeed())
+	})
+
+	t.Run("does nothing when the manifest is not deployed yet", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{Client: fake.NewClientBuilder().WithScheme(newKubeVIPTestScheme(g)).Build()}
+
+		reapplied, err := w.ReconcileControlPlaneVIP(context.Background(), rcp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(reapplied).To(BeFalse())
+		g.Expect(w.Get(context.Background(), daemonSetKey, &appsv1.DaemonSet{})).ToNot(Succeed())
+	})
+
+	t.Run("does nothing when kube-vip is not configured", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{Client: fake.NewClientBuilder().WithScheme(newKubeVIPTestScheme(g)).Build()}
+
+		reapplied, err := w.ReconcileControlPlaneVIP(context.Background(), &controlplanev1.RKE2ControlPlane{})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(reapplied).To(BeFalse())
+		g.Expect(w.Get(context.Background(), daemonSetKey, &appsv1.DaemonSet{})).ToNot(Succeed())
+	})
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/cluster-api/util/certs"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/kubeconfig"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/secret"
+)
+
+// ErrClusterCAExternallyManaged is returned when a credential would have to be signed by a cluster CA which was not
+// generated by a controller.
+var ErrClusterCAExternallyManaged = errors.New("cluster CA is externally managed")
+
+// GetKubeconfig returns an admin kubeconfig for the workload cluster, authenticating with a client certificate which
+// is signed by the client CA of the cluster and expires after ttl. It is meant for tooling, as minting a short-lived
+// certificate is safer than copying the static admin kubeconfig. Credentials are not minted from a cluster CA which
+// is externally managed, i.e. which was not generated by a controller, as its owner did not delegate signing.
+func (w *Workload) GetKubeconfig(ctx context.Context, clusterKey ctrlclient.ObjectKey, ttl time.Duration) ([]byte, error) {
+	if w.managementClient == nil {
+		return nil, errors.New("management cluster client is not set")
+	}
+
+	if w.apiServerAddress == "" {
+		return nil, errors.Errorf("API server address of cluster %s is unknown", clusterKey)
+	}
+
+	clusterCA, err := w.controllerManagedCA(ctx, clusterKey, secret.ClusterCA)
+	if err != nil {
+		return nil, err
+	}
+
+	clientClusterCA, err := w.controllerManagedCA(ctx, clusterKey, secret.ClientClusterCA)
+	if err != nil {
+		return nil, err
+	}
+
+	serverCACert, err := certs.DecodeCertPEM(clusterCA.Data[secret.TLSCrtDataName])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode cluster CA certificate")
+	} else if serverCACert == nil {
+		return nil, errors.New("cluster CA certificate not found")
+	}
+
+	clientCACert, err := certs.DecodeCertPEM(clientClusterCA.Data[secret.TLSCrtDataName])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode client CA certificate")
+	} else if clientCACert == nil {
+		return nil, errors.New("client CA certificate not found")
+	}
+
+	clientCAKey, err := certs.DecodePrivateKeyPEM(clientClusterCA.Data[secret.TLSKeyDataName])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode client CA private key")
+	} else if clientCAKey == nil {
+		return nil, errors.New("client CA private key not found")
+	}
+
+	cfg, err := kubeconfig.NewWithTTL(clusterKey.Name, "https://"+w.apiServerAddress, clientCACert, clientCAKey, serverCACert, ttl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to generate kubeconfig for cluster %s", clusterKey)
+	}
+
+	out, err := clientcmd.Write(*cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to serialize kubeconfig to yaml")
+	}
+
+	return out, nil
+}
+
+// controllerManagedCA returns the CA secret of the cluster with the given purpose, or an error wrapping
+// ErrClusterCAExternallyManaged if the secret is not controlled by a controller.
+func (w *Workload) controllerManagedCA(ctx context.Context, clusterKey ctrlclient.ObjectKey, purpose secret.Purpose) (*corev1.Secret, error) {
+	ca, err := secret.GetFromNamespacedName(ctx, w.managementClient, clusterKey, purpose)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get %s secret of cluster %s", purpose, clusterKey)
+	}
+
+	if metav1.GetControllerOf(ca) == nil {
+		return nil, errors.Wrapf(ErrClusterCAExternallyManaged, "secret %s is not controlled by a controller", ca.Name)
+	}
+
+	return ca, nil
+}
@@ -0,0 +1,136 @@
+package rke2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/cluster-api/util/certs"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/secret"
+)
+
+func TestGetKubeconfig(t *testing.T) {
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "cluster"}
+
+	// caSecret returns the CA secret with the given purpose, controlled by a controller if controlled is true.
+	caSecret := func(g *WithT, purpose secret.Purpose, controlled bool) (*corev1.Secret, *x509.Certificate) {
+		key, err := certs.NewPrivateKey()
+		g.Expect(err).ToNot(HaveOccurred())
+
+		tmpl := x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: string(purpose)},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(24 * time.Hour),
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, key.Public(), key)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		cert, err := x509.ParseCertificate(der)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		s := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: clusterKey.Namespace, Name: secret.Name(clusterKey.Name, purpose)},
+			Data: map[string][]byte{
+				secret.TLSCrtDataName: certs.EncodeCertPEM(cert),
+				secret.TLSKeyDataName: certs.EncodePrivateKeyPEM(key),
+			},
+		}
+
+		if controlled {
+			s.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "controlplane.cluster.x-k8s.io/v1beta1",
+				Kind:       "RKE2ControlPlane",
+				Name:       "rcp",
+				Controller: ptr.To(true),
+			}}
+		}
+
+		return s, cert
+	}
+
+	t.Run("mints a client certificate expiring after the TTL", func(t *testing.T) {
+		g := NewWithT(t)
+
+		clusterCA, _ := caSecret(g, secret.ClusterCA, true)
+		clientCA, clientCACert := caSecret(g, secret.ClientClusterCA, true)
+
+		w := &Workload{
+			apiServerAddress: "cluster.example.com:6443",
+			managementClient: fake.NewClientBuilder().WithObjects(clusterCA, clientCA).Build(),
+		}
+
+		before := time.Now()
+
+		out, err := w.GetKubeconfig(context.Background(), clusterKey, 10*time.Minute)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		cfg, err := clientcmd.Load(out)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cfg.Clusters).To(HaveKey("cluster"))
+		g.Expect(cfg.Clusters["cluster"].Server).To(Equal("https://cluster.example.com:6443"))
+		g.Expect(cfg.Clusters["cluster"].CertificateAuthorityData).To(Equal(clusterCA.Data[secret.TLSCrtDataName]))
+
+		authInfo := cfg.AuthInfos[cfg.Contexts[cfg.CurrentContext].AuthInfo]
+		g.Expect(authInfo).ToNot(BeNil())
+
+		clientCert, err := certs.DecodeCertPEM(authInfo.ClientCertificateData)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(clientCert.Subject.Organization).To(ConsistOf("system:masters"))
+		g.Expect(clientCert.NotAfter).To(BeTemporally(">=", before.Add(10*time.Minute).Truncate(time.Second)))
+		g.Expect(clientCert.NotAfter).To(BeTemporally("<=", time.Now().Add(10*time.Minute)))
+		g.Expect(clientCert.NotAfter.Sub(clientCert.NotBefore)).To(BeNumerically("<=", 11*time.Minute+time.Second))
+
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCACert)
+		_, err = clientCert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+
+	t.Run("rejects a non-positive TTL", func(t *testing.T) {
+		g := NewWithT(t)
+
+		clusterCA, _ := caSecret(g, secret.ClusterCA, true)
+		clientCA, _ := caSecret(g, secret.ClientClusterCA, true)
+
+		w := &Workload{
+			apiServerAddress: "cluster.example.com:6443",
+			managementClient: fake.NewClientBuilder().WithObjects(clusterCA, clientCA).Build(),
+		}
+
+		_, err := w.GetKubeconfig(context.Background(), clusterKey, 0)
+		g.Expect(err).To(MatchError(ContainSubstring("must be positive")))
+	})
+
+	t.Run("refuses an externally managed cluster CA", func(t *testing.T) {
+		g := NewWithT(t)
+
+		clusterCA, _ := caSecret(g, secret.ClusterCA, false)
+		clientCA, _ := caSecret(g, secret.ClientClusterCA, true)
+
+		w := &Workload{
+			apiServerAddress: "cluster.example.com:6443",
+			managementClient: fake.NewClientBuilder().WithObjects(clusterCA, clientCA).Build(),
+		}
+
+		_, err := w.GetKubeconfig(context.Background(), clusterKey, 10*time.Minute)
+		g.Expect(err).To(MatchError(ErrClusterCAExternallyManaged))
+	})
+}
@@ -0,0 +1,652 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/watch"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+	etcdutil "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/util"
+)
+
+// nodeRewatchInterval is how long to wait before re-establishing a node watch closed by the workload cluster.
+const nodeRewatchInterval = time.Second
+
+// ErrNodeNotReady is returned when a node doesn't become ready before the context is done.
+var ErrNodeNotReady = errors.New("node is not ready")
+
+// ErrNodeStillReady is returned when removing a node which is still ready, as its machine is likely still running.
+var ErrNodeStillReady = errors.New("node is still ready")
+
+// ErrNodeHasEtcdMember is returned when removing a node which is still an etcd member.
+var ErrNodeHasEtcdMember = errors.New("node still has an etcd member")
+
+// WaitForNodeReady waits for the node with the given provider ID to be created and to report Ready=true.
+// If the context is done first, the returned error wraps ErrNodeNotReady and carries the last reason the node
+// was not ready for.
+func (w *Workload) WaitForNodeReady(ctx context.Context, providerID string) error {
+	watchClient, ok := w.Client.(ctrlclient.WithWatch)
+	if !ok {
+		return errors.New("workload cluster client does not support watching nodes")
+	}
+
+	notReadyReason := "node does not exist yet"
+
+	for {
+		ready, err := watchNodeReady(ctx, watchClient, providerID, &notReadyReason)
+		if err != nil {
+			return err
+		}
+
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ErrNodeNotReady, "node with provider ID %s: %s", providerID, notReadyReason)
+		case <-time.After(nodeRewatchInterval):
+			log.FromContext(ctx).V(4).Info("Re-establishing node watch", "providerID", providerID)
+		}
+	}
+}
+
+// watchNodeReady watches the nodes of the workload cluster until the node with the given provider ID is ready,
+// the context is done or the watch is closed, updating notReadyReason with the last observed reason.
+func watchNodeReady(ctx context.Context, c ctrlclient.WithWatch, providerID string, notReadyReason *string) (bool, error) {
+	// Nodes are listed after the watch is started, so no update is missed in between.
+	watcher, err := c.Watch(ctx, &corev1.NodeList{})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to watch nodes")
+	}
+	defer watcher.Stop()
+
+	nodes := &corev1.NodeList{}
+	if err := c.List(ctx, nodes); err != nil {
+		return false, errors.Wrap(err, "failed to list nodes")
+	}
+
+	for i := range nodes.Items {
+		if nodes.Items[i].Spec.ProviderID == providerID && nodeReady(&nodes.Items[i], notReadyReason) {
+			return true, nil
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return false, nil
+			}
+
+			node, isNode := event.Object.(*corev1.Node)
+			if !isNode || node.Spec.ProviderID != providerID {
+				continue
+			}
+
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				if nodeReady(node, notReadyReason) {
+					return true, nil
+				}
+			case watch.Deleted:
+				*notReadyReason = "node was deleted"
+			}
+		}
+	}
+}
+
+// nodeReady returns true if the node reports Ready=true, otherwise the reason is set from its Ready condition.
+func nodeReady(node *corev1.Node, notReadyReason *string) bool {
+	if util.IsNodeReady(node) {
+		return true
+	}
+
+	*notReadyReason = "node does not report the Ready condition yet"
+
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			*notReadyReason = fmt.Sprintf("Ready=%s, reason: %s, message: %s", condition.Status, condition.Reason, condition.Message)
+		}
+	}
+
+	return false
+}
+
+// RemoveNode deletes the node with the given provider ID, which lingers as NotReady once its machine is deleted.
+// The node is only deleted once its machine is gone, i.e. the node is no longer ready, and its etcd member has been
+// removed. Removing a node which does not exist is not an error.
+func (w *Workload) RemoveNode(ctx context.Context, providerID string) error {
+	nodes := &corev1.NodeList{}
+	if err := w.List(ctx, nodes); err != nil {
+		return errors.Wrap(err, "failed to list nodes")
+	}
+
+	var node *corev1.Node
+
+	for i := range nodes.Items {
+		if nodes.Items[i].Spec.ProviderID == providerID {
+			node = &nodes.Items[i]
+
+			break
+		}
+	}
+
+	if node == nil {
+		return nil
+	}
+
+	if util.IsNodeReady(node) {
+		return errors.Wrapf(ErrNodeStillReady, "refusing to remove node %s", node.Name)
+	}
+
+	if err := w.checkNoEtcdMember(ctx, node); err != nil {
+		return err
+	}
+
+	if err := w.Delete(ctx, node); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete node %s", node.Name)
+	}
+
+	log.FromContext(ctx).Info("Removed node", "node", node.Name, "providerID", providerID)
+
+	return nil
+}
+
+// EnsureControlPlaneLabels adds the control plane and etcd node role labels RKE2 sets on server nodes to the nodes
+// of the given control plane machines which are missing them, e.g. after a configuration change, so they don't need
+// to be rolled out. The etcd label is not added when the control plane uses an external etcd, as the servers don't
+// host an etcd member then. Nodes are matched by ProviderID, any other node is left untouched.
+func (w *Workload) EnsureControlPlaneLabels(ctx context.Context, machines collections.Machines) error {
+	providerIDs := map[string]bool{}
+
+	for _, machine := range machines {
+		if machine.Spec.ProviderID != nil && *machine.Spec.ProviderID != "" {
+			providerIDs[*machine.Spec.ProviderID] = true
+		}
+	}
+
+	if len(providerIDs) == 0 {
+		return nil
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := w.List(ctx, nodes); err != nil {
+		return errors.Wrap(err, "failed to list nodes")
+	}
+
+	labels := []string{labelNodeRoleServer, labelNodeRoleControlPlane}
+	if w.externalEtcd == nil {
+		labels = append(labels, labelNodeRoleEtcd)
+	}
+
+	errList := []error{}
+
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if !providerIDs[node.Spec.ProviderID] {
+			continue
+		}
+
+		missing := []string{}
+
+		for _, label := range labels {
+			if node.Labels[label] != "true" {
+				missing = append(missing, label)
+			}
+		}
+
+		if len(missing) == 0 {
+			continue
+		}
+
+		patch := ctrlclient.MergeFrom(node.DeepCopy())
+
+		if node.Labels == nil {
+			node.Labels = map[string]string{}
+		}
+
+		for _, label := range missing {
+			node.Labels[label] = "true"
+		}
+
+		if err := w.Patch(ctx, node, patch); err != nil {
+			errList = append(errList, errors.Wrapf(err, "failed to add role labels to node %s", node.Name))
+
+			continue
+		}
+
+		log.FromContext(ctx).Info("Added missing role labels to control plane node", "node", node.Name, "labels", missing)
+	}
+
+	return kerrors.NewAggregate(errList)
+}
+
+// controlPlaneTaintKeys are the keys of the taints keeping workloads off the control plane nodes.
+var controlPlaneTaintKeys = []string{labelNodeRoleServer, labelNodeRoleControlPlane}
+
+// EnsureNodeTaintsRemovedOnReady removes the NoSchedule control plane taints from the nodes of the given control plane
+// machines once they are Ready and their network is available, when the RKE2ControlPlane has the
+// RemoveControlPlaneTaintAnnotation set to "true". Taints with the same key and effect as one of the agentConfig
+// nodeTaints are explicitly configured by the user, and are kept. Nodes are matched by ProviderID, any other node is
+// left untouched. The names of the nodes whose taints were removed are returned.
+func (w *Workload) EnsureNodeTaintsRemovedOnReady(
+	ctx context.Context,
+	rcp *controlplanev1.RKE2ControlPlane,
+	machines collections.Machines,
+) ([]string, error) {
+	if rcp.GetAnnotations()[controlplanev1.RemoveControlPlaneTaintAnnotation] != "true" {
+		return nil, nil
+	}
+
+	providerIDs := map[string]bool{}
+
+	for _, machine := range machines {
+		if machine.Spec.ProviderID != nil && *machine.Spec.ProviderID != "" {
+			providerIDs[*machine.Spec.ProviderID] = true
+		}
+	}
+
+	if len(providerIDs) == 0 {
+		return nil, nil
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := w.List(ctx, nodes); err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+
+	untainted := []string{}
+	errList := []error{}
+
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if !providerIDs[node.Spec.ProviderID] || !util.IsNodeReady(node) || nodeNetworkUnavailable(node) {
+			continue
+		}
+
+		taints := slices.DeleteFunc(slices.Clone(node.Spec.Taints), func(taint corev1.Taint) bool {
+			return removableControlPlaneTaint(taint, rcp.Spec.AgentConfig.NodeTaints)
+		})
+		if len(taints) == len(node.Spec.Taints) {
+			continue
+		}
+
+		patch := ctrlclient.MergeFrom(node.DeepCopy())
+		node.Spec.Taints = taints
+
+		if err := w.Patch(ctx, node, patch); err != nil {
+			errList = append(errList, errors.Wrapf(err, "failed to remove control plane taint from node %s", node.Name))
+
+			continue
+		}
+
+		log.FromContext(ctx).Info("Removed control plane taint from ready node", "node", node.Name)
+
+		untainted = append(untainted, node.Name)
+	}
+
+	return untainted, kerrors.NewAggregate(errList)
+}
+
+// nodeNetworkUnavailable returns true if the node reports NetworkUnavailable=true, i.e. its CNI is not set up yet.
+func nodeNetworkUnavailable(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeNetworkUnavailable {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// removableControlPlaneTaint returns true if the taint is a NoSchedule control plane taint which is not one of the
+// configured taints, in the key=value:effect format.
+func removableControlPlaneTaint(taint corev1.Taint, configuredTaints []string) bool {
+	if taint.Effect != corev1.TaintEffectNoSchedule || !slices.Contains(controlPlaneTaintKeys, taint.Key) {
+		return false
+	}
+
+	for _, configured := range configuredTaints {
+		key, _, effect := splitTaint(configured)
+		if key == taint.Key && corev1.TaintEffect(effect) == taint.Effect {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetNodeInternalIPs returns the address of the node of each control plane machine, by machine name, so that etcd
+// endpoints can be built from addresses which don't change when the etcd pod is restarted. The InternalIP of the
+// preferred IP family of the cluster is used first, then any InternalIP, then the other addresses of the node.
+// Machines without a node or without a usable address are omitted.
+func (w *Workload) GetNodeInternalIPs(ctx context.Context, machines collections.Machines) (map[string]string, error) {
+	nodes := &corev1.NodeList{}
+	if err := w.List(ctx, nodes); err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+
+	nodesByName := map[string]*corev1.Node{}
+	nodesByProviderID := map[string]*corev1.Node{}
+
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		nodesByName[node.Name] = node
+
+		if node.Spec.ProviderID != "" {
+			nodesByProviderID[node.Spec.ProviderID] = node
+		}
+	}
+
+	addresses := map[string]string{}
+
+	for _, machine := range machines {
+		var node *corev1.Node
+
+		switch {
+		case machine.Status.NodeRef != nil:
+			node = nodesByName[machine.Status.NodeRef.Name]
+		case machine.Spec.ProviderID != nil:
+			node = nodesByProviderID[*machine.Spec.ProviderID]
+		}
+
+		if node == nil {
+			continue
+		}
+
+		if address := nodeAddress(node, w.preferredIPFamily); address != "" {
+			addresses[machine.Name] = address
+		}
+	}
+
+	return addresses, nil
+}
+
+// nodeAddressTypes are the node address types usable to reach a node, in order of preference.
+var nodeAddressTypes = []corev1.NodeAddressType{
+	corev1.NodeInternalIP,
+	corev1.NodeExternalIP,
+	corev1.NodeInternalDNS,
+	corev1.NodeHostName,
+	corev1.NodeExternalDNS,
+}
+
+// nodeAddress returns the preferred address of the node, addresses of the preferred IP family come first for each
+// address type, as nodes with several network interfaces can expose addresses of both families.
+func nodeAddress(node *corev1.Node, preferredIPFamily corev1.IPFamily) string {
+	rank := func(address corev1.NodeAddress) int {
+		typeRank := slices.Index(nodeAddressTypes, address.Type)
+		if typeRank < 0 || address.Address == "" {
+			return -1
+		}
+
+		ip := net.ParseIP(address.Address)
+		if ip == nil {
+			return 2 * typeRank
+		}
+
+		if ip.IsUnspecified() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+			return -1
+		}
+
+		if isIPv6 := ip.To4() == nil; isIPv6 == (preferredIPFamily == corev1.IPv6Protocol) {
+			return 2 * typeRank
+		}
+
+		return 2*typeRank + 1
+	}
+
+	best, bestRank := "", -1
+
+	for _, address := range node.Status.Addresses {
+		if r := rank(address); r >= 0 && (bestRank < 0 || r < bestRank) {
+			best, bestRank = address.Address, r
+		}
+	}
+
+	return best
+}
+
+// checkNoEtcdMember returns an error wrapping ErrNodeHasEtcdMember if the control plane node is still an etcd member.
+// The etcd cluster is reached through the other control plane nodes.
+func (w *Workload) checkNoEtcdMember(ctx context.Context, node *corev1.Node) error {
+	if w.externalEtcd != nil || w.etcdClientGenerator == nil || node.Labels[labelNodeRoleControlPlane] != "true" {
+		return nil
+	}
+
+	nodeNames, err := w.etcdNodeNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	remainingNodes := slices.DeleteFunc(nodeNames, func(name string) bool { return name == node.Name })
+	if len(remainingNodes) == 0 {
+		return errors.Wrapf(ErrNodeHasEtcdMember, "node %s is the last control plane node", node.Name)
+	}
+
+	etcdClient, err := w.etcdClientGenerator.ForFirstAvailableNode(ctx, remainingNodes)
+	if err != nil {
+		return errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	if etcdutil.MemberForName(members, node.Name) != nil {
+		return errors.Wrapf(ErrNodeHasEtcdMember, "refusing to remove node %s", node.Name)
+	}
+
+	return nil
+}
+
+const (
+	// DefaultDrainPodTimeout is the default time budget to evict a pod and wait for it to be gone while draining a node.
+	DefaultDrainPodTimeout = 2 * time.Minute
+
+	// drainPollInterval is how often an eviction blocked by a PodDisruptionBudget is retried, and how often an evicted
+	// pod is checked for deletion.
+	drainPollInterval = time.Second
+)
+
+// ErrDrainIncomplete is returned when some pods could not be evicted from the drained node in their time budget.
+var ErrDrainIncomplete = errors.New("node drain is incomplete")
+
+// DrainOptions restricts the pods evicted when draining a node.
+type DrainOptions struct {
+	// IncludeNamespaces, if set, restricts the eviction to the pods of these namespaces.
+	IncludeNamespaces []string
+
+	// ExcludeNamespaces are the namespaces whose pods are not evicted.
+	ExcludeNamespaces []string
+
+	// PodSelector, if set, restricts the eviction to the pods whose labels match it.
+	PodSelector *metav1.LabelSelector
+
+	// PodTimeout is the time budget to evict a pod, including the retries of evictions blocked by a
+	// PodDisruptionBudget, and to wait for it to be gone. DefaultDrainPodTimeout is used if it is not positive.
+	PodTimeout time.Duration
+}
+
+// DrainResult reports what happened to the pods of a drained node.
+type DrainResult struct {
+	// Evicted are the pods evicted from the node, as namespace/name.
+	Evicted []string
+
+	// Excluded are the pods left on the node, as namespace/name, because they are filtered out by the drain options,
+	// or are DaemonSet or static pods.
+	Excluded []string
+
+	// Failed maps the pods which could not be evicted in their time budget, as namespace/name, to the reason.
+	Failed map[string]string
+}
+
+// DrainNode cordons the node and evicts its pods using the eviction API, so PodDisruptionBudgets are honored.
+// DaemonSet and static pods are never evicted, and the eviction can be restricted with the options. Pods which are
+// excluded are reported, and pods which can't be evicted in their time budget, e.g. because of a PodDisruptionBudget,
+// are reported as failed, along with an error wrapping ErrDrainIncomplete; no pod is ever force-deleted.
+func (w *Workload) DrainNode(ctx context.Context, nodeName string, opts DrainOptions) (*DrainResult, error) {
+	selector := labels.Everything()
+
+	if opts.PodSelector != nil {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(opts.PodSelector); err != nil {
+			return nil, errors.Wrap(err, "invalid pod selector")
+		}
+	}
+
+	podTimeout := opts.PodTimeout
+	if podTimeout <= 0 {
+		podTimeout = DefaultDrainPodTimeout
+	}
+
+	node := &corev1.Node{}
+	if err := w.Get(ctx, ctrlclient.ObjectKey{Name: nodeName}, node); err != nil {
+		return nil, errors.Wrapf(err, "failed to get node %s", nodeName)
+	}
+
+	if !node.Spec.Unschedulable {
+		patch := ctrlclient.MergeFrom(node.DeepCopy())
+		node.Spec.Unschedulable = true
+
+		if err := w.Patch(ctx, node, patch); err != nil {
+			return nil, errors.Wrapf(err, "failed to cordon node %s", nodeName)
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := w.List(ctx, pods, ctrlclient.MatchingFields{"spec.nodeName": nodeName}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list pods of node %s", nodeName)
+	}
+
+	result := &DrainResult{Failed: map[string]string{}}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		key := pod.Namespace + "/" + pod.Name
+
+		if !drainEvictsPod(pod, opts, selector) {
+			result.Excluded = append(result.Excluded, key)
+
+			continue
+		}
+
+		if err := w.evictPod(ctx, pod, podTimeout); err != nil {
+			result.Failed[key] = err.Error()
+
+			continue
+		}
+
+		result.Evicted = append(result.Evicted, key)
+	}
+
+	log.FromContext(ctx).Info("Drained node", "node", nodeName,
+		"evicted", len(result.Evicted), "excluded", len(result.Excluded), "failed", len(result.Failed))
+
+	if len(result.Failed) > 0 {
+		return result, errors.Wrapf(ErrDrainIncomplete, "%d pods of node %s could not be evicted", len(result.Failed), nodeName)
+	}
+
+	return result, nil
+}
+
+// drainEvictsPod returns true if the pod is evicted when draining its node with the given options.
+func drainEvictsPod(pod *corev1.Pod, opts DrainOptions, selector labels.Selector) bool {
+	if _, isMirror := pod.Annotations[corev1.MirrorPodAnnotationKey]; isMirror {
+		return false
+	}
+
+	if controller := metav1.GetControllerOf(pod); controller != nil && controller.Kind == "DaemonSet" {
+		return false
+	}
+
+	if len(opts.IncludeNamespaces) > 0 && !slices.Contains(opts.IncludeNamespaces, pod.Namespace) {
+		return false
+	}
+
+	if slices.Contains(opts.ExcludeNamespaces, pod.Namespace) {
+		return false
+	}
+
+	return selector.Matches(labels.Set(pod.Labels))
+}
+
+// evictPod evicts the pod and waits for it to be gone, retrying evictions blocked by a PodDisruptionBudget until
+// the timeout.
+func (w *Workload) evictPod(ctx context.Context, pod *corev1.Pod, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name}}
+	evicted := false
+	lastErr := errors.New("pod was not evicted")
+
+	for {
+		if !evicted {
+			err := w.SubResource("eviction").Create(ctx, pod, eviction)
+
+			switch {
+			case err == nil || apierrors.IsNotFound(err):
+				evicted = true
+			case apierrors.IsTooManyRequests(err):
+				lastErr = errors.Wrap(err, "eviction is blocked by a PodDisruptionBudget")
+			default:
+				return errors.Wrap(err, "failed to evict pod")
+			}
+		}
+
+		if evicted {
+			current := &corev1.Pod{}
+
+			err := w.Get(ctx, ctrlclient.ObjectKeyFromObject(pod), current)
+			if apierrors.IsNotFound(err) || (err == nil && current.UID != pod.UID) {
+				return nil
+			}
+
+			lastErr = errors.New("pod is still terminating")
+		}
+
+		select {
+		case <-ctx.Done():
+			return lastErr
+		case <-time.After(drainPollInterval):
+		}
+	}
+}
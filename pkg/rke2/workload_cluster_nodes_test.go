@@ -0,0 +1,535 @@
+package rke2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	etcdfake "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/fake"
+)
+
+func readyNode(name, providerID string, status corev1.ConditionStatus) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       corev1.NodeSpec{ProviderID: providerID},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{{
+			Type:    corev1.NodeReady,
+			Status:  status,
+			Reason:  "KubeletNotReady",
+			Message: "container runtime network not ready",
+		}}},
+	}
+}
+
+func TestWaitForNodeReady(t *testing.T) {
+	const providerID = "aws:///eu-central-1a/i-0123456789"
+
+	t.Run("returns when the node is already ready", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{
+			Client: fake.NewClientBuilder().WithObjects(readyNode("node-1", providerID, corev1.ConditionTrue)).Build(),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		g.Expect(w.WaitForNodeReady(ctx, providerID)).To(Succeed())
+	})
+
+	t.Run("waits for the node to be created and become ready", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{Client: fake.NewClientBuilder().Build()}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+
+			node := readyNode("node-1", providerID, corev1.ConditionFalse)
+			_ = w.Create(ctx, node)
+
+			time.Sleep(100 * time.Millisecond)
+
+			node.Status.Conditions[0].Status = corev1.ConditionTrue
+			_ = w.Status().Update(ctx, node)
+		}()
+
+		g.Expect(w.WaitForNodeReady(ctx, providerID)).To(Succeed())
+	})
+
+	t.Run("surfaces the last NotReady reason on timeout", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{
+			Client: fake.NewClientBuilder().WithObjects(
+				readyNode("node-1", providerID, corev1.ConditionFalse),
+				readyNode("node-2", "aws:///eu-central-1a/i-other", corev1.ConditionTrue),
+			).Build(),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		err := w.WaitForNodeReady(ctx, providerID)
+		g.Expect(err).To(MatchError(ErrNodeNotReady))
+		g.Expect(err.Error()).To(ContainSubstring("container runtime network not ready"))
+	})
+
+	t.Run("reports a missing node on timeout", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{Client: fake.NewClientBuilder().Build()}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		err := w.WaitForNodeReady(ctx, providerID)
+		g.Expect(err).To(MatchError(ErrNodeNotReady))
+		g.Expect(err.Error()).To(ContainSubstring("node does not exist yet"))
+	})
+}
+
+func TestRemoveNode(t *testing.T) {
+	const providerID = "aws:///eu-central-1a/i-0123456789"
+
+	controlPlaneNode := func(name, providerID string, status corev1.ConditionStatus) *corev1.Node {
+		node := readyNode(name, providerID, status)
+		node.Labels = map[string]string{labelNodeRoleControlPlane: "true"}
+
+		return node
+	}
+
+	etcdClientGenerator := func(memberNames ...string) *fakeEtcdClientGenerator {
+		members := []*pb.Member{}
+		for i, name := range memberNames {
+			members = append(members, &pb.Member{Name: name, ID: uint64(i + 1)})
+		}
+
+		return &fakeEtcdClientGenerator{
+			forNodesClient: &etcd.Client{
+				EtcdClient: &etcdfake.FakeEtcdClient{
+					MemberListResponse: &clientv3.MemberListResponse{Members: members},
+					AlarmResponse:      &clientv3.AlarmResponse{},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name                string
+		objs                []client.Object
+		etcdClientGenerator etcd.ClientFor
+		expectErr           error
+		expectRemoved       bool
+	}{
+		{
+			name: "does nothing if the node is already gone",
+			objs: []client.Object{controlPlaneNode("cp2", "aws:///eu-central-1a/i-other", corev1.ConditionTrue)},
+		},
+		{
+			name:          "removes a NotReady worker node",
+			objs:          []client.Object{readyNode("worker", providerID, corev1.ConditionUnknown)},
+			expectRemoved: true,
+		},
+		{
+			name:      "refuses to remove a node which is still ready",
+			objs:      []client.Object{readyNode("worker", providerID, corev1.ConditionTrue)},
+			expectErr: ErrNodeStillReady,
+		},
+		{
+			name: "removes a NotReady control plane node whose etcd member was removed",
+			objs: []client.Object{
+				controlPlaneNode("cp1", providerID, corev1.ConditionUnknown),
+				controlPlaneNode("cp2", "aws:///eu-central-1a/i-other", corev1.ConditionTrue),
+			},
+			etcdClientGenerator: etcdClientGenerator("cp2"),
+			expectRemoved:       true,
+		},
+		{
+			name: "refuses to remove a control plane node which still has an etcd member",
+			objs: []client.Object{
+				controlPlaneNode("cp1", providerID, corev1.ConditionUnknown),
+				controlPlaneNode("cp2", "aws:///eu-central-1a/i-other", corev1.ConditionTrue),
+			},
+			etcdClientGenerator: etcdClientGenerator("cp1", "cp2"),
+			expectErr:           ErrNodeHasEtcdMember,
+		},
+		{
+			name:                "refuses to remove the last control plane node",
+			objs:                []client.Object{controlPlaneNode("cp1", providerID, corev1.ConditionUnknown)},
+			etcdClientGenerator: etcdClientGenerator(),
+			expectErr:           ErrNodeHasEtcdMember,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			w := &Workload{
+				Client:              fake.NewClientBuilder().WithObjects(tt.objs...).Build(),
+				etcdClientGenerator: tt.etcdClientGenerator,
+			}
+
+			err := w.RemoveNode(context.Background(), providerID)
+			if tt.expectErr != nil {
+				g.Expect(err).To(MatchError(tt.expectErr))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			nodes := &corev1.NodeList{}
+			g.Expect(w.List(context.Background(), nodes)).To(Succeed())
+
+			remaining := len(tt.objs)
+			if tt.expectRemoved {
+				remaining--
+			}
+
+			g.Expect(nodes.Items).To(HaveLen(remaining))
+
+			for _, node := range nodes.Items {
+				if tt.expectRemoved {
+					g.Expect(node.Spec.ProviderID).ToNot(Equal(providerID))
+				}
+			}
+		})
+	}
+
+	t.Run("is idempotent", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{Client: fake.NewClientBuilder().WithObjects(readyNode("worker", providerID, corev1.ConditionFalse)).Build()}
+
+		g.Expect(w.RemoveNode(context.Background(), providerID)).To(Succeed())
+		g.Expect(w.RemoveNode(context.Background(), providerID)).To(Succeed())
+	})
+}
+
+func TestEnsureControlPlaneLabels(t *testing.T) {
+	g := NewWithT(t)
+
+	machineWithProviderID := func(name, providerID string) *clusterv1.Machine {
+		return &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       clusterv1.MachineSpec{ProviderID: &providerID},
+		}
+	}
+
+	labelled := readyNode("cp1", "aws:///eu-central-1a/i-cp1", corev1.ConditionTrue)
+	labelled.Labels = map[string]string{
+		labelNodeRoleServer:       "true",
+		labelNodeRoleControlPlane: "true",
+		labelNodeRoleEtcd:         "true",
+	}
+	missingRole := readyNode("cp2", "aws:///eu-central-1a/i-cp2", corev1.ConditionTrue)
+	missingRole.Labels = map[string]string{labelNodeRoleEtcd: "true", "topology.kubernetes.io/zone": "eu-central-1a"}
+	worker := readyNode("worker", "aws:///eu-central-1a/i-worker", corev1.ConditionTrue)
+
+	w := &Workload{
+		Client: fake.NewClientBuilder().WithObjects(labelled, missingRole, worker).Build(),
+	}
+
+	machines := collections.FromMachines(
+		machineWithProviderID("machine-cp1", labelled.Spec.ProviderID),
+		machineWithProviderID("machine-cp2", missingRole.Spec.ProviderID),
+		&clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine-cp3"}},
+	)
+
+	g.Expect(w.EnsureControlPlaneLabels(ctx, machines)).To(Succeed())
+
+	node := &corev1.Node{}
+	g.Expect(w.Get(ctx, client.ObjectKeyFromObject(missingRole), node)).To(Succeed())
+	g.Expect(node.Labels).To(Equal(map[string]string{
+		labelNodeRoleServer:           "true",
+		labelNodeRoleControlPlane:     "true",
+		labelNodeRoleEtcd:             "true",
+		"topology.kubernetes.io/zone": "eu-central-1a",
+	}))
+
+	g.Expect(w.Get(ctx, client.ObjectKeyFromObject(worker), node)).To(Succeed())
+	g.Expect(node.Labels).To(BeEmpty())
+
+	// The servers of a control plane using an external etcd don't get the etcd label.
+	externalEtcdNode := readyNode("cp4", "aws:///eu-central-1a/i-cp4", corev1.ConditionTrue)
+
+	w = &Workload{
+		Client:       fake.NewClientBuilder().WithObjects(externalEtcdNode).Build(),
+		externalEtcd: &etcd.ExternalClientGenerator{},
+	}
+
+	g.Expect(w.EnsureControlPlaneLabels(ctx, collections.FromMachines(
+		machineWithProviderID("machine-cp4", externalEtcdNode.Spec.ProviderID),
+	))).To(Succeed())
+
+	g.Expect(w.Get(ctx, client.ObjectKeyFromObject(externalEtcdNode), node)).To(Succeed())
+	g.Expect(node.Labels).To(Equal(map[string]string{
+		labelNodeRoleServer:       "true",
+		labelNodeRoleControlPlane: "true",
+	}))
+}
+
+func TestEnsureNodeTaintsRemovedOnReady(t *testing.T) {
+	controlPlaneTaint := corev1.Taint{Key: labelNodeRoleServer, Effect: corev1.TaintEffectNoSchedule}
+	uninitializedTaint := corev1.Taint{Key: "node.cloudprovider.kubernetes.io/uninitialized", Value: "true", Effect: corev1.TaintEffectNoSchedule}
+
+	taintedNode := func(name string, status corev1.ConditionStatus, taints ...corev1.Taint) *corev1.Node {
+		node := readyNode(name, "aws:///eu-central-1a/i-"+name, status)
+		node.Spec.Taints = taints
+
+		return node
+	}
+	machinesFor := func(nodes ...*corev1.Node) collections.Machines {
+		machines := collections.New()
+		for _, node := range nodes {
+			machines.Insert(&clusterv1.Machine{
+				ObjectMeta: metav1.ObjectMeta{Name: "machine-" + node.Name},
+				Spec:       clusterv1.MachineSpec{ProviderID: ptr.To(node.Spec.ProviderID)},
+			})
+		}
+
+		return machines
+	}
+	rcpWith := func(annotations map[string]string, nodeTaints ...string) *controlplanev1.RKE2ControlPlane {
+		taintRCP := &controlplanev1.RKE2ControlPlane{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+		taintRCP.Spec.AgentConfig.NodeTaints = nodeTaints
+
+		return taintRCP
+	}
+	enabled := map[string]string{controlplanev1.RemoveControlPlaneTaintAnnotation: "true"}
+
+	t.Run("removes the control plane taint from ready nodes", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ready := taintedNode("cp1", corev1.ConditionTrue, controlPlaneTaint, uninitializedTaint)
+		notReady := taintedNode("cp2", corev1.ConditionFalse, controlPlaneTaint)
+		networkUnavailable := taintedNode("cp3", corev1.ConditionTrue, controlPlaneTaint)
+		networkUnavailable.Status.Conditions = append(networkUnavailable.Status.Conditions,
+			corev1.NodeCondition{Type: corev1.NodeNetworkUnavailable, Status: corev1.ConditionTrue})
+		worker := taintedNode("worker", corev1.ConditionTrue, controlPlaneTaint)
+
+		w := &Workload{Client: fake.NewClientBuilder().WithObjects(ready, notReady, networkUnavailable, worker).Build()}
+
+		untainted, err := w.EnsureNodeTaintsRemovedOnReady(ctx, rcpWith(enabled), machinesFor(ready, notReady, networkUnavailable))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(untainted).To(Equal([]string{"cp1"}))
+
+		node := &corev1.Node{}
+		g.Expect(w.Get(ctx, client.ObjectKeyFromObject(ready), node)).To(Succeed())
+		g.Expect(node.Spec.Taints).To(Equal([]corev1.Taint{uninitializedTaint}))
+
+		for _, tainted := range []*corev1.Node{notReady, networkUnavailable, worker} {
+			g.Expect(w.Get(ctx, client.ObjectKeyFromObject(tainted), node)).To(Succeed())
+			g.Expect(node.Spec.Taints).To(Equal([]corev1.Taint{controlPlaneTaint}))
+		}
+	})
+
+	t.Run("keeps the taints configured by the user", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ready := taintedNode("cp1", corev1.ConditionTrue, controlPlaneTaint)
+		w := &Workload{Client: fake.NewClientBuilder().WithObjects(ready).Build()}
+
+		untainted, err := w.EnsureNodeTaintsRemovedOnReady(ctx,
+			rcpWith(enabled, "node-role.kubernetes.io/control-plane=true:NoSchedule"), machinesFor(ready))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(untainted).To(BeEmpty())
+
+		node := &corev1.Node{}
+		g.Expect(w.Get(ctx, client.ObjectKeyFromObject(ready), node)).To(Succeed())
+		g.Expect(node.Spec.Taints).To(Equal([]corev1.Taint{controlPlaneTaint}))
+	})
+
+	t.Run("does nothing without the opt-in annotation", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ready := taintedNode("cp1", corev1.ConditionTrue, controlPlaneTaint)
+		w := &Workload{Client: fake.NewClientBuilder().WithObjects(ready).Build()}
+
+		untainted, err := w.EnsureNodeTaintsRemovedOnReady(ctx, rcpWith(nil), machinesFor(ready))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(untainted).To(BeEmpty())
+
+		node := &corev1.Node{}
+		g.Expect(w.Get(ctx, client.ObjectKeyFromObject(ready), node)).To(Succeed())
+		g.Expect(node.Spec.Taints).To(Equal([]corev1.Taint{controlPlaneTaint}))
+	})
+}
+
+func TestGetNodeInternalIPs(t *testing.T) {
+	multiNIC := readyNode("cp1", "aws:///eu-central-1a/i-cp1", corev1.ConditionTrue)
+	multiNIC.Status.Addresses = []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: "cp1"},
+		{Type: corev1.NodeExternalIP, Address: "203.0.113.10"},
+		{Type: corev1.NodeInternalIP, Address: "fd00::10"},
+		{Type: corev1.NodeInternalIP, Address: "10.0.0.10"},
+		{Type: corev1.NodeInternalIP, Address: "fe80::1"},
+	}
+	externalOnly := readyNode("cp2", "aws:///eu-central-1a/i-cp2", corev1.ConditionTrue)
+	externalOnly.Status.Addresses = []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: "cp2"},
+		{Type: corev1.NodeExternalIP, Address: "203.0.113.20"},
+	}
+	noAddress := readyNode("cp3", "aws:///eu-central-1a/i-cp3", corev1.ConditionTrue)
+
+	machines := collections.FromMachines(
+		&clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine-cp1"},
+			Status:     clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "cp1"}},
+		},
+		&clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine-cp2"},
+			Spec:       clusterv1.MachineSpec{ProviderID: &externalOnly.Spec.ProviderID},
+		},
+		&clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine-cp3"},
+			Status:     clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "cp3"}},
+		},
+		&clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine-cp4"}},
+	)
+
+	tests := []struct {
+		name     string
+		family   corev1.IPFamily
+		expected map[string]string
+	}{
+		{
+			name:     "prefers the IPv4 InternalIP",
+			family:   corev1.IPv4Protocol,
+			expected: map[string]string{"machine-cp1": "10.0.0.10", "machine-cp2": "203.0.113.20"},
+		},
+		{
+			name:     "prefers the IPv6 InternalIP",
+			family:   corev1.IPv6Protocol,
+			expected: map[string]string{"machine-cp1": "fd00::10", "machine-cp2": "203.0.113.20"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			w := &Workload{
+				Client:            fake.NewClientBuilder().WithObjects(multiNIC, externalOnly, noAddress).Build(),
+				preferredIPFamily: tt.family,
+			}
+
+			addresses, err := w.GetNodeInternalIPs(ctx, machines)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(addresses).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestDrainNode(t *testing.T) {
+	pod := func(namespace, name, nodeName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: map[string]string{"app": name}},
+			Spec:       corev1.PodSpec{NodeName: nodeName},
+		}
+	}
+
+	// drainClient returns a workload cluster client whose pods can be listed by node, and whose evictions of the
+	// blocked pods are rejected as a PodDisruptionBudget would.
+	drainClient := func(blocked string, objects ...client.Object) client.Client {
+		return fake.NewClientBuilder().
+			WithObjects(objects...).
+			WithIndex(&corev1.Pod{}, "spec.nodeName", func(obj client.Object) []string {
+				return []string{obj.(*corev1.Pod).Spec.NodeName}
+			}).
+			WithInterceptorFuncs(interceptor.Funcs{
+				SubResourceCreate: func(
+					ctx context.Context, c client.Client, subResource string, obj client.Object, sub client.Object,
+					opts ...client.SubResourceCreateOption,
+				) error {
+					if subResource == "eviction" && obj.GetName() == blocked {
+						return apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+					}
+
+					return c.SubResource(subResource).Create(ctx, obj, sub, opts...)
+				},
+			}).
+			Build()
+	}
+
+	t.Run("evicts the pods except the excluded namespaces", func(t *testing.T) {
+		g := NewWithT(t)
+
+		daemonSetPod := pod("kube-system", "canal-abcde", "node-1")
+		daemonSetPod.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "canal", Controller: ptr.To(true)}}
+
+		cl := drainClient("",
+			readyNode("node-1", "", corev1.ConditionTrue),
+			pod("default", "web", "node-1"),
+			pod("monitoring", "prometheus", "node-1"),
+			pod("default", "other-node", "node-2"),
+			daemonSetPod,
+		)
+		w := &Workload{Client: cl}
+
+		result, err := w.DrainNode(context.Background(), "node-1", DrainOptions{ExcludeNamespaces: []string{"monitoring"}})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(result.Evicted).To(ConsistOf("default/web"))
+		g.Expect(result.Excluded).To(ConsistOf("monitoring/prometheus", "kube-system/canal-abcde"))
+		g.Expect(result.Failed).To(BeEmpty())
+
+		node := &corev1.Node{}
+		g.Expect(cl.Get(context.Background(), client.ObjectKey{Name: "node-1"}, node)).To(Succeed())
+		g.Expect(node.Spec.Unschedulable).To(BeTrue())
+		g.Expect(cl.Get(context.Background(), client.ObjectKey{Namespace: "monitoring", Name: "prometheus"}, &corev1.Pod{})).To(Succeed())
+		g.Expect(cl.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "other-node"}, &corev1.Pod{})).To(Succeed())
+	})
+
+	t.Run("only evicts the pods matching the selector", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := &Workload{Client: drainClient("",
+			readyNode("node-1", "", corev1.ConditionTrue),
+			pod("default", "web", "node-1"),
+			pod("default", "db", "node-1"),
+		)}
+
+		result, err := w.DrainNode(context.Background(), "node-1", DrainOptions{
+			PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(result.Evicted).To(ConsistOf("default/web"))
+		g.Expect(result.Excluded).To(ConsistOf("default/db"))
+	})
+
+	t.Run("reports the pods blocked by a PodDisruptionBudget without deleting them", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cl := drainClient("db",
+			readyNode("node-1", "", corev1.ConditionTrue),
+			pod("default", "web", "node-1"),
+			pod("default", "db", "node-1"),
+		)
+		w := &Workload{Client: cl}
+
+		result, err := w.DrainNode(context.Background(), "node-1", DrainOptions{PodTimeout: 100 * time.Millisecond})
+		g.Expect(err).To(MatchError(ErrDrainIncomplete))
+		g.Expect(result.Evicted).To(ConsistOf("default/web"))
+		g.Expect(result.Failed).To(HaveKeyWithValue("default/db", ContainSubstring("PodDisruptionBudget")))
+		g.Expect(cl.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "db"}, &corev1.Pod{})).To(Succeed())
+	})
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/cluster-api/util"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ControlPlaneReadinessCheckName is the name of a check contributing to the readiness of the control plane.
+type ControlPlaneReadinessCheckName string
+
+const (
+	// EtcdQuorumCheck checks that a quorum of the etcd voting members is healthy.
+	EtcdQuorumCheck ControlPlaneReadinessCheckName = "EtcdQuorum"
+
+	// ControlPlaneNodesReadyCheck checks that all the control plane nodes are ready.
+	ControlPlaneNodesReadyCheck ControlPlaneReadinessCheckName = "ControlPlaneNodesReady"
+
+	// APIServerReachableCheck checks that the API server is reachable from the pods.
+	APIServerReachableCheck ControlPlaneReadinessCheckName = "APIServerReachable"
+
+	// CNIReadyCheck checks that the network of all the control plane nodes is set up by the CNI.
+	CNIReadyCheck ControlPlaneReadinessCheckName = "CNIReady"
+)
+
+// ControlPlaneReadinessCheck is the result of a check contributing to the readiness of the control plane.
+type ControlPlaneReadinessCheck struct {
+	// Name is the name of the check.
+	Name ControlPlaneReadinessCheckName
+
+	// Ready is true if the check succeeded.
+	Ready bool
+
+	// Message explains why the check did not succeed, or why it was skipped.
+	Message string
+}
+
+// ControlPlaneReadiness is the readiness of the control plane, along with the result of each check.
+type ControlPlaneReadiness struct {
+	// Ready is true if all the checks succeeded.
+	Ready bool
+
+	// Checks are the results of the checks, in the order they were run.
+	Checks []ControlPlaneReadinessCheck
+}
+
+// Check returns the result of the named check.
+func (r *ControlPlaneReadiness) Check(name ControlPlaneReadinessCheckName) (ControlPlaneReadinessCheck, bool) {
+	for _, check := range r.Checks {
+		if check.Name == name {
+			return check, true
+		}
+	}
+
+	return ControlPlaneReadinessCheck{}, false
+}
+
+// FailedChecks returns the results of the checks which did not succeed.
+func (r *ControlPlaneReadiness) FailedChecks() []ControlPlaneReadinessCheck {
+	failed := []ControlPlaneReadinessCheck{}
+
+	for _, check := range r.Checks {
+		if !check.Ready {
+			failed = append(failed, check)
+		}
+	}
+
+	return failed
+}
+
+// ControlPlaneReady builds the workload cluster and returns the readiness of its control plane, see
+// Workload.ControlPlaneReady. Clusters using an external etcd are not supported.
+func (m *Management) ControlPlaneReady(ctx context.Context, clusterKey ctrlclient.ObjectKey) (*ControlPlaneReadiness, error) {
+	workloadCluster, err := m.GetWorkloadCluster(ctx, clusterKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer workloadCluster.Close()
+
+	return workloadCluster.ControlPlaneReady(ctx), nil
+}
+
+// ControlPlaneReady returns whether the control plane of the workload cluster is ready, which is the case when a quorum
+// of the etcd voting members is healthy, all the control plane nodes are ready, the API server is reachable from the
+// pods, and the CNI set up the network of all the control plane nodes. Every check is run and reported, even when a
+// previous one failed, and a check which can't be run, e.g. because the nodes can't be listed, is reported as failed.
+// The etcd quorum check is skipped when the control plane uses an external etcd or the cluster does not provide etcd
+// certificates.
+func (w *Workload) ControlPlaneReady(ctx context.Context) *ControlPlaneReadiness {
+	readiness := &ControlPlaneReadiness{}
+
+	nodes, nodesErr := w.getControlPlaneNodes(ctx)
+	if nodesErr != nil {
+		nodesErr = errors.Wrap(nodesErr, "failed to list control plane nodes")
+	}
+
+	readiness.Checks = append(readiness.Checks,
+		w.etcdQuorumCheck(ctx),
+		controlPlaneNodesReadyCheck(nodes, nodesErr),
+		w.apiServerReachableCheck(ctx),
+		cniReadyCheck(nodes, nodesErr),
+	)
+
+	readiness.Ready = len(readiness.FailedChecks()) == 0
+
+	return readiness
+}
+
+// etcdQuorumCheck checks that more than half of the etcd voting members are started, reachable and without alarm,
+// and run on a ready node.
+func (w *Workload) etcdQuorumCheck(ctx context.Context) ControlPlaneReadinessCheck {
+	check := ControlPlaneReadinessCheck{Name: EtcdQuorumCheck}
+
+	if w.externalEtcd != nil || w.etcdClientGenerator == nil {
+		check.Ready = true
+		check.Message = "etcd is not managed by the control plane"
+
+		return check
+	}
+
+	members, err := w.controlPlaneNodesWithEtcdMember(ctx)
+	if err != nil {
+		check.Message = err.Error()
+
+		return check
+	}
+
+	voters, healthyVoters := 0, 0
+
+	for _, member := range members {
+		if !member.HasEtcdMember || member.IsLearner {
+			continue
+		}
+
+		voters++
+
+		if member.Healthy {
+			healthyVoters++
+		}
+	}
+
+	quorum := voters/2 + 1
+
+	check.Ready = voters > 0 && healthyVoters >= quorum
+	if !check.Ready {
+		check.Message = fmt.Sprintf("%d of %d etcd voting members are healthy, %d are required for quorum", healthyVoters, voters, quorum)
+	}
+
+	return check
+}
+
+// controlPlaneNodesReadyCheck checks that there is at least one control plane node, and that they are all ready.
+func controlPlaneNodesReadyCheck(nodes *corev1.NodeList, nodesErr error) ControlPlaneReadinessCheck {
+	check := ControlPlaneReadinessCheck{Name: ControlPlaneNodesReadyCheck}
+
+	if nodesErr != nil {
+		check.Message = nodesErr.Error()
+
+		return check
+	}
+
+	if len(nodes.Items) == 0 {
+		check.Message = "no control plane node found"
+
+		return check
+	}
+
+	notReady := []string{}
+
+	for i := range nodes.Items {
+		if !util.IsNodeReady(&nodes.Items[i]) {
+			notReady = append(notReady, nodes.Items[i].Name)
+		}
+	}
+
+	check.Ready = len(notReady) == 0
+	if !check.Ready {
+		slices.Sort(notReady)
+		check.Message = "control plane nodes are not ready: " + strings.Join(notReady, ", ")
+	}
+
+	return check
+}
+
+// apiServerReachableCheck checks that the API server is reachable from the pods, see CheckAPIServerReachableFromPods.
+func (w *Workload) apiServerReachableCheck(ctx context.Context) ControlPlaneReadinessCheck {
+	check := ControlPlaneReadinessCheck{Name: APIServerReachableCheck, Ready: true}
+
+	if _, err := w.CheckAPIServerReachableFromPods(ctx); err != nil {
+		check.Ready = false
+		check.Message = err.Error()
+	}
+
+	return check
+}
+
+// cniReadyCheck checks that no control plane node reports its network as unavailable, or its kubelet as not ready
+// because the network plugin is not initialized.
+func cniReadyCheck(nodes *corev1.NodeList, nodesErr error) ControlPlaneReadinessCheck {
+	check := ControlPlaneReadinessCheck{Name: CNIReadyCheck}
+
+	if nodesErr != nil {
+		check.Message = nodesErr.Error()
+
+		return check
+	}
+
+	notReady := []string{}
+
+	for i := range nodes.Items {
+		if nodeNetworkUnavailable(&nodes.Items[i]) || nodeNetworkPluginNotReady(&nodes.Items[i]) {
+			notReady = append(notReady, nodes.Items[i].Name)
+		}
+	}
+
+	check.Ready = len(notReady) == 0
+	if !check.Ready {
+		slices.Sort(notReady)
+		check.Message = "network is not ready on control plane nodes: " + strings.Join(notReady, ", ")
+	}
+
+	return check
+}
+
+// nodeNetworkPluginNotReady returns true if the kubelet of the node reports it is not ready as the container runtime
+// network, i.e. the CNI plugin, is not ready.
+func nodeNetworkPluginNotReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady && condition.Status != corev1.ConditionTrue {
+			return strings.Contains(condition.Message, "container runtime network not ready") ||
+				strings.Contains(condition.Message, "NetworkPluginNotReady")
+		}
+	}
+
+	return false
+}
+
+// controlPlaneNodesWithEtcdMember returns the control plane nodes joined with their etcd member from the health cached
+// by the WorkloadClusterHealthProber when the cluster is watched and its health is fresh enough, so the readiness is
+// checked without connecting to every etcd member, or lists them otherwise.
+func (w *Workload) controlPlaneNodesWithEtcdMember(ctx context.Context) ([]ControlPlaneNodeEtcdMember, error) {
+	if health, ok := w.healthProber.cached(w.clusterKey); ok {
+		return health.Members, health.Err
+	}
+
+	return w.ListControlPlaneNodesWithEtcdMember(ctx, nil)
+}
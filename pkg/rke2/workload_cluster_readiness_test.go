@@ -0,0 +1,189 @@
+package rke2
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/rancher/cluster-api-provider-rke2/pkg/etcd"
+	etcdfake "github.com/rancher/cluster-api-provider-rke2/pkg/etcd/fake"
+)
+
+func TestControlPlaneReady(t *testing.T) {
+	controlPlaneNode := func(name, address string, ready corev1.ConditionStatus, message string) *corev1.Node {
+		node := readyNode(name, "", ready)
+		node.Labels = map[string]string{labelNodeRoleControlPlane: "true"}
+		node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: address}}
+		node.Status.Conditions[0].Message = message
+
+		return node
+	}
+
+	pod := func(name string, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceSystem, Name: name, Labels: labels},
+			Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}},
+		}
+	}
+
+	endpointSlice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: metav1.NamespaceDefault,
+			Name:      "kubernetes",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "kubernetes"},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.0.0.1"}, Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)}},
+			{Addresses: []string{"10.0.0.2"}, Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)}},
+			{Addresses: []string{"10.0.0.3"}, Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)}},
+		},
+	}
+
+	etcdClientGenerator := func(forNodesErr error) *fakeEtcdClientGenerator {
+		return &fakeEtcdClientGenerator{
+			forLeaderClient: &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{
+				MemberListResponse: &clientv3.MemberListResponse{
+					Members: []*pb.Member{
+						{Name: "node-1-1a2b3c4d", ID: uint64(1)},
+						{Name: "node-2-1a2b3c4d", ID: uint64(2)},
+						{Name: "node-3-1a2b3c4d", ID: uint64(3)},
+					},
+				},
+				AlarmResponse: &clientv3.AlarmResponse{},
+			}},
+			forNodesClient: &etcd.Client{EtcdClient: &etcdfake.FakeEtcdClient{}},
+			forNodesErr:    forNodesErr,
+		}
+	}
+
+	// workload builds a workload cluster of three control plane nodes, whose third node has the given readiness.
+	workload := func(thirdNodeReady corev1.ConditionStatus, thirdNodeMessage string, forNodesErr error, objects ...client.Object) *Workload {
+		objects = append(objects,
+			controlPlaneNode("node-1", "10.0.0.1", corev1.ConditionTrue, ""),
+			controlPlaneNode("node-2", "10.0.0.2", corev1.ConditionTrue, ""),
+			controlPlaneNode("node-3", "10.0.0.3", thirdNodeReady, thirdNodeMessage),
+			pod("kube-apiserver-node-1", nil),
+			pod("kube-apiserver-node-2", nil),
+			pod("kube-apiserver-node-3", nil),
+			pod("rke2-coredns-rke2-coredns-abcde", inClusterProbeLabels),
+		)
+
+		return &Workload{
+			Client:              fake.NewClientBuilder().WithObjects(objects...).Build(),
+			etcdClientGenerator: etcdClientGenerator(forNodesErr),
+		}
+	}
+
+	checks := func(readiness *ControlPlaneReadiness) map[ControlPlaneReadinessCheckName]bool {
+		results := map[ControlPlaneReadinessCheckName]bool{}
+		for _, check := range readiness.Checks {
+			results[check.Name] = check.Ready
+		}
+
+		return results
+	}
+
+	t.Run("is ready when every check succeeds", func(t *testing.T) {
+		g := NewWithT(t)
+
+		readiness := workload(corev1.ConditionTrue, "", nil, endpointSlice).ControlPlaneReady(context.Background())
+		g.Expect(readiness.Ready).To(BeTrue())
+		g.Expect(readiness.FailedChecks()).To(BeEmpty())
+		g.Expect(checks(readiness)).To(Equal(map[ControlPlaneReadinessCheckName]bool{
+			EtcdQuorumCheck:             true,
+			ControlPlaneNodesReadyCheck: true,
+			APIServerReachableCheck:     true,
+			CNIReadyCheck:               true,
+		}))
+	})
+
+	t.Run("keeps etcd quorum with a node which is not ready", func(t *testing.T) {
+		g := NewWithT(t)
+
+		readiness := workload(corev1.ConditionFalse, "kubelet stopped posting node status", nil, endpointSlice).
+			ControlPlaneReady(context.Background())
+		g.Expect(readiness.Ready).To(BeFalse())
+		g.Expect(checks(readiness)).To(Equal(map[ControlPlaneReadinessCheckName]bool{
+			EtcdQuorumCheck:             true,
+			ControlPlaneNodesReadyCheck: false,
+			APIServerReachableCheck:     true,
+			CNIReadyCheck:               true,
+		}))
+
+		check, found := readiness.Check(ControlPlaneNodesReadyCheck)
+		g.Expect(found).To(BeTrue())
+		g.Expect(check.Message).To(ContainSubstring("node-3"))
+	})
+
+	t.Run("reports a node whose CNI is not ready", func(t *testing.T) {
+		g := NewWithT(t)
+
+		readiness := workload(corev1.ConditionFalse,
+			"container runtime network not ready: NetworkReady=false reason:NetworkPluginNotReady", nil, endpointSlice).
+			ControlPlaneReady(context.Background())
+		g.Expect(readiness.Ready).To(BeFalse())
+		g.Expect(checks(readiness)).To(Equal(map[ControlPlaneReadinessCheckName]bool{
+			EtcdQuorumCheck:             true,
+			ControlPlaneNodesReadyCheck: false,
+			APIServerReachableCheck:     true,
+			CNIReadyCheck:               false,
+		}))
+
+		check, _ := readiness.Check(CNIReadyCheck)
+		g.Expect(check.Message).To(ContainSubstring("node-3"))
+	})
+
+	t.Run("reports a lost etcd quorum", func(t *testing.T) {
+		g := NewWithT(t)
+
+		readiness := workload(corev1.ConditionTrue, "", errors.New("no client"), endpointSlice).ControlPlaneReady(context.Background())
+		g.Expect(readiness.Ready).To(BeFalse())
+		g.Expect(checks(readiness)).To(Equal(map[ControlPlaneReadinessCheckName]bool{
+			EtcdQuorumCheck:             false,
+			ControlPlaneNodesReadyCheck: true,
+			APIServerReachableCheck:     true,
+			CNIReadyCheck:               true,
+		}))
+
+		check, _ := readiness.Check(EtcdQuorumCheck)
+		g.Expect(check.Message).To(Equal("0 of 3 etcd voting members are healthy, 2 are required for quorum"))
+	})
+
+	t.Run("reports an API server which is not reachable from the pods", func(t *testing.T) {
+		g := NewWithT(t)
+
+		readiness := workload(corev1.ConditionTrue, "", nil).ControlPlaneReady(context.Background())
+		g.Expect(readiness.Ready).To(BeFalse())
+		g.Expect(checks(readiness)).To(Equal(map[ControlPlaneReadinessCheckName]bool{
+			EtcdQuorumCheck:             true,
+			ControlPlaneNodesReadyCheck: true,
+			APIServerReachableCheck:     false,
+			CNIReadyCheck:               true,
+		}))
+	})
+
+	t.Run("skips the etcd quorum check without etcd client", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := workload(corev1.ConditionTrue, "", nil, endpointSlice)
+		w.etcdClientGenerator = nil
+
+		readiness := w.ControlPlaneReady(context.Background())
+		g.Expect(readiness.Ready).To(BeTrue())
+
+		check, _ := readiness.Check(EtcdQuorumCheck)
+		g.Expect(check.Ready).To(BeTrue())
+		g.Expect(check.Message).ToNot(BeEmpty())
+	})
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// secretsEncryptionHashAnnotation is the annotation RKE2 sets on the server nodes with the secrets encryption stage
+// and the hash of the encryption config the server is using, e.g. "rotate-1a2b3c".
+const secretsEncryptionHashAnnotation = "rke2.io/encryption-config-hash"
+
+// SecretsEncryptionStage is a stage of the RKE2 secrets encryption key rotation.
+type SecretsEncryptionStage string
+
+const (
+	// SecretsEncryptionStart is the stage of servers whose encryption key was never rotated.
+	SecretsEncryptionStart SecretsEncryptionStage = "start"
+
+	// SecretsEncryptionPrepare is the stage of servers which added a new encryption key, not used for encryption yet.
+	SecretsEncryptionPrepare SecretsEncryptionStage = "prepare"
+
+	// SecretsEncryptionRotate is the stage of servers which encrypt secrets with the new encryption key.
+	SecretsEncryptionRotate SecretsEncryptionStage = "rotate"
+
+	// SecretsEncryptionReencrypt is the stage requested to re-encrypt the existing secrets with the new encryption key.
+	SecretsEncryptionReencrypt SecretsEncryptionStage = "reencrypt"
+
+	// SecretsEncryptionReencryptRequest is the stage of servers which were requested to re-encrypt the secrets.
+	SecretsEncryptionReencryptRequest SecretsEncryptionStage = "reencrypt_request"
+
+	// SecretsEncryptionReencryptActive is the stage of servers re-encrypting the secrets.
+	SecretsEncryptionReencryptActive SecretsEncryptionStage = "reencrypt_active"
+
+	// SecretsEncryptionReencryptFinished is the stage of servers which re-encrypted the secrets and removed the previous key.
+	SecretsEncryptionReencryptFinished SecretsEncryptionStage = "reencrypt_finished"
+)
+
+// ErrSecretsEncryptionDisabled is returned when secrets encryption is not enabled on the workload cluster.
+var ErrSecretsEncryptionDisabled = errors.New("secrets encryption is disabled")
+
+// ErrSupervisorNotAvailable is returned when the RKE2 supervisor API can't be called, as the cluster token is unknown.
+var ErrSupervisorNotAvailable = errors.New("RKE2 supervisor API is not available")
+
+// SecretsEncryptionSpec is the desired secrets encryption of the workload cluster.
+type SecretsEncryptionSpec struct {
+	// RotateKeys requests a new encryption key and the re-encryption of the existing secrets with it. It is ignored
+	// while a rotation is in progress.
+	RotateKeys bool
+}
+
+// SecretsEncryptionProgress reports the progress of the secrets encryption key rotation.
+type SecretsEncryptionProgress struct {
+	// Stage is the stage of the most advanced control plane node.
+	Stage SecretsEncryptionStage
+
+	// Nodes are the control plane nodes which reached the stage with the same encryption config.
+	Nodes []string
+
+	// PendingNodes are the control plane nodes which did not reach the stage, or use a different encryption config.
+	PendingNodes []string
+
+	// Completed is true when no rotation is in progress.
+	Completed bool
+}
+
+// SecretsEncryptionIncompleteError is returned when only part of the control plane nodes reached a stage of the key
+// rotation, so the rotation can't proceed with the next stage yet.
+type SecretsEncryptionIncompleteError struct {
+	// Stage is the stage the rotation is waiting for.
+	Stage SecretsEncryptionStage
+
+	// PendingNodes are the control plane nodes which did not reach the stage yet.
+	PendingNodes []string
+}
+
+func (e *SecretsEncryptionIncompleteError) Error() string {
+	return fmt.Sprintf("secrets encryption stage %s is not active on nodes %s yet", e.Stage, strings.Join(e.PendingNodes, ", "))
+}
+
+// EnsureSecretsEncryption verifies that secrets encryption is enabled, and moves the encryption key rotation forward.
+// A rotation goes through the prepare, rotate and reencrypt stages; a stage is only requested once all the control
+// plane nodes report the previous one with the same encryption config, so the new key is active on every server
+// before being used and before the existing secrets are re-encrypted. Servers pick up a new stage once RKE2 reloads
+// the encryption config, the rotation does not progress until they do.
+//
+// EnsureSecretsEncryption is meant to be called until the returned progress is completed, with RotateKeys only set
+// for the first call. A SecretsEncryptionIncompleteError is returned while nodes are pending.
+func (w *Workload) EnsureSecretsEncryption(ctx context.Context, desired SecretsEncryptionSpec) (*SecretsEncryptionProgress, error) {
+	if w.supervisorClientFor == nil {
+		return nil, ErrSupervisorNotAvailable
+	}
+
+	nodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list control plane nodes")
+	}
+
+	if len(nodes.Items) == 0 {
+		return nil, errors.New("no control plane node found")
+	}
+
+	supervisor, err := w.supervisorClientFor(nodes.Items[0].Name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create supervisor client for node %s", nodes.Items[0].Name)
+	}
+
+	status, err := supervisor.SecretsEncryptionStatus(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get secrets encryption status")
+	}
+
+	if status.Enable == nil || !*status.Enable {
+		return nil, ErrSecretsEncryptionDisabled
+	}
+
+	progress := secretsEncryptionProgress(nodes.Items)
+	if len(progress.PendingNodes) > 0 {
+		return progress, &SecretsEncryptionIncompleteError{Stage: progress.Stage, PendingNodes: progress.PendingNodes}
+	}
+
+	var next SecretsEncryptionStage
+
+	switch progress.Stage {
+	case "":
+		return progress, errors.New("secrets encryption stage is not reported by the control plane nodes")
+	case SecretsEncryptionStart, SecretsEncryptionReencryptFinished:
+		if !desired.RotateKeys {
+			progress.Completed = true
+
+			return progress, nil
+		}
+
+		next = SecretsEncryptionPrepare
+	case SecretsEncryptionPrepare:
+		next = SecretsEncryptionRotate
+	case SecretsEncryptionRotate:
+		next = SecretsEncryptionReencrypt
+	default:
+		// The re-encryption is in progress.
+		return progress, nil
+	}
+
+	if err := supervisor.SetSecretsEncryptionStage(ctx, next); err != nil {
+		return progress, errors.Wrapf(err, "failed to request secrets encryption stage %s", next)
+	}
+
+	log.FromContext(ctx).Info("Requested secrets encryption stage", "stage", next)
+
+	return progress, nil
+}
+
+// secretsEncryptionProgress returns the stage reached by the nodes. The stage is the one of the most advanced node,
+// nodes which report another stage or another encryption config are pending.
+func secretsEncryptionProgress(nodes []corev1.Node) *SecretsEncryptionProgress {
+	progress := &SecretsEncryptionProgress{}
+
+	// Once a node prepared or rotated a new key, the nodes which did not pick up the new rotation yet are behind it.
+	rotationStarted := slices.ContainsFunc(nodes, func(node corev1.Node) bool {
+		nodeStage, _ := parseSecretsEncryptionHash(node.Annotations[secretsEncryptionHashAnnotation])
+
+		return nodeStage == SecretsEncryptionPrepare || nodeStage == SecretsEncryptionRotate
+	})
+
+	order := func(stage SecretsEncryptionStage) int {
+		if rotationStarted && (stage == SecretsEncryptionStart || stage == SecretsEncryptionReencryptFinished) {
+			return 0
+		}
+
+		return secretsEncryptionStageOrder(stage)
+	}
+
+	var (
+		stage SecretsEncryptionStage
+		hash  string
+	)
+
+	for i := range nodes {
+		nodeStage, nodeHash := parseSecretsEncryptionHash(nodes[i].Annotations[secretsEncryptionHashAnnotation])
+		if stage == "" || order(nodeStage) > order(stage) {
+			stage, hash = nodeStage, nodeHash
+		}
+	}
+
+	progress.Stage = stage
+
+	for i := range nodes {
+		nodeStage, nodeHash := parseSecretsEncryptionHash(nodes[i].Annotations[secretsEncryptionHashAnnotation])
+		if nodeStage == stage && nodeHash == hash {
+			progress.Nodes = append(progress.Nodes, nodes[i].Name)
+		} else {
+			progress.PendingNodes = append(progress.PendingNodes, nodes[i].Name)
+		}
+	}
+
+	return progress
+}
+
+// parseSecretsEncryptionHash splits the secrets encryption hash annotation value into its stage and hash.
+func parseSecretsEncryptionHash(value string) (SecretsEncryptionStage, string) {
+	index := strings.LastIndex(value, "-")
+	if index == -1 {
+		return SecretsEncryptionStage(value), ""
+	}
+
+	return SecretsEncryptionStage(value[:index]), value[index+1:]
+}
+
+// secretsEncryptionStageOrder returns the position of the stage in a key rotation, unknown stages come first.
+func secretsEncryptionStageOrder(stage SecretsEncryptionStage) int {
+	switch stage {
+	case SecretsEncryptionStart:
+		return 1
+	case SecretsEncryptionPrepare:
+		return 2 //nolint:mnd
+	case SecretsEncryptionRotate:
+		return 3 //nolint:mnd
+	case SecretsEncryptionReencryptRequest:
+		return 4 //nolint:mnd
+	case SecretsEncryptionReencryptActive:
+		return 5 //nolint:mnd
+	case SecretsEncryptionReencryptFinished:
+		return 6 //nolint:mnd
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,143 @@
+package rke2
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeSupervisorClient struct {
+	enabled         bool
+	requestedStages []SecretsEncryptionStage
+}
+
+func (c *fakeSupervisorClient) SecretsEncryptionStatus(context.Context) (*supervisorEncryptionState, error) {
+	return &supervisorEncryptionState{Enable: ptr.To(c.enabled)}, nil
+}
+
+func (c *fakeSupervisorClient) SetSecretsEncryptionStage(_ context.Context, stage SecretsEncryptionStage) error {
+	c.requestedStages = append(c.requestedStages, stage)
+
+	return nil
+}
+
+func (c *fakeSupervisorClient) TokenAccepted(context.Context) (bool, error) {
+	return true, nil
+}
+
+func TestEnsureSecretsEncryption(t *testing.T) {
+	// workload returns a workload cluster whose control plane nodes report the given encryption config hash annotations.
+	workload := func(supervisor *fakeSupervisorClient, hashes ...string) *Workload {
+		objects := []client.Object{}
+
+		for i, hash := range hashes {
+			objects = append(objects, &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:        []string{"node-1", "node-2", "node-3"}[i],
+				Labels:      map[string]string{labelNodeRoleControlPlane: "true"},
+				Annotations: map[string]string{secretsEncryptionHashAnnotation: hash},
+			}})
+		}
+
+		return &Workload{
+			Client:              fake.NewClientBuilder().WithObjects(objects...).Build(),
+			supervisorClientFor: func(string) (supervisorClient, error) { return supervisor, nil },
+		}
+	}
+
+	t.Run("fails when secrets encryption is disabled", func(t *testing.T) {
+		g := NewWithT(t)
+
+		supervisor := &fakeSupervisorClient{}
+
+		_, err := workload(supervisor, "start-aaa").EnsureSecretsEncryption(context.Background(), SecretsEncryptionSpec{})
+		g.Expect(err).To(MatchError(ErrSecretsEncryptionDisabled))
+	})
+
+	t.Run("reports completion when no rotation is requested", func(t *testing.T) {
+		g := NewWithT(t)
+
+		supervisor := &fakeSupervisorClient{enabled: true}
+
+		progress, err := workload(supervisor, "reencrypt_finished-aaa", "reencrypt_finished-aaa").
+			EnsureSecretsEncryption(context.Background(), SecretsEncryptionSpec{})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(progress.Completed).To(BeTrue())
+		g.Expect(supervisor.requestedStages).To(BeEmpty())
+	})
+
+	t.Run("moves the rotation forward once all the nodes reached a stage", func(t *testing.T) {
+		for _, tt := range []struct {
+			hash string
+			next SecretsEncryptionStage
+		}{
+			{hash: "start-aaa", next: SecretsEncryptionPrepare},
+			{hash: "prepare-bbb", next: SecretsEncryptionRotate},
+			{hash: "rotate-ccc", next: SecretsEncryptionReencrypt},
+		} {
+			g := NewWithT(t)
+
+			supervisor := &fakeSupervisorClient{enabled: true}
+
+			progress, err := workload(supervisor, tt.hash, tt.hash, tt.hash).
+				EnsureSecretsEncryption(context.Background(), SecretsEncryptionSpec{RotateKeys: true})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(progress.Completed).To(BeFalse())
+			g.Expect(progress.Nodes).To(ConsistOf("node-1", "node-2", "node-3"))
+			g.Expect(supervisor.requestedStages).To(Equal([]SecretsEncryptionStage{tt.next}))
+		}
+	})
+
+	t.Run("waits for the re-encryption to finish", func(t *testing.T) {
+		g := NewWithT(t)
+
+		supervisor := &fakeSupervisorClient{enabled: true}
+
+		progress, err := workload(supervisor, "reencrypt_active-ccc", "reencrypt_active-ccc").
+			EnsureSecretsEncryption(context.Background(), SecretsEncryptionSpec{RotateKeys: true})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(progress.Stage).To(Equal(SecretsEncryptionReencryptActive))
+		g.Expect(progress.Completed).To(BeFalse())
+		g.Expect(supervisor.requestedStages).To(BeEmpty())
+	})
+
+	t.Run("does not move forward while nodes are pending", func(t *testing.T) {
+		g := NewWithT(t)
+
+		supervisor := &fakeSupervisorClient{enabled: true}
+
+		progress, err := workload(supervisor, "prepare-bbb", "reencrypt_finished-aaa", "prepare-bbb").
+			EnsureSecretsEncryption(context.Background(), SecretsEncryptionSpec{RotateKeys: true})
+
+		incompleteErr := &SecretsEncryptionIncompleteError{}
+		g.Expect(err).To(BeAssignableToTypeOf(incompleteErr))
+		g.Expect(err.(*SecretsEncryptionIncompleteError).Stage).To(Equal(SecretsEncryptionPrepare))
+		g.Expect(err.(*SecretsEncryptionIncompleteError).PendingNodes).To(ConsistOf("node-2"))
+		g.Expect(progress.Nodes).To(ConsistOf("node-1", "node-3"))
+		g.Expect(supervisor.requestedStages).To(BeEmpty())
+	})
+
+	t.Run("nodes with another encryption config are pending", func(t *testing.T) {
+		g := NewWithT(t)
+
+		supervisor := &fakeSupervisorClient{enabled: true}
+
+		progress, err := workload(supervisor, "rotate-ccc", "rotate-ddd").
+			EnsureSecretsEncryption(context.Background(), SecretsEncryptionSpec{})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(progress.PendingNodes).To(HaveLen(1))
+		g.Expect(supervisor.requestedStages).To(BeEmpty())
+	})
+
+	t.Run("is not available without the cluster token", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := (&Workload{}).EnsureSecretsEncryption(context.Background(), SecretsEncryptionSpec{})
+		g.Expect(err).To(MatchError(ErrSupervisorNotAvailable))
+	})
+}
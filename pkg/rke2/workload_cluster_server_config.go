@@ -0,0 +1,463 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+const (
+	// InPlaceServerConfigImage is the image of the pods applying the server config in place on the nodes. It is pulled
+	// from the system default registry of the control plane if set, and through its private registry mirrors otherwise.
+	InPlaceServerConfigImage = "rancher/mirrored-library-busybox:1.36.1"
+
+	// maxInPlaceServerConfigAttempts is the number of times applying a server config in place on a machine is attempted
+	// before the machine is rolled out instead.
+	maxInPlaceServerConfigAttempts = 3
+
+	// inPlaceServerConfigPodTimeout is the duration after which a pod applying the server config in place which did not
+	// complete, e.g. because its image can't be pulled, is considered as failed. It is also the active deadline of the
+	// pod, so the kubelet stops a pod hanging on the node even if the controller does not delete it.
+	inPlaceServerConfigPodTimeout = 10 * time.Minute
+
+	// inPlaceServerConfigFile is the RKE2 config drop-in file holding the server config applied in place. Drop-in files
+	// are read after the main config file, their keys replace the ones of the main config file.
+	inPlaceServerConfigFile = "/etc/rancher/rke2/config.yaml.d/50-capi-in-place.yaml"
+
+	// inPlaceServerConfigPodPrefix is the name prefix of the pods applying the server config in place.
+	inPlaceServerConfigPodPrefix = "rke2-server-config-"
+
+	// inPlaceServerConfigHashAnnotation is the annotation holding the hash of the server config applied by a pod.
+	inPlaceServerConfigHashAnnotation = "controlplane.cluster.x-k8s.io/server-config-hash"
+
+	// inPlaceServerConfigFailedAnnotation is the machine annotation holding the hash of the server config which failed to
+	// be applied in place on the machine. The machine is rolled out instead, as long as this config is the desired one.
+	inPlaceServerConfigFailedAnnotation = "controlplane.cluster.x-k8s.io/server-config-in-place-failed"
+
+	// inPlaceServerConfigAttemptsAnnotation is the machine annotation holding the hash of the server config being applied
+	// in place on the machine and the number of failed attempts, separated by a colon.
+	inPlaceServerConfigAttemptsAnnotation = "controlplane.cluster.x-k8s.io/server-config-in-place-attempts"
+
+	// defaultEtcdSnapshotScheduleCron and defaultEtcdSnapshotRetention are the RKE2 defaults of the etcd snapshot
+	// schedule and retention, written to the in place config drop-in file when they are not set, so that unsetting them
+	// restores the defaults.
+	defaultEtcdSnapshotScheduleCron = "0 */12 * * *"
+	defaultEtcdSnapshotRetention    = "5"
+
+	// inPlaceServerConfigScript writes the server config drop-in file and restarts rke2-server to load it.
+	inPlaceServerConfigScript = `set -e
+mkdir -p "$(dirname "$RKE2_CONFIG_FILE")"
+printf '%s\n' "$RKE2_CONFIG" > "$RKE2_CONFIG_FILE"
+systemctl restart rke2-server`
+)
+
+// hotReloadableServerConfig is the part of the server config which can be changed on an existing node by restarting
+// rke2-server, it is written to the in place config drop-in file. Its fields track the hot-reloadable server config
+// fields: the extra args of the kube-apiserver, kube-controller-manager and kube-scheduler, the etcd snapshot
+// schedule and retention, and the TLS SANs. The TLS SANs are appended to the ones of the main config file, which also
+// holds the control plane endpoint, so that SANs can only be added in place.
+type hotReloadableServerConfig struct {
+	KubeAPIServerArgs         []string `yaml:"kube-apiserver-arg"`
+	KubeControllerManagerArgs []string `yaml:"kube-controller-manager-arg"`
+	KubeSchedulerArgs         []string `yaml:"kube-scheduler-arg"`
+	EtcdSnapshotScheduleCron  string   `yaml:"etcd-snapshot-schedule-cron"`
+	EtcdSnapshotRetention     string   `yaml:"etcd-snapshot-retention"`
+	TLSSANs                   []string `yaml:"tls-san+,omitempty"`
+}
+
+// errInPlaceServerConfigFailed is returned when the pod applying the server config in place on a node failed.
+var errInPlaceServerConfigFailed = errors.New("server config pod failed")
+
+// ReconcileRKE2ServerConfigInPlace applies changes of the hot-reloadable server config fields to the control plane
+// nodes, when enabled by the InPlaceServerConfigUpdatesAnnotation. Other changes are not applied in place and still
+// require a rollout. The config is written to an RKE2 config drop-in file and rke2-server is restarted by a privileged
+// pod, one node at a time; the server config annotation of the machine is updated once it completed.
+//
+// The returned bool is true while an update is in progress, the call is meant to be repeated until it is false.
+// rke2-server is never restarted on the only ready control plane node, as the workload cluster would be unreachable
+// while it restarts. When applying the config fails maxInPlaceServerConfigAttempts times on a node, its machine is
+// marked so that it is rolled out instead. The machine annotations are updated, the caller is expected to patch the
+// machines.
+func (w *Workload) ReconcileRKE2ServerConfigInPlace(ctx context.Context, controlPlane *ControlPlane) (bool, error) {
+	rcp := controlPlane.RCP
+	if !inPlaceServerConfigUpdatesEnabled(rcp) {
+		return false, nil
+	}
+
+	desired := hotReloadableServerConfigFor(&rcp.Spec.ServerConfig)
+	image := inPlaceServerConfigImage(rcp)
+
+	for _, machine := range controlPlane.Machines.Filter(collections.Not(collections.HasDeletionTimestamp)).SortedByCreationTimestamp() {
+		machineServerConfig, ok := recordedServerConfig(machine)
+		if !ok || machine.Status.NodeRef == nil {
+			continue
+		}
+
+		// Machines with other server config changes, removed TLS SANs, or on which applying the config in place failed,
+		// are rolled out instead.
+		if !matchServerConfig(rcp, machine) || !matchTLSSANs(rcp, machine) || !inPlaceServerConfigUpdatesApply(rcp, machine) {
+			continue
+		}
+
+		if reflect.DeepEqual(normalizedHotReloadableServerConfig(hotReloadableServerConfigFor(machineServerConfig)),
+			normalizedHotReloadableServerConfig(desired)) {
+			continue
+		}
+
+		nodeName := machine.Status.NodeRef.Name
+
+		done, err := w.applyServerConfigInPlace(ctx, nodeName, image, desired)
+		if errors.Is(err, errInPlaceServerConfigFailed) {
+			_, configHash, hashErr := marshalHotReloadableServerConfig(desired)
+			if hashErr != nil {
+				return true, hashErr
+			}
+
+			attempts := recordInPlaceServerConfigAttempt(machine, configHash)
+			if attempts < maxInPlaceServerConfigAttempts {
+				log.FromContext(ctx).Error(err, "Failed to apply server config in place, retrying",
+					"machine", machine.Name, "node", nodeName, "attempts", attempts)
+
+				return true, nil
+			}
+
+			machine.Annotations[inPlaceServerConfigFailedAnnotation] = configHash
+			delete(machine.Annotations, inPlaceServerConfigAttemptsAnnotation)
+
+			log.FromContext(ctx).Error(err, "Failed to apply server config in place, the machine will be rolled out",
+				"machine", machine.Name, "node", nodeName, "attempts", attempts)
+
+			return true, nil
+		}
+
+		if err != nil {
+			return true, errors.Wrapf(err, "failed to apply server config in place on node %s", nodeName)
+		}
+
+		if !done {
+			return true, nil
+		}
+
+		// Only the hot-reloadable fields are updated, so other changes recorded for the machine are kept.
+		setHotReloadableServerConfig(machineServerConfig, &rcp.Spec.ServerConfig)
+
+		serverConfig, err := json.Marshal(machineServerConfig)
+		if err != nil {
+			return true, errors.Wrap(err, "failed to marshal server config")
+		}
+
+		machine.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation] = string(serverConfig)
+		delete(machine.Annotations, inPlaceServerConfigFailedAnnotation)
+		delete(machine.Annotations, inPlaceServerConfigAttemptsAnnotation)
+
+		log.FromContext(ctx).Info("Applied server config in place", "machine", machine.Name, "node", nodeName)
+	}
+
+	return false, nil
+}
+
+// recordInPlaceServerConfigAttempt records a failed attempt to apply the server config with the given hash in place on
+// the machine, and returns the number of failed attempts for this config.
+func recordInPlaceServerConfigAttempt(machine *clusterv1.Machine, configHash string) int {
+	attempts := 0
+
+	if hash, count, ok := strings.Cut(machine.Annotations[inPlaceServerConfigAttemptsAnnotation], ":"); ok && hash == configHash {
+		attempts, _ = strconv.Atoi(count)
+	}
+
+	attempts++
+	machine.Annotations[inPlaceServerConfigAttemptsAnnotation] = configHash + ":" + strconv.Itoa(attempts)
+
+	return attempts
+}
+
+// inPlaceServerConfigImage returns the image of the pods applying the server config in place, from the system default
+// registry of the control plane if set. Otherwise the image is pulled from its default registry, through the private
+// registry mirrors configured on the nodes if any.
+func inPlaceServerConfigImage(rcp *controlplanev1.RKE2ControlPlane) string {
+	registry := strings.TrimSuffix(rcp.Spec.AgentConfig.SystemDefaultRegistry, "/")
+	if registry == "" {
+		return InPlaceServerConfigImage
+	}
+
+	return registry + "/" + InPlaceServerConfigImage
+}
+
+// applyServerConfigInPlace runs the pod applying the server config on the node, and returns true once it succeeded.
+// A pod applying a previous server config is replaced, a pod which did not complete within the
+// inPlaceServerConfigPodTimeout is deleted and reported as failed.
+func (w *Workload) applyServerConfigInPlace(
+	ctx context.Context,
+	nodeName, image string,
+	config hotReloadableServerConfig,
+) (bool, error) {
+	content, configHash, err := marshalHotReloadableServerConfig(config)
+	if err != nil {
+		return false, err
+	}
+
+	podKey := ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: inPlaceServerConfigPodPrefix + nodeName}
+
+	pod := &corev1.Pod{}
+	if err := w.Get(ctx, podKey, pod); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, errors.Wrap(err, "failed to get server config pod")
+		}
+
+		if err := w.checkOtherAPIServerAvailable(ctx, nodeName); err != nil {
+			return false, err
+		}
+
+		if err := w.Create(ctx, newInPlaceServerConfigPod(podKey, nodeName, image, content, configHash)); err != nil {
+			return false, errors.Wrap(err, "failed to create server config pod")
+		}
+
+		return false, nil
+	}
+
+	if pod.Annotations[inPlaceServerConfigHashAnnotation] != configHash {
+		return false, w.deleteInPlaceServerConfigPod(ctx, pod)
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		return true, w.deleteInPlaceServerConfigPod(ctx, pod)
+	case corev1.PodFailed:
+		if err := w.deleteInPlaceServerConfigPod(ctx, pod); err != nil {
+			return false, err
+		}
+
+		return false, errInPlaceServerConfigFailed
+	default:
+		if pod.CreationTimestamp.IsZero() || time.Since(pod.CreationTimestamp.Time) < inPlaceServerConfigPodTimeout {
+			return false, nil
+		}
+
+		if err := w.deleteInPlaceServerConfigPod(ctx, pod); err != nil {
+			return false, err
+		}
+
+		return false, errors.Wrapf(errInPlaceServerConfigFailed, "server config pod did not complete within %s",
+			inPlaceServerConfigPodTimeout)
+	}
+}
+
+// marshalHotReloadableServerConfig returns the content of the in place config drop-in file for the config, and its hash.
+func marshalHotReloadableServerConfig(config hotReloadableServerConfig) (string, string, error) {
+	content, err := yaml.Marshal(config)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to marshal server config")
+	}
+
+	hash := sha256.Sum256(content)
+
+	return string(content), hex.EncodeToString(hash[:]), nil
+}
+
+func (w *Workload) deleteInPlaceServerConfigPod(ctx context.Context, pod *corev1.Pod) error {
+	if err := w.Delete(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "failed to delete server config pod")
+	}
+
+	return nil
+}
+
+// newInPlaceServerConfigPod returns a pod writing the server config drop-in file on the node and restarting
+// rke2-server. It runs privileged in the host PID namespace, and enters the namespaces of the host init process as
+// root, as the config file and the rke2-server unit are on the host, see InPlaceServerConfigUpdatesAnnotation.
+func newInPlaceServerConfigPod(key ctrlclient.ObjectKey, nodeName, image, config, configHash string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   key.Namespace,
+			Name:        key.Name,
+			Annotations: map[string]string{inPlaceServerConfigHashAnnotation: configHash},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:              nodeName,
+			HostPID:               true,
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: ptr.To(int64(inPlaceServerConfigPodTimeout.Seconds())),
+			Tolerations:           []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Containers: []corev1.Container{{
+				Name:    "server-config",
+				Image:   image,
+				Command: []string{"nsenter", "--target", "1", "--mount", "--uts", "--ipc", "--net", "--", "sh", "-c", inPlaceServerConfigScript},
+				Env: []corev1.EnvVar{
+					{Name: "RKE2_CONFIG", Value: config},
+					{Name: "RKE2_CONFIG_FILE", Value: inPlaceServerConfigFile},
+				},
+				SecurityContext: &corev1.SecurityContext{Privileged: ptr.To(true)},
+			}},
+		},
+	}
+}
+
+// inPlaceServerConfigUpdatesEnabled returns true if changes of the hot-reloadable server config fields of the RCP are
+// applied in place. The args of a defaults ConfigMap are merged when the machines are bootstrapped, so they can't be
+// applied in place.
+func inPlaceServerConfigUpdatesEnabled(rcp *controlplanev1.RKE2ControlPlane) bool {
+	return rcp.GetAnnotations()[controlplanev1.InPlaceServerConfigUpdatesAnnotation] == "true" &&
+		rcp.Spec.ServerConfig.DefaultsConfigMap == nil
+}
+
+// inPlaceServerConfigUpdatesApply returns true if changes of the hot-reloadable server config fields of the RCP are
+// applied in place on the machine, that is if they are enabled and applying the desired config did not fail on the
+// machine.
+func inPlaceServerConfigUpdatesApply(rcp *controlplanev1.RKE2ControlPlane, machine *clusterv1.Machine) bool {
+	if !inPlaceServerConfigUpdatesEnabled(rcp) {
+		return false
+	}
+
+	failedConfigHash, ok := machine.GetAnnotations()[inPlaceServerConfigFailedAnnotation]
+	if !ok {
+		return true
+	}
+
+	_, configHash, err := marshalHotReloadableServerConfig(hotReloadableServerConfigFor(&rcp.Spec.ServerConfig))
+
+	return err == nil && configHash != failedConfigHash
+}
+
+// recordedServerConfig returns the server config recorded in the machine annotation, and false if it is missing or
+// invalid.
+func recordedServerConfig(machine *clusterv1.Machine) (*controlplanev1.RKE2ServerConfig, bool) {
+	machineServerConfigStr, ok := machine.GetAnnotations()[controlplanev1.RKE2ServerConfigurationAnnotation]
+	if !ok {
+		return nil, false
+	}
+
+	machineServerConfig := &controlplanev1.RKE2ServerConfig{}
+	if err := json.Unmarshal([]byte(machineServerConfigStr), &machineServerConfig); err != nil || machineServerConfig == nil {
+		return nil, false
+	}
+
+	return machineServerConfig, true
+}
+
+// hotReloadableServerConfigFor returns the hot-reloadable fields of the server config, with the etcd snapshot
+// schedule and retention defaulted.
+func hotReloadableServerConfigFor(serverConfig *controlplanev1.RKE2ServerConfig) hotReloadableServerConfig {
+	config := hotReloadableServerConfig{
+		KubeAPIServerArgs:         componentArgs(serverConfig.KubeAPIServer),
+		KubeControllerManagerArgs: componentArgs(serverConfig.KubeControllerManager),
+		KubeSchedulerArgs:         componentArgs(serverConfig.KubeScheduler),
+		EtcdSnapshotScheduleCron:  serverConfig.Etcd.BackupConfig.ScheduleCron,
+		EtcdSnapshotRetention:     serverConfig.Etcd.BackupConfig.Retention,
+		TLSSANs:                   slices.Clone(serverConfig.TLSSan),
+	}
+
+	if config.EtcdSnapshotScheduleCron == "" {
+		config.EtcdSnapshotScheduleCron = defaultEtcdSnapshotScheduleCron
+	}
+
+	if config.EtcdSnapshotRetention == "" {
+		config.EtcdSnapshotRetention = defaultEtcdSnapshotRetention
+	}
+
+	return config
+}
+
+// normalizedHotReloadableServerConfig returns a copy of the config with the args and TLS SANs sorted and deduplicated.
+func normalizedHotReloadableServerConfig(config hotReloadableServerConfig) hotReloadableServerConfig {
+	return hotReloadableServerConfig{
+		KubeAPIServerArgs:         normalizeArgs(config.KubeAPIServerArgs),
+		KubeControllerManagerArgs: normalizeArgs(config.KubeControllerManagerArgs),
+		KubeSchedulerArgs:         normalizeArgs(config.KubeSchedulerArgs),
+		EtcdSnapshotScheduleCron:  strings.TrimSpace(config.EtcdSnapshotScheduleCron),
+		EtcdSnapshotRetention:     strings.TrimSpace(config.EtcdSnapshotRetention),
+		TLSSANs:                   normalizeTLSSANs(config.TLSSANs),
+	}
+}
+
+// clearEtcdSnapshotConfig removes the etcd snapshot schedule and retention, which are hot-reloadable fields, from the
+// server config.
+func clearEtcdSnapshotConfig(serverConfig *controlplanev1.RKE2ServerConfig) {
+	serverConfig.Etcd.BackupConfig.ScheduleCron = ""
+	serverConfig.Etcd.BackupConfig.Retention = ""
+}
+
+// clearComponentArgs removes the extra args of the kube-apiserver, kube-controller-manager and kube-scheduler, which
+// are the hot-reloadable fields, from the server config. Component configs left empty are removed, so they match the
+// ones which were never set.
+func clearComponentArgs(serverConfig *controlplanev1.RKE2ServerConfig) {
+	for _, componentConfig := range []**bootstrapv1.ComponentConfig{
+		&serverConfig.KubeAPIServer, &serverConfig.KubeControllerManager, &serverConfig.KubeScheduler,
+	} {
+		if *componentConfig == nil {
+			continue
+		}
+
+		(*componentConfig).ExtraArgs = nil
+
+		if reflect.DeepEqual(**componentConfig, bootstrapv1.ComponentConfig{}) {
+			*componentConfig = nil
+		}
+	}
+}
+
+// setHotReloadableServerConfig sets the hot-reloadable fields of the server config to the ones of the source config.
+func setHotReloadableServerConfig(serverConfig, source *controlplanev1.RKE2ServerConfig) {
+	clearComponentArgs(serverConfig)
+
+	serverConfig.Etcd.BackupConfig.ScheduleCron = source.Etcd.BackupConfig.ScheduleCron
+	serverConfig.Etcd.BackupConfig.Retention = source.Etcd.BackupConfig.Retention
+	serverConfig.TLSSan = slices.Clone(source.TLSSan)
+
+	config := hotReloadableServerConfigFor(source)
+
+	for _, component := range []struct {
+		componentConfig **bootstrapv1.ComponentConfig
+		extraArgs       []string
+	}{
+		{&serverConfig.KubeAPIServer, config.KubeAPIServerArgs},
+		{&serverConfig.KubeControllerManager, config.KubeControllerManagerArgs},
+		{&serverConfig.KubeScheduler, config.KubeSchedulerArgs},
+	} {
+		if len(component.extraArgs) == 0 {
+			continue
+		}
+
+		if *component.componentConfig == nil {
+			*component.componentConfig = &bootstrapv1.ComponentConfig{}
+		}
+
+		(*component.componentConfig).ExtraArgs = append([]string(nil), component.extraArgs...)
+	}
+}
@@ -0,0 +1,301 @@
+package rke2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	bootstrapv1 "github.com/rancher/cluster-api-provider-rke2/bootstrap/api/v1beta1"
+	controlplanev1 "github.com/rancher/cluster-api-provider-rke2/controlplane/api/v1beta1"
+)
+
+func TestReconcileRKE2ServerConfigInPlace(t *testing.T) {
+	recordedConfig := `{"cni":"calico","kubeAPIServer":{"extraArgs":["v=2"]}}`
+
+	controlPlane := func(annotations map[string]string, serverConfig controlplanev1.RKE2ServerConfig) *ControlPlane {
+		m := &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "machine-1",
+				Annotations: map[string]string{controlplanev1.RKE2ServerConfigurationAnnotation: recordedConfig},
+			},
+			Status: clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "node-1"}},
+		}
+
+		return &ControlPlane{
+			RCP: &controlplanev1.RKE2ControlPlane{
+				ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+				Spec:       controlplanev1.RKE2ControlPlaneSpec{ServerConfig: serverConfig},
+			},
+			Machines: collections.FromMachines(m),
+		}
+	}
+
+	workload := func() *Workload {
+		controlPlaneNode := func(name string) *corev1.Node {
+			node := readyNode(name, "", corev1.ConditionTrue)
+			node.Labels = map[string]string{labelNodeRoleControlPlane: "true"}
+
+			return node
+		}
+
+		return &Workload{Client: fake.NewClientBuilder().WithObjects(controlPlaneNode("node-1"), controlPlaneNode("node-2")).Build()}
+	}
+
+	enabled := map[string]string{controlplanev1.InPlaceServerConfigUpdatesAnnotation: "true"}
+	podKey := client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: "rke2-server-config-node-1"}
+
+	t.Run("applies hot-reloadable changes without a rollout", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := workload()
+		cp := controlPlane(enabled, controlplanev1.RKE2ServerConfig{
+			CNI:           "calico",
+			KubeAPIServer: &bootstrapv1.ComponentConfig{ExtraArgs: []string{"v=4"}},
+		})
+		m := cp.Machines.Oldest()
+
+		g.Expect(matchServerConfig(cp.RCP, m)).To(BeTrue())
+		g.Expect(matchComponentArgs(cp.RCP, m, kubeAPIServerConfig)).To(BeTrue())
+
+		inProgress, err := w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(inProgress).To(BeTrue())
+
+		pod := &corev1.Pod{}
+		g.Expect(w.Get(context.Background(), podKey, pod)).To(Succeed())
+		g.Expect(pod.Spec.NodeName).To(Equal("node-1"))
+		g.Expect(pod.Spec.ActiveDeadlineSeconds).To(Equal(ptr.To(int64(inPlaceServerConfigPodTimeout.Seconds()))))
+		g.Expect(pod.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+			Name: "RKE2_CONFIG",
+			Value: "kube-apiserver-arg:\n    - v=4\nkube-controller-manager-arg: []\nkube-scheduler-arg: []\n" +
+				"etcd-snapshot-schedule-cron: 0 */12 * * *\netcd-snapshot-retention: \"5\"\n",
+		}))
+		g.Expect(m.Annotations[controlplanev1.RKE2ServerConfigurationAnnotation]).To(Equal(recordedConfig))
+
+		pod.Status.Phase = corev1.PodSucceeded
+		g.Expect(w.Status().Update(context.Background(), pod)).To(Succeed())
+
+		inProgress, err = w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(inProgress).To(BeFalse())
+		g.Expect(apierrors.IsNotFound(w.Get(context.Background(), podKey, &corev1.Pod{}))).To(BeTrue())
+
+		recorded, ok := recordedServerConfig(m)
+		g.Expect(ok).To(BeTrue())
+		g.Expect(recorded.CNI).To(Equal(controlplanev1.Calico))
+		g.Expect(recorded.KubeAPIServer.ExtraArgs).To(Equal([]string{"v=4"}))
+	})
+
+	t.Run("applies an etcd snapshot retention change without a rollout", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := workload()
+		cp := controlPlane(enabled, controlplanev1.RKE2ServerConfig{
+			CNI:           "calico",
+			KubeAPIServer: &bootstrapv1.ComponentConfig{ExtraArgs: []string{"v=2"}},
+			Etcd:          controlplanev1.EtcdConfig{BackupConfig: controlplanev1.EtcdBackupConfig{Retention: "10"}},
+		})
+		m := cp.Machines.Oldest()
+
+		g.Expect(matchServerConfig(cp.RCP, m)).To(BeTrue())
+
+		inProgress, err := w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(inProgress).To(BeTrue())
+
+		pod := &corev1.Pod{}
+		g.Expect(w.Get(context.Background(), podKey, pod)).To(Succeed())
+		g.Expect(pod.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+			Name: "RKE2_CONFIG",
+			Value: "kube-apiserver-arg:\n    - v=2\nkube-controller-manager-arg: []\nkube-scheduler-arg: []\n" +
+				"etcd-snapshot-schedule-cron: 0 */12 * * *\netcd-snapshot-retention: \"10\"\n",
+		}))
+
+		pod.Status.Phase = corev1.PodSucceeded
+		g.Expect(w.Status().Update(context.Background(), pod)).To(Succeed())
+
+		inProgress, err = w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(inProgress).To(BeFalse())
+
+		recorded, ok := recordedServerConfig(m)
+		g.Expect(ok).To(BeTrue())
+		g.Expect(recorded.Etcd.BackupConfig.Retention).To(Equal("10"))
+		g.Expect(matchServerConfig(cp.RCP, m)).To(BeTrue())
+	})
+
+	t.Run("rolls out an etcd snapshot retention change which failed to be applied in place", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := workload()
+		cp := controlPlane(enabled, controlplanev1.RKE2ServerConfig{
+			CNI:           "calico",
+			KubeAPIServer: &bootstrapv1.ComponentConfig{ExtraArgs: []string{"v=2"}},
+			Etcd:          controlplanev1.EtcdConfig{BackupConfig: controlplanev1.EtcdBackupConfig{Retention: "10"}},
+		})
+		m := cp.Machines.Oldest()
+
+		// Applying the config is retried until the attempts are used up.
+		for attempt := 1; attempt <= maxInPlaceServerConfigAttempts; attempt++ {
+			g.Expect(m.Annotations).ToNot(HaveKey(inPlaceServerConfigFailedAnnotation))
+			g.Expect(matchServerConfig(cp.RCP, m)).To(BeTrue())
+
+			inProgress, err := w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(inProgress).To(BeTrue())
+
+			pod := &corev1.Pod{}
+			g.Expect(w.Get(context.Background(), podKey, pod)).To(Succeed())
+
+			pod.Status.Phase = corev1.PodFailed
+			g.Expect(w.Status().Update(context.Background(), pod)).To(Succeed())
+
+			inProgress, err = w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(inProgress).To(BeTrue())
+			g.Expect(apierrors.IsNotFound(w.Get(context.Background(), podKey, &corev1.Pod{}))).To(BeTrue())
+		}
+
+		g.Expect(m.Annotations).To(HaveKey(inPlaceServerConfigFailedAnnotation))
+		g.Expect(m.Annotations).ToNot(HaveKey(inPlaceServerConfigAttemptsAnnotation))
+		g.Expect(matchServerConfig(cp.RCP, m)).To(BeFalse())
+
+		// The machine is left to the rollout.
+		inProgress, err := w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(inProgress).To(BeFalse())
+		g.Expect(apierrors.IsNotFound(w.Get(context.Background(), podKey, &corev1.Pod{}))).To(BeTrue())
+	})
+
+	t.Run("considers a pod which does not complete as failed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := workload()
+		cp := controlPlane(enabled, controlplanev1.RKE2ServerConfig{
+			CNI:           "calico",
+			KubeAPIServer: &bootstrapv1.ComponentConfig{ExtraArgs: []string{"v=4"}},
+		})
+		cp.RCP.Spec.AgentConfig.SystemDefaultRegistry = "registry.example.com"
+		m := cp.Machines.Oldest()
+
+		inProgress, err := w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(inProgress).To(BeTrue())
+
+		pod := &corev1.Pod{}
+		g.Expect(w.Get(context.Background(), podKey, pod)).To(Succeed())
+		g.Expect(pod.Spec.Containers[0].Image).To(Equal("registry.example.com/" + InPlaceServerConfigImage))
+
+		// The image can't be pulled, the pod stays pending.
+		g.Expect(w.Delete(context.Background(), pod)).To(Succeed())
+		pod.ResourceVersion = ""
+		pod.CreationTimestamp = metav1.NewTime(time.Now().Add(-inPlaceServerConfigPodTimeout))
+		pod.Status.Phase = corev1.PodPending
+		g.Expect(w.Create(context.Background(), pod)).To(Succeed())
+
+		inProgress, err = w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(inProgress).To(BeTrue())
+		g.Expect(apierrors.IsNotFound(w.Get(context.Background(), podKey, &corev1.Pod{}))).To(BeTrue())
+		g.Expect(m.Annotations).To(HaveKey(inPlaceServerConfigAttemptsAnnotation))
+		g.Expect(m.Annotations).ToNot(HaveKey(inPlaceServerConfigFailedAnnotation))
+	})
+
+	t.Run("re-issues the certificate with an added TLS SAN without a rollout", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := workload()
+		cp := controlPlane(enabled, controlplanev1.RKE2ServerConfig{
+			CNI:           "calico",
+			KubeAPIServer: &bootstrapv1.ComponentConfig{ExtraArgs: []string{"v=2"}},
+			TLSSan:        []string{"api.example.com"},
+		})
+		m := cp.Machines.Oldest()
+
+		g.Expect(matchServerConfig(cp.RCP, m)).To(BeTrue())
+		g.Expect(matchTLSSANs(cp.RCP, m)).To(BeTrue())
+
+		inProgress, err := w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(inProgress).To(BeTrue())
+
+		pod := &corev1.Pod{}
+		g.Expect(w.Get(context.Background(), podKey, pod)).To(Succeed())
+		g.Expect(pod.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+			Name: "RKE2_CONFIG",
+			Value: "kube-apiserver-arg:\n    - v=2\nkube-controller-manager-arg: []\nkube-scheduler-arg: []\n" +
+				"etcd-snapshot-schedule-cron: 0 */12 * * *\netcd-snapshot-retention: \"5\"\ntls-san+:\n    - api.example.com\n",
+		}))
+
+		pod.Status.Phase = corev1.PodSucceeded
+		g.Expect(w.Status().Update(context.Background(), pod)).To(Succeed())
+
+		inProgress, err = w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(inProgress).To(BeFalse())
+
+		recorded, ok := recordedServerConfig(m)
+		g.Expect(ok).To(BeTrue())
+		g.Expect(recorded.TLSSan).To(Equal([]string{"api.example.com"}))
+
+		// Removing the SAN again is rolled out, as it is kept in the certificate.
+		cp.RCP.Spec.ServerConfig.TLSSan = nil
+
+		g.Expect(matchTLSSANs(cp.RCP, m)).To(BeFalse())
+
+		inProgress, err = w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(inProgress).To(BeFalse())
+		g.Expect(apierrors.IsNotFound(w.Get(context.Background(), podKey, &corev1.Pod{}))).To(BeTrue())
+	})
+
+	t.Run("leaves other changes to the rollout", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := workload()
+		cp := controlPlane(enabled, controlplanev1.RKE2ServerConfig{
+			CNI:           "cilium",
+			KubeAPIServer: &bootstrapv1.ComponentConfig{ExtraArgs: []string{"v=4"}},
+		})
+
+		g.Expect(matchServerConfig(cp.RCP, cp.Machines.Oldest())).To(BeFalse())
+
+		inProgress, err := w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(inProgress).To(BeFalse())
+		g.Expect(apierrors.IsNotFound(w.Get(context.Background(), podKey, &corev1.Pod{}))).To(BeTrue())
+	})
+
+	t.Run("does nothing unless enabled", func(t *testing.T) {
+		g := NewWithT(t)
+
+		w := workload()
+		cp := controlPlane(nil, controlplanev1.RKE2ServerConfig{
+			CNI:           "calico",
+			KubeAPIServer: &bootstrapv1.ComponentConfig{ExtraArgs: []string{"v=4"}},
+		})
+
+		g.Expect(matchComponentArgs(cp.RCP, cp.Machines.Oldest(), kubeAPIServerConfig)).To(BeFalse())
+		g.Expect(matchServerConfig(controlPlane(nil, controlplanev1.RKE2ServerConfig{
+			CNI:           "calico",
+			KubeAPIServer: &bootstrapv1.ComponentConfig{ExtraArgs: []string{"v=2"}},
+			Etcd:          controlplanev1.EtcdConfig{BackupConfig: controlplanev1.EtcdBackupConfig{Retention: "10"}},
+		}).RCP, cp.Machines.Oldest())).To(BeFalse())
+
+		inProgress, err := w.ReconcileRKE2ServerConfigInPlace(context.Background(), cp)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(inProgress).To(BeFalse())
+		g.Expect(apierrors.IsNotFound(w.Get(context.Background(), podKey, &corev1.Pod{}))).To(BeTrue())
+	})
+}
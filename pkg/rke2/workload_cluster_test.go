@@ -529,3 +529,138 @@ var _ = Describe("ClusterStatus validation", func() {
 		Expect(status.HasRKE2ServingSecret).To(BeFalse(), "On connection error assume control plane not initialized")
 	})
 })
+
+var _ = Describe("NodeRKE2Versions", func() {
+	newNode := func(name, kubeletVersion string, annotations map[string]string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Annotations: annotations,
+			},
+			Status: corev1.NodeStatus{
+				NodeInfo: corev1.NodeSystemInfo{KubeletVersion: kubeletVersion},
+			},
+		}
+	}
+
+	It("should report actual versus expected versions for each node", func() {
+		fakeClient := fake.NewClientBuilder().WithObjects(
+			newNode("rke2-up-to-date", "v1.31.1+rke2r1", nil),
+			newNode("rke2-outdated", "v1.30.5+rke2r1", nil),
+			newNode("kube-up-to-date", "v1.31.1", nil),
+			newNode("kube-outdated", "v1.30.5", nil),
+			newNode("annotated", "v1.31.1", map[string]string{nodeRKE2VersionAnnotation: "v1.31.1+rke2r2"}),
+		).Build()
+		w := &Workload{Client: fakeClient}
+
+		versions, err := w.NodeRKE2Versions(ctx, "v1.31.1+rke2r1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(versions).To(HaveLen(5))
+		Expect(versions["rke2-up-to-date"]).To(Equal(NodeVersionStatus{
+			Expected: "v1.31.1+rke2r1", Actual: "v1.31.1+rke2r1", Matches: true,
+		}))
+		Expect(versions["rke2-outdated"].Matches).To(BeFalse())
+		Expect(versions["kube-up-to-date"].Matches).To(BeTrue())
+		Expect(versions["kube-outdated"].Matches).To(BeFalse())
+		Expect(versions["annotated"].Actual).To(Equal("v1.31.1+rke2r2"))
+		Expect(versions["annotated"].Matches).To(BeFalse())
+	})
+
+	It("should not match nodes without a reported version", func() {
+		fakeClient := fake.NewClientBuilder().WithObjects(newNode("unknown", "", nil)).Build()
+		w := &Workload{Client: fakeClient}
+
+		versions, err := w.NodeRKE2Versions(ctx, "v1.31.1+rke2r1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(versions["unknown"].Matches).To(BeFalse())
+	})
+})
+
+var _ = Describe("CheckBootstrapTokens", func() {
+	newBootstrapToken := func(name string, expiration time.Time) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: metav1.NamespaceSystem,
+			},
+			Type: corev1.SecretTypeBootstrapToken,
+			Data: map[string][]byte{
+				"token-id":                       []byte("abcdef"),
+				"token-secret":                   []byte("0123456789abcdef"),
+				"expiration":                     []byte(expiration.Format(time.RFC3339)),
+				"usage-bootstrap-authentication": []byte("true"),
+			},
+		}
+	}
+
+	It("should succeed when the cluster relies on the RKE2 cluster token only", func() {
+		w := &Workload{Client: fake.NewClientBuilder().Build()}
+
+		Expect(w.CheckBootstrapTokens(ctx)).To(Succeed())
+	})
+
+	It("should succeed when at least one bootstrap token is valid", func() {
+		w := &Workload{Client: fake.NewClientBuilder().WithObjects(
+			newBootstrapToken("bootstrap-token-expired", time.Now().Add(-time.Hour)),
+			newBootstrapToken("bootstrap-token-valid", time.Now().Add(time.Hour)),
+		).Build()}
+
+		Expect(w.CheckBootstrapTokens(ctx)).To(Succeed())
+	})
+
+	It("should return ErrBootstrapTokensExpired when all bootstrap tokens are expired", func() {
+		notForAuthentication := newBootstrapToken("bootstrap-token-signing", time.Now().Add(time.Hour))
+		notForAuthentication.Data["usage-bootstrap-authentication"] = []byte("false")
+
+		w := &Workload{Client: fake.NewClientBuilder().WithObjects(
+			newBootstrapToken("bootstrap-token-expired", time.Now().Add(-time.Hour)),
+			notForAuthentication,
+		).Build()}
+
+		err := w.CheckBootstrapTokens(ctx)
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, ErrBootstrapTokensExpired)).To(BeTrue())
+	})
+})
+
+var _ = Describe("CheckWorkerVersionSkew", func() {
+	newNode := func(name, kubeletVersion string, controlPlane bool) *corev1.Node {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
+			Status: corev1.NodeStatus{
+				NodeInfo: corev1.NodeSystemInfo{KubeletVersion: kubeletVersion},
+			},
+		}
+
+		if controlPlane {
+			node.Labels[labelNodeRoleControlPlane] = "true"
+		}
+
+		return node
+	}
+
+	It("should succeed when workers are within the supported skew", func() {
+		w := &Workload{Client: fake.NewClientBuilder().WithObjects(
+			newNode("cp", "v1.31.1+rke2r1", true),
+			newNode("worker-same", "v1.31.1+rke2r1", false),
+			newNode("worker-behind", "v1.28.9+rke2r1", false),
+		).Build()}
+
+		Expect(w.CheckWorkerVersionSkew(ctx, "v1.31.1+rke2r1")).To(Succeed())
+	})
+
+	It("should return ErrWorkerVersionSkew when workers lag beyond the supported skew", func() {
+		w := &Workload{Client: fake.NewClientBuilder().WithObjects(
+			newNode("cp", "v1.27.3+rke2r1", true),
+			newNode("worker-ok", "v1.29.4+rke2r1", false),
+			newNode("worker-old", "v1.27.3+rke2r1", false),
+		).Build()}
+
+		err := w.CheckWorkerVersionSkew(ctx, "v1.31.1+rke2r1")
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, ErrWorkerVersionSkew)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("worker-old"))
+		Expect(err.Error()).ToNot(ContainSubstring("worker-ok"))
+		Expect(err.Error()).ToNot(ContainSubstring("cp ("))
+	})
+})
@@ -0,0 +1,239 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rke2
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/collections"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bsutil "github.com/rancher/cluster-api-provider-rke2/pkg/util"
+)
+
+// ErrRKE2TokenExternallyManaged is returned when the cluster token secret would have to be repaired, but is not
+// controlled by a controller.
+var ErrRKE2TokenExternallyManaged = errors.New("RKE2 token is externally managed")
+
+// bootstrapDataTokenRegexp matches the token of the RKE2 config file written by the cloud-init bootstrap data.
+var bootstrapDataTokenRegexp = regexp.MustCompile(`(?m)^\s*token:\s*["']?([^"'\s]+)["']?\s*$`)
+
+// ReapplyRKE2TokenIfMissing checks that the servers accept the token stored in the cluster token secret of the
+// management cluster, which is used to join new nodes, and repairs the secret when it is missing or its token differs
+// from the token of the servers. The token of the servers is searched for in the bootstrap data of the given machines,
+// and only a token accepted by the supervisor API of a ready server is written to the secret. Bootstrap data in the
+// Ignition format is not searched. It returns true if the secret was repaired, and an error wrapping
+// ErrRKE2TokenExternallyManaged if the secret to repair is not controlled by a controller. Calling it again once the
+// secret is repaired is a no-op.
+func (w *Workload) ReapplyRKE2TokenIfMissing(ctx context.Context, machines collections.Machines) (bool, error) {
+	if w.managementClient == nil || w.supervisorClientForToken == nil {
+		return false, errors.New("workload cluster can't repair the cluster token")
+	}
+
+	nodeName, err := w.readyControlPlaneNodeName(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	tokenSecret := &corev1.Secret{}
+	tokenKey := ctrlclient.ObjectKey{Namespace: w.clusterKey.Namespace, Name: bsutil.TokenName(w.clusterKey.Name)}
+
+	tokenSecretFound := true
+	if err := w.managementClient.Get(ctx, tokenKey, tokenSecret); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, errors.Wrap(err, "failed to get cluster token secret")
+		}
+
+		tokenSecretFound = false
+	}
+
+	currentToken := string(tokenSecret.Data["value"])
+	if currentToken != "" {
+		accepted, err := w.tokenAccepted(ctx, nodeName, currentToken)
+		if err != nil {
+			return false, err
+		}
+
+		if accepted {
+			return false, nil
+		}
+	}
+
+	if tokenSecretFound && metav1.GetControllerOf(tokenSecret) == nil {
+		return false, errors.Wrapf(ErrRKE2TokenExternallyManaged, "secret %s is not controlled by a controller", tokenSecret.Name)
+	}
+
+	candidates, err := w.bootstrapDataTokens(ctx, machines)
+	if err != nil {
+		return false, err
+	}
+
+	for _, token := range candidates {
+		if token == currentToken {
+			continue
+		}
+
+		accepted, err := w.tokenAccepted(ctx, nodeName, token)
+		if err != nil {
+			return false, err
+		}
+
+		if !accepted {
+			continue
+		}
+
+		if err := w.storeClusterToken(ctx, tokenSecret, tokenSecretFound, token); err != nil {
+			return false, err
+		}
+
+		log.FromContext(ctx).Info("Repaired the cluster token secret with the token of the servers", "secret", tokenKey.Name)
+
+		return true, nil
+	}
+
+	return false, errors.Errorf("servers on node %s don't accept the token of secret %s, nor any token of the machines bootstrap data",
+		nodeName, tokenKey.Name)
+}
+
+// readyControlPlaneNodeName returns the name of the first ready control plane node, by name.
+func (w *Workload) readyControlPlaneNodeName(ctx context.Context) (string, error) {
+	nodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list control plane nodes")
+	}
+
+	names := []string{}
+
+	for i := range nodes.Items {
+		if util.IsNodeReady(&nodes.Items[i]) {
+			names = append(names, nodes.Items[i].Name)
+		}
+	}
+
+	if len(names) == 0 {
+		return "", errors.New("no ready control plane node to check the cluster token against")
+	}
+
+	slices.Sort(names)
+
+	return names[0], nil
+}
+
+// tokenAccepted returns true if the server running on the node accepts the token.
+func (w *Workload) tokenAccepted(ctx context.Context, nodeName, token string) (bool, error) {
+	supervisor, err := w.supervisorClientForToken(nodeName, token)
+	if err != nil {
+		return false, err
+	}
+
+	accepted, err := supervisor.TokenAccepted(ctx)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to check the cluster token against node %s", nodeName)
+	}
+
+	return accepted, nil
+}
+
+// bootstrapDataTokens returns the distinct tokens found in the bootstrap data of the machines, sorted by machine name.
+func (w *Workload) bootstrapDataTokens(ctx context.Context, machines collections.Machines) ([]string, error) {
+	tokens := []string{}
+
+	names := machines.Names()
+	slices.Sort(names)
+
+	for _, name := range names {
+		machine := machines[name]
+		if machine.Spec.Bootstrap.DataSecretName == nil {
+			continue
+		}
+
+		dataSecret := &corev1.Secret{}
+		dataKey := ctrlclient.ObjectKey{Namespace: machine.Namespace, Name: *machine.Spec.Bootstrap.DataSecretName}
+
+		if err := w.managementClient.Get(ctx, dataKey, dataSecret); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+
+			return nil, errors.Wrapf(err, "failed to get bootstrap data secret of machine %s", machine.Name)
+		}
+
+		for _, match := range bootstrapDataTokenRegexp.FindAllStringSubmatch(string(dataSecret.Data["value"]), -1) {
+			if token := strings.TrimSpace(match[1]); token != "" && !slices.Contains(tokens, token) {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+
+	return tokens, nil
+}
+
+// storeClusterToken writes the token to the cluster token secret, creating the secret if it was not found.
+func (w *Workload) storeClusterToken(ctx context.Context, tokenSecret *corev1.Secret, found bool, token string) error {
+	if found {
+		patchBase := ctrlclient.MergeFrom(tokenSecret.DeepCopy())
+
+		if tokenSecret.Data == nil {
+			tokenSecret.Data = map[string][]byte{}
+		}
+
+		tokenSecret.Data["value"] = []byte(token)
+
+		return errors.Wrap(w.managementClient.Patch(ctx, tokenSecret, patchBase), "failed to update cluster token secret")
+	}
+
+	cluster := &clusterv1.Cluster{}
+	if err := w.managementClient.Get(ctx, w.clusterKey, cluster); err != nil {
+		return errors.Wrap(err, "failed to get cluster")
+	}
+
+	tokenSecret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      bsutil.TokenName(cluster.Name),
+			Namespace: cluster.Namespace,
+			Labels: map[string]string{
+				clusterv1.ClusterNameLabel: cluster.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: clusterv1.GroupVersion.String(),
+					Kind:       "Cluster",
+					Name:       cluster.Name,
+					UID:        cluster.UID,
+					Controller: ptr.To(true),
+				},
+			},
+		},
+		Data: map[string][]byte{
+			"value": []byte(token),
+		},
+		Type: clusterv1.ClusterSecretType,
+	}
+
+	return errors.Wrap(w.managementClient.Create(ctx, tokenSecret), "failed to create cluster token secret")
+}
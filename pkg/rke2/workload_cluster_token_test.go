@@ -0,0 +1,155 @@
+package rke2
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// tokenCheckingSupervisorClient is a supervisor client of a server accepting serverToken only.
+type tokenCheckingSupervisorClient struct {
+	fakeSupervisorClient
+
+	token       string
+	serverToken string
+}
+
+func (c *tokenCheckingSupervisorClient) TokenAccepted(context.Context) (bool, error) {
+	return c.token == c.serverToken, nil
+}
+
+func TestReapplyRKE2TokenIfMissing(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	NewWithT(t).Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+	NewWithT(t).Expect(clusterv1.AddToScheme(testScheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster", UID: "cluster-uid"},
+	}
+	tokenSecret := func(token string, controlled bool) *corev1.Secret {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster-token"},
+			Data:       map[string][]byte{"value": []byte(token)},
+		}
+		if controlled {
+			secret.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: clusterv1.GroupVersion.String(),
+				Kind:       "Cluster",
+				Name:       cluster.Name,
+				UID:        cluster.UID,
+				Controller: ptr.To(true),
+			}}
+		}
+
+		return secret
+	}
+	bootstrapData := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine-1-bootstrap"},
+		Data: map[string][]byte{"value": []byte(`## template: jinja
+#cloud-config
+write_files:
+-   path: /etc/rancher/rke2/config.yaml
+    owner: root:root
+    permissions: '0640'
+    content: |
+      tls-san:
+        - cluster.example.com
+      token: server-token
+`)},
+	}
+	machines := collections.FromMachines(&clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine-1"},
+		Spec: clusterv1.MachineSpec{
+			Bootstrap: clusterv1.Bootstrap{DataSecretName: ptr.To(bootstrapData.Name)},
+		},
+	})
+	workload := func(managementClient client.Client) *Workload {
+		node := readyNode("node-1", "", corev1.ConditionTrue)
+		node.Labels = map[string]string{labelNodeRoleControlPlane: "true"}
+
+		return &Workload{
+			Client:           fake.NewClientBuilder().WithObjects(node).Build(),
+			clusterKey:       client.ObjectKeyFromObject(cluster),
+			managementClient: managementClient,
+			supervisorClientForToken: func(_, token string) (supervisorClient, error) {
+				return &tokenCheckingSupervisorClient{token: token, serverToken: "server-token"}, nil
+			},
+		}
+	}
+
+	t.Run("repairs a token secret differing from the cluster token", func(t *testing.T) {
+		g := NewWithT(t)
+
+		managementClient := fake.NewClientBuilder().WithScheme(testScheme).
+			WithObjects(cluster.DeepCopy(), bootstrapData.DeepCopy(), tokenSecret("rotated-token", true)).Build()
+		w := workload(managementClient)
+
+		repaired, err := w.ReapplyRKE2TokenIfMissing(context.Background(), machines)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(repaired).To(BeTrue())
+
+		secret := &corev1.Secret{}
+		g.Expect(managementClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "cluster-token"}, secret)).
+			To(Succeed())
+		g.Expect(string(secret.Data["value"])).To(Equal("server-token"))
+
+		// The repair is idempotent.
+		repaired, err = w.ReapplyRKE2TokenIfMissing(context.Background(), machines)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(repaired).To(BeFalse())
+	})
+
+	t.Run("recreates a missing token secret", func(t *testing.T) {
+		g := NewWithT(t)
+
+		managementClient := fake.NewClientBuilder().WithScheme(testScheme).
+			WithObjects(cluster.DeepCopy(), bootstrapData.DeepCopy()).Build()
+
+		repaired, err := workload(managementClient).ReapplyRKE2TokenIfMissing(context.Background(), machines)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(repaired).To(BeTrue())
+
+		secret := &corev1.Secret{}
+		g.Expect(managementClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "cluster-token"}, secret)).
+			To(Succeed())
+		g.Expect(string(secret.Data["value"])).To(Equal("server-token"))
+		g.Expect(metav1.GetControllerOf(secret)).ToNot(BeNil())
+		g.Expect(metav1.GetControllerOf(secret).UID).To(Equal(cluster.UID))
+	})
+
+	t.Run("refuses to repair an externally managed token secret", func(t *testing.T) {
+		g := NewWithT(t)
+
+		managementClient := fake.NewClientBuilder().WithScheme(testScheme).
+			WithObjects(cluster.DeepCopy(), bootstrapData.DeepCopy(), tokenSecret("rotated-token", false)).Build()
+
+		repaired, err := workload(managementClient).ReapplyRKE2TokenIfMissing(context.Background(), machines)
+		g.Expect(err).To(MatchError(ErrRKE2TokenExternallyManaged))
+		g.Expect(repaired).To(BeFalse())
+
+		secret := &corev1.Secret{}
+		g.Expect(managementClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "cluster-token"}, secret)).
+			To(Succeed())
+		g.Expect(string(secret.Data["value"])).To(Equal("rotated-token"))
+	})
+
+	t.Run("does nothing when the servers accept the token", func(t *testing.T) {
+		g := NewWithT(t)
+
+		managementClient := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(tokenSecret("server-token", false)).Build()
+
+		repaired, err := workload(managementClient).ReapplyRKE2TokenIfMissing(context.Background(), machines)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(repaired).To(BeFalse())
+	})
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secret
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"sync"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/cluster-api/util/certs"
+)
+
+// CAProvider is an external signer, e.g. a Vault PKI, issuing the cluster CAs instead of having them generated in the
+// management cluster. RKE2 signs the cluster certificates on the nodes, so the provider signs an intermediate CA whose
+// key is generated in the management cluster, and the root CA is only trusted.
+type CAProvider interface {
+	// GetCA returns the CA certificate of the external signer used for the given purpose.
+	GetCA(ctx context.Context, purpose Purpose) (*x509.Certificate, error)
+
+	// Sign signs the certificate request of an intermediate CA for the given purpose.
+	Sign(ctx context.Context, purpose Purpose, csr *x509.CertificateRequest) (*x509.Certificate, error)
+}
+
+// ErrCAProviderNotFound is returned when no CA provider is registered with the requested name.
+var ErrCAProviderNotFound = errors.New("CA provider not found")
+
+var (
+	caProvidersLock sync.RWMutex
+	caProviders     = map[string]CAProvider{}
+)
+
+// RegisterCAProvider registers a CA provider, which clusters can then use by name.
+func RegisterCAProvider(name string, provider CAProvider) {
+	caProvidersLock.Lock()
+	defer caProvidersLock.Unlock()
+
+	caProviders[name] = provider
+}
+
+// GetCAProvider returns the CA provider registered with the given name, or an error wrapping ErrCAProviderNotFound.
+func GetCAProvider(name string) (CAProvider, error) {
+	caProvidersLock.RLock()
+	defer caProvidersLock.RUnlock()
+
+	provider, ok := caProviders[name]
+	if !ok {
+		return nil, errors.Wrapf(ErrCAProviderNotFound, "no CA provider registered as %q", name)
+	}
+
+	return provider, nil
+}
+
+// LookupOrIssue looks up the certificates, and generates the missing ones, or has the missing CAs signed by the CA
+// provider registered with the given name if any.
+func (c Certificates) LookupOrIssue(
+	ctx context.Context,
+	ctrlclient client.Client,
+	clusterName client.ObjectKey,
+	owner metav1.OwnerReference,
+	providerName string,
+) error {
+	if providerName == "" {
+		return c.LookupOrGenerate(ctx, ctrlclient, clusterName, owner)
+	}
+
+	provider, err := GetCAProvider(providerName)
+	if err != nil {
+		return err
+	}
+
+	return c.LookupOrSign(ctx, ctrlclient, clusterName, owner, provider)
+}
+
+// LookupOrSign is LookupOrGenerate issuing the missing CAs with the CA provider instead of generating them. Key pairs
+// which are not CAs, i.e. the service account keys, are still generated.
+func (c Certificates) LookupOrSign(
+	ctx context.Context,
+	ctrlclient client.Client,
+	clusterName client.ObjectKey,
+	owner metav1.OwnerReference,
+	provider CAProvider,
+) error {
+	if err := c.Lookup(ctx, ctrlclient, clusterName); err != nil {
+		return err
+	}
+
+	for _, certificate := range c {
+		if certificate.GetKeyPair() != nil {
+			continue
+		}
+
+		managed, ok := certificate.(*ManagedCertificate)
+		if !ok || certificate.GetPurpose() == ServiceAccount || certificate.GetPurpose() == APIServerEtcdClient {
+			if err := certificate.Generate(); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := managed.Sign(ctx, provider); err != nil {
+			return err
+		}
+	}
+
+	return c.SaveGenerated(ctx, ctrlclient, clusterName, owner)
+}
+
+// Sign issues the certificate as an intermediate CA signed by the CA provider. The certificate data holds the
+// intermediate CA followed by the CA of the provider, so the chain can be verified on the nodes.
+func (c *ManagedCertificate) Sign(ctx context.Context, provider CAProvider) error {
+	key, err := certs.NewPrivateKey()
+	if err != nil {
+		return err
+	}
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "rke2-" + string(c.Purpose) + "-ca"},
+	}, key)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s CA certificate request", c.Purpose)
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	cert, err := provider.Sign(ctx, c.Purpose, csr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to sign %s CA with the CA provider", c.Purpose)
+	}
+
+	if !cert.IsCA {
+		return errors.Errorf("CA provider issued a %s certificate which is not a CA", c.Purpose)
+	}
+
+	if !bytes.Equal(cert.RawSubjectPublicKeyInfo, csr.RawSubjectPublicKeyInfo) {
+		return errors.Errorf("CA provider issued a %s certificate for another key", c.Purpose)
+	}
+
+	ca, err := provider.GetCA(ctx, c.Purpose)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get %s CA from the CA provider", c.Purpose)
+	}
+
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		return errors.Wrapf(err, "%s CA is not signed by the CA provider", c.Purpose)
+	}
+
+	c.SetKeyPair(&certs.KeyPair{
+		Cert: append(certs.EncodeCertPEM(cert), certs.EncodeCertPEM(ca)...),
+		Key:  certs.EncodePrivateKeyPEM(key),
+	})
+	c.Generated = true
+
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secret
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/cluster-api/util/certs"
+)
+
+// SecretCAProviderName is the name the SecretCAProvider is registered with by RegisterSecretCAProvider.
+const SecretCAProviderName = "secret"
+
+// SecretCAProvider is a CAProvider signing the intermediate CAs with a root CA stored in a Secret of the management
+// cluster, e.g. the root CA of an organization, whose key is then only readable by the controllers. The Secret holds
+// the PEM encoded certificate and key of the root CA under the tls.crt and tls.key keys, and is read on every
+// signature so the root CA can be rotated without restarting the controllers.
+type SecretCAProvider struct {
+	// Reader reads the Secret of the root CA.
+	Reader client.Reader
+	// Secret is the key of the Secret of the root CA.
+	Secret client.ObjectKey
+}
+
+// RegisterSecretCAProvider registers a SecretCAProvider reading the root CA from the Secret referenced as
+// "namespace/name", so that clusters can use it as the "secret" CA provider.
+func RegisterSecretCAProvider(reader client.Reader, secretRef string) error {
+	namespace, name, found := strings.Cut(secretRef, "/")
+	if !found || namespace == "" || name == "" {
+		return errors.Errorf("CA provider secret %q is not a namespace/name reference", secretRef)
+	}
+
+	RegisterCAProvider(SecretCAProviderName, &SecretCAProvider{
+		Reader: reader,
+		Secret: client.ObjectKey{Namespace: namespace, Name: name},
+	})
+
+	return nil
+}
+
+// GetCA returns the root CA of the Secret, the same CA signing every purpose.
+func (p *SecretCAProvider) GetCA(ctx context.Context, _ Purpose) (*x509.Certificate, error) {
+	ca, _, err := p.rootCA(ctx)
+
+	return ca, err
+}
+
+// Sign signs the certificate request of an intermediate CA with the root CA of the Secret. The intermediate CA can
+// only sign leaf certificates, and does not outlive the root CA.
+func (p *SecretCAProvider) Sign(ctx context.Context, purpose Purpose, csr *x509.CertificateRequest) (*x509.Certificate, error) {
+	if err := csr.CheckSignature(); err != nil {
+		return nil, errors.Wrapf(err, "invalid %s CA certificate request", purpose)
+	}
+
+	ca, key, err := p.rootCA(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate serial number")
+	}
+
+	now := time.Now().UTC()
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               csr.Subject,
+		NotBefore:             now.Add(time.Minute * -5),
+		NotAfter:              now.Add(TenYears),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		MaxPathLenZero:        true,
+		BasicConstraintsValid: true,
+		MaxPathLen:            0,
+		IsCA:                  true,
+	}
+
+	if tmpl.NotAfter.After(ca.NotAfter) {
+		tmpl.NotAfter = ca.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, csr.PublicKey, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to sign %s CA certificate", purpose)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+
+	return cert, errors.WithStack(err)
+}
+
+// rootCA reads the certificate and key of the root CA from the Secret.
+func (p *SecretCAProvider) rootCA(ctx context.Context) (*x509.Certificate, crypto.Signer, error) {
+	s := &corev1.Secret{}
+	if err := p.Reader.Get(ctx, p.Secret, s); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get CA provider secret %s", p.Secret)
+	}
+
+	ca, err := certs.DecodeCertPEM(s.Data[corev1.TLSCertKey])
+	if err != nil || ca == nil {
+		return nil, nil, errors.Errorf("CA provider secret %s has no valid %s", p.Secret, corev1.TLSCertKey)
+	}
+
+	if !ca.IsCA {
+		return nil, nil, errors.Errorf("certificate of CA provider secret %s is not a CA", p.Secret)
+	}
+
+	key, err := certs.DecodePrivateKeyPEM(s.Data[corev1.TLSPrivateKeyKey])
+	if err != nil || key == nil {
+		return nil, nil, errors.Errorf("CA provider secret %s has no valid %s", p.Secret, corev1.TLSPrivateKeyKey)
+	}
+
+	return ca, key, nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secret
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/cluster-api/util/certs"
+)
+
+func TestSecretCAProvider(t *testing.T) {
+	g := NewWithT(t)
+
+	root, err := newFakeCAProvider()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	rootSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "rke2-system", Name: "root-ca"},
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certs.EncodeCertPEM(root.ca),
+			corev1.TLSPrivateKeyKey: certs.EncodePrivateKeyPEM(root.key),
+		},
+	}
+	cl := fake.NewClientBuilder().WithObjects(rootSecret).Build()
+
+	g.Expect(RegisterSecretCAProvider(cl, "rke2-system/root-ca")).To(Succeed())
+
+	provider, err := GetCAProvider(SecretCAProviderName)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "cluster"}
+	certificates := NewCertificatesForInitialControlPlane()
+
+	g.Expect(certificates.LookupOrSign(context.Background(), cl, clusterKey, metav1.OwnerReference{}, provider)).To(Succeed())
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.ca)
+
+	for _, purpose := range []Purpose{ClusterCA, ClientClusterCA, EtcdServerCA, EtcdCA} {
+		kp := certificates.GetByPurpose(purpose).GetKeyPair()
+		g.Expect(kp).ToNot(BeNil())
+
+		intermediate, err := certs.DecodeCertPEM(kp.Cert)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(intermediate.IsCA).To(BeTrue())
+		g.Expect(intermediate.MaxPathLenZero).To(BeTrue())
+		g.Expect(intermediate.NotAfter).ToNot(BeTemporally(">", root.ca.NotAfter))
+
+		_, err = intermediate.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+
+	t.Run("fails without the root CA key", func(t *testing.T) {
+		g := NewWithT(t)
+
+		delete(rootSecret.Data, corev1.TLSPrivateKeyKey)
+
+		provider := &SecretCAProvider{
+			Reader: fake.NewClientBuilder().WithObjects(rootSecret).Build(),
+			Secret: client.ObjectKeyFromObject(rootSecret),
+		}
+
+		err := NewCertificatesForInitialControlPlane().LookupOrSign(
+			context.Background(), fake.NewClientBuilder().Build(), clusterKey, metav1.OwnerReference{}, provider)
+		g.Expect(err).To(MatchError(ContainSubstring("has no valid tls.key")))
+	})
+
+	t.Run("requires a namespaced secret reference", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(RegisterSecretCAProvider(cl, "root-ca")).ToNot(Succeed())
+	})
+}
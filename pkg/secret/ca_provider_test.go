@@ -0,0 +1,150 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secret
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/cluster-api/util/certs"
+)
+
+// fakeCAProvider is an external signer signing intermediate CAs with its own root CA.
+type fakeCAProvider struct {
+	ca     *x509.Certificate
+	key    *rsa.PrivateKey
+	signed []Purpose
+}
+
+func newFakeCAProvider() (*fakeCAProvider, error) {
+	key, err := certs.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(0),
+		Subject:               pkix.Name{CommonName: "external-root-ca"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fakeCAProvider{ca: ca, key: key}, nil
+}
+
+func (p *fakeCAProvider) GetCA(_ context.Context, _ Purpose) (*x509.Certificate, error) {
+	return p.ca, nil
+}
+
+func (p *fakeCAProvider) Sign(_ context.Context, purpose Purpose, csr *x509.CertificateRequest) (*x509.Certificate, error) {
+	p.signed = append(p.signed, purpose)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(int64(len(p.signed))),
+		Subject:               pkix.Name{CommonName: csr.Subject.CommonName},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, p.ca, csr.PublicKey, p.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+func TestLookupOrSign(t *testing.T) {
+	g := NewWithT(t)
+
+	provider, err := newFakeCAProvider()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	cl := fake.NewClientBuilder().Build()
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "cluster"}
+	certificates := NewCertificatesForInitialControlPlane()
+
+	g.Expect(certificates.LookupOrSign(context.Background(), cl, clusterKey, metav1.OwnerReference{}, provider)).To(Succeed())
+	g.Expect(provider.signed).To(ConsistOf(ClusterCA, ClientClusterCA, EtcdServerCA, EtcdCA))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(provider.ca)
+
+	for _, purpose := range provider.signed {
+		kp := certificates.GetByPurpose(purpose).GetKeyPair()
+		g.Expect(kp).ToNot(BeNil())
+
+		chain, err := certs.DecodeCertPEM(kp.Cert)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(chain.IsCA).To(BeTrue())
+
+		_, err = chain.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		secret, err := GetFromNamespacedName(context.Background(), cl, clusterKey, purpose)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(secret.Data).To(HaveKeyWithValue(TLSCrtDataName, kp.Cert))
+	}
+
+	// Existing certificates are looked up instead of being signed again.
+	certificates = NewCertificatesForInitialControlPlane()
+	g.Expect(certificates.LookupOrSign(context.Background(), cl, clusterKey, metav1.OwnerReference{}, provider)).To(Succeed())
+	g.Expect(provider.signed).To(HaveLen(4))
+}
+
+func TestGetCAProvider(t *testing.T) {
+	g := NewWithT(t)
+
+	provider, err := newFakeCAProvider()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	RegisterCAProvider("fake", provider)
+
+	registered, err := GetCAProvider("fake")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(registered).To(Equal(provider))
+
+	_, err = GetCAProvider("missing")
+	g.Expect(err).To(MatchError(ErrCAProviderNotFound))
+}
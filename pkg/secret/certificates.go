@@ -214,6 +214,27 @@ func NewCertificatesForLegacyControlPlane() Certificates {
 	return certificates
 }
 
+// NewCertificatesForExternalEtcdControlPlane returns a list of certificates configured for a control plane node using
+// an external etcd, excluding etcd certificates set: the etcd CA and client certificate are supplied by the user.
+func NewCertificatesForExternalEtcdControlPlane() Certificates {
+	certificatesDir := DefaultCertificatesDir
+
+	certificates := Certificates{
+		&ManagedCertificate{
+			Purpose:  ClusterCA,
+			CertFile: filepath.Join(certificatesDir, "server-ca.crt"),
+			KeyFile:  filepath.Join(certificatesDir, "server-ca.key"),
+		},
+		&ManagedCertificate{
+			Purpose:  ClientClusterCA,
+			CertFile: filepath.Join(certificatesDir, "client-ca.crt"),
+			KeyFile:  filepath.Join(certificatesDir, "client-ca.key"),
+		},
+	}
+
+	return certificates
+}
+
 // GetByPurpose returns a certificate by the given name.
 // This could be removed if we use a map instead of a slice to hold certificates, however other code becomes more complex.
 func (c Certificates) GetByPurpose(purpose Purpose) Certificate {
@@ -247,6 +268,35 @@ func (c Certificates) Lookup(ctx context.Context, ctrlclient client.Reader, clus
 	return nil
 }
 
+// LookupAll looks up the secrets of all the certificates in one pass, populates the certificates with the secret data
+// and returns their key pairs by purpose, so they can be reused for the rest of the reconcile. Unlike Lookup, it does
+// not stop at the first missing secret: certificates without secret, external or not, are left untouched and are
+// missing from the returned key pairs, so the caller can tell which ones are missing.
+func (c Certificates) LookupAll(ctx context.Context, ctrlclient client.Reader, clusterName client.ObjectKey) (map[Purpose]*certs.KeyPair, error) {
+	keyPairs := make(map[Purpose]*certs.KeyPair, len(c))
+
+	for _, certificate := range c {
+		s, err := certificate.Lookup(ctx, ctrlclient, clusterName)
+		if apierrors.IsNotFound(err) || (err == nil && s == nil) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		kp, err := secretToKeyPair(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid secret %s", client.ObjectKeyFromObject(s))
+		}
+
+		certificate.SetKeyPair(kp)
+		keyPairs[certificate.GetPurpose()] = kp
+	}
+
+	return keyPairs, nil
+}
+
 // Generate will generate any certificates that do not have KeyPair data.
 func (c *ManagedCertificate) Generate() error {
 	// Do not generate the APIServerEtcdClient key pair. It is user supplied
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secret
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/cluster-api/util/certs"
+)
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		purpose  Purpose
+		expected string
+	}{
+		{purpose: EtcdCA, expected: "cluster-peer-etcd"},
+		{purpose: EtcdServerCA, expected: "cluster-etcd"},
+		{purpose: ClusterCA, expected: "cluster-ca"},
+		{purpose: ClientClusterCA, expected: "cluster-cca"},
+		{purpose: APIServerEtcdClient, expected: "cluster-apiserver-etcd-client"},
+		{purpose: ServiceAccount, expected: "cluster-sa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.purpose), func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(Name("cluster", tt.purpose)).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestCertificatesLookupAll(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "cluster"}
+	certificateSecret := func(purpose Purpose) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: clusterKey.Namespace, Name: Name(clusterKey.Name, purpose)},
+			Data: map[string][]byte{
+				TLSCrtDataName: []byte(string(purpose) + "-cert"),
+				TLSKeyDataName: []byte(string(purpose) + "-key"),
+			},
+		}
+	}
+
+	cl := fake.NewClientBuilder().WithObjects(
+		certificateSecret(ClusterCA),
+		certificateSecret(ClientClusterCA),
+		certificateSecret(EtcdServerCA),
+	).Build()
+
+	// The etcd peer CA is missing, the lookup goes on with the next certificates.
+	certificates := NewCertificatesForInitialControlPlane()
+
+	keyPairs, err := certificates.LookupAll(context.Background(), cl, clusterKey)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(keyPairs).To(Equal(map[Purpose]*certs.KeyPair{
+		ClusterCA:       {Cert: []byte("ca-cert"), Key: []byte("ca-key")},
+		ClientClusterCA: {Cert: []byte("cca-cert"), Key: []byte("cca-key")},
+		EtcdServerCA:    {Cert: []byte("etcd-cert"), Key: []byte("etcd-key")},
+	}))
+
+	for purpose, keyPair := range keyPairs {
+		g.Expect(certificates.GetByPurpose(purpose).GetKeyPair()).To(BeIdenticalTo(keyPair))
+	}
+
+	g.Expect(certificates.GetByPurpose(EtcdCA).GetKeyPair()).To(BeNil())
+}
+
+func TestLookupOrGenerateExternalEtcd(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterKey := client.ObjectKey{Namespace: "default", Name: "cluster"}
+	cl := fake.NewClientBuilder().Build()
+
+	certificates := NewCertificatesForExternalEtcdControlPlane()
+	g.Expect(certificates.LookupOrGenerate(context.Background(), cl, clusterKey, metav1.OwnerReference{})).To(Succeed())
+
+	secrets := &corev1.SecretList{}
+	g.Expect(cl.List(context.Background(), secrets)).To(Succeed())
+
+	names := []string{}
+	for _, s := range secrets.Items {
+		names = append(names, s.Name)
+	}
+
+	// The etcd CAs are supplied by the user along with the external etcd, they must not be generated.
+	g.Expect(names).To(ConsistOf(Name(clusterKey.Name, ClusterCA), Name(clusterKey.Name, ClientClusterCA)))
+	g.Expect(certificates.GetByPurpose(EtcdServerCA)).To(BeNil())
+	g.Expect(certificates.GetByPurpose(EtcdCA)).To(BeNil())
+}
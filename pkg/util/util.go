@@ -21,8 +21,10 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"math"
 	"regexp"
+	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/version"
@@ -115,7 +117,7 @@ func TokenName(clusterName string) string {
 
 // Rke2ToKubeVersion converts an RKE2 version to a Kubernetes version.
 func Rke2ToKubeVersion(rk2Version string) (kubeVersion string, err error) {
-	regexStr := "v(\\d\\.\\d{2}\\.\\d)\\+rke2r\\d"
+	regexStr := "v(\\d+\\.\\d+\\.\\d+)\\+rke2r\\d+"
 
 	var regex *regexp.Regexp
 
@@ -131,13 +133,37 @@ func Rke2ToKubeVersion(rk2Version string) (kubeVersion string, err error) {
 
 // IsRKE2Version checks if a string is an RKE2 version.
 func IsRKE2Version(rke2Version string) bool {
-	regexStr := "v(\\d\\.\\d{2}\\.\\d)\\+rke2r\\d"
+	regexStr := "v(\\d+\\.\\d+\\.\\d+)\\+rke2r\\d+"
 
 	regex, _ := regexp.Compile(regexStr)
 
 	return regex.MatchString(rke2Version)
 }
 
+// imageTagVersionRegexp matches the RKE2 version of an image tag, e.g. "v1.30.2-rke2r1" or "v1.30.2-rke2r1-windows-amd64".
+var imageTagVersionRegexp = regexp.MustCompile(`^v?(\d+\.\d+\.\d+)[-+]rke2r(\d+)(-.+)?$`)
+
+// VersionFromImageRef returns the RKE2 version, e.g. "v1.30.2+rke2r1", an RKE2 image reference, e.g.
+// "rancher/rke2-runtime:v1.30.2-rke2r1", is tagged with. As "+" is not allowed in image tags, RKE2 images use a
+// "-rke2rN" suffix instead, and platform suffixes, e.g. "-windows-amd64", as well as digests are ignored. An error
+// is returned if the reference has no tag, or its tag is not an RKE2 version.
+func VersionFromImageRef(imageRef string) (string, error) {
+	ref, _, _ := strings.Cut(strings.TrimSpace(imageRef), "@")
+
+	// A colon before the last slash separates the port of the registry, not the tag.
+	_, tag, found := strings.Cut(ref[strings.LastIndex(ref, "/")+1:], ":")
+	if !found || tag == "" {
+		return "", fmt.Errorf("image reference %q has no tag", imageRef)
+	}
+
+	match := imageTagVersionRegexp.FindStringSubmatch(tag)
+	if match == nil {
+		return "", fmt.Errorf("tag %q of image reference %q is not an RKE2 version", tag, imageRef)
+	}
+
+	return fmt.Sprintf("v%s+rke2r%s", match[1], match[2]), nil
+}
+
 // AppendIfNotPresent appends a string to a slice only if the value does not already exist.
 func AppendIfNotPresent(origSlice []string, strItem string) (resultSlice []string) {
 	present := false
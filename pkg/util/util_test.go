@@ -39,3 +39,36 @@ var _ = Describe("Testing IsRKE2Version", func() {
 		Expect(IsRKE2Version(k8sVersion)).To(BeFalse())
 	})
 })
+
+var _ = Describe("Testing VersionFromImageRef", func() {
+	It("Should parse the RKE2 version of common tag formats", func() {
+		for ref, expected := range map[string]string{
+			"rancher/rke2-runtime:v1.30.2-rke2r1":                                   "v1.30.2+rke2r1",
+			"docker.io/rancher/rke2-runtime:v1.30.2-rke2r12":                        "v1.30.2+rke2r12",
+			"registry.example.com:5000/rancher/rke2-runtime:v1.29.10-rke2r1":        "v1.29.10+rke2r1",
+			"rancher/rke2-runtime:v1.30.2-rke2r1-windows-amd64":                     "v1.30.2+rke2r1",
+			"rancher/rke2-runtime:v1.30.2+rke2r1":                                   "v1.30.2+rke2r1",
+			"rancher/rke2-runtime:1.30.2-rke2r2":                                    "v1.30.2+rke2r2",
+			"rancher/rke2-runtime:v1.30.2-rke2r1@sha256:0123456789abcdef0123456789": "v1.30.2+rke2r1",
+		} {
+			version, err := VersionFromImageRef(ref)
+			Expect(err).ToNot(HaveOccurred(), ref)
+			Expect(version).To(Equal(expected), ref)
+			Expect(IsRKE2Version(version)).To(BeTrue(), ref)
+		}
+	})
+
+	It("Should fail on references without RKE2 version tag", func() {
+		for _, ref := range []string{
+			"",
+			"rancher/rke2-runtime",
+			"registry.example.com:5000/rancher/rke2-runtime",
+			"rancher/rke2-runtime@sha256:0123456789abcdef0123456789",
+			"rancher/rke2-runtime:latest",
+			"rancher/rke2-runtime:v1.30.2",
+		} {
+			_, err := VersionFromImageRef(ref)
+			Expect(err).To(HaveOccurred(), ref)
+		}
+	})
+})